@@ -1,15 +1,67 @@
 package main
 
 import (
+	"auth_service/internal/accounts"
+	"auth_service/internal/acme"
+	"auth_service/internal/analytics"
+	"auth_service/internal/audit"
+	"auth_service/internal/auditlog"
+	"auth_service/internal/bus"
+	busfactory "auth_service/internal/bus/factory"
+	"auth_service/internal/captcha"
+	"auth_service/internal/clientip"
 	"auth_service/internal/config"
-	"auth_service/internal/database"
+	"auth_service/internal/geo"
+	"auth_service/internal/grpcapi"
 	"auth_service/internal/handlers"
+	"auth_service/internal/health"
+	"auth_service/internal/i18n"
+	"auth_service/internal/jobs"
+	"auth_service/internal/lockout"
+	"auth_service/internal/maintenance"
 	"auth_service/internal/migrations"
-	"auth_service/internal/storage/postgres"
+	"auth_service/internal/mtls"
+	"auth_service/internal/notify"
+	"auth_service/internal/outbox"
+	"auth_service/internal/passwordexpiry"
+	"auth_service/internal/profiling"
+	"auth_service/internal/pwned"
+	"auth_service/internal/quota"
+	"auth_service/internal/ratelimit"
+	"auth_service/internal/refreshlimit"
+	"auth_service/internal/revocation"
+	"auth_service/internal/security"
+	"auth_service/internal/selfcheck"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/services/cleanup"
+	"auth_service/internal/services/tokens"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/factory"
+	"auth_service/internal/systemd"
+	"auth_service/internal/tlsconfig"
+	"auth_service/internal/tracing"
+	"auth_service/internal/usage"
+	"auth_service/internal/webhook"
 	"auth_service/lib/logger/sl"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
+	"maps"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -19,46 +71,930 @@ const (
 )
 
 func main() {
+	dev := flag.Bool("dev", false, "start with in-memory storage, a generated JWT secret and a test user")
+	flag.Parse()
+
 	// Загрузка конфигурации
-	cfg := config.MustLoad()
+	var cfg *config.Config
+	if *dev {
+		cfg = config.MustLoadDev()
+	} else {
+		cfg = config.MustLoad()
+	}
 
 	// Настройка логгера
 	log := setupLogger(cfg.Env)
 
+	hasher, err := passwordHasher(cfg.Security)
+	if err != nil {
+		log.Error("Invalid security configuration", sl.Err(err))
+		os.Exit(1)
+	}
+	tokens.SetPasswordHasher(hasher)
+	pepper, err := passwordPepper(cfg.Security.Pepper)
+	if err != nil {
+		log.Error("Invalid password pepper configuration", sl.Err(err))
+		os.Exit(1)
+	}
+	tokens.SetPepper(pepper)
+	setupBreachedPasswords(cfg.Security.BreachedPasswords)
+
+	// Подкоманды CLI
+	if args := flag.Args(); len(args) > 0 {
+		var err error
+		switch args[0] {
+		case "migrate":
+			err = runMigrate(args[1:], cfg, log)
+		case "seed":
+			err = runSeed(args[1:], cfg, log)
+		default:
+			err = fmt.Errorf("unknown command %q", args[0])
+		}
+		if err != nil {
+			log.Error("Command failed", slog.String("command", args[0]), sl.Err(err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Info("Starting auth_service...", slog.String("env", cfg.Env))
 	log.Debug("Debug messages are enabled")
 
-	// Инициализация БД
-	pool, err := database.InitDB(cfg, log)
+	// Проверка настроек безопасности; в prod небезопасная конфигурация останавливает запуск.
+	if err := selfcheck.Run(cfg, log); err != nil {
+		log.Error("Insecure configuration, refusing to start", sl.Err(err))
+		os.Exit(1)
+	}
+	if cfg.HTTPServer.ShutdownTimeout <= 0 {
+		log.Error("Invalid HTTP server configuration: shutdown_timeout must be positive",
+			slog.Duration("shutdown_timeout", cfg.HTTPServer.ShutdownTimeout))
+		os.Exit(1)
+	}
+	if cfg.OpsServer.PProf && cfg.OpsServer.Address == "" {
+		// Профили не должны отдаваться на адресе, открытом клиентам API.
+		log.Error("Invalid ops server configuration: pprof requires ops_server.address")
+		os.Exit(1)
+	}
+	if *dev {
+		log.Warn("Running in dev mode: in-memory storage, generated JWT secret",
+			slog.String("test_user_id", config.DevUserID),
+		)
+	}
+
+	// Трассировка запросов
+	var traceExporter *tracing.OTLPExporter
+	if cfg.Tracing.Enabled {
+		if ratio := cfg.Tracing.SampleRatio; ratio < 0 || ratio > 1 {
+			log.Error("Invalid tracing configuration: sample_ratio must be between 0 and 1", slog.Float64("sample_ratio", ratio))
+			os.Exit(1)
+		}
+		traceExporter, err = tracing.NewOTLPExporter(log, tracing.OTLPConfig{
+			Endpoint:     cfg.Tracing.Endpoint,
+			Headers:      cfg.Tracing.Headers,
+			ServiceName:  cfg.Tracing.ServiceName,
+			BatchTimeout: cfg.Tracing.BatchTimeout,
+			MaxQueueSize: cfg.Tracing.MaxQueueSize,
+		})
+		if err != nil {
+			log.Error("Invalid tracing configuration", sl.Err(err))
+			os.Exit(1)
+		}
+		tracing.Set(traceExporter, cfg.Tracing.SampleRatio)
+		log.Info("Tracing enabled", slog.String("endpoint", cfg.Tracing.Endpoint), slog.Float64("sample_ratio", cfg.Tracing.SampleRatio))
+	}
+
+	// Создание экземпляра хранилища
+	backend, err := factory.New(cfg, log)
 	if err != nil {
-		log.Error("Failed to connect to database: %v", sl.Err(err))
+		log.Error("Failed to initialize storage", sl.Err(err))
 		os.Exit(1)
 	}
-	defer pool.Close()
+	store := backend.Storage
 
 	// Инициализация и запуск миграций
-	migrations.InitAndRunMigrations(cfg, log)
+	if backend.Pool != nil {
+		if err := migrations.InitAndRunMigrations(cfg, log); err != nil {
+			log.Error("Failed to run migrations", sl.Err(err))
+			os.Exit(1)
+		}
+	}
 
-	// Создание экземпляра хранилища
-	storage := postgres.NewPostgresStorage(pool)
+	// Контекст отменяется сигналом остановки (SIGTERM от systemd, Docker или Ctrl+C).
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
 
-	// Маршруты
-	http.HandleFunc("/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
-		handlers.GenerateTokensHandler(w, r, log, cfg, storage)
-	})
-	http.HandleFunc("/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
-		handlers.RefreshTokensHandler(w, r, log, cfg, storage)
+	// Фоновые задачи
+	var locker jobs.Locker = jobs.NewLocalLocker()
+	if backend.Pool != nil {
+		locker = jobs.NewPostgresLocker(backend.Pool)
+	}
+	scheduler := jobs.NewScheduler(log, locker)
+	addJob := func(job jobs.Job) {
+		if err := scheduler.Add(job); err != nil {
+			log.Error("Invalid background job configuration", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+	if cfg.Cleanup.Enabled {
+		if cfg.Cleanup.Retention.EndedSessions > 0 && cfg.Storage.Driver == factory.DriverRedis {
+			log.Warn("Ended session retention is not supported by the redis driver, sessions are removed by TTL")
+		}
+		tokenCleanup := cleanup.New(backend.Cleaner, log, cfg.Cleanup.BatchSize).
+			WithIdleTimeout(cfg.Session.IdleTimeout).
+			WithRetention(cfg.Cleanup.Retention.EndedSessions)
+		addJob(jobs.Job{
+			Name:     "token_cleanup",
+			Interval: cfg.Cleanup.Interval,
+			Run: func(ctx context.Context) error {
+				deleted, err := tokenCleanup.RunOnce(ctx)
+				if err == nil {
+					log.Info("Expired tokens cleaned up", slog.Int64("deleted", deleted))
+				}
+				return err
+			},
+		})
+	}
+	lockoutPolicy := lockout.Policy{
+		MaxAccountFailures: cfg.LoginLockout.MaxAccountFailures,
+		MaxIPFailures:      cfg.LoginLockout.MaxIPFailures,
+		BaseLockout:        cfg.LoginLockout.BaseLockout,
+		MaxLockout:         cfg.LoginLockout.MaxLockout,
+		ResetAfter:         cfg.LoginLockout.ResetAfter,
+	}
+	if err := lockout.Set(backend.LoginAttempts, lockoutPolicy); err != nil {
+		log.Error("Invalid login lockout configuration", sl.Err(err))
+		os.Exit(1)
+	}
+	if lockoutPolicy.Enabled() && backend.LoginAttempts == nil {
+		log.Warn("Login lockout is not supported by the storage driver and is not enforced")
+	} else if lockoutPolicy.Enabled() {
+		addJob(jobs.Job{
+			Name:     "login_attempts_cleanup",
+			Interval: cfg.Cleanup.Interval,
+			Run: func(ctx context.Context) error {
+				_, err := lockout.Prune(cfg.Cleanup.BatchSize)
+				return err
+			},
+		})
+	}
+	if err := setupCaptcha(cfg.Captcha, lockoutPolicy.Enabled() && backend.LoginAttempts != nil); err != nil {
+		log.Error("Invalid captcha configuration", sl.Err(err))
+		os.Exit(1)
+	}
+	if backend.Reencryptor != nil {
+		addJob(jobs.Job{
+			Name:     "column_reencryption",
+			Interval: cfg.Storage.Encryption.ReencryptInterval,
+			Run: func(ctx context.Context) error {
+				updated, err := backend.Reencryptor.ReencryptColumns(cfg.Cleanup.BatchSize)
+				if err == nil && updated > 0 {
+					log.Info("Columns re-encrypted with primary key", slog.Int64("updated", updated))
+				}
+				return err
+			},
+		})
+	}
+	if backend.Usage != nil {
+		usage.SetStore(backend.Usage)
+		// Каждая реплика записывает свои счётчики, поэтому задача выполняется без блокировки.
+		addJob(jobs.Job{
+			Name:     "usage_flush",
+			Interval: cfg.Usage.FlushInterval,
+			Local:    true,
+			Run: func(ctx context.Context) error {
+				_, err := usage.Flush(ctx)
+				return err
+			},
+		})
+	} else {
+		log.Warn("Usage statistics are not supported by the storage driver, only Prometheus metrics are collected")
+	}
+	if cfg.Analytics.Enabled && backend.Analytics != nil {
+		analytics.SetStore(backend.Analytics)
+		addJob(jobs.Job{
+			Name:     "stats_rollup",
+			Interval: cfg.Analytics.Interval,
+			Run: func(ctx context.Context) error {
+				_, err := analytics.Rollup(ctx, time.Now())
+				return err
+			},
+		})
+	}
+	// Обработчики событий безопасности после записи в лог.
+	var sinks []security.Sink
+	if cfg.AuditExport.Enabled {
+		if backend.Audit == nil {
+			log.Warn("Audit log is not supported by the storage driver, audit export is disabled")
+		} else {
+			exportCfg := cfg.AuditExport
+			objects, err := audit.NewS3(audit.S3Config{
+				Endpoint:        exportCfg.ObjectStorage.Endpoint,
+				Region:          exportCfg.ObjectStorage.Region,
+				Bucket:          exportCfg.ObjectStorage.Bucket,
+				AccessKeyID:     exportCfg.ObjectStorage.AccessKeyID,
+				SecretAccessKey: exportCfg.ObjectStorage.SecretAccessKey,
+				PathStyle:       exportCfg.ObjectStorage.PathStyle,
+			}, exportCfg.Timeout)
+			var exporter *audit.Exporter
+			if err == nil {
+				exporter, err = audit.NewExporter(log, backend.Audit, objects, exportCfg.ObjectStorage.Prefix, exportCfg.Format, exportCfg.BatchSize)
+			}
+			if err != nil {
+				log.Error("Invalid audit export configuration", sl.Err(err))
+				os.Exit(1)
+			}
+			sinks = append(sinks, audit.NewSink(backend.Audit))
+			addJob(jobs.Job{
+				Name:     "audit_export",
+				Interval: exportCfg.Interval,
+				Run: func(ctx context.Context) error {
+					exported, err := exporter.Export(ctx)
+					if exported > 0 {
+						log.Info("Audit events exported", slog.Int("exported", exported))
+					}
+					if err != nil || exportCfg.Retention <= 0 {
+						return err
+					}
+					_, err = exporter.Prune(exportCfg.Retention, cfg.Cleanup.BatchSize)
+					return err
+				},
+			})
+		}
+	}
+
+	// Очередь доступна и без получателей, чтобы недоставленные можно было просмотреть.
+	webhook.SetQueue(backend.Webhooks)
+	if len(cfg.Webhooks.Endpoints) > 0 {
+		endpoints := make([]webhook.Endpoint, 0, len(cfg.Webhooks.Endpoints))
+		for _, e := range cfg.Webhooks.Endpoints {
+			endpoints = append(endpoints, webhook.Endpoint{Name: e.Name, URL: e.URL, Secrets: e.Secrets, Events: e.Events})
+		}
+		retry := webhook.Retry{
+			MaxAttempts:    cfg.Webhooks.Retry.MaxAttempts,
+			InitialBackoff: cfg.Webhooks.Retry.InitialBackoff,
+			MaxBackoff:     cfg.Webhooks.Retry.MaxBackoff,
+		}
+		webhooks, err := webhook.New(log, endpoints, cfg.Webhooks.Timeout)
+		if err == nil {
+			err = retry.Validate(cfg.Webhooks.Timeout)
+		}
+		if err != nil {
+			log.Error("Invalid webhooks configuration", sl.Err(err))
+			os.Exit(1)
+		}
+		webhooks.WithRetry(retry)
+		sinks = append(sinks, webhooks)
+
+		if backend.Webhooks != nil {
+			addJob(jobs.Job{
+				Name:     "webhook_delivery",
+				Interval: cfg.Webhooks.Retry.Interval,
+				Run: func(ctx context.Context) error {
+					if _, err := webhooks.ProcessDue(ctx, cfg.Cleanup.BatchSize); err != nil {
+						return err
+					}
+					_, err := webhook.PurgeDelivered(time.Now().Add(-cfg.Webhooks.Retry.DeliveredRetention), cfg.Cleanup.BatchSize)
+					return err
+				},
+			})
+		} else {
+			log.Warn("Webhook delivery queue is not supported by the storage driver, failed deliveries are not retried")
+		}
+	}
+	publisher, err := busfactory.New(cfg.MessageBus)
+	if err != nil {
+		log.Error("Invalid message bus configuration", sl.Err(err))
+		os.Exit(1)
+	}
+	if publisher != nil {
+		defer publisher.Close()
+		sinks = append(sinks, bus.NewSink(publisher, cfg.MessageBus.Events))
+		log.Info("Publishing events to message bus", slog.String("driver", cfg.MessageBus.Driver))
+	}
+	auditlog.Set(backend.AuditTrail, handlers.IPPrivacy(cfg))
+	if backend.AuditTrail != nil {
+		sinks = append(sinks, auditlog.NewSink())
+	} else {
+		log.Warn("Audit log is not supported by the storage driver, actions are not recorded")
+	}
+	security.SetSinks(sinks...)
+	var outboxStore storage.Outbox
+	if cfg.Outbox.Enabled {
+		if backend.Outbox == nil {
+			log.Warn("Outbox is not supported by the storage driver, events are delivered without it")
+		} else {
+			backoff := outbox.Backoff{Initial: cfg.Outbox.InitialBackoff, Max: cfg.Outbox.MaxBackoff}
+			if err := backoff.Validate(); err != nil {
+				log.Error("Invalid outbox configuration", sl.Err(err))
+				os.Exit(1)
+			}
+			outboxStore = backend.Outbox
+			relay := outbox.NewRelay(log, backend.Outbox, security.NewDefaultPipeline(log), backoff)
+			addJob(jobs.Job{
+				Name:     "outbox_relay",
+				Interval: cfg.Outbox.Interval,
+				Run: func(ctx context.Context) error {
+					_, err := relay.ProcessDue(ctx, cfg.Cleanup.BatchSize)
+					return err
+				},
+			})
+		}
+	}
+	if err := tokens.SetAccessTokenTTL(cfg.Session.AccessTokenTTL); err != nil {
+		log.Error("Invalid session configuration", sl.Err(err))
+		os.Exit(1)
+	}
+	tokens.SetIssuer(cfg.AccessTokenSigning.Issuer, cfg.AccessTokenSigning.Audience)
+
+	switch cfg.AccessTokenSigning.Algorithm {
+	case tokens.AlgorithmHS512:
+	case tokens.AlgorithmRS256, tokens.AlgorithmES256, tokens.AlgorithmEdDSA:
+		signer, err := tokens.LoadSigner(cfg.AccessTokenSigning.Algorithm, cfg.AccessTokenSigning.PrivateKeyFile, cfg.AccessTokenSigning.KeyID)
+		if err != nil {
+			log.Error("Failed to configure access token signing", sl.Err(err))
+			os.Exit(1)
+		}
+		tokens.SetSigner(signer)
+		log.Info("Access tokens are signed with private key",
+			slog.String("algorithm", cfg.AccessTokenSigning.Algorithm),
+			slog.String("kid", signer.KeyID()))
+
+		previous := make([]tokens.PublicKey, 0, len(cfg.AccessTokenSigning.PreviousPublicKeyFiles))
+		for _, path := range cfg.AccessTokenSigning.PreviousPublicKeyFiles {
+			key, err := tokens.LoadPublicKey(path, "")
+			if err != nil {
+				log.Error("Failed to load previous access token signing key", sl.Err(err))
+				os.Exit(1)
+			}
+			previous = append(previous, key)
+		}
+		tokens.SetPreviousKeys(previous)
+		tokens.SetLegacyHS512Until(cfg.AccessTokenSigning.AcceptLegacyHS512Until)
+	default:
+		log.Error("Unsupported access token signing algorithm",
+			slog.String("algorithm", cfg.AccessTokenSigning.Algorithm),
+			slog.String("expected", strings.Join([]string{tokens.AlgorithmHS512, tokens.AlgorithmRS256, tokens.AlgorithmES256, tokens.AlgorithmEdDSA}, ", ")))
+		os.Exit(1)
+	}
+
+	if cfg.TokenEncryption.Enabled {
+		key, err := tokens.ParseEncryptionKey(cfg.TokenEncryption.Key)
+		if err == nil {
+			err = tokens.SetEncryptionKey(key)
+		}
+		if err != nil {
+			log.Error("Failed to configure access token encryption", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	if _, err := clientip.NewResolver(cfg.HTTPServer.TrustedProxies); err != nil {
+		log.Error("Invalid HTTP server configuration", sl.Err(err))
+		os.Exit(1)
+	}
+
+	ipPrivacy := handlers.IPPrivacy(cfg)
+	if err := ipPrivacy.Validate(); err != nil {
+		log.Error("Invalid IP privacy configuration", sl.Err(err))
+		os.Exit(1)
+	}
+
+	ipGranularity := handlers.IPGranularity(cfg)
+	if err := ipGranularity.Validate(); err != nil {
+		log.Error("Invalid session configuration", sl.Err(err))
+		os.Exit(1)
+	}
+
+	if dir := cfg.I18n.Dir; dir != "" {
+		if err := i18n.LoadDir(dir); err != nil {
+			log.Error("Failed to load message catalogs", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	if dir := cfg.Notifications.TemplatesDir; dir != "" {
+		if err := notify.LoadDir(dir); err != nil {
+			log.Error("Failed to load email templates", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+	if locale := cfg.Notifications.DefaultLocale; locale != "" {
+		if err := notify.SetDefaultLocale(locale); err != nil {
+			log.Error("Invalid notifications configuration", sl.Err(err))
+			os.Exit(1)
+		}
+	}
+	notify.SetVariables(cfg.Notifications.Variables)
+
+	geoRules := handlers.GeoRules(cfg)
+	if err := geoRules.Validate(); err != nil {
+		log.Error("Invalid geo restrictions", sl.Err(err))
+		os.Exit(1)
+	}
+	if path := cfg.GeoRestrictions.Database; path != "" {
+		geoDB, err := geo.Open(path)
+		if err != nil {
+			log.Error("Failed to load geoip database", sl.Err(err))
+			os.Exit(1)
+		}
+		geo.SetDatabase(geoDB)
+	} else if geoRules.Enabled() {
+		log.Warn("Geo restrictions are set without a geoip database, client countries are unknown")
+	}
+
+	if err := security.Actions(cfg.SecurityActions).Validate(); err != nil {
+		log.Error("Invalid security actions", sl.Err(err))
+		os.Exit(1)
+	}
+
+	if err := maintenance.Set(maintenance.State{
+		Enabled:    cfg.Maintenance.Enabled,
+		RetryAfter: int(cfg.Maintenance.RetryAfter.Round(time.Second).Seconds()),
+	}); err != nil {
+		log.Error("Invalid maintenance configuration", sl.Err(err))
+		os.Exit(1)
+	}
+
+	// Зависимости, проверяемые GET /readyz.
+	var readinessChecks []health.Check
+	if backend.Pool != nil {
+		readinessChecks = append(readinessChecks, health.Check{Name: "postgres", Probe: backend.Pool.Ping})
+	}
+	if cfg.Storage.Driver == factory.DriverRedis {
+		readinessChecks = append(readinessChecks, health.Check{Name: "redis", Probe: backend.Ping})
+	}
+	health.SetChecks(cfg.Readiness.Timeout, readinessChecks...)
+	if cfg.Maintenance.Enabled {
+		log.Warn("Maintenance mode is enabled, token issuance and refresh are rejected")
+	}
+
+	quotas := quota.Limits{RequestsPerMinute: cfg.Quotas.RequestsPerMinute, MaxSessions: cfg.Quotas.MaxSessions}
+	if err := quota.SetLimits(quotas); err != nil {
+		log.Error("Invalid quotas", sl.Err(err))
+		os.Exit(1)
+	}
+	quota.SetSessionCounter(backend.Sessions)
+	limiter, err := ratelimit.New(ratelimit.Config{
+		RequestsPerMinute: cfg.RateLimit.RequestsPerMinute,
+		Burst:             cfg.RateLimit.Burst,
+		IPv6Prefix:        cfg.RateLimit.IPv6Prefix,
+		Exempt:            cfg.RateLimit.Exempt,
 	})
+	if err != nil {
+		log.Error("Invalid rate limit", sl.Err(err))
+		os.Exit(1)
+	}
+	ratelimit.Set(limiter)
+	refreshLimits := refreshlimit.Limits{
+		MaxFailures: cfg.RefreshLimit.MaxFailures,
+		Window:      cfg.RefreshLimit.Window,
+		Cooldown:    cfg.RefreshLimit.Cooldown,
+	}
+	if err := refreshlimit.Set(backend.RefreshFailures, refreshLimits); err != nil {
+		log.Error("Invalid refresh limit", sl.Err(err))
+		os.Exit(1)
+	}
+	if refreshLimits.MaxFailures > 0 && backend.RefreshFailures == nil {
+		log.Warn("Refresh limit is not supported by the storage driver and is not enforced")
+	}
+	expiryPolicy := passwordexpiry.Policy{
+		MaxAge:       cfg.Security.PasswordExpiry.MaxAge,
+		RefreshGrace: cfg.Security.PasswordExpiry.RefreshGrace,
+	}
+	if err := passwordexpiry.Set(backend.Passwords, expiryPolicy); err != nil {
+		log.Error("Invalid password expiry policy", sl.Err(err))
+		os.Exit(1)
+	}
+	if expiryPolicy.Enabled() && backend.Passwords == nil {
+		log.Warn("Password expiry is not supported by the storage driver and is not enforced")
+	}
+	if quotas.MaxSessions > 0 && backend.Sessions == nil {
+		log.Warn("Session quota is not supported by the storage driver and is not enforced")
+	}
+
+	sessionPolicy := handlers.SessionPolicy(cfg)
+	if err := sessionPolicy.Validate(); err != nil {
+		log.Error("Invalid session configuration", sl.Err(err))
+		os.Exit(1)
+	}
+
+	authService := auth.New(log, store, cfg.JWTSecret).
+		WithRefreshSecret(cfg.RefreshTokenSecret).
+		WithSessionPolicy(sessionPolicy).
+		WithStrictValidation(cfg.AccessTokenDenylist.Strict).
+		WithIPGranularity(ipGranularity).
+		WithGeoRules(geoRules).
+		WithIPPrivacy(ipPrivacy).
+		WithRiskActions(cfg.SecurityActions).
+		WithSessionFinder(backend.Finder).
+		WithRevocationPublisher(backend.Revocations).
+		WithOutbox(outboxStore)
+	revocation.Set(authService, cfg.Session.RevocationBatchSize)
+	accounts.Set(store, backend.Accounts)
+
+	// Задачи запускаются после настройки токенов и пакетов, которыми они пользуются.
+	scheduler.Start(ctx)
+
+	// TLS и проверка клиентских сертификатов внутренних сервисов
+	var serverTLS *tls.Config
+	var clientAuth tls.ClientAuthType
+	var grpcOpts []grpc.ServerOption
+	if cfg.MTLS.Enabled {
+		authorizer, err := handlers.Authorizer(cfg)
+		if err != nil {
+			log.Error("Invalid mTLS identities", sl.Err(err))
+			os.Exit(1)
+		}
+		serverTLS, err = mtls.ServerTLSConfig(cfg.MTLS.CertFile, cfg.MTLS.KeyFile, cfg.MTLS.ClientCAFile)
+		if err == nil {
+			clientAuth, err = mtls.ParseClientAuth(cfg.MTLS.ClientAuth)
+		}
+		if err != nil {
+			log.Error("Invalid mTLS configuration", sl.Err(err))
+			os.Exit(1)
+		}
+		// gRPC API вызывают только внутренние сервисы.
+		grpcTLS := serverTLS.Clone()
+		grpcTLS.ClientAuth = clientAuth
+		grpcOpts = append(grpcOpts,
+			grpc.Creds(credentials.NewTLS(grpcTLS)),
+			grpc.ChainUnaryInterceptor(authorizer.UnaryServerInterceptor(grpcapi.MethodScopes)),
+		)
+	}
+
+	// TLS HTTP-сервера. С mTLS публичный API предъявляет сертификат
+	// http_server.tls, а клиентские сертификаты проверяются так же, как с
+	// сертификатом mTLS.
+	httpTLS := serverTLS
+	var acmeManager *autocert.Manager
+	tlsCfg := cfg.HTTPServer.TLS
+	if tlsCfg.ACME.Enabled && !tlsCfg.Enabled {
+		log.Error("Invalid HTTP server TLS configuration: acme requires http_server.tls.enabled")
+		os.Exit(1)
+	}
+	if tlsCfg.Enabled && tlsCfg.ACME.Enabled {
+		httpTLS, acmeManager, err = acmeTLS(tlsCfg, backend.ACME)
+		if err != nil {
+			log.Error("Invalid HTTP server TLS configuration", sl.Err(err))
+			os.Exit(1)
+		}
+	} else if tlsCfg.Enabled {
+		var reloader *tlsconfig.Reloader
+		httpTLS, reloader, err = tlsconfig.New(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.MinVersion, tlsCfg.CipherSuites)
+		if err != nil {
+			log.Error("Invalid HTTP server TLS configuration", sl.Err(err))
+			os.Exit(1)
+		}
+		// Продлённый сертификат подхватывается без перезапуска: по SIGHUP
+		// и при изменении файлов.
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go reloader.Watch(ctx, log, tlsCfg.ReloadInterval, hup)
+	}
+	if tlsCfg.Enabled {
+		if serverTLS != nil {
+			httpTLS.ClientCAs = serverTLS.ClientCAs
+			httpTLS.ClientAuth = serverTLS.ClientAuth
+		}
+	}
+
+	// Ошибки серверов, из-за которых сервис останавливается раньше сигнала.
+	serveErrs := make(chan error, 4)
+
+	// gRPC API для внутренних сервисов
+	var grpcServer *grpc.Server
+	if cfg.GRPCServer.Enabled {
+		lis, err := net.Listen("tcp", cfg.GRPCServer.Address)
+		if err != nil {
+			log.Error("Failed to listen for gRPC", sl.Err(err))
+			os.Exit(1)
+		}
+		grpcServer = grpcapi.New(log, cfg, authService, grpcOpts...)
+
+		go func() {
+			log.Info("gRPC server is up and running", slog.String("address", cfg.GRPCServer.Address))
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Error("Failed to serve gRPC", sl.Err(err))
+				serveErrs <- fmt.Errorf("gRPC server: %w", err)
+				cancel()
+			}
+		}()
+	}
+
+	// Маршруты
+	router := handlers.NewRouter(log, cfg, authService)
 
 	// Запуск сервера
-	log.Info("Auth service is up and running", slog.String("address", cfg.HTTPServer.Address))
-	if err := http.ListenAndServe(cfg.HTTPServer.Address, nil); err != nil {
+	lis, err := net.Listen("tcp", cfg.HTTPServer.Address)
+	if err != nil {
 		log.Error("Failed to start HTTP server", sl.Err(err))
+		os.Exit(1)
+	}
+	server := &http.Server{
+		Handler:           router,
+		TLSConfig:         httpTLS,
+		ReadTimeout:       cfg.HTTPServer.Timeout,
+		ReadHeaderTimeout: cfg.HTTPServer.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPServer.WriteTimeout,
+		IdleTimeout:       cfg.HTTPServer.IdleTimeout,
+	}
+	go func() {
+		if err := serve(server, lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("Failed to serve HTTP", sl.Err(err))
+			serveErrs <- fmt.Errorf("HTTP server: %w", err)
+			cancel()
+		}
+	}()
+	log.Info("Auth service is up and running", slog.String("address", cfg.HTTPServer.Address), slog.Bool("tls", httpTLS != nil))
+	servers := []*http.Server{server}
+
+	// Проверка HTTP-01 и перенаправление на HTTPS для сертификатов ACME.
+	if acmeManager != nil && tlsCfg.ACME.HTTPAddress != "" {
+		challengeLis, err := net.Listen("tcp", tlsCfg.ACME.HTTPAddress)
+		if err != nil {
+			log.Error("Failed to start ACME challenge server", sl.Err(err))
+			os.Exit(1)
+		}
+		challengeServer := &http.Server{Handler: acmeManager.HTTPHandler(nil), ReadHeaderTimeout: cfg.HTTPServer.ReadHeaderTimeout}
+		go func() {
+			if err := challengeServer.Serve(challengeLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("Failed to serve ACME challenges", sl.Err(err))
+				serveErrs <- fmt.Errorf("ACME challenge server: %w", err)
+				cancel()
+			}
+		}()
+		servers = append(servers, challengeServer)
+		log.Info("ACME challenge server is up and running", slog.String("address", tlsCfg.ACME.HTTPAddress))
+	}
+
+	// Служебные маршруты на отдельном адресе, закрытом от клиентов API.
+	if cfg.OpsServer.Address != "" {
+		opsLis, err := net.Listen("tcp", cfg.OpsServer.Address)
+		if err != nil {
+			log.Error("Failed to start ops server", sl.Err(err))
+			os.Exit(1)
+		}
+		// С mTLS клиентский сертификат нужен для проверки scope admin маршрутов
+		// /admin/*; в режиме required он обязателен уже при рукопожатии.
+		opsTLS := httpTLS
+		if serverTLS != nil {
+			opsTLS = httpTLS.Clone()
+			opsTLS.ClientAuth = clientAuth
+		}
+		// С pprof без WriteTimeout, как у отладочного сервера: профиль CPU
+		// снимается указанное в запросе время (по умолчанию 30 секунд).
+		opsWriteTimeout := cfg.HTTPServer.WriteTimeout
+		if cfg.OpsServer.PProf {
+			opsWriteTimeout = 0
+		}
+		opsServer := &http.Server{
+			Handler:           handlers.NewOpsRouter(log, cfg),
+			TLSConfig:         opsTLS,
+			ReadTimeout:       cfg.HTTPServer.Timeout,
+			ReadHeaderTimeout: cfg.HTTPServer.ReadHeaderTimeout,
+			WriteTimeout:      opsWriteTimeout,
+			IdleTimeout:       cfg.HTTPServer.IdleTimeout,
+		}
+		go func() {
+			if err := serve(opsServer, opsLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("Failed to serve ops HTTP", sl.Err(err))
+				serveErrs <- fmt.Errorf("ops server: %w", err)
+				cancel()
+			}
+		}()
+		servers = append(servers, opsServer)
+		log.Info("Ops server is up and running", slog.String("address", cfg.OpsServer.Address))
+	}
+
+	// Профилирование на отдельном адресе, недоступном клиентам API.
+	var debugServer *http.Server
+	if cfg.DebugServer.Enabled {
+		debugLis, err := net.Listen("tcp", cfg.DebugServer.Address)
+		if err != nil {
+			log.Error("Failed to start debug server", sl.Err(err))
+			os.Exit(1)
+		}
+		if addr, ok := debugLis.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+			log.Warn("Debug server listens on a non-loopback address, restrict access to it",
+				slog.String("address", cfg.DebugServer.Address))
+		}
+		// Без WriteTimeout: профиль CPU снимается указанное в запросе время (по умолчанию 30 секунд).
+		debugServer = &http.Server{Handler: profiling.Handler(), ReadHeaderTimeout: cfg.HTTPServer.ReadHeaderTimeout}
+		go func() {
+			if err := debugServer.Serve(debugLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("Failed to serve debug server", sl.Err(err))
+			}
+		}()
+		log.Info("Debug server is up and running", slog.String("address", cfg.DebugServer.Address))
 	}
 
-	//TODO:
-	// задокументировать код,
+	// Хранилище подключено и сервер принимает соединения: юнит systemd с
+	// Type=notify считается запущенным.
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		log.Warn("Failed to notify systemd", sl.Err(err))
+	}
+	if interval, err := systemd.WatchdogInterval(); err != nil {
+		log.Error("Invalid systemd watchdog settings", sl.Err(err))
+	} else if interval > 0 {
+		go systemd.RunWatchdog(ctx, log, interval, backend.Ping)
+	}
+
+	<-ctx.Done()
+	log.Info("Shutting down auth_service...")
+	if debugServer != nil {
+		// Снимаемые профили не нужно дожидаться.
+		_ = debugServer.Close()
+	}
+	if _, err := systemd.Notify(systemd.Stopping); err != nil {
+		log.Warn("Failed to notify systemd", sl.Err(err))
+	}
+	err = shutdown(cfg.HTTPServer.ShutdownTimeout, servers, grpcServer, scheduler, backend.Close)
+	if err != nil {
+		log.Error("Failed to shut down gracefully", sl.Err(err))
+	}
+	if traceExporter != nil {
+		// Спаны последних запросов отправляются после их завершения.
+		flushCtx, stop := context.WithTimeout(context.Background(), cfg.Tracing.BatchTimeout)
+		if err := traceExporter.Shutdown(flushCtx); err != nil {
+			log.Warn("Failed to export remaining trace spans", sl.Err(err))
+		}
+		stop()
+	}
+	select {
+	case serveErr := <-serveErrs:
+		err = errors.Join(serveErr, err)
+	default:
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+	log.Info("Auth service stopped")
+}
+
+// Принимает соединения HTTP-сервера: по TLS, если задан server.TLSConfig
+// (с согласованием HTTP/2, как ListenAndServeTLS), иначе без шифрования.
+func serve(server *http.Server, lis net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(lis, "", "")
+	}
+	return server.Serve(lis)
+}
+
+// Останавливает сервис: прекращает приём запросов HTTP и gRPC, дожидается
+// завершения обрабатываемых запросов и фоновых задач и только затем закрывает
+// хранилище, чтобы запросы не получили ошибку закрытого пула соединений.
+//
+// Принимает:
+// - timeout: время на завершение обрабатываемых запросов; по его истечении
+// оставшиеся соединения закрываются принудительно.
+// - servers: HTTP-серверы API и служебных маршрутов.
+// - grpcServer: gRPC-сервер; nil, если gRPC API выключен.
+// - scheduler: планировщик фоновых задач, контекст которых уже отменён.
+// - closeStorage: закрытие хранилища.
+//
+// Возвращает:
+// - ошибку, если запросы не завершились за timeout.
+func shutdown(timeout time.Duration, servers []*http.Server, grpcServer *grpc.Server, scheduler *jobs.Scheduler, closeStorage func()) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			_ = server.Close()
+			errs = append(errs, fmt.Errorf("HTTP server: %w", err))
+		}
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+			errs = append(errs, fmt.Errorf("gRPC server: %w", ctx.Err()))
+		}
+	}
+	scheduler.Wait()
+	closeStorage()
+	return errors.Join(errs...)
+}
+
+// Создаёт конфигурацию TLS HTTP-сервера с сертификатами ACME.
+//
+// Принимает:
+// - cfg: настройки http_server.tls.
+// - store: хранилище данных ACME; nil, если драйвер его не поддерживает.
+//
+// Возвращает:
+// - конфигурацию TLS.
+// - менеджер сертификатов (для проверки HTTP-01).
+// - ошибку, если настройки некорректны.
+func acmeTLS(cfg config.HTTPTLS, store storage.ACMECache) (*tls.Config, *autocert.Manager, error) {
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		return nil, nil, errors.New("cert_file and key_file must be empty when acme is enabled")
+	}
+	var cache autocert.Cache
+	switch {
+	case cfg.ACME.CacheDir != "":
+		cache = autocert.DirCache(cfg.ACME.CacheDir)
+	case store != nil:
+		cache = acme.NewStorageCache(store)
+	default:
+		return nil, nil, errors.New("acme cache_dir is required for this storage driver")
+	}
+	manager, err := acme.NewManager(cfg.ACME.Hosts, cfg.ACME.Email, cfg.ACME.DirectoryURL, cache)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := manager.TLSConfig()
+	if err := tlsconfig.SetProtocol(tlsConfig, cfg.MinVersion, cfg.CipherSuites); err != nil {
+		return nil, nil, err
+	}
+	return tlsConfig, manager, nil
+}
+
+// Создаёт алгоритм хеширования паролей и секретов клиентов по конфигурации.
+func passwordHasher(cfg config.Security) (tokens.PasswordHasher, error) {
+	switch cfg.PasswordHash {
+	case tokens.PasswordHashBcrypt:
+		return tokens.NewBcryptHasher(cfg.BcryptCost)
+	case tokens.PasswordHashArgon2id:
+		return tokens.NewArgon2idHasher(cfg.Argon2id.Memory, cfg.Argon2id.Iterations, cfg.Argon2id.Parallelism)
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q, expected %s or %s", cfg.PasswordHash, tokens.PasswordHashBcrypt, tokens.PasswordHashArgon2id)
+	}
+}
+
+// Загружает ключи перца из конфигурации и директории менеджера секретов.
+// Без ключей возвращает nil: пароли хешируются без перца.
+func passwordPepper(cfg config.Pepper) (*tokens.Pepper, error) {
+	keys := maps.Clone(cfg.Keys)
+	if cfg.KeysDir != "" {
+		entries, err := os.ReadDir(cfg.KeysDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pepper keys: %w", err)
+		}
+		if keys == nil {
+			keys = make(map[string]string, len(entries))
+		}
+		for _, entry := range entries {
+			// Служебные файлы и ссылки монтирования секретов Kubernetes (..data).
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if _, ok := keys[entry.Name()]; ok {
+				return nil, fmt.Errorf("pepper key %s is configured twice", entry.Name())
+			}
+			content, err := os.ReadFile(filepath.Join(cfg.KeysDir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read pepper key: %w", err)
+			}
+			keys[entry.Name()] = string(content)
+		}
+	}
+	if len(keys) == 0 && cfg.PrimaryKey == "" {
+		return nil, nil
+	}
+	return tokens.ParsePepper(keys, cfg.PrimaryKey)
+}
+
+// Включает проверку новых паролей по базе утечек, если она задана в конфигурации.
+func setupBreachedPasswords(cfg config.BreachedPasswords) {
+	if !cfg.Enabled {
+		return
+	}
+	checker := pwned.New(cfg.Timeout)
+	if cfg.URL != "" {
+		checker.WithURL(cfg.URL)
+	}
+	pwned.Set(checker, cfg.FailOpen)
+}
+
+// Устанавливает проверку CAPTCHA по конфигурации. Режим after_failures
+// опирается на счётчики блокировки входа, поэтому без неё недопустим.
+func setupCaptcha(cfg config.Captcha, lockoutEnabled bool) error {
+	if cfg.Provider == "" {
+		if len(cfg.Endpoints) > 0 {
+			return errors.New("captcha endpoints are configured without a provider")
+		}
+		return nil
+	}
+	verifier, err := captcha.New(cfg.Provider, cfg.Secret, cfg.MinScore, cfg.Timeout)
+	if err != nil {
+		return err
+	}
+	rules := make(map[string]captcha.Rule, len(cfg.Endpoints))
+	for endpoint, rule := range cfg.Endpoints {
+		if rule.Mode == captcha.ModeAfterFailures && !lockoutEnabled {
+			return fmt.Errorf("captcha endpoint %q: mode after_failures requires login_lockout", endpoint)
+		}
+		rules[endpoint] = captcha.Rule{Mode: rule.Mode, AfterFailures: rule.AfterFailures}
+	}
+	return captcha.Set(verifier, rules)
 }
 
 func setupLogger(env string) *slog.Logger {
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"auth_service/internal/config"
+	"auth_service/internal/migrations"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+const migrateUsage = `usage: auth_service migrate <command>
+
+commands:
+  up               apply all pending migrations
+  down N           roll back the last N migrations
+  force VERSION    set schema version and clear the dirty flag
+  status           print current schema version`
+
+// Выполняет подкоманду migrate.
+//
+// Принимает:
+// - args: аргументы после слова migrate.
+// - cfg: указатель на конфигурацию приложения.
+// - log: указатель на logger для логирования событий.
+//
+// Возвращает:
+// - ошибку, если команда неизвестна или её выполнение не удалось.
+func runMigrate(args []string, cfg *config.Config, log *slog.Logger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		return migrations.InitAndRunMigrations(cfg, log)
+	case "down":
+		if len(args) != 2 {
+			return fmt.Errorf("down requires the number of migrations\n%s", migrateUsage)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid number of migrations %q: %w", args[1], err)
+		}
+		if err := migrations.Down(cfg, n); err != nil {
+			return err
+		}
+		log.Info("Migrations rolled back", slog.Int("steps", n))
+		return nil
+	case "force":
+		if len(args) != 2 {
+			return fmt.Errorf("force requires a version\n%s", migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q: %w", args[1], err)
+		}
+		if err := migrations.Force(cfg, version); err != nil {
+			return err
+		}
+		log.Info("Migration version forced", slog.Int("version", version))
+		return nil
+	case "status":
+		status, err := migrations.GetStatus(cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d\ndirty: %t\n", status.Version, status.Dirty)
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"auth_service/internal/config"
+	"auth_service/internal/database"
+	"auth_service/internal/migrations"
+	"auth_service/internal/seed"
+	"auth_service/internal/storage/factory"
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+const defaultSeedPath = "config/seed.yaml"
+
+// Выполняет подкоманду seed: применяет миграции и записывает начальные данные.
+//
+// Принимает:
+// - args: аргументы после слова seed (необязательный путь к файлу).
+// - cfg: указатель на конфигурацию приложения.
+// - log: указатель на logger для логирования событий.
+//
+// Возвращает:
+// - ошибку, если начальные данные не удалось записать.
+func runSeed(args []string, cfg *config.Config, log *slog.Logger) error {
+	path := defaultSeedPath
+	switch len(args) {
+	case 0:
+	case 1:
+		path = args[0]
+	default:
+		return fmt.Errorf("usage: auth_service seed [path]")
+	}
+
+	s, err := seed.Load(path)
+	if err != nil {
+		return err
+	}
+	keyring, err := factory.Keyring(cfg)
+	if err != nil {
+		return err
+	}
+
+	pool, err := database.InitDB(cfg, log)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	if err := migrations.InitAndRunMigrations(cfg, log); err != nil {
+		return err
+	}
+
+	result, err := seed.Apply(context.Background(), pool, s, keyring)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Seed data applied",
+		slog.String("path", path),
+		slog.String("admin_id", result.AdminID),
+		slog.Int("scopes", result.Scopes),
+		slog.Int("roles", result.Roles),
+		slog.Int("clients", result.Clients),
+	)
+	return nil
+}
@@ -0,0 +1,246 @@
+// Пакет accounts позволяет администратору отключать учётные записи и снимать
+// с них блокировки после неудачных попыток (маршруты /admin/users/{id}).
+//
+// Отключённой учётной записи не выдаются токены: вход по паролю, выдача по
+// user_id и обновление токенов отклоняются (см. Check). Уже выданные
+// access-токены действуют до истечения срока; чтобы прекратить их действие
+// сразу, сессии отзываются через /admin/sessions/revoke.
+package accounts
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/internal/lockout"
+	"auth_service/internal/metrics"
+	"auth_service/internal/refreshlimit"
+	"auth_service/internal/storage"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Учётная запись отключена администратором.
+var ErrDisabled = errors.New("account is disabled")
+
+var rejected = metrics.NewCounterVec(
+	"auth_disabled_account_rejections_total",
+	"Number of token requests rejected because the account is disabled.",
+)
+
+// Источник email пользователей (реализуется storage.Storage).
+type Users interface {
+	GetUserEmail(userID string) (string, error)
+}
+
+var (
+	mu     sync.RWMutex
+	users  Users
+	status storage.AccountStatus
+)
+
+// Устанавливает хранилища пользователей и состояния учётных записей.
+// Вызывается при запуске; до вызова учётные записи не отключаются, а
+// служебные маршруты отвечают 501 Not Implemented.
+//
+// Принимает:
+// - u: источник email пользователей.
+// - s: состояние учётных записей; nil — драйвер его не поддерживает.
+func Set(u Users, s storage.AccountStatus) {
+	mu.Lock()
+	defer mu.Unlock()
+	users, status = u, s
+}
+
+func current() (Users, storage.AccountStatus) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return users, status
+}
+
+// Проверяет, что учётная запись пользователя не отключена.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - ErrDisabled, если учётная запись отключена.
+// - ошибку хранилища, если состояние не удалось проверить.
+func Check(userID string) error {
+	_, s := current()
+	if s == nil {
+		return nil
+	}
+	disabledAt, err := s.GetUserDisabledAt(userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		// Токены можно выдать и пользователю без записи в users.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check account status: %w", err)
+	}
+	if !disabledAt.IsZero() {
+		rejected.Inc()
+		return ErrDisabled
+	}
+	return nil
+}
+
+// Состояние учётной записи в ответах служебных маршрутов.
+type Status struct {
+	UserID   string `json:"user_id"`
+	Disabled bool   `json:"disabled"`
+	// Время отключения; null, если учётная запись включена.
+	DisabledAt *time.Time `json:"disabled_at"`
+	// Неудачных попыток входа подряд, учитываемых для блокировки.
+	LoginFailures int `json:"login_failures"`
+	// Время последней неудачной попытки входа; null, если попыток нет.
+	LastLoginFailureAt *time.Time `json:"last_login_failure_at"`
+	// Окончание блокировки входа; null, если вход не заблокирован.
+	LoginLockedUntil *time.Time `json:"login_locked_until"`
+	// Окончание запрета обновления токенов; null, если запрета нет.
+	RefreshLockedUntil *time.Time `json:"refresh_locked_until"`
+}
+
+// Создаёт обработчик GET /admin/users/{id}.
+//
+// Возвращает состояние учётной записи: отключена ли она, неудачные попытки
+// входа и действующие блокировки.
+//
+// Возвращает:
+// - http.Handler.
+func StatusHandler() http.Handler {
+	return userHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request, userID, email string, s storage.AccountStatus) {
+		writeStatus(w, r, userID, email, s)
+	})
+}
+
+// Создаёт обработчик POST /admin/users/{id}/unlock.
+//
+// Сбрасывает неудачные попытки входа в учётную запись и обновления её
+// токенов и снимает их блокировки. Блокировки адресов клиентов остаются.
+//
+// Возвращает:
+// - http.Handler.
+func UnlockHandler() http.Handler {
+	return userHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request, userID, email string, s storage.AccountStatus) {
+		if err := lockout.ResetAccount(email); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := refreshlimit.Reset(userID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeStatus(w, r, userID, email, s)
+	})
+}
+
+// Создаёт обработчик POST /admin/users/{id}/disable.
+//
+// Отключает учётную запись; повторный вызов сохраняет время первого.
+//
+// Возвращает:
+// - http.Handler.
+func DisableHandler() http.Handler {
+	return setDisabledHandler(true)
+}
+
+// Создаёт обработчик POST /admin/users/{id}/enable.
+//
+// Включает отключённую учётную запись.
+//
+// Возвращает:
+// - http.Handler.
+func EnableHandler() http.Handler {
+	return setDisabledHandler(false)
+}
+
+func setDisabledHandler(disabled bool) http.Handler {
+	return userHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request, userID, email string, s storage.AccountStatus) {
+		if err := s.SetUserDisabled(userID, disabled); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeStatus(w, r, userID, email, s)
+	})
+}
+
+// Проверяет метод запроса, поддержку хранилищем и пользователя из пути
+// перед вызовом handle.
+func userHandler(method string, handle func(w http.ResponseWriter, r *http.Request, userID, email string, s storage.AccountStatus)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		userID := r.PathValue("id")
+		if _, err := uuid.Parse(userID); err != nil {
+			i18n.Error(w, r, "invalid_user_id", http.StatusBadRequest)
+			return
+		}
+		u, s := current()
+		if u == nil || s == nil {
+			i18n.Error(w, r, "account_status_not_supported", http.StatusNotImplemented)
+			return
+		}
+		email, err := u.GetUserEmail(userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		handle(w, r, userID, email, s)
+	})
+}
+
+// Отправляет состояние учётной записи.
+func writeStatus(w http.ResponseWriter, r *http.Request, userID, email string, s storage.AccountStatus) {
+	disabledAt, err := s.GetUserDisabledAt(userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	attempt, err := lockout.AccountState(email)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	refreshLockedUntil, err := refreshlimit.Cooldown(userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(Status{
+		UserID:             userID,
+		Disabled:           !disabledAt.IsZero(),
+		DisabledAt:         optionalTime(disabledAt),
+		LoginFailures:      attempt.Failures,
+		LastLoginFailureAt: optionalTime(attempt.LastFailureAt),
+		LoginLockedUntil:   optionalTime(attempt.LockedUntil),
+		RefreshLockedUntil: optionalTime(refreshLockedUntil),
+	})
+}
+
+// Отправляет ответ с ошибкой хранилища.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		i18n.Error(w, r, "user_not_found", http.StatusNotFound)
+		return
+	}
+	i18n.Error(w, r, "service_unavailable", http.StatusServiceUnavailable)
+}
+
+// Возвращает nil для нулевого времени.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,105 @@
+package accounts
+
+import (
+	"auth_service/internal/lockout"
+	"auth_service/internal/refreshlimit"
+	"auth_service/internal/storage/memory"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userID = "123e4567-e89b-12d3-a456-426614174000"
+
+// Выполняет запрос к обработчику, зарегистрированному как в служебном маршрутизаторе.
+func serve(t *testing.T, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("/admin/users/{id}", StatusHandler())
+	mux.Handle("/admin/users/{id}/unlock", UnlockHandler())
+	mux.Handle("/admin/users/{id}/disable", DisableHandler())
+	mux.Handle("/admin/users/{id}/enable", EnableHandler())
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func decodeStatus(t *testing.T, rec *httptest.ResponseRecorder) Status {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var status Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	return status
+}
+
+// Проверка отключения, включения и снятия блокировок учётной записи.
+func TestHandlers(t *testing.T) {
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "alice@example.com")
+	Set(db, db)
+	t.Cleanup(func() { Set(nil, nil) })
+	require.NoError(t, lockout.Set(db, lockout.Policy{MaxAccountFailures: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour}))
+	t.Cleanup(func() { lockout.Set(nil, lockout.Policy{}) })
+	require.NoError(t, refreshlimit.Set(db, refreshlimit.Limits{MaxFailures: 1, Window: time.Minute, Cooldown: time.Minute}))
+	t.Cleanup(func() { refreshlimit.Set(nil, refreshlimit.Limits{}) })
+
+	status := decodeStatus(t, serve(t, http.MethodGet, "/admin/users/"+userID))
+	assert.Equal(t, Status{UserID: userID}, status)
+
+	// Отключённой учётной записи токены не выдаются до включения.
+	status = decodeStatus(t, serve(t, http.MethodPost, "/admin/users/"+userID+"/disable"))
+	assert.True(t, status.Disabled)
+	require.NotNil(t, status.DisabledAt)
+	assert.ErrorIs(t, Check(userID), ErrDisabled)
+
+	status = decodeStatus(t, serve(t, http.MethodPost, "/admin/users/"+userID+"/enable"))
+	assert.False(t, status.Disabled)
+	assert.Nil(t, status.DisabledAt)
+	assert.NoError(t, Check(userID))
+
+	// Блокировки входа и обновления видны и снимаются.
+	for i := 0; i < 2; i++ {
+		_, err := lockout.RecordFailure("alice@example.com", "")
+		require.NoError(t, err)
+	}
+	require.NoError(t, refreshlimit.RecordFailure(userID))
+	status = decodeStatus(t, serve(t, http.MethodGet, "/admin/users/"+userID))
+	assert.Equal(t, 2, status.LoginFailures)
+	assert.NotNil(t, status.LastLoginFailureAt)
+	assert.NotNil(t, status.LoginLockedUntil)
+	assert.NotNil(t, status.RefreshLockedUntil)
+
+	status = decodeStatus(t, serve(t, http.MethodPost, "/admin/users/"+userID+"/unlock"))
+	assert.Equal(t, Status{UserID: userID}, status)
+	assert.NoError(t, lockout.Check("alice@example.com", ""))
+	assert.NoError(t, refreshlimit.Check(userID))
+}
+
+// Проверка ответов на некорректные запросы.
+func TestHandlers_Errors(t *testing.T) {
+	rec := serve(t, http.MethodGet, "/admin/users/"+userID)
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.Equal(t, "account_status_not_supported", rec.Header().Get("X-Error-Code"))
+
+	db := memory.NewMemoryStorage()
+	Set(db, db)
+	t.Cleanup(func() { Set(nil, nil) })
+
+	rec = serve(t, http.MethodGet, "/admin/users/not-a-uuid")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_user_id", rec.Header().Get("X-Error-Code"))
+
+	rec = serve(t, http.MethodPost, "/admin/users/"+userID+"/disable")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "user_not_found", rec.Header().Get("X-Error-Code"))
+	assert.NoError(t, Check(userID), "users without a record are not disabled")
+
+	rec = serve(t, http.MethodGet, "/admin/users/"+userID+"/disable")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
@@ -0,0 +1,97 @@
+// Пакет acme получает и продлевает сертификаты HTTP-сервера у центра
+// сертификации ACME (по умолчанию Let's Encrypt) для небольших установок
+// без обратного прокси.
+//
+// Сертификаты, ключи и учётная запись ACME хранятся в хранилище сервиса
+// (StorageCache) или в каталоге (autocert.DirCache). Общее хранилище
+// позволяет всем репликам использовать одни сертификаты, не запрашивая
+// каждый раз новые и не упираясь в ограничения Let's Encrypt.
+package acme
+
+import (
+	"auth_service/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Хранилище autocert.Cache поверх storage.ACMECache.
+type StorageCache struct {
+	store storage.ACMECache
+}
+
+// Создаёт хранилище сертификатов поверх хранилища сервиса.
+//
+// Принимает:
+// - store: хранилище данных ACME.
+//
+// Возвращает:
+// - указатель на StorageCache.
+func NewStorageCache(store storage.ACMECache) *StorageCache {
+	return &StorageCache{store: store}
+}
+
+// Возвращает данные по ключу или autocert.ErrCacheMiss.
+func (c *StorageCache) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := c.store.GetACMEData(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, err
+}
+
+// Сохраняет данные по ключу.
+func (c *StorageCache) Put(_ context.Context, key string, data []byte) error {
+	return c.store.SaveACMEData(key, data)
+}
+
+// Удаляет данные по ключу.
+func (c *StorageCache) Delete(_ context.Context, key string) error {
+	return c.store.DeleteACMEData(key)
+}
+
+// Создаёт менеджер сертификатов ACME.
+//
+// Сертификаты выдаются только для перечисленных имён и продлеваются
+// автоматически за 30 дней до истечения. Подтверждение владения именем
+// выполняется проверкой TLS-ALPN-01 на адресе HTTP-сервера, а при
+// обслуживании Manager.HTTPHandler на порту 80 — и HTTP-01.
+//
+// Принимает:
+// - hosts: DNS-имена сервиса.
+// - email: адрес для уведомлений центра сертификации; может быть пустым.
+// - directoryURL: адрес каталога ACME; пусто — Let's Encrypt.
+// - cache: хранилище сертификатов и ключей.
+//
+// Возвращает:
+// - указатель на autocert.Manager.
+// - ошибку, если имена не заданы или некорректны.
+func NewManager(hosts []string, email, directoryURL string, cache autocert.Cache) (*autocert.Manager, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("acme hosts are required")
+	}
+	for _, host := range hosts {
+		if host == "" || strings.ContainsAny(host, ":/*") || net.ParseIP(host) != nil {
+			return nil, fmt.Errorf("invalid acme host %q, expected a DNS name", host)
+		}
+	}
+	if cache == nil {
+		return nil, errors.New("acme cache is required")
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      cache,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Email:      email,
+	}
+	if directoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: directoryURL}
+	}
+	return manager, nil
+}
@@ -0,0 +1,47 @@
+package acme
+
+import (
+	"auth_service/internal/storage/memory"
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestStorageCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewStorageCache(memory.NewMemoryStorage())
+
+	_, err := cache.Get(ctx, "auth.example.com")
+	assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+
+	require.NoError(t, cache.Put(ctx, "auth.example.com", []byte("certificate")))
+	data, err := cache.Get(ctx, "auth.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("certificate"), data)
+
+	require.NoError(t, cache.Delete(ctx, "auth.example.com"))
+	_, err = cache.Get(ctx, "auth.example.com")
+	assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+}
+
+func TestNewManager(t *testing.T) {
+	cache := NewStorageCache(memory.NewMemoryStorage())
+	manager, err := NewManager([]string{"auth.example.com"}, "ops@example.com", "https://acme-staging-v02.api.letsencrypt.org/directory", cache)
+	require.NoError(t, err)
+	assert.Equal(t, "https://acme-staging-v02.api.letsencrypt.org/directory", manager.Client.DirectoryURL)
+
+	// Сертификаты для других имён не запрашиваются.
+	_, err = manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	assert.Error(t, err)
+
+	for _, hosts := range [][]string{nil, {""}, {"203.0.113.1"}, {"*.example.com"}, {"auth.example.com:443"}} {
+		_, err := NewManager(hosts, "", "", cache)
+		assert.Error(t, err, "%v", hosts)
+	}
+	_, err = NewManager([]string{"auth.example.com"}, "", "", nil)
+	assert.Error(t, err)
+}
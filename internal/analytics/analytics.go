@@ -0,0 +1,163 @@
+// Пакет analytics рассчитывает суточные сводки использования сервиса:
+// активных и новых пользователей, количество запросов и долю неуспешных.
+//
+// Сводки пересчитываются периодической задачей stats_rollup (см. Rollup) и
+// доступны через GET /admin/stats, чтобы для продуктовой аналитики не
+// приходилось обращаться к сессиям и статистике запросов напрямую.
+package analytics
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Формат дат в параметрах from и to и в ответе.
+const dateLayout = "2006-01-02"
+
+// Период по умолчанию, если from не задан.
+const defaultPeriod = 30 * 24 * time.Hour
+
+var (
+	mu    sync.Mutex
+	store storage.Analytics
+)
+
+// Устанавливает хранилище сводок.
+//
+// Принимает:
+// - s: хранилище; nil — сводки не рассчитываются.
+func SetStore(s storage.Analytics) {
+	mu.Lock()
+	defer mu.Unlock()
+	store = s
+}
+
+// Пересчитывает сводки за предыдущие и текущие сутки (UTC).
+//
+// Предыдущие сутки пересчитываются, чтобы в их сводку вошли запросы,
+// записанные репликами после полуночи, текущие — чтобы сводка за сегодня
+// была доступна до окончания суток.
+//
+// Принимает:
+// - ctx: контекст выполнения.
+// - now: текущее время.
+//
+// Возвращает:
+// - пересчитанные сводки.
+// - ошибку, если сводку не удалось пересчитать.
+func Rollup(ctx context.Context, now time.Time) ([]storage.DailyStats, error) {
+	mu.Lock()
+	s := store
+	mu.Unlock()
+	if s == nil {
+		return nil, nil
+	}
+
+	var rolledUp []storage.DailyStats
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+		if err := ctx.Err(); err != nil {
+			return rolledUp, err
+		}
+		stats, err := s.RollupDailyStats(day)
+		if err != nil {
+			return rolledUp, fmt.Errorf("failed to roll up stats for %s: %w", day.UTC().Format(dateLayout), err)
+		}
+		rolledUp = append(rolledUp, stats)
+	}
+	return rolledUp, nil
+}
+
+// Сводка за сутки в ответе GET /admin/stats.
+type Row struct {
+	Day              string `json:"day"`
+	ActiveUsers      int64  `json:"active_users"`
+	NewUsers         int64  `json:"new_users"`
+	Requests         int64  `json:"requests"`
+	RejectedRequests int64  `json:"rejected_requests"`
+	FailedRequests   int64  `json:"failed_requests"`
+	// Доля отклонённых и завершившихся ошибкой запросов; 0, если запросов не было.
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// Создаёт обработчик GET /admin/stats?from=YYYY-MM-DD&to=YYYY-MM-DD.
+//
+// Возвращает сводки за период с from по to включительно; по умолчанию — за
+// последние 30 суток. Сутки, для которых сводка ещё не рассчитана, в ответ
+// не входят.
+//
+// Возвращает:
+// - http.Handler.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		mu.Lock()
+		s := store
+		mu.Unlock()
+		if s == nil {
+			i18n.Error(w, r, "stats_not_supported", http.StatusNotImplemented)
+			return
+		}
+
+		from, to, ok := period(r)
+		if !ok {
+			i18n.Error(w, r, "invalid_period", http.StatusBadRequest)
+			return
+		}
+
+		stored, err := s.ListDailyStats(from, to)
+		if err != nil {
+			i18n.Error(w, r, "service_unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		rows := make([]Row, 0, len(stored))
+		for _, stats := range stored {
+			row := Row{
+				Day:              stats.Day.UTC().Format(dateLayout),
+				ActiveUsers:      stats.ActiveUsers,
+				NewUsers:         stats.NewUsers,
+				Requests:         stats.Requests,
+				RejectedRequests: stats.RejectedRequests,
+				FailedRequests:   stats.FailedRequests,
+			}
+			if stats.Requests > 0 {
+				row.FailureRate = float64(stats.RejectedRequests+stats.FailedRequests) / float64(stats.Requests)
+			}
+			rows = append(rows, row)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rows)
+	})
+}
+
+// Возвращает период запроса из параметров from и to.
+func period(r *http.Request) (time.Time, time.Time, bool) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultPeriod)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+	return from, to, !from.After(to)
+}
@@ -0,0 +1,89 @@
+package analytics_test
+
+import (
+	"auth_service/internal/analytics"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/memory"
+	"auth_service/lib/clock"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка пересчёта сводок за предыдущие и текущие сутки.
+func TestRollup(t *testing.T) {
+	now := time.Date(2024, 3, 2, 0, 30, 0, 0, time.UTC)
+	ms := memory.NewMemoryStorage().WithClock(clock.NewFake(now))
+	ms.CreateUser("user", "user@example.com")
+	_, err := ms.SaveRefreshToken("user", "hash", "192.168.1.1", now.Add(time.Hour))
+	require.NoError(t, err)
+	// Запросы предыдущих суток, записанные репликой после полуночи.
+	require.NoError(t, ms.AddUsage([]storage.UsageRow{
+		{Day: now.AddDate(0, 0, -1), API: "http", Operation: "issue", Result: "success", Count: 3},
+		{Day: now.AddDate(0, 0, -1), API: "http", Operation: "issue", Result: "error", Count: 1},
+	}))
+
+	stats, err := analytics.Rollup(context.Background(), now)
+	require.NoError(t, err)
+	assert.Empty(t, stats, "nothing is rolled up without a store")
+
+	analytics.SetStore(ms)
+	t.Cleanup(func() { analytics.SetStore(nil) })
+
+	stats, err = analytics.Rollup(context.Background(), now)
+	require.NoError(t, err)
+	require.Len(t, stats, 2)
+	assert.Equal(t, "2024-03-01", stats[0].Day.Format("2006-01-02"))
+	assert.Equal(t, int64(4), stats[0].Requests)
+	assert.Equal(t, int64(1), stats[0].FailedRequests)
+	assert.Zero(t, stats[0].ActiveUsers)
+	assert.Equal(t, "2024-03-02", stats[1].Day.Format("2006-01-02"))
+	assert.Equal(t, int64(1), stats[1].ActiveUsers)
+	assert.Equal(t, int64(1), stats[1].NewUsers)
+}
+
+// Проверка выдачи сводок через GET /admin/stats.
+func TestHandler(t *testing.T) {
+	serve := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		analytics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	rr := serve("/admin/stats")
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Equal(t, "stats_not_supported", rr.Header().Get("X-Error-Code"))
+
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ms := memory.NewMemoryStorage()
+	require.NoError(t, ms.AddUsage([]storage.UsageRow{
+		{Day: day, API: "http", Operation: "refresh", Result: "success", Count: 6},
+		{Day: day, API: "http", Operation: "refresh", Result: "rejected", Count: 3},
+		{Day: day, API: "grpc", Operation: "validate", Result: "error", Count: 1},
+	}))
+	_, err := ms.RollupDailyStats(day)
+	require.NoError(t, err)
+	_, err = ms.RollupDailyStats(day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	analytics.SetStore(ms)
+	t.Cleanup(func() { analytics.SetStore(nil) })
+
+	rr = serve("/admin/stats?from=2024-03-01&to=2024-03-02")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var rows []analytics.Row
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rows))
+	assert.Equal(t, []analytics.Row{
+		{Day: "2024-03-01", Requests: 10, RejectedRequests: 3, FailedRequests: 1, FailureRate: 0.4},
+		{Day: "2024-03-02"},
+	}, rows)
+
+	rr = serve("/admin/stats?to=03/02/2024")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "invalid_period", rr.Header().Get("X-Error-Code"))
+}
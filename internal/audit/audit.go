@@ -0,0 +1,54 @@
+// Пакет audit сохраняет события безопасности в журнал аудита и выгружает
+// его в объектное хранилище (S3, GCS и совместимые).
+//
+// Sink записывает каждое событие в хранилище (storage.AuditLog), а задача
+// выгрузки (Exporter) периодически упаковывает записи, появившиеся после
+// последней выгрузки, в объекты NDJSON и запоминает номер последней
+// выгруженной записи. Выгруженные записи можно удалять из базы данных, не
+// дожидаясь обычного срока хранения.
+package audit
+
+import (
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"context"
+	"fmt"
+)
+
+// Обработчик событий безопасности, сохраняющий их в журнал аудита.
+type Sink struct {
+	store storage.AuditLog
+}
+
+// Создаёт обработчик.
+//
+// Принимает:
+// - store: хранилище журнала аудита.
+//
+// Возвращает:
+// - указатель на Sink.
+func NewSink(store storage.AuditLog) *Sink {
+	return &Sink{store: store}
+}
+
+// Возвращает имя обработчика.
+func (s *Sink) Name() string {
+	return "audit"
+}
+
+// Сохраняет событие в журнал аудита.
+func (s *Sink) Handle(ctx context.Context, event security.Event) error {
+	err := s.store.AppendAudit(storage.AuditEvent{
+		Type:      event.Type,
+		Severity:  string(event.Severity),
+		Time:      event.Time,
+		UserID:    event.UserID,
+		SessionID: event.SessionID,
+		ClientIP:  event.ClientIP,
+		Details:   event.Details,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
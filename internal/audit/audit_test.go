@@ -0,0 +1,175 @@
+package audit_test
+
+import (
+	"auth_service/internal/audit"
+	"auth_service/internal/security"
+	"auth_service/internal/storage/memory"
+	"auth_service/lib/clock"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Объектное хранилище в памяти.
+type objects struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	err  error
+}
+
+func (o *objects) Put(ctx context.Context, key, contentType string, body []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return o.err
+	}
+	if o.data == nil {
+		o.data = make(map[string][]byte)
+	}
+	o.data[key] = body
+	return nil
+}
+
+// Читает записи объекта NDJSON, сжатого gzip.
+func decode(t *testing.T, body []byte) []audit.Record {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	var records []audit.Record
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var r audit.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+// Проверка выгрузки порциями с сохранением позиции и удаления выгруженных записей.
+func TestExporter_Export(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	start := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	store := memory.NewMemoryStorage().WithClock(clk)
+
+	pipeline := security.NewPipeline(logger, audit.NewSink(store))
+	for i := 0; i < 3; i++ {
+		pipeline.Emit(context.Background(), security.Event{
+			Type:     security.EventIPChange,
+			Severity: security.SeverityMedium,
+			Time:     start.Add(time.Duration(i) * time.Second),
+			UserID:   "user-1",
+			Details:  map[string]string{"previous_ip": "192.0.2.1"},
+		})
+	}
+
+	bucket := &objects{}
+	exporter, err := audit.NewExporter(logger, store, bucket, "audit/", audit.FormatNDJSON, 2)
+	require.NoError(t, err)
+	exporter.WithClock(clk)
+
+	// Недавние записи ещё не выгружаются.
+	exported, err := exporter.Export(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, exported)
+
+	clk.Advance(time.Hour)
+	exported, err = exporter.Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, exported)
+	require.Len(t, bucket.data, 2, "events are split into objects of batch_size")
+
+	first := bucket.data["audit/2026/01/02/00000000000000000001-00000000000000000002.ndjson.gz"]
+	require.NotNil(t, first)
+	records := decode(t, first)
+	require.Len(t, records, 2)
+	assert.Equal(t, int64(1), records[0].Seq)
+	assert.Equal(t, security.EventIPChange, records[0].Type)
+	assert.Equal(t, "medium", records[0].Severity)
+	assert.Equal(t, "user-1", records[0].UserID)
+	assert.Equal(t, map[string]string{"previous_ip": "192.0.2.1"}, records[0].Details)
+	assert.Len(t, decode(t, bucket.data["audit/2026/01/02/00000000000000000003-00000000000000000003.ndjson.gz"]), 1)
+
+	// Выгруженные записи не выгружаются повторно.
+	exported, err = exporter.Export(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, exported)
+
+	// Ошибка хранилища объектов не переносит позицию.
+	pipeline.Emit(context.Background(), security.Event{Type: security.EventGeoBlocked, Time: clk.Now()})
+	clk.Advance(time.Hour)
+	bucket.err = errors.New("unavailable")
+	_, err = exporter.Export(context.Background())
+	assert.Error(t, err)
+	bucket.err = nil
+	exported, err = exporter.Export(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, exported)
+
+	// Удаляются только выгруженные записи старше срока хранения.
+	pipeline.Emit(context.Background(), security.Event{Type: security.EventGeoBlocked, Time: clk.Now()})
+	deleted, err := exporter.Prune(30*time.Minute, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), deleted)
+	left, err := store.ListAuditAfter(0, clk.Now().Add(time.Hour), 1000)
+	require.NoError(t, err)
+	require.Len(t, left, 1)
+	assert.Equal(t, int64(5), left[0].Seq)
+}
+
+// Проверка отклонения неподдерживаемого формата.
+func TestNewExporter_Format(t *testing.T) {
+	_, err := audit.NewExporter(slog.New(slog.NewTextHandler(io.Discard, nil)), memory.NewMemoryStorage(), &objects{}, "", "parquet", 100)
+	assert.Error(t, err)
+}
+
+// Проверка сохранения объекта в S3-совместимом хранилище.
+func TestS3_Put(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	s3, err := audit.NewS3(audit.S3Config{
+		Endpoint: server.URL, Region: "us-east-1", Bucket: "archive",
+		AccessKeyID: "id", SecretAccessKey: "secret", PathStyle: true,
+	}, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, s3.Put(context.Background(), "audit/a.ndjson.gz", "application/gzip", []byte("data")))
+
+	require.NotNil(t, got)
+	assert.Equal(t, http.MethodPut, got.Method)
+	assert.Equal(t, "/archive/audit/a.ndjson.gz", got.URL.Path)
+	assert.Equal(t, "data", string(body))
+	assert.Equal(t, "application/gzip", got.Header.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(got.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/"))
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer failing.Close()
+	s3, err = audit.NewS3(audit.S3Config{
+		Endpoint: failing.URL, Region: "us-east-1", Bucket: "archive",
+		AccessKeyID: "id", SecretAccessKey: "secret", PathStyle: true,
+	}, time.Second)
+	require.NoError(t, err)
+	assert.ErrorContains(t, s3.Put(context.Background(), "a", "application/gzip", nil), "403")
+}
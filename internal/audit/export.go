@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/storage"
+	"auth_service/lib/clock"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Форматы выгрузки.
+const (
+	// Объект — сжатый gzip файл с записью JSON на строку.
+	FormatNDJSON = "ndjson"
+)
+
+// Имя выгрузки, под которым хранится её позиция.
+const checkpointName = "object_storage"
+
+// Отставание границы выгрузки от текущего времени: записи, сохранённые
+// параллельно, успевают стать видимыми до того, как позиция выгрузки
+// пройдёт их номера.
+const settleDelay = time.Minute
+
+var exportedEvents = metrics.NewCounterVec(
+	"auth_audit_exported_events_total",
+	"Number of audit events exported to object storage, by format.",
+	"format",
+)
+
+// Объектное хранилище.
+type ObjectStore interface {
+	// Сохраняет объект под ключом key, заменяя существующий.
+	Put(ctx context.Context, key, contentType string, body []byte) error
+}
+
+// Запись в выгружаемом объекте.
+type Record struct {
+	// Порядковый номер; по нему получатель отбрасывает повторно выгруженные записи.
+	Seq       int64             `json:"seq"`
+	Type      string            `json:"type"`
+	Severity  string            `json:"severity"`
+	Time      time.Time         `json:"time"`
+	UserID    string            `json:"user_id,omitempty"`
+	SessionID string            `json:"session_id,omitempty"`
+	ClientIP  string            `json:"client_ip,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Выгрузка журнала аудита в объектное хранилище.
+type Exporter struct {
+	log       *slog.Logger
+	store     storage.AuditLog
+	objects   ObjectStore
+	prefix    string
+	format    string
+	batchSize int
+	clock     clock.Clock
+}
+
+// Создаёт выгрузку.
+//
+// Принимает:
+// - log: указатель на logger.
+// - store: хранилище журнала аудита.
+// - objects: объектное хранилище.
+// - prefix: префикс ключей объектов (например, audit/).
+// - format: формат объектов (FormatNDJSON).
+// - batchSize: наибольшее количество записей в одном объекте.
+//
+// Возвращает:
+// - указатель на Exporter.
+// - ошибку, если формат не поддерживается или размер порции не положителен.
+func NewExporter(log *slog.Logger, store storage.AuditLog, objects ObjectStore, prefix, format string, batchSize int) (*Exporter, error) {
+	if format != FormatNDJSON {
+		return nil, fmt.Errorf("unsupported audit export format %q, expected %s", format, FormatNDJSON)
+	}
+	if batchSize < 1 {
+		return nil, errors.New("audit export batch_size must be positive")
+	}
+	return &Exporter{
+		log:       log,
+		store:     store,
+		objects:   objects,
+		prefix:    prefix,
+		format:    format,
+		batchSize: batchSize,
+		clock:     clock.Real{},
+	}, nil
+}
+
+// Устанавливает источник времени (для тестов).
+func (e *Exporter) WithClock(c clock.Clock) *Exporter {
+	e.clock = c
+	return e
+}
+
+// Выгружает записи, появившиеся после предыдущей выгрузки.
+//
+// Записи упаковываются в объекты не больше batchSize записей; после
+// сохранения каждого объекта позиция выгрузки переносится на его последнюю
+// запись. Если процесс остановится между сохранением объекта и позиции,
+// следующий запуск выгрузит те же записи повторно (получатель отбрасывает
+// их по seq), но ни одна запись не будет пропущена.
+//
+// Принимает:
+// - ctx: контекст; при отмене выгрузка прерывается между объектами.
+//
+// Возвращает:
+// - количество выгруженных записей.
+// - ошибку чтения журнала, сохранения объекта или позиции.
+func (e *Exporter) Export(ctx context.Context) (int, error) {
+	checkpoint, err := e.store.GetAuditCheckpoint(checkpointName)
+	if err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	for ctx.Err() == nil {
+		events, err := e.store.ListAuditAfter(checkpoint, e.clock.Now().Add(-settleDelay), e.batchSize)
+		if err != nil {
+			return exported, err
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		body, err := encodeNDJSON(events)
+		if err != nil {
+			return exported, err
+		}
+		key := e.objectKey(events[0], events[len(events)-1])
+		if err := e.objects.Put(ctx, key, "application/gzip", body); err != nil {
+			return exported, fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		checkpoint = events[len(events)-1].Seq
+		if err := e.store.SaveAuditCheckpoint(checkpointName, checkpoint); err != nil {
+			return exported, err
+		}
+		exported += len(events)
+		exportedEvents.Add(float64(len(events)), e.format)
+		e.log.Debug("Audit events exported", slog.String("object", key), slog.Int("count", len(events)))
+
+		if len(events) < e.batchSize {
+			break
+		}
+	}
+	return exported, nil
+}
+
+// Удаляет из хранилища выгруженные записи старше retention.
+//
+// Принимает:
+// - retention: срок хранения выгруженных записей.
+// - limit: наибольшее количество удаляемых записей за вызов.
+//
+// Возвращает:
+// - количество удалённых записей.
+// - ошибку чтения позиции или удаления.
+func (e *Exporter) Prune(retention time.Duration, limit int) (int64, error) {
+	checkpoint, err := e.store.GetAuditCheckpoint(checkpointName)
+	if err != nil || checkpoint == 0 {
+		return 0, err
+	}
+	return e.store.DeleteAuditEvents(checkpoint, e.clock.Now().Add(-retention), limit)
+}
+
+// Ключ объекта: <prefix><год>/<месяц>/<день>/<первый номер>-<последний номер>.ndjson.gz
+// по времени первой записи; номера дополняются нулями, чтобы объекты
+// сортировались в порядке записей.
+func (e *Exporter) objectKey(first, last storage.AuditEvent) string {
+	return fmt.Sprintf("%s%s/%020d-%020d.ndjson.gz", e.prefix, first.Time.UTC().Format("2006/01/02"), first.Seq, last.Seq)
+}
+
+// Кодирует записи в NDJSON, сжатый gzip.
+func encodeNDJSON(events []storage.AuditEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, event := range events {
+		record := Record{
+			Seq:       event.Seq,
+			Type:      event.Type,
+			Severity:  event.Severity,
+			Time:      event.Time.UTC(),
+			UserID:    event.UserID,
+			SessionID: event.SessionID,
+			ClientIP:  event.ClientIP,
+			Details:   event.Details,
+		}
+		if err := enc.Encode(record); err != nil {
+			return nil, fmt.Errorf("failed to encode audit event %d: %w", event.Seq, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress audit events: %w", err)
+	}
+	return buf.Bytes(), nil
+}
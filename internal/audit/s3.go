@@ -0,0 +1,208 @@
+package audit
+
+import (
+	"auth_service/lib/clock"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Настройки S3-совместимого хранилища.
+//
+// GCS принимает те же запросы по адресу https://storage.googleapis.com с
+// HMAC-ключами сервисного аккаунта (interoperability API).
+type S3Config struct {
+	// Адрес API, например https://s3.amazonaws.com или http://minio:9000.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Ключ доступа и секрет для подписи запросов (AWS Signature Version 4).
+	AccessKeyID     string
+	SecretAccessKey string
+	// Адресовать бакет путём (endpoint/bucket/key), а не поддоменом
+	// (bucket.endpoint/key); нужно для MinIO и большинства локальных хранилищ.
+	PathStyle bool
+}
+
+// Проверяет настройки хранилища.
+func (c S3Config) Validate() error {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid object storage endpoint %q", c.Endpoint)
+	}
+	if c.Bucket == "" {
+		return errors.New("object storage bucket is required")
+	}
+	if c.Region == "" {
+		return errors.New("object storage region is required")
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return errors.New("object storage access key and secret are required")
+	}
+	return nil
+}
+
+// Клиент S3-совместимого хранилища, умеющий сохранять объекты.
+type S3 struct {
+	cfg    S3Config
+	client *http.Client
+	clock  clock.Clock
+}
+
+// Создаёт клиент.
+//
+// Принимает:
+// - cfg: настройки хранилища.
+// - timeout: время ожидания ответа на один запрос.
+//
+// Возвращает:
+// - указатель на S3.
+// - ошибку, если настройки некорректны.
+func NewS3(cfg S3Config, timeout time.Duration) (*S3, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &S3{cfg: cfg, client: &http.Client{Timeout: timeout}, clock: clock.Real{}}, nil
+}
+
+// Устанавливает источник времени подписи (для тестов).
+func (s *S3) WithClock(c clock.Clock) *S3 {
+	s.clock = c
+	return s
+}
+
+// Сохраняет объект запросом PUT Object.
+func (s *S3) Put(ctx context.Context, key, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	signV4(req, sha256Hex(body), s.cfg.Region, s.cfg.AccessKeyID, s.cfg.SecretAccessKey, s.clock.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Адрес объекта с учётом способа адресации бакета.
+func (s *S3) objectURL(key string) string {
+	u, _ := url.Parse(s.cfg.Endpoint)
+	if s.cfg.PathStyle {
+		u.Path = "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = escapePath(u.Path)
+	return u.String()
+}
+
+// Подписывает запрос по схеме AWS Signature Version 4 для сервиса s3.
+//
+// Подписываются Host и все заголовки запроса; устанавливает заголовки
+// X-Amz-Date, X-Amz-Content-Sha256 и Authorization.
+func signV4(req *http.Request, payloadHash, region, accessKeyID, secret string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secret), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// Строка параметров запроса в каноническом виде: имена и значения
+// отсортированы и закодированы по RFC 3986.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, escape(name, true)+"="+escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// Кодирует путь по RFC 3986, сохраняя разделители /.
+func escapePath(path string) string {
+	return escape(path, false)
+}
+
+// Кодирует все символы, кроме незарезервированных (и / в пути).
+func escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
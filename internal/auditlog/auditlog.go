@@ -0,0 +1,295 @@
+// Пакет auditlog ведёт журнал действий: неизменяемую историю значимых для
+// безопасности операций (выдача и обновление токенов, отказы в обновлении,
+// смена IP-адреса, действия администратора) с исполнителем, адресом и
+// User-Agent клиента и результатом.
+//
+// События безопасности попадают в журнал через Sink, действия
+// администратора — через Admin. Записи только добавляются; журнал
+// просматривается через GET /admin/audit (см. Handler), а история входов
+// пользователя строится по нему функцией History.
+package auditlog
+
+import (
+	"auth_service/internal/clientip"
+	"auth_service/internal/metrics"
+	"auth_service/internal/mtls"
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Результаты действий.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Действия администратора (маршруты /admin/*). Действия пользователей
+// совпадают с типами событий безопасности (token_issued, refresh_failed, ...).
+const (
+	ActionAccountDisable   = "admin_account_disable"
+	ActionAccountEnable    = "admin_account_enable"
+	ActionAccountUnlock    = "admin_account_unlock"
+	ActionSessionsRevoke   = "admin_sessions_revoke"
+	ActionMaintenance      = "admin_maintenance"
+	ActionQuotas           = "admin_quotas"
+	ActionWebhookRedeliver = "admin_webhook_redeliver"
+)
+
+// Смена пароля пользователем; записывается через Record.
+const ActionPasswordChange = "password_change"
+
+// Исполнитель действий администратора без клиентского сертификата.
+const defaultAdminActor = "admin"
+
+// Наибольшая длина сохраняемого User-Agent, байт.
+const maxUserAgentLength = 512
+
+var recorded = metrics.NewCounterVec(
+	"auth_audit_log_records_total",
+	"Number of audit log records, by result of writing them.",
+	"result",
+)
+
+var (
+	mu      sync.RWMutex
+	store   storage.AuditTrail
+	privacy clientip.Privacy
+)
+
+// Устанавливает хранилище журнала действий. Вызывается при запуске; до
+// вызова действия администратора не записываются, а GET /admin/audit
+// отвечает 501 Not Implemented.
+//
+// Принимает:
+// - s: журнал действий; nil — драйвер его не поддерживает.
+// - p: форма хранения IP-адресов администраторов.
+func Set(s storage.AuditTrail, p clientip.Privacy) {
+	mu.Lock()
+	defer mu.Unlock()
+	store, privacy = s, p
+}
+
+func current() (storage.AuditTrail, clientip.Privacy) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return store, privacy
+}
+
+// Сохраняет запись в журнал действий; без хранилища ничего не делает.
+// Время записи по умолчанию — текущее, исполнитель — администратор или
+// пользователь из контекста запроса (см. Middleware и Admin).
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - record: запись.
+//
+// Возвращает:
+// - ошибку хранилища.
+func Record(ctx context.Context, record storage.AuditRecord) error {
+	s, _ := current()
+	if s == nil {
+		return nil
+	}
+	meta := fromContext(ctx)
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Actor = cmp.Or(record.Actor, meta.actor, record.UserID)
+	record.UserAgent = cmp.Or(record.UserAgent, meta.userAgent)
+	if err := s.AppendAuditRecord(record); err != nil {
+		recorded.Inc("failure")
+		return fmt.Errorf("failed to record audit log entry: %w", err)
+	}
+	recorded.Inc("success")
+	return nil
+}
+
+// Сведения о запросе для записей журнала.
+type requestMeta struct {
+	userAgent string
+	// Администратор, выполняющий запрос; пусто для запросов пользователей.
+	actor string
+}
+
+type metaKey struct{}
+
+func fromContext(ctx context.Context) requestMeta {
+	meta, _ := ctx.Value(metaKey{}).(requestMeta)
+	return meta
+}
+
+// Создаёт middleware, сохраняющее User-Agent запроса в контексте, чтобы он
+// попал в записи о действиях, выполненных при обработке запроса.
+//
+// Принимает:
+// - next: обработчик маршрута.
+//
+// Возвращает:
+// - http.Handler.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meta := fromContext(r.Context())
+		meta.userAgent = userAgent(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), metaKey{}, meta)))
+	})
+}
+
+// Создаёт middleware, записывающее изменяющие запросы администратора к
+// маршруту (кроме GET и HEAD).
+//
+// Исполнитель — идентичность клиентского сертификата (при включённом mTLS)
+// или "admin"; результат определяется по коду ответа. События безопасности,
+// возникшие при обработке запроса (например, token_revoked), записываются с
+// тем же исполнителем.
+//
+// Принимает:
+// - action: действие маршрута (Action*).
+// - next: обработчик маршрута.
+//
+// Возвращает:
+// - http.Handler.
+func Admin(action string, next http.Handler) http.Handler {
+	return admin(action, false, next)
+}
+
+// Как Admin, но для маршрутов /admin/users/{id}: пользователь из пути
+// сохраняется в записи.
+//
+// Принимает:
+// - action: действие маршрута (Action*).
+// - next: обработчик маршрута.
+//
+// Возвращает:
+// - http.Handler.
+func AdminUser(action string, next http.Handler) http.Handler {
+	return admin(action, true, next)
+}
+
+func admin(action string, user bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s, p := current()
+		if s == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		meta := requestMeta{userAgent: userAgent(r), actor: cmp.Or(mtls.RequestIdentity(r), defaultAdminActor)}
+		ctx := context.WithValue(r.Context(), metaKey{}, meta)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		record := storage.AuditRecord{
+			Action:  action,
+			Outcome: OutcomeSuccess,
+			Details: map[string]string{
+				"method": r.Method,
+				"status": strconv.Itoa(sw.status),
+			},
+		}
+		if ip := clientip.FromRequest(r); ip != "" {
+			record.ClientIP = p.Apply(ip)
+		}
+		if sw.status >= http.StatusBadRequest {
+			record.Outcome = OutcomeFailure
+		}
+		if target := r.PathValue("id"); target != "" {
+			record.Details["target"] = target
+			if user {
+				record.UserID = target
+			}
+		}
+		// Ответ уже отправлен; ошибка учитывается в метрике.
+		_ = Record(ctx, record)
+	})
+}
+
+// Возвращает User-Agent запроса, обрезанный до maxUserAgentLength байт.
+func userAgent(r *http.Request) string {
+	ua := strings.TrimSpace(strings.ToValidUTF8(r.UserAgent(), ""))
+	if len(ua) <= maxUserAgentLength {
+		return ua
+	}
+	ua = ua[:maxUserAgentLength]
+	for !utf8.ValidString(ua) {
+		ua = ua[:len(ua)-1]
+	}
+	return ua
+}
+
+// http.ResponseWriter, запоминающий код ответа.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status, sw.wroteHeader = status, true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(p)
+}
+
+// Возвращает исходный ResponseWriter (для http.ResponseController).
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// Обработчик событий безопасности, записывающий их в журнал действий.
+// Принимает все события, включая события жизненного цикла токенов.
+type Sink struct{}
+
+// Создаёт обработчик. Записи сохраняются в хранилище, установленное Set.
+//
+// Возвращает:
+// - указатель на Sink.
+func NewSink() *Sink {
+	return &Sink{}
+}
+
+// Возвращает имя обработчика.
+func (s *Sink) Name() string {
+	return "audit_log"
+}
+
+// Сообщает, что обработчик принимает события всех типов.
+func (s *Sink) Subscribed(string) bool {
+	return true
+}
+
+// Записывает событие в журнал действий.
+func (s *Sink) Handle(ctx context.Context, event security.Event) error {
+	outcome := OutcomeSuccess
+	switch event.Type {
+	case security.EventRefreshFailed, security.EventRefreshTokenReuse, security.EventGeoBlocked,
+		security.EventLoginFailed, security.EventLoginLockout:
+		outcome = OutcomeFailure
+	}
+	return Record(ctx, storage.AuditRecord{
+		Time:      event.Time,
+		Action:    event.Type,
+		UserID:    event.UserID,
+		SessionID: event.SessionID,
+		ClientIP:  event.ClientIP,
+		Outcome:   outcome,
+		Details:   event.Details,
+	})
+}
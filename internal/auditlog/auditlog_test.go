@@ -0,0 +1,214 @@
+package auditlog
+
+import (
+	"auth_service/internal/clientip"
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/memory"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userID = "123e4567-e89b-12d3-a456-426614174000"
+
+func setup(t *testing.T) *memory.MemoryStorage {
+	t.Helper()
+	db := memory.NewMemoryStorage()
+	Set(db, clientip.Privacy{Mode: clientip.PrivacyTruncate, Truncate: clientip.Granularity{IPv4: 24, IPv6: 48}})
+	t.Cleanup(func() { Set(nil, clientip.Privacy{}) })
+	return db
+}
+
+func query(t *testing.T, db storage.AuditTrail, q storage.AuditQuery) []storage.AuditRecord {
+	t.Helper()
+	q.Limit = 100
+	records, err := db.QueryAuditRecords(q)
+	require.NoError(t, err)
+	return records
+}
+
+// Проверка записи событий безопасности: исполнитель, User-Agent запроса и результат.
+func TestSink(t *testing.T) {
+	db := setup(t)
+	sink := NewSink()
+	assert.True(t, sink.Subscribed(security.EventTokenIssued))
+
+	var ctx context.Context
+	req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+	req.Header.Set("User-Agent", "  Mozilla/5.0  ")
+	Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { ctx = r.Context() })).ServeHTTP(httptest.NewRecorder(), req)
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, sink.Handle(ctx, security.Event{Type: security.EventTokenRotated, Time: at, UserID: userID, SessionID: "session", ClientIP: "10.0.0.0"}))
+	require.NoError(t, sink.Handle(ctx, security.Event{Type: security.EventRefreshFailed, Time: at, UserID: userID, Details: map[string]string{"reason": "refresh_token_expired"}}))
+
+	records := query(t, db, storage.AuditQuery{})
+	require.Len(t, records, 2)
+	assert.Equal(t, security.EventRefreshFailed, records[0].Action)
+	assert.Equal(t, OutcomeFailure, records[0].Outcome)
+	assert.Equal(t, "refresh_token_expired", records[0].Details["reason"])
+	assert.Equal(t, storage.AuditRecord{
+		ID:        records[1].ID,
+		Time:      at,
+		Action:    security.EventTokenRotated,
+		Actor:     userID,
+		UserID:    userID,
+		SessionID: "session",
+		ClientIP:  "10.0.0.0",
+		UserAgent: "Mozilla/5.0",
+		Outcome:   OutcomeSuccess,
+	}, records[1])
+}
+
+// Проверка записи действий администратора: изменяющие запросы, исполнитель,
+// адрес и результат по коду ответа.
+func TestAdmin(t *testing.T) {
+	db := setup(t)
+	sink := NewSink()
+	mux := http.NewServeMux()
+	mux.Handle("/admin/users/{id}/disable", AdminUser(ActionAccountDisable, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// События при обработке запроса записываются от имени администратора.
+		assert.NoError(t, sink.Handle(r.Context(), security.Event{Type: security.EventTokenRevoked, UserID: r.PathValue("id")}))
+		if r.PathValue("id") != userID {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	})))
+	mux.Handle("/admin/maintenance", Admin(ActionMaintenance, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/admin/maintenance", nil),
+		httptest.NewRequest(http.MethodPut, "/admin/maintenance", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/users/"+userID+"/disable", nil),
+		httptest.NewRequest(http.MethodPost, "/admin/users/unknown/disable", nil),
+	} {
+		req.Header.Set("User-Agent", "curl/8.0")
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	records := query(t, db, storage.AuditQuery{Actor: defaultAdminActor})
+	require.Len(t, records, 5, "GET requests are not recorded")
+	failed := records[0]
+	assert.Equal(t, ActionAccountDisable, failed.Action)
+	assert.Equal(t, OutcomeFailure, failed.Outcome)
+	assert.Equal(t, "unknown", failed.UserID)
+	assert.Equal(t, map[string]string{"method": http.MethodPost, "status": "404", "target": "unknown"}, failed.Details)
+
+	disabled := records[2]
+	assert.Equal(t, ActionAccountDisable, disabled.Action)
+	assert.Equal(t, OutcomeSuccess, disabled.Outcome)
+	assert.Equal(t, userID, disabled.UserID)
+	assert.Equal(t, "192.0.2.0", disabled.ClientIP, "the address is stored according to ip_privacy")
+	assert.Equal(t, "curl/8.0", disabled.UserAgent)
+	assert.Equal(t, security.EventTokenRevoked, records[3].Action)
+	assert.Equal(t, defaultAdminActor, records[3].Actor)
+
+	maintenance := records[4]
+	assert.Equal(t, ActionMaintenance, maintenance.Action)
+	assert.Empty(t, maintenance.UserID)
+	assert.Equal(t, map[string]string{"method": http.MethodPut, "status": "200"}, maintenance.Details)
+}
+
+func get(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func decodePage(t *testing.T, rec *httptest.ResponseRecorder) Page {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var page Page
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	return page
+}
+
+// Проверка выборки журнала: условия, период и постраничный вывод.
+func TestHandler(t *testing.T) {
+	assert.Equal(t, http.StatusNotImplemented, get(t, "/admin/audit").Code)
+
+	db := setup(t)
+	start := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		outcome := OutcomeSuccess
+		if i%2 == 1 {
+			outcome = OutcomeFailure
+		}
+		require.NoError(t, db.AppendAuditRecord(storage.AuditRecord{
+			Time:    start.Add(time.Duration(i) * time.Hour),
+			Action:  security.EventTokenIssued,
+			Actor:   userID,
+			UserID:  userID,
+			Outcome: outcome,
+		}))
+	}
+
+	page := decodePage(t, get(t, "/admin/audit?limit=2"))
+	require.Len(t, page.Records, 2)
+	require.NotNil(t, page.NextBefore)
+	assert.Equal(t, page.Records[1].ID, *page.NextBefore)
+	assert.Equal(t, start.Add(4*time.Hour), page.Records[0].Time)
+	assert.Equal(t, map[string]string{}, page.Records[0].Details)
+
+	page = decodePage(t, get(t, "/admin/audit?limit=2&before="+strconv.FormatInt(*page.NextBefore, 10)))
+	require.Len(t, page.Records, 2)
+	assert.Equal(t, start.Add(2*time.Hour), page.Records[0].Time)
+	page = decodePage(t, get(t, "/admin/audit?limit=2&before="+strconv.FormatInt(*page.NextBefore, 10)))
+	require.Len(t, page.Records, 1)
+	assert.Nil(t, page.NextBefore)
+
+	page = decodePage(t, get(t, "/admin/audit?outcome=failure&user_id="+userID))
+	assert.Len(t, page.Records, 2)
+	page = decodePage(t, get(t, "/admin/audit?from=2026-01-02T01:00:00Z&to=2026-01-02T03:00:00Z"))
+	assert.Len(t, page.Records, 2)
+	page = decodePage(t, get(t, "/admin/audit?action=admin_maintenance"))
+	assert.Empty(t, page.Records)
+
+	for _, target := range []string{
+		"/admin/audit?limit=0",
+		"/admin/audit?limit=1001",
+		"/admin/audit?from=yesterday",
+		"/admin/audit?from=2026-01-02T03:00:00Z&to=2026-01-02T01:00:00Z",
+		"/admin/audit?before=0",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(t, target).Code, target)
+	}
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/audit", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+// Проверка истории входов: только выдача и обновление токенов пользователя.
+func TestHistory(t *testing.T) {
+	_, err := History(userID, 0, 10)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	db := setup(t)
+	for _, record := range []storage.AuditRecord{
+		{Action: security.EventTokenIssued, UserID: userID},
+		{Action: security.EventRefreshFailed, UserID: userID},
+		{Action: security.EventTokenRotated, UserID: userID},
+		{Action: security.EventTokenIssued, UserID: "other"},
+		{Action: security.EventTokenRevoked, UserID: userID},
+	} {
+		require.NoError(t, db.AppendAuditRecord(record))
+	}
+
+	records, err := History(userID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, security.EventTokenRotated, records[0].Action)
+	assert.Equal(t, security.EventTokenIssued, records[1].Action)
+
+	records, err = History(userID, records[0].ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
@@ -0,0 +1,148 @@
+package auditlog
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/internal/storage"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Количество записей в ответе по умолчанию и наибольшее.
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// Запись журнала в ответе GET /admin/audit.
+type Entry struct {
+	ID        int64     `json:"id"`
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	UserID    string    `json:"user_id"`
+	SessionID string    `json:"session_id"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	// success или failure.
+	Outcome string            `json:"outcome"`
+	Details map[string]string `json:"details"`
+}
+
+// Страница журнала в ответе GET /admin/audit.
+type Page struct {
+	Records []Entry `json:"records"`
+	// Значение параметра before для следующей страницы; null, если записей больше нет.
+	NextBefore *int64 `json:"next_before"`
+}
+
+// Создаёт обработчик GET /admin/audit.
+//
+// Параметры запроса (все необязательные): action, actor, user_id, outcome —
+// точное совпадение; from и to — время в формате RFC 3339, полуинтервал
+// [from, to); before — номер записи, с которой начинается страница (значение
+// next_before предыдущей); limit — размер страницы (по умолчанию 100, не
+// больше 1000). Записи возвращаются начиная с последних.
+//
+// Возвращает:
+// - http.Handler.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		s, _ := current()
+		if s == nil {
+			i18n.Error(w, r, "audit_log_not_supported", http.StatusNotImplemented)
+			return
+		}
+
+		values := r.URL.Query()
+		query := storage.AuditQuery{
+			Action:  values.Get("action"),
+			Actor:   values.Get("actor"),
+			UserID:  values.Get("user_id"),
+			Outcome: values.Get("outcome"),
+			Limit:   defaultLimit,
+		}
+		if value := values.Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxLimit {
+				i18n.Error(w, r, "invalid_limit", http.StatusBadRequest)
+				return
+			}
+			query.Limit = limit
+		}
+		if !parseFilter(values.Get("from"), values.Get("to"), values.Get("before"), &query) {
+			i18n.Error(w, r, "invalid_audit_query", http.StatusBadRequest)
+			return
+		}
+
+		// Запрашивается на одну запись больше, чтобы узнать, есть ли следующая страница.
+		limit := query.Limit
+		query.Limit++
+		records, err := s.QueryAuditRecords(query)
+		if err != nil {
+			i18n.Error(w, r, "service_unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		page := Page{Records: make([]Entry, 0, min(len(records), limit))}
+		if len(records) > limit {
+			records = records[:limit]
+			next := records[limit-1].ID
+			page.NextBefore = &next
+		}
+		for _, record := range records {
+			page.Records = append(page.Records, toEntry(record))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+	})
+}
+
+// Разбирает границы периода и номер записи, с которой начинается страница.
+func parseFilter(from, to, before string, query *storage.AuditQuery) bool {
+	var err error
+	if from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return false
+		}
+	}
+	if to != "" {
+		if query.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return false
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return false
+	}
+	if before != "" {
+		if query.BeforeID, err = strconv.ParseInt(before, 10, 64); err != nil || query.BeforeID < 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Преобразует запись из хранилища в ответ.
+func toEntry(record storage.AuditRecord) Entry {
+	details := record.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+	return Entry{
+		ID:        record.ID,
+		Time:      record.Time.UTC(),
+		Action:    record.Action,
+		Actor:     record.Actor,
+		UserID:    record.UserID,
+		SessionID: record.SessionID,
+		ClientIP:  record.ClientIP,
+		UserAgent: record.UserAgent,
+		Outcome:   record.Outcome,
+		Details:   details,
+	}
+}
@@ -0,0 +1,43 @@
+package auditlog
+
+import (
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"errors"
+	"fmt"
+)
+
+// Действия, из которых состоит история входов пользователя: выдача токенов
+// новой сессии (вход) и их обновление.
+var historyActions = []string{security.EventTokenIssued, security.EventTokenRotated}
+
+// Ошибка History, если драйвер хранилища не поддерживает журнал действий.
+var ErrNotSupported = errors.New("audit log is not supported by the storage driver")
+
+// Возвращает историю входов пользователя — записи журнала о выдаче
+// (token_issued) и обновлении (token_rotated) его токенов, начиная с последних.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - beforeID: только записи с номером меньше beforeID; 0 — с последней.
+// - limit: наибольшее количество записей.
+//
+// Возвращает:
+// - записи журнала.
+// - ErrNotSupported, если хранилище не установлено (см. Set), или ошибку хранилища.
+func History(userID string, beforeID int64, limit int) ([]storage.AuditRecord, error) {
+	s, _ := current()
+	if s == nil {
+		return nil, ErrNotSupported
+	}
+	records, err := s.QueryAuditRecords(storage.AuditQuery{
+		Actions:  historyActions,
+		UserID:   userID,
+		BeforeID: beforeID,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query login history: %w", err)
+	}
+	return records, nil
+}
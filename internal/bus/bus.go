@@ -0,0 +1,108 @@
+// Пакет bus публикует события безопасности и жизненного цикла токенов в шину
+// сообщений, чтобы SIEM, антифрод и другие сервисы получали их без опроса
+// базы данных.
+//
+// Sink переводит событие в сообщение общего формата (Message), а доставку
+// выполняет Publisher выбранного брокера: Kafka (пакет kafka), NATS (пакет
+// nats) или RabbitMQ (пакет rabbitmq). Брокер выбирается в конфигурации
+// (пакет factory); новый брокер подключается реализацией Publisher.
+package bus
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/security"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var published = metrics.NewCounterVec(
+	"auth_bus_events_total",
+	"Number of events published to the message bus, by broker, type and result (success, failure).",
+	"broker", "type", "result",
+)
+
+// Сообщение о событии; тело публикуется в формате JSON.
+type Message struct {
+	// Идентификатор события; у события из outbox не меняется при повторной
+	// публикации, поэтому потребитель может по нему отбрасывать дубли.
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Severity  string            `json:"severity"`
+	Time      time.Time         `json:"time"`
+	UserID    string            `json:"user_id"`
+	SessionID string            `json:"session_id,omitempty"`
+	ClientIP  string            `json:"client_ip,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Клиент брокера сообщений.
+type Publisher interface {
+	// Имя брокера для логов и метрик.
+	Name() string
+	// Публикует сообщение и ждёт подтверждения брокера; body — сообщение в
+	// формате JSON, поля message используются для ключа, темы и заголовков.
+	Publish(ctx context.Context, message Message, body []byte) error
+	// Закрывает соединения с брокером.
+	Close() error
+}
+
+// Получатель событий, публикующий их в шину сообщений.
+type Sink struct {
+	publisher Publisher
+	events    []string
+}
+
+// Создаёт обработчик событий.
+//
+// Принимает:
+// - publisher: клиент брокера.
+// - events: типы публикуемых событий; пусто — все, включая события
+// жизненного цикла токенов (token_issued, token_rotated, token_revoked).
+//
+// Возвращает:
+// - указатель на Sink.
+func NewSink(publisher Publisher, events []string) *Sink {
+	return &Sink{publisher: publisher, events: events}
+}
+
+// Возвращает имя брокера.
+func (s *Sink) Name() string {
+	return s.publisher.Name()
+}
+
+// Сообщает, публикуются ли события этого типа.
+func (s *Sink) Subscribed(eventType string) bool {
+	return len(s.events) == 0 || slices.Contains(s.events, eventType)
+}
+
+// Публикует событие.
+func (s *Sink) Handle(ctx context.Context, event security.Event) error {
+	message := Message{
+		ID:        cmp.Or(event.ID, uuid.NewString()),
+		Type:      event.Type,
+		Severity:  string(event.Severity),
+		Time:      event.Time.UTC(),
+		UserID:    event.UserID,
+		SessionID: event.SessionID,
+		ClientIP:  event.ClientIP,
+		Details:   event.Details,
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode bus message: %w", err)
+	}
+
+	broker := s.publisher.Name()
+	if err := s.publisher.Publish(ctx, message, body); err != nil {
+		published.Inc(broker, event.Type, "failure")
+		return err
+	}
+	published.Inc(broker, event.Type, "success")
+	return nil
+}
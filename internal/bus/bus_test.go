@@ -0,0 +1,75 @@
+package bus_test
+
+import (
+	"auth_service/internal/bus"
+	"auth_service/internal/security"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Клиент брокера, сохраняющий сообщения и возвращающий заданную ошибку.
+type fakePublisher struct {
+	err      error
+	messages []bus.Message
+	bodies   [][]byte
+}
+
+func (f *fakePublisher) Name() string { return "fake" }
+
+func (f *fakePublisher) Publish(ctx context.Context, message bus.Message, body []byte) error {
+	f.messages = append(f.messages, message)
+	f.bodies = append(f.bodies, body)
+	return f.err
+}
+
+func (f *fakePublisher) Close() error { return nil }
+
+func TestSink_Handle(t *testing.T) {
+	publisher := &fakePublisher{}
+	sink := bus.NewSink(publisher, nil)
+	assert.Equal(t, "fake", sink.Name())
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("MSK", 3*60*60))
+	require.NoError(t, sink.Handle(context.Background(), security.Event{
+		ID:       "event-1",
+		Type:     security.EventGeoBlocked,
+		Severity: security.SeverityMedium,
+		Time:     at,
+		UserID:   "user",
+		Details:  map[string]string{"country": "XX"},
+	}))
+	want := bus.Message{
+		ID:       "event-1",
+		Type:     security.EventGeoBlocked,
+		Severity: "medium",
+		Time:     at.UTC(),
+		UserID:   "user",
+		Details:  map[string]string{"country": "XX"},
+	}
+	require.Len(t, publisher.messages, 1)
+	assert.Equal(t, want, publisher.messages[0])
+	var decoded bus.Message
+	require.NoError(t, json.Unmarshal(publisher.bodies[0], &decoded))
+	assert.Equal(t, want, decoded)
+
+	// Событию без идентификатора назначается новый.
+	publisher.err = errors.New("broker unavailable")
+	assert.Error(t, sink.Handle(context.Background(), security.Event{Type: security.EventTokenIssued, Time: at}))
+	assert.NotEmpty(t, publisher.messages[1].ID)
+}
+
+func TestSink_Subscribed(t *testing.T) {
+	all := bus.NewSink(&fakePublisher{}, nil)
+	assert.True(t, all.Subscribed(security.EventTokenRotated))
+	assert.True(t, all.Subscribed(security.EventGeoBlocked))
+
+	some := bus.NewSink(&fakePublisher{}, []string{security.EventIPChange})
+	assert.True(t, some.Subscribed(security.EventIPChange))
+	assert.False(t, some.Subscribed(security.EventTokenIssued))
+}
@@ -0,0 +1,66 @@
+package factory
+
+import (
+	"auth_service/internal/bus"
+	"auth_service/internal/bus/kafka"
+	"auth_service/internal/bus/nats"
+	"auth_service/internal/bus/rabbitmq"
+	"auth_service/internal/config"
+	"crypto/tls"
+	"fmt"
+)
+
+// Поддерживаемые брокеры сообщений.
+const (
+	DriverKafka    = "kafka"
+	DriverNATS     = "nats"
+	DriverRabbitMQ = "rabbitmq"
+)
+
+// Создаёт клиента брокера, выбранного в конфигурации.
+//
+// Принимает:
+// - cfg: настройки шины сообщений.
+//
+// Возвращает:
+// - клиента брокера; nil, если драйвер не задан (публикация выключена).
+// - ошибку, если драйвер неизвестен или настройки некорректны.
+func New(cfg config.MessageBus) (bus.Publisher, error) {
+	var publisher bus.Publisher
+	var err error
+	switch cfg.Driver {
+	case "":
+		return nil, nil
+	case DriverKafka:
+		kafkaCfg := kafka.Config{
+			Brokers:  cfg.Kafka.Brokers,
+			Topic:    cfg.Kafka.Topic,
+			ClientID: cfg.Kafka.ClientID,
+			Timeout:  cfg.Timeout,
+		}
+		if cfg.Kafka.TLS {
+			kafkaCfg.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		publisher, err = kafka.NewProducer(kafkaCfg)
+	case DriverNATS:
+		publisher, err = nats.NewPublisher(nats.Config{
+			URL:     cfg.NATS.URL,
+			Subject: cfg.NATS.Subject,
+			Name:    cfg.NATS.Name,
+			Timeout: cfg.Timeout,
+		})
+	case DriverRabbitMQ:
+		publisher, err = rabbitmq.NewPublisher(rabbitmq.Config{
+			URL:      cfg.RabbitMQ.URL,
+			Exchange: cfg.RabbitMQ.Exchange,
+			Name:     cfg.RabbitMQ.Name,
+			Timeout:  cfg.Timeout,
+		})
+	default:
+		return nil, fmt.Errorf("unknown message bus driver %q", cfg.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return publisher, nil
+}
@@ -0,0 +1,43 @@
+package factory_test
+
+import (
+	"auth_service/internal/bus/factory"
+	"auth_service/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка выбора брокера по конфигурации.
+func TestNew_DriverSelection(t *testing.T) {
+	cfg := config.MessageBus{
+		Timeout:  time.Second,
+		Kafka:    config.Kafka{Brokers: []string{"localhost:9092"}, Topic: "auth-events"},
+		NATS:     config.NATS{URL: "nats://localhost:4222", Subject: "auth.events"},
+		RabbitMQ: config.RabbitMQ{URL: "amqp://localhost", Exchange: "auth.events"},
+	}
+
+	publisher, err := factory.New(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, publisher, "publishing is disabled without a driver")
+
+	for _, driver := range []string{factory.DriverKafka, factory.DriverNATS, factory.DriverRabbitMQ} {
+		cfg.Driver = driver
+		publisher, err := factory.New(cfg)
+		require.NoError(t, err, driver)
+		assert.Equal(t, driver, publisher.Name())
+		assert.NoError(t, publisher.Close())
+	}
+
+	cfg.Driver = factory.DriverNATS
+	cfg.NATS.URL = "http://localhost"
+	publisher, err = factory.New(cfg)
+	assert.Error(t, err)
+	assert.Nil(t, publisher)
+
+	cfg.Driver = "sqs"
+	_, err = factory.New(cfg)
+	assert.Error(t, err)
+}
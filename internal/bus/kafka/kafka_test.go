@@ -0,0 +1,307 @@
+package kafka
+
+import (
+	"auth_service/internal/bus"
+	"auth_service/internal/security"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Принятая брокером запись.
+type produced struct {
+	partition int32
+	record    Record
+}
+
+// Брокер Kafka для тестов: отвечает на Metadata и Produce одного топика.
+type fakeBroker struct {
+	t          *testing.T
+	listener   net.Listener
+	topic      string
+	partitions int32
+
+	mu sync.Mutex
+	// Коды ошибок, которыми отвечаются следующие запросы Produce.
+	produceErrors []int16
+	records       []produced
+	metadataCalls int
+}
+
+func newFakeBroker(t *testing.T, topic string, partitions int32) *fakeBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &fakeBroker{t: t, listener: listener, topic: topic, partitions: partitions}
+	t.Cleanup(func() { listener.Close() })
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		d := decoder{buf: req}
+		apiKey, version, correlation := d.int16(), d.int16(), d.int32()
+		d.string() // client id
+
+		var resp encoder
+		resp.int32(0)
+		resp.int32(correlation)
+		switch apiKey {
+		case apiMetadata:
+			assert.Equal(b.t, metadataVersion, version)
+			b.metadata(&resp)
+		case apiProduce:
+			assert.Equal(b.t, produceVersion, version)
+			b.produce(&d, &resp)
+		default:
+			b.t.Errorf("unexpected api key %d", apiKey)
+			return
+		}
+		binary.BigEndian.PutUint32(resp.buf, uint32(len(resp.buf)-4))
+		if _, err := conn.Write(resp.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) metadata(resp *encoder) {
+	b.mu.Lock()
+	b.metadataCalls++
+	b.mu.Unlock()
+
+	host, port, _ := net.SplitHostPort(b.addr())
+	portNumber, _ := strconv.Atoi(port)
+	resp.int32(0) // throttle time
+	resp.int32(1)
+	resp.int32(1)
+	resp.string(host)
+	resp.int32(int32(portNumber))
+	resp.int16(-1) // rack
+	resp.string("cluster")
+	resp.int32(1)
+	resp.int32(1)
+	resp.int16(0)
+	resp.string(b.topic)
+	resp.int8(0)
+	resp.int32(b.partitions)
+	// Разделы в обратном порядке: клиент упорядочивает их сам.
+	for id := b.partitions - 1; id >= 0; id-- {
+		resp.int16(0)
+		resp.int32(id)
+		resp.int32(1)
+		resp.int32(1)
+		resp.int32(1)
+		resp.int32(1)
+		resp.int32(1)
+	}
+}
+
+func (b *fakeBroker) produce(d *decoder, resp *encoder) {
+	d.string() // transactional id
+	assert.Equal(b.t, int16(-1), d.int16(), "acks=all")
+	d.int32()
+	require.Equal(b.t, 1, d.arrayLen())
+	topic := d.string()
+	require.Equal(b.t, 1, d.arrayLen())
+	partition := d.int32()
+	batch := d.bytes()
+	require.NoError(b.t, d.err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var code int16
+	if len(b.produceErrors) > 0 {
+		code, b.produceErrors = b.produceErrors[0], b.produceErrors[1:]
+	} else {
+		for _, r := range decodeRecordBatch(b.t, batch) {
+			b.records = append(b.records, produced{partition: partition, record: r})
+		}
+	}
+
+	resp.int32(1)
+	resp.string(topic)
+	resp.int32(1)
+	resp.int32(partition)
+	resp.int16(code)
+	resp.int64(0)
+	resp.int64(-1)
+	resp.int32(0) // throttle time
+}
+
+// Разбирает RecordBatch и проверяет его CRC.
+func decodeRecordBatch(t *testing.T, batch []byte) []Record {
+	d := decoder{buf: batch}
+	d.int64()
+	length := d.int32()
+	assert.Equal(t, int(length), len(d.buf))
+	d.int32()
+	assert.Equal(t, recordBatchMagic, d.int8())
+	crc := uint32(d.int32())
+	assert.Equal(t, crc32.Checksum(d.buf, castagnoli), crc)
+	d.int16()
+	d.int32()
+	first := d.int64()
+	d.int64()
+	d.int64()
+	d.int16()
+	d.int32()
+
+	var records []Record
+	for i, n := 0, int(d.int32()); i < n; i++ {
+		d.varint()
+		d.int8()
+		r := Record{Timestamp: first + d.varint()}
+		d.varint()
+		r.Key = d.varbytes()
+		r.Value = d.varbytes()
+		for j, headers := 0, int(d.varint()); j < headers; j++ {
+			r.Headers = append(r.Headers, Header{Key: string(d.varbytes()), Value: d.varbytes()})
+		}
+		records = append(records, r)
+	}
+	require.NoError(t, d.err)
+	return records
+}
+
+func newProducer(t *testing.T, broker *fakeBroker) *Producer {
+	t.Helper()
+	p, err := NewProducer(Config{Brokers: []string{broker.addr()}, Topic: "auth-events", ClientID: "auth_service", Timeout: time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// Проверка публикации событий: формат записи, ключ и выбор раздела.
+func TestProducer_Publish(t *testing.T) {
+	broker := newFakeBroker(t, "auth-events", 4)
+	sink := bus.NewSink(newProducer(t, broker), nil)
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	require.NoError(t, sink.Handle(context.Background(), security.Event{
+		ID:        "event-1",
+		Type:      security.EventIPChange,
+		Severity:  security.SeverityMedium,
+		Time:      at,
+		UserID:    userID,
+		SessionID: "session",
+		ClientIP:  "192.0.2.1",
+		Details:   map[string]string{"previous_ip": "192.0.2.2"},
+	}))
+	require.NoError(t, sink.Handle(context.Background(), security.Event{Type: security.EventTokenIssued, Time: at, UserID: userID}))
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	require.Len(t, broker.records, 2)
+	first := broker.records[0]
+	assert.Equal(t, []byte(userID), first.record.Key)
+	assert.Equal(t, int32(partitionFor([]byte(userID), 4)), first.partition)
+	assert.Equal(t, broker.records[1].partition, first.partition, "events of one user go to one partition")
+	assert.Equal(t, at.UnixMilli(), first.record.Timestamp)
+	assert.Equal(t, []Header{{Key: EventHeader, Value: []byte(security.EventIPChange)}}, first.record.Headers)
+
+	var message bus.Message
+	require.NoError(t, json.Unmarshal(first.record.Value, &message))
+	assert.Equal(t, bus.Message{
+		ID:        "event-1",
+		Type:      security.EventIPChange,
+		Severity:  "medium",
+		Time:      at,
+		UserID:    userID,
+		SessionID: "session",
+		ClientIP:  "192.0.2.1",
+		Details:   map[string]string{"previous_ip": "192.0.2.2"},
+	}, message)
+
+	require.NoError(t, json.Unmarshal(broker.records[1].record.Value, &message))
+	assert.NotEmpty(t, message.ID)
+	assert.Equal(t, security.EventTokenIssued, message.Type)
+}
+
+// Проверка повтора после смены лидера раздела и ошибки, которую повтор не исправит.
+func TestProducer_Errors(t *testing.T) {
+	broker := newFakeBroker(t, "auth-events", 1)
+	p := newProducer(t, broker)
+
+	broker.mu.Lock()
+	broker.produceErrors = []int16{errNotLeaderOrFollower}
+	broker.mu.Unlock()
+	require.NoError(t, p.Produce(context.Background(), Record{Value: []byte("a")}))
+	broker.mu.Lock()
+	assert.Len(t, broker.records, 1)
+	assert.Equal(t, 2, broker.metadataCalls, "metadata is refreshed after a leader change")
+	broker.produceErrors = []int16{10} // MESSAGE_TOO_LARGE
+	broker.mu.Unlock()
+
+	err := p.Produce(context.Background(), Record{Value: []byte("b")})
+	var brokerErr *BrokerError
+	require.ErrorAs(t, err, &brokerErr)
+	assert.Equal(t, int16(10), brokerErr.Code)
+
+	// Топика нет у брокера.
+	missing, err := NewProducer(Config{Brokers: []string{broker.addr()}, Topic: "missing", Timeout: time.Second})
+	require.NoError(t, err)
+	defer missing.Close()
+	assert.Error(t, missing.Produce(context.Background(), Record{Value: []byte("c")}))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := Config{Brokers: []string{"kafka:9092"}, Topic: "auth-events", Timeout: time.Second}
+	assert.NoError(t, valid.Validate())
+
+	for name, cfg := range map[string]Config{
+		"no brokers":     {Topic: "auth-events", Timeout: time.Second},
+		"invalid broker": {Brokers: []string{"kafka"}, Topic: "auth-events", Timeout: time.Second},
+		"no topic":       {Brokers: []string{"kafka:9092"}, Timeout: time.Second},
+		"no timeout":     {Brokers: []string{"kafka:9092"}, Topic: "auth-events"},
+	} {
+		assert.Error(t, cfg.Validate(), name)
+	}
+}
+
+func TestMurmur2(t *testing.T) {
+	// Значения стандартного клиента Kafka.
+	for key, want := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"abc":                        479470107,
+	} {
+		assert.Equal(t, want, murmur2([]byte(key)), key)
+	}
+}
@@ -0,0 +1,371 @@
+// Пакет kafka публикует события шины сообщений (см. пакет bus) в топик Kafka.
+//
+// Клиент реализует только то, что нужно для отправки: запросы Metadata (v4)
+// и Produce (v3) с пакетами записей без сжатия, подтверждение записи всеми
+// репликами (acks=all) и выбор раздела по ключу так же, как стандартный
+// клиент Kafka (murmur2), поэтому события одного пользователя попадают в
+// один раздел и читаются по порядку.
+package kafka
+
+import (
+	"auth_service/internal/bus"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Как долго используются полученные метаданные топика.
+const metadataTTL = 5 * time.Minute
+
+// Заголовок записи с типом события.
+const EventHeader = "event_type"
+
+// Настройки подключения.
+type Config struct {
+	// Адреса брокеров для первого подключения (host:port).
+	Brokers []string
+	Topic   string
+	// Идентификатор клиента в логах и квотах брокера.
+	ClientID string
+	// Время ожидания подключения и ответа брокера.
+	Timeout time.Duration
+	// Настройки TLS; nil — без шифрования.
+	TLS *tls.Config
+}
+
+// Проверяет настройки.
+func (c Config) Validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("kafka brokers are required")
+	}
+	for _, broker := range c.Brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			return fmt.Errorf("invalid kafka broker address %q: %w", broker, err)
+		}
+	}
+	if c.Topic == "" {
+		return errors.New("kafka topic is required")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("kafka timeout must be positive")
+	}
+	return nil
+}
+
+// Раздел топика и адрес его лидера.
+type partition struct {
+	id     int32
+	leader string
+}
+
+// Клиент, отправляющий записи в один топик.
+//
+// Безопасен для конкурентного использования; запросы к брокерам выполняются
+// по одному.
+type Producer struct {
+	cfg Config
+
+	mu          sync.Mutex
+	conns       map[string]net.Conn
+	partitions  []partition
+	metadataAt  time.Time
+	correlation int32
+	// Счётчик для записей без ключа: они распределяются по разделам по очереди.
+	next int
+}
+
+// Создаёт клиента; подключение выполняется при первой отправке.
+//
+// Принимает:
+// - cfg: настройки подключения.
+//
+// Возвращает:
+// - указатель на Producer.
+// - ошибку, если настройки некорректны.
+func NewProducer(cfg Config) (*Producer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Producer{cfg: cfg, conns: make(map[string]net.Conn)}, nil
+}
+
+// Отправляет запись и ждёт подтверждения всех реплик.
+//
+// Если брокер сообщает о смене лидера раздела или соединение разорвано,
+// метаданные запрашиваются заново и отправка повторяется один раз.
+//
+// Принимает:
+// - ctx: контекст; его срок ограничивает ожидание ответа.
+// - record: запись; Timestamp 0 — текущее время.
+//
+// Возвращает:
+// - ошибку, если запись не принята.
+func (p *Producer) Produce(ctx context.Context, record Record) error {
+	if record.Timestamp == 0 {
+		record.Timestamp = time.Now().UnixMilli()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = p.produce(ctx, record); err == nil {
+			return nil
+		}
+		var brokerErr *BrokerError
+		if errors.As(err, &brokerErr) && !brokerErr.retriable() {
+			break
+		}
+		// Лидер раздела мог смениться: метаданные запрашиваются заново.
+		p.metadataAt = time.Time{}
+	}
+	return fmt.Errorf("failed to produce to kafka topic %s: %w", p.cfg.Topic, err)
+}
+
+// Возвращает имя брокера.
+func (p *Producer) Name() string {
+	return "kafka"
+}
+
+// Публикует событие; ключ записи — идентификатор пользователя, поэтому
+// события одного пользователя попадают в один раздел.
+func (p *Producer) Publish(ctx context.Context, message bus.Message, body []byte) error {
+	record := Record{
+		Value:     body,
+		Headers:   []Header{{Key: EventHeader, Value: []byte(message.Type)}},
+		Timestamp: message.Time.UnixMilli(),
+	}
+	if message.UserID != "" {
+		record.Key = []byte(message.UserID)
+	}
+	return p.Produce(ctx, record)
+}
+
+// Закрывает соединения с брокерами.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for addr, conn := range p.conns {
+		errs = append(errs, conn.Close())
+		delete(p.conns, addr)
+	}
+	return errors.Join(errs...)
+}
+
+// Выполняет одну попытку отправки; вызывается под p.mu.
+func (p *Producer) produce(ctx context.Context, record Record) error {
+	if err := p.refreshMetadata(ctx); err != nil {
+		return err
+	}
+	var part partition
+	if record.Key != nil {
+		part = p.partitions[partitionFor(record.Key, len(p.partitions))]
+	} else {
+		part = p.partitions[p.next%len(p.partitions)]
+		p.next++
+	}
+	if part.leader == "" {
+		return &BrokerError{Code: errLeaderNotAvailable}
+	}
+
+	var req encoder
+	req.int16(-1) // transactional id: null
+	req.int16(-1) // acks: все реплики
+	req.int32(int32(p.cfg.Timeout / time.Millisecond))
+	req.int32(1)
+	req.string(p.cfg.Topic)
+	req.int32(1)
+	req.int32(part.id)
+	req.bytes(encodeRecordBatch([]Record{record}))
+
+	resp, err := p.roundTrip(ctx, part.leader, apiProduce, produceVersion, req.buf)
+	if err != nil {
+		return err
+	}
+	d := decoder{buf: resp}
+	for i, topics := 0, d.arrayLen(); i < topics; i++ {
+		d.string()
+		for j, parts := 0, d.arrayLen(); j < parts; j++ {
+			d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code != 0 && d.err == nil {
+				return &BrokerError{Code: code}
+			}
+		}
+	}
+	return d.err
+}
+
+// Запрашивает разделы топика и их лидеров, если метаданные устарели.
+func (p *Producer) refreshMetadata(ctx context.Context) error {
+	if len(p.partitions) > 0 && time.Since(p.metadataAt) < metadataTTL {
+		return nil
+	}
+
+	var req encoder
+	req.int32(1)
+	req.string(p.cfg.Topic)
+	req.int8(0) // не создавать топик автоматически
+
+	var errs []error
+	for _, broker := range p.cfg.Brokers {
+		resp, err := p.roundTrip(ctx, broker, apiMetadata, metadataVersion, req.buf)
+		if err == nil {
+			err = p.parseMetadata(resp)
+		}
+		if err == nil {
+			p.metadataAt = time.Now()
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+	}
+	return fmt.Errorf("failed to get kafka metadata: %w", errors.Join(errs...))
+}
+
+// Разбирает ответ Metadata v4.
+func (p *Producer) parseMetadata(resp []byte) error {
+	d := decoder{buf: resp}
+	d.int32() // throttle time
+	brokers := make(map[int32]string)
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster id
+	d.int32()  // controller id
+
+	var partitions []partition
+	var topicErr int16
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		for j, parts := 0, d.arrayLen(); j < parts; j++ {
+			d.int16() // partition error
+			id := d.int32()
+			leader := d.int32()
+			for k, replicas := 0, d.arrayLen(); k < replicas; k++ {
+				d.int32()
+			}
+			for k, isr := 0, d.arrayLen(); k < isr; k++ {
+				d.int32()
+			}
+			if name == p.cfg.Topic {
+				partitions = append(partitions, partition{id: id, leader: brokers[leader]})
+			}
+		}
+		if name == p.cfg.Topic {
+			topicErr = code
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if topicErr != 0 {
+		return &BrokerError{Code: topicErr}
+	}
+	if len(partitions) == 0 {
+		return &BrokerError{Code: errUnknownTopicOrPartition}
+	}
+	// Разделы упорядочиваются по номеру, чтобы ключ выбирал тот же раздел,
+	// что и у стандартного клиента.
+	ordered := make([]partition, len(partitions))
+	for _, part := range partitions {
+		if int(part.id) >= len(ordered) || part.id < 0 {
+			return fmt.Errorf("unexpected kafka partition %d", part.id)
+		}
+		ordered[part.id] = part
+	}
+	p.partitions = ordered
+	return nil
+}
+
+// Отправляет запрос брокеру и возвращает тело ответа. При ошибке соединение
+// закрывается, чтобы следующий запрос открыл новое.
+func (p *Producer) roundTrip(ctx context.Context, addr string, apiKey, version int16, body []byte) ([]byte, error) {
+	conn, err := p.conn(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.exchange(ctx, conn, apiKey, version, body)
+	if err != nil {
+		_ = conn.Close()
+		delete(p.conns, addr)
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *Producer) exchange(ctx context.Context, conn net.Conn, apiKey, version int16, body []byte) ([]byte, error) {
+	deadline := time.Now().Add(p.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	p.correlation++
+	var req encoder
+	req.int32(0) // размер, заполняется ниже
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(p.correlation)
+	req.string(p.cfg.ClientID)
+	req.buf = append(req.buf, body...)
+	binary.BigEndian.PutUint32(req.buf, uint32(len(req.buf)-4))
+	if _, err := conn.Write(req.buf); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 {
+		return nil, errShortResponse
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != p.correlation {
+		return nil, fmt.Errorf("kafka response correlation id %d does not match request %d", id, p.correlation)
+	}
+	return resp[4:], nil
+}
+
+// Возвращает открытое соединение с брокером или открывает новое.
+func (p *Producer) conn(ctx context.Context, addr string) (net.Conn, error) {
+	if conn, ok := p.conns[addr]; ok {
+		return conn, nil
+	}
+	dialer := &net.Dialer{Timeout: p.cfg.Timeout}
+	var conn net.Conn
+	var err error
+	if p.cfg.TLS != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: p.cfg.TLS}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to kafka broker %s: %w", addr, err)
+	}
+	p.conns[addr] = conn
+	return conn, nil
+}
@@ -0,0 +1,282 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Ключи и версии запросов протокола Kafka. Версии выбраны так, чтобы их
+// поддерживали брокеры от 1.0 до 4.x.
+const (
+	apiProduce        int16 = 0
+	apiMetadata       int16 = 3
+	produceVersion    int16 = 3
+	metadataVersion   int16 = 4
+	recordBatchMagic  int8  = 2
+	noProducerID      int64 = -1
+	noPartitionLeader int32 = -1
+)
+
+// Коды ошибок брокера, после которых нужно заново получить метаданные.
+const (
+	errUnknownTopicOrPartition int16 = 3
+	errLeaderNotAvailable      int16 = 5
+	errNotLeaderOrFollower     int16 = 6
+	errNotEnoughReplicas       int16 = 19
+)
+
+// Брокер ответил ошибкой.
+type BrokerError struct {
+	Code int16
+}
+
+func (e *BrokerError) Error() string {
+	return fmt.Sprintf("kafka broker error code %d", e.Code)
+}
+
+// Сообщает, что ошибка устранится после обновления метаданных или повтора.
+func (e *BrokerError) retriable() bool {
+	switch e.Code {
+	case errUnknownTopicOrPartition, errLeaderNotAvailable, errNotLeaderOrFollower, errNotEnoughReplicas:
+		return true
+	default:
+		return false
+	}
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Кодирует значения в формате протокола Kafka (big-endian).
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8)   { e.buf = append(e.buf, byte(v)) }
+func (e *encoder) int16(v int16) { e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) }
+func (e *encoder) int32(v int32) { e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v)) }
+func (e *encoder) int64(v int64) { e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v)) }
+func (e *encoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// Значение длиной varint; nil кодируется длиной -1.
+func (e *encoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+var errShortResponse = errors.New("kafka response is truncated")
+
+// Читает значения в формате протокола Kafka; после первой ошибки возвращает
+// нулевые значения, а ошибка сохраняется в err.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errShortResponse
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errShortResponse
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// Строка с длиной int16; null (-1) читается как пустая строка.
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+func (d *decoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// Длина массива; null (-1) читается как пустой массив.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 || int(n) > len(d.buf) {
+		if n > 0 {
+			d.err = errShortResponse
+		}
+		return 0
+	}
+	return int(n)
+}
+
+// Заголовок записи.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Запись для отправки.
+type Record struct {
+	Key     []byte
+	Value   []byte
+	Headers []Header
+	// Время записи в миллисекундах Unix.
+	Timestamp int64
+}
+
+// Кодирует записи одного раздела как RecordBatch (magic 2) без сжатия.
+func encodeRecordBatch(records []Record) []byte {
+	first, last := records[0].Timestamp, records[0].Timestamp
+	for _, r := range records {
+		first, last = min(first, r.Timestamp), max(last, r.Timestamp)
+	}
+
+	// Часть пакета, по которой считается CRC: от attributes до конца.
+	var body encoder
+	body.int16(0) // attributes: без сжатия, без транзакций
+	body.int32(int32(len(records) - 1))
+	body.int64(first)
+	body.int64(last)
+	body.int64(noProducerID)
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(records)))
+	for i, r := range records {
+		var rec encoder
+		rec.int8(0) // attributes
+		rec.varint(r.Timestamp - first)
+		rec.varint(int64(i))
+		rec.varbytes(r.Key)
+		rec.varbytes(r.Value)
+		rec.varint(int64(len(r.Headers)))
+		for _, h := range r.Headers {
+			rec.varbytes([]byte(h.Key))
+			rec.varbytes(h.Value)
+		}
+		body.varint(int64(len(rec.buf)))
+		body.buf = append(body.buf, rec.buf...)
+	}
+
+	var batch encoder
+	batch.int64(0) // base offset назначает брокер
+	// Длина после поля длины: epoch, magic, crc и тело.
+	batch.int32(int32(4 + 1 + 4 + len(body.buf)))
+	batch.int32(noPartitionLeader)
+	batch.int8(recordBatchMagic)
+	batch.int32(int32(crc32.Checksum(body.buf, castagnoli)))
+	batch.buf = append(batch.buf, body.buf...)
+	return batch.buf
+}
+
+// Вычисляет хеш murmur2 ключа так же, как стандартный разделитель клиента
+// Kafka для Java, чтобы записи с одним ключом попадали в тот же раздел.
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// Возвращает раздел для ключа.
+func partitionFor(key []byte, partitions int) int {
+	return int(murmur2(key)&0x7fffffff) % partitions
+}
@@ -0,0 +1,314 @@
+// Пакет nats публикует события шины сообщений (см. пакет bus) в NATS.
+//
+// Клиент реализует текстовый протокол NATS в объёме, нужном для публикации:
+// CONNECT, HPUB (PUB, если сервер не поддерживает заголовки) и PING/PONG.
+// После каждой публикации отправляется PING: ответ PONG означает, что сервер
+// принял сообщение, а ошибка публикации (например, нет прав на тему) приходит
+// до него. Сообщения, опубликованные в тему потока JetStream, сохраняются
+// потоком; заголовок Nats-Msg-Id позволяет JetStream отбрасывать дубли.
+package nats
+
+import (
+	"auth_service/internal/bus"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Заголовки сообщения.
+const (
+	// Идентификатор события; по нему JetStream отбрасывает дубли.
+	MsgIDHeader = "Nats-Msg-Id"
+	// Тип события.
+	EventHeader = "Event-Type"
+)
+
+// Настройки подключения.
+type Config struct {
+	// Адрес сервера: nats://host:4222 или tls://host:4222 для подключения по
+	// TLS; учётные данные указываются в адресе (user:password@ или token@).
+	URL string
+	// Префикс темы: событие публикуется в <Subject>.<тип события>.
+	Subject string
+	// Имя клиента в мониторинге сервера.
+	Name string
+	// Время ожидания подключения и ответа сервера.
+	Timeout time.Duration
+}
+
+// Проверяет настройки.
+func (c Config) Validate() error {
+	if _, err := c.server(); err != nil {
+		return err
+	}
+	if c.Subject == "" || strings.ContainsAny(c.Subject, " \t\r\n*>") {
+		return fmt.Errorf("invalid nats subject %q", c.Subject)
+	}
+	if c.Timeout <= 0 {
+		return errors.New("nats timeout must be positive")
+	}
+	return nil
+}
+
+// Разбирает адрес сервера.
+func (c Config) server() (*url.URL, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nats url: %w", err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("unsupported nats url scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("nats url %q has no port", c.URL)
+	}
+	return u, nil
+}
+
+// Сервер ответил ошибкой (-ERR).
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return "nats server error: " + e.Message
+}
+
+// Сведения о сервере из INFO.
+type serverInfo struct {
+	Headers     bool  `json:"headers"`
+	MaxPayload  int64 `json:"max_payload"`
+	TLSRequired bool  `json:"tls_required"`
+}
+
+// Параметры CONNECT.
+type connectOptions struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name,omitempty"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+	Protocol  int    `json:"protocol"`
+	Headers   bool   `json:"headers"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// Клиент, публикующий сообщения в NATS.
+//
+// Безопасен для конкурентного использования; публикации выполняются по одной.
+type Publisher struct {
+	cfg    Config
+	server *url.URL
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+	info serverInfo
+}
+
+// Создаёт клиента; подключение выполняется при первой публикации.
+//
+// Принимает:
+// - cfg: настройки подключения.
+//
+// Возвращает:
+// - указатель на Publisher.
+// - ошибку, если настройки некорректны.
+func NewPublisher(cfg Config) (*Publisher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	server, _ := cfg.server()
+	return &Publisher{cfg: cfg, server: server}, nil
+}
+
+// Возвращает имя брокера.
+func (p *Publisher) Name() string {
+	return "nats"
+}
+
+// Публикует событие в тему <Subject>.<тип события> и ждёт подтверждения
+// сервера. Если соединение разорвано, оно открывается заново и публикация
+// повторяется один раз.
+func (p *Publisher) Publish(ctx context.Context, message bus.Message, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = p.publish(ctx, message, body); err == nil {
+			return nil
+		}
+		p.reset()
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) {
+			break
+		}
+	}
+	return fmt.Errorf("failed to publish to nats subject %s.%s: %w", p.cfg.Subject, message.Type, err)
+}
+
+// Закрывает соединение с сервером.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.r = nil, nil
+	return err
+}
+
+// Выполняет одну попытку публикации; вызывается под p.mu.
+func (p *Publisher) publish(ctx context.Context, message bus.Message, body []byte) error {
+	if err := p.connect(ctx); err != nil {
+		return err
+	}
+	if err := p.deadline(ctx); err != nil {
+		return err
+	}
+	if p.info.MaxPayload > 0 && int64(len(body)) > p.info.MaxPayload {
+		return fmt.Errorf("nats message size %d exceeds server limit %d", len(body), p.info.MaxPayload)
+	}
+
+	subject := p.cfg.Subject + "." + message.Type
+	var buf strings.Builder
+	if p.info.Headers {
+		headers := "NATS/1.0\r\n" +
+			MsgIDHeader + ": " + message.ID + "\r\n" +
+			EventHeader + ": " + message.Type + "\r\n\r\n"
+		fmt.Fprintf(&buf, "HPUB %s %d %d\r\n%s", subject, len(headers), len(headers)+len(body), headers)
+	} else {
+		fmt.Fprintf(&buf, "PUB %s %d\r\n", subject, len(body))
+	}
+	buf.Write(body)
+	buf.WriteString("\r\nPING\r\n")
+	if _, err := p.conn.Write([]byte(buf.String())); err != nil {
+		return err
+	}
+	return p.awaitPong()
+}
+
+// Открывает соединение, если его нет: читает INFO, при необходимости
+// включает TLS и отправляет CONNECT.
+func (p *Publisher) connect(ctx context.Context) error {
+	if p.conn != nil {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: p.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.server.Host)
+	if err != nil {
+		return fmt.Errorf("failed to connect to nats server %s: %w", p.server.Host, err)
+	}
+	p.conn, p.r = conn, bufio.NewReader(conn)
+	if err := p.deadline(ctx); err != nil {
+		return err
+	}
+
+	line, err := p.readLine()
+	if err != nil {
+		return err
+	}
+	info, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected nats greeting %q", line)
+	}
+	p.info = serverInfo{}
+	if err := json.Unmarshal([]byte(info), &p.info); err != nil {
+		return fmt.Errorf("invalid nats server info: %w", err)
+	}
+
+	if p.server.Scheme == "tls" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.server.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("nats tls handshake failed: %w", err)
+		}
+		p.conn, p.r = tlsConn, bufio.NewReader(tlsConn)
+	} else if p.info.TLSRequired {
+		return errors.New("nats server requires TLS, use a tls:// url")
+	}
+
+	opts := connectOptions{
+		Name:     p.cfg.Name,
+		Lang:     "go",
+		Version:  "1.0.0",
+		Protocol: 1,
+		Headers:  p.info.Headers,
+	}
+	if user := p.server.User; user != nil {
+		if pass, ok := user.Password(); ok {
+			opts.User, opts.Pass = user.Username(), pass
+		} else {
+			opts.AuthToken = user.Username()
+		}
+	}
+	connect, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := p.conn.Write([]byte("CONNECT " + string(connect) + "\r\nPING\r\n")); err != nil {
+		return err
+	}
+	return p.awaitPong()
+}
+
+// Читает ответы сервера до PONG, отвечая на его PING.
+func (p *Publisher) awaitPong() error {
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return &ServerError{Message: strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'")}
+		case line == "+OK", strings.HasPrefix(line, "INFO "):
+			// Подтверждения и обновления списка серверов не нужны.
+		default:
+			return fmt.Errorf("unexpected nats response %q", line)
+		}
+	}
+}
+
+func (p *Publisher) readLine() (string, error) {
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Ограничивает ожидание ответа сервера сроком контекста и Timeout.
+func (p *Publisher) deadline(ctx context.Context) error {
+	deadline := time.Now().Add(p.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return p.conn.SetDeadline(deadline)
+}
+
+// Закрывает соединение после ошибки, чтобы следующая публикация открыла новое.
+func (p *Publisher) reset() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn, p.r = nil, nil
+	}
+}
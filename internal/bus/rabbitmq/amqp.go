@@ -0,0 +1,237 @@
+package rabbitmq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Заголовок протокола AMQP 0-9-1, с которого начинается соединение.
+var protocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+// Типы кадров.
+const (
+	frameMethod    byte = 1
+	frameHeader    byte = 2
+	frameBody      byte = 3
+	frameHeartbeat byte = 8
+	frameEnd       byte = 0xCE
+)
+
+// Максимальный размер кадра, который предлагает клиент.
+const maxFrameSize = 128 * 1024
+
+// Метод AMQP: класс и номер метода в классе.
+type method struct {
+	class, id uint16
+}
+
+func (m method) String() string {
+	return fmt.Sprintf("%d.%d", m.class, m.id)
+}
+
+// Используемые методы.
+var (
+	connectionStart    = method{10, 10}
+	connectionStartOk  = method{10, 11}
+	connectionTune     = method{10, 30}
+	connectionTuneOk   = method{10, 31}
+	connectionOpen     = method{10, 40}
+	connectionOpenOk   = method{10, 41}
+	connectionClose    = method{10, 50}
+	connectionCloseOk  = method{10, 51}
+	channelOpen        = method{20, 10}
+	channelOpenOk      = method{20, 11}
+	channelClose       = method{20, 40}
+	channelCloseOk     = method{20, 41}
+	basicPublish       = method{60, 40}
+	basicReturn        = method{60, 50}
+	basicAck           = method{60, 80}
+	basicNack          = method{60, 120}
+	confirmSelect      = method{85, 10}
+	confirmSelectOk    = method{85, 11}
+	basicClass         = uint16(60)
+	replySuccess       = uint16(200)
+	replyNoRoute       = uint16(312)
+	persistentDelivery = uint8(2)
+)
+
+// Флаги свойств сообщения в заголовке содержимого.
+const (
+	propContentType  uint16 = 1 << 15
+	propHeaders      uint16 = 1 << 13
+	propDeliveryMode uint16 = 1 << 12
+	propMessageID    uint16 = 1 << 7
+	propTimestamp    uint16 = 1 << 6
+	propType         uint16 = 1 << 5
+	propAppID        uint16 = 1 << 3
+)
+
+// Кадр протокола.
+type frame struct {
+	typ     byte
+	channel uint16
+	payload []byte
+}
+
+// Метод кадра; ok = false, если кадр не содержит метода.
+func (f frame) method() (method, *decoder, bool) {
+	if f.typ != frameMethod {
+		return method{}, nil, false
+	}
+	d := &decoder{buf: f.payload}
+	m := method{d.short(), d.short()}
+	return m, d, d.err == nil
+}
+
+func writeFrame(w io.Writer, typ byte, channel uint16, payload []byte) error {
+	buf := make([]byte, 0, 8+len(payload))
+	buf = append(buf, typ)
+	buf = binary.BigEndian.AppendUint16(buf, channel)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = append(buf, payload...)
+	buf = append(buf, frameEnd)
+	_, err := w.Write(buf)
+	return err
+}
+
+func writeMethod(w io.Writer, channel uint16, m method, args []byte) error {
+	var e encoder
+	e.short(m.class)
+	e.short(m.id)
+	e.buf = append(e.buf, args...)
+	return writeFrame(w, frameMethod, channel, e.buf)
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var head [7]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{typ: head[0], channel: binary.BigEndian.Uint16(head[1:])}
+	size := binary.BigEndian.Uint32(head[3:])
+	if size > maxFrameSize {
+		return frame{}, fmt.Errorf("amqp frame size %d exceeds %d", size, maxFrameSize)
+	}
+	f.payload = make([]byte, size+1)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	if f.payload[size] != frameEnd {
+		return frame{}, errors.New("invalid amqp frame end")
+	}
+	f.payload = f.payload[:size]
+	return f, nil
+}
+
+// Кодирует значения в формате AMQP (big-endian).
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) octet(v uint8)     { e.buf = append(e.buf, v) }
+func (e *encoder) short(v uint16)    { e.buf = binary.BigEndian.AppendUint16(e.buf, v) }
+func (e *encoder) long(v uint32)     { e.buf = binary.BigEndian.AppendUint32(e.buf, v) }
+func (e *encoder) longlong(v uint64) { e.buf = binary.BigEndian.AppendUint64(e.buf, v) }
+
+// Короткая строка; длиннее 255 байт обрезается.
+func (e *encoder) shortstr(s string) {
+	s = s[:min(len(s), 255)]
+	e.octet(uint8(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) longstr(s string) {
+	e.long(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// Таблица полей; поддерживаются строки и вложенные таблицы. Поля
+// упорядочиваются по имени, чтобы кодирование было детерминированным.
+func (e *encoder) table(fields map[string]any) {
+	var t encoder
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		t.shortstr(key)
+		switch v := fields[key].(type) {
+		case string:
+			t.octet('S')
+			t.longstr(v)
+		case map[string]any:
+			t.octet('F')
+			t.table(v)
+		}
+	}
+	e.long(uint32(len(t.buf)))
+	e.buf = append(e.buf, t.buf...)
+}
+
+var errShortFrame = errors.New("amqp frame is truncated")
+
+// Читает значения в формате AMQP; после первой ошибки возвращает нулевые
+// значения, а ошибка сохраняется в err.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errShortFrame
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) octet() uint8 {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) short() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) long() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) longlong() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) shortstr() string {
+	return string(d.take(int(d.octet())))
+}
+
+func (d *decoder) longstr() string {
+	return string(d.take(int(d.long())))
+}
+
+// Таблица полей; содержимое не разбирается.
+func (d *decoder) skipTable() {
+	d.take(int(d.long()))
+}
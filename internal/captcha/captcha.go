@@ -0,0 +1,283 @@
+// Пакет captcha проверяет ответ CAPTCHA перед обработкой запросов, которые
+// удобно перебирать автоматически.
+//
+// Проверка выполняется через Verifier; SiteVerifier поддерживает reCAPTCHA,
+// hCaptcha и Cloudflare Turnstile, у которых одинаковый протокол siteverify.
+// Для каждой точки входа задаётся правило (Rule): проверять всегда, только
+// после неудачных попыток или не проверять. Сейчас CAPTCHA поддерживается
+// только при входе по паролю (EndpointLogin): регистрации в сервисе нет.
+package captcha
+
+import (
+	"auth_service/internal/metrics"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Ответ CAPTCHA не передан, хотя для запроса он требуется.
+	ErrRequired = errors.New("captcha is required")
+	// Ответ CAPTCHA отклонён проверяющим сервисом.
+	ErrInvalid = errors.New("captcha is invalid")
+)
+
+// Поставщики CAPTCHA.
+const (
+	ProviderRecaptcha = "recaptcha"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+)
+
+// Адреса проверки ответа поставщиков.
+var verifyURLs = map[string]string{
+	ProviderRecaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// Точки входа, для которых можно требовать CAPTCHA.
+const (
+	EndpointLogin = "login"
+)
+
+var endpoints = []string{EndpointLogin}
+
+// Режимы проверки.
+const (
+	// Не проверять.
+	ModeOff = "off"
+	// Проверять каждый запрос.
+	ModeAlways = "always"
+	// Проверять после AfterFailures неудачных попыток подряд.
+	ModeAfterFailures = "after_failures"
+)
+
+// Правило проверки для точки входа.
+type Rule struct {
+	// ModeOff, ModeAlways или ModeAfterFailures; пустое значение — ModeOff.
+	Mode string
+	// Неудачных попыток подряд, после которых требуется CAPTCHA (для ModeAfterFailures).
+	AfterFailures int
+}
+
+// Проверяет правило.
+func (r Rule) Validate() error {
+	switch r.Mode {
+	case "", ModeOff, ModeAlways:
+		return nil
+	case ModeAfterFailures:
+		if r.AfterFailures <= 0 {
+			return fmt.Errorf("after_failures must be positive, got %d", r.AfterFailures)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown captcha mode %q", r.Mode)
+	}
+}
+
+// Проверяющий ответ CAPTCHA.
+type Verifier interface {
+	// Проверяет ответ CAPTCHA.
+	//
+	// Принимает:
+	// - ctx: контекст запроса.
+	// - token: ответ CAPTCHA, полученный клиентом.
+	// - remoteIP: адрес клиента; пустая строка — не передаётся.
+	//
+	// Возвращает:
+	// - ErrInvalid, если ответ отклонён.
+	// - другую ошибку, если проверить ответ не удалось.
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+var verifications = metrics.NewCounterVec(
+	"auth_captcha_verifications_total",
+	"Number of CAPTCHA checks by endpoint and result (passed, required, invalid, error).",
+	"endpoint", "result",
+)
+
+// Проверяющий через siteverify поставщика CAPTCHA.
+type SiteVerifier struct {
+	url      string
+	secret   string
+	minScore float64
+	client   *http.Client
+}
+
+// Создаёт проверяющего.
+//
+// Принимает:
+// - provider: ProviderRecaptcha, ProviderHCaptcha или ProviderTurnstile.
+// - secret: секретный ключ сайта.
+// - minScore: наименьшая допустимая оценка reCAPTCHA v3; 0 — оценка не проверяется.
+// - timeout: время ожидания ответа поставщика.
+//
+// Возвращает:
+// - указатель на SiteVerifier.
+// - ошибку, если поставщик неизвестен или секрет не задан.
+func New(provider, secret string, minScore float64, timeout time.Duration) (*SiteVerifier, error) {
+	verifyURL, ok := verifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown captcha provider %q", provider)
+	}
+	if secret == "" {
+		return nil, errors.New("captcha secret is required")
+	}
+	if minScore < 0 || minScore > 1 {
+		return nil, fmt.Errorf("min_score must be between 0 and 1, got %g", minScore)
+	}
+	return &SiteVerifier{
+		url:      verifyURL,
+		secret:   secret,
+		minScore: minScore,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Устанавливает адрес проверки вместо адреса поставщика (для тестов и
+// совместимых самостоятельно размещённых сервисов).
+func (v *SiteVerifier) WithURL(verifyURL string) *SiteVerifier {
+	v.url = verifyURL
+	return v
+}
+
+// Ответ siteverify.
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+	// Оценка reCAPTCHA v3; у остальных поставщиков отсутствует.
+	Score *float64 `json:"score"`
+}
+
+// Проверяет ответ CAPTCHA запросом к поставщику.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - token: ответ CAPTCHA, полученный клиентом.
+// - remoteIP: адрес клиента; пустая строка — не передаётся.
+//
+// Возвращает:
+// - ErrInvalid, если поставщик отклонил ответ или оценка ниже минимальной.
+// - другую ошибку, если поставщик недоступен или ответил некорректно.
+func (v *SiteVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create captcha request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha provider responded with status %d", resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode captcha response: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(result.ErrorCodes, ", "))
+	}
+	if v.minScore > 0 && result.Score != nil && *result.Score < v.minScore {
+		return fmt.Errorf("%w: score %g is below %g", ErrInvalid, *result.Score, v.minScore)
+	}
+	return nil
+}
+
+var (
+	mu       sync.RWMutex
+	verifier Verifier
+	rules    map[string]Rule
+)
+
+// Устанавливает проверяющего и правила точек входа. Вызывается при запуске.
+//
+// Принимает:
+// - v: проверяющий; nil — CAPTCHA не проверяется.
+// - r: правила по точкам входа; точки без правила не проверяются.
+//
+// Возвращает:
+// - ошибку, если точка входа неизвестна или правило некорректно; в этом
+// случае действующие правила не меняются.
+func Set(v Verifier, r map[string]Rule) error {
+	for endpoint, rule := range r {
+		if !slices.Contains(endpoints, endpoint) {
+			return fmt.Errorf("unknown captcha endpoint %q", endpoint)
+		}
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("captcha endpoint %q: %w", endpoint, err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	verifier, rules = v, r
+	return nil
+}
+
+// Возвращает проверяющего и правило точки входа, если проверка для неё включена.
+func current(endpoint string) (Verifier, Rule, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	rule := rules[endpoint]
+	return verifier, rule, verifier != nil && rule.Mode != "" && rule.Mode != ModeOff
+}
+
+// Проверяет ответ CAPTCHA, если правило точки входа его требует.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - endpoint: точка входа (EndpointLogin).
+// - token: ответ CAPTCHA из запроса; пустая строка — не передан.
+// - remoteIP: адрес клиента.
+// - failures: возвращает число неудачных попыток подряд (для ModeAfterFailures).
+//
+// Возвращает:
+// - ErrRequired, если ответ требуется, но не передан.
+// - ошибку, для которой errors.Is(err, ErrInvalid), если ответ отклонён.
+// - другую ошибку, если проверить ответ или число попыток не удалось.
+func Check(ctx context.Context, endpoint, token, remoteIP string, failures func() (int, error)) error {
+	v, rule, ok := current(endpoint)
+	if !ok {
+		return nil
+	}
+	if rule.Mode == ModeAfterFailures {
+		n, err := failures()
+		if err != nil {
+			verifications.Inc(endpoint, "error")
+			return fmt.Errorf("failed to count failed attempts: %w", err)
+		}
+		if n < rule.AfterFailures {
+			return nil
+		}
+	}
+	if token == "" {
+		verifications.Inc(endpoint, "required")
+		return ErrRequired
+	}
+	err := v.Verify(ctx, token, remoteIP)
+	switch {
+	case err == nil:
+		verifications.Inc(endpoint, "passed")
+	case errors.Is(err, ErrInvalid):
+		verifications.Inc(endpoint, "invalid")
+	default:
+		verifications.Inc(endpoint, "error")
+	}
+	return err
+}
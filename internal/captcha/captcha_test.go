@@ -0,0 +1,141 @@
+package captcha_test
+
+import (
+	"auth_service/internal/captcha"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Запускает siteverify, отвечающий body и сохраняющий полученную форму.
+func newSiteVerify(t *testing.T, body string) (*httptest.Server, *url.Values) {
+	t.Helper()
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &form
+}
+
+func TestSiteVerifier_Verify(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		minScore float64
+		wantErr  error
+	}{
+		{name: "success", body: `{"success":true}`},
+		{name: "rejected", body: `{"success":false,"error-codes":["invalid-input-response"]}`, wantErr: captcha.ErrInvalid},
+		{name: "score above minimum", body: `{"success":true,"score":0.9}`, minScore: 0.5},
+		{name: "score below minimum", body: `{"success":true,"score":0.1}`, minScore: 0.5, wantErr: captcha.ErrInvalid},
+		{name: "malformed response", body: `not json`, wantErr: errors.New("decode")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, form := newSiteVerify(t, tt.body)
+			v, err := captcha.New(captcha.ProviderTurnstile, "site-secret", tt.minScore, time.Second)
+			require.NoError(t, err)
+
+			err = v.WithURL(server.URL).Verify(context.Background(), "client-token", "203.0.113.7")
+			switch {
+			case tt.wantErr == nil:
+				require.NoError(t, err)
+			case errors.Is(tt.wantErr, captcha.ErrInvalid):
+				assert.ErrorIs(t, err, captcha.ErrInvalid)
+			default:
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, captcha.ErrInvalid)
+			}
+			assert.Equal(t, "site-secret", form.Get("secret"))
+			assert.Equal(t, "client-token", form.Get("response"))
+			assert.Equal(t, "203.0.113.7", form.Get("remoteip"))
+		})
+	}
+}
+
+func TestSiteVerifier_ProviderUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	v, err := captcha.New(captcha.ProviderHCaptcha, "site-secret", 0, time.Second)
+	require.NoError(t, err)
+	err = v.WithURL(server.URL).Verify(context.Background(), "client-token", "")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, captcha.ErrInvalid)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := captcha.New("unknown", "secret", 0, time.Second)
+	assert.Error(t, err)
+	_, err = captcha.New(captcha.ProviderRecaptcha, "", 0, time.Second)
+	assert.Error(t, err)
+	_, err = captcha.New(captcha.ProviderRecaptcha, "secret", 1.5, time.Second)
+	assert.Error(t, err)
+}
+
+// Проверяющий, принимающий только ответ "ok".
+type stubVerifier struct {
+	calls int
+}
+
+func (v *stubVerifier) Verify(_ context.Context, token, _ string) error {
+	v.calls++
+	if token != "ok" {
+		return captcha.ErrInvalid
+	}
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, captcha.Set(nil, nil)) })
+	failures := func(n int) func() (int, error) {
+		return func() (int, error) { return n, nil }
+	}
+
+	v := &stubVerifier{}
+	require.NoError(t, captcha.Set(v, map[string]captcha.Rule{
+		captcha.EndpointLogin: {Mode: captcha.ModeAlways},
+	}))
+	ctx := context.Background()
+	assert.ErrorIs(t, captcha.Check(ctx, captcha.EndpointLogin, "", "", failures(0)), captcha.ErrRequired)
+	assert.ErrorIs(t, captcha.Check(ctx, captcha.EndpointLogin, "bad", "", failures(0)), captcha.ErrInvalid)
+	assert.NoError(t, captcha.Check(ctx, captcha.EndpointLogin, "ok", "", failures(0)))
+
+	require.NoError(t, captcha.Set(v, map[string]captcha.Rule{
+		captcha.EndpointLogin: {Mode: captcha.ModeAfterFailures, AfterFailures: 3},
+	}))
+	calls := v.calls
+	assert.NoError(t, captcha.Check(ctx, captcha.EndpointLogin, "", "", failures(2)))
+	assert.Equal(t, calls, v.calls, "captcha must not be verified before the threshold")
+	assert.ErrorIs(t, captcha.Check(ctx, captcha.EndpointLogin, "", "", failures(3)), captcha.ErrRequired)
+	assert.NoError(t, captcha.Check(ctx, captcha.EndpointLogin, "ok", "", failures(3)))
+
+	storeErr := errors.New("storage down")
+	err := captcha.Check(ctx, captcha.EndpointLogin, "ok", "", func() (int, error) { return 0, storeErr })
+	assert.ErrorIs(t, err, storeErr)
+
+	require.NoError(t, captcha.Set(v, map[string]captcha.Rule{
+		captcha.EndpointLogin: {Mode: captcha.ModeOff},
+	}))
+	assert.NoError(t, captcha.Check(ctx, captcha.EndpointLogin, "", "", failures(100)))
+}
+
+func TestSet_InvalidRules(t *testing.T) {
+	v := &stubVerifier{}
+	assert.Error(t, captcha.Set(v, map[string]captcha.Rule{"register": {Mode: captcha.ModeAlways}}))
+	assert.Error(t, captcha.Set(v, map[string]captcha.Rule{captcha.EndpointLogin: {Mode: "sometimes"}}))
+	assert.Error(t, captcha.Set(v, map[string]captcha.Rule{captcha.EndpointLogin: {Mode: captcha.ModeAfterFailures}}))
+}
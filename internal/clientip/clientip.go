@@ -0,0 +1,260 @@
+// Пакет clientip определяет IP-адрес клиента с учётом прокси и балансировщиков.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Определение адреса клиента по заголовкам доверенных прокси.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// Создаёт Resolver.
+//
+// Принимает:
+// - trustedProxies: адреса и подсети (CIDR) прокси, заголовкам которых можно
+// доверять; без них заголовки игнорируются и используется адрес соединения.
+//
+// Возвращает:
+// - указатель на Resolver.
+// - ошибку, если адрес или подсеть не удалось разобрать.
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// Возвращает IP-адрес клиента, отправившего запрос.
+//
+// Заголовки учитываются, только если запрос пришёл от доверенного прокси.
+// Тогда адрес берётся из первого заголовка, содержащего корректный IP, в
+// порядке Forwarded (RFC 7239), X-Forwarded-For, X-Real-IP. Цепочки Forwarded
+// и X-Forwarded-For просматриваются справа налево: адресом клиента считается
+// последний адрес, не принадлежащий доверенным прокси, поэтому адреса,
+// подставленные самим клиентом в начало цепочки, не учитываются. В остальных
+// случаях используется адрес соединения. Порт отбрасывается.
+//
+// Принимает:
+// - req: HTTP-запрос.
+//
+// Возвращает:
+// - IP-адрес клиента без порта.
+func (r *Resolver) FromRequest(req *http.Request) string {
+	peer := Normalize(req.RemoteAddr)
+	if !r.isTrusted(peer) {
+		return peer
+	}
+
+	if ip, ok := r.fromChain(forwardedFor(req.Header.Values("Forwarded"))); ok {
+		return ip
+	}
+	if ip, ok := r.fromChain(splitList(req.Header.Values("X-Forwarded-For"))); ok {
+		return ip
+	}
+	if ip, ok := parse(req.Header.Get("X-Real-IP")); ok {
+		return ip
+	}
+	return peer
+}
+
+// Создаёт middleware, определяющее адрес клиента и сохраняющее его в контексте
+// запроса для FromRequest.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), contextKey{}, r.FromRequest(req))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// Возвращает IP-адрес клиента, определённый Resolver.Middleware, или адрес
+// соединения без порта, если запрос не прошёл через middleware.
+//
+// Принимает:
+// - req: HTTP-запрос.
+//
+// Возвращает:
+// - IP-адрес клиента без порта.
+func FromRequest(req *http.Request) string {
+	if ip, ok := req.Context().Value(contextKey{}).(string); ok {
+		return ip
+	}
+	return Normalize(req.RemoteAddr)
+}
+
+// Сообщает, принадлежит ли адрес доверенному прокси.
+func (r *Resolver) isTrusted(ip string) bool {
+	addr, err := parseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Возвращает последний адрес цепочки, не принадлежащий доверенным прокси.
+//
+// Если вся цепочка состоит из доверенных прокси, возвращается её первый адрес;
+// некорректный адрес обрывает разбор, и цепочка не используется.
+func (r *Resolver) fromChain(chain []string) (string, bool) {
+	var ip string
+	for i := len(chain) - 1; i >= 0; i-- {
+		var ok bool
+		if ip, ok = parse(chain[i]); !ok {
+			return "", false
+		}
+		if !r.isTrusted(ip) {
+			return ip, true
+		}
+	}
+	return ip, ip != ""
+}
+
+// Возвращает значения параметра for всех элементов заголовков Forwarded.
+func forwardedFor(values []string) []string {
+	var chain []string
+	for _, element := range splitList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			name, node, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && strings.EqualFold(name, "for") {
+				// Значения unknown и _obfuscated не являются адресами и отклоняются parse.
+				chain = append(chain, strings.Trim(node, `"`))
+			}
+		}
+	}
+	return chain
+}
+
+// Разбивает значения заголовков-списков по запятым.
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// Приводит IP-адрес к каноническому виду: отбрасывает порт и зону IPv6,
+// записывает IPv6 в сокращённой форме в нижнем регистре, а IPv4-mapped
+// адреса (::ffff:192.0.2.1) — как IPv4.
+//
+// Принимает:
+// - ip: адрес, возможно с портом.
+//
+// Возвращает:
+// - канонический адрес; если ip не удалось разобрать, ip без изменений.
+func Normalize(ip string) string {
+	if normalized, ok := parse(ip); ok {
+		return normalized
+	}
+	return ip
+}
+
+// Точность сравнения адресов клиента: длины сетевых префиксов, в пределах
+// которых адреса считаются одинаковыми. 0 — сравнение адресов целиком.
+type Granularity struct {
+	IPv4 int
+	IPv6 int
+}
+
+// Проверяет длины префиксов.
+func (g Granularity) Validate() error {
+	if g.IPv4 < 0 || g.IPv4 > 32 {
+		return fmt.Errorf("invalid IPv4 prefix length %d", g.IPv4)
+	}
+	if g.IPv6 < 0 || g.IPv6 > 128 {
+		return fmt.Errorf("invalid IPv6 prefix length %d", g.IPv6)
+	}
+	return nil
+}
+
+// Сообщает, совпадают ли адреса с точностью до префикса.
+//
+// Адреса предварительно нормализуются (см. Normalize); адреса разных семейств
+// различны. Если адрес не удалось разобрать, строки сравниваются как есть.
+//
+// Принимает:
+// - a, b: сравниваемые адреса.
+//
+// Возвращает:
+// - true, если адреса принадлежат одной сети заданного размера.
+func (g Granularity) Same(a, b string) bool {
+	addrA, errA := parseAddr(a)
+	addrB, errB := parseAddr(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	if addrA.Is4() != addrB.Is4() {
+		return false
+	}
+
+	bits := g.IPv6
+	if addrA.Is4() {
+		bits = g.IPv4
+	}
+	if bits == 0 {
+		return addrA == addrB
+	}
+	prefixA, _ := addrA.Prefix(bits)
+	prefixB, _ := addrB.Prefix(bits)
+	return prefixA == prefixB
+}
+
+// Разбирает IP-адрес с необязательным портом и возвращает его канонический вид.
+func parse(value string) (string, bool) {
+	addr, err := parseAddr(value)
+	if err != nil {
+		return "", false
+	}
+	return addr.String(), true
+}
+
+// Разбирает IP-адрес с необязательным портом ("1.2.3.4", "1.2.3.4:80",
+// "2001:db8::1", "[2001:db8::1]:80"), отбрасывая зону и IPv4-mapped префикс.
+func parseAddr(value string) (netip.Addr, error) {
+	value = strings.TrimSpace(value)
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		host, _, splitErr := net.SplitHostPort(value)
+		if splitErr != nil {
+			return netip.Addr{}, err
+		}
+		if addr, err = netip.ParseAddr(host); err != nil {
+			return netip.Addr{}, err
+		}
+	}
+	return addr.Unmap().WithZone(""), nil
+}
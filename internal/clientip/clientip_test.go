@@ -0,0 +1,152 @@
+package clientip_test
+
+import (
+	"auth_service/internal/clientip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка выбора адреса клиента из заголовков доверенных прокси и адреса соединения.
+func TestResolver_FromRequest(t *testing.T) {
+	resolver, err := clientip.NewResolver([]string{"10.0.0.0/8", "2001:db8:ffff::1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{name: "remote addr with port", remoteAddr: "192.0.2.1:54321", want: "192.0.2.1"},
+		{name: "ipv6 remote addr", remoteAddr: "[2001:db8::1]:443", want: "2001:db8::1"},
+		{name: "remote addr without port", remoteAddr: "192.0.2.1", want: "192.0.2.1"},
+		{
+			name:       "untrusted peer headers are ignored",
+			remoteAddr: "192.0.2.1:54321",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Real-IP": "203.0.113.8"},
+			want:       "192.0.2.1",
+		},
+		{
+			name:       "x-forwarded-for chain",
+			remoteAddr: "10.0.0.1:80",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7, 10.0.0.2"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed x-forwarded-for prefix",
+			remoteAddr: "10.0.0.1:80",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.0.0.2"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "x-real-ip",
+			remoteAddr: "[2001:db8:ffff::1]:80",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.8"},
+			want:       "203.0.113.8",
+		},
+		{
+			name:       "forwarded with quoted ipv6 and port",
+			remoteAddr: "10.0.0.1:80",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.2`,
+				"X-Forwarded-For": "203.0.113.7",
+			},
+			want: "2001:db8:cafe::17",
+		},
+		{
+			name:       "obfuscated forwarded falls back to x-forwarded-for",
+			remoteAddr: "10.0.0.1:80",
+			headers:    map[string]string{"Forwarded": "for=_hidden", "X-Forwarded-For": "203.0.113.7:1234"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "invalid headers fall back to remote addr",
+			remoteAddr: "10.0.0.1:80",
+			headers:    map[string]string{"X-Forwarded-For": "not-an-ip", "X-Real-IP": ""},
+			want:       "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			assert.Equal(t, tt.want, resolver.FromRequest(r))
+		})
+	}
+}
+
+// Проверка разбора списка доверенных прокси.
+func TestNewResolver_Invalid(t *testing.T) {
+	_, err := clientip.NewResolver([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = clientip.NewResolver([]string{"proxy.local"})
+	assert.Error(t, err)
+}
+
+// Проверка передачи адреса из middleware в FromRequest.
+func TestMiddleware(t *testing.T) {
+	resolver, err := clientip.NewResolver([]string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	var got string
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = clientip.FromRequest(r)
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:80"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "203.0.113.7", got)
+
+	// Без middleware заголовки не учитываются.
+	assert.Equal(t, "10.0.0.1", clientip.FromRequest(r))
+}
+
+// Проверка приведения адресов к каноническому виду.
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":              "192.0.2.1",
+		"192.0.2.1:8080":         "192.0.2.1",
+		"::ffff:192.0.2.1":       "192.0.2.1",
+		"[::ffff:192.0.2.1]:443": "192.0.2.1",
+		"2001:DB8:0:0:0:0:0:1":   "2001:db8::1",
+		"[2001:db8::1]:443":      "2001:db8::1",
+		"fe80::1%eth0":           "fe80::1",
+		"not-an-ip":              "not-an-ip",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, clientip.Normalize(in), in)
+	}
+}
+
+// Проверка сравнения адресов с точностью до префикса.
+func TestGranularity_Same(t *testing.T) {
+	exact := clientip.Granularity{}
+	assert.True(t, exact.Same("192.0.2.1", "::ffff:192.0.2.1"))
+	assert.True(t, exact.Same("192.0.2.1:1234", "192.0.2.1"))
+	assert.False(t, exact.Same("192.0.2.1", "192.0.2.2"))
+
+	coarse := clientip.Granularity{IPv4: 24, IPv6: 64}
+	assert.True(t, coarse.Same("203.0.113.7", "203.0.113.99"))
+	assert.False(t, coarse.Same("203.0.113.7", "203.0.114.7"))
+	assert.True(t, coarse.Same("2001:db8:1:2::1", "2001:db8:1:2:ffff::5"))
+	assert.False(t, coarse.Same("2001:db8:1:2::1", "2001:db8:1:3::1"))
+	assert.False(t, coarse.Same("192.0.2.1", "2001:db8::1"))
+	assert.False(t, coarse.Same("unknown", "192.0.2.1"))
+}
+
+// Проверка допустимых длин префиксов.
+func TestGranularity_Validate(t *testing.T) {
+	assert.NoError(t, clientip.Granularity{IPv4: 24, IPv6: 64}.Validate())
+	assert.Error(t, clientip.Granularity{IPv4: 33}.Validate())
+	assert.Error(t, clientip.Granularity{IPv6: -1}.Validate())
+}
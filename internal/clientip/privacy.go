@@ -0,0 +1,100 @@
+package clientip
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Режимы хранения IP-адресов.
+const (
+	// Адрес хранится как есть.
+	PrivacyOff = "off"
+	// Хранится только сеть адреса (например, 203.0.113.0 для /24).
+	PrivacyTruncate = "truncate"
+	// Хранится HMAC-SHA256 адреса с секретной солью.
+	PrivacyHash = "hash"
+)
+
+// Префикс хешированных адресов.
+const hashPrefix = "hmac:"
+
+// Способ хранения IP-адресов клиентов в сессиях, токенах и логах.
+type Privacy struct {
+	// Режим: PrivacyOff (или пустая строка), PrivacyTruncate, PrivacyHash.
+	Mode string
+	// Секретная соль для PrivacyHash.
+	Salt string
+	// Длины сохраняемых префиксов для PrivacyTruncate.
+	Truncate Granularity
+}
+
+// Проверяет режим и его параметры.
+func (p Privacy) Validate() error {
+	switch p.Mode {
+	case "", PrivacyOff:
+		return nil
+	case PrivacyTruncate:
+		if p.Truncate.IPv4 == 0 || p.Truncate.IPv6 == 0 {
+			return errors.New("ip privacy truncate mode requires non-zero prefix lengths")
+		}
+		return p.Truncate.Validate()
+	case PrivacyHash:
+		if p.Salt == "" {
+			return errors.New("ip privacy hash mode requires a salt")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown ip privacy mode %q", p.Mode)
+	}
+}
+
+// Возвращает форму адреса, которую можно сохранить.
+//
+// Одинаковые адреса (и адреса одной сети в режиме PrivacyTruncate) дают
+// одинаковый результат, поэтому смену адреса можно обнаружить, сравнивая
+// сохранённые значения. Адрес, который не удалось разобрать, в режимах
+// PrivacyTruncate и PrivacyHash хешируется как строка, чтобы не сохранить его
+// открыто.
+//
+// Принимает:
+// - ip: IP-адрес клиента.
+//
+// Возвращает:
+// - адрес, сеть адреса или "hmac:<hex>" в зависимости от режима.
+func (p Privacy) Apply(ip string) string {
+	switch p.Mode {
+	case PrivacyTruncate:
+		addr, err := parseAddr(ip)
+		if err != nil {
+			return p.hash(ip)
+		}
+		bits := p.Truncate.IPv6
+		if addr.Is4() {
+			bits = p.Truncate.IPv4
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return p.hash(ip)
+		}
+		return prefix.Addr().String()
+	case PrivacyHash:
+		return p.hash(Normalize(ip))
+	default:
+		return ip
+	}
+}
+
+// Возвращает HMAC-SHA256 значения с солью (первые 16 байт в hex).
+func (p Privacy) hash(value string) string {
+	mac := hmac.New(sha256.New, []byte(p.Salt))
+	mac.Write([]byte(value))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Сообщает, хранятся ли адреса в исходном виде.
+func (p Privacy) Raw() bool {
+	return p.Mode == "" || p.Mode == PrivacyOff
+}
@@ -0,0 +1,40 @@
+package clientip_test
+
+import (
+	"auth_service/internal/clientip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Проверка сохраняемых форм адреса.
+func TestPrivacy_Apply(t *testing.T) {
+	off := clientip.Privacy{}
+	assert.Equal(t, "203.0.113.7", off.Apply("203.0.113.7"))
+
+	truncate := clientip.Privacy{Mode: clientip.PrivacyTruncate, Truncate: clientip.Granularity{IPv4: 24, IPv6: 48}}
+	assert.Equal(t, "203.0.113.0", truncate.Apply("203.0.113.7"))
+	assert.Equal(t, "203.0.113.0", truncate.Apply("::ffff:203.0.113.99"))
+	assert.Equal(t, "2001:db8:1::", truncate.Apply("2001:db8:1:2::5"))
+	assert.True(t, strings.HasPrefix(truncate.Apply("unknown"), "hmac:"), "unparsable address is not stored as is")
+
+	hash := clientip.Privacy{Mode: clientip.PrivacyHash, Salt: "salt"}
+	hashed := hash.Apply("203.0.113.7")
+	assert.True(t, strings.HasPrefix(hashed, "hmac:"))
+	assert.NotContains(t, hashed, "203.0.113.7")
+	assert.Equal(t, hashed, hash.Apply("[::ffff:203.0.113.7]:443"), "address is normalized before hashing")
+	assert.NotEqual(t, hashed, hash.Apply("203.0.113.8"))
+	assert.NotEqual(t, hashed, clientip.Privacy{Mode: clientip.PrivacyHash, Salt: "other"}.Apply("203.0.113.7"))
+}
+
+// Проверка параметров режимов.
+func TestPrivacy_Validate(t *testing.T) {
+	assert.NoError(t, clientip.Privacy{}.Validate())
+	assert.NoError(t, clientip.Privacy{Mode: clientip.PrivacyOff}.Validate())
+	assert.NoError(t, clientip.Privacy{Mode: clientip.PrivacyHash, Salt: "salt"}.Validate())
+	assert.Error(t, clientip.Privacy{Mode: clientip.PrivacyHash}.Validate())
+	assert.Error(t, clientip.Privacy{Mode: clientip.PrivacyTruncate}.Validate())
+	assert.Error(t, clientip.Privacy{Mode: clientip.PrivacyTruncate, Truncate: clientip.Granularity{IPv4: 40, IPv6: 48}}.Validate())
+	assert.Error(t, clientip.Privacy{Mode: "mask"}.Validate())
+}
@@ -6,7 +6,11 @@ import (
 	"log/slog"
 
 	"auth_service/internal/config"
+	"auth_service/internal/storage/postgres"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgconn/stmtcache"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -26,6 +30,13 @@ func InitDB(cfg *config.Config, log *slog.Logger) (*pgxpool.Pool, error) {
 		return nil, fmt.Errorf("unable to parse database config: %w", err)
 	}
 
+	if err := configureStatementCache(poolConfig, cfg.Database); err != nil {
+		return nil, err
+	}
+	// Длительность запросов учитывается всегда, медленные запросы записываются в лог.
+	poolConfig.ConnConfig.Logger = postgres.NewQueryLogger(log, cfg.Database.SlowQueryThreshold)
+	poolConfig.ConnConfig.LogLevel = pgx.LogLevelInfo
+
 	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
 	if err != nil {
 		log.Error("Unable to connect to database", slog.String("error", err.Error()))
@@ -35,3 +46,46 @@ func InitDB(cfg *config.Config, log *slog.Logger) (*pgxpool.Pool, error) {
 	log.Info("Successfully connected to database", slog.String("database", cfg.Database.DBName))
 	return pool, nil
 }
+
+// Настраивает кеш подготовленных выражений и протокол обмена с PostgreSQL.
+//
+// В режиме simple protocol кеш отключается, а запросы не подготавливаются:
+// PgBouncer в режиме transaction pooling не поддерживает подготовленные выражения.
+// В остальных случаях запросы горячего пути подготавливаются на каждом новом соединении.
+//
+// Принимает:
+// - poolConfig: конфигурация пула соединений.
+// - dbCfg: параметры базы данных из конфигурации приложения.
+//
+// Возвращает:
+// - ошибку, если указан неизвестный режим кеша.
+func configureStatementCache(poolConfig *pgxpool.Config, dbCfg config.Database) error {
+	if dbCfg.PreferSimpleProtocol {
+		poolConfig.ConnConfig.PreferSimpleProtocol = true
+		poolConfig.ConnConfig.BuildStatementCache = nil
+		return nil
+	}
+
+	var mode int
+	switch dbCfg.StatementCacheMode {
+	case "", "prepare":
+		mode = stmtcache.ModePrepare
+	case "describe":
+		mode = stmtcache.ModeDescribe
+	default:
+		return fmt.Errorf("unknown statement cache mode: %s", dbCfg.StatementCacheMode)
+	}
+
+	capacity := dbCfg.StatementCacheCapacity
+	if capacity <= 0 {
+		capacity = 512
+	}
+
+	poolConfig.ConnConfig.BuildStatementCache = func(conn *pgconn.PgConn) stmtcache.Cache {
+		return stmtcache.New(conn, mode, capacity)
+	}
+	poolConfig.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		return postgres.PrepareStatements(ctx, conn)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"auth_service/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Инициализирует подключение к Redis и проверяет его доступность
+func InitRedis(cfg *config.Config, log *slog.Logger) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Storage.Redis.Address,
+		Password: cfg.Storage.Redis.Password,
+		DB:       cfg.Storage.Redis.DB,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		_ = client.Close()
+		log.Error("Unable to connect to redis", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	log.Info("Successfully connected to redis", slog.String("address", cfg.Storage.Redis.Address))
+	return client, nil
+}
@@ -0,0 +1,247 @@
+// Пакет geo определяет страну клиента по IP-адресу и проверяет правила
+// ограничения доступа по странам.
+package geo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Диапазон адресов одной страны.
+type ipRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+// База соответствия IP-адресов странам.
+type Database struct {
+	ranges []ipRange
+}
+
+// Используемая сервисом база; nil — страна клиента неизвестна.
+var database *Database
+
+// Загружает базу из CSV-файла.
+//
+// Поддерживаются строки вида "начало,конец,страна" (формат бесплатных баз
+// DB-IP и IP2Location LITE) и "подсеть,страна" (CIDR). Страна задаётся кодом
+// ISO 3166-1 alpha-2; строки, начинающиеся с #, пропускаются.
+//
+// Принимает:
+// - path: путь к файлу базы.
+//
+// Возвращает:
+// - указатель на Database.
+// - ошибку, если файл не удалось прочитать или разобрать.
+func Open(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+	defer f.Close()
+
+	db, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse geoip database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Разбирает базу в формате, описанном у Open.
+//
+// Принимает:
+// - r: источник данных в формате CSV.
+//
+// Возвращает:
+// - указатель на Database.
+// - ошибку разбора с номером строки.
+func Parse(r io.Reader) (*Database, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	db := &Database{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		entry, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		db.ranges = append(db.ranges, entry)
+	}
+
+	slices.SortFunc(db.ranges, func(a, b ipRange) int { return a.start.Compare(b.start) })
+	return db, nil
+}
+
+// Разбирает строку базы.
+func parseRecord(record []string) (ipRange, error) {
+	switch len(record) {
+	case 2:
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			return ipRange{}, err
+		}
+		prefix = prefix.Masked()
+		return newRange(prefix.Addr(), lastAddr(prefix), record[1])
+	case 3:
+		start, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+		if err != nil {
+			return ipRange{}, err
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err != nil {
+			return ipRange{}, err
+		}
+		return newRange(start, end, record[2])
+	default:
+		return ipRange{}, fmt.Errorf("expected 2 or 3 fields, got %d", len(record))
+	}
+}
+
+// Создаёт диапазон, проверяя границы и код страны.
+func newRange(start, end netip.Addr, country string) (ipRange, error) {
+	start, end = start.Unmap(), end.Unmap()
+	if start.Is4() != end.Is4() || end.Less(start) {
+		return ipRange{}, fmt.Errorf("invalid range %s-%s", start, end)
+	}
+	code, err := NormalizeCountry(country)
+	if err != nil {
+		return ipRange{}, err
+	}
+	return ipRange{start: start, end: end, country: code}, nil
+}
+
+// Возвращает последний адрес подсети.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(addr)*8; bit++ {
+		addr[bit/8] |= 0x80 >> (bit % 8)
+	}
+	last, _ := netip.AddrFromSlice(addr)
+	return last
+}
+
+// Возвращает код страны, которой принадлежит адрес.
+//
+// Принимает:
+// - ip: IP-адрес клиента.
+//
+// Возвращает:
+// - код страны ISO 3166-1 alpha-2 или пустую строку, если адрес не найден.
+func (d *Database) Country(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap().WithZone("")
+
+	// Последний диапазон, начинающийся не позже адреса.
+	i, found := slices.BinarySearchFunc(d.ranges, addr, func(r ipRange, a netip.Addr) int { return r.start.Compare(a) })
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return ""
+	}
+	if r := d.ranges[i]; r.start.Is4() == addr.Is4() && !r.end.Less(addr) {
+		return r.country
+	}
+	return ""
+}
+
+// Устанавливает базу, по которой определяется страна клиента. Вызывается при
+// запуске до обработки первых запросов.
+//
+// Принимает:
+// - db: база; nil отключает определение страны.
+func SetDatabase(db *Database) {
+	database = db
+}
+
+// Возвращает код страны клиента по базе, установленной SetDatabase.
+//
+// Принимает:
+// - ip: IP-адрес клиента.
+//
+// Возвращает:
+// - код страны или пустую строку, если база не задана или адрес не найден.
+func Country(ip string) string {
+	if database == nil {
+		return ""
+	}
+	return database.Country(ip)
+}
+
+// Приводит код страны к верхнему регистру и проверяет его формат.
+//
+// Принимает:
+// - code: код страны ISO 3166-1 alpha-2.
+//
+// Возвращает:
+// - код в верхнем регистре.
+// - ошибку, если код не состоит из двух латинских букв.
+func NormalizeCountry(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return "", fmt.Errorf("invalid country code %q", code)
+	}
+	return code, nil
+}
+
+// Правила доступа по странам.
+//
+// Если задан список Allow, доступ разрешён только из перечисленных стран, а
+// клиентам, страну которых определить не удалось, запрещён. Страны из списка
+// Deny запрещены всегда. Пустые правила ничего не ограничивают.
+type Rules struct {
+	Allow []string
+	Deny  []string
+}
+
+// Сообщает, заданы ли ограничения.
+func (r Rules) Enabled() bool {
+	return len(r.Allow) > 0 || len(r.Deny) > 0
+}
+
+// Проверяет коды стран в правилах.
+func (r Rules) Validate() error {
+	for _, code := range slices.Concat(r.Allow, r.Deny) {
+		if _, err := NormalizeCountry(code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Сообщает, разрешён ли доступ из страны.
+//
+// Принимает:
+// - country: код страны; пустая строка — страна неизвестна.
+//
+// Возвращает:
+// - true, если доступ разрешён.
+func (r Rules) Allowed(country string) bool {
+	if country != "" && slices.ContainsFunc(r.Deny, func(code string) bool { return strings.EqualFold(code, country) }) {
+		return false
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	return country != "" && slices.ContainsFunc(r.Allow, func(code string) bool { return strings.EqualFold(code, country) })
+}
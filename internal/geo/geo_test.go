@@ -0,0 +1,71 @@
+package geo_test
+
+import (
+	"auth_service/internal/geo"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDatabase = `# start,end,country
+203.0.113.0,203.0.113.255,ru
+198.51.100.0/24,KP
+2001:db8::/32,DE
+192.0.2.0,192.0.2.127,US
+`
+
+// Проверка определения страны по диапазонам и подсетям.
+func TestDatabase_Country(t *testing.T) {
+	db, err := geo.Parse(strings.NewReader(testDatabase))
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"203.0.113.7":        "RU",
+		"::ffff:203.0.113.7": "RU",
+		"198.51.100.255":     "KP",
+		"2001:db8:1::1":      "DE",
+		"192.0.2.127":        "US",
+		"192.0.2.128":        "",
+		"10.0.0.1":           "",
+		"2001:db9::1":        "",
+		"not-an-ip":          "",
+	}
+	for ip, want := range tests {
+		assert.Equal(t, want, db.Country(ip), ip)
+	}
+}
+
+// Проверка ошибок разбора базы.
+func TestParse_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"203.0.113.0,RU,extra,field",
+		"203.0.113.255,203.0.113.0,RU",
+		"203.0.113.0/24,RUS",
+		"203.0.113.0,2001:db8::1,RU",
+	} {
+		_, err := geo.Parse(strings.NewReader(data))
+		assert.Error(t, err, data)
+	}
+}
+
+// Проверка правил доступа.
+func TestRules_Allowed(t *testing.T) {
+	assert.False(t, geo.Rules{}.Enabled())
+	assert.True(t, geo.Rules{}.Allowed(""))
+
+	deny := geo.Rules{Deny: []string{"kp"}}
+	assert.False(t, deny.Allowed("KP"))
+	assert.True(t, deny.Allowed("RU"))
+	assert.True(t, deny.Allowed(""), "unknown country is allowed without allow list")
+
+	allow := geo.Rules{Allow: []string{"RU", "KZ"}, Deny: []string{"KZ"}}
+	assert.True(t, allow.Allowed("RU"))
+	assert.False(t, allow.Allowed("KZ"), "deny wins over allow")
+	assert.False(t, allow.Allowed("DE"))
+	assert.False(t, allow.Allowed(""), "unknown country is denied with allow list")
+
+	assert.NoError(t, allow.Validate())
+	assert.Error(t, geo.Rules{Deny: []string{"Russia"}}.Validate())
+}
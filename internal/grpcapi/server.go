@@ -0,0 +1,153 @@
+package grpcapi
+
+import (
+	"auth_service/internal/accounts"
+	"auth_service/internal/clientip"
+	"auth_service/internal/config"
+	"auth_service/internal/maintenance"
+	"auth_service/internal/mtls"
+	"auth_service/internal/passwordexpiry"
+	"auth_service/internal/quota"
+	"auth_service/internal/refreshlimit"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/storage"
+	"auth_service/internal/tracing"
+	"auth_service/internal/usage"
+	"auth_service/pkg/authpb"
+	"context"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Scope клиентского сертификата, требуемые для методов AuthService при
+// включённом mTLS (см. пакет mtls).
+var MethodScopes = map[string]string{
+	authpb.AuthService_IssueTokens_FullMethodName:   mtls.ScopeTokensIssue,
+	authpb.AuthService_RefreshTokens_FullMethodName: mtls.ScopeTokensRefresh,
+	authpb.AuthService_ValidateToken_FullMethodName: mtls.ScopeTokensValidate,
+	authpb.AuthService_RevokeSession_FullMethodName: mtls.ScopeSessionsRevoke,
+}
+
+// Реализация authpb.AuthServiceServer поверх сервиса auth.
+type authServer struct {
+	authpb.UnimplementedAuthServiceServer
+	log *slog.Logger
+	svc *auth.Service
+}
+
+// Создаёт gRPC-сервер с зарегистрированным AuthService.
+//
+// Также регистрирует сервис проверки состояния grpc.health.v1 (для gRPC-проб
+// Kubernetes) и, если это разрешено конфигурацией, server reflection. Вызовы
+// AuthService учитываются в статистике использования (см. пакет usage),
+// отклоняются в режиме обслуживания (см. пакет maintenance) и ограничиваются
+// квотой запросов (см. пакет quota).
+//
+// Принимает:
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис операций с токенами.
+// - opts: дополнительные параметры grpc.Server.
+//
+// Возвращает:
+// - указатель на grpc.Server.
+func New(log *slog.Logger, cfg *config.Config, svc *auth.Service, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor(), usage.UnaryServerInterceptor(), maintenance.UnaryServerInterceptor(), quota.UnaryServerInterceptor()))
+	server := grpc.NewServer(opts...)
+	authpb.RegisterAuthServiceServer(server, &authServer{log: log, svc: svc})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(authpb.AuthService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	if cfg.GRPCServer.Reflection {
+		reflection.Register(server)
+	}
+	return server
+}
+
+func (s *authServer) IssueTokens(ctx context.Context, req *authpb.IssueTokensRequest) (*authpb.TokenPair, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	pair, err := s.svc.IssueTokens(ctx, req.GetUserId(), clientIP(ctx))
+	if err != nil {
+		return nil, s.toStatus("IssueTokens", err)
+	}
+	return &authpb.TokenPair{AccessToken: pair.AccessToken, RefreshToken: pair.RefreshToken}, nil
+}
+
+func (s *authServer) RefreshTokens(ctx context.Context, req *authpb.RefreshTokensRequest) (*authpb.TokenPair, error) {
+	pair, err := s.svc.RefreshTokens(ctx, req.GetAccessToken(), req.GetRefreshToken(), clientIP(ctx))
+	if err != nil {
+		return nil, s.toStatus("RefreshTokens", err)
+	}
+	return &authpb.TokenPair{AccessToken: pair.AccessToken, RefreshToken: pair.RefreshToken}, nil
+}
+
+func (s *authServer) ValidateToken(ctx context.Context, req *authpb.ValidateTokenRequest) (*authpb.ValidateTokenResponse, error) {
+	claims, err := s.svc.ValidateToken(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, s.toStatus("ValidateToken", err)
+	}
+	return &authpb.ValidateTokenResponse{UserId: claims.UserID, ClientIp: claims.ClientIP, SessionId: claims.SessionID}, nil
+}
+
+func (s *authServer) RevokeSession(ctx context.Context, req *authpb.RevokeSessionRequest) (*authpb.RevokeSessionResponse, error) {
+	if err := s.svc.RevokeSession(ctx, req.GetUserId()); err != nil {
+		return nil, s.toStatus("RevokeSession", err)
+	}
+	return &authpb.RevokeSessionResponse{}, nil
+}
+
+// Преобразует ошибку сервиса в gRPC-статус.
+func (s *authServer) toStatus(method string, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidUserID):
+		return status.Error(codes.InvalidArgument, "invalid user_id")
+	case errors.Is(err, auth.ErrInvalidAccessToken):
+		return status.Error(codes.Unauthenticated, "invalid access token")
+	case errors.Is(err, auth.ErrInvalidRefreshToken):
+		return status.Error(codes.Unauthenticated, "invalid refresh token")
+	case errors.Is(err, auth.ErrRefreshTokenExpired):
+		return status.Error(codes.Unauthenticated, "refresh token expired")
+	case errors.Is(err, auth.ErrGeoBlocked):
+		return status.Error(codes.PermissionDenied, "access from client country is not allowed")
+	case errors.Is(err, accounts.ErrDisabled):
+		return status.Error(codes.PermissionDenied, "account is disabled")
+	case errors.Is(err, passwordexpiry.ErrExpired):
+		return status.Error(codes.PermissionDenied, "password has expired")
+	case errors.Is(err, quota.ErrExceeded):
+		return status.Error(codes.ResourceExhausted, "quota exceeded")
+	case errors.Is(err, refreshlimit.ErrThrottled):
+		return status.Error(codes.ResourceExhausted, "too many failed refresh attempts")
+	case errors.Is(err, auth.ErrSessionNotFound):
+		if method == "RevokeSession" {
+			return status.Error(codes.NotFound, "session not found")
+		}
+		return status.Error(codes.Unauthenticated, "refresh token not found")
+	}
+
+	s.log.Error("gRPC request failed", slog.String("method", method), slog.String("error", err.Error()))
+	if errors.Is(err, storage.ErrUnavailable) {
+		return status.Error(codes.Unavailable, "service temporarily unavailable")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+// Возвращает IP-адрес клиента (без порта) из контекста вызова.
+func clientIP(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return clientip.Normalize(p.Addr.String())
+	}
+	return ""
+}
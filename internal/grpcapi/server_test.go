@@ -0,0 +1,104 @@
+package grpcapi_test
+
+import (
+	"auth_service/internal/config"
+	"auth_service/internal/grpcapi"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/storage/memory"
+	"auth_service/pkg/authpb"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const userID = "123e4567-e89b-12d3-a456-426614174000"
+
+func newConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	lis := bufconn.Listen(1 << 20)
+	cfg := &config.Config{GRPCServer: config.GRPCServer{Reflection: true}}
+	server := grpcapi.New(log, cfg, auth.New(log, db, "secret"))
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+// Проверка полного цикла операций через gRPC.
+func TestAuthService_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	client := authpb.NewAuthServiceClient(newConn(t))
+
+	issued, err := client.IssueTokens(ctx, &authpb.IssueTokensRequest{UserId: userID})
+	require.NoError(t, err)
+
+	validated, err := client.ValidateToken(ctx, &authpb.ValidateTokenRequest{AccessToken: issued.GetAccessToken()})
+	require.NoError(t, err)
+	assert.Equal(t, userID, validated.GetUserId())
+	assert.NotEmpty(t, validated.GetSessionId())
+
+	refreshed, err := client.RefreshTokens(ctx, &authpb.RefreshTokensRequest{
+		AccessToken:  issued.GetAccessToken(),
+		RefreshToken: issued.GetRefreshToken(),
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, issued.GetRefreshToken(), refreshed.GetRefreshToken())
+
+	_, err = client.RevokeSession(ctx, &authpb.RevokeSessionRequest{UserId: userID})
+	require.NoError(t, err)
+
+	_, err = client.RevokeSession(ctx, &authpb.RevokeSessionRequest{UserId: userID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// Проверка преобразования ошибок в gRPC-статусы.
+func TestAuthService_Errors(t *testing.T) {
+	ctx := context.Background()
+	client := authpb.NewAuthServiceClient(newConn(t))
+
+	_, err := client.IssueTokens(ctx, &authpb.IssueTokensRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.IssueTokens(ctx, &authpb.IssueTokensRequest{UserId: "not-a-uuid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ValidateToken(ctx, &authpb.ValidateTokenRequest{AccessToken: "invalid_token"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.RefreshTokens(ctx, &authpb.RefreshTokensRequest{AccessToken: "invalid_token"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// Проверка сервиса grpc.health.v1.
+func TestHealth(t *testing.T) {
+	client := healthpb.NewHealthClient(newConn(t))
+
+	for _, service := range []string{"", "auth.v1.AuthService"} {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	}
+}
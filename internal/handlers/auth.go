@@ -1,11 +1,34 @@
 package handlers
 
 import (
+	"auth_service/internal/accounts"
+	"auth_service/internal/auditlog"
+	"auth_service/internal/captcha"
+	"auth_service/internal/clientip"
 	"auth_service/internal/config"
-	"auth_service/internal/services/tokens"
+	"auth_service/internal/geo"
+	"auth_service/internal/i18n"
+	"auth_service/internal/lockout"
+	"auth_service/internal/mtls"
+	"auth_service/internal/passwordexpiry"
+	"auth_service/internal/quota"
+	"auth_service/internal/refreshlimit"
+	"auth_service/internal/security"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/breaker"
+	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -13,17 +36,89 @@ import (
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	// Пароль истёк и его нужно сменить; передаётся только со значением true.
+	PasswordExpired bool `json:"password_expired,omitempty"`
 }
 
-// Интерфейс для работы с хранилищем токенов и IP-адресов.
-type Storage interface {
-	SaveRefreshToken(userID, hashedToken, clientIP string) error
-	GetRefreshToken(userID string) (string, error)
-	UpdateRefreshToken(userID, hashedToken, clientIP string) error
-	GetLastIP(userID string) (string, error)
-	GetUserEmail(userID string) (string, error)
+// Тело запроса обновления токенов. Access-токен необязателен: сессия
+// находится по refresh-токену.
+type RefreshRequest struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Тело запроса входа по паролю.
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Ответ CAPTCHA; можно передать и заголовком X-Captcha-Token.
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+// Ответ на выход со всех устройств.
+type LogoutAllResponse struct {
+	// Количество отозванных сессий.
+	RevokedSessions int `json:"revoked_sessions"`
+}
+
+// Список сессий пользователя.
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// Сессия пользователя.
+type SessionResponse struct {
+	ID     string         `json:"id"`
+	Device DeviceResponse `json:"device"`
+	// IP-адрес последней выдачи или обновления токенов.
+	ClientIP   string    `json:"client_ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Сессия, в которой выдан access-токен запроса.
+	Current bool `json:"current"`
+}
+
+// Устройство сессии; пустые поля клиент не сообщил.
+type DeviceResponse struct {
+	UserAgent string `json:"user_agent"`
+	Name      string `json:"name"`
+	Platform  string `json:"platform"`
+}
+
+// Типы записей истории входов.
+const (
+	historyLogin   = "login"
+	historyRefresh = "refresh"
+)
+
+// История входов пользователя.
+type LoginHistoryResponse struct {
+	Entries []LoginHistoryEntry `json:"entries"`
+	// Значение параметра before для следующей страницы; null, если записей больше нет.
+	NextBefore *int64 `json:"next_before"`
+}
+
+// Вход или обновление токенов в истории входов.
+type LoginHistoryEntry struct {
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	// login — выдача токенов новой сессии, refresh — их обновление.
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	// IP-адрес клиента в сохраняемой форме (с учётом режима приватности).
+	ClientIP string `json:"client_ip"`
+	// Код страны ISO 3166-1 alpha-2; пусто, если её не удалось определить.
+	Country string `json:"country"`
+	// User-Agent запроса; название и платформа — из сессии, если она ещё действует.
+	Device DeviceResponse `json:"device"`
+	// Запись сессии, в которой выдан access-токен запроса.
+	Current bool `json:"current"`
 }
 
+// Интерфейс для работы с хранилищем токенов и IP-адресов.
+type Storage = storage.Storage
+
 // Обрабатывает запросы на генерацию новых токенов.
 //
 // Принимает:
@@ -31,64 +126,189 @@ type Storage interface {
 // - r: *http.Request с данными запроса.
 // - log: указатель на logger для логирования событий.
 // - cfg: ссылка на конфигурацию приложения.
-// - db: интерфейс для взаимодействия с хранилищем токенов.
+// - svc: сервис токенов.
 //
 // Возвращает:
 // - HTTP 200 OK с access и refresh токенами в теле ответа при успешной обработке.
 // - HTTP 400 Bad Request, если отсутствует или некорректен параметр user_id.
+// - HTTP 403 Forbidden, если доступ из страны клиента запрещён или учётная запись отключена.
+// - HTTP 429 Too Many Requests, если исчерпана квота запросов или сессий.
 // - HTTP 500 Internal Server Error, если возникает ошибка при генерации токенов или сохранении в хранилище.
-func GenerateTokensHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, db Storage) {
+func GenerateTokensHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
 	log.Info("Handling GenerateTokens request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
 
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
 		log.Warn("Missing user_id in request")
-		http.Error(w, "user_id is required", http.StatusBadRequest)
+		i18n.Error(w, r, "user_id_required", http.StatusBadRequest)
 		return
 	}
 
 	if _, err := uuid.Parse(userID); err != nil {
 		log.Warn("Invalid user_id provided", slog.String("user_id", userID))
-		http.Error(w, "invalid user_id", http.StatusBadRequest)
+		i18n.Error(w, r, "invalid_user_id", http.StatusBadRequest)
 		return
 	}
 
-	clientIP := r.RemoteAddr
-	log.Info("Client IP address obtained", slog.String("clientIP", clientIP))
+	clientIP := clientip.FromRequest(r)
+	log.Info("Client IP address obtained", slog.String("clientIP", IPPrivacy(cfg).Apply(clientIP)))
 
-	// Генерация Refresh токена и его хеша
-	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash()
-	if err != nil {
-		log.Error("Failed to generate refresh token", slog.String("error", err.Error()))
-		http.Error(w, "failed to generate refresh token", http.StatusInternalServerError)
+	pair, err := svc.WithLogger(log).IssueTokens(withDevice(r), userID, clientIP)
+	writeIssuedTokens(w, r, log, userID, pair, err)
+}
+
+// Обрабатывает запросы на вход по email и паролю.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: *http.Request с телом LoginRequest.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис токенов.
+//
+// Возвращает:
+// - HTTP 200 OK с access и refresh токенами в теле ответа при успешной обработке
+// (с password_expired: true, если пароль истёк).
+// - HTTP 400 Bad Request, если тело запроса некорректно или не содержит email и пароль
+// либо требуемый ответ CAPTCHA не передан или отклонён.
+// - HTTP 401 Unauthorized, если email или пароль не подходят.
+// - HTTP 403 Forbidden, если доступ из страны клиента запрещён или учётная запись отключена.
+// - HTTP 405 Method Not Allowed для методов, отличных от POST.
+// - HTTP 429 Too Many Requests, если исчерпана квота запросов или сессий либо вход
+// заблокирован после неудачных попыток.
+// - HTTP 500 Internal Server Error, если возникает ошибка при генерации токенов или сохранении в хранилище.
+// - HTTP 503 Service Unavailable, если поставщик CAPTCHA недоступен.
+func LoginHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
+	log.Info("Handling Login request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Сохранение Refresh токена
-	err = db.SaveRefreshToken(userID, hashedToken, clientIP)
-	if err != nil {
-		log.Error("Failed to save refresh token to database", slog.String("error", err.Error()))
-		http.Error(w, "failed to save refresh token", http.StatusInternalServerError)
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("Invalid request body", slog.String("error", err.Error()))
+		i18n.Error(w, r, "invalid_request_body", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" || req.Password == "" {
+		log.Warn("Missing email or password in request")
+		i18n.Error(w, r, "credentials_required", http.StatusBadRequest)
 		return
 	}
 
-	accessToken, err := tokens.GenerateAccessToken(userID, clientIP, cfg.JWTSecret, hashedToken)
+	clientIP := clientip.FromRequest(r)
+	if !checkCaptcha(w, r, log, cfg, req, clientIP) {
+		return
+	}
+	pair, err := svc.WithLogger(log).Login(withDevice(r), req.Email, req.Password, clientIP)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		log.Warn("Invalid credentials provided", slog.String("clientIP", IPPrivacy(cfg).Apply(clientIP)))
+		i18n.Error(w, r, "invalid_credentials", http.StatusUnauthorized)
+		return
+	}
+	var lockedErr *lockout.LockedError
+	if errors.As(err, &lockedErr) {
+		log.Warn("Login locked after failed attempts", slog.String("scope", lockedErr.Scope), slog.String("clientIP", IPPrivacy(cfg).Apply(clientIP)))
+		setRetryAfter(w, lockedErr.RetryAfter)
+		i18n.Error(w, r, "login_locked", http.StatusTooManyRequests)
+		return
+	}
+	writeIssuedTokens(w, r, log, "", pair, err)
+}
+
+// Проверяет ответ CAPTCHA запроса входа, если правило входа его требует.
+// Поставщику передаётся адрес клиента, только если адреса хранятся как есть.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ошибки клиенту.
+// - r: *http.Request с данными запроса.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - req: тело запроса входа.
+// - clientIP: адрес клиента.
+//
+// Возвращает:
+// - true, если вход можно продолжить; иначе ошибка уже отправлена клиенту.
+func checkCaptcha(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, req LoginRequest, clientIP string) bool {
+	privacy := IPPrivacy(cfg)
+	storedIP := privacy.Apply(clientIP)
+	token := req.CaptchaToken
+	if token == "" {
+		token = r.Header.Get("X-Captcha-Token")
+	}
+	remoteIP := ""
+	if privacy.Mode == "" || privacy.Mode == clientip.PrivacyOff {
+		remoteIP = clientIP
+	}
+
+	err := captcha.Check(r.Context(), captcha.EndpointLogin, token, remoteIP, func() (int, error) {
+		return lockout.Failures(req.Email, storedIP)
+	})
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, captcha.ErrRequired):
+		log.Warn("Captcha required for login", slog.String("clientIP", storedIP))
+		i18n.Error(w, r, "captcha_required", http.StatusBadRequest)
+	case errors.Is(err, captcha.ErrInvalid):
+		log.Warn("Captcha rejected", slog.String("clientIP", storedIP), slog.String("error", err.Error()))
+		i18n.Error(w, r, "captcha_invalid", http.StatusBadRequest)
+	default:
+		log.Error("Failed to verify captcha", slog.String("error", err.Error()))
+		if writeUnavailable(w, r, err) {
+			return false
+		}
+		i18n.Error(w, r, "captcha_unavailable", http.StatusServiceUnavailable)
+	}
+	return false
+}
+
+// Отправляет клиенту выданную пару токенов или ошибку выдачи.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: *http.Request с данными запроса.
+// - log: указатель на logger для логирования событий.
+// - userID: идентификатор пользователя для журнала (пустой, если неизвестен).
+// - pair: выданная пара токенов.
+// - err: ошибка выдачи токенов.
+func writeIssuedTokens(w http.ResponseWriter, r *http.Request, log *slog.Logger, userID string, pair auth.TokenPair, err error) {
+	if errors.Is(err, auth.ErrGeoBlocked) {
+		i18n.Error(w, r, "geo_blocked", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, accounts.ErrDisabled) {
+		log.Warn("Account is disabled", slog.String("user_id", userID))
+		i18n.Error(w, r, "account_disabled", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		log.Warn("Session quota exceeded", slog.String("user_id", userID))
+		i18n.Error(w, r, "quota_exceeded", http.StatusTooManyRequests)
+		return
+	}
 	if err != nil {
-		log.Error("Failed to generate access token", slog.String("error", err.Error()))
-		http.Error(w, "failed to generate access token", http.StatusInternalServerError)
+		log.Error("Failed to issue tokens", slog.String("error", err.Error()))
+		if writeUnavailable(w, r, err) {
+			return
+		}
+		i18n.Error(w, r, "token_generation_failed", http.StatusInternalServerError)
 		return
 	}
 
 	log.Info("Tokens generated and saved successfully", slog.String("user_id", userID), slog.Int("status", http.StatusOK))
 
 	response := TokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:     pair.AccessToken,
+		RefreshToken:    pair.RefreshToken,
+		PasswordExpired: pair.PasswordExpired,
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := writeJSON(w, response); err != nil {
 		log.Error("Failed to encode response", slog.String("error", err.Error()))
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		i18n.Error(w, r, "response_encoding_failed", http.StatusInternalServerError)
 	}
 }
 
@@ -99,95 +319,640 @@ func GenerateTokensHandler(w http.ResponseWriter, r *http.Request, log *slog.Log
 // - r: *http.Request с данными запроса.
 // - log: указатель на logger для логирования событий.
 // - cfg: ссылка на конфигурацию приложения.
-// - db: интерфейс для взаимодействия с хранилищем токенов.
+// - svc: сервис токенов.
 //
 // Возвращает:
 // - HTTP 200 OK с новыми токенами в теле ответа при успешной обработке.
 // - HTTP 400 Bad Request, если тело запроса некорректное.
-// - HTTP 401 Unauthorized, если предоставленные токены недействительны.
+// - HTTP 401 Unauthorized, если предоставленные токены недействительны или срок refresh-токена истёк.
+// - HTTP 403 Forbidden, если доступ из страны клиента запрещён, учётная запись
+// отключена или пароль пользователя истёк.
+// - HTTP 429 Too Many Requests, если исчерпана квота запросов или обновление токенов
+// пользователя временно запрещено после неудачных попыток.
 // - HTTP 500 Internal Server Error, если возникает ошибка при обновлении токенов или сохранении в хранилище.
-func RefreshTokensHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, db Storage) {
+func RefreshTokensHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
 	log.Info("Handling RefreshTokens request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
 
-	var req TokenResponse
+	var req RefreshRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Warn("Invalid request body", slog.String("error", err.Error()))
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		i18n.Error(w, r, "invalid_request_body", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		log.Warn("Missing refresh_token in request")
+		i18n.Error(w, r, "refresh_token_required", http.StatusBadRequest)
 		return
 	}
 
-	userID, clientIP, storedHash, err := tokens.ValidateAccessToken(req.AccessToken, cfg.JWTSecret)
+	pair, err := svc.WithLogger(log).RefreshTokens(withDevice(r), req.AccessToken, req.RefreshToken, clientip.FromRequest(r))
 	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidAccessToken):
+			log.Warn("Invalid access token provided", slog.String("error", err.Error()))
+			i18n.Error(w, r, "invalid_access_token", http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrSessionNotFound):
+			log.Warn("Refresh token not found", slog.String("error", err.Error()))
+			i18n.Error(w, r, "refresh_token_not_found", http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrInvalidRefreshToken):
+			log.Warn("Invalid refresh token provided", slog.String("error", err.Error()))
+			i18n.Error(w, r, "invalid_refresh_token", http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrRefreshTokenExpired):
+			log.Warn("Expired refresh token provided", slog.String("error", err.Error()))
+			i18n.Error(w, r, "refresh_token_expired", http.StatusUnauthorized)
+		case errors.Is(err, auth.ErrGeoBlocked):
+			i18n.Error(w, r, "geo_blocked", http.StatusForbidden)
+		case errors.Is(err, accounts.ErrDisabled):
+			log.Warn("Refresh rejected for disabled account")
+			i18n.Error(w, r, "account_disabled", http.StatusForbidden)
+		case errors.Is(err, passwordexpiry.ErrExpired):
+			log.Warn("Refresh rejected for expired password")
+			i18n.Error(w, r, "password_expired", http.StatusForbidden)
+		case errors.Is(err, refreshlimit.ErrThrottled):
+			log.Warn("Refresh throttled after failed attempts", slog.String("error", err.Error()))
+			var throttledErr *refreshlimit.ThrottledError
+			if errors.As(err, &throttledErr) {
+				setRetryAfter(w, throttledErr.RetryAfter)
+			}
+			i18n.Error(w, r, "refresh_throttled", http.StatusTooManyRequests)
+		default:
+			log.Error("Failed to refresh tokens", slog.String("error", err.Error()))
+			if writeUnavailable(w, r, err) {
+				return
+			}
+			i18n.Error(w, r, "token_refresh_failed", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := TokenResponse{
+		AccessToken:     pair.AccessToken,
+		RefreshToken:    pair.RefreshToken,
+		PasswordExpired: pair.PasswordExpired,
+	}
+	if err := writeJSON(w, response); err != nil {
+		log.Error("Failed to encode response", slog.String("error", err.Error()))
+		i18n.Error(w, r, "response_encoding_failed", http.StatusInternalServerError)
+	}
+}
+
+// Обрабатывает запросы на выход из сессии.
+//
+// Завершается сессия, в которой выдан access-токен из заголовка
+// Authorization: Bearer <token>: её refresh-токен удаляется, а access-токены
+// сессии заносятся в список отзыва. Другие сессии пользователя сохраняются.
+// Повторный выход из уже завершённой сессии не считается ошибкой.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: *http.Request с заголовком Authorization.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис токенов.
+//
+// Возвращает:
+// - HTTP 204 No Content, если сессия завершена.
+// - HTTP 401 Unauthorized, если access-токен не передан или недействителен.
+// - HTTP 405 Method Not Allowed для методов, отличных от POST.
+// - HTTP 500 Internal Server Error, если сессию не удалось завершить.
+func LogoutHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
+	log.Info("Handling Logout request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		i18n.Error(w, r, "access_token_required", http.StatusUnauthorized)
+		return
+	}
+
+	err := svc.WithLogger(log).Logout(r.Context(), accessToken)
+	switch {
+	case err == nil, errors.Is(err, auth.ErrSessionNotFound):
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, auth.ErrInvalidAccessToken):
 		log.Warn("Invalid access token provided", slog.String("error", err.Error()))
-		http.Error(w, "invalid access token", http.StatusUnauthorized)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		i18n.Error(w, r, "invalid_access_token", http.StatusUnauthorized)
+	default:
+		log.Error("Failed to log out", slog.String("error", err.Error()))
+		if writeUnavailable(w, r, err) {
+			return
+		}
+		i18n.Error(w, r, "logout_failed", http.StatusInternalServerError)
+	}
+}
+
+// Обрабатывает запросы на выход со всех устройств.
+//
+// Пользователь определяется по access-токену из заголовка
+// Authorization: Bearer <token>. Все его refresh-токены отзываются, а версия
+// токенов повышается, так что выданные ранее access-токены отклоняются
+// строгой проверкой.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: *http.Request с заголовком Authorization.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис токенов.
+//
+// Возвращает:
+// - HTTP 200 OK с количеством отозванных сессий (LogoutAllResponse).
+// - HTTP 401 Unauthorized, если access-токен не передан или недействителен.
+// - HTTP 405 Method Not Allowed для методов, отличных от POST.
+// - HTTP 500 Internal Server Error, если сессии не удалось отозвать.
+func LogoutAllHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
+	log.Info("Handling LogoutAll request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 		return
 	}
 
-	storedToken, err := db.GetRefreshToken(userID)
-	if err != nil {
-		log.Error("Failed to retrieve refresh token from database", slog.String("error", err.Error()))
-		http.Error(w, "refresh token not found", http.StatusUnauthorized)
+	svc = svc.WithLogger(log)
+	claims, ok := authenticate(w, r, log, svc, "logout_failed")
+	if !ok {
 		return
 	}
 
-	err = tokens.CompareRefreshToken(storedToken, req.RefreshToken)
+	revoked, err := svc.LogoutAll(r.Context(), claims.UserID)
 	if err != nil {
-		log.Warn("Invalid refresh token provided", slog.String("user_id", userID))
-		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		log.Error("Failed to log out from all devices", slog.String("user_id", claims.UserID), slog.String("error", err.Error()))
+		if writeUnavailable(w, r, err) {
+			return
+		}
+		i18n.Error(w, r, "logout_failed", http.StatusInternalServerError)
+		return
+	}
+
+	if err := writeJSON(w, LogoutAllResponse{RevokedSessions: revoked}); err != nil {
+		log.Error("Failed to encode response", slog.String("error", err.Error()))
+		i18n.Error(w, r, "response_encoding_failed", http.StatusInternalServerError)
+	}
+}
+
+// Обрабатывает запросы на получение списка сессий пользователя.
+//
+// Пользователь определяется по access-токену из заголовка
+// Authorization: Bearer <token>.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: *http.Request с заголовком Authorization.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис токенов.
+//
+// Возвращает:
+// - HTTP 200 OK со списком действующих сессий (SessionsResponse).
+// - HTTP 401 Unauthorized, если access-токен не передан или недействителен.
+// - HTTP 405 Method Not Allowed для методов, отличных от GET.
+// - HTTP 500 Internal Server Error, если сессии не удалось получить.
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
+	log.Info("Handling ListSessions request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	svc = svc.WithLogger(log)
+	claims, ok := authenticate(w, r, log, svc, "list_sessions_failed")
+	if !ok {
 		return
 	}
 
-	lastIP, err := db.GetLastIP(userID)
+	sessions, err := svc.ListSessions(r.Context(), claims.UserID)
 	if err != nil {
-		log.Error("Failed to retrieve last IP from database", slog.String("error", err.Error()))
-		http.Error(w, "failed to retrieve last IP", http.StatusInternalServerError)
+		log.Error("Failed to list sessions", slog.String("user_id", claims.UserID), slog.String("error", err.Error()))
+		if writeUnavailable(w, r, err) {
+			return
+		}
+		i18n.Error(w, r, "list_sessions_failed", http.StatusInternalServerError)
+		return
+	}
+
+	response := SessionsResponse{Sessions: make([]SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, SessionResponse{
+			ID: session.ID,
+			Device: DeviceResponse{
+				UserAgent: session.Device.UserAgent,
+				Name:      session.Device.Name,
+				Platform:  session.Device.Platform,
+			},
+			ClientIP:   session.ClientIP,
+			CreatedAt:  session.CreatedAt.UTC(),
+			LastUsedAt: session.LastUsedAt.UTC(),
+			ExpiresAt:  session.ExpiresAt.UTC(),
+			Current:    claims.SessionID != "" && session.ID == claims.SessionID,
+		})
+	}
+	if err := writeJSON(w, response); err != nil {
+		log.Error("Failed to encode response", slog.String("error", err.Error()))
+		i18n.Error(w, r, "response_encoding_failed", http.StatusInternalServerError)
+	}
+}
+
+// Обрабатывает запросы на завершение одной сессии пользователя.
+//
+// Пользователь определяется по access-токену из заголовка
+// Authorization: Bearer <token>, идентификатор сессии — по пути
+// /auth/sessions/{id}. Завершить можно и текущую сессию.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: *http.Request с заголовком Authorization и параметром пути id.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис токенов.
+//
+// Возвращает:
+// - HTTP 204 No Content, если сессия завершена.
+// - HTTP 401 Unauthorized, если access-токен не передан или недействителен.
+// - HTTP 404 Not Found, если у пользователя нет такой сессии.
+// - HTTP 405 Method Not Allowed для методов, отличных от DELETE.
+// - HTTP 500 Internal Server Error, если сессию не удалось завершить.
+func DeleteSessionHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
+	log.Info("Handling DeleteSession request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 		return
 	}
 
-	if clientIP != lastIP {
-		log.Warn("Client IP has changed", slog.String("user_id", userID), slog.String("lastIP", lastIP), slog.String("currentIP", clientIP))
+	svc = svc.WithLogger(log)
+	claims, ok := authenticate(w, r, log, svc, "revoke_session_failed")
+	if !ok {
+		return
+	}
 
-		email, err := db.GetUserEmail(userID)
-		if err != nil {
-			log.Error("Failed to retrieve user email", slog.String("error", err.Error()))
-			http.Error(w, "failed to retrieve user email", http.StatusInternalServerError)
+	sessionID := r.PathValue("id")
+	err := svc.RevokeUserSession(r.Context(), claims.UserID, sessionID)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, auth.ErrSessionNotFound):
+		i18n.Error(w, r, "session_not_found", http.StatusNotFound)
+	default:
+		log.Error("Failed to revoke session",
+			slog.String("user_id", claims.UserID),
+			slog.String("session_id", sessionID),
+			slog.String("error", err.Error()))
+		if writeUnavailable(w, r, err) {
 			return
 		}
+		i18n.Error(w, r, "revoke_session_failed", http.StatusInternalServerError)
+	}
+}
+
+// Обрабатывает запросы на получение истории входов пользователя.
+//
+// Пользователь определяется по access-токену из заголовка
+// Authorization: Bearer <token>. История строится по журналу действий
+// (выдача и обновление токенов), начиная с последних записей; название и
+// платформа устройства берутся из сессии, если она ещё действует. Параметры
+// запроса: limit — размер страницы (по умолчанию 20, не больше 100), before —
+// значение next_before предыдущей страницы.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: *http.Request с заголовком Authorization.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис токенов.
+//
+// Возвращает:
+// - HTTP 200 OK с историей входов (LoginHistoryResponse).
+// - HTTP 400 Bad Request, если limit или before некорректны.
+// - HTTP 401 Unauthorized, если access-токен не передан или недействителен.
+// - HTTP 405 Method Not Allowed для методов, отличных от GET.
+// - HTTP 500 Internal Server Error, если историю не удалось получить.
+// - HTTP 501 Not Implemented, если драйвер хранилища не ведёт журнал действий.
+func LoginHistoryHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
+	log.Info("Handling LoginHistory request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
 
-		log.Warn("Sending warning email", slog.String("email", email), slog.String("user_id", userID))
-		// Здесь можно добавить реальную интеграцию с почтовым сервисом.
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
 	}
 
-	// Генерация новых токенов
-	newAccessToken, err := tokens.GenerateAccessToken(userID, clientIP, cfg.JWTSecret, storedHash)
-	if err != nil {
-		log.Error("Failed to generate access token", slog.String("error", err.Error()))
-		http.Error(w, "failed to generate access token", http.StatusInternalServerError)
+	svc = svc.WithLogger(log)
+	claims, ok := authenticate(w, r, log, svc, "login_history_failed")
+	if !ok {
 		return
 	}
 
-	newRefreshToken, newHashedToken, err := tokens.GenerateRefreshTokenAndHash()
-	if err != nil {
-		log.Error("Failed to generate refresh token", slog.String("error", err.Error()))
-		http.Error(w, "failed to generate refresh token", http.StatusInternalServerError)
+	limit, before, ok := parseHistoryPage(r)
+	if !ok {
+		i18n.Error(w, r, "invalid_history_query", http.StatusBadRequest)
 		return
 	}
 
-	// Обновление токена в базе
-	err = db.UpdateRefreshToken(userID, newHashedToken, clientIP)
+	// Запрашивается на одну запись больше, чтобы узнать, есть ли следующая страница.
+	records, err := auditlog.History(claims.UserID, before, limit+1)
+	if errors.Is(err, auditlog.ErrNotSupported) {
+		i18n.Error(w, r, "login_history_not_supported", http.StatusNotImplemented)
+		return
+	}
+	var sessions []storage.Session
+	if err == nil {
+		sessions, err = svc.ListSessions(r.Context(), claims.UserID)
+	}
 	if err != nil {
-		log.Error("Failed to update refresh token in database", slog.String("error", err.Error()))
-		http.Error(w, "failed to update refresh token", http.StatusInternalServerError)
+		log.Error("Failed to get login history", slog.String("user_id", claims.UserID), slog.String("error", err.Error()))
+		if writeUnavailable(w, r, err) {
+			return
+		}
+		i18n.Error(w, r, "login_history_failed", http.StatusInternalServerError)
 		return
 	}
 
-	response := TokenResponse{
-		AccessToken:  newAccessToken,
-		RefreshToken: newRefreshToken,
+	devices := make(map[string]storage.Device, len(sessions))
+	for _, session := range sessions {
+		devices[session.ID] = session.Device
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	response := LoginHistoryResponse{Entries: make([]LoginHistoryEntry, 0, min(len(records), limit))}
+	if len(records) > limit {
+		records = records[:limit]
+		next := records[limit-1].ID
+		response.NextBefore = &next
+	}
+	for _, record := range records {
+		entryType := historyLogin
+		if record.Action == security.EventTokenRotated {
+			entryType = historyRefresh
+		}
+		device := devices[record.SessionID]
+		response.Entries = append(response.Entries, LoginHistoryEntry{
+			ID:        record.ID,
+			Time:      record.Time.UTC(),
+			Type:      entryType,
+			SessionID: record.SessionID,
+			ClientIP:  record.ClientIP,
+			Country:   cmp.Or(record.Details["country"], geo.Country(record.ClientIP)),
+			Device: DeviceResponse{
+				UserAgent: cmp.Or(record.UserAgent, device.UserAgent),
+				Name:      device.Name,
+				Platform:  device.Platform,
+			},
+			Current: claims.SessionID != "" && record.SessionID == claims.SessionID,
+		})
+	}
+	if err := writeJSON(w, response); err != nil {
 		log.Error("Failed to encode response", slog.String("error", err.Error()))
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		i18n.Error(w, r, "response_encoding_failed", http.StatusInternalServerError)
+	}
+}
+
+// Размер страницы истории входов по умолчанию и наибольший.
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// Разбирает параметры страницы истории входов limit и before.
+//
+// Возвращает:
+// - размер страницы.
+// - номер записи, с которой начинается страница; 0 — с последней.
+// - false, если параметры некорректны.
+func parseHistoryPage(r *http.Request) (int, int64, bool) {
+	values := r.URL.Query()
+	limit := defaultHistoryLimit
+	if value := values.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxHistoryLimit {
+			return 0, 0, false
+		}
+	}
+	var before int64
+	if value := values.Get("before"); value != "" {
+		var err error
+		if before, err = strconv.ParseInt(value, 10, 64); err != nil || before < 1 {
+			return 0, 0, false
+		}
+	}
+	return limit, before, true
+}
+
+// Обрабатывает запросы на отзыв access-токена.
+//
+// Отзывается токен из заголовка Authorization: Bearer <token>, например
+// скомпрометированный: его jti заносится в список отзыва до истечения срока,
+// а сессия и refresh-токен не затрагиваются. Отзыв учитывается проверкой
+// токенов в строгом режиме.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: *http.Request с заголовком Authorization.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис токенов.
+//
+// Возвращает:
+// - HTTP 204 No Content, если токен отозван.
+// - HTTP 401 Unauthorized, если access-токен не передан или недействителен.
+// - HTTP 405 Method Not Allowed для методов, отличных от POST.
+// - HTTP 500 Internal Server Error, если токен не удалось отозвать.
+func RevokeAccessTokenHandler(w http.ResponseWriter, r *http.Request, log *slog.Logger, cfg *config.Config, svc *auth.Service) {
+	log.Info("Handling RevokeAccessToken request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		i18n.Error(w, r, "access_token_required", http.StatusUnauthorized)
+		return
+	}
+
+	svc = svc.WithLogger(log)
+	err := svc.RevokeAccessToken(r.Context(), accessToken)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, auth.ErrInvalidAccessToken):
+		log.Warn("Invalid access token provided", slog.String("error", err.Error()))
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		i18n.Error(w, r, "invalid_access_token", http.StatusUnauthorized)
+	default:
+		log.Error("Failed to revoke access token", slog.String("error", err.Error()))
+		if writeUnavailable(w, r, err) {
+			return
+		}
+		i18n.Error(w, r, "revoke_access_token_failed", http.StatusInternalServerError)
+	}
+}
+
+// Проверяет access-токен из заголовка Authorization: Bearer <token>.
+//
+// Если токен не передан или недействителен, отправляет 401 Unauthorized с
+// заголовком WWW-Authenticate; при ошибке проверки — 503 или 500 с кодом
+// failureKey.
+//
+// Возвращает:
+// - данные токена.
+// - false, если ответ уже отправлен.
+func authenticate(w http.ResponseWriter, r *http.Request, log *slog.Logger, svc *auth.Service, failureKey string) (auth.Claims, bool) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		i18n.Error(w, r, "access_token_required", http.StatusUnauthorized)
+		return auth.Claims{}, false
+	}
+
+	claims, err := svc.ValidateToken(r.Context(), accessToken)
+	if errors.Is(err, auth.ErrInvalidAccessToken) {
+		log.Warn("Invalid access token provided", slog.String("error", err.Error()))
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		i18n.Error(w, r, "invalid_access_token", http.StatusUnauthorized)
+		return auth.Claims{}, false
+	}
+	if err != nil {
+		log.Error("Failed to validate access token", slog.String("error", err.Error()))
+		if !writeUnavailable(w, r, err) {
+			i18n.Error(w, r, failureKey, http.StatusInternalServerError)
+		}
+		return auth.Claims{}, false
+	}
+	return claims, true
+}
+
+// Буферы для кодирования JSON-ответов, переиспользуемые между запросами.
+var jsonBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// Кодирует v в JSON и отправляет его с кодом 200 OK.
+//
+// Ответ кодируется в буфер из пула целиком, поэтому при ошибке кодирования
+// клиенту ещё ничего не отправлено и можно ответить 500.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - v: значение для кодирования.
+//
+// Возвращает:
+// - ошибку кодирования.
+func writeJSON(w http.ResponseWriter, v any) error {
+	buf := jsonBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		jsonBuffers.Put(buf)
+	}()
+
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	_, _ = w.Write(buf.Bytes())
+	return nil
+}
+
+// Отвечает 503 Service Unavailable, если хранилище временно недоступно.
+//
+// Если ошибка получена от разомкнутого автоматического выключателя,
+// устанавливает заголовок Retry-After (в секундах, с округлением вверх).
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: запрос клиента.
+// - err: ошибка, полученная от хранилища.
+//
+// Возвращает:
+// - true, если ответ был отправлен.
+func writeUnavailable(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, storage.ErrUnavailable) {
+		return false
+	}
+
+	var openErr *breaker.OpenError
+	if errors.As(err, &openErr) {
+		seconds := int(math.Ceil(openErr.RetryAfter.Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+	i18n.Error(w, r, "service_unavailable", http.StatusServiceUnavailable)
+	return true
+}
+
+// Устанавливает заголовок Retry-After (в секундах, с округлением вверх, не меньше 1).
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(d.Seconds())))))
+}
+
+// Заголовки, в которых клиент сообщает имя и платформу устройства.
+const (
+	headerDeviceName     = "X-Device-Name"
+	headerDevicePlatform = "X-Device-Platform"
+)
+
+// Возвращает контекст запроса с устройством клиента (см. auth.WithDevice):
+// заголовком User-Agent, именем и платформой устройства из заголовков
+// X-Device-Name и X-Device-Platform.
+func withDevice(r *http.Request) context.Context {
+	return auth.WithDevice(r.Context(), storage.Device{
+		UserAgent: r.UserAgent(),
+		Name:      r.Header.Get(headerDeviceName),
+		Platform:  r.Header.Get(headerDevicePlatform),
+	})
+}
+
+// Возвращает форму хранения IP-адресов из конфигурации.
+func IPPrivacy(cfg *config.Config) clientip.Privacy {
+	return clientip.Privacy{
+		Mode: cfg.IPPrivacy.Mode,
+		Salt: cfg.IPPrivacy.Salt,
+		Truncate: clientip.Granularity{
+			IPv4: cfg.IPPrivacy.IPv4Prefix,
+			IPv6: cfg.IPPrivacy.IPv6Prefix,
+		},
+	}
+}
+
+// Возвращает сопоставление идентичностей клиентских сертификатов со scope из конфигурации.
+func Authorizer(cfg *config.Config) (*mtls.Authorizer, error) {
+	return mtls.NewAuthorizer(cfg.MTLS.TrustDomain, cfg.MTLS.Identities)
+}
+
+// Возвращает ограничения доступа по странам из конфигурации.
+func GeoRules(cfg *config.Config) geo.Rules {
+	return geo.Rules{Allow: cfg.GeoRestrictions.Allow, Deny: cfg.GeoRestrictions.Deny}
+}
+
+// Возвращает точность сравнения IP-адресов из конфигурации.
+func IPGranularity(cfg *config.Config) clientip.Granularity {
+	return clientip.Granularity{
+		IPv4: cfg.Session.IPChangePrefix.IPv4,
+		IPv6: cfg.Session.IPChangePrefix.IPv6,
+	}
+}
+
+// Возвращает политику истечения сессий из конфигурации.
+func SessionPolicy(cfg *config.Config) auth.SessionPolicy {
+	return auth.SessionPolicy{
+		TTL:         cfg.Session.RefreshTokenTTL,
+		Expiry:      cfg.Session.ExpiryPolicy,
+		MaxLifetime: cfg.Session.MaxSessionLifetime,
+		IdleTimeout: cfg.Session.IdleTimeout,
+		MaxSessions: cfg.Session.MaxSessions,
 	}
 }
@@ -1,21 +1,51 @@
 package handlers_test
 
 import (
+	"auth_service/internal/accounts"
+	"auth_service/internal/auditlog"
+	"auth_service/internal/captcha"
+	"auth_service/internal/clientip"
 	"auth_service/internal/config"
 	"auth_service/internal/handlers"
+	"auth_service/internal/lockout"
+	"auth_service/internal/quota"
+	"auth_service/internal/refreshlimit"
+	"auth_service/internal/security"
+	"auth_service/internal/services/auth"
 	"auth_service/internal/services/tokens"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/memory"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// Создаёт сервис токенов с настройками из конфигурации, как при запуске
+// сервиса (cmd/auth_service).
+func newService(cfg *config.Config, db handlers.Storage) *auth.Service {
+	return auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, cfg.JWTSecret).
+		WithRefreshSecret(cfg.RefreshTokenSecret).
+		WithSessionPolicy(handlers.SessionPolicy(cfg)).
+		WithStrictValidation(cfg.AccessTokenDenylist.Strict).
+		WithIPGranularity(handlers.IPGranularity(cfg)).
+		WithGeoRules(handlers.GeoRules(cfg)).
+		WithIPPrivacy(handlers.IPPrivacy(cfg)).
+		WithRiskActions(cfg.SecurityActions)
+}
+
 type MockStorage struct {
 	users         map[string]bool
 	refreshTokens map[string]string
@@ -32,25 +62,28 @@ func NewMockStorage() *MockStorage {
 	}
 }
 
-// Добавляет пользователя в storage.
+// Добавляет пользователя с email вида <userID>@example.com в storage.
 // Принимает userID (строка) — идентификатор пользователя.
 func (m *MockStorage) CreateUser(userID string) {
 	m.users[userID] = true
+	m.emails[userID] = userID + "@example.com"
 }
 
 // Сохраняет refresh-токен для пользователя.
+// Мок хранит одну сессию на пользователя, её идентификатор совпадает с userID.
 // Принимает:
 // - userID (строка): идентификатор пользователя.
 // - hashedToken (строка): хешированный refresh-токен.
 // - clientIP (строка): IP-адрес клиента.
-// Возвращает ошибку, если пользователь не существует.
-func (m *MockStorage) SaveRefreshToken(userID, hashedToken, clientIP string) error {
+// - expiresAt (time.Time): срок действия сессии (не учитывается).
+// Возвращает идентификатор сессии или ошибку, если пользователь не существует.
+func (m *MockStorage) SaveRefreshToken(userID, hashedToken, clientIP string, expiresAt time.Time) (string, error) {
 	if _, exists := m.users[userID]; !exists {
-		return fmt.Errorf("user does not exist")
+		return "", fmt.Errorf("user does not exist")
 	}
 	m.refreshTokens[userID] = hashedToken
 	m.ipAddresses[userID] = clientIP
-	return nil
+	return userID, nil
 }
 
 // Возвращает refresh-токен пользователя.
@@ -69,18 +102,23 @@ func (m *MockStorage) GetRefreshToken(userID string) (string, error) {
 	return token, nil
 }
 
-// Обновляет refresh-токен пользователя.
+// Обновляет refresh-токен сессии.
 // Принимает:
-// - userID (строка): идентификатор пользователя.
+// - sessionID (строка): идентификатор сессии (совпадает с userID).
+// - oldHash (строка): хеш ротируемого refresh-токена.
 // - hashedToken (строка): новый хешированный refresh-токен.
 // - clientIP (строка): IP-адрес клиента.
-// Возвращает ошибку, если пользователь не существует.
-func (m *MockStorage) UpdateRefreshToken(userID, hashedToken, clientIP string) error {
-	if _, exists := m.users[userID]; !exists {
+// - expiresAt (time.Time): срок действия сессии (не учитывается).
+// Возвращает ошибку, если пользователь не существует или токен уже ротирован.
+func (m *MockStorage) UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time) error {
+	if _, exists := m.users[sessionID]; !exists {
 		return fmt.Errorf("user does not exist")
 	}
-	m.refreshTokens[userID] = hashedToken
-	m.ipAddresses[userID] = clientIP
+	if m.refreshTokens[sessionID] != oldHash {
+		return storage.ErrNotFound
+	}
+	m.refreshTokens[sessionID] = hashedToken
+	m.ipAddresses[sessionID] = clientIP
 	return nil
 }
 
@@ -113,6 +151,102 @@ func (m *MockStorage) GetUserEmail(userID string) (string, error) {
 	return email, nil
 }
 
+// Учётные данные в моке не хранятся: вход по паролю проверяется на memory.Storage.
+func (m *MockStorage) GetUserCredentials(email string) (string, string, error) {
+	return "", "", storage.ErrNotFound
+}
+
+// Возвращает предпочитаемый язык пользователя (в моке не задаётся).
+func (m *MockStorage) GetUserLocale(userID string) (string, error) {
+	if _, exists := m.emails[userID]; !exists {
+		return "", fmt.Errorf("user does not exist")
+	}
+	return "", nil
+}
+
+// Удаляет refresh-токен пользователя.
+// Принимает userID (строка) — идентификатор пользователя.
+// Возвращает ошибку, если токен не найден.
+func (m *MockStorage) DeleteRefreshToken(userID string) error {
+	if _, exists := m.refreshTokens[userID]; !exists {
+		return fmt.Errorf("refresh token not found")
+	}
+	delete(m.refreshTokens, userID)
+	delete(m.ipAddresses, userID)
+	return nil
+}
+
+// Возвращает сессию по хешу refresh-токена.
+// Принимает refreshHash (строка) — хеш refresh-токена.
+// Возвращает storage.ErrNotFound, если такого хеша нет.
+func (m *MockStorage) GetSessionByRefreshHash(refreshHash string) (storage.Session, error) {
+	for userID, hash := range m.refreshTokens {
+		if hash == refreshHash {
+			return storage.Session{ID: userID, UserID: userID, RefreshTokenHash: hash, ClientIP: m.ipAddresses[userID]}, nil
+		}
+	}
+	return storage.Session{}, storage.ErrNotFound
+}
+
+// Возвращает сессии пользователя (не более одной).
+// Принимает userID (строка) — идентификатор пользователя.
+func (m *MockStorage) ListSessions(userID string) ([]storage.Session, error) {
+	hash, exists := m.refreshTokens[userID]
+	if !exists {
+		return []storage.Session{}, nil
+	}
+	return []storage.Session{{ID: userID, UserID: userID, RefreshTokenHash: hash, ClientIP: m.ipAddresses[userID]}}, nil
+}
+
+// Удаляет сессию по идентификатору.
+// Принимает sessionID (строка) — идентификатор сессии (совпадает с userID).
+// Возвращает storage.ErrNotFound, если сессии нет.
+func (m *MockStorage) DeleteSession(sessionID string) error {
+	if _, exists := m.refreshTokens[sessionID]; !exists {
+		return storage.ErrNotFound
+	}
+	delete(m.refreshTokens, sessionID)
+	delete(m.ipAddresses, sessionID)
+	return nil
+}
+
+// Удаляет сессию пользователя; у пользователя мока одна сессия с идентификатором userID.
+func (m *MockStorage) DeleteUserSession(userID, sessionID string) error {
+	if sessionID != userID {
+		return storage.ErrNotFound
+	}
+	return m.DeleteSession(sessionID)
+}
+
+// Версии токенов в моке не повышаются: выход со всех устройств проверяется на memory.Storage.
+func (m *MockStorage) GetTokenVersion(userID string) (int64, error) {
+	if _, exists := m.users[userID]; !exists {
+		return 0, storage.ErrNotFound
+	}
+	return 0, nil
+}
+
+func (m *MockStorage) BumpTokenVersion(userID string) (int64, error) {
+	return 0, storage.ErrNotFound
+}
+
+// Устройство сессии в моке не хранится.
+func (m *MockStorage) SetSessionDevice(sessionID string, device storage.Device) error {
+	if _, exists := m.refreshTokens[sessionID]; !exists {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// Список отзыва access-токенов не используется в тестах обработчиков.
+func (m *MockStorage) DenyAccessToken(key string, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *MockStorage) IsAccessTokenDenied(keys ...string) (bool, error) {
+	return false, nil
+}
+
 // Тестирование обработчика GenerateTokensHandler.
 // Проверяка генерацию access и refresh токенов для валидного user_id.
 func TestGenerateTokensHandler(t *testing.T) {
@@ -130,7 +264,7 @@ func TestGenerateTokensHandler(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil)
 	rec := httptest.NewRecorder()
 
-	handlers.GenerateTokensHandler(rec, req, logger, cfg, storage)
+	handlers.GenerateTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 
@@ -142,6 +276,32 @@ func TestGenerateTokensHandler(t *testing.T) {
 	assert.NotEmpty(t, resp.RefreshToken)
 }
 
+// Тестирование обработчика GenerateTokensHandler.
+// Проверка ответа при исчерпанной квоте сессий.
+func TestGenerateTokensHandler_SessionQuota(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+	require.NoError(t, quota.SetLimits(quota.Limits{MaxSessions: 1}))
+	quota.SetSessionCounter(db)
+	t.Cleanup(func() {
+		_ = quota.SetLimits(quota.Limits{})
+		quota.SetSessionCounter(nil)
+	})
+
+	rec := httptest.NewRecorder()
+	handlers.GenerateTokensHandler(rec, httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil), logger, cfg, newService(cfg, db))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handlers.GenerateTokensHandler(rec, httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil), logger, cfg, newService(cfg, db))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "quota_exceeded", rec.Header().Get("X-Error-Code"))
+}
+
 // Тестирование обработчика GenerateTokensHandler.
 // Проверка поведения при отсутствии user_id в запросе.
 func TestGenerateTokensHandler_MissingUserID(t *testing.T) {
@@ -155,12 +315,608 @@ func TestGenerateTokensHandler_MissingUserID(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/auth/tokens", nil)
 	rec := httptest.NewRecorder()
 
-	handlers.GenerateTokensHandler(rec, req, logger, cfg, storage)
+	handlers.GenerateTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 	assert.Contains(t, rec.Body.String(), "user_id is required")
 }
 
+// Проверка перевода ошибки на язык из Accept-Language.
+func TestGenerateTokensHandler_LocalizedError(t *testing.T) {
+	cfg := &config.Config{
+		JWTSecret: "secret",
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id=bad", nil)
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en;q=0.8")
+	rec := httptest.NewRecorder()
+
+	handlers.GenerateTokensHandler(rec, req, logger, cfg, newService(cfg, NewMockStorage()))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "некорректный user_id\n", rec.Body.String())
+	assert.Equal(t, "invalid_user_id", rec.Header().Get("X-Error-Code"))
+}
+
+// Тестирование обработчика LoginHandler.
+// Проверка выдачи токенов по email и паролю и отказа при неверном пароле.
+func TestLoginHandler(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, db.SetPassword(userID, string(hash)))
+
+	login := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handlers.LoginHandler(rec, httptest.NewRequest(method, "/auth/login", strings.NewReader(body)), logger, cfg, newService(cfg, db))
+		return rec
+	}
+
+	rec := login(http.MethodPost, `{"email":"test@example.com","password":"correct horse"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	claims, err := tokens.ParseAccessToken(response.AccessToken, cfg.JWTSecret)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+	assert.NotEmpty(t, response.RefreshToken)
+
+	rec = login(http.MethodPost, `{"email":"test@example.com","password":"wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_credentials", rec.Header().Get("X-Error-Code"))
+
+	rec = login(http.MethodPost, `{"email":"unknown@example.com","password":"correct horse"}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_credentials", rec.Header().Get("X-Error-Code"))
+
+	rec = login(http.MethodPost, `{"email":"test@example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "credentials_required", rec.Header().Get("X-Error-Code"))
+
+	rec = login(http.MethodPost, `not json`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "invalid_request_body", rec.Header().Get("X-Error-Code"))
+
+	rec = login(http.MethodGet, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
+
+// Проверка ответа на вход, заблокированный после неудачных попыток.
+func TestLoginHandler_Locked(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := memory.NewMemoryStorage()
+	require.NoError(t, lockout.Set(db, lockout.Policy{MaxIPFailures: 1, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour}))
+	t.Cleanup(func() { lockout.Set(nil, lockout.Policy{}) })
+
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"test@example.com","password":"wrong"}`))
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		handlers.LoginHandler(rec, req, logger, cfg, newService(cfg, db))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login().Code)
+	rec := login()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "login_locked", rec.Header().Get("X-Error-Code"))
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+}
+
+// Тестирование обработчика GenerateTokensHandler для отключённой учётной записи.
+func TestGenerateTokensHandler_Disabled(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+	require.NoError(t, db.SetUserDisabled(userID, true))
+	accounts.Set(db, db)
+	t.Cleanup(func() { accounts.Set(nil, nil) })
+
+	rec := httptest.NewRecorder()
+	handlers.GenerateTokensHandler(rec, httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil), logger, cfg, newService(cfg, db))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "account_disabled", rec.Header().Get("X-Error-Code"))
+}
+
+// Проверяющий CAPTCHA, принимающий только ответ "passed".
+type stubCaptcha struct{}
+
+func (stubCaptcha) Verify(_ context.Context, token, _ string) error {
+	if token != "passed" {
+		return captcha.ErrInvalid
+	}
+	return nil
+}
+
+// Тестирование обработчика LoginHandler с CAPTCHA после неудачных попыток.
+func TestLoginHandler_Captcha(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := memory.NewMemoryStorage()
+	require.NoError(t, lockout.Set(db, lockout.Policy{MaxAccountFailures: 10, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour}))
+	t.Cleanup(func() { lockout.Set(nil, lockout.Policy{}) })
+	require.NoError(t, captcha.Set(stubCaptcha{}, map[string]captcha.Rule{
+		captcha.EndpointLogin: {Mode: captcha.ModeAfterFailures, AfterFailures: 1},
+	}))
+	t.Cleanup(func() { captcha.Set(nil, nil) })
+
+	login := func(body, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+		if header != "" {
+			req.Header.Set("X-Captcha-Token", header)
+		}
+		rec := httptest.NewRecorder()
+		handlers.LoginHandler(rec, req, logger, cfg, newService(cfg, db))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login(`{"email":"test@example.com","password":"wrong"}`, "").Code)
+
+	rec := login(`{"email":"test@example.com","password":"wrong"}`, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "captcha_required", rec.Header().Get("X-Error-Code"))
+
+	rec = login(`{"email":"test@example.com","password":"wrong","captcha_token":"bot"}`, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "captcha_invalid", rec.Header().Get("X-Error-Code"))
+
+	assert.Equal(t, http.StatusUnauthorized, login(`{"email":"test@example.com","password":"wrong","captcha_token":"passed"}`, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, login(`{"email":"test@example.com","password":"wrong"}`, "passed").Code)
+
+	// Другие учётные записи CAPTCHA не требуют.
+	assert.Equal(t, http.StatusUnauthorized, login(`{"email":"other@example.com","password":"wrong"}`, "").Code)
+}
+
+// Тестирование обработчика LogoutHandler.
+// Проверка завершения сессии по access-токену.
+func TestLogoutHandler(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+
+	rec := httptest.NewRecorder()
+	handlers.GenerateTokensHandler(rec, httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil), logger, cfg, newService(cfg, db))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var issued handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+
+	logout := func(method, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/auth/logout", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handlers.LogoutHandler(rec, req, logger, cfg, newService(cfg, db))
+		return rec
+	}
+
+	rec = logout(http.MethodPost, "Bearer "+issued.AccessToken)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	sessions, err := db.ListSessions(userID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// Повторный выход из завершённой сессии не считается ошибкой.
+	rec = logout(http.MethodPost, "Bearer "+issued.AccessToken)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = logout(http.MethodPost, "Bearer invalid")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_access_token", rec.Header().Get("X-Error-Code"))
+
+	rec = logout(http.MethodPost, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "access_token_required", rec.Header().Get("X-Error-Code"))
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	rec = logout(http.MethodGet, "Bearer "+issued.AccessToken)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
+
+// Рассылка уведомлений об отзыве, сохраняющая уведомления.
+type recordingPublisher struct {
+	notices []storage.RevocationNotice
+}
+
+func (p *recordingPublisher) PublishRevocation(notice storage.RevocationNotice) error {
+	p.notices = append(p.notices, notice)
+	return nil
+}
+
+// Проверка рассылки уведомления об отзыве сессии при выходе через
+// маршрутизатор сервисом, переданным в NewRouter.
+func TestLogoutHandler_RevocationNotice(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret", Admin: config.Admin{Tokens: []string{adminToken}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+	publisher := &recordingPublisher{}
+	router := handlers.NewRouter(logger, cfg, newService(cfg, db).WithRevocationPublisher(publisher))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, issueRequest("/api/v1/auth/tokens?user_id="+userID))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var issued handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+	claims, err := tokens.ParseAccessToken(issued.AccessToken, cfg.JWTSecret)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+issued.AccessToken)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	require.Len(t, publisher.notices, 1)
+	assert.Equal(t, claims.SessionID, publisher.notices[0].SessionID)
+}
+
+// Тестирование обработчика LogoutAllHandler.
+// Проверка отзыва всех сессий пользователя по его access-токену.
+func TestLogoutAllHandler(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	cfg.AccessTokenDenylist.Strict = true
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+
+	issue := func() handlers.TokenResponse {
+		rec := httptest.NewRecorder()
+		handlers.GenerateTokensHandler(rec, httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil), logger, cfg, newService(cfg, db))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var response handlers.TokenResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response
+	}
+	logoutAll := func(method, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/auth/logout_all", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handlers.LogoutAllHandler(rec, req, logger, cfg, newService(cfg, db))
+		return rec
+	}
+
+	phone := issue()
+	laptop := issue()
+
+	rec := logoutAll(http.MethodPost, "Bearer "+phone.AccessToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response handlers.LogoutAllResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.RevokedSessions)
+
+	sessions, err := db.ListSessions(userID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// Выданные ранее access-токены больше не принимаются.
+	rec = logoutAll(http.MethodPost, "Bearer "+laptop.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_access_token", rec.Header().Get("X-Error-Code"))
+
+	rec = logoutAll(http.MethodPost, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "access_token_required", rec.Header().Get("X-Error-Code"))
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	rec = logoutAll(http.MethodGet, "Bearer "+issue().AccessToken)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
+
+// Тестирование обработчика RevokeAccessTokenHandler.
+// Проверка, что отозванный access-токен отклоняется, а сессия сохраняется.
+func TestRevokeAccessTokenHandler(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	cfg.AccessTokenDenylist.Strict = true
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+
+	rec := httptest.NewRecorder()
+	handlers.GenerateTokensHandler(rec, httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil), logger, cfg, newService(cfg, db))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var issued handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+
+	revoke := func(method, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/auth/revoke", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handlers.RevokeAccessTokenHandler(rec, req, logger, cfg, newService(cfg, db))
+		return rec
+	}
+
+	rec = revoke(http.MethodPost, "Bearer "+issued.AccessToken)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	// Отозванный токен больше не принимается, но сессия действует.
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/auth/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+issued.AccessToken)
+	handlers.ListSessionsHandler(rec, req, logger, cfg, newService(cfg, db))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_access_token", rec.Header().Get("X-Error-Code"))
+	sessions, err := db.ListSessions(userID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	rec = revoke(http.MethodPost, "Bearer invalid")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_access_token", rec.Header().Get("X-Error-Code"))
+
+	rec = revoke(http.MethodPost, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "access_token_required", rec.Header().Get("X-Error-Code"))
+
+	rec = revoke(http.MethodGet, "Bearer "+issued.AccessToken)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
+
+// Тестирование обработчика ListSessionsHandler.
+// Проверка списка сессий пользователя с устройствами и отметкой текущей сессии.
+func TestListSessionsHandler(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+
+	issue := func(name string) handlers.TokenResponse {
+		req := httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil)
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set("X-Device-Name", name)
+		req.Header.Set("X-Device-Platform", "iOS")
+		rec := httptest.NewRecorder()
+		handlers.GenerateTokensHandler(rec, req, logger, cfg, newService(cfg, db))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var response handlers.TokenResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response
+	}
+	list := func(method, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/auth/sessions", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handlers.ListSessionsHandler(rec, req, logger, cfg, newService(cfg, db))
+		return rec
+	}
+
+	phone := issue("Phone")
+	issue("Laptop")
+
+	rec := list(http.MethodGet, "Bearer "+phone.AccessToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response handlers.SessionsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Sessions, 2)
+
+	current := map[string]bool{}
+	for _, session := range response.Sessions {
+		assert.NotEmpty(t, session.ID)
+		assert.Equal(t, "test-agent", session.Device.UserAgent)
+		assert.Equal(t, "ios", session.Device.Platform)
+		assert.False(t, session.CreatedAt.IsZero())
+		assert.True(t, session.ExpiresAt.After(session.LastUsedAt))
+		current[session.Device.Name] = session.Current
+	}
+	assert.Equal(t, map[string]bool{"Phone": true, "Laptop": false}, current)
+
+	rec = list(http.MethodGet, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "access_token_required", rec.Header().Get("X-Error-Code"))
+
+	rec = list(http.MethodGet, "Bearer invalid")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_access_token", rec.Header().Get("X-Error-Code"))
+
+	rec = list(http.MethodPost, "Bearer "+phone.AccessToken)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodGet, rec.Header().Get("Allow"))
+}
+
+// Тестирование обработчика LoginHistoryHandler.
+// Проверка истории входов: устройство, текущая сессия и постраничный вывод.
+func TestLoginHistoryHandler(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+	security.SetSinks(auditlog.NewSink())
+	t.Cleanup(func() { security.SetSinks() })
+
+	// Запросы проходят через auditlog.Middleware, как в маршрутизаторе.
+	serve := func(handler func(http.ResponseWriter, *http.Request, *slog.Logger, *config.Config, *auth.Service), req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		auditlog.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r, logger, cfg, newService(cfg, db))
+		})).ServeHTTP(rec, req)
+		return rec
+	}
+	issue := func(name string) handlers.TokenResponse {
+		req := httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil)
+		req.Header.Set("User-Agent", name+"-agent")
+		req.Header.Set("X-Device-Name", name)
+		rec := serve(handlers.GenerateTokensHandler, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var response handlers.TokenResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response
+	}
+	history := func(method, target, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return serve(handlers.LoginHistoryHandler, req)
+	}
+
+	phone := issue("Phone")
+	rec := history(http.MethodGet, "/auth/history", "Bearer "+phone.AccessToken)
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.Equal(t, "login_history_not_supported", rec.Header().Get("X-Error-Code"))
+
+	auditlog.Set(db, clientip.Privacy{})
+	t.Cleanup(func() { auditlog.Set(nil, clientip.Privacy{}) })
+	phone = issue("Phone")
+	req := httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(`{"refresh_token":"`+phone.RefreshToken+`"}`))
+	req.Header.Set("User-Agent", "Phone-agent")
+	rec = serve(handlers.RefreshTokensHandler, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	laptop := issue("Laptop")
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+laptop.AccessToken)
+	require.Equal(t, http.StatusNoContent, serve(handlers.LogoutHandler, req).Code)
+
+	rec = history(http.MethodGet, "/auth/history", "Bearer "+phone.AccessToken)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var response handlers.LoginHistoryResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Entries, 3)
+	assert.Nil(t, response.NextBefore)
+
+	ended := response.Entries[0]
+	assert.Equal(t, "login", ended.Type)
+	assert.Equal(t, handlers.DeviceResponse{UserAgent: "Laptop-agent"}, ended.Device, "the session has ended")
+	assert.False(t, ended.Current)
+	refreshed := response.Entries[1]
+	assert.Equal(t, "refresh", refreshed.Type)
+	assert.Equal(t, "192.0.2.1", refreshed.ClientIP)
+	assert.Equal(t, handlers.DeviceResponse{UserAgent: "Phone-agent", Name: "Phone"}, refreshed.Device)
+	assert.True(t, refreshed.Current)
+	assert.Equal(t, "login", response.Entries[2].Type)
+	assert.Equal(t, refreshed.SessionID, response.Entries[2].SessionID)
+	assert.False(t, response.Entries[2].Time.After(refreshed.Time))
+
+	rec = history(http.MethodGet, "/auth/history?limit=2", "Bearer "+phone.AccessToken)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Entries, 2)
+	require.NotNil(t, response.NextBefore)
+	rec = history(http.MethodGet, fmt.Sprintf("/auth/history?limit=2&before=%d", *response.NextBefore), "Bearer "+phone.AccessToken)
+	response = handlers.LoginHistoryResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Entries, 1)
+	assert.Equal(t, "login", response.Entries[0].Type)
+	assert.Nil(t, response.NextBefore)
+
+	for _, target := range []string{"/auth/history?limit=0", "/auth/history?limit=101", "/auth/history?before=abc"} {
+		rec = history(http.MethodGet, target, "Bearer "+phone.AccessToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		assert.Equal(t, "invalid_history_query", rec.Header().Get("X-Error-Code"), target)
+	}
+
+	rec = history(http.MethodGet, "/auth/history", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "access_token_required", rec.Header().Get("X-Error-Code"))
+
+	rec = history(http.MethodPost, "/auth/history", "Bearer "+phone.AccessToken)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodGet, rec.Header().Get("Allow"))
+}
+
+// Тестирование обработчика DeleteSessionHandler.
+// Проверка завершения одной сессии без затрагивания остальных.
+func TestDeleteSessionHandler(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	cfg.AccessTokenDenylist.Strict = true
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	otherID := "223e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+	db.CreateUser(otherID, "other@example.com")
+
+	issue := func(userID string) handlers.TokenResponse {
+		rec := httptest.NewRecorder()
+		handlers.GenerateTokensHandler(rec, httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil), logger, cfg, newService(cfg, db))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var response handlers.TokenResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response
+	}
+	sessionID := func(userID string) string {
+		sessions, err := db.ListSessions(userID)
+		require.NoError(t, err)
+		require.NotEmpty(t, sessions)
+		return sessions[0].ID
+	}
+	deleteSession := func(method, authorization, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/auth/sessions/"+id, nil)
+		req.SetPathValue("id", id)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handlers.DeleteSessionHandler(rec, req, logger, cfg, newService(cfg, db))
+		return rec
+	}
+
+	phone := issue(userID)
+	laptop := issue(userID)
+	laptopSession := sessionID(userID)
+	other := issue(otherID)
+
+	rec := deleteSession(http.MethodDelete, "Bearer "+phone.AccessToken, laptopSession)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	sessions, err := db.ListSessions(userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.NotEqual(t, laptopSession, sessions[0].ID)
+
+	// Access-токен завершённой сессии отклоняется.
+	rec = deleteSession(http.MethodDelete, "Bearer "+laptop.AccessToken, sessions[0].ID)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid_access_token", rec.Header().Get("X-Error-Code"))
+
+	// Чужую, уже завершённую и некорректную сессии завершить нельзя.
+	for _, id := range []string{sessionID(otherID), laptopSession, "not-a-uuid"} {
+		rec = deleteSession(http.MethodDelete, "Bearer "+phone.AccessToken, id)
+		assert.Equal(t, http.StatusNotFound, rec.Code, id)
+		assert.Equal(t, "session_not_found", rec.Header().Get("X-Error-Code"), id)
+	}
+	rec = deleteSession(http.MethodDelete, "Bearer "+other.AccessToken, sessionID(otherID))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = deleteSession(http.MethodDelete, "", laptopSession)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "access_token_required", rec.Header().Get("X-Error-Code"))
+
+	rec = deleteSession(http.MethodGet, "Bearer "+phone.AccessToken, laptopSession)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodDelete, rec.Header().Get("Allow"))
+}
+
 // Тестирует обработчика RefreshTokensHandler.
 // Проверка обновления токенов для валидного запроса.
 func TestRefreshTokensHandler(t *testing.T) {
@@ -176,15 +932,15 @@ func TestRefreshTokensHandler(t *testing.T) {
 	storage.CreateUser(userID)
 
 	// Генерация Refresh токена и его хеша.
-	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash()
+	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash(cfg.JWTSecret)
 	assert.NoError(t, err)
 
 	// Сохранение Refresh токена в хранилище.
-	err = storage.SaveRefreshToken(userID, hashedToken, clientIP)
+	_, err = storage.SaveRefreshToken(userID, hashedToken, clientIP, time.Now().Add(time.Hour))
 	assert.NoError(t, err)
 
 	// Генерация Access токена.
-	accessToken, err := tokens.GenerateAccessToken(userID, clientIP, cfg.JWTSecret, hashedToken)
+	accessToken, err := tokens.GenerateAccessToken(userID, clientIP, cfg.JWTSecret, hashedToken, "", 0, nil)
 	assert.NoError(t, err)
 
 	reqBody, err := json.Marshal(handlers.TokenResponse{
@@ -199,7 +955,7 @@ func TestRefreshTokensHandler(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 
-	handlers.RefreshTokensHandler(rec, req, logger, cfg, storage)
+	handlers.RefreshTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 
@@ -211,6 +967,148 @@ func TestRefreshTokensHandler(t *testing.T) {
 	assert.NotEmpty(t, resp.RefreshToken)
 }
 
+// Проверка обновления токенов по одному refresh-токену.
+func TestRefreshTokensHandler_RefreshTokenOnly(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage := NewMockStorage()
+
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	storage.CreateUser(userID)
+	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash(cfg.JWTSecret)
+	require.NoError(t, err)
+	_, err = storage.SaveRefreshToken(userID, hashedToken, "127.0.0.1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	refresh := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "127.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handlers.RefreshTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
+		return rec
+	}
+
+	rec := refresh(`{"refresh_token":"` + refreshToken + `"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp handlers.TokenResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.NotEmpty(t, resp.AccessToken)
+	assert.NotEmpty(t, resp.RefreshToken)
+
+	rec = refresh(`{"refresh_token":"` + refreshToken + `"}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = refresh(`{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "refresh token is required")
+}
+
+// Проверка сохранения событий ротации в outbox при обновлении токенов через
+// маршрутизатор сервисом, переданным в NewRouter.
+func TestRefreshTokensHandler_Outbox(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "secret", Admin: config.Admin{Tokens: []string{adminToken}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+	router := handlers.NewRouter(logger, cfg, newService(cfg, db).WithOutbox(db))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, issueRequest("/api/v1/auth/tokens?user_id="+userID))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var issued handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &issued))
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(`{"refresh_token":"`+issued.RefreshToken+`"}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	due, err := db.DueOutboxEvents(time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, security.EventTokenRotated, due[0].Type)
+	assert.Contains(t, string(due[0].Payload), userID)
+}
+
+// Проверка запрета обновления токенов пользователя после неудачных попыток.
+func TestRefreshTokensHandler_Throttled(t *testing.T) {
+	require.NoError(t, refreshlimit.Set(memory.NewMemoryStorage(), refreshlimit.Limits{MaxFailures: 2, Window: time.Minute, Cooldown: time.Minute}))
+	t.Cleanup(func() { refreshlimit.Set(nil, refreshlimit.Limits{}) })
+
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage := NewMockStorage()
+
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	storage.CreateUser(userID)
+	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash(cfg.JWTSecret)
+	require.NoError(t, err)
+	_, err = storage.SaveRefreshToken(userID, hashedToken, "127.0.0.1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	accessToken, err := tokens.GenerateAccessToken(userID, "127.0.0.1", cfg.JWTSecret, hashedToken, "", 0, nil)
+	require.NoError(t, err)
+
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(handlers.RefreshRequest{AccessToken: accessToken, RefreshToken: refreshToken})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handlers.RefreshTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := refresh("guessed-refresh-token")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+	// Во время запрета не принимается и настоящий refresh-токен.
+	rec := refresh(refreshToken)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "refresh_throttled", rec.Header().Get("X-Error-Code"))
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+}
+
+// Проверка запрета обновления по одному refresh-токену, без access-токена.
+func TestRefreshTokensHandler_ThrottledRefreshOnly(t *testing.T) {
+	require.NoError(t, refreshlimit.Set(memory.NewMemoryStorage(), refreshlimit.Limits{MaxFailures: 2, Window: time.Minute, Cooldown: time.Minute}))
+	t.Cleanup(func() { refreshlimit.Set(nil, refreshlimit.Limits{}) })
+
+	cfg := &config.Config{JWTSecret: "secret"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage := NewMockStorage()
+
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	storage.CreateUser(userID)
+	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash(cfg.JWTSecret)
+	require.NoError(t, err)
+	_, err = storage.SaveRefreshToken(userID, hashedToken, "127.0.0.1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	accessToken, err := tokens.GenerateAccessToken(userID, "127.0.0.1", cfg.JWTSecret, hashedToken, "", 0, nil)
+	require.NoError(t, err)
+
+	refresh := func(request handlers.RefreshRequest) *httptest.ResponseRecorder {
+		body, err := json.Marshal(request)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handlers.RefreshTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := refresh(handlers.RefreshRequest{AccessToken: accessToken, RefreshToken: "guessed-refresh-token"})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+	// Запрет действует и на запрос без access-токена: пользователь
+	// определяется по сессии refresh-токена.
+	rec := refresh(handlers.RefreshRequest{RefreshToken: refreshToken})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	assert.Equal(t, "refresh_throttled", rec.Header().Get("X-Error-Code"))
+}
+
 // Тестирование обработчика RefreshTokensHandler.
 // Проверка поведения при недействительном access токене.
 func TestRefreshTokensHandler_InvalidAccessToken(t *testing.T) {
@@ -228,7 +1126,7 @@ func TestRefreshTokensHandler_InvalidAccessToken(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
-	handlers.RefreshTokensHandler(rec, req, logger, cfg, storage)
+	handlers.RefreshTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
 
 	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 	assert.Contains(t, rec.Body.String(), "invalid access token")
@@ -250,13 +1148,13 @@ func TestRefreshTokensHandler_IPChangeWarning(t *testing.T) {
 
 	storage.CreateUser(userID)
 
-	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash()
+	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash(cfg.JWTSecret)
 	assert.NoError(t, err)
 
-	err = storage.SaveRefreshToken(userID, hashedToken, clientIP)
+	_, err = storage.SaveRefreshToken(userID, hashedToken, clientIP, time.Now().Add(time.Hour))
 	assert.NoError(t, err)
 
-	accessToken, err := tokens.GenerateAccessToken(userID, clientIP, cfg.JWTSecret, hashedToken)
+	accessToken, err := tokens.GenerateAccessToken(userID, clientIP, cfg.JWTSecret, hashedToken, "", 0, nil)
 	assert.NoError(t, err)
 
 	reqBody, err := json.Marshal(handlers.TokenResponse{
@@ -271,7 +1169,7 @@ func TestRefreshTokensHandler_IPChangeWarning(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 
-	handlers.RefreshTokensHandler(rec, req, logger, cfg, storage)
+	handlers.RefreshTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 
@@ -281,3 +1179,79 @@ func TestRefreshTokensHandler_IPChangeWarning(t *testing.T) {
 	assert.NotEmpty(t, resp.AccessToken)
 	assert.NotEmpty(t, resp.RefreshToken)
 }
+
+// Проверка, что адрес клиента берётся из заголовка только доверенного прокси.
+func TestGenerateTokensHandler_ForwardedClientIP(t *testing.T) {
+	cfg := &config.Config{
+		JWTSecret: "secret",
+		Admin:     config.Admin{Tokens: []string{adminToken}},
+	}
+	cfg.HTTPServer.TrustedProxies = []string{"10.0.0.0/8"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage := NewMockStorage()
+
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	storage.CreateUser(userID)
+	router := handlers.NewRouter(logger, cfg, newService(cfg, storage))
+
+	issue := func(remoteAddr string) string {
+		req := issueRequest("/api/v1/auth/tokens?user_id=" + userID)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.2")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		ip, err := storage.GetLastIP(userID)
+		assert.NoError(t, err)
+		return ip
+	}
+
+	assert.Equal(t, "203.0.113.7", issue("10.0.0.1:54321"))
+	assert.Equal(t, "192.0.2.1", issue("192.0.2.1:54321"), "headers from untrusted peer")
+}
+
+// Тестирование полного цикла выдачи и обновления токенов на хранилище в памяти.
+func TestGenerateAndRefresh_MemoryStorage(t *testing.T) {
+	cfg := &config.Config{
+		JWTSecret: "secret",
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
+	storage := memory.NewMemoryStorage()
+
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	clientIP := "127.0.0.1"
+	storage.CreateUser(userID, "test@example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/tokens?user_id="+userID, nil)
+	req.RemoteAddr = clientIP
+	rec := httptest.NewRecorder()
+
+	handlers.GenerateTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var issued handlers.TokenResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&issued))
+
+	reqBody, err := json.Marshal(issued)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewReader(reqBody))
+	req.RemoteAddr = clientIP
+	rec = httptest.NewRecorder()
+
+	handlers.RefreshTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var refreshed handlers.TokenResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&refreshed))
+	assert.NotEqual(t, issued.RefreshToken, refreshed.RefreshToken)
+
+	// Старый refresh-токен после ротации больше не принимается.
+	req = httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewReader(reqBody))
+	req.RemoteAddr = clientIP
+	rec = httptest.NewRecorder()
+
+	handlers.RefreshTokensHandler(rec, req, logger, cfg, newService(cfg, storage))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
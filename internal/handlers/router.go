@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"auth_service/internal/accounts"
+	"auth_service/internal/analytics"
+	"auth_service/internal/auditlog"
+	"auth_service/internal/clientip"
+	"auth_service/internal/config"
+	"auth_service/internal/health"
+	"auth_service/internal/httpmw"
+	"auth_service/internal/i18n"
+	"auth_service/internal/jwks"
+	"auth_service/internal/maintenance"
+	"auth_service/internal/metrics"
+	"auth_service/internal/mtls"
+	"auth_service/internal/openapi"
+	"auth_service/internal/profiling"
+	"auth_service/internal/quota"
+	"auth_service/internal/ratelimit"
+	"auth_service/internal/revocation"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/services/tokens"
+	"auth_service/internal/tracing"
+	"auth_service/internal/usage"
+	"auth_service/internal/webhook"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Группы маршрутов, для которых middleware настраивается отдельно.
+const (
+	// Маршруты API (/api/v1 и устаревшие пути без версии).
+	GroupAPI = "api"
+	// Служебные маршруты: /metrics, /openapi.json, /docs, /readyz и /admin/*.
+	GroupOps = "ops"
+)
+
+// Маршрут версии API (путь указывается без префикса версии).
+type Route struct {
+	Path    string
+	Handler http.Handler
+}
+
+// Версия HTTP API.
+//
+// Маршруты версии регистрируются под префиксом Prefix. Чтобы выпустить
+// несовместимые изменения, добавляется новая версия (например, /api/v2) со
+// своим набором маршрутов, а предыдущая помечается Deprecated и продолжает
+// работать до удаления.
+type APIVersion struct {
+	Prefix     string
+	Routes     []Route
+	Deprecated bool
+	// Версия, на которую следует перейти клиентам устаревшей версии.
+	Successor string
+}
+
+// Создаёт маршрутизатор HTTP API.
+//
+// Если задан отдельный адрес служебных маршрутов (ops_server.address), они
+// не регистрируются здесь, а обслуживаются маршрутизатором NewOpsRouter.
+//
+// Принимает:
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - svc: сервис токенов, общий для всех маршрутов (и gRPC API).
+//
+// Возвращает:
+// - *http.ServeMux со всеми маршрутами сервиса.
+func NewRouter(log *slog.Logger, cfg *config.Config, svc *auth.Service) *http.ServeMux {
+	v1 := v1Routes(log, cfg, svc)
+
+	server := serverLimiter(cfg)
+	api := groupMiddleware(log, cfg, GroupAPI, server)
+
+	// Адрес клиента определяется до остальных middleware API.
+	resolver, err := clientip.NewResolver(cfg.HTTPServer.TrustedProxies)
+	if err != nil {
+		log.Error("Invalid trusted proxies, forwarded headers are ignored", slog.String("error", err.Error()))
+		resolver, _ = clientip.NewResolver(nil)
+	}
+
+	mux := http.NewServeMux()
+	mountVersions(mux, func(h http.Handler) http.Handler { return resolver.Middleware(api(h)) },
+		APIVersion{Prefix: "/api/v1", Routes: v1},
+		// Пути до введения версий; оставлены для существующих клиентов.
+		APIVersion{Prefix: "", Routes: v1, Deprecated: true, Successor: "/api/v1"},
+	)
+	// Ключи подписи нужны API-шлюзам и сервисам-потребителям, поэтому
+	// публикуются в группе API, а не в служебной.
+	mux.Handle("/.well-known/jwks.json", api(jwks.Handler(tokens.PublicKeys(), cfg.AccessTokenSigning.JWKSMaxAge)))
+	if cfg.OpsServer.Address == "" {
+		mountOps(mux, log, cfg, groupMiddleware(log, cfg, GroupOps, server))
+	}
+	return mux
+}
+
+// Создаёт маршрутизатор служебных маршрутов для отдельного адреса
+// (ops_server.address): /metrics, /readyz, /openapi.json, /docs, /admin/* и,
+// если включено ops_server.pprof, профили /debug/pprof/*.
+//
+// Принимает:
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+//
+// Возвращает:
+// - *http.ServeMux со служебными маршрутами.
+func NewOpsRouter(log *slog.Logger, cfg *config.Config) *http.ServeMux {
+	mux := http.NewServeMux()
+	admin := mountOps(mux, log, cfg, groupMiddleware(log, cfg, GroupOps, serverLimiter(cfg)))
+	if cfg.OpsServer.PProf {
+		mux.Handle("/debug/pprof/", admin(profiling.Handler()))
+	}
+	return mux
+}
+
+// Создаёт общее ограничение одновременных запросов для всех групп
+// маршрутов сервера; nil — без ограничения.
+func serverLimiter(cfg *config.Config) *httpmw.Limiter {
+	if max := cfg.HTTPServer.LoadShedding.MaxInFlight; max > 0 {
+		return httpmw.NewLimiter("server", max)
+	}
+	return nil
+}
+
+// Регистрирует служебные маршруты.
+//
+// Принимает:
+// - mux: маршрутизатор.
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - ops: middleware группы служебных маршрутов.
+//
+// Возвращает:
+// - middleware маршрутов /admin/* с проверкой учётных данных администратора.
+func mountOps(mux *http.ServeMux, log *slog.Logger, cfg *config.Config, ops func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	mux.Handle("/metrics", ops(metrics.Handler()))
+	mux.Handle("/openapi.json", ops(openapi.SpecHandler()))
+	mux.Handle("/docs", ops(openapi.DocsHandler()))
+	mux.Handle("/readyz", ops(health.Handler()))
+
+	requireAdmin := trustedCaller(log, cfg, mtls.ScopeAdmin, "admin_credentials_required")
+	admin := func(h http.Handler) http.Handler { return ops(requireAdmin(h)) }
+	// Изменяющие запросы администратора записываются в журнал действий.
+	mux.Handle("/admin/usage", admin(usage.Handler()))
+	mux.Handle("/admin/stats", admin(analytics.Handler()))
+	mux.Handle("/admin/audit", admin(auditlog.Handler()))
+	mux.Handle("/admin/quotas", admin(auditlog.Admin(auditlog.ActionQuotas, quota.Handler())))
+	mux.Handle("/admin/maintenance", admin(auditlog.Admin(auditlog.ActionMaintenance, maintenance.Handler())))
+	mux.Handle("/admin/sessions/revoke", admin(auditlog.Admin(auditlog.ActionSessionsRevoke, revocation.Handler())))
+	mux.Handle("/admin/users/{id}", admin(accounts.StatusHandler()))
+	mux.Handle("/admin/users/{id}/unlock", admin(auditlog.AdminUser(auditlog.ActionAccountUnlock, accounts.UnlockHandler())))
+	mux.Handle("/admin/users/{id}/disable", admin(auditlog.AdminUser(auditlog.ActionAccountDisable, accounts.DisableHandler())))
+	mux.Handle("/admin/users/{id}/enable", admin(auditlog.AdminUser(auditlog.ActionAccountEnable, accounts.EnableHandler())))
+	mux.Handle("/admin/webhooks/deliveries/{id}", admin(webhook.DeliveryHandler()))
+	mux.Handle("/admin/webhooks/deliveries/{id}/redeliver", admin(auditlog.Admin(auditlog.ActionWebhookRedeliver, webhook.RedeliverHandler())))
+	mux.Handle("/admin/webhooks/dead-letters", admin(webhook.DeadLettersHandler()))
+	return admin
+}
+
+// Создаёт middleware, пропускающее только доверенного вызывающего: администратора
+// или внутренний сервис со scope, на любом адресе, где обслуживается маршрут.
+//
+// Запрос принимается с одним из токенов admin.tokens в заголовке
+// Authorization: Bearer или, при включённом mTLS, с клиентским сертификатом,
+// которому разрешён scope. Без токена и mTLS запрос получает
+// 401 Unauthorized с кодом code; при включённом mTLS ответы те же,
+// что у mtls.Authorizer.Middleware.
+//
+// Принимает:
+// - log: указатель на logger для логирования событий.
+// - cfg: ссылка на конфигурацию приложения.
+// - scope: scope клиентского сертификата (mtls.ScopeAdmin, mtls.ScopeTokensIssue).
+// - code: код ошибки ответа без учётных данных.
+//
+// Возвращает:
+// - функцию, оборачивающую обработчик.
+func trustedCaller(log *slog.Logger, cfg *config.Config, scope, code string) func(http.Handler) http.Handler {
+	var requireCertificate func(http.Handler) http.Handler
+	if cfg.MTLS.Enabled {
+		authorizer, err := Authorizer(cfg)
+		if err != nil {
+			log.Error("Invalid mTLS identities, client certificates are rejected", slog.String("scope", scope), slog.String("error", err.Error()))
+			authorizer, _ = mtls.NewAuthorizer("", nil)
+		}
+		requireCertificate = authorizer.Middleware(scope)
+	}
+
+	tokens := make([][]byte, 0, len(cfg.Admin.Tokens))
+	for _, token := range cfg.Admin.Tokens {
+		if token != "" {
+			tokens = append(tokens, []byte(token))
+		}
+	}
+	validToken := func(r *http.Request) bool {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || presented == "" {
+			return false
+		}
+		for _, token := range tokens {
+			if subtle.ConstantTimeCompare([]byte(presented), token) == 1 {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		certificate := next
+		if requireCertificate != nil {
+			certificate = requireCertificate(next)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case validToken(r):
+				next.ServeHTTP(w, r)
+			case requireCertificate != nil:
+				certificate.ServeHTTP(w, r)
+			default:
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				i18n.Error(w, r, code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// Возвращает middleware, применяемые к группе маршрутов согласно конфигурации.
+//
+// Принимает:
+// - log: логгер для записей о запросах.
+// - cfg: ссылка на конфигурацию приложения.
+// - group: имя группы маршрутов (GroupAPI, GroupOps).
+// - server: общее для всех групп ограничение одновременных запросов (nil — без ограничения).
+//
+// Возвращает:
+// - функцию, оборачивающую обработчик маршрута группы.
+func groupMiddleware(log *slog.Logger, cfg *config.Config, group string, server *httpmw.Limiter) func(http.Handler) http.Handler {
+	// Служебные маршруты (/metrics, /readyz) опрашиваются часто, поэтому
+	// записываются только на уровне DEBUG.
+	level := slog.LevelInfo
+	if group == GroupOps {
+		level = slog.LevelDebug
+	}
+
+	// Идентификатор назначается и спан запроса начинается первыми, чтобы в лог
+	// и трассировку попадали и запросы, отклонённые ограничением нагрузки.
+	chain := []func(http.Handler) http.Handler{httpmw.RequestLog(log, level), tracing.Middleware, auditlog.Middleware}
+
+	shedding := cfg.HTTPServer.LoadShedding
+	if server != nil {
+		chain = append(chain, httpmw.LimitConcurrency(server, shedding.RetryAfter))
+	}
+	if max := shedding.Groups[group]; max > 0 {
+		chain = append(chain, httpmw.LimitConcurrency(httpmw.NewLimiter(group, max), shedding.RetryAfter))
+	}
+
+	compression := cfg.HTTPServer.Compression
+	if compression.Enabled && slices.Contains(compression.Groups, group) {
+		chain = append(chain, httpmw.Compress(compression.MinSize))
+	}
+
+	return func(h http.Handler) http.Handler {
+		for i := len(chain) - 1; i >= 0; i-- {
+			h = chain[i](h)
+		}
+		return h
+	}
+}
+
+// Возвращает маршруты версии v1.
+func v1Routes(log *slog.Logger, cfg *config.Config, svc *auth.Service) []Route {
+	// Токены по user_id без пароля выдаются только доверенным сервисам
+	// (как IssueTokens в gRPC) и администратору; пользователи входят через /auth/login.
+	requireIssuer := trustedCaller(log, cfg, mtls.ScopeTokensIssue, "issuer_credentials_required")
+	return []Route{
+		{Path: "/auth/tokens", Handler: usage.Middleware(usage.OperationIssue, requireIssuer(maintenance.Middleware(ratelimit.Middleware(quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			GenerateTokensHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		}))))))},
+		{Path: "/auth/login", Handler: usage.Middleware(usage.OperationLogin, maintenance.Middleware(ratelimit.Middleware(quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			LoginHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		})))))},
+		{Path: "/auth/refresh", Handler: usage.Middleware(usage.OperationRefresh, maintenance.Middleware(ratelimit.Middleware(quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			RefreshTokensHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		})))))},
+		// Выход, отзыв, список сессий и история входов работают и в режиме обслуживания.
+		{Path: "/auth/logout", Handler: usage.Middleware(usage.OperationRevoke, quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			LogoutHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		})))},
+		{Path: "/auth/logout_all", Handler: usage.Middleware(usage.OperationRevoke, quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			LogoutAllHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		})))},
+		{Path: "/auth/revoke", Handler: usage.Middleware(usage.OperationRevoke, quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			RevokeAccessTokenHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		})))},
+		{Path: "/auth/sessions", Handler: usage.Middleware(usage.OperationSessions, quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ListSessionsHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		})))},
+		{Path: "/auth/history", Handler: usage.Middleware(usage.OperationSessions, quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			LoginHistoryHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		})))},
+		{Path: "/auth/sessions/{id}", Handler: usage.Middleware(usage.OperationRevoke, quota.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			DeleteSessionHandler(w, r, httpmw.RequestLogger(r.Context(), log), cfg, svc)
+		})))},
+	}
+}
+
+// Регистрирует маршруты версий API.
+//
+// Принимает:
+// - mux: маршрутизатор.
+// - wrap: middleware группы маршрутов API.
+// - versions: версии API.
+func mountVersions(mux *http.ServeMux, wrap func(http.Handler) http.Handler, versions ...APIVersion) {
+	for _, version := range versions {
+		for _, route := range version.Routes {
+			handler := route.Handler
+			if version.Deprecated {
+				handler = deprecatedRoute(handler, version)
+			}
+			mux.Handle(version.Prefix+route.Path, wrap(handler))
+		}
+	}
+}
+
+// Помечает ответы маршрута устаревшей версии; ссылка на актуальный путь
+// строится по пути запроса, чтобы в ней были значения параметров ({id}).
+func deprecatedRoute(next http.Handler, version APIVersion) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := ""
+		if version.Successor != "" {
+			successor = version.Successor + strings.TrimPrefix(r.URL.Path, version.Prefix)
+		}
+		Deprecated(next, successor).ServeHTTP(w, r)
+	})
+}
+
+// Помечает ответы обработчика как устаревшие.
+//
+// Добавляет заголовок Deprecation и, если задан successor, ссылку на
+// актуальный путь (Link: <successor>; rel="successor-version").
+//
+// Принимает:
+// - next: обработчик устаревшего маршрута.
+// - successor: путь, на который следует перейти клиентам.
+//
+// Возвращает:
+// - http.Handler.
+func Deprecated(next http.Handler, successor string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if successor != "" {
+			w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
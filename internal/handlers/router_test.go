@@ -0,0 +1,409 @@
+package handlers_test
+
+import (
+	"auth_service/internal/accounts"
+	"auth_service/internal/analytics"
+	"auth_service/internal/auditlog"
+	"auth_service/internal/config"
+	"auth_service/internal/handlers"
+	"auth_service/internal/health"
+	"auth_service/internal/jwks"
+	"auth_service/internal/maintenance"
+	"auth_service/internal/mtls"
+	"auth_service/internal/openapi"
+	"auth_service/internal/quota"
+	"auth_service/internal/revocation"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/storage/memory"
+	"auth_service/internal/usage"
+	"auth_service/internal/webhook"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	_ "net/http/pprof"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openAPISpec struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) openAPISpec {
+	t.Helper()
+
+	var spec openAPISpec
+	require.NoError(t, json.Unmarshal(openapi.Spec(), &spec))
+	require.True(t, strings.HasPrefix(spec.OpenAPI, "3."))
+	return spec
+}
+
+func newRouter() *http.ServeMux {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
+	cfg := &config.Config{JWTSecret: "test_secret", Admin: config.Admin{Tokens: []string{adminToken}}}
+	return handlers.NewRouter(logger, cfg, newService(cfg, NewMockStorage()))
+}
+
+// Проверка соответствия путей спецификации маршрутам сервиса.
+func TestOpenAPI_PathsMatchRoutes(t *testing.T) {
+	spec := loadSpec(t)
+	router := newRouter()
+
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			req := httptest.NewRequest(strings.ToUpper(method), path, nil)
+			_, pattern := router.Handler(req)
+			assert.Equal(t, path, pattern, "%s %s is documented but not routed", method, path)
+		}
+	}
+}
+
+// Проверка соответствия схемы TokenResponse структуре ответа.
+func TestOpenAPI_TokenResponseSchema(t *testing.T) {
+	spec := loadSpec(t)
+
+	var fields []string
+	typ := reflect.TypeOf(handlers.TokenResponse{})
+	for i := 0; i < typ.NumField(); i++ {
+		fields = append(fields, strings.Split(typ.Field(i).Tag.Get("json"), ",")[0])
+	}
+
+	var properties []string
+	for name := range spec.Components.Schemas["TokenResponse"].Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(fields)
+	sort.Strings(properties)
+	assert.Equal(t, fields, properties)
+}
+
+// Проверка соответствия схем ответам служебных маршрутов.
+func TestOpenAPI_AdminSchemas(t *testing.T) {
+	spec := loadSpec(t)
+
+	for schema, value := range map[string]any{
+		"LoginRequest":         handlers.LoginRequest{},
+		"RefreshRequest":       handlers.RefreshRequest{},
+		"LogoutAllResponse":    handlers.LogoutAllResponse{},
+		"SessionsResponse":     handlers.SessionsResponse{},
+		"Session":              handlers.SessionResponse{},
+		"Device":               handlers.DeviceResponse{},
+		"LoginHistoryResponse": handlers.LoginHistoryResponse{},
+		"LoginHistoryEntry":    handlers.LoginHistoryEntry{},
+		"JWKS":                 jwks.Document{},
+		"JWK":                  jwks.Key{},
+		"UsageRow":             usage.Row{},
+		"DailyStats":           analytics.Row{},
+		"AuditPage":            auditlog.Page{},
+		"AuditRecord":          auditlog.Entry{},
+		"QuotaLimits":          quota.Limits{},
+		"QuotaReport":          quota.Report{},
+		"WebhookDelivery":      webhook.Delivery{},
+		"MaintenanceState":     maintenance.State{},
+		"ReadinessReport":      health.Report{},
+		"DependencyStatus":     health.Dependency{},
+		"RevocationRequest":    revocation.Request{},
+		"RevocationResult":     revocation.Response{},
+		"AccountStatus":        accounts.Status{},
+	} {
+		var fields []string
+		typ := reflect.TypeOf(value)
+		for i := 0; i < typ.NumField(); i++ {
+			fields = append(fields, strings.Split(typ.Field(i).Tag.Get("json"), ",")[0])
+		}
+
+		var properties []string
+		for name := range spec.Components.Schemas[schema].Properties {
+			properties = append(properties, name)
+		}
+		sort.Strings(fields)
+		sort.Strings(properties)
+		assert.Equal(t, fields, properties, schema)
+	}
+}
+
+// Проверка отдачи спецификации и Swagger UI.
+func TestOpenAPI_Endpoints(t *testing.T) {
+	router := newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.True(t, json.Valid(rr.Body.Bytes()))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "/openapi.json")
+}
+
+// Проверка недоступности профилей через основной HTTP API: они
+// отдаются только служебным сервером (debug_server).
+func TestRouter_NoProfiling(t *testing.T) {
+	router := newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pprof/heap", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// Проверка переноса служебных маршрутов на отдельный адрес.
+func TestRouter_OpsServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{
+		JWTSecret: "test_secret",
+		OpsServer: config.OpsServer{Address: "localhost:8081"},
+		Admin:     config.Admin{Tokens: []string{adminToken}},
+	}
+	router := handlers.NewRouter(logger, cfg, newService(cfg, NewMockStorage()))
+	ops := handlers.NewOpsRouter(logger, cfg)
+
+	serve := func(h http.Handler, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for _, path := range []string{"/metrics", "/openapi.json", "/admin/maintenance"} {
+		assert.Equal(t, http.StatusNotFound, serve(router, path), path)
+		assert.Equal(t, http.StatusOK, serve(ops, path), path)
+	}
+	assert.Equal(t, http.StatusOK, serve(router, "/.well-known/jwks.json"))
+	_, pattern := router.Handler(httptest.NewRequest(http.MethodPost, "/api/v1/auth/tokens", nil))
+	assert.Equal(t, "/api/v1/auth/tokens", pattern)
+	_, pattern = ops.Handler(httptest.NewRequest(http.MethodPost, "/api/v1/auth/tokens", nil))
+	assert.Empty(t, pattern)
+
+	// Профили отдаются только при включённом ops_server.pprof.
+	assert.Equal(t, http.StatusNotFound, serve(ops, "/debug/pprof/"))
+	cfg.OpsServer.PProf = true
+	assert.Equal(t, http.StatusOK, serve(handlers.NewOpsRouter(logger, cfg), "/debug/pprof/"))
+}
+
+// Токен администратора в тестах маршрутов /admin/*.
+const adminToken = "test-admin-token"
+
+// Создаёт запрос выдачи токенов от доверенного вызывающего (с токеном администратора).
+func issueRequest(target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	return req
+}
+
+// Проверка обязательной аутентификации администратора на маршрутах /admin/*,
+// в том числе на адресе API при настройках по умолчанию.
+func TestRouter_AdminAuth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+
+	request := func(router http.Handler, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/users/"+userID+"/disable", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Без токенов администратора и mTLS маршруты недоступны никому.
+	cfg := &config.Config{JWTSecret: "test_secret"}
+	router := handlers.NewRouter(logger, cfg, newService(cfg, NewMockStorage()))
+	rr := request(router, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "admin_credentials_required", rr.Header().Get("X-Error-Code"))
+	assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, request(router, "Bearer ").Code)
+
+	cfg.Admin.Tokens = []string{adminToken}
+	router = handlers.NewRouter(logger, cfg, newService(cfg, NewMockStorage()))
+	assert.Equal(t, http.StatusUnauthorized, request(router, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(router, "Bearer wrong-token").Code)
+	assert.NotEqual(t, http.StatusUnauthorized, request(router, "Bearer "+adminToken).Code)
+
+	// При включённом mTLS запрос без токена проверяется по сертификату.
+	cfg.MTLS.Enabled = true
+	ops := handlers.NewOpsRouter(logger, cfg)
+	rr = request(ops, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "client_certificate_required", rr.Header().Get("X-Error-Code"))
+	assert.NotEqual(t, http.StatusUnauthorized, request(ops, "Bearer "+adminToken).Code)
+}
+
+// Проверка того, что токены по user_id выдаются только доверенному вызывающему:
+// с токеном администратора или сертификатом со scope tokens:issue.
+func TestRouter_TokensRequireTrustedCaller(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	storage := NewMockStorage()
+	storage.CreateUser(userID)
+
+	request := func(router http.Handler, path, authorization string, cert *x509.Certificate) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path+"?user_id="+userID, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	cfg := &config.Config{JWTSecret: "test_secret", Admin: config.Admin{Tokens: []string{adminToken}}}
+	router := handlers.NewRouter(logger, cfg, newService(cfg, storage))
+	for _, path := range []string{"/api/v1/auth/tokens", "/auth/tokens"} {
+		rr := request(router, path, "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, path)
+		assert.Equal(t, "issuer_credentials_required", rr.Header().Get("X-Error-Code"), path)
+		assert.Equal(t, http.StatusUnauthorized, request(router, path, "Bearer wrong-token", nil).Code, path)
+		assert.Equal(t, http.StatusOK, request(router, path, "Bearer "+adminToken, nil).Code, path)
+	}
+
+	// При включённом mTLS сервису нужен сертификат со scope tokens:issue.
+	cfg.MTLS.Enabled = true
+	cfg.MTLS.Identities = map[string][]string{
+		"issuer":    {mtls.ScopeTokensIssue},
+		"validator": {mtls.ScopeTokensValidate},
+	}
+	router = handlers.NewRouter(logger, cfg, newService(cfg, storage))
+	rr := request(router, "/api/v1/auth/tokens", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "client_certificate_required", rr.Header().Get("X-Error-Code"))
+	validator := &x509.Certificate{Subject: pkix.Name{CommonName: "validator"}}
+	assert.Equal(t, http.StatusForbidden, request(router, "/api/v1/auth/tokens", "", validator).Code)
+	issuer := &x509.Certificate{Subject: pkix.Name{CommonName: "issuer"}}
+	assert.Equal(t, http.StatusOK, request(router, "/api/v1/auth/tokens", "", issuer).Code)
+}
+
+// Массовый отзыв сессий, запоминающий вызовы.
+type recordingRevoker struct {
+	calls int
+}
+
+func (r *recordingRevoker) RevokeSessions(context.Context, auth.RevocationFilter, int) (auth.RevocationResult, error) {
+	r.calls++
+	return auth.RevocationResult{}, nil
+}
+
+// Проверка того, что массовый отзыв сессий на адресе API с настройками по
+// умолчанию недоступен без учётных данных администратора.
+func TestRouter_SessionsRevokeRequiresAdmin(t *testing.T) {
+	revoker := &recordingRevoker{}
+	revocation.Set(revoker, 0)
+	t.Cleanup(func() { revocation.Set(nil, 0) })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{JWTSecret: "test_secret", Admin: config.Admin{Tokens: []string{adminToken}}}
+	router := handlers.NewRouter(logger, cfg, newService(cfg, NewMockStorage()))
+
+	revoke := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/sessions/revoke", strings.NewReader(`{"issued_before": "2099-01-01T00:00:00Z"}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, revoke(""))
+	assert.Equal(t, http.StatusUnauthorized, revoke("Bearer wrong-token"))
+	assert.Zero(t, revoker.calls)
+
+	assert.Equal(t, http.StatusOK, revoke("Bearer "+adminToken))
+	assert.Equal(t, 1, revoker.calls)
+}
+
+// Проверка того, что режим обслуживания на адресе API с настройками по
+// умолчанию не включается без учётных данных администратора.
+func TestRouter_MaintenanceRequiresAdmin(t *testing.T) {
+	t.Cleanup(func() { _ = maintenance.Set(maintenance.State{}) })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{JWTSecret: "test_secret", Admin: config.Admin{Tokens: []string{adminToken}}}
+	router := handlers.NewRouter(logger, cfg, newService(cfg, NewMockStorage()))
+
+	enable := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodPut, "/admin/maintenance", strings.NewReader(`{"enabled": true}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, enable(""))
+	assert.False(t, maintenance.Current().Enabled)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/auth/refresh", nil))
+	assert.NotEqual(t, http.StatusServiceUnavailable, rr.Code)
+
+	assert.Equal(t, http.StatusOK, enable("Bearer "+adminToken))
+	assert.True(t, maintenance.Current().Enabled)
+}
+
+// Проверка заголовков устаревших путей без префикса версии.
+func TestRouter_LegacyPathsDeprecated(t *testing.T) {
+	router := newRouter()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, issueRequest("/api/v1/auth/tokens"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Empty(t, rr.Header().Get("Deprecation"))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, issueRequest("/auth/tokens"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v1/auth/tokens>; rel="successor-version"`, rr.Header().Get("Link"))
+
+	// Ссылка на актуальный путь содержит значения параметров пути.
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/auth/sessions/123e4567-e89b-12d3-a456-426614174000", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, `</api/v1/auth/sessions/123e4567-e89b-12d3-a456-426614174000>; rel="successor-version"`, rr.Header().Get("Link"))
+}
+
+func BenchmarkGenerateTokensHandler(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
+	cfg := &config.Config{JWTSecret: "test_secret", Admin: config.Admin{Tokens: []string{adminToken}}}
+	db := memory.NewMemoryStorage()
+	userID := "123e4567-e89b-12d3-a456-426614174000"
+	db.CreateUser(userID, "test@example.com")
+	router := handlers.NewRouter(logger, cfg, newService(cfg, db))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, issueRequest("/api/v1/auth/tokens?user_id="+userID))
+		if rr.Code != http.StatusOK {
+			b.Fatalf("unexpected status %d", rr.Code)
+		}
+	}
+}
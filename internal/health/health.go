@@ -0,0 +1,188 @@
+// Пакет health проверяет готовность сервиса к обработке запросов.
+//
+// GET /readyz (см. Handler) проверяет все зависимости сервиса (PostgreSQL,
+// Redis и т.п.) и отвечает 200 OK, если все они доступны, и 503 Service
+// Unavailable, если хотя бы одна недоступна. Тело ответа содержит состояние
+// каждой зависимости: результат и длительность проверки и последнюю ошибку,
+// чтобы было видно, какая именно зависимость ухудшает работу сервиса.
+package health
+
+import (
+	"auth_service/internal/metrics"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var checkFailures = metrics.NewCounterVec(
+	"auth_dependency_check_failures_total",
+	"Number of failed readiness checks, by dependency.",
+	"dependency",
+)
+
+// Состояния зависимости и сервиса.
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Проверка зависимости.
+type Check struct {
+	// Имя зависимости в отчёте, например postgres.
+	Name string
+	// Проверяет доступность зависимости; ошибка означает, что она недоступна.
+	Probe func(ctx context.Context) error
+}
+
+// Состояние зависимости.
+type Dependency struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Длительность последней проверки в миллисекундах.
+	LatencyMS float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Последняя ошибка проверки, в том числе если зависимость с тех пор
+	// восстановилась; пусто, если проверки не завершались ошибкой.
+	LastError   string     `json:"last_error"`
+	LastErrorAt *time.Time `json:"last_error_at"`
+}
+
+// Отчёт о готовности сервиса.
+type Report struct {
+	// up, если все зависимости доступны, иначе down.
+	Status       string       `json:"status"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// Последняя ошибка проверки зависимости.
+type failure struct {
+	err string
+	at  time.Time
+}
+
+var (
+	mu       sync.Mutex
+	checks   []Check
+	timeout  time.Duration
+	failures = make(map[string]failure)
+)
+
+// Задаёт проверяемые зависимости.
+//
+// Принимает:
+// - checkTimeout: время ожидания проверки одной зависимости; 0 — без ограничения.
+// - cs: проверки зависимостей.
+func SetChecks(checkTimeout time.Duration, cs ...Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks = cs
+	timeout = checkTimeout
+	failures = make(map[string]failure)
+}
+
+// Проверяет все зависимости одновременно.
+//
+// Принимает:
+// - ctx: контекст выполнения.
+//
+// Возвращает:
+// - отчёт о готовности; зависимости перечислены в порядке SetChecks.
+func Run(ctx context.Context) Report {
+	mu.Lock()
+	cs, checkTimeout := checks, timeout
+	mu.Unlock()
+
+	report := Report{Status: StatusUp, Dependencies: make([]Dependency, len(cs))}
+	var wg sync.WaitGroup
+	for i, check := range cs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Dependencies[i] = run(ctx, check, checkTimeout)
+		}()
+	}
+	wg.Wait()
+
+	for _, dependency := range report.Dependencies {
+		if dependency.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// Проверяет зависимость и запоминает ошибку проверки.
+func run(ctx context.Context, check Check, checkTimeout time.Duration) Dependency {
+	if checkTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, checkTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := probe(ctx, check.Probe)
+	elapsed := time.Since(start)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		checkFailures.Inc(check.Name)
+		failures[check.Name] = failure{err: err.Error(), at: start}
+	}
+
+	dependency := Dependency{
+		Name:      check.Name,
+		Status:    StatusUp,
+		LatencyMS: float64(elapsed.Microseconds()) / 1000,
+		CheckedAt: start,
+	}
+	if err != nil {
+		dependency.Status = StatusDown
+	}
+	if f, ok := failures[check.Name]; ok {
+		at := f.at
+		dependency.LastError, dependency.LastErrorAt = f.err, &at
+	}
+	return dependency
+}
+
+// Выполняет проверку, не дожидаясь её дольше, чем позволяет ctx: проверка,
+// не учитывающая контекст, не задерживает ответ.
+func probe(ctx context.Context, p func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- p(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.New("check timed out")
+	}
+}
+
+// Создаёт обработчик /readyz.
+//
+// GET проверяет зависимости и возвращает Report: 200 OK, если все зависимости
+// доступны, и 503 Service Unavailable в противном случае.
+//
+// Возвращает:
+// - http.Handler.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := Run(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusUp {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка отчёта о готовности при доступных и недоступных зависимостях.
+func TestHandler(t *testing.T) {
+	redisErr := errors.New("dial tcp: connection refused")
+	t.Cleanup(func() { SetChecks(0) })
+	SetChecks(time.Second,
+		Check{Name: "postgres", Probe: func(context.Context) error { return nil }},
+		Check{Name: "redis", Probe: func(context.Context) error { return redisErr }},
+	)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var report Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, StatusDown, report.Status)
+	require.Len(t, report.Dependencies, 2)
+	assert.Equal(t, "postgres", report.Dependencies[0].Name)
+	assert.Equal(t, StatusUp, report.Dependencies[0].Status)
+	assert.Empty(t, report.Dependencies[0].LastError)
+	assert.Nil(t, report.Dependencies[0].LastErrorAt)
+	assert.Equal(t, StatusDown, report.Dependencies[1].Status)
+	assert.Equal(t, redisErr.Error(), report.Dependencies[1].LastError)
+	assert.NotNil(t, report.Dependencies[1].LastErrorAt)
+
+	// После восстановления зависимости последняя ошибка сохраняется в отчёте.
+	redisErr = nil
+	SetChecks(time.Second,
+		Check{Name: "redis", Probe: func(context.Context) error { return redisErr }},
+	)
+	failures["redis"] = failure{err: "connection refused", at: time.Now()}
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Equal(t, StatusUp, report.Dependencies[0].Status)
+	assert.Equal(t, "connection refused", report.Dependencies[0].LastError)
+}
+
+// Проверка ограничения времени проверки зависимости.
+func TestRun_Timeout(t *testing.T) {
+	t.Cleanup(func() { SetChecks(0) })
+	block := make(chan struct{})
+	defer close(block)
+	SetChecks(10*time.Millisecond, Check{Name: "smtp", Probe: func(context.Context) error {
+		<-block
+		return nil
+	}})
+
+	report := Run(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "check timed out", report.Dependencies[0].LastError)
+}
+
+// Проверка ответа на неподдерживаемый метод.
+func TestHandler_MethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/readyz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodGet, rec.Header().Get("Allow"))
+}
@@ -0,0 +1,211 @@
+// Пакет httpmw содержит HTTP middleware сервиса.
+package httpmw
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	flateWriters = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return w
+	}}
+)
+
+// Создаёт middleware, сжимающее ответы gzip или deflate.
+//
+// Кодировка выбирается по заголовку Accept-Encoding (gzip предпочтительнее
+// при равных весах). Ответы меньше minSize байт, а также ответы, уже имеющие
+// Content-Encoding, отправляются без сжатия.
+//
+// Принимает:
+// - minSize: минимальный размер тела ответа для сжатия.
+//
+// Возвращает:
+// - middleware вида func(http.Handler) http.Handler.
+func Compress(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// Выбирает кодировку из Accept-Encoding с учётом q-значений.
+//
+// Принимает:
+// - header: значение заголовка Accept-Encoding.
+//
+// Возвращает:
+// - gzip, deflate или пустую строку, если сжатие не принимается.
+func negotiateEncoding(header string) string {
+	weights := make(map[string]float64, 2)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch name {
+		case encodingGzip, encodingDeflate:
+			weights[name] = q
+		case "*":
+			wildcard = q
+		}
+	}
+
+	// "*" относится только к кодировкам, не перечисленным явно.
+	for _, name := range []string{encodingGzip, encodingDeflate} {
+		if _, ok := weights[name]; !ok && wildcard >= 0 {
+			weights[name] = wildcard
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range []string{encodingGzip, encodingDeflate} {
+		if q := weights[name]; q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// ResponseWriter, накапливающий первые minSize байт ответа, чтобы решить, сжимать ли его.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	// Решение принято: ответ либо сжимается (compressor != nil), либо идёт как есть.
+	decided    bool
+	compressor io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	cw.wroteHeader = true
+	if cw.decided {
+		if cw.compressor != nil {
+			return cw.compressor.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf.Write(p)
+	if cw.buf.Len() >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Отправляет заголовки и накопленные данные, начиная сжатие, если compress и ответ это допускает.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	header := cw.Header()
+
+	if compress && header.Get("Content-Encoding") == "" && bodyAllowed(cw.status) {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		cw.compressor = cw.newCompressor()
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.compressor != nil {
+		_, err = cw.compressor.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+func (cw *compressWriter) newCompressor() io.WriteCloser {
+	if cw.encoding == encodingDeflate {
+		fw := flateWriters.Get().(*flate.Writer)
+		fw.Reset(cw.ResponseWriter)
+		return fw
+	}
+	gw := gzipWriters.Get().(*gzip.Writer)
+	gw.Reset(cw.ResponseWriter)
+	return gw
+}
+
+// Завершает ответ: отправляет несжатый остаток или дописывает сжатый поток.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		return cw.decide(false)
+	}
+	if cw.compressor == nil {
+		return nil
+	}
+
+	err := cw.compressor.Close()
+	switch c := cw.compressor.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(c)
+	case *flate.Writer:
+		flateWriters.Put(c)
+	}
+	cw.compressor = nil
+	return err
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Сообщает, может ли ответ с этим статусом иметь тело.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,85 @@
+package httpmw_test
+
+import (
+	"auth_service/internal/httpmw"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveCompressed(t *testing.T, body string, acceptEncoding string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	handler := httpmw.Compress(64)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "999")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// Проверка выбора кодировки по Accept-Encoding.
+func TestCompress_Negotiation(t *testing.T) {
+	body := strings.Repeat(`{"session":"value"},`, 20)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		encoding       string
+	}{
+		{name: "No header", acceptEncoding: "", encoding: ""},
+		{name: "Gzip", acceptEncoding: "gzip", encoding: "gzip"},
+		{name: "Deflate", acceptEncoding: "deflate", encoding: "deflate"},
+		{name: "Gzip preferred on tie", acceptEncoding: "deflate, gzip", encoding: "gzip"},
+		{name: "Q-values", acceptEncoding: "gzip;q=0.5, deflate;q=0.8", encoding: "deflate"},
+		{name: "Wildcard", acceptEncoding: "*", encoding: "gzip"},
+		{name: "Explicit refusal beats wildcard", acceptEncoding: "gzip;q=0, *", encoding: "deflate"},
+		{name: "Identity only", acceptEncoding: "identity", encoding: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveCompressed(t, body, tt.acceptEncoding)
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			assert.Equal(t, tt.encoding, rr.Header().Get("Content-Encoding"))
+			assert.Contains(t, rr.Header().Values("Vary"), "Accept-Encoding")
+
+			var reader io.Reader = rr.Body
+			switch tt.encoding {
+			case "gzip":
+				assert.Empty(t, rr.Header().Get("Content-Length"))
+				gr, err := gzip.NewReader(rr.Body)
+				require.NoError(t, err)
+				reader = gr
+			case "deflate":
+				reader = flate.NewReader(rr.Body)
+			}
+			decoded, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, body, string(decoded))
+		})
+	}
+}
+
+// Проверка, что маленькие ответы не сжимаются.
+func TestCompress_SkipsSmallBodies(t *testing.T) {
+	rr := serveCompressed(t, `{"ok":true}`, "gzip")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, `{"ok":true}`, rr.Body.String())
+}
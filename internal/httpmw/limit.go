@@ -0,0 +1,94 @@
+package httpmw
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/internal/metrics"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var shedRequests = metrics.NewCounterVec(
+	"auth_http_requests_shed_total",
+	"Number of HTTP requests rejected because the in-flight limit was reached.",
+	"scope",
+)
+
+// Ограничение числа одновременно обрабатываемых запросов.
+//
+// Один Limiter может использоваться несколькими middleware, чтобы
+// ограничение было общим для нескольких групп маршрутов.
+type Limiter struct {
+	name  string
+	slots chan struct{}
+}
+
+// Создаёт Limiter.
+//
+// Принимает:
+// - name: имя ограничения для метрик (например, server или api).
+// - max: максимальное число одновременно обрабатываемых запросов.
+//
+// Возвращает:
+// - указатель на Limiter.
+func NewLimiter(name string, max int) *Limiter {
+	return &Limiter{name: name, slots: make(chan struct{}, max)}
+}
+
+// Занимает место для запроса без ожидания.
+//
+// Возвращает:
+// - false, если все места заняты.
+func (l *Limiter) TryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Освобождает место, занятое TryAcquire.
+func (l *Limiter) Release() {
+	<-l.slots
+}
+
+// Возвращает число обрабатываемых сейчас запросов.
+func (l *Limiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Создаёт middleware, отклоняющее запросы сверх ограничения.
+//
+// Запрос, для которого нет свободного места, не ждёт в очереди, а сразу
+// получает 503 Service Unavailable с заголовком Retry-After, чтобы во время
+// всплеска нагрузки задержки и потребление памяти не росли неограниченно.
+//
+// Принимает:
+// - limiter: ограничение числа запросов.
+// - retryAfter: значение Retry-After (округляется вверх до секунд).
+//
+// Возвращает:
+// - middleware вида func(http.Handler) http.Handler.
+func LimitConcurrency(limiter *Limiter, retryAfter time.Duration) func(http.Handler) http.Handler {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	retryAfterValue := strconv.Itoa(seconds)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.TryAcquire() {
+				shedRequests.Inc(limiter.name)
+				w.Header().Set("Retry-After", retryAfterValue)
+				i18n.Error(w, r, "server_overloaded", http.StatusServiceUnavailable)
+				return
+			}
+			defer limiter.Release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
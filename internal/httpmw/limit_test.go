@@ -0,0 +1,53 @@
+package httpmw_test
+
+import (
+	"auth_service/internal/httpmw"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Проверка отклонения запросов сверх ограничения и освобождения мест.
+func TestLimitConcurrency(t *testing.T) {
+	limiter := httpmw.NewLimiter("test", 2)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	handler := httpmw.LimitConcurrency(limiter, 1500*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, serve().Code)
+		}()
+		<-started
+	}
+	assert.Equal(t, 2, limiter.InFlight())
+
+	rr := serve()
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 0, limiter.InFlight())
+
+	go func() { <-started }()
+	assert.Equal(t, http.StatusOK, serve().Code)
+}
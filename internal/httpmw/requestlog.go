@@ -0,0 +1,130 @@
+package httpmw
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Заголовок с идентификатором запроса.
+const RequestIDHeader = "X-Request-ID"
+
+// Наибольшая длина идентификатора запроса, принимаемого от клиента.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// Создаёт middleware, назначающее запросу идентификатор и записывающее
+// запрос в лог после ответа.
+//
+// Идентификатор берётся из заголовка X-Request-ID, если его передал клиент
+// или прокси (не длиннее 128 символов из букв, цифр и знаков -_.:), иначе
+// создаётся новый UUID. Он возвращается в заголовке ответа и доступен
+// обработчикам через RequestIDFrom и RequestLogger.
+//
+// Запись содержит метод, путь, шаблон маршрута, код ответа, длительность и
+// размер тела ответа в байтах.
+//
+// Принимает:
+// - log: логгер для записей о запросах.
+// - level: уровень записей; ответы 5xx записываются с уровнем не ниже WARN.
+//
+// Возвращает:
+// - функцию, оборачивающую обработчик маршрута.
+func RequestLog(log *slog.Logger, level slog.Level) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			lw := &logWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+
+			recordLevel := level
+			if lw.status >= http.StatusInternalServerError && recordLevel < slog.LevelWarn {
+				recordLevel = slog.LevelWarn
+			}
+			log.LogAttrs(r.Context(), recordLevel, "HTTP request",
+				slog.String("request_id", id),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", r.Pattern),
+				slog.Int("status", lw.status),
+				slog.Duration("duration", time.Since(start)),
+				slog.Int64("bytes", lw.bytes),
+			)
+		})
+	}
+}
+
+// Сообщает, что идентификатор запроса от клиента можно принять: он не
+// пуст, не слишком длинный и не может исказить записи лога.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// Возвращает идентификатор запроса из контекста (см. RequestLog) или пустую строку.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Возвращает логгер, добавляющий к записям идентификатор запроса из
+// контекста, чтобы все записи одного запроса можно было найти вместе.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - log: исходный логгер.
+//
+// Возвращает:
+// - логгер с атрибутом request_id или log, если идентификатора нет.
+func RequestLogger(ctx context.Context, log *slog.Logger) *slog.Logger {
+	if id := RequestIDFrom(ctx); id != "" {
+		return log.With(slog.String("request_id", id))
+	}
+	return log
+}
+
+// http.ResponseWriter, запоминающий код ответа и размер тела.
+type logWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (lw *logWriter) WriteHeader(status int) {
+	if !lw.wroteHeader {
+		lw.status, lw.wroteHeader = status, true
+	}
+	lw.ResponseWriter.WriteHeader(status)
+}
+
+func (lw *logWriter) Write(p []byte) (int, error) {
+	lw.wroteHeader = true
+	n, err := lw.ResponseWriter.Write(p)
+	lw.bytes += int64(n)
+	return n, err
+}
+
+// Возвращает исходный ResponseWriter (для http.ResponseController).
+func (lw *logWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
@@ -0,0 +1,83 @@
+package httpmw_test
+
+import (
+	"auth_service/internal/httpmw"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка назначения идентификатора запроса и записи запроса в лог.
+func TestRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	handler := httpmw.RequestLog(log, slog.LevelInfo)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpmw.RequestLogger(r.Context(), log).Info("Handling")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	serve := func(id string) (*httptest.ResponseRecorder, []map[string]any) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/auth/tokens", nil)
+		if id != "" {
+			req.Header.Set(httpmw.RequestIDHeader, id)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &record))
+			records = append(records, record)
+		}
+		return rr, records
+	}
+
+	// Идентификатор клиента сохраняется и попадает во все записи запроса.
+	rr, records := serve("req-42")
+	assert.Equal(t, "req-42", rr.Header().Get(httpmw.RequestIDHeader))
+	require.Len(t, records, 2)
+	assert.Equal(t, "Handling", records[0]["msg"])
+	assert.Equal(t, "req-42", records[0]["request_id"])
+	assert.Equal(t, "HTTP request", records[1]["msg"])
+	assert.Equal(t, "req-42", records[1]["request_id"])
+	assert.Equal(t, "POST", records[1]["method"])
+	assert.Equal(t, "/auth/tokens", records[1]["path"])
+	assert.EqualValues(t, http.StatusCreated, records[1]["status"])
+	assert.EqualValues(t, 5, records[1]["bytes"])
+
+	// Без идентификатора и с недопустимым идентификатором создаётся новый.
+	for _, id := range []string{"", "bad id\n", strings.Repeat("a", 129)} {
+		rr, records = serve(id)
+		generated := rr.Header().Get(httpmw.RequestIDHeader)
+		assert.NoError(t, uuid.Validate(generated))
+		assert.Equal(t, generated, records[1]["request_id"])
+	}
+}
+
+// Проверка повышения уровня записи для ответов 5xx.
+func TestRequestLog_ServerError(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	handler := httpmw.RequestLog(log, slog.LevelDebug)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "WARN", record["level"])
+	assert.EqualValues(t, http.StatusServiceUnavailable, record["status"])
+}
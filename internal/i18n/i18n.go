@@ -0,0 +1,225 @@
+// Пакет i18n переводит сообщения об ошибках API на язык клиента.
+//
+// Сообщения хранятся в каталогах — JSON-файлах вида {"код": "текст"}, по
+// одному на язык. Каталоги английского и русского языков встроены в сервис;
+// дополнительные языки и исправленные тексты загружаются из каталога на диске
+// (LoadDir) без пересборки.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Язык, используемый, если клиент не указал поддерживаемый.
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var embedded embed.FS
+
+// Набор каталогов сообщений по языкам.
+type Bundle struct {
+	catalogs map[string]map[string]string
+}
+
+// Используемый сервисом набор каталогов.
+var bundle = mustBundle()
+
+// Создаёт набор со встроенными каталогами.
+//
+// Возвращает:
+// - указатель на Bundle.
+// - ошибку, если встроенный каталог повреждён.
+func NewBundle() (*Bundle, error) {
+	b := &Bundle{catalogs: make(map[string]map[string]string)}
+	if err := b.load(embedded, "locales"); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Создаёт набор со встроенными каталогами; встроенные каталоги проверяются тестами.
+func mustBundle() *Bundle {
+	b, err := NewBundle()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Загружает каталоги <язык>.json из директории.
+//
+// Сообщения файла дополняют каталог языка, заменяя встроенные тексты с теми
+// же кодами.
+//
+// Принимает:
+// - dir: путь к директории с каталогами.
+//
+// Возвращает:
+// - ошибку, если директорию или каталог не удалось прочитать.
+func (b *Bundle) LoadDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("failed to open message catalogs directory: %w", err)
+	}
+	return b.load(os.DirFS(dir), ".")
+}
+
+// Загружает каталоги из файловой системы.
+func (b *Bundle) load(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list message catalogs: %w", err)
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read message catalog: %w", err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("failed to parse message catalog %s: %w", file, err)
+		}
+
+		lang := strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))
+		if b.catalogs[lang] == nil {
+			b.catalogs[lang] = make(map[string]string)
+		}
+		for code, text := range messages {
+			b.catalogs[lang][code] = text
+		}
+	}
+	return nil
+}
+
+// Выбирает язык ответа по заголовку Accept-Language.
+//
+// Языки перебираются в порядке убывания веса q; для тега с регионом (ru-RU)
+// подходит и каталог основного языка (ru).
+//
+// Принимает:
+// - acceptLanguage: значение заголовка Accept-Language.
+//
+// Возвращает:
+// - язык, для которого есть каталог, или DefaultLanguage.
+func (b *Bundle) Language(acceptLanguage string) string {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && q > 0 {
+			candidates = append(candidates, candidate{tag: tag, q: q})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	for _, c := range candidates {
+		if _, ok := b.catalogs[c.tag]; ok {
+			return c.tag
+		}
+		base, _, _ := strings.Cut(c.tag, "-")
+		if _, ok := b.catalogs[base]; ok {
+			return base
+		}
+	}
+	return DefaultLanguage
+}
+
+// Возвращает текст сообщения.
+//
+// Принимает:
+// - lang: язык.
+// - code: код сообщения.
+//
+// Возвращает:
+// - текст на языке lang; если перевода нет — на DefaultLanguage, а если нет и
+// его — сам код.
+func (b *Bundle) Message(lang, code string) string {
+	if text, ok := b.catalogs[lang][code]; ok {
+		return text
+	}
+	if text, ok := b.catalogs[DefaultLanguage][code]; ok {
+		return text
+	}
+	return code
+}
+
+// Загружает дополнительные каталоги в используемый сервисом набор. Вызывается
+// при запуске до обработки первых запросов.
+//
+// Принимает:
+// - dir: путь к директории с каталогами <язык>.json.
+//
+// Возвращает:
+// - ошибку, если каталоги не удалось загрузить.
+func LoadDir(dir string) error {
+	return bundle.LoadDir(dir)
+}
+
+// Отправляет ответ с ошибкой на языке клиента.
+//
+// Текст ошибки выбирается по коду и заголовку Accept-Language запроса. Код
+// передаётся в заголовке X-Error-Code, чтобы клиенты могли обрабатывать ошибку,
+// не разбирая переведённый текст; язык текста — в заголовке Content-Language.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: запрос клиента.
+// - code: код ошибки (ключ каталога).
+// - status: код ответа HTTP.
+func Error(w http.ResponseWriter, r *http.Request, code string, status int) {
+	lang := bundle.Language(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("X-Error-Code", code)
+	http.Error(w, bundle.Message(lang, code), status)
+}
+
+// Тело ответа JSONError.
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Отправляет ответ с ошибкой на языке клиента в виде JSON-объекта
+// {"code": "...", "message": "..."}. Заголовки те же, что у Error.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - r: запрос клиента.
+// - code: код ошибки (ключ каталога).
+// - status: код ответа HTTP.
+func JSONError(w http.ResponseWriter, r *http.Request, code string, status int) {
+	lang := bundle.Language(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("X-Error-Code", code)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody{Code: code, Message: bundle.Message(lang, code)})
+}
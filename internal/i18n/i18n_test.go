@@ -0,0 +1,100 @@
+package i18n_test
+
+import (
+	"auth_service/internal/i18n"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка, что встроенные каталоги содержат одинаковый набор кодов.
+func TestEmbeddedCatalogs(t *testing.T) {
+	read := func(lang string) map[string]string {
+		data, err := os.ReadFile(filepath.Join("locales", lang+".json"))
+		require.NoError(t, err)
+		var messages map[string]string
+		require.NoError(t, json.Unmarshal(data, &messages))
+		return messages
+	}
+	en, ru := read("en"), read("ru")
+	for code := range en {
+		assert.Contains(t, ru, code)
+	}
+	assert.Len(t, ru, len(en))
+}
+
+// Проверка выбора языка по Accept-Language.
+func TestBundle_Language(t *testing.T) {
+	b, err := i18n.NewBundle()
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"":                       "en",
+		"ru":                     "ru",
+		"ru-RU,ru;q=0.9":         "ru",
+		"de-DE, en;q=0.5":        "en",
+		"en;q=0.3, RU;q=0.7":     "ru",
+		"ru;q=0, en":             "en",
+		"fr":                     "en",
+		"*":                      "en",
+		"ru;q=invalid, en;q=0.1": "en",
+	}
+	for header, want := range tests {
+		assert.Equal(t, want, b.Language(header), header)
+	}
+}
+
+// Проверка загрузки дополнительных каталогов.
+func TestBundle_LoadDir(t *testing.T) {
+	b, err := i18n.NewBundle()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"invalid_user_id": "ungültige user_id"}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ru.json"), []byte(`{"invalid_user_id": "неверный user_id"}`), 0o600))
+	require.NoError(t, b.LoadDir(dir))
+
+	assert.Equal(t, "de", b.Language("de-AT"))
+	assert.Equal(t, "ungültige user_id", b.Message("de", "invalid_user_id"))
+	// Отсутствующий перевод берётся из языка по умолчанию.
+	assert.Equal(t, "invalid refresh token", b.Message("de", "invalid_refresh_token"))
+	assert.Equal(t, "неверный user_id", b.Message("ru", "invalid_user_id"))
+	assert.Equal(t, "unknown_code", b.Message("ru", "unknown_code"))
+
+	assert.Error(t, b.LoadDir(filepath.Join(dir, "missing")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{`), 0o600))
+	assert.Error(t, b.LoadDir(dir))
+}
+
+// Проверка ответа с переведённой ошибкой.
+func TestError(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "ru-RU")
+	w := httptest.NewRecorder()
+	i18n.Error(w, r, "invalid_access_token", http.StatusUnauthorized)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "недействительный access-токен\n", w.Body.String())
+	assert.Equal(t, "ru", w.Header().Get("Content-Language"))
+	assert.Equal(t, "invalid_access_token", w.Header().Get("X-Error-Code"))
+}
+
+// Проверка ответа с переведённой ошибкой в виде JSON.
+func TestJSONError(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "ru-RU")
+	w := httptest.NewRecorder()
+	i18n.JSONError(w, r, "invalid_access_token", http.StatusUnauthorized)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"code": "invalid_access_token", "message": "недействительный access-токен"}`, w.Body.String())
+	assert.Equal(t, "ru", w.Header().Get("Content-Language"))
+	assert.Equal(t, "invalid_access_token", w.Header().Get("X-Error-Code"))
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Периодическая задача.
+type Job struct {
+	// Уникальное имя задачи; используется и как ключ блокировки.
+	Name string
+	// Интервал между запусками.
+	Interval time.Duration
+	// Тело задачи.
+	Run func(ctx context.Context) error
+	// Выполнять на каждой реплике без блокировки: для задач, обрабатывающих
+	// данные самого процесса (например, накопленные в памяти счётчики).
+	Local bool
+}
+
+// Выбор лидера для задачи.
+//
+// TryLock пытается захватить блокировку с именем name без ожидания. Блокировка
+// не выдаётся, пока задача выполняется, а также если её запуск начался (на
+// любой реплике) меньше interval назад: тикеры реплик не согласованы, и без
+// этого каждая реплика запускала бы задачу в свой такт.
+// Если блокировка захвачена, возвращает функцию её освобождения и true.
+type Locker interface {
+	TryLock(ctx context.Context, name string, interval time.Duration) (release func(), acquired bool, err error)
+}
+
+// Планировщик периодических задач.
+//
+// Каждая задача выполняется в отдельной горутине. Перед каждым запуском
+// планировщик захватывает блокировку с именем задачи, поэтому при нескольких
+// репликах сервиса задача выполняется только на одной из них и не чаще
+// одного раза за интервал.
+type Scheduler struct {
+	log    *slog.Logger
+	locker Locker
+	jobs   []Job
+	wg     sync.WaitGroup
+}
+
+// Создаёт новый планировщик.
+//
+// Принимает:
+// - log: указатель на logger для логирования событий.
+// - locker: реализация выбора лидера.
+//
+// Возвращает:
+// - указатель на Scheduler.
+func NewScheduler(log *slog.Logger, locker Locker) *Scheduler {
+	return &Scheduler{log: log, locker: locker}
+}
+
+// Регистрирует задачу. Должна вызываться до Start.
+//
+// Принимает:
+// - job: задача.
+//
+// Возвращает:
+// - ошибку, если интервал задачи не положителен.
+func (s *Scheduler) Add(job Job) error {
+	if job.Interval <= 0 {
+		return fmt.Errorf("job %s: interval must be positive, got %s", job.Name, job.Interval)
+	}
+	s.jobs = append(s.jobs, job)
+	return nil
+}
+
+// Запускает все зарегистрированные задачи до отмены контекста.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Ожидает завершения всех задач после отмены контекста.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runOnce(ctx, job)
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	log := s.log.With(slog.String("job", job.Name))
+
+	if !job.Local {
+		// Начало запуска фиксируется чуть позже такта, поэтому следующий такт
+		// той же реплики наступает чуть раньше, чем через Interval; запас в
+		// десятую часть интервала не даёт ей пропустить собственный запуск.
+		release, acquired, err := s.locker.TryLock(ctx, job.Name, job.Interval-job.Interval/10)
+		if err != nil {
+			log.Error("Failed to acquire job lock", slog.String("error", err.Error()))
+			return
+		}
+		if !acquired {
+			log.Debug("Job is running on another instance, skipping")
+			return
+		}
+		defer release()
+	}
+
+	start := time.Now()
+	if err := job.Run(ctx); err != nil {
+		log.Error("Job failed", slog.String("error", err.Error()), slog.Duration("duration", time.Since(start)))
+		return
+	}
+	log.Debug("Job completed", slog.Duration("duration", time.Since(start)))
+}
+
+// Блокировка в пределах одного процесса: используется, когда хранилище
+// не поддерживает распределённые блокировки (memory, redis).
+type LocalLocker struct {
+	mu     sync.Mutex
+	locked map[string]bool
+	// Время начала последнего запуска задачи.
+	lastRun map[string]time.Time
+}
+
+// Создаёт новый экземпляр LocalLocker.
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{locked: make(map[string]bool), lastRun: make(map[string]time.Time)}
+}
+
+func (l *LocalLocker) TryLock(_ context.Context, name string, interval time.Duration) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.locked[name] || now.Sub(l.lastRun[name]) < interval {
+		return nil, false, nil
+	}
+	l.locked[name] = true
+	l.lastRun[name] = now
+
+	return func() {
+		l.mu.Lock()
+		delete(l.locked, name)
+		l.mu.Unlock()
+	}, true, nil
+}
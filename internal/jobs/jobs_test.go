@@ -0,0 +1,153 @@
+package jobs_test
+
+import (
+	"auth_service/internal/jobs"
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка того, что занятая блокировка не выдаётся повторно до освобождения.
+func TestLocalLocker(t *testing.T) {
+	locker := jobs.NewLocalLocker()
+
+	release, ok, err := locker.TryLock(context.Background(), "cleanup", 0)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, ok, _ = locker.TryLock(context.Background(), "cleanup", 0)
+	assert.False(t, ok)
+
+	release()
+	_, ok, _ = locker.TryLock(context.Background(), "cleanup", 0)
+	assert.True(t, ok)
+}
+
+// Проверка того, что блокировка не выдаётся в пределах интервала после
+// начала предыдущего запуска, даже если он завершён.
+func TestLocalLocker_Interval(t *testing.T) {
+	locker := jobs.NewLocalLocker()
+
+	release, ok, err := locker.TryLock(context.Background(), "cleanup", time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	release()
+
+	_, ok, _ = locker.TryLock(context.Background(), "cleanup", time.Hour)
+	assert.False(t, ok)
+
+	_, ok, _ = locker.TryLock(context.Background(), "cleanup", 0)
+	assert.True(t, ok)
+}
+
+// Проверка того, что задача с неположительным интервалом не регистрируется:
+// такой интервал остановил бы процесс паникой time.NewTicker при запуске.
+func TestScheduler_RejectsNonPositiveInterval(t *testing.T) {
+	scheduler := jobs.NewScheduler(slog.New(slog.NewTextHandler(io.Discard, nil)), jobs.NewLocalLocker())
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err := scheduler.Add(jobs.Job{Name: "cleanup", Interval: interval, Run: func(context.Context) error { return nil }})
+		assert.Error(t, err, interval)
+	}
+
+	// Без зарегистрированных задач запуск ничего не делает.
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler.Start(ctx)
+	cancel()
+	scheduler.Wait()
+}
+
+// Проверка периодического запуска задачи и остановки по отмене контекста.
+func TestScheduler_RunsJobs(t *testing.T) {
+	var runs atomic.Int32
+	scheduler := jobs.NewScheduler(slog.New(slog.NewTextHandler(io.Discard, nil)), jobs.NewLocalLocker())
+	require.NoError(t, scheduler.Add(jobs.Job{
+		Name:     "counter",
+		Interval: 5 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler.Start(ctx)
+
+	assert.Eventually(t, func() bool { return runs.Load() >= 2 }, time.Second, time.Millisecond)
+	cancel()
+	scheduler.Wait()
+}
+
+// Проверка запуска локальной задачи без блокировки.
+func TestScheduler_LocalJob(t *testing.T) {
+	locker := jobs.NewLocalLocker()
+	// Блокировка занята «другой репликой».
+	_, ok, err := locker.TryLock(context.Background(), "flush", 0)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	var runs atomic.Int32
+	scheduler := jobs.NewScheduler(slog.New(slog.NewTextHandler(io.Discard, nil)), locker)
+	require.NoError(t, scheduler.Add(jobs.Job{
+		Name:     "flush",
+		Interval: 5 * time.Millisecond,
+		Local:    true,
+		Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler.Start(ctx)
+
+	assert.Eventually(t, func() bool { return runs.Load() >= 1 }, time.Second, time.Millisecond)
+	cancel()
+	scheduler.Wait()
+}
+
+// Проверка того, что при двух репликах со сдвинутыми тактами задача
+// выполняется не чаще одного раза за интервал, а не в такт каждой реплики.
+func TestScheduler_StaggeredReplicas(t *testing.T) {
+	const interval = 40 * time.Millisecond
+	locker := jobs.NewLocalLocker()
+
+	var runs atomic.Int32
+	job := jobs.Job{
+		Name:     "cleanup",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	replicas := make([]*jobs.Scheduler, 2)
+	for i := range replicas {
+		replicas[i] = jobs.NewScheduler(slog.New(slog.NewTextHandler(io.Discard, nil)), locker)
+		require.NoError(t, replicas[i].Add(job))
+	}
+	start := time.Now()
+	replicas[0].Start(ctx)
+	// Такты второй реплики приходятся на середину интервала первой.
+	time.Sleep(interval / 2)
+	replicas[1].Start(ctx)
+
+	time.Sleep(10 * interval)
+	cancel()
+	elapsed := time.Since(start)
+	for _, replica := range replicas {
+		replica.Wait()
+	}
+
+	// Запуски разделены не меньше чем 0.9 интервала.
+	maxRuns := int32(elapsed/(interval*9/10)) + 1
+	assert.LessOrEqual(t, runs.Load(), maxRuns)
+	assert.GreaterOrEqual(t, runs.Load(), int32(5))
+}
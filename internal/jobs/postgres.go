@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Выбор лидера через advisory-блокировки PostgreSQL.
+//
+// Блокировка уровня сессии удерживается на выделенном соединении пула
+// на всё время выполнения задачи и освобождается вместе с ним. Время начала
+// последнего запуска хранится в таблице job_runs, чтобы реплики не
+// запускали задачу повторно в пределах интервала.
+type PostgresLocker struct {
+	pool *pgxpool.Pool
+}
+
+// Создаёт новый экземпляр PostgresLocker.
+//
+// Принимает:
+// - pool: пул соединений с базой данных.
+//
+// Возвращает:
+// - указатель на PostgresLocker.
+func NewPostgresLocker(pool *pgxpool.Pool) *PostgresLocker {
+	return &PostgresLocker{pool: pool}
+}
+
+// Отмечает начало запуска задачи, если предыдущий начался не меньше interval
+// назад. Время берётся на сервере базы данных, поэтому расхождение часов
+// реплик не влияет на результат.
+const claimRunQuery = `
+	INSERT INTO job_runs (name, started_at) VALUES ($1, NOW())
+	ON CONFLICT (name) DO UPDATE SET started_at = EXCLUDED.started_at
+	WHERE job_runs.started_at <= NOW() - make_interval(secs => $2)
+`
+
+func (l *PostgresLocker) TryLock(ctx context.Context, name string, interval time.Duration) (func(), bool, error) {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	key := lockKey(name)
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	release := func() {
+		// Используется фоновый контекст: блокировку нужно снять даже после отмены ctx.
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+		conn.Release()
+	}
+
+	tag, err := conn.Exec(ctx, claimRunQuery, name, interval.Seconds())
+	if err != nil {
+		release()
+		return nil, false, fmt.Errorf("failed to record job run: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		release()
+		return nil, false, nil
+	}
+
+	return release, true, nil
+}
+
+// Преобразует имя задачи в ключ advisory-блокировки.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("auth_service:jobs:" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,51 @@
+package jobs_test
+
+import (
+	"auth_service/internal/jobs"
+	"auth_service/internal/testutil/pgtest"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Run(m))
+}
+
+// Проверка того, что реплики с общей базой не запускают задачу повторно в
+// пределах интервала, даже если предыдущий запуск завершён.
+func TestPostgresLocker_Interval(t *testing.T) {
+	pool := pgtest.New(t)
+	ctx := context.Background()
+	first, second := jobs.NewPostgresLocker(pool), jobs.NewPostgresLocker(pool)
+
+	release, ok, err := first.TryLock(ctx, "cleanup", time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Пока задача выполняется, блокировка занята.
+	_, ok, err = second.TryLock(ctx, "cleanup", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	release()
+
+	// Запуск начался меньше интервала назад.
+	_, ok, err = second.TryLock(ctx, "cleanup", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	release, ok, err = second.TryLock(ctx, "cleanup", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	release()
+
+	// Интервал отсчитывается для каждой задачи отдельно.
+	release, ok, err = second.TryLock(ctx, "stats_rollup", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	release()
+}
@@ -0,0 +1,96 @@
+// Пакет jwks публикует открытые ключи подписи access-токенов в формате JWKS
+// (RFC 7517) на GET /.well-known/jwks.json, чтобы API-шлюзы и сервисы-
+// потребители проверяли токены сами, не обращаясь к сервису авторизации.
+package jwks
+
+import (
+	"auth_service/internal/services/tokens"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Документ JWKS.
+type Document struct {
+	Keys []Key `json:"keys"`
+}
+
+// Открытый ключ в формате JWK; набор членов ключа зависит от kty.
+type Key struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// Кривая EC или OKP.
+	Crv string `json:"crv,omitempty"`
+	// Модуль и экспонента RSA.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Координаты EC или ключ OKP.
+	X string `json:"x,omitempty"`
+	Y string `json:"y,omitempty"`
+}
+
+// Формирует документ из открытых ключей.
+func NewDocument(keys []tokens.PublicKey) Document {
+	doc := Document{Keys: make([]Key, 0, len(keys))}
+	for _, key := range keys {
+		params := tokens.JWKParams(key.Key)
+		doc.Keys = append(doc.Keys, Key{
+			Kty: params["kty"],
+			Use: "sig",
+			Alg: key.Algorithm(),
+			Kid: key.ID,
+			Crv: params["crv"],
+			N:   params["n"],
+			E:   params["e"],
+			X:   params["x"],
+			Y:   params["y"],
+		})
+	}
+	return doc
+}
+
+// Создаёт обработчик /.well-known/jwks.json.
+//
+// Ключи задаются при запуске и не меняются до перезапуска, поэтому документ
+// формируется один раз. Ответ разрешено кешировать на maxAge (Cache-Control);
+// ETag позволяет клиентам проверять актуальность кеша условным запросом
+// (304 Not Modified). Если токены подписываются общим секретом, набор пуст.
+//
+// Принимает:
+// - keys: открытые ключи проверки подписи (tokens.PublicKeys).
+// - maxAge: время, на которое клиенты могут кешировать ответ.
+//
+// Возвращает:
+// - http.Handler.
+func Handler(keys []tokens.PublicKey, maxAge time.Duration) http.Handler {
+	body, _ := json.Marshal(NewDocument(keys))
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	cacheControl := "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, _ = w.Write(body)
+	})
+}
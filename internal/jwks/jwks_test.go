@@ -0,0 +1,113 @@
+package jwks_test
+
+import (
+	"auth_service/internal/jwks"
+	"auth_service/internal/services/tokens"
+	"auth_service/pkg/authtoken"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка документа, заголовков кеширования и условного запроса.
+func TestHandler(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer, err := tokens.NewKeySigner(tokens.AlgorithmRS256, key, "")
+	require.NoError(t, err)
+	tokens.SetSigner(signer)
+	t.Cleanup(func() { tokens.SetSigner(nil) })
+
+	handler := jwks.Handler(tokens.PublicKeys(), 5*time.Minute)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/jwk-set+json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300", rec.Header().Get("Cache-Control"))
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Документ разбирается клиентом JWKS, и токен проверяется по нему.
+	keys, err := authtoken.ParseJWKS(rec.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 1, keys.Len())
+	verifier, err := authtoken.NewVerifier(authtoken.WithKeys(keys))
+	require.NoError(t, err)
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), accessToken)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+// Проверка, что ключи EC и OKP публикуются с кривой и проверяют токены.
+func TestHandler_KeyTypes(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		algorithm string
+		key       crypto.Signer
+		kty, crv  string
+	}{
+		{tokens.AlgorithmES256, ecKey, "EC", "P-256"},
+		{tokens.AlgorithmEdDSA, edKey, "OKP", "Ed25519"},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			signer, err := tokens.NewKeySigner(tc.algorithm, tc.key, "")
+			require.NoError(t, err)
+			tokens.SetSigner(signer)
+			t.Cleanup(func() { tokens.SetSigner(nil) })
+
+			doc := jwks.NewDocument(tokens.PublicKeys())
+			require.Len(t, doc.Keys, 1)
+			assert.Equal(t, tc.kty, doc.Keys[0].Kty)
+			assert.Equal(t, tc.crv, doc.Keys[0].Crv)
+			assert.Equal(t, tc.algorithm, doc.Keys[0].Alg)
+			assert.Equal(t, signer.KeyID(), doc.Keys[0].Kid)
+
+			rec := httptest.NewRecorder()
+			jwks.Handler(tokens.PublicKeys(), time.Minute).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+			keys, err := authtoken.ParseJWKS(rec.Body.Bytes())
+			require.NoError(t, err)
+			verifier, err := authtoken.NewVerifier(authtoken.WithKeys(keys))
+			require.NoError(t, err)
+			accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+			require.NoError(t, err)
+			_, err = verifier.Verify(context.Background(), accessToken)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// Проверка пустого набора при подписи общим секретом.
+func TestHandler_NoKeys(t *testing.T) {
+	rec := httptest.NewRecorder()
+	jwks.Handler(tokens.PublicKeys(), time.Minute).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"keys":[]}`, rec.Body.String())
+}
@@ -0,0 +1,353 @@
+// Пакет lockout защищает вход по паролю от подбора: неудачные попытки
+// подряд учитываются для учётной записи (email) и для адреса клиента, и после
+// порога вход блокируется с экспоненциально растущей длительностью.
+//
+// Первая блокировка длится BaseLockout, каждая следующая неудачная попытка
+// после неё удваивает длительность вплоть до MaxLockout. Счёт начинается
+// заново после успешного входа в учётную запись или если неудачных попыток не
+// было дольше ResetAfter. Счётчики хранятся в хранилище
+// (storage.LoginAttempts), поэтому блокировка действует на всех репликах.
+//
+// Учётная запись определяется по email из запроса, в том числе для
+// несуществующих пользователей, поэтому по блокировке нельзя узнать, есть ли
+// пользователь с таким email. В хранилище сохраняется только SHA-256 email.
+package lockout
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/storage"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Вход временно заблокирован.
+var ErrLocked = errors.New("login is temporarily locked")
+
+// Область блокировки (значения метки scope метрик и поля Lock.Scope).
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// Ошибка блокировки входа с временем до её окончания.
+type LockedError struct {
+	// ScopeAccount или ScopeIP.
+	Scope string
+	// Через сколько блокировка закончится.
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s by %s, retry after %s", ErrLocked, e.Scope, e.RetryAfter)
+}
+
+// Позволяет проверять ошибку через errors.Is(err, ErrLocked).
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+var rejected = metrics.NewCounterVec(
+	"auth_login_locked_total",
+	"Number of login requests rejected because the account or client address is locked, by scope.",
+	"scope",
+)
+
+var lockouts = metrics.NewCounterVec(
+	"auth_login_lockouts_total",
+	"Number of login lockouts started after repeated failed attempts, by scope.",
+	"scope",
+)
+
+// Правила блокировки.
+type Policy struct {
+	// Неудачных попыток подряд для учётной записи, после которых вход блокируется; 0 — без ограничения.
+	MaxAccountFailures int
+	// Неудачных попыток подряд с адреса клиента, после которых вход блокируется; 0 — без ограничения.
+	MaxIPFailures int
+	// Длительность первой блокировки.
+	BaseLockout time.Duration
+	// Наибольшая длительность блокировки.
+	MaxLockout time.Duration
+	// Время без неудачных попыток, после которого счёт начинается заново.
+	ResetAfter time.Duration
+}
+
+// Сообщает, включена ли блокировка хотя бы для одной области.
+func (p Policy) Enabled() bool {
+	return p.MaxAccountFailures > 0 || p.MaxIPFailures > 0
+}
+
+// Проверяет правила.
+func (p Policy) Validate() error {
+	if p.MaxAccountFailures < 0 || p.MaxIPFailures < 0 {
+		return fmt.Errorf("max_account_failures and max_ip_failures must not be negative, got %d and %d", p.MaxAccountFailures, p.MaxIPFailures)
+	}
+	if !p.Enabled() {
+		return nil
+	}
+	if p.BaseLockout <= 0 || p.MaxLockout < p.BaseLockout {
+		return fmt.Errorf("base_lockout must be positive and not exceed max_lockout, got %s and %s", p.BaseLockout, p.MaxLockout)
+	}
+	if p.ResetAfter <= 0 {
+		return fmt.Errorf("reset_after must be positive, got %s", p.ResetAfter)
+	}
+	return nil
+}
+
+// Длительность блокировки после failures неудачных попыток при пороге threshold.
+func (p Policy) lockout(failures, threshold int) time.Duration {
+	d := p.BaseLockout
+	for i := threshold; i < failures && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxLockout)
+}
+
+// Начатая блокировка входа.
+type Lock struct {
+	// ScopeAccount или ScopeIP.
+	Scope string
+	// Неудачных попыток подряд.
+	Failures int
+	// Момент окончания блокировки.
+	Until time.Time
+}
+
+var (
+	mu     sync.RWMutex
+	policy Policy
+	store  storage.LoginAttempts
+	now    = time.Now
+)
+
+// Устанавливает правила блокировки и хранилище счётчиков. Вызывается при запуске.
+//
+// Принимает:
+// - s: хранилище счётчиков; nil — вход не блокируется.
+// - p: правила блокировки.
+//
+// Возвращает:
+// - ошибку, если правила некорректны; в этом случае действующие правила не меняются.
+func Set(s storage.LoginAttempts, p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	store, policy = s, p
+	return nil
+}
+
+// Возвращает хранилище счётчиков и правила, если блокировка включена.
+func current() (storage.LoginAttempts, Policy, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return store, policy, store != nil && policy.Enabled()
+}
+
+// Ключ учётной записи: SHA-256 email без учёта регистра и пробелов по краям.
+func accountKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return ScopeAccount + ":" + hex.EncodeToString(sum[:])
+}
+
+// Ключ адреса клиента.
+func ipKey(clientIP string) string {
+	return ScopeIP + ":" + clientIP
+}
+
+// Ключи и пороги областей, для которых блокировка включена.
+type scope struct {
+	name      string
+	key       string
+	threshold int
+}
+
+func scopes(p Policy, email, clientIP string) []scope {
+	var result []scope
+	if p.MaxAccountFailures > 0 {
+		result = append(result, scope{ScopeAccount, accountKey(email), p.MaxAccountFailures})
+	}
+	if p.MaxIPFailures > 0 && clientIP != "" {
+		result = append(result, scope{ScopeIP, ipKey(clientIP), p.MaxIPFailures})
+	}
+	return result
+}
+
+// Проверяет, не заблокирован ли вход.
+//
+// Принимает:
+// - email: email из запроса входа.
+// - clientIP: адрес клиента в сохраняемой форме; пустая строка — не проверяется.
+//
+// Возвращает:
+// - *LockedError, если вход в учётную запись или с адреса заблокирован.
+// - ошибку хранилища, если блокировку не удалось проверить.
+func Check(email, clientIP string) error {
+	s, p, ok := current()
+	if !ok {
+		return nil
+	}
+	for _, sc := range scopes(p, email, clientIP) {
+		attempt, err := s.GetLoginAttempt(sc.key)
+		if err != nil {
+			return fmt.Errorf("failed to check login lockout: %w", err)
+		}
+		if retryAfter := attempt.LockedUntil.Sub(now()); retryAfter > 0 {
+			rejected.Inc(sc.name)
+			return &LockedError{Scope: sc.name, RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// Возвращает наибольшее число неудачных попыток подряд для учётной записи
+// или адреса клиента, учитываемых сейчас (например, чтобы потребовать CAPTCHA
+// раньше блокировки).
+//
+// Принимает:
+// - email: email из запроса входа.
+// - clientIP: адрес клиента в сохраняемой форме; пустая строка — не учитывается.
+//
+// Возвращает:
+// - число попыток; 0, если блокировка не включена.
+// - ошибку хранилища, если попытки не удалось прочитать.
+func Failures(email, clientIP string) (int, error) {
+	s, p, ok := current()
+	if !ok {
+		return 0, nil
+	}
+	failures := 0
+	for _, sc := range scopes(p, email, clientIP) {
+		attempt, err := s.GetLoginAttempt(sc.key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get login attempts: %w", err)
+		}
+		if now().Sub(attempt.LastFailureAt) < p.ResetAfter {
+			failures = max(failures, attempt.Failures)
+		}
+	}
+	return failures, nil
+}
+
+// Учитывает неудачную попытку входа.
+//
+// Принимает:
+// - email: email из запроса входа.
+// - clientIP: адрес клиента в сохраняемой форме; пустая строка — не учитывается.
+//
+// Возвращает:
+// - блокировки, начатые или продлённые этой попыткой.
+// - ошибку хранилища, если попытку не удалось учесть.
+func RecordFailure(email, clientIP string) ([]Lock, error) {
+	s, p, ok := current()
+	if !ok {
+		return nil, nil
+	}
+	var locks []Lock
+	for _, sc := range scopes(p, email, clientIP) {
+		attempt, err := s.AddLoginFailure(sc.key, p.ResetAfter)
+		if err != nil {
+			return locks, fmt.Errorf("failed to record login failure: %w", err)
+		}
+		if attempt.Failures < sc.threshold {
+			continue
+		}
+		until := now().Add(p.lockout(attempt.Failures, sc.threshold))
+		if err := s.LockLogin(sc.key, until); err != nil {
+			return locks, fmt.Errorf("failed to lock login: %w", err)
+		}
+		lockouts.Inc(sc.name)
+		locks = append(locks, Lock{Scope: sc.name, Failures: attempt.Failures, Until: until})
+	}
+	return locks, nil
+}
+
+// Сбрасывает неудачные попытки учётной записи после успешного входа.
+// Попытки с адреса клиента не сбрасываются: иначе успешный вход в свою
+// учётную запись позволял бы продолжать подбор паролей к чужим.
+//
+// Принимает:
+// - email: email из запроса входа.
+//
+// Возвращает:
+// - ошибку хранилища, если попытки не удалось сбросить.
+func RecordSuccess(email string) error {
+	s, p, ok := current()
+	if !ok || p.MaxAccountFailures == 0 {
+		return nil
+	}
+	if err := s.ResetLoginAttempts(accountKey(email)); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
+
+// Возвращает действующие неудачные попытки и блокировку учётной записи
+// (для служебных маршрутов). Попытки старше ResetAfter и закончившаяся
+// блокировка не возвращаются.
+//
+// Принимает:
+// - email: email учётной записи.
+//
+// Возвращает:
+// - попытки; нулевое значение, если их нет или блокировка не включена.
+// - ошибку хранилища.
+func AccountState(email string) (storage.LoginAttempt, error) {
+	s, p, ok := current()
+	if !ok {
+		return storage.LoginAttempt{}, nil
+	}
+	attempt, err := s.GetLoginAttempt(accountKey(email))
+	if err != nil {
+		return storage.LoginAttempt{}, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+	if now().Sub(attempt.LastFailureAt) >= p.ResetAfter {
+		attempt.Failures = 0
+	}
+	if !attempt.LockedUntil.After(now()) {
+		attempt.LockedUntil = time.Time{}
+	}
+	return attempt, nil
+}
+
+// Сбрасывает неудачные попытки и снимает блокировку учётной записи
+// (по запросу администратора). Попытки с адресов клиентов не меняются.
+//
+// Принимает:
+// - email: email учётной записи.
+//
+// Возвращает:
+// - ошибку хранилища.
+func ResetAccount(email string) error {
+	s, _, ok := current()
+	if !ok {
+		return nil
+	}
+	if err := s.ResetLoginAttempts(accountKey(email)); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
+
+// Удаляет записи о попытках, после которых прошло больше ResetAfter и
+// блокировка которых закончилась: они уже не влияют на вход.
+//
+// Принимает:
+// - limit: максимальное количество удаляемых записей за один вызов.
+//
+// Возвращает:
+// - количество удалённых записей.
+// - ошибку хранилища.
+func Prune(limit int) (int64, error) {
+	s, p, ok := current()
+	if !ok {
+		return 0, nil
+	}
+	return s.DeleteLoginAttempts(now().Add(-p.ResetAfter), limit)
+}
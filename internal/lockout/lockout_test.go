@@ -0,0 +1,136 @@
+package lockout
+
+import (
+	"auth_service/internal/storage/memory"
+	"auth_service/lib/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Устанавливает правила с хранилищем в памяти и управляемыми часами.
+func setup(t *testing.T, p Policy) *clock.Fake {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	now = clk.Now
+	require.NoError(t, Set(memory.NewMemoryStorage().WithClock(clk), p))
+	t.Cleanup(func() { now = time.Now; Set(nil, Policy{}) })
+	return clk
+}
+
+// Проверка экспоненциального роста блокировки учётной записи.
+func TestAccountLockout(t *testing.T) {
+	clk := setup(t, Policy{MaxAccountFailures: 3, BaseLockout: time.Minute, MaxLockout: 5 * time.Minute, ResetAfter: time.Hour})
+	const email = "alice@example.com"
+
+	for i := 0; i < 2; i++ {
+		locks, err := RecordFailure(email, "192.0.2.1")
+		require.NoError(t, err)
+		assert.Empty(t, locks)
+	}
+	require.NoError(t, Check(email, "192.0.2.1"))
+
+	// Длительность удваивается с каждой неудачей после порога до MaxLockout.
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute} {
+		locks, err := RecordFailure(email, "192.0.2.1")
+		require.NoError(t, err)
+		require.Len(t, locks, 1)
+		assert.Equal(t, ScopeAccount, locks[0].Scope)
+		assert.Equal(t, clk.Now().Add(want), locks[0].Until)
+
+		err = Check(" ALICE@example.com", "198.51.100.1")
+		var lockedErr *LockedError
+		require.ErrorAs(t, err, &lockedErr)
+		assert.ErrorIs(t, err, ErrLocked)
+		assert.Equal(t, want, lockedErr.RetryAfter)
+		clk.Advance(want)
+	}
+	require.NoError(t, Check(email, "192.0.2.1"))
+	assert.NoError(t, Check("bob@example.com", "192.0.2.1"), "other accounts are not affected")
+
+	// Успешный вход сбрасывает счёт.
+	require.NoError(t, RecordSuccess(email))
+	locks, err := RecordFailure(email, "192.0.2.1")
+	require.NoError(t, err)
+	assert.Empty(t, locks)
+}
+
+// Проверка блокировки адреса клиента, перебирающего учётные записи.
+func TestIPLockout(t *testing.T) {
+	clk := setup(t, Policy{MaxIPFailures: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour})
+
+	_, err := RecordFailure("alice@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	// Успешный вход не сбрасывает счёт адреса.
+	require.NoError(t, RecordSuccess("mallory@example.com"))
+	locks, err := RecordFailure("bob@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	require.Len(t, locks, 1)
+	assert.Equal(t, ScopeIP, locks[0].Scope)
+
+	assert.ErrorIs(t, Check("carol@example.com", "192.0.2.1"), ErrLocked)
+	assert.NoError(t, Check("carol@example.com", "192.0.2.2"))
+
+	// Записи удаляются после окончания блокировки и ResetAfter.
+	clk.Advance(time.Hour + time.Second)
+	deleted, err := Prune(100)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	assert.NoError(t, Policy{}.Validate())
+	assert.NoError(t, Policy{MaxAccountFailures: 5, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour}.Validate())
+	assert.Error(t, Policy{MaxIPFailures: -1}.Validate())
+	assert.Error(t, Policy{MaxAccountFailures: 5, MaxLockout: time.Hour, ResetAfter: time.Hour}.Validate())
+	assert.Error(t, Policy{MaxAccountFailures: 5, BaseLockout: time.Hour, MaxLockout: time.Minute, ResetAfter: time.Hour}.Validate())
+	assert.Error(t, Policy{MaxAccountFailures: 5, BaseLockout: time.Minute, MaxLockout: time.Hour}.Validate())
+}
+
+// Проверка подсчёта неудачных попыток по наибольшей из областей.
+func TestFailures(t *testing.T) {
+	clk := setup(t, Policy{MaxAccountFailures: 10, MaxIPFailures: 10, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour})
+
+	_, err := RecordFailure("alice@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	_, err = RecordFailure("bob@example.com", "192.0.2.1")
+	require.NoError(t, err)
+
+	n, err := Failures("alice@example.com", "198.51.100.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = Failures("carol@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// После ResetAfter попытки не учитываются.
+	clk.Advance(time.Hour)
+	n, err = Failures("alice@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+// Проверка просмотра и снятия блокировки учётной записи администратором.
+func TestResetAccount(t *testing.T) {
+	clk := setup(t, Policy{MaxAccountFailures: 2, MaxIPFailures: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour})
+	const email = "alice@example.com"
+
+	for i := 0; i < 2; i++ {
+		_, err := RecordFailure(email, "192.0.2.1")
+		require.NoError(t, err)
+	}
+	state, err := AccountState("Alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 2, state.Failures)
+	assert.Equal(t, clk.Now().Add(time.Minute), state.LockedUntil)
+
+	require.NoError(t, ResetAccount(email))
+	state, err = AccountState(email)
+	require.NoError(t, err)
+	assert.Zero(t, state)
+	// Блокировка адреса клиента остаётся.
+	assert.ErrorIs(t, Check(email, "192.0.2.1"), ErrLocked)
+	assert.NoError(t, Check(email, "192.0.2.2"))
+}
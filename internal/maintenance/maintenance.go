@@ -0,0 +1,149 @@
+// Пакет maintenance реализует режим обслуживания.
+//
+// В режиме обслуживания выдача и обновление токенов (HTTP API и методы gRPC
+// IssueTokens и RefreshTokens) отклоняются с 503 Service Unavailable и кодом
+// maintenance, а проверка токенов, служебные маршруты и проверки состояния
+// продолжают работать. Режим включается конфигурацией или без перезапуска
+// через PUT /admin/maintenance (см. Handler) — на реплике, получившей запрос.
+package maintenance
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/internal/metrics"
+	"auth_service/pkg/authpb"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var rejected = metrics.NewCounterVec(
+	"auth_maintenance_rejected_total",
+	"Number of requests rejected in maintenance mode, by API.",
+	"api",
+)
+
+// Состояние режима обслуживания.
+type State struct {
+	Enabled bool `json:"enabled"`
+	// Через сколько секунд клиентам повторить запрос (заголовок Retry-After);
+	// 0 — не указывать.
+	RetryAfter int `json:"retry_after"`
+}
+
+// Проверяет состояние.
+func (s State) Validate() error {
+	if s.RetryAfter < 0 {
+		return fmt.Errorf("retry_after must not be negative, got %d", s.RetryAfter)
+	}
+	return nil
+}
+
+var (
+	mu    sync.Mutex
+	state State
+)
+
+// Устанавливает состояние режима обслуживания.
+//
+// Принимает:
+// - s: состояние.
+//
+// Возвращает:
+// - ошибку, если состояние некорректно; в этом случае действующее не меняется.
+func Set(s State) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	state = s
+	return nil
+}
+
+// Возвращает действующее состояние режима обслуживания.
+func Current() State {
+	mu.Lock()
+	defer mu.Unlock()
+	return state
+}
+
+// Создаёт middleware, отклоняющее запросы в режиме обслуживания.
+//
+// Запрос получает 503 Service Unavailable с кодом maintenance в заголовке
+// X-Error-Code и, если задан RetryAfter, заголовком Retry-After.
+//
+// Принимает:
+// - next: обработчик маршрута.
+//
+// Возвращает:
+// - http.Handler.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s := Current(); s.Enabled {
+			rejected.Inc("http")
+			if s.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+			}
+			i18n.Error(w, r, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Создаёт перехватчик, отклоняющий вызовы IssueTokens и RefreshTokens в
+// режиме обслуживания со статусом UNAVAILABLE. Остальные методы не
+// ограничиваются.
+//
+// Возвращает:
+// - grpc.UnaryServerInterceptor.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		switch info.FullMethod {
+		case authpb.AuthService_IssueTokens_FullMethodName, authpb.AuthService_RefreshTokens_FullMethodName:
+			if Current().Enabled {
+				rejected.Inc("grpc")
+				return nil, status.Error(codes.Unavailable, "service is under maintenance")
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Создаёт обработчик /admin/maintenance.
+//
+// GET возвращает состояние режима обслуживания, PUT заменяет его значением
+// из тела запроса (State в JSON). Изменение действует на реплике, получившей
+// запрос, до её перезапуска.
+//
+// Возвращает:
+// - http.Handler.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var s State
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&s); err != nil || Set(s) != nil {
+				i18n.Error(w, r, "invalid_maintenance", http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Current())
+	})
+}
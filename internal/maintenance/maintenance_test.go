@@ -0,0 +1,90 @@
+package maintenance_test
+
+import (
+	"auth_service/internal/maintenance"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Устанавливает состояние на время теста.
+func setup(t *testing.T, s maintenance.State) {
+	t.Helper()
+	require.NoError(t, maintenance.Set(s))
+	t.Cleanup(func() { _ = maintenance.Set(maintenance.State{}) })
+}
+
+// Проверка отклонения выдачи и обновления токенов в режиме обслуживания.
+func TestMiddleware(t *testing.T) {
+	handler := maintenance.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/tokens", nil)
+		req.Header.Set("Accept-Language", "ru")
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, serve().Code)
+
+	setup(t, maintenance.State{Enabled: true, RetryAfter: 600})
+	rr := serve()
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "maintenance", rr.Header().Get("X-Error-Code"))
+	assert.Equal(t, "600", rr.Header().Get("Retry-After"))
+	assert.Equal(t, "ru", rr.Header().Get("Content-Language"))
+
+	require.NoError(t, maintenance.Set(maintenance.State{Enabled: true}))
+	assert.Empty(t, serve().Header().Get("Retry-After"))
+
+	interceptor := maintenance.UnaryServerInterceptor()
+	call := func(fullMethod string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: fullMethod},
+			func(ctx context.Context, req any) (any, error) { return nil, nil })
+		return err
+	}
+	assert.Equal(t, codes.Unavailable, status.Code(call("/auth.v1.AuthService/IssueTokens")))
+	assert.Equal(t, codes.Unavailable, status.Code(call("/auth.v1.AuthService/RefreshTokens")))
+	assert.NoError(t, call("/auth.v1.AuthService/ValidateToken"), "validation keeps working")
+	assert.NoError(t, call("/grpc.health.v1.Health/Check"), "health checks keep working")
+}
+
+// Проверка просмотра и переключения режима через /admin/maintenance.
+func TestHandler(t *testing.T) {
+	setup(t, maintenance.State{})
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		maintenance.Handler().ServeHTTP(rr, httptest.NewRequest(method, "/admin/maintenance", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := serve(http.MethodPut, `{"enabled": true, "retry_after": 300}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var s maintenance.State
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &s))
+	assert.Equal(t, maintenance.State{Enabled: true, RetryAfter: 300}, s)
+
+	rr = serve(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &s))
+	assert.True(t, s.Enabled)
+
+	for _, body := range []string{`{"enabled": true, "retry_after": -1}`, `{"message": "later"}`, `not json`} {
+		rr = serve(http.MethodPut, body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		assert.Equal(t, "invalid_maintenance", rr.Header().Get("X-Error-Code"))
+	}
+	assert.Equal(t, maintenance.State{Enabled: true, RetryAfter: 300}, maintenance.Current(), "invalid state must not be applied")
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "{}").Code)
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Границы корзин для длительностей в секундах: от 1 мс до 10 с.
+var DurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Гистограмма с набором меток, экспортируемая в текстовом формате Prometheus.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+type histogram struct {
+	// Количество наблюдений не больше соответствующей границы (не накопленное).
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Создаёт и регистрирует гистограмму.
+//
+// Принимает:
+// - name: имя метрики.
+// - help: описание метрики.
+// - buckets: возрастающие верхние границы корзин (корзина +Inf добавляется автоматически).
+// - labels: имена меток.
+//
+// Возвращает:
+// - указатель на HistogramVec.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+	register(h)
+	return h
+}
+
+// Учитывает наблюдение с указанными значениями меток.
+//
+// Количество значений должно совпадать с количеством меток.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.name, len(h.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = v
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		v.counts[i]++
+	}
+	v.sum += value
+	v.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v := h.values[key]
+		labels := formatLabels(h.labels, key)
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += v.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", strconv.FormatFloat(le, 'g', -1, 64)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, labels, v.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, v.count)
+	}
+}
+
+// Добавляет метку к уже отформатированному набору меток.
+func withLabel(labels, name, value string) string {
+	pair := fmt.Sprintf(`%s="%s"`, name, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return strings.TrimSuffix(labels, "}") + "," + pair + "}"
+}
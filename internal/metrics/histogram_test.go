@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Проверка экспорта гистограммы в текстовом формате Prometheus.
+func TestHistogramVec(t *testing.T) {
+	h := &HistogramVec{
+		name:    "test_duration_seconds",
+		help:    "Test durations.",
+		labels:  []string{"operation"},
+		buckets: []float64{0.1, 1},
+		values:  make(map[string]*histogram),
+	}
+	h.Observe(0.05, "get")
+	h.Observe(0.1, "get")
+	h.Observe(0.5, "get")
+	h.Observe(3, "get")
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	assert.Equal(t, `# HELP test_duration_seconds Test durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{operation="get",le="0.1"} 2
+test_duration_seconds_bucket{operation="get",le="1"} 3
+test_duration_seconds_bucket{operation="get",le="+Inf"} 4
+test_duration_seconds_sum{operation="get"} 3.65
+test_duration_seconds_count{operation="get"} 4
+`, buf.String())
+
+	assert.Panics(t, func() { h.Observe(1) })
+}
@@ -0,0 +1,129 @@
+package migrations
+
+import (
+	"auth_service/internal/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const migrationsDir = "internal/storage/migrations"
+
+// Применённая миграция была изменена после применения.
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+const createChecksumsTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_migration_checksums (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+`
+
+// Файл up-миграции.
+type migrationFile struct {
+	version  uint
+	name     string
+	checksum string
+}
+
+// Проверяет контрольные суммы применённых миграций.
+//
+// Для каждой применённой up-миграции сравнивает SHA-256 файла с суммой,
+// записанной при её применении. Суммы впервые встреченных миграций
+// записываются. Записи о миграциях выше текущей версии (после отката) удаляются.
+//
+// Принимает:
+// - ctx: контекст выполнения.
+// - cfg: указатель на конфигурацию приложения.
+// - version: текущая версия схемы.
+//
+// Возвращает:
+// - ErrChecksumMismatch, если файл применённой миграции был изменён.
+// - ошибку, если проверку не удалось выполнить.
+func VerifyChecksums(ctx context.Context, cfg *config.Config, version uint) error {
+	files, err := readMigrationFiles(migrationsDir)
+	if err != nil {
+		return err
+	}
+
+	conn, err := pgx.Connect(ctx, databaseURL(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, createChecksumsTableQuery); err != nil {
+		return fmt.Errorf("failed to create checksums table: %w", err)
+	}
+	if _, err := conn.Exec(ctx, `DELETE FROM schema_migration_checksums WHERE version > $1`, int64(version)); err != nil {
+		return fmt.Errorf("failed to remove checksums of rolled back migrations: %w", err)
+	}
+
+	for _, file := range files {
+		if file.version > version {
+			break
+		}
+
+		var stored string
+		err := conn.QueryRow(ctx, `SELECT checksum FROM schema_migration_checksums WHERE version = $1`, int64(file.version)).Scan(&stored)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			_, err = conn.Exec(ctx,
+				`INSERT INTO schema_migration_checksums (version, name, checksum) VALUES ($1, $2, $3)`,
+				int64(file.version), file.name, file.checksum,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to record checksum of migration %d: %w", file.version, err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to read checksum of migration %d: %w", file.version, err)
+		case stored != file.checksum:
+			return fmt.Errorf("%w: migration %d (%s) was modified after it had been applied", ErrChecksumMismatch, file.version, file.name)
+		}
+	}
+	return nil
+}
+
+// Читает up-миграции из каталога и вычисляет их контрольные суммы.
+func readMigrationFiles(dir string) ([]migrationFile, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	files := make([]migrationFile, 0, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".up.sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s: %w", path, err)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", path, err)
+		}
+		sum := sha256.Sum256(content)
+
+		files = append(files, migrationFile{
+			version:  uint(version),
+			name:     name,
+			checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].version < files[j].version })
+	return files, nil
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Проверка разбора имён файлов миграций и чувствительности суммы к изменению файла.
+func TestReadMigrationFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	write("000002_add_sessions.up.sql", "CREATE TABLE sessions ();")
+	write("000001_init.up.sql", "CREATE TABLE users ();")
+	write("000001_init.down.sql", "DROP TABLE users;")
+
+	files, err := readMigrationFiles(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, uint(1), files[0].version)
+	assert.Equal(t, "000001_init", files[0].name)
+	assert.Equal(t, uint(2), files[1].version)
+
+	original := files[0].checksum
+	write("000001_init.up.sql", "CREATE TABLE users (id UUID);")
+	files, err = readMigrationFiles(dir)
+	assert.NoError(t, err)
+	assert.NotEqual(t, original, files[0].checksum)
+}
+
+// Проверка того, что реальные миграции репозитория читаются без ошибок.
+func TestReadMigrationFiles_Repository(t *testing.T) {
+	files, err := readMigrationFiles(filepath.Join("..", "storage", "migrations"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+}
@@ -0,0 +1,288 @@
+// Пакет mtls аутентифицирует внутренние сервисы по клиентским сертификатам.
+//
+// Сервис-клиент предъявляет при TLS-рукопожатии сертификат, подписанный
+// доверенным УЦ (например, X.509-SVID SPIFFE). Идентичность клиента — SPIFFE
+// ID из URI SAN сертификата (spiffe://<trust-domain>/<path>), а у
+// сертификатов без SPIFFE ID — Common Name субъекта. Каждой идентичности
+// конфигурацией сопоставлены scope, которые проверяются для служебных
+// маршрутов HTTP (Middleware) и методов gRPC (UnaryServerInterceptor) вместо
+// общих статических секретов.
+package mtls
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/internal/metrics"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Scope внутренних вызовов.
+const (
+	// Служебные маршруты HTTP /admin/*.
+	ScopeAdmin = "admin"
+	// Методы gRPC AuthService.
+	ScopeTokensIssue    = "tokens:issue"
+	ScopeTokensRefresh  = "tokens:refresh"
+	ScopeTokensValidate = "tokens:validate"
+	ScopeSessionsRevoke = "sessions:revoke"
+)
+
+var denied = metrics.NewCounterVec(
+	"auth_mtls_denied_total",
+	"Number of internal calls rejected by client certificate authorization, by API and reason.",
+	"api", "reason",
+)
+
+// Режимы проверки клиентских сертификатов при рукопожатии.
+const (
+	// Сертификат необязателен; предъявленный проверяется по доверенным УЦ.
+	ClientAuthOptional = "optional"
+	// Соединение без действительного сертификата отклоняется при рукопожатии.
+	ClientAuthRequired = "required"
+)
+
+// Возвращает тип проверки клиентских сертификатов crypto/tls для режима.
+//
+// Принимает:
+// - mode: ClientAuthOptional или ClientAuthRequired; пусто — ClientAuthOptional.
+//
+// Возвращает:
+// - тип проверки.
+// - ошибку, если режим неизвестен.
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequired:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unsupported client_auth %q, expected %s or %s", mode, ClientAuthOptional, ClientAuthRequired)
+	}
+}
+
+// Причины отказа (значения метки reason).
+const (
+	reasonNoCertificate = "no_certificate"
+	reasonUnknown       = "unknown_identity"
+	reasonScope         = "missing_scope"
+)
+
+// Сопоставление идентичностей клиентов со scope.
+type Authorizer struct {
+	// Домен доверия SPIFFE; если задан, принимаются только SPIFFE ID этого домена.
+	trustDomain string
+	identities  map[string][]string
+}
+
+// Создаёт Authorizer.
+//
+// Принимает:
+// - trustDomain: домен доверия SPIFFE (например, example.org); пустая строка — любой.
+// - identities: scope по идентичностям (SPIFFE ID или Common Name).
+//
+// Возвращает:
+// - указатель на Authorizer.
+// - ошибку, если SPIFFE ID некорректен или не принадлежит домену доверия.
+func NewAuthorizer(trustDomain string, identities map[string][]string) (*Authorizer, error) {
+	for identity := range identities {
+		if !strings.HasPrefix(identity, "spiffe://") {
+			continue
+		}
+		domain, err := spiffeTrustDomain(identity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SPIFFE ID %q: %w", identity, err)
+		}
+		if trustDomain != "" && domain != trustDomain {
+			return nil, fmt.Errorf("SPIFFE ID %q is outside trust domain %q", identity, trustDomain)
+		}
+	}
+	return &Authorizer{trustDomain: trustDomain, identities: identities}, nil
+}
+
+// Возвращает идентичность клиента по его сертификату.
+//
+// Принимает:
+// - cert: проверенный сертификат клиента.
+//
+// Возвращает:
+// - SPIFFE ID из URI SAN или, если его нет, Common Name субъекта.
+func Identity(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	return cert.Subject.CommonName
+}
+
+// Проверяет, разрешён ли идентичности scope.
+//
+// Принимает:
+// - identity: идентичность клиента.
+// - scope: требуемый scope.
+//
+// Возвращает:
+// - пустую строку, если вызов разрешён, иначе причину отказа.
+func (a *Authorizer) check(identity, scope string) string {
+	if identity == "" {
+		return reasonNoCertificate
+	}
+	if a.trustDomain != "" {
+		if domain, err := spiffeTrustDomain(identity); err != nil || domain != a.trustDomain {
+			return reasonUnknown
+		}
+	}
+	scopes, ok := a.identities[identity]
+	if !ok {
+		return reasonUnknown
+	}
+	if !slices.Contains(scopes, scope) {
+		return reasonScope
+	}
+	return ""
+}
+
+// Возвращает домен доверия SPIFFE ID.
+func spiffeTrustDomain(id string) (string, error) {
+	u, err := url.Parse(id)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "spiffe" || u.Host == "" || u.User != nil || u.Port() != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("not a SPIFFE ID")
+	}
+	return u.Host, nil
+}
+
+// Возвращает идентичность клиента из состояния TLS-соединения; пустую строку,
+// если клиент не предъявил проверенный сертификат.
+func identityFromState(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return Identity(state.VerifiedChains[0][0])
+}
+
+// Возвращает идентичность клиента запроса; пустую строку, если клиент не
+// предъявил проверенный сертификат.
+//
+// Принимает:
+// - r: HTTP-запрос.
+//
+// Возвращает:
+// - SPIFFE ID или Common Name клиентского сертификата.
+func RequestIdentity(r *http.Request) string {
+	return identityFromState(r.TLS)
+}
+
+// Создаёт middleware, пропускающее только клиентов, чьему сертификату разрешён scope.
+//
+// Запрос без проверенного клиентского сертификата получает 401 Unauthorized
+// с кодом client_certificate_required, запрос клиента без scope — 403 Forbidden
+// с кодом insufficient_scope.
+//
+// Принимает:
+// - scope: требуемый scope.
+//
+// Возвращает:
+// - функцию, оборачивающую обработчик.
+func (a *Authorizer) Middleware(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch reason := a.check(identityFromState(r.TLS), scope); reason {
+			case "":
+				next.ServeHTTP(w, r)
+			case reasonNoCertificate:
+				denied.Inc("http", reason)
+				i18n.Error(w, r, "client_certificate_required", http.StatusUnauthorized)
+			default:
+				denied.Inc("http", reason)
+				i18n.Error(w, r, "insufficient_scope", http.StatusForbidden)
+			}
+		})
+	}
+}
+
+// Создаёт перехватчик, проверяющий scope клиентского сертификата для методов gRPC.
+//
+// Методы, которых нет в methodScopes (например, проверки состояния и
+// reflection), доступны без сертификата.
+//
+// Принимает:
+// - methodScopes: scope по полным именам методов (/package.Service/Method).
+//
+// Возвращает:
+// - grpc.UnaryServerInterceptor.
+func (a *Authorizer) UnaryServerInterceptor(methodScopes map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		scope, ok := methodScopes[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		var identity string
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				identity = identityFromState(&tlsInfo.State)
+			}
+		}
+		switch reason := a.check(identity, scope); reason {
+		case "":
+			return handler(ctx, req)
+		case reasonNoCertificate:
+			denied.Inc("grpc", reason)
+			return nil, status.Error(codes.Unauthenticated, "client certificate is required")
+		default:
+			denied.Inc("grpc", reason)
+			return nil, status.Errorf(codes.PermissionDenied, "missing scope %q", scope)
+		}
+	}
+}
+
+// Создаёт конфигурацию TLS сервера, запрашивающую клиентские сертификаты.
+//
+// Сертификат клиента необязателен на уровне рукопожатия, чтобы публичный
+// API и проверки состояния оставались доступны; предъявленный сертификат
+// проверяется по clientCAFile, а scope — в Middleware и
+// UnaryServerInterceptor.
+//
+// Принимает:
+// - certFile, keyFile: сертификат и ключ сервера в PEM.
+// - clientCAFile: сертификаты доверенных УЦ клиентов в PEM (например, SPIFFE trust bundle).
+//
+// Возвращает:
+// - конфигурацию TLS.
+// - ошибку, если файлы не удалось прочитать.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("failed to parse client CA: no certificates in %s", clientCAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,231 @@
+package mtls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	billingID = "spiffe://example.org/ns/billing/sa/api"
+	opsID     = "spiffe://example.org/ns/ops/sa/console"
+)
+
+// Создаёт сертификат, подписанный parent (самоподписанный, если parent nil).
+func newCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func spiffeCert(t *testing.T, id string) *x509.Certificate {
+	t.Helper()
+	uri, err := url.Parse(id)
+	require.NoError(t, err)
+	cert, _ := newCert(t, &x509.Certificate{URIs: []*url.URL{uri}}, nil, nil)
+	return cert
+}
+
+// Состояние соединения с проверенным сертификатом клиента.
+func verifiedState(cert *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func newAuthorizer(t *testing.T, trustDomain string) *Authorizer {
+	t.Helper()
+	a, err := NewAuthorizer(trustDomain, map[string][]string{
+		billingID:      {ScopeTokensValidate},
+		opsID:          {ScopeAdmin, ScopeSessionsRevoke},
+		"legacy-batch": {ScopeAdmin},
+	})
+	require.NoError(t, err)
+	return a
+}
+
+// Проверка определения идентичности по сертификату.
+func TestIdentity(t *testing.T) {
+	assert.Equal(t, billingID, Identity(spiffeCert(t, billingID)))
+
+	cert, _ := newCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "legacy-batch"}}, nil, nil)
+	assert.Equal(t, "legacy-batch", Identity(cert))
+}
+
+// Проверка отклонения идентичностей вне домена доверия.
+func TestNewAuthorizer(t *testing.T) {
+	_, err := NewAuthorizer("example.org", map[string][]string{"spiffe://other.org/sa/api": {ScopeAdmin}})
+	assert.Error(t, err)
+
+	_, err = NewAuthorizer("", map[string][]string{"spiffe:///no-domain": {ScopeAdmin}})
+	assert.Error(t, err)
+
+	a := newAuthorizer(t, "example.org")
+	assert.Equal(t, reasonUnknown, a.check("legacy-batch", ScopeAdmin), "Common Name is not accepted with a trust domain")
+	assert.Empty(t, a.check(opsID, ScopeAdmin))
+}
+
+// Проверка middleware служебных маршрутов.
+func TestMiddleware(t *testing.T) {
+	handler := newAuthorizer(t, "").Middleware(ScopeAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for name, tc := range map[string]struct {
+		state  *tls.ConnectionState
+		status int
+		code   string
+	}{
+		"plaintext":      {state: nil, status: http.StatusUnauthorized, code: "client_certificate_required"},
+		"no certificate": {state: &tls.ConnectionState{}, status: http.StatusUnauthorized, code: "client_certificate_required"},
+		"missing scope":  {state: verifiedState(spiffeCert(t, billingID)), status: http.StatusForbidden, code: "insufficient_scope"},
+		"unknown":        {state: verifiedState(spiffeCert(t, "spiffe://example.org/unknown")), status: http.StatusForbidden, code: "insufficient_scope"},
+		"allowed":        {state: verifiedState(spiffeCert(t, opsID)), status: http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+		req.TLS = tc.state
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tc.status, rec.Code, name)
+		assert.Equal(t, tc.code, rec.Header().Get("X-Error-Code"), name)
+	}
+}
+
+// Проверка перехватчика gRPC.
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := newAuthorizer(t, "example.org").UnaryServerInterceptor(map[string]string{
+		"/auth.v1.AuthService/ValidateToken": ScopeTokensValidate,
+		"/auth.v1.AuthService/IssueTokens":   ScopeTokensIssue,
+	})
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	call := func(method string, cert *x509.Certificate) error {
+		ctx := context.Background()
+		if cert != nil {
+			ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: *verifiedState(cert)}})
+		}
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	assert.NoError(t, call("/auth.v1.AuthService/ValidateToken", spiffeCert(t, billingID)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call("/auth.v1.AuthService/IssueTokens", spiffeCert(t, billingID))))
+	assert.Equal(t, codes.Unauthenticated, status.Code(call("/auth.v1.AuthService/ValidateToken", nil)))
+	assert.NoError(t, call("/grpc.health.v1.Health/Check", nil), "methods without a scope are public")
+}
+
+// Проверка рукопожатия с клиентским сертификатом, подписанным доверенным УЦ.
+func TestServerTLSConfig(t *testing.T) {
+	ca, caKey := newCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	server, serverKey := newCert(t, &x509.Certificate{
+		DNSNames:    []string{"localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	opsURI, _ := url.Parse(opsID)
+	client, clientKey := newCert(t, &x509.Certificate{
+		URIs:        []*url.URL{opsURI},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+		return path
+	}
+	keyDER, err := x509.MarshalECPrivateKey(serverKey)
+	require.NoError(t, err)
+	config, err := ServerTLSConfig(
+		write("server.pem", "CERTIFICATE", server.Raw),
+		write("server-key.pem", "EC PRIVATE KEY", keyDER),
+		write("ca.pem", "CERTIFICATE", ca.Raw),
+	)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(newAuthorizer(t, "example.org").Middleware(ScopeAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(Identity(r.TLS.VerifiedChains[0][0])))
+	})))
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(certs ...tls.Certificate) int {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: certs}}}
+		resp, err := c.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, get(tls.Certificate{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}))
+	assert.Equal(t, http.StatusUnauthorized, get(), "connections without a certificate reach the middleware")
+
+	// В режиме required соединение без сертификата отклоняется при рукопожатии.
+	clientAuth, err := ParseClientAuth(ClientAuthRequired)
+	require.NoError(t, err)
+	required := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	required.TLS = config.Clone()
+	required.TLS.ClientAuth = clientAuth
+	required.StartTLS()
+	defer required.Close()
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}}
+	_, err = c.Get(required.URL)
+	assert.Error(t, err)
+	c.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}}}}
+	resp, err := c.Get(required.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = ServerTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
+
+func TestParseClientAuth(t *testing.T) {
+	for mode, want := range map[string]tls.ClientAuthType{
+		"":                 tls.VerifyClientCertIfGiven,
+		ClientAuthOptional: tls.VerifyClientCertIfGiven,
+		ClientAuthRequired: tls.RequireAndVerifyClientCert,
+	} {
+		got, err := ParseClientAuth(mode)
+		require.NoError(t, err, mode)
+		assert.Equal(t, want, got, mode)
+	}
+	_, err := ParseClientAuth("request")
+	assert.Error(t, err)
+}
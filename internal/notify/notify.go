@@ -0,0 +1,297 @@
+// Пакет notify формирует письма-уведомления пользователям на их языке.
+//
+// Шаблоны писем сгруппированы по языкам: templates/<язык>/<имя>.tmpl. Каждый
+// шаблон определяет блоки subject и body (text/template) и может определить
+// блок html — HTML-версию письма (html/template, значения экранируются).
+// Шаблоны английского и русского языков встроены в сервис; дополнительные
+// языки и изменённые тексты загружаются из директории на диске (LoadDir) без
+// пересборки.
+//
+// Кроме данных письма, шаблонам доступны переменные, заданные в конфигурации
+// (SetVariables): {{var "support_email"}}.
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Имена шаблонов писем.
+const (
+	// Предупреждение о смене IP-адреса клиента (данные — IPChangeData).
+	IPChange = "ip_change"
+	// Вход с нового устройства (данные — NewDeviceData).
+	NewDevice = "new_device"
+	// Ссылка для сброса пароля (данные — PasswordResetData).
+	PasswordReset = "password_reset"
+	// Подтверждение email (данные — VerificationData).
+	Verification = "verification"
+)
+
+// Имена встроенных шаблонов; каждый встроенный язык определяет их все.
+var Names = []string{IPChange, NewDevice, PasswordReset, Verification}
+
+// Данные шаблона IPChange.
+type IPChangeData struct {
+	PreviousIP string
+	CurrentIP  string
+	Time       time.Time
+}
+
+// Данные шаблона NewDevice.
+type NewDeviceData struct {
+	// Название устройства и платформа, как их сообщил клиент; могут быть пустыми.
+	DeviceName string
+	Platform   string
+	ClientIP   string
+	Time       time.Time
+}
+
+// Данные шаблона PasswordReset.
+type PasswordResetData struct {
+	// Ссылка на форму нового пароля.
+	Link      string
+	ExpiresAt time.Time
+	// Адрес клиента, запросившего сброс.
+	ClientIP string
+}
+
+// Данные шаблона Verification.
+type VerificationData struct {
+	// Ссылка подтверждения.
+	Link string
+	// Код для ввода вручную; может быть пустым.
+	Code      string
+	ExpiresAt time.Time
+}
+
+// Письмо, готовое к отправке.
+type Message struct {
+	// Язык, на котором сформировано письмо.
+	Locale  string
+	Subject string
+	// Текстовая версия письма.
+	Body string
+	// HTML-версия письма; пустая, если шаблон не определяет блок html.
+	HTML string
+}
+
+//go:embed templates
+var embedded embed.FS
+
+// Шаблон письма: текстовые блоки и необязательная HTML-версия.
+type emailTemplate struct {
+	text *template.Template
+	// nil, если шаблон не определяет блок html.
+	html *htmltemplate.Template
+}
+
+// Наборы шаблонов писем по языкам.
+type Templates struct {
+	sets          map[string]map[string]emailTemplate
+	defaultLocale string
+	// Переменные, доступные шаблонам через функцию var.
+	vars map[string]string
+}
+
+// Используемые сервисом шаблоны.
+var templates = mustTemplates()
+
+// Создаёт наборы со встроенными шаблонами; язык по умолчанию — en.
+//
+// Возвращает:
+// - указатель на Templates.
+// - ошибку, если встроенный шаблон повреждён.
+func NewTemplates() (*Templates, error) {
+	t := &Templates{sets: make(map[string]map[string]emailTemplate), defaultLocale: "en", vars: make(map[string]string)}
+	if err := t.load(embedded, "templates"); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Создаёт наборы со встроенными шаблонами; встроенные шаблоны проверяются тестами.
+func mustTemplates() *Templates {
+	t, err := NewTemplates()
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Загружает шаблоны <язык>/<имя>.tmpl из директории.
+//
+// Шаблоны дополняют наборы языков, заменяя встроенные шаблоны с теми же именами.
+//
+// Принимает:
+// - dir: путь к директории с шаблонами.
+//
+// Возвращает:
+// - ошибку, если директорию или шаблон не удалось прочитать или разобрать.
+func (t *Templates) LoadDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("failed to open email templates directory: %w", err)
+	}
+	return t.load(os.DirFS(dir), ".")
+}
+
+// Загружает шаблоны из файловой системы.
+func (t *Templates) load(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*", "*.tmpl"))
+	if err != nil {
+		return fmt.Errorf("failed to list email templates: %w", err)
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read email template: %w", err)
+		}
+		tmpl, err := t.parse(file, string(data))
+		if err != nil {
+			return err
+		}
+
+		locale := strings.ToLower(path.Base(path.Dir(file)))
+		name := strings.TrimSuffix(path.Base(file), ".tmpl")
+		if t.sets[locale] == nil {
+			t.sets[locale] = make(map[string]emailTemplate)
+		}
+		t.sets[locale][name] = tmpl
+	}
+	return nil
+}
+
+// Разбирает шаблон письма. Текстовые блоки разбираются text/template, блок
+// html — html/template, который экранирует подставляемые значения.
+func (t *Templates) parse(name, source string) (emailTemplate, error) {
+	funcs := map[string]any{"var": t.variable}
+	text, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(source)
+	if err != nil {
+		return emailTemplate{}, fmt.Errorf("failed to parse email template %s: %w", name, err)
+	}
+	if text.Lookup("subject") == nil || text.Lookup("body") == nil {
+		return emailTemplate{}, fmt.Errorf("email template %s must define subject and body", name)
+	}
+	tmpl := emailTemplate{text: text}
+	if text.Lookup("html") != nil {
+		tmpl.html, err = htmltemplate.New(name).Option("missingkey=error").Funcs(funcs).Parse(source)
+		if err != nil {
+			return emailTemplate{}, fmt.Errorf("failed to parse email template %s: %w", name, err)
+		}
+	}
+	return tmpl, nil
+}
+
+// Возвращает переменную шаблонов (функция var).
+func (t *Templates) variable(name string) (string, error) {
+	value, ok := t.vars[name]
+	if !ok {
+		return "", fmt.Errorf("template variable %q is not set", name)
+	}
+	return value, nil
+}
+
+// Задаёт переменные, доступные шаблонам через {{var "имя"}}: название
+// сервиса, адрес поддержки и т.п. Обращение к незаданной переменной — ошибка
+// формирования письма.
+//
+// Принимает:
+// - vars: значения по именам; заменяют заданные ранее.
+func (t *Templates) SetVariables(vars map[string]string) {
+	t.vars = maps.Clone(vars)
+	if t.vars == nil {
+		t.vars = make(map[string]string)
+	}
+}
+
+// Устанавливает язык писем пользователей, язык которых не задан или не поддерживается.
+//
+// Принимает:
+// - locale: язык, для которого загружены шаблоны.
+//
+// Возвращает:
+// - ошибку, если шаблонов для языка нет.
+func (t *Templates) SetDefaultLocale(locale string) error {
+	locale = strings.ToLower(locale)
+	if _, ok := t.sets[locale]; !ok {
+		return fmt.Errorf("no email templates for locale %q", locale)
+	}
+	t.defaultLocale = locale
+	return nil
+}
+
+// Формирует письмо на языке пользователя.
+//
+// Шаблон ищется для языка пользователя, затем для его основного языка (ru для
+// ru-RU) и, наконец, для языка по умолчанию.
+//
+// Принимает:
+// - locale: предпочитаемый язык пользователя; пустая строка — язык по умолчанию.
+// - name: имя шаблона.
+// - data: данные шаблона.
+//
+// Возвращает:
+// - письмо.
+// - ошибку, если шаблон не найден или не выполнился.
+func (t *Templates) Render(locale, name string, data any) (Message, error) {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	base, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range []string{locale, base, t.defaultLocale} {
+		tmpl, ok := t.sets[candidate][name]
+		if !ok {
+			continue
+		}
+
+		var subject, body bytes.Buffer
+		if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+			return Message{}, fmt.Errorf("failed to render email subject: %w", err)
+		}
+		if err := tmpl.text.ExecuteTemplate(&body, "body", data); err != nil {
+			return Message{}, fmt.Errorf("failed to render email body: %w", err)
+		}
+		message := Message{
+			Locale:  candidate,
+			Subject: strings.TrimSpace(subject.String()),
+			Body:    strings.TrimSpace(body.String()) + "\n",
+		}
+		if tmpl.html != nil {
+			var html bytes.Buffer
+			if err := tmpl.html.ExecuteTemplate(&html, "html", data); err != nil {
+				return Message{}, fmt.Errorf("failed to render email HTML: %w", err)
+			}
+			message.HTML = strings.TrimSpace(html.String()) + "\n"
+		}
+		return message, nil
+	}
+	return Message{}, fmt.Errorf("email template %q not found", name)
+}
+
+// Загружает дополнительные шаблоны в используемые сервисом наборы. Вызывается
+// при запуске до отправки первых писем.
+func LoadDir(dir string) error {
+	return templates.LoadDir(dir)
+}
+
+// Устанавливает язык писем по умолчанию для используемых сервисом шаблонов.
+func SetDefaultLocale(locale string) error {
+	return templates.SetDefaultLocale(locale)
+}
+
+// Задаёт переменные используемых сервисом шаблонов (см. Templates.SetVariables).
+func SetVariables(vars map[string]string) {
+	templates.SetVariables(vars)
+}
+
+// Формирует письмо по используемым сервисом шаблонам (см. Templates.Render).
+func Render(locale, name string, data any) (Message, error) {
+	return templates.Render(locale, name, data)
+}
@@ -0,0 +1,143 @@
+package notify_test
+
+import (
+	"auth_service/internal/notify"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ipChange = notify.IPChangeData{
+	PreviousIP: "203.0.113.7",
+	CurrentIP:  "198.51.100.1",
+	Time:       time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+}
+
+// Данные встроенных шаблонов по именам.
+var samples = map[string]any{
+	notify.IPChange:      ipChange,
+	notify.NewDevice:     notify.NewDeviceData{DeviceName: "Pixel 8", Platform: "android", ClientIP: "198.51.100.1", Time: ipChange.Time},
+	notify.PasswordReset: notify.PasswordResetData{Link: "https://example.com/reset?token=abc", ExpiresAt: ipChange.Time, ClientIP: "198.51.100.1"},
+	notify.Verification:  notify.VerificationData{Link: "https://example.com/verify?token=abc", Code: "123456", ExpiresAt: ipChange.Time},
+}
+
+// Проверка, что каждый встроенный язык определяет все шаблоны с HTML-версией.
+func TestTemplates_Embedded(t *testing.T) {
+	templates, err := notify.NewTemplates()
+	require.NoError(t, err)
+
+	for _, locale := range []string{"en", "ru"} {
+		for _, name := range notify.Names {
+			t.Run(fmt.Sprintf("%s/%s", locale, name), func(t *testing.T) {
+				message, err := templates.Render(locale, name, samples[name])
+				require.NoError(t, err)
+				assert.Equal(t, locale, message.Locale)
+				assert.NotEmpty(t, message.Subject)
+				assert.NotEmpty(t, message.Body)
+				assert.NotEmpty(t, message.HTML)
+			})
+		}
+	}
+}
+
+// Проверка экранирования значений в HTML-версии письма.
+func TestTemplates_HTMLEscaping(t *testing.T) {
+	templates, err := notify.NewTemplates()
+	require.NoError(t, err)
+
+	message, err := templates.Render("en", notify.NewDevice, notify.NewDeviceData{DeviceName: `<script>alert(1)</script>`, ClientIP: "198.51.100.1", Time: ipChange.Time})
+	require.NoError(t, err)
+	assert.Contains(t, message.Body, `Device: <script>alert(1)</script>`, "text version is not escaped")
+	assert.NotContains(t, message.HTML, "<script>")
+	assert.Contains(t, message.HTML, "&lt;script&gt;")
+
+	// Ссылки с небезопасной схемой не подставляются в href.
+	message, err = templates.Render("en", notify.PasswordReset, notify.PasswordResetData{Link: "javascript:alert(1)", ExpiresAt: ipChange.Time})
+	require.NoError(t, err)
+	assert.NotContains(t, message.HTML, `href="javascript:`)
+}
+
+// Проверка переменных шаблонов.
+func TestTemplates_Variables(t *testing.T) {
+	templates, err := notify.NewTemplates()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "en"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en", "ip_change.tmpl"), []byte(
+		`{{define "subject"}}{{var "service_name"}}: new address{{end}}`+
+			`{{define "body"}}Contact {{var "support_email"}}{{end}}`+
+			`{{define "html"}}<a href="mailto:{{var "support_email"}}">{{var "service_name"}}</a>{{end}}`), 0o600))
+	require.NoError(t, templates.LoadDir(dir))
+
+	_, err = templates.Render("en", notify.IPChange, ipChange)
+	assert.ErrorContains(t, err, `"service_name" is not set`)
+
+	templates.SetVariables(map[string]string{"service_name": "Example & Co", "support_email": "help@example.com"})
+	message, err := templates.Render("en", notify.IPChange, ipChange)
+	require.NoError(t, err)
+	assert.Equal(t, "Example & Co: new address", message.Subject)
+	assert.Equal(t, "Contact help@example.com\n", message.Body)
+	assert.Equal(t, `<a href="mailto:help@example.com">Example &amp; Co</a>`+"\n", message.HTML)
+}
+
+// Проверка выбора языка письма.
+func TestTemplates_Render(t *testing.T) {
+	templates, err := notify.NewTemplates()
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"":      "en",
+		"ru":    "ru",
+		"ru-RU": "ru",
+		"ru_RU": "ru",
+		"EN-gb": "en",
+		"fr":    "en",
+	}
+	for locale, want := range tests {
+		message, err := templates.Render(locale, notify.IPChange, ipChange)
+		require.NoError(t, err, locale)
+		assert.Equal(t, want, message.Locale, locale)
+	}
+
+	message, err := templates.Render("ru", notify.IPChange, ipChange)
+	require.NoError(t, err)
+	assert.Equal(t, "Вход в аккаунт с нового адреса", message.Subject)
+	assert.Contains(t, message.Body, "Новый адрес: 198.51.100.1")
+	assert.Contains(t, message.Body, "01.05.2024 12:30 UTC")
+
+	_, err = templates.Render("en", "unknown", nil)
+	assert.Error(t, err)
+}
+
+// Проверка загрузки шаблонов из директории и языка по умолчанию.
+func TestTemplates_LoadDir(t *testing.T) {
+	templates, err := notify.NewTemplates()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "de"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de", "ip_change.tmpl"),
+		[]byte(`{{define "subject"}}Neue Adresse{{end}}{{define "body"}}Neue Adresse: {{.CurrentIP}}{{end}}`), 0o600))
+	require.NoError(t, templates.LoadDir(dir))
+
+	message, err := templates.Render("de-AT", notify.IPChange, ipChange)
+	require.NoError(t, err)
+	assert.Equal(t, "Neue Adresse", message.Subject)
+	assert.Equal(t, "Neue Adresse: 198.51.100.1\n", message.Body)
+
+	require.NoError(t, templates.SetDefaultLocale("ru"))
+	message, err = templates.Render("fr", notify.IPChange, ipChange)
+	require.NoError(t, err)
+	assert.Equal(t, "ru", message.Locale)
+	assert.Error(t, templates.SetDefaultLocale("es"))
+
+	assert.Error(t, templates.LoadDir(filepath.Join(dir, "missing")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de", "broken.tmpl"), []byte(`{{define "subject"}}x{{end}}`), 0o600))
+	assert.Error(t, templates.LoadDir(dir), "template without body")
+}
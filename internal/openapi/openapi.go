@@ -0,0 +1,37 @@
+// Пакет openapi содержит спецификацию OpenAPI 3 HTTP API сервиса и страницу Swagger UI.
+//
+// Спецификация поддерживается вручную в openapi.json; её соответствие
+// маршрутам и структурам ответов проверяется тестами пакета handlers.
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed docs.html
+var docs []byte
+
+// Возвращает спецификацию OpenAPI в формате JSON.
+func Spec() []byte {
+	return spec
+}
+
+// Возвращает обработчик, отдающий спецификацию (/openapi.json).
+func SpecHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(spec)
+	})
+}
+
+// Возвращает обработчик, отдающий страницу Swagger UI (/docs).
+func DocsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(docs)
+	})
+}
@@ -0,0 +1,221 @@
+// Пакет outbox гарантирует доставку событий ротации refresh-токенов и смены
+// IP-адреса клиента (transactional outbox).
+//
+// Сервис сохраняет события в таблицу outbox в одной транзакции с ротацией
+// токена (storage.Outbox), поэтому событие не теряется, если процесс
+// остановится между обновлением сессии и публикацией. Relay периодически
+// выбирает сохранённые события и передаёт их обработчикам событий
+// безопасности (webhook, журнал аудита, брокер сообщений); событие удаляется
+// только после того, как все обработчики его приняли, а при ошибке
+// публикуется повторно с экспоненциальной паузой.
+//
+// Доставка выполняется не менее одного раза: после сбоя или повторной
+// попытки обработчик может получить событие снова, поэтому получатели
+// отбрасывают дубли по идентификатору события (security.Event.ID). Порядок
+// публикации событий разных сессий не гарантируется.
+package outbox
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"auth_service/lib/clock"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var published = metrics.NewCounterVec(
+	"auth_outbox_published_total",
+	"Number of outbox publish attempts, by event type and result (success, failure).",
+	"type", "result",
+)
+
+// Пауза перед повторной публикацией по умолчанию.
+var DefaultBackoff = Backoff{Initial: 5 * time.Second, Max: 5 * time.Minute}
+
+// Пауза перед повторной публикацией события.
+type Backoff struct {
+	// Пауза после первой неудачной попытки; каждая следующая вдвое больше.
+	Initial time.Duration
+	// Наибольшая пауза между попытками.
+	Max time.Duration
+}
+
+// Проверяет паузы.
+func (b Backoff) Validate() error {
+	if b.Initial <= 0 {
+		return errors.New("outbox initial_backoff must be positive")
+	}
+	if b.Max < b.Initial {
+		return errors.New("outbox max_backoff must not be less than initial_backoff")
+	}
+	return nil
+}
+
+// Возвращает паузу перед следующей попыткой.
+//
+// Принимает:
+// - attempts: количество выполненных неудачных попыток (не меньше 1).
+//
+// Возвращает:
+// - Initial·2^(attempts-1), но не больше Max.
+func (b Backoff) Delay(attempts int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < attempts && delay < b.Max; i++ {
+		delay *= 2
+	}
+	return min(delay, b.Max)
+}
+
+// Событие в сохраняемом виде.
+type record struct {
+	Type      string            `json:"type"`
+	Severity  string            `json:"severity"`
+	Time      time.Time         `json:"time"`
+	UserID    string            `json:"user_id"`
+	SessionID string            `json:"session_id,omitempty"`
+	ClientIP  string            `json:"client_ip,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Подготавливает событие к сохранению в outbox и назначает ему идентификатор.
+//
+// Принимает:
+// - event: событие безопасности.
+//
+// Возвращает:
+// - запись outbox.
+// - ошибку, если событие не удалось сериализовать.
+func Encode(event security.Event) (storage.OutboxEvent, error) {
+	payload, err := json.Marshal(record{
+		Type:      event.Type,
+		Severity:  string(event.Severity),
+		Time:      event.Time.UTC(),
+		UserID:    event.UserID,
+		SessionID: event.SessionID,
+		ClientIP:  event.ClientIP,
+		Details:   event.Details,
+	})
+	if err != nil {
+		return storage.OutboxEvent{}, fmt.Errorf("failed to encode outbox event: %w", err)
+	}
+	return storage.OutboxEvent{ID: uuid.NewString(), Type: event.Type, Payload: payload}, nil
+}
+
+// Восстанавливает событие из записи outbox.
+func decode(e storage.OutboxEvent) (security.Event, error) {
+	var r record
+	if err := json.Unmarshal(e.Payload, &r); err != nil {
+		return security.Event{}, fmt.Errorf("failed to decode outbox event: %w", err)
+	}
+	return security.Event{
+		ID:        e.ID,
+		Type:      r.Type,
+		Severity:  security.Severity(r.Severity),
+		Time:      r.Time,
+		UserID:    r.UserID,
+		SessionID: r.SessionID,
+		ClientIP:  r.ClientIP,
+		Details:   r.Details,
+	}, nil
+}
+
+// Получатель событий outbox.
+type Publisher interface {
+	// Публикует событие; при ошибке публикация будет повторена.
+	Publish(ctx context.Context, event security.Event) error
+}
+
+// Публикует события, сохранённые в outbox.
+type Relay struct {
+	log       *slog.Logger
+	store     storage.Outbox
+	publisher Publisher
+	backoff   Backoff
+	clock     clock.Clock
+}
+
+// Создаёт Relay.
+//
+// Принимает:
+// - log: указатель на logger.
+// - store: хранилище outbox.
+// - publisher: получатель событий (обычно security.NewDefaultPipeline).
+// - backoff: пауза перед повторной публикацией.
+//
+// Возвращает:
+// - указатель на Relay.
+func NewRelay(log *slog.Logger, store storage.Outbox, publisher Publisher, backoff Backoff) *Relay {
+	return &Relay{log: log, store: store, publisher: publisher, backoff: backoff, clock: clock.Real{}}
+}
+
+// Устанавливает источник времени (для тестов).
+func (r *Relay) WithClock(c clock.Clock) *Relay {
+	r.clock = c
+	return r
+}
+
+// Публикует события, время попытки которых наступило. Вызывается
+// периодически на одной реплике.
+//
+// Принимает:
+// - ctx: контекст; при отмене обработка прерывается.
+// - limit: наибольшее количество событий за один вызов.
+//
+// Возвращает:
+// - количество опубликованных событий.
+// - ошибку, если события не удалось выбрать.
+func (r *Relay) ProcessDue(ctx context.Context, limit int) (int, error) {
+	due, err := r.store.DueOutboxEvents(r.clock.Now(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select due outbox events: %w", err)
+	}
+
+	sent := 0
+	for _, e := range due {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		if r.publish(ctx, e) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// Публикует одно событие и удаляет его либо назначает повторную попытку.
+func (r *Relay) publish(ctx context.Context, e storage.OutboxEvent) bool {
+	event, err := decode(e)
+	if err == nil {
+		err = r.publisher.Publish(ctx, event)
+	}
+	if err != nil {
+		published.Inc(e.Type, "failure")
+		attempts := e.Attempts + 1
+		next := r.clock.Now().Add(r.backoff.Delay(attempts))
+		r.log.Warn("Failed to publish outbox event, retry scheduled",
+			slog.String("event_id", e.ID),
+			slog.String("type", e.Type),
+			slog.Int("attempts", attempts),
+			slog.Time("next_attempt_at", next),
+			slog.String("error", err.Error()),
+		)
+		if err := r.store.RetryOutboxEvent(e.ID, attempts, next, err.Error()); err != nil {
+			r.log.Error("Failed to update outbox event", slog.String("event_id", e.ID), slog.String("error", err.Error()))
+		}
+		return false
+	}
+
+	published.Inc(e.Type, "success")
+	// Если удалить не удалось, событие будет опубликовано повторно.
+	if err := r.store.DeleteOutboxEvent(e.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		r.log.Error("Failed to delete published outbox event", slog.String("event_id", e.ID), slog.String("error", err.Error()))
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/memory"
+	"auth_service/lib/clock"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userID = "123e4567-e89b-12d3-a456-426614174000"
+
+// Получатель-заглушка, сохраняющий события и возвращающий заданную ошибку.
+type fakePublisher struct {
+	err    error
+	events []security.Event
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, event security.Event) error {
+	f.events = append(f.events, event)
+	return f.err
+}
+
+// Сохраняет события вместе с ротацией токена новой сессии.
+func rotate(t *testing.T, db *memory.MemoryStorage, clk clock.Clock, events ...security.Event) []storage.OutboxEvent {
+	t.Helper()
+	sessionID, err := db.SaveRefreshToken(userID, "hash-1", "192.0.2.1", clk.Now().Add(time.Hour))
+	require.NoError(t, err)
+	records := make([]storage.OutboxEvent, 0, len(events))
+	for _, event := range events {
+		record, err := Encode(event)
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+	require.NoError(t, db.UpdateRefreshTokenWithEvents(sessionID, "hash-1", "hash-2", "192.0.2.2", clk.Now().Add(time.Hour), records))
+	return records
+}
+
+// Проверка публикации, повторной попытки после ошибки и удаления опубликованных событий.
+func TestRelay_ProcessDue(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	db := memory.NewMemoryStorage().WithClock(clk)
+	db.CreateUser(userID, "alice@example.com")
+	publisher := &fakePublisher{err: errors.New("broker unavailable")}
+	relay := NewRelay(slog.New(slog.NewTextHandler(io.Discard, nil)), db, publisher, Backoff{Initial: time.Second, Max: time.Minute}).WithClock(clk)
+
+	records := rotate(t, db, clk, security.Event{
+		Type:      security.EventIPChange,
+		Severity:  security.SeverityMedium,
+		Time:      clk.Now(),
+		UserID:    userID,
+		SessionID: "session",
+		ClientIP:  "192.0.2.2",
+		Details:   map[string]string{"previous_ip": "192.0.2.1"},
+	})
+
+	sent, err := relay.ProcessDue(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+	require.Len(t, publisher.events, 1)
+	event := publisher.events[0]
+	assert.Equal(t, records[0].ID, event.ID)
+	assert.Equal(t, security.EventIPChange, event.Type)
+	assert.Equal(t, security.SeverityMedium, event.Severity)
+	assert.True(t, clk.Now().Equal(event.Time))
+	assert.Equal(t, map[string]string{"previous_ip": "192.0.2.1"}, event.Details)
+
+	// До окончания паузы событие не публикуется повторно.
+	sent, err = relay.ProcessDue(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+	assert.Len(t, publisher.events, 1)
+
+	clk.Advance(time.Second)
+	publisher.err = nil
+	sent, err = relay.ProcessDue(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	require.Len(t, publisher.events, 2)
+	assert.Equal(t, records[0].ID, publisher.events[1].ID, "retries keep the event id")
+
+	due, err := db.DueOutboxEvents(clk.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due, "published events are deleted")
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 5 * time.Second}
+	assert.Equal(t, time.Second, b.Delay(1))
+	assert.Equal(t, 2*time.Second, b.Delay(2))
+	assert.Equal(t, 4*time.Second, b.Delay(3))
+	assert.Equal(t, 5*time.Second, b.Delay(10))
+
+	assert.NoError(t, DefaultBackoff.Validate())
+	assert.Error(t, Backoff{}.Validate())
+	assert.Error(t, Backoff{Initial: time.Minute, Max: time.Second}.Validate())
+}
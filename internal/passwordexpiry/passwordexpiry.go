@@ -0,0 +1,140 @@
+// Пакет passwordexpiry ограничивает срок действия пароля: пароль, который не
+// менялся дольше MaxAge, считается истёкшим.
+//
+// Вход с истёкшим паролем проходит, но в ответе отмечается флагом
+// password_expired, чтобы клиент предложил сменить пароль. Обновление токенов
+// после истечения пароля разрешено ещё RefreshGrace и тоже отмечается
+// флагом; затем оно отклоняется с ErrExpired, пока пароль не сменят.
+// Время смены пароля хранится в хранилище (storage.PasswordAge).
+package passwordexpiry
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/storage"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Пароль истёк, и обновление токенов больше не разрешено.
+var ErrExpired = errors.New("password has expired")
+
+var expired = metrics.NewCounterVec(
+	"auth_password_expired_total",
+	"Number of logins and token refreshes with an expired password, by action (login, refresh) and result (flagged, rejected).",
+	"action", "result",
+)
+
+// Политика срока действия пароля.
+type Policy struct {
+	// Срок действия пароля; 0 — пароли не истекают.
+	MaxAge time.Duration
+	// Сколько после истечения пароля ещё разрешено обновлять токены.
+	RefreshGrace time.Duration
+}
+
+// Сообщает, что срок действия пароля ограничен.
+func (p Policy) Enabled() bool {
+	return p.MaxAge > 0
+}
+
+// Проверяет политику.
+func (p Policy) Validate() error {
+	if p.MaxAge < 0 || p.RefreshGrace < 0 {
+		return fmt.Errorf("max_age and refresh_grace must not be negative, got %s and %s", p.MaxAge, p.RefreshGrace)
+	}
+	return nil
+}
+
+var (
+	mu     sync.RWMutex
+	policy Policy
+	store  storage.PasswordAge
+	now    = time.Now
+)
+
+// Устанавливает политику и хранилище времени смены паролей. Вызывается при запуске.
+//
+// Принимает:
+// - s: хранилище; nil — пароли не истекают.
+// - p: политика.
+//
+// Возвращает:
+// - ошибку, если политика некорректна; в этом случае действующая политика не меняется.
+func Set(s storage.PasswordAge, p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	store, policy = s, p
+	return nil
+}
+
+// Возвращает хранилище и политику, если срок действия паролей ограничен.
+func current() (storage.PasswordAge, Policy, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return store, policy, store != nil && policy.Enabled()
+}
+
+// Возвращает время истечения пароля пользователя или нулевое время, если
+// пароль не истекает (политика выключена, время смены не известно или
+// пользователя нет в хранилище).
+func expiresAt(userID string) (time.Time, Policy, error) {
+	s, p, ok := current()
+	if !ok {
+		return time.Time{}, p, nil
+	}
+	changedAt, err := s.GetPasswordChangedAt(userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return time.Time{}, p, nil
+	}
+	if err != nil {
+		return time.Time{}, p, fmt.Errorf("failed to check password age: %w", err)
+	}
+	if changedAt.IsZero() {
+		return time.Time{}, p, nil
+	}
+	return changedAt.Add(p.MaxAge), p, nil
+}
+
+// Проверяет пароль пользователя при входе.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - true, если пароль истёк.
+// - ошибку хранилища, если время смены пароля не удалось получить.
+func CheckLogin(userID string) (bool, error) {
+	expiry, _, err := expiresAt(userID)
+	if err != nil || expiry.IsZero() || now().Before(expiry) {
+		return false, err
+	}
+	expired.Inc("login", "flagged")
+	return true, nil
+}
+
+// Проверяет пароль пользователя при обновлении токенов.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - true, если пароль истёк, но обновление ещё разрешено.
+// - ErrExpired, если пароль истёк дольше RefreshGrace назад.
+// - ошибку хранилища, если время смены пароля не удалось получить.
+func CheckRefresh(userID string) (bool, error) {
+	expiry, p, err := expiresAt(userID)
+	if err != nil || expiry.IsZero() || now().Before(expiry) {
+		return false, err
+	}
+	if !now().Before(expiry.Add(p.RefreshGrace)) {
+		expired.Inc("refresh", "rejected")
+		return true, ErrExpired
+	}
+	expired.Inc("refresh", "flagged")
+	return true, nil
+}
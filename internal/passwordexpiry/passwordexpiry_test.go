@@ -0,0 +1,74 @@
+package passwordexpiry
+
+import (
+	"auth_service/internal/storage/memory"
+	"auth_service/lib/clock"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userID = "123e4567-e89b-12d3-a456-426614174000"
+
+// Проверка флага истёкшего пароля, отсрочки обновления и смены пароля.
+func TestCheck(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	now = clk.Now
+	store := memory.NewMemoryStorage().WithClock(clk)
+	store.CreateUser(userID, "alice@example.com")
+	require.NoError(t, store.SetPassword(userID, "hash"))
+	require.NoError(t, Set(store, Policy{MaxAge: 90 * 24 * time.Hour, RefreshGrace: time.Hour}))
+	t.Cleanup(func() { now = time.Now; Set(nil, Policy{}) })
+
+	expired, err := CheckLogin(userID)
+	require.NoError(t, err)
+	assert.False(t, expired)
+
+	clk.Advance(90 * 24 * time.Hour)
+	expired, err = CheckLogin(userID)
+	require.NoError(t, err)
+	assert.True(t, expired, "login succeeds with the flag set")
+	expired, err = CheckRefresh(userID)
+	require.NoError(t, err)
+	assert.True(t, expired, "refresh is allowed during the grace period")
+
+	clk.Advance(time.Hour)
+	_, err = CheckRefresh(userID)
+	assert.ErrorIs(t, err, ErrExpired)
+
+	// После смены пароля срок отсчитывается заново.
+	require.NoError(t, store.SetPassword(userID, "new-hash"))
+	expired, err = CheckRefresh(userID)
+	require.NoError(t, err)
+	assert.False(t, expired)
+}
+
+// Проверка пользователей без известного времени смены пароля и выключенной политики.
+func TestCheck_NotTracked(t *testing.T) {
+	store := memory.NewMemoryStorage()
+	store.CreateUser(userID, "alice@example.com")
+	require.NoError(t, Set(store, Policy{MaxAge: time.Nanosecond}))
+	t.Cleanup(func() { Set(nil, Policy{}) })
+
+	expired, err := CheckRefresh(userID)
+	require.NoError(t, err)
+	assert.False(t, expired, "password was never set")
+	expired, err = CheckLogin("00000000-0000-0000-0000-000000000001")
+	require.NoError(t, err)
+	assert.False(t, expired, "unknown users are not checked")
+
+	require.NoError(t, store.SetPassword(userID, "hash"))
+	require.NoError(t, Set(store, Policy{}))
+	expired, err = CheckRefresh(userID)
+	require.NoError(t, err)
+	assert.False(t, expired)
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	assert.NoError(t, Policy{}.Validate())
+	assert.NoError(t, Policy{MaxAge: time.Hour, RefreshGrace: time.Hour}.Validate())
+	assert.Error(t, Policy{MaxAge: -time.Hour}.Validate())
+	assert.Error(t, Policy{MaxAge: time.Hour, RefreshGrace: -time.Hour}.Validate())
+}
@@ -0,0 +1,27 @@
+// Пакет profiling предоставляет обработчики net/http/pprof для служебного
+// сервера профилирования (секция debug_server конфигурации).
+//
+// Основной HTTP API использует собственный маршрутизатор (а не
+// http.DefaultServeMux, в котором net/http/pprof регистрируется при импорте),
+// поэтому профили доступны только на адресе служебного сервера.
+package profiling
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// Возвращает обработчик профилей по путям /debug/pprof/...: heap,
+// goroutine, allocs, block, mutex, threadcreate, profile (CPU), trace.
+//
+// Возвращает:
+// - http.Handler.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,75 @@
+package pwned_test
+
+import (
+	"auth_service/internal/pwned"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// SHA-1 пароля "password": 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+const (
+	breachedPrefix = "5BAA6"
+	breachedSuffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+)
+
+// Запускает сервис диапазонов, сохраняющий запрошенный путь.
+func newRangeServer(t *testing.T, status int, body string) (*httptest.Server, *string) {
+	t.Helper()
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		assert.Equal(t, "true", r.Header.Get("Add-Padding"))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &path
+}
+
+func TestChecker_Count(t *testing.T) {
+	body := strings.Join([]string{
+		"0018A45C4D1DEF81644B54AB7F969B88D65:1",
+		strings.ToLower(breachedSuffix) + ":3861493",
+		"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:0",
+	}, "\r\n")
+	server, path := newRangeServer(t, http.StatusOK, body)
+	c := pwned.New(time.Second).WithURL(server.URL + "/range/")
+
+	n, err := c.Count(context.Background(), "password")
+	require.NoError(t, err)
+	assert.Equal(t, 3861493, n)
+	// Передаётся только префикс хеша.
+	assert.Equal(t, "/range/"+breachedPrefix, *path)
+
+	n, err = c.Count(context.Background(), "correct horse battery staple 42")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestCheck(t *testing.T) {
+	t.Cleanup(func() { pwned.Set(nil, false) })
+	assert.NoError(t, pwned.Check(context.Background(), "password"), "disabled check accepts any password")
+
+	server, _ := newRangeServer(t, http.StatusOK, breachedSuffix+":10\n")
+	pwned.Set(pwned.New(time.Second).WithURL(server.URL+"/"), false)
+	assert.ErrorIs(t, pwned.Check(context.Background(), "password"), pwned.ErrBreached)
+
+	// Дополняющая запись с нулевым числом вхождений не считается утечкой.
+	server, _ = newRangeServer(t, http.StatusOK, breachedSuffix+":0\n")
+	pwned.Set(pwned.New(time.Second).WithURL(server.URL+"/"), false)
+	assert.NoError(t, pwned.Check(context.Background(), "password"))
+
+	server, _ = newRangeServer(t, http.StatusServiceUnavailable, "")
+	pwned.Set(pwned.New(time.Second).WithURL(server.URL+"/"), false)
+	assert.ErrorIs(t, pwned.Check(context.Background(), "password"), pwned.ErrUnavailable)
+
+	pwned.Set(pwned.New(time.Second).WithURL(server.URL+"/"), true)
+	assert.NoError(t, pwned.Check(context.Background(), "password"))
+}
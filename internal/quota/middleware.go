@@ -0,0 +1,103 @@
+package quota
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/pkg/authpb"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Создаёт middleware, отклоняющее запросы HTTP API сверх RequestsPerMinute.
+//
+// Запрос сверх квоты получает 429 Too Many Requests с кодом quota_exceeded и
+// заголовком Retry-After до начала следующей минуты.
+//
+// Принимает:
+// - next: обработчик маршрута.
+//
+// Возвращает:
+// - http.Handler.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter, err := AllowRequest(); err != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(retryAfter)))
+			i18n.Error(w, r, "quota_exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Создаёт перехватчик, отклоняющий вызовы AuthService сверх RequestsPerMinute
+// со статусом RESOURCE_EXHAUSTED. Вызовы других сервисов не ограничиваются.
+//
+// Возвращает:
+// - grpc.UnaryServerInterceptor.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	prefix := "/" + authpb.AuthService_ServiceDesc.ServiceName + "/"
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if strings.HasPrefix(info.FullMethod, prefix) {
+			if _, err := AllowRequest(); err != nil {
+				return nil, status.Error(codes.ResourceExhausted, "quota exceeded")
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Длительность в секундах с округлением вверх, не меньше 1.
+func seconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// Ответ GET /admin/quotas.
+type Report struct {
+	Limits Limits `json:"limits"`
+	Usage  Usage  `json:"usage"`
+}
+
+// Создаёт обработчик /admin/quotas.
+//
+// GET возвращает действующие квоты и их использование. PUT заменяет квоты
+// значениями из тела запроса (Limits в JSON); изменение действует на
+// реплике, получившей запрос, до её перезапуска, поэтому постоянные значения
+// задаются в конфигурации.
+//
+// Возвращает:
+// - http.Handler.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var l Limits
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&l); err != nil || SetLimits(l) != nil {
+				i18n.Error(w, r, "invalid_quotas", http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPut)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		usage, err := CurrentUsage()
+		if err != nil {
+			i18n.Error(w, r, "service_unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Report{Limits: Current(), Usage: usage})
+	})
+}
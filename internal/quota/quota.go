@@ -0,0 +1,189 @@
+// Пакет quota ограничивает использование сервиса: число запросов к API в
+// минуту и число действующих сессий.
+//
+// Сервис пока обслуживает одного арендатора, поэтому квоты действуют на всю
+// установку. Ограничение запросов считается отдельно на каждой реплике.
+// Квоты задаются конфигурацией и могут быть изменены без перезапуска через
+// PUT /admin/quotas (см. Handler).
+package quota
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/storage"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Квота исчерпана.
+var ErrExceeded = errors.New("quota exceeded")
+
+// Имена квот (значения метки quota метрики auth_quota_exceeded_total).
+const (
+	QuotaRequests = "requests_per_minute"
+	QuotaSessions = "max_sessions"
+)
+
+// Как долго используется полученное из хранилища число сессий.
+const sessionsCacheTTL = 5 * time.Second
+
+var exceeded = metrics.NewCounterVec(
+	"auth_quota_exceeded_total",
+	"Number of requests rejected because a quota was exceeded, by quota.",
+	"quota",
+)
+
+// Квоты; 0 — без ограничения.
+type Limits struct {
+	// Запросов к API в минуту на реплику.
+	RequestsPerMinute int `json:"requests_per_minute"`
+	// Действующих сессий всех пользователей.
+	MaxSessions int64 `json:"max_sessions"`
+}
+
+// Проверяет квоты.
+func (l Limits) Validate() error {
+	if l.RequestsPerMinute < 0 {
+		return fmt.Errorf("requests_per_minute must not be negative, got %d", l.RequestsPerMinute)
+	}
+	if l.MaxSessions < 0 {
+		return fmt.Errorf("max_sessions must not be negative, got %d", l.MaxSessions)
+	}
+	return nil
+}
+
+var (
+	mu     sync.Mutex
+	limits Limits
+	// Начало текущей минуты и число запросов в ней.
+	window   time.Time
+	requests int
+	counter  storage.SessionCounter
+	// Последнее полученное из хранилища число сессий и время его получения.
+	sessions  int64
+	countedAt time.Time
+	now       = time.Now
+)
+
+// Устанавливает квоты.
+//
+// Принимает:
+// - l: квоты.
+//
+// Возвращает:
+// - ошибку, если квоты некорректны; в этом случае действующие квоты не меняются.
+func SetLimits(l Limits) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	limits = l
+	return nil
+}
+
+// Возвращает действующие квоты.
+func Current() Limits {
+	mu.Lock()
+	defer mu.Unlock()
+	return limits
+}
+
+// Устанавливает источник числа сессий.
+//
+// Принимает:
+// - c: реализация подсчёта сессий; nil — квота MaxSessions не проверяется.
+func SetSessionCounter(c storage.SessionCounter) {
+	mu.Lock()
+	defer mu.Unlock()
+	counter, countedAt = c, time.Time{}
+}
+
+// Учитывает запрос к API.
+//
+// Возвращает:
+// - время до начала следующей минуты.
+// - ErrExceeded, если запросов в текущей минуте больше RequestsPerMinute.
+func AllowRequest() (time.Duration, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	t := now()
+	if start := t.Truncate(time.Minute); !start.Equal(window) {
+		window, requests = start, 0
+	}
+	retryAfter := window.Add(time.Minute).Sub(t)
+	if limits.RequestsPerMinute == 0 {
+		return retryAfter, nil
+	}
+	if requests >= limits.RequestsPerMinute {
+		exceeded.Inc(QuotaRequests)
+		return retryAfter, fmt.Errorf("%s: %w", QuotaRequests, ErrExceeded)
+	}
+	requests++
+	return retryAfter, nil
+}
+
+// Проверяет, можно ли начать ещё одну сессию.
+//
+// Число сессий запрашивается у хранилища не чаще раза в несколько секунд,
+// поэтому при всплеске входов квота может быть превышена на число сессий,
+// начатых за это время.
+//
+// Возвращает:
+// - ErrExceeded, если действующих сессий не меньше MaxSessions.
+// - ошибку, если число сессий не удалось получить.
+func CheckSessions() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if limits.MaxSessions == 0 || counter == nil {
+		return nil
+	}
+	if t := now(); t.Sub(countedAt) >= sessionsCacheTTL {
+		count, err := counter.CountSessions()
+		if err != nil {
+			return err
+		}
+		sessions, countedAt = count, t
+	}
+	if sessions >= limits.MaxSessions {
+		exceeded.Inc(QuotaSessions)
+		return fmt.Errorf("%s: %w", QuotaSessions, ErrExceeded)
+	}
+	sessions++
+	return nil
+}
+
+// Состояние квот в ответе GET /admin/quotas.
+type Usage struct {
+	// Запросов в текущей минуте на этой реплике.
+	RequestsThisMinute int `json:"requests_this_minute"`
+	// Действующих сессий по последнему подсчёту; -1, если подсчёт не поддерживается.
+	Sessions int64 `json:"sessions"`
+}
+
+// Возвращает состояние квот.
+//
+// Возвращает:
+// - состояние квот.
+// - ошибку, если число сессий не удалось получить.
+func CurrentUsage() (Usage, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	usage := Usage{Sessions: -1}
+	if now().Truncate(time.Minute).Equal(window) {
+		usage.RequestsThisMinute = requests
+	}
+	if counter != nil {
+		count, err := counter.CountSessions()
+		if err != nil {
+			return Usage{}, err
+		}
+		sessions, countedAt = count, now()
+		usage.Sessions = count
+	}
+	return usage, nil
+}
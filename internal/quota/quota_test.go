@@ -0,0 +1,140 @@
+package quota
+
+import (
+	"auth_service/internal/storage/memory"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Устанавливает квоты и часы на время теста.
+func setup(t *testing.T, l Limits, clock *time.Time) {
+	t.Helper()
+	require.NoError(t, SetLimits(l))
+	now = func() time.Time { return *clock }
+	t.Cleanup(func() {
+		_ = SetLimits(Limits{})
+		SetSessionCounter(nil)
+		now = time.Now
+		window, requests = time.Time{}, 0
+	})
+}
+
+// Проверка квоты запросов в минуту.
+func TestAllowRequest(t *testing.T) {
+	clock := time.Date(2024, 3, 1, 12, 0, 15, 0, time.UTC)
+	setup(t, Limits{RequestsPerMinute: 2}, &clock)
+
+	for i := 0; i < 2; i++ {
+		_, err := AllowRequest()
+		require.NoError(t, err)
+	}
+	retryAfter, err := AllowRequest()
+	assert.ErrorIs(t, err, ErrExceeded)
+	assert.Equal(t, 45*time.Second, retryAfter)
+
+	// В следующей минуте счёт начинается заново.
+	clock = clock.Add(time.Minute)
+	_, err = AllowRequest()
+	assert.NoError(t, err)
+}
+
+// Проверка квоты действующих сессий.
+func TestCheckSessions(t *testing.T) {
+	clock := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	setup(t, Limits{MaxSessions: 2}, &clock)
+
+	// Без источника числа сессий квота не проверяется.
+	require.NoError(t, CheckSessions())
+
+	ms := memory.NewMemoryStorage()
+	ms.CreateUser("user", "user@example.com")
+	_, err := ms.SaveRefreshToken("user", "hash-1", "192.168.1.1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	SetSessionCounter(ms)
+
+	require.NoError(t, CheckSessions())
+	// Сессия, разрешённая последней проверкой, учитывается до следующего подсчёта.
+	assert.ErrorIs(t, CheckSessions(), ErrExceeded)
+
+	_, err = ms.SaveRefreshToken("user", "hash-2", "192.168.1.1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	clock = clock.Add(sessionsCacheTTL)
+	assert.ErrorIs(t, CheckSessions(), ErrExceeded)
+
+	require.NoError(t, ms.DeleteRefreshToken("user"))
+	clock = clock.Add(sessionsCacheTTL)
+	assert.NoError(t, CheckSessions())
+}
+
+// Проверка ответа HTTP API и gRPC API сверх квоты запросов.
+func TestMiddleware(t *testing.T) {
+	clock := time.Date(2024, 3, 1, 12, 0, 59, 500_000_000, time.UTC)
+	setup(t, Limits{RequestsPerMinute: 1}, &clock)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/auth/tokens", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/auth/tokens", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "quota_exceeded", rr.Header().Get("X-Error-Code"))
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	interceptor := UnaryServerInterceptor()
+	call := func(fullMethod string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: fullMethod},
+			func(ctx context.Context, req any) (any, error) { return nil, nil })
+		return err
+	}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("/auth.v1.AuthService/IssueTokens")))
+	assert.NoError(t, call("/grpc.health.v1.Health/Check"), "health checks are not limited")
+}
+
+// Проверка просмотра и изменения квот через /admin/quotas.
+func TestHandler(t *testing.T) {
+	clock := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	setup(t, Limits{RequestsPerMinute: 10}, &clock)
+	_, err := AllowRequest()
+	require.NoError(t, err)
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		Handler().ServeHTTP(rr, httptest.NewRequest(method, "/admin/quotas", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var report Report
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(t, Report{Limits: Limits{RequestsPerMinute: 10}, Usage: Usage{RequestsThisMinute: 1, Sessions: -1}}, report)
+
+	rr = serve(http.MethodPut, `{"requests_per_minute": 100, "max_sessions": 5000}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, Limits{RequestsPerMinute: 100, MaxSessions: 5000}, Current())
+
+	for _, body := range []string{`{"max_sessions": -1}`, `{"max_users": 10}`, `not json`} {
+		rr = serve(http.MethodPut, body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		assert.Equal(t, "invalid_quotas", rr.Header().Get("X-Error-Code"))
+	}
+	assert.Equal(t, Limits{RequestsPerMinute: 100, MaxSessions: 5000}, Current(), "invalid quotas must not be applied")
+
+	rr = httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/admin/quotas", bytes.NewReader(nil)))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
@@ -0,0 +1,211 @@
+// Пакет ratelimit ограничивает частоту запросов выдачи и обновления токенов
+// с одного IP-адреса клиента (token bucket).
+//
+// У каждого адреса своё «ведро» ёмкостью Burst запросов, которое пополняется
+// со скоростью RequestsPerMinute. Запрос из пустого ведра получает 429 Too
+// Many Requests. Ограничение считается отдельно на каждой реплике. Адреса
+// IPv6 учитываются по сети /64 (IPv6Prefix), поскольку клиенту обычно
+// выделяется вся сеть и менять адрес в ней ничего не стоит.
+package ratelimit
+
+import (
+	"auth_service/internal/clientip"
+	"auth_service/internal/i18n"
+	"auth_service/internal/metrics"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var limited = metrics.NewCounterVec(
+	"auth_rate_limited_total",
+	"Number of requests rejected by the per-IP rate limit.",
+)
+
+// Как часто удаляются ведра адресов, которые успели заполниться.
+const sweepInterval = time.Minute
+
+// Настройки ограничения.
+type Config struct {
+	// Запросов в минуту с одного адреса; 0 — без ограничения.
+	RequestsPerMinute int
+	// Запросов, которые можно выполнить подряд без ожидания.
+	Burst int
+	// Длина префикса, по которому учитываются адреса IPv6.
+	IPv6Prefix int
+	// Адреса и подсети (CIDR), запросы с которых не ограничиваются.
+	Exempt []string
+}
+
+// Ограничение частоты запросов по адресам клиентов.
+type Limiter struct {
+	rate   float64 // запросов в секунду
+	burst  float64
+	ipv6   int
+	exempt []netip.Prefix
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Создаёт ограничение частоты запросов.
+//
+// Принимает:
+// - cfg: настройки ограничения.
+//
+// Возвращает:
+// - указатель на Limiter; nil, если RequestsPerMinute равно 0.
+// - ошибку, если настройки некорректны.
+func New(cfg Config) (*Limiter, error) {
+	if cfg.RequestsPerMinute < 0 {
+		return nil, fmt.Errorf("requests_per_minute must not be negative, got %d", cfg.RequestsPerMinute)
+	}
+	if cfg.RequestsPerMinute == 0 {
+		return nil, nil
+	}
+	if cfg.Burst < 1 {
+		return nil, fmt.Errorf("burst must be positive, got %d", cfg.Burst)
+	}
+	if cfg.IPv6Prefix < 0 || cfg.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid IPv6 prefix length %d", cfg.IPv6Prefix)
+	}
+	exempt := make([]netip.Prefix, 0, len(cfg.Exempt))
+	for _, value := range cfg.Exempt {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid exempt address or CIDR %q", value)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		exempt = append(exempt, prefix.Masked())
+	}
+	return &Limiter{
+		rate:    float64(cfg.RequestsPerMinute) / 60,
+		burst:   float64(cfg.Burst),
+		ipv6:    cfg.IPv6Prefix,
+		exempt:  exempt,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}, nil
+}
+
+// Учитывает запрос с адреса клиента.
+//
+// Принимает:
+// - ip: адрес клиента (см. clientip.FromRequest).
+//
+// Возвращает:
+// - true, если запрос разрешён.
+// - время, через которое можно повторить отклонённый запрос.
+func (l *Limiter) Allow(ip string) (bool, time.Duration) {
+	key, ok := l.key(ip)
+	if !ok {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		limited.Inc()
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Возвращает ключ ведра адреса; false — адрес не ограничивается.
+func (l *Limiter) key(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		// Адрес соединения всегда разбирается; неразобранный адрес
+		// учитывается как есть.
+		return ip, true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.exempt {
+		if prefix.Contains(addr) {
+			return "", false
+		}
+	}
+	if addr.Is6() && l.ipv6 > 0 {
+		prefix, _ := addr.Prefix(l.ipv6)
+		return prefix.String(), true
+	}
+	return addr.String(), true
+}
+
+// Удаляет ведра, которые успели заполниться: они не отличаются от новых.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+var (
+	mu      sync.RWMutex
+	current *Limiter
+)
+
+// Устанавливает ограничение для Middleware. Вызывается при запуске.
+//
+// Принимает:
+// - l: ограничение; nil — запросы не ограничиваются.
+func Set(l *Limiter) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = l
+}
+
+// Создаёт middleware, отклоняющее запросы сверх ограничения для адреса клиента.
+//
+// Запрос сверх ограничения получает 429 Too Many Requests с JSON-телом
+// {"code": "rate_limited", "message": "..."} и заголовком Retry-After.
+//
+// Принимает:
+// - next: обработчик маршрута.
+//
+// Возвращает:
+// - http.Handler.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.RLock()
+		l := current
+		mu.RUnlock()
+		if l != nil {
+			if ok, retryAfter := l.Allow(clientip.FromRequest(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+				i18n.JSONError(w, r, "rate_limited", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Создаёт ограничение с управляемыми часами.
+func newLimiter(t *testing.T, cfg Config, clock *time.Time) *Limiter {
+	t.Helper()
+	l, err := New(cfg)
+	require.NoError(t, err)
+	l.now = func() time.Time { return *clock }
+	return l
+}
+
+// Проверка расходования и пополнения ведра.
+func TestLimiter_Allow(t *testing.T) {
+	clock := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(t, Config{RequestsPerMinute: 60, Burst: 2, IPv6Prefix: 64}, &clock)
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.Allow("203.0.113.1")
+		require.True(t, ok)
+	}
+	ok, retryAfter := l.Allow("203.0.113.1")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retryAfter)
+
+	// Другие адреса ограничиваются отдельно.
+	ok, _ = l.Allow("203.0.113.2")
+	assert.True(t, ok)
+
+	// Ведро пополняется со скоростью requests_per_minute.
+	clock = clock.Add(time.Second)
+	ok, _ = l.Allow("203.0.113.1")
+	assert.True(t, ok)
+	ok, _ = l.Allow("203.0.113.1")
+	assert.False(t, ok)
+
+	// Адреса IPv6 учитываются по сети /64.
+	ok, _ = l.Allow("2001:db8::1")
+	require.True(t, ok)
+	ok, _ = l.Allow("2001:db8::2")
+	require.True(t, ok)
+	ok, _ = l.Allow("2001:db8::3")
+	assert.False(t, ok)
+	ok, _ = l.Allow("2001:db8:0:1::1")
+	assert.True(t, ok)
+
+	// Заполнившиеся ведра удаляются.
+	clock = clock.Add(sweepInterval)
+	l.Allow("198.51.100.1")
+	assert.Len(t, l.buckets, 1)
+}
+
+// Проверка адресов, запросы с которых не ограничиваются.
+func TestLimiter_Exempt(t *testing.T) {
+	clock := time.Now()
+	l := newLimiter(t, Config{RequestsPerMinute: 1, Burst: 1, Exempt: []string{"10.0.0.0/8", "192.0.2.1"}}, &clock)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("10.1.2.3")
+		assert.True(t, ok)
+		ok, _ = l.Allow("192.0.2.1")
+		assert.True(t, ok)
+	}
+	ok, _ := l.Allow("::ffff:10.1.2.3")
+	assert.True(t, ok, "IPv4-mapped addresses match IPv4 ranges")
+}
+
+func TestNew(t *testing.T) {
+	l, err := New(Config{})
+	require.NoError(t, err)
+	assert.Nil(t, l, "zero requests_per_minute disables the limit")
+
+	for _, cfg := range []Config{
+		{RequestsPerMinute: -1, Burst: 1},
+		{RequestsPerMinute: 10, Burst: 0},
+		{RequestsPerMinute: 10, Burst: 1, IPv6Prefix: 129},
+		{RequestsPerMinute: 10, Burst: 1, Exempt: []string{"not-a-network"}},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err, "%+v", cfg)
+	}
+}
+
+// Проверка ответа 429 с JSON-телом.
+func TestMiddleware(t *testing.T) {
+	l, err := New(Config{RequestsPerMinute: 6, Burst: 1})
+	require.NoError(t, err)
+	Set(l)
+	t.Cleanup(func() { Set(nil) })
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/tokens", nil)
+		req.RemoteAddr = "203.0.113.1:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, serve().Code)
+	rr := serve()
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "10", rr.Header().Get("Retry-After"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, "rate_limited", body["code"])
+}
@@ -0,0 +1,189 @@
+// Пакет refreshlimit замедляет подбор refresh-токенов: после MaxFailures
+// неудачных попыток обновления токенов пользователя за Window обновление его
+// токенов запрещается на Cooldown.
+//
+// Попытка относится к пользователю по действительному access-токену, который
+// клиент передал вместе с refresh-токеном. Счётчики хранятся в хранилище
+// (storage.RefreshFailureCounter), поэтому запрет действует на всех репликах
+// и переживает перезапуск. Попытки без access-токена пользователю не
+// приписываются; их ограничивает пакет ratelimit по адресу клиента.
+package refreshlimit
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/storage"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Обновление токенов пользователя временно запрещено.
+var ErrThrottled = errors.New("too many failed refresh attempts")
+
+// Ошибка запрета обновления с временем до его окончания.
+type ThrottledError struct {
+	// Через сколько запрет закончится.
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrThrottled, e.RetryAfter)
+}
+
+// Позволяет проверять ошибку через errors.Is(err, ErrThrottled).
+func (e *ThrottledError) Unwrap() error {
+	return ErrThrottled
+}
+
+var throttled = metrics.NewCounterVec(
+	"auth_refresh_throttled_total",
+	"Number of token refresh requests rejected because the user is in a cooldown after repeated failures.",
+)
+
+var cooldowns = metrics.NewCounterVec(
+	"auth_refresh_cooldowns_total",
+	"Number of failed token refresh attempts that started or extended a per-user cooldown.",
+)
+
+// Настройки ограничения.
+type Limits struct {
+	// Неудачных попыток в окне, после которых обновление запрещается; 0 — без ограничения.
+	MaxFailures int
+	// Длина окна подсчёта попыток.
+	Window time.Duration
+	// Длительность запрета.
+	Cooldown time.Duration
+}
+
+// Проверяет настройки.
+func (l Limits) Validate() error {
+	if l.MaxFailures < 0 {
+		return fmt.Errorf("max_failures must not be negative, got %d", l.MaxFailures)
+	}
+	if l.MaxFailures > 0 && (l.Window <= 0 || l.Cooldown <= 0) {
+		return fmt.Errorf("window and cooldown must be positive, got %s and %s", l.Window, l.Cooldown)
+	}
+	return nil
+}
+
+var (
+	mu     sync.RWMutex
+	limits Limits
+	store  storage.RefreshFailureCounter
+	now    = time.Now
+)
+
+// Устанавливает ограничение и хранилище счётчиков. Вызывается при запуске.
+//
+// Принимает:
+// - s: хранилище счётчиков; nil — попытки не ограничиваются.
+// - l: настройки ограничения.
+//
+// Возвращает:
+// - ошибку, если настройки некорректны; в этом случае действующее ограничение не меняется.
+func Set(s storage.RefreshFailureCounter, l Limits) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	store, limits = s, l
+	return nil
+}
+
+// Возвращает хранилище счётчиков и настройки, если ограничение включено.
+func current() (storage.RefreshFailureCounter, Limits, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return store, limits, store != nil && limits.MaxFailures > 0
+}
+
+// Проверяет, может ли пользователь обновлять токены.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - *ThrottledError, если обновление запрещено.
+// - ошибку хранилища, если запрет не удалось проверить.
+func Check(userID string) error {
+	s, _, ok := current()
+	if !ok {
+		return nil
+	}
+	lockedUntil, err := s.GetRefreshCooldown(userID)
+	if err != nil {
+		return fmt.Errorf("failed to check refresh cooldown: %w", err)
+	}
+	if retryAfter := lockedUntil.Sub(now()); retryAfter > 0 {
+		throttled.Inc()
+		return &ThrottledError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Учитывает неудачную попытку обновления токенов пользователем.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - ошибку хранилища, если попытку не удалось учесть.
+func RecordFailure(userID string) error {
+	s, l, ok := current()
+	if !ok {
+		return nil
+	}
+	lockedUntil, err := s.AddRefreshFailure(userID, l.Window, l.MaxFailures, l.Cooldown)
+	if err != nil {
+		return fmt.Errorf("failed to record refresh failure: %w", err)
+	}
+	if lockedUntil.After(now()) {
+		cooldowns.Inc()
+	}
+	return nil
+}
+
+// Возвращает момент окончания запрета обновления токенов пользователя (для
+// служебных маршрутов).
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - момент окончания запрета; нулевое время, если запрета нет или ограничение не включено.
+// - ошибку хранилища.
+func Cooldown(userID string) (time.Time, error) {
+	s, _, ok := current()
+	if !ok {
+		return time.Time{}, nil
+	}
+	lockedUntil, err := s.GetRefreshCooldown(userID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get refresh cooldown: %w", err)
+	}
+	if !lockedUntil.After(now()) {
+		return time.Time{}, nil
+	}
+	return lockedUntil, nil
+}
+
+// Сбрасывает неудачные попытки и снимает запрет обновления токенов
+// пользователя (по запросу администратора).
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - ошибку хранилища.
+func Reset(userID string) error {
+	s, _, ok := current()
+	if !ok {
+		return nil
+	}
+	if err := s.ResetRefreshFailures(userID); err != nil {
+		return fmt.Errorf("failed to reset refresh failures: %w", err)
+	}
+	return nil
+}
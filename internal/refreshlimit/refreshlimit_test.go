@@ -0,0 +1,78 @@
+package refreshlimit
+
+import (
+	"auth_service/internal/storage/memory"
+	"auth_service/lib/clock"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка запрета обновления после неудачных попыток и его окончания.
+func TestCheck(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	now = clk.Now
+	store := memory.NewMemoryStorage().WithClock(clk)
+	require.NoError(t, Set(store, Limits{MaxFailures: 3, Window: time.Minute, Cooldown: 5 * time.Minute}))
+	t.Cleanup(func() { now = time.Now; Set(nil, Limits{}) })
+
+	const userID = "123e4567-e89b-12d3-a456-426614174000"
+	for i := 0; i < 2; i++ {
+		require.NoError(t, RecordFailure(userID))
+	}
+	require.NoError(t, Check(userID))
+
+	require.NoError(t, RecordFailure(userID))
+	err := Check(userID)
+	require.ErrorIs(t, err, ErrThrottled)
+	var throttledErr *ThrottledError
+	require.True(t, errors.As(err, &throttledErr))
+	assert.Equal(t, 5*time.Minute, throttledErr.RetryAfter)
+	assert.NoError(t, Check("00000000-0000-0000-0000-000000000001"), "other users are not affected")
+
+	clk.Advance(5 * time.Minute)
+	assert.NoError(t, Check(userID))
+}
+
+// Проверка отключённого ограничения.
+func TestDisabled(t *testing.T) {
+	store := memory.NewMemoryStorage()
+	require.NoError(t, Set(store, Limits{}))
+	t.Cleanup(func() { Set(nil, Limits{}) })
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, RecordFailure("user"))
+	}
+	assert.NoError(t, Check("user"))
+}
+
+func TestLimits_Validate(t *testing.T) {
+	assert.NoError(t, Limits{}.Validate())
+	assert.NoError(t, Limits{MaxFailures: 5, Window: time.Minute, Cooldown: time.Minute}.Validate())
+	assert.Error(t, Limits{MaxFailures: -1}.Validate())
+	assert.Error(t, Limits{MaxFailures: 5, Cooldown: time.Minute}.Validate())
+	assert.Error(t, Limits{MaxFailures: 5, Window: time.Minute}.Validate())
+}
+
+// Проверка просмотра и снятия запрета администратором.
+func TestReset(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	now = clk.Now
+	require.NoError(t, Set(memory.NewMemoryStorage().WithClock(clk), Limits{MaxFailures: 1, Window: time.Minute, Cooldown: 5 * time.Minute}))
+	t.Cleanup(func() { now = time.Now; Set(nil, Limits{}) })
+
+	const userID = "123e4567-e89b-12d3-a456-426614174000"
+	require.NoError(t, RecordFailure(userID))
+	lockedUntil, err := Cooldown(userID)
+	require.NoError(t, err)
+	assert.Equal(t, clk.Now().Add(5*time.Minute), lockedUntil)
+
+	require.NoError(t, Reset(userID))
+	assert.NoError(t, Check(userID))
+	lockedUntil, err = Cooldown(userID)
+	require.NoError(t, err)
+	assert.True(t, lockedUntil.IsZero())
+}
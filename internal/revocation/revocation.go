@@ -0,0 +1,152 @@
+// Пакет revocation реализует массовый отзыв сессий (POST /admin/sessions/revoke).
+//
+// Отзыв нужен при реагировании на инциденты: после атаки подбором учётных
+// данных или утечки секрета отзываются все сессии, подходящие под условия
+// (пользователи, подсети адресов клиентов, время входа), а не сессии одного
+// пользователя.
+package revocation
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Условия отзыва в теле запроса; сессия отзывается, если подходит под все
+// заданные условия.
+type Request struct {
+	// Арендатор. Сервис пока не разделяет пользователей по арендаторам,
+	// поэтому непустое значение отклоняется.
+	Tenant  string   `json:"tenant"`
+	UserIDs []string `json:"user_ids"`
+	// Подсети (CIDR) или отдельные IP-адреса клиентов.
+	IPRanges []string `json:"ip_ranges"`
+	// Сессии, начатые раньше этого времени.
+	IssuedBefore *time.Time `json:"issued_before"`
+}
+
+// Результат отзыва.
+type Response struct {
+	Matched int64 `json:"matched"`
+	Revoked int64 `json:"revoked"`
+}
+
+// Операция массового отзыва (реализуется auth.Service).
+type Revoker interface {
+	RevokeSessions(ctx context.Context, filter auth.RevocationFilter, batchSize int) (auth.RevocationResult, error)
+}
+
+var (
+	mu        sync.Mutex
+	revoker   Revoker
+	batchSize int
+)
+
+// Задаёт сервис, отзывающий сессии; до вызова обработчик отвечает 501 Not Implemented.
+//
+// Принимает:
+// - r: сервис.
+// - size: размер порции отзыва; 0 — auth.DefaultRevocationBatchSize.
+func Set(r Revoker, size int) {
+	mu.Lock()
+	defer mu.Unlock()
+	revoker, batchSize = r, size
+}
+
+// Преобразует тело запроса в условия отзыва.
+//
+// Возвращает:
+// - условия отзыва.
+// - ошибку, если подсеть или адрес некорректны.
+func (req Request) filter() (auth.RevocationFilter, error) {
+	filter := auth.RevocationFilter{UserIDs: req.UserIDs}
+	if req.IssuedBefore != nil {
+		filter.IssuedBefore = *req.IssuedBefore
+	}
+	for _, value := range req.IPRanges {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return auth.RevocationFilter{}, err
+			}
+			addr = addr.Unmap()
+			filter.Networks = append(filter.Networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return auth.RevocationFilter{}, err
+		}
+		filter.Networks = append(filter.Networks, prefix.Masked())
+	}
+	return filter, nil
+}
+
+// Создаёт обработчик /admin/sessions/revoke.
+//
+// POST отзывает сессии, подходящие под условия из тела запроса (Request), и
+// возвращает количество подошедших и отозванных сессий (Response).
+//
+// Возвращает:
+// - http.Handler.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req Request
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			i18n.Error(w, r, "invalid_request_body", http.StatusBadRequest)
+			return
+		}
+		if req.Tenant != "" {
+			i18n.Error(w, r, "tenants_not_supported", http.StatusBadRequest)
+			return
+		}
+		filter, err := req.filter()
+		if err != nil {
+			i18n.Error(w, r, "invalid_revocation_filter", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		rv, size := revoker, batchSize
+		mu.Unlock()
+		if rv == nil {
+			i18n.Error(w, r, "session_search_not_supported", http.StatusNotImplemented)
+			return
+		}
+
+		result, err := rv.RevokeSessions(r.Context(), filter, size)
+		switch {
+		case errors.Is(err, auth.ErrInvalidRevocationFilter):
+			i18n.Error(w, r, "invalid_revocation_filter", http.StatusBadRequest)
+			return
+		case errors.Is(err, auth.ErrSessionSearchNotSupported):
+			i18n.Error(w, r, "session_search_not_supported", http.StatusNotImplemented)
+			return
+		case errors.Is(err, storage.ErrUnavailable):
+			i18n.Error(w, r, "service_unavailable", http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			i18n.Error(w, r, "session_revocation_failed", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Response{Matched: result.Matched, Revoked: result.Revoked})
+	})
+}
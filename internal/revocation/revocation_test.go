@@ -0,0 +1,116 @@
+package revocation
+
+import (
+	"auth_service/internal/services/auth"
+	"auth_service/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRevoker struct {
+	filter    auth.RevocationFilter
+	batchSize int
+	result    auth.RevocationResult
+	err       error
+}
+
+func (f *fakeRevoker) RevokeSessions(_ context.Context, filter auth.RevocationFilter, batchSize int) (auth.RevocationResult, error) {
+	f.filter, f.batchSize = filter, batchSize
+	return f.result, f.err
+}
+
+func revoke(body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/sessions/revoke", strings.NewReader(body)))
+	return rec
+}
+
+// Проверка разбора условий и ответа с количеством отозванных сессий.
+func TestHandler(t *testing.T) {
+	fake := &fakeRevoker{result: auth.RevocationResult{Matched: 3, Revoked: 3}}
+	Set(fake, 100)
+	t.Cleanup(func() { Set(nil, 0) })
+
+	rec := revoke(`{
+		"user_ids": ["123e4567-e89b-12d3-a456-426614174000"],
+		"ip_ranges": ["203.0.113.7/24", "2001:db8::1", "::ffff:198.51.100.1"],
+		"issued_before": "2026-10-16T09:00:00Z"
+	}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, Response{Matched: 3, Revoked: 3}, resp)
+
+	assert.Equal(t, 100, fake.batchSize)
+	assert.Equal(t, []string{"123e4567-e89b-12d3-a456-426614174000"}, fake.filter.UserIDs)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("203.0.113.0/24"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+		netip.MustParsePrefix("198.51.100.1/32"),
+	}, fake.filter.Networks)
+	assert.Equal(t, time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC), fake.filter.IssuedBefore)
+}
+
+// Проверка ответов на некорректные запросы и ошибки отзыва.
+func TestHandler_Errors(t *testing.T) {
+	fake := &fakeRevoker{}
+	Set(fake, 0)
+	t.Cleanup(func() { Set(nil, 0) })
+
+	for name, tc := range map[string]struct {
+		body   string
+		err    error
+		status int
+		code   string
+	}{
+		"malformed body":   {body: `{"user_ids": "x"}`, status: http.StatusBadRequest, code: "invalid_request_body"},
+		"unknown field":    {body: `{"users": []}`, status: http.StatusBadRequest, code: "invalid_request_body"},
+		"tenant":           {body: `{"tenant": "acme"}`, status: http.StatusBadRequest, code: "tenants_not_supported"},
+		"invalid ip range": {body: `{"ip_ranges": ["10.0.0.0/33"]}`, status: http.StatusBadRequest, code: "invalid_revocation_filter"},
+		"invalid filter": {
+			body: `{}`, err: fmt.Errorf("%w: empty", auth.ErrInvalidRevocationFilter),
+			status: http.StatusBadRequest, code: "invalid_revocation_filter",
+		},
+		"not supported": {
+			body: `{"user_ids": []}`, err: auth.ErrSessionSearchNotSupported,
+			status: http.StatusNotImplemented, code: "session_search_not_supported",
+		},
+		"unavailable": {
+			body: `{"ip_ranges": ["10.0.0.1"]}`, err: fmt.Errorf("failed to find sessions: %w", storage.ErrUnavailable),
+			status: http.StatusServiceUnavailable, code: "service_unavailable",
+		},
+		"failed": {
+			body: `{"ip_ranges": ["10.0.0.1"]}`, err: fmt.Errorf("failed to delete session: boom"),
+			status: http.StatusInternalServerError, code: "session_revocation_failed",
+		},
+	} {
+		fake.err = tc.err
+		rec := revoke(tc.body)
+		assert.Equal(t, tc.status, rec.Code, name)
+		assert.Equal(t, tc.code, rec.Header().Get("X-Error-Code"), name)
+	}
+}
+
+// Проверка ответа без сервиса и на неподдерживаемый метод.
+func TestHandler_NotConfigured(t *testing.T) {
+	Set(nil, 0)
+
+	rec := revoke(`{"user_ids": ["123e4567-e89b-12d3-a456-426614174000"]}`)
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/sessions/revoke", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
@@ -0,0 +1,57 @@
+package security
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Автоматические действия в ответ на события.
+const (
+	// Только сообщить о событии.
+	ActionNone = "none"
+	// Отозвать сессию, в которой обнаружено событие; клиенту нужно войти заново.
+	ActionRevokeSession = "revoke_session"
+	// Отозвать все сессии пользователя.
+	ActionRevokeAll = "revoke_all"
+)
+
+// Известные типы событий.
+var eventTypes = []string{EventIPChange, EventRefreshTokenReuse, EventGeoBlocked, EventLoginFailed, EventLoginLockout}
+
+// Сообщает, известен ли тип события.
+func IsKnownEvent(eventType string) bool {
+	return slices.Contains(eventTypes, eventType)
+}
+
+// Действия в ответ на события по типам событий; для типов, которых нет в
+// наборе, действие — ActionNone.
+type Actions map[string]string
+
+// Проверяет типы событий и действия.
+func (a Actions) Validate() error {
+	for eventType, action := range a {
+		if !IsKnownEvent(eventType) {
+			return fmt.Errorf("unknown security event type %q", eventType)
+		}
+		switch action {
+		case ActionNone, ActionRevokeSession, ActionRevokeAll:
+		default:
+			return fmt.Errorf("unknown action %q for security event %s", action, eventType)
+		}
+	}
+	return nil
+}
+
+// Возвращает действие для типа события.
+//
+// Принимает:
+// - eventType: тип события.
+//
+// Возвращает:
+// - действие; ActionNone, если оно не задано.
+func (a Actions) For(eventType string) string {
+	if action, ok := a[eventType]; ok && action != "" {
+		return action
+	}
+	return ActionNone
+}
@@ -0,0 +1,274 @@
+// Пакет security доставляет события безопасности (смена IP-адреса клиента,
+// повторное использование refresh-токена, отказ по стране и т. п.) в
+// подключённые обработчики: журнал аудита, webhook, системы оповещения,
+// шину событий.
+//
+// Сервис сообщает о каждом обнаруженном событии один раз через Pipeline.Emit,
+// а обработчики (Sink) решают, куда его доставить; новый канал доставки
+// подключается без изменения мест, где события обнаруживаются.
+package security
+
+import (
+	"auth_service/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Типы событий.
+const (
+	// IP-адрес клиента изменился с момента последней выдачи токенов.
+	EventIPChange = "ip_change"
+	// Предъявлен refresh-токен сессии, уже ротированный ранее.
+	EventRefreshTokenReuse = "refresh_token_reuse"
+	// Доступ из страны клиента запрещён правилами.
+	EventGeoBlocked = "geo_blocked"
+	// Неудачная попытка входа по паролю.
+	EventLoginFailed = "login_failed"
+	// Вход в учётную запись или с адреса клиента заблокирован после неудачных попыток.
+	EventLoginLockout = "login_lockout"
+)
+
+// Типы событий жизненного цикла токенов (см. Lifecycle).
+const (
+	// Выданы токены новой сессии.
+	EventTokenIssued = "token_issued"
+	// Refresh-токен сессии ротирован.
+	EventTokenRotated = "token_rotated"
+	// Сессия или все сессии пользователя (details.scope = all) отозваны.
+	EventTokenRevoked = "token_revoked"
+	// Обновление токенов отклонено (details.reason — причина).
+	EventRefreshFailed = "refresh_failed"
+)
+
+// Сообщает, что тип относится к событиям жизненного цикла токенов. Они не
+// являются угрозами и передаются только обработчикам, которые на них
+// подписаны (Subscriber), например брокеру сообщений для SIEM.
+func Lifecycle(eventType string) bool {
+	switch eventType {
+	case EventTokenIssued, EventTokenRotated, EventTokenRevoked, EventRefreshFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Важность события.
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// Уровень записи в лог для важности.
+func (s Severity) level() slog.Level {
+	switch s {
+	case SeverityHigh:
+		return slog.LevelError
+	case SeverityMedium:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Событие безопасности.
+type Event struct {
+	// Идентификатор события; задаётся outbox и не меняется при повторных
+	// публикациях, поэтому получатели могут по нему отбрасывать дубли.
+	ID       string
+	Type     string
+	Severity Severity
+	// Время обнаружения; если не задано, Emit устанавливает текущее.
+	Time      time.Time
+	UserID    string
+	SessionID string
+	// IP-адрес клиента в сохраняемой форме (см. clientip.Privacy).
+	ClientIP string
+	// Подробности, зависящие от типа события (например, previous_ip, country).
+	Details map[string]string
+}
+
+// Обработчик событий.
+type Sink interface {
+	// Имя обработчика для логов и метрик.
+	Name() string
+	// Доставляет событие; ошибка логируется и не мешает другим обработчикам.
+	Handle(ctx context.Context, event Event) error
+}
+
+// Обработчик, принимающий только часть событий. Обработчики без этого
+// интерфейса принимают все события, кроме событий жизненного цикла токенов.
+type Subscriber interface {
+	// Сообщает, нужно ли передавать обработчику события этого типа.
+	Subscribed(eventType string) bool
+}
+
+// Сообщает, нужно ли передавать событие обработчику.
+func accepts(sink Sink, eventType string) bool {
+	if subscriber, ok := sink.(Subscriber); ok {
+		return subscriber.Subscribed(eventType)
+	}
+	return !Lifecycle(eventType)
+}
+
+var (
+	emittedEvents = metrics.NewCounterVec(
+		"auth_security_events_total",
+		"Number of security events emitted by the service, by type and severity.",
+		"type", "severity",
+	)
+	sinkErrors = metrics.NewCounterVec(
+		"auth_security_sink_errors_total",
+		"Number of security events a sink failed to deliver.",
+		"sink",
+	)
+)
+
+var (
+	sinksMu sync.RWMutex
+	// Обработчики, подключаемые к цепочкам NewDefaultPipeline.
+	defaultSinks []Sink
+)
+
+// Устанавливает обработчики, которые NewDefaultPipeline добавляет после
+// записи в лог (например, webhook). Вызывается при запуске сервиса.
+//
+// Принимает:
+// - sinks: обработчики в порядке вызова.
+func SetSinks(sinks ...Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	defaultSinks = sinks
+}
+
+// Создаёт цепочку из записи в лог и обработчиков, установленных SetSinks.
+//
+// Принимает:
+// - log: указатель на logger.
+//
+// Возвращает:
+// - указатель на Pipeline.
+func NewDefaultPipeline(log *slog.Logger) *Pipeline {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	return NewPipeline(log, append([]Sink{NewLogSink(log)}, defaultSinks...)...)
+}
+
+// Цепочка обработчиков событий.
+type Pipeline struct {
+	log   *slog.Logger
+	sinks []Sink
+}
+
+// Создаёт цепочку обработчиков.
+//
+// Принимает:
+// - log: указатель на logger для ошибок обработчиков.
+// - sinks: обработчики в порядке вызова.
+//
+// Возвращает:
+// - указатель на Pipeline.
+func NewPipeline(log *slog.Logger, sinks ...Sink) *Pipeline {
+	return &Pipeline{log: log, sinks: sinks}
+}
+
+// Передаёт событие всем обработчикам по очереди.
+//
+// Ошибки обработчиков логируются и учитываются метрикой
+// auth_security_sink_errors_total, но не возвращаются: доставка события не
+// должна влиять на обработку запроса, в котором оно обнаружено.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - event: событие.
+func (p *Pipeline) Emit(ctx context.Context, event Event) {
+	_ = p.Publish(ctx, event)
+}
+
+// Передаёт событие всем обработчикам по очереди, как Emit, и возвращает их
+// ошибки. Используется, когда событие нужно опубликовать повторно при отказе
+// обработчика (см. internal/outbox); обработчики, уже принявшие событие,
+// получат его снова.
+//
+// Принимает:
+// - ctx: контекст выполнения.
+// - event: событие.
+//
+// Возвращает:
+// - ошибки обработчиков, объединённые errors.Join; nil, если все приняли событие.
+func (p *Pipeline) Publish(ctx context.Context, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Severity == "" {
+		event.Severity = SeverityLow
+	}
+	emittedEvents.Inc(event.Type, string(event.Severity))
+
+	var errs []error
+	for _, sink := range p.sinks {
+		if !accepts(sink, event.Type) {
+			continue
+		}
+		if err := sink.Handle(ctx, event); err != nil {
+			sinkErrors.Inc(sink.Name())
+			p.log.Error("Failed to deliver security event",
+				slog.String("sink", sink.Name()),
+				slog.String("type", event.Type),
+				slog.String("error", err.Error()),
+			)
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Обработчик, записывающий события в лог как записи аудита (audit=true).
+type LogSink struct {
+	log *slog.Logger
+}
+
+// Создаёт обработчик, записывающий события в лог.
+//
+// Принимает:
+// - log: указатель на logger.
+//
+// Возвращает:
+// - указатель на LogSink.
+func NewLogSink(log *slog.Logger) *LogSink {
+	return &LogSink{log: log}
+}
+
+// Возвращает имя обработчика.
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+// Записывает событие в лог с уровнем, соответствующим его важности.
+func (s *LogSink) Handle(ctx context.Context, event Event) error {
+	attrs := []slog.Attr{
+		slog.Bool("audit", true),
+		slog.String("type", event.Type),
+		slog.String("severity", string(event.Severity)),
+		slog.Time("detected_at", event.Time),
+		slog.String("user_id", event.UserID),
+		slog.String("session_id", event.SessionID),
+		slog.String("client_ip", event.ClientIP),
+	}
+	if event.ID != "" {
+		attrs = append(attrs, slog.String("event_id", event.ID))
+	}
+	for _, key := range slices.Sorted(maps.Keys(event.Details)) {
+		attrs = append(attrs, slog.String(key, event.Details[key]))
+	}
+	s.log.LogAttrs(ctx, event.Severity.level(), "Security event", attrs...)
+	return nil
+}
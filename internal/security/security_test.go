@@ -0,0 +1,130 @@
+package security_test
+
+import (
+	"auth_service/internal/security"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Обработчик-заглушка, сохраняющий события и возвращающий заданную ошибку.
+type fakeSink struct {
+	name   string
+	err    error
+	events []security.Event
+}
+
+func (f *fakeSink) Name() string { return f.name }
+
+func (f *fakeSink) Handle(ctx context.Context, event security.Event) error {
+	f.events = append(f.events, event)
+	return f.err
+}
+
+// Проверка доставки события всем обработчикам, в том числе после ошибки одного из них.
+func TestPipeline_Emit(t *testing.T) {
+	failing := &fakeSink{name: "failing", err: errors.New("unavailable")}
+	recording := &fakeSink{name: "recording"}
+	var logs bytes.Buffer
+	p := security.NewPipeline(slog.New(slog.NewTextHandler(&logs, nil)), failing, recording)
+
+	p.Emit(context.Background(), security.Event{Type: security.EventIPChange, UserID: "user"})
+
+	require.Len(t, recording.events, 1)
+	event := recording.events[0]
+	assert.Equal(t, security.EventIPChange, event.Type)
+	assert.Equal(t, security.SeverityLow, event.Severity, "severity defaults to low")
+	assert.WithinDuration(t, time.Now(), event.Time, time.Minute)
+	assert.Len(t, failing.events, 1)
+	assert.Contains(t, logs.String(), "sink=failing")
+
+	// Publish возвращает ошибки обработчиков.
+	err := p.Publish(context.Background(), security.Event{Type: security.EventRefreshTokenReuse})
+	assert.ErrorContains(t, err, "failing: unavailable")
+	assert.Len(t, recording.events, 2)
+	assert.NoError(t, security.NewPipeline(slog.New(slog.NewTextHandler(io.Discard, nil)), recording).Publish(context.Background(), security.Event{}))
+}
+
+// Обработчик-заглушка с подпиской на заданные типы событий.
+type subscribedSink struct {
+	fakeSink
+	types []string
+}
+
+func (f *subscribedSink) Subscribed(eventType string) bool {
+	return slices.Contains(f.types, eventType)
+}
+
+// Проверка отбора событий: события жизненного цикла токенов получают только
+// подписанные на них обработчики.
+func TestPipeline_Subscriptions(t *testing.T) {
+	plain := &fakeSink{name: "plain"}
+	subscribed := &subscribedSink{fakeSink: fakeSink{name: "subscribed"}, types: []string{security.EventTokenIssued}}
+	p := security.NewPipeline(slog.New(slog.NewTextHandler(io.Discard, nil)), plain, subscribed)
+
+	p.Emit(context.Background(), security.Event{Type: security.EventTokenIssued})
+	p.Emit(context.Background(), security.Event{Type: security.EventTokenRevoked})
+	p.Emit(context.Background(), security.Event{Type: security.EventIPChange})
+
+	require.Len(t, plain.events, 1)
+	assert.Equal(t, security.EventIPChange, plain.events[0].Type)
+	require.Len(t, subscribed.events, 1)
+	assert.Equal(t, security.EventTokenIssued, subscribed.events[0].Type)
+	assert.True(t, security.Lifecycle(security.EventTokenRotated))
+	assert.False(t, security.Lifecycle(security.EventLoginFailed))
+}
+
+// Проверка записи события в лог.
+func TestLogSink(t *testing.T) {
+	var logs bytes.Buffer
+	sink := security.NewLogSink(slog.New(slog.NewTextHandler(&logs, nil)))
+	p := security.NewPipeline(slog.New(slog.NewTextHandler(io.Discard, nil)), sink)
+
+	p.Emit(context.Background(), security.Event{
+		Type:      security.EventRefreshTokenReuse,
+		Severity:  security.SeverityHigh,
+		UserID:    "user",
+		SessionID: "session",
+		ClientIP:  "203.0.113.7",
+		Details:   map[string]string{"b": "2", "a": "1"},
+	})
+
+	line := logs.String()
+	assert.Contains(t, line, "level=ERROR")
+	assert.Contains(t, line, `msg="Security event" audit=true type=refresh_token_reuse severity=high`)
+	assert.Contains(t, line, "session_id=session client_ip=203.0.113.7 a=1 b=2")
+}
+
+// Проверка подключения обработчиков к цепочкам по умолчанию.
+func TestNewDefaultPipeline(t *testing.T) {
+	recording := &fakeSink{name: "recording"}
+	security.SetSinks(recording)
+	t.Cleanup(func() { security.SetSinks() })
+
+	var logs bytes.Buffer
+	p := security.NewDefaultPipeline(slog.New(slog.NewTextHandler(&logs, nil)))
+	p.Emit(context.Background(), security.Event{Type: security.EventGeoBlocked, UserID: "user"})
+
+	assert.Contains(t, logs.String(), `msg="Security event"`)
+	assert.Len(t, recording.events, 1)
+}
+
+// Проверка набора действий в ответ на события.
+func TestActions(t *testing.T) {
+	actions := security.Actions{security.EventRefreshTokenReuse: security.ActionRevokeAll}
+	require.NoError(t, actions.Validate())
+	assert.Equal(t, security.ActionRevokeAll, actions.For(security.EventRefreshTokenReuse))
+	assert.Equal(t, security.ActionNone, actions.For(security.EventIPChange))
+	assert.Equal(t, security.ActionNone, security.Actions(nil).For(security.EventIPChange))
+
+	assert.Error(t, security.Actions{"unknown": security.ActionNone}.Validate())
+	assert.Error(t, security.Actions{security.EventIPChange: "block"}.Validate())
+}
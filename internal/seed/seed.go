@@ -0,0 +1,194 @@
+package seed
+
+import (
+	"auth_service/internal/pwned"
+	"auth_service/internal/services/tokens"
+	"auth_service/internal/storage/fieldcrypt"
+	"auth_service/internal/storage/postgres"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"gopkg.in/yaml.v3"
+)
+
+// Начальные данные для новой установки сервиса.
+type Seed struct {
+	Admin   Admin    `yaml:"admin"`
+	Scopes  []Scope  `yaml:"scopes"`
+	Roles   []Role   `yaml:"roles"`
+	Clients []Client `yaml:"clients"`
+}
+
+type Admin struct {
+	Email    string   `yaml:"email"`
+	Password string   `yaml:"password"`
+	Roles    []string `yaml:"roles"`
+}
+
+type Scope struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+type Role struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Scopes      []string `yaml:"scopes"`
+}
+
+type Client struct {
+	ID           string   `yaml:"id"`
+	Name         string   `yaml:"name"`
+	Secret       string   `yaml:"secret"`
+	RedirectURIs []string `yaml:"redirect_uris"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// Итоги применения начальных данных.
+type Result struct {
+	AdminID string
+	Scopes  int
+	Roles   int
+	Clients int
+}
+
+// Загружает начальные данные из YAML-файла.
+//
+// Принимает:
+// - path: путь к файлу.
+//
+// Возвращает:
+// - указатель на Seed.
+// - ошибку, если файл не удалось прочитать или он некорректен.
+func Load(path string) (*Seed, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file: %w", err)
+	}
+
+	var s Seed
+	if err := yaml.Unmarshal(content, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse seed file: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Seed) validate() error {
+	if s.Admin.Email == "" || s.Admin.Password == "" {
+		return errors.New("seed: admin email and password are required")
+	}
+	for _, c := range s.Clients {
+		if c.ID == "" || c.Secret == "" {
+			return fmt.Errorf("seed: client %q must have id and secret", c.Name)
+		}
+	}
+	return nil
+}
+
+// Записывает начальные данные в базу в одной транзакции.
+//
+// Операция идемпотентна: существующие записи обновляются, а пароль
+// существующего администратора не перезаписывается. Если задан keyring, email
+// администратора шифруется так же, как в хранилище PostgreSQL. Пароль
+// администратора проверяется по базе утечек, если проверка включена (pwned.Set).
+//
+// Принимает:
+// - ctx: контекст выполнения.
+// - pool: пул соединений с базой данных.
+// - s: начальные данные.
+// - keyring: ключи шифрования столбцов; nil — email хранится открыто.
+//
+// Возвращает:
+// - итоги применения.
+// - ошибку, если пароль администратора отклонён или данные не удалось записать.
+func Apply(ctx context.Context, pool *pgxpool.Pool, s *Seed, keyring *fieldcrypt.Keyring) (Result, error) {
+	if err := pwned.Check(ctx, s.Admin.Password); err != nil {
+		return Result{}, fmt.Errorf("admin password is rejected: %w", err)
+	}
+
+	var result Result
+
+	err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		for _, scope := range s.Scopes {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO scopes (name, description) VALUES ($1, $2)
+				ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description`,
+				scope.Name, scope.Description)
+			if err != nil {
+				return fmt.Errorf("failed to seed scope %s: %w", scope.Name, err)
+			}
+			result.Scopes++
+		}
+
+		for _, role := range s.Roles {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO roles (name, description) VALUES ($1, $2)
+				ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description`,
+				role.Name, role.Description)
+			if err != nil {
+				return fmt.Errorf("failed to seed role %s: %w", role.Name, err)
+			}
+			for _, scope := range role.Scopes {
+				_, err := tx.Exec(ctx, `
+					INSERT INTO role_scopes (role_name, scope_name) VALUES ($1, $2)
+					ON CONFLICT DO NOTHING`,
+					role.Name, scope)
+				if err != nil {
+					return fmt.Errorf("failed to assign scope %s to role %s: %w", scope, role.Name, err)
+				}
+			}
+			result.Roles++
+		}
+
+		passwordHash, err := tokens.HashPassword(s.Admin.Password)
+		if err != nil {
+			return fmt.Errorf("failed to hash admin password: %w", err)
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO users (email, password_hash) VALUES ($1, $2)
+			ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+			RETURNING id`,
+			keyring.EncryptDeterministic(postgres.ColumnUserEmail, s.Admin.Email), passwordHash).Scan(&result.AdminID)
+		if err != nil {
+			return fmt.Errorf("failed to seed admin user: %w", err)
+		}
+		for _, role := range s.Admin.Roles {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO user_roles (user_id, role_name) VALUES ($1, $2)
+				ON CONFLICT DO NOTHING`,
+				result.AdminID, role)
+			if err != nil {
+				return fmt.Errorf("failed to assign role %s to admin: %w", role, err)
+			}
+		}
+
+		for _, client := range s.Clients {
+			secretHash, err := tokens.HashPassword(client.Secret)
+			if err != nil {
+				return fmt.Errorf("failed to hash secret of client %s: %w", client.ID, err)
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (id) DO UPDATE
+				SET name = EXCLUDED.name, redirect_uris = EXCLUDED.redirect_uris, scopes = EXCLUDED.scopes`,
+				client.ID, client.Name, secretHash, client.RedirectURIs, client.Scopes)
+			if err != nil {
+				return fmt.Errorf("failed to seed client %s: %w", client.ID, err)
+			}
+			result.Clients++
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
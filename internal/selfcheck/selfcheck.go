@@ -0,0 +1,232 @@
+// Пакет selfcheck проверяет настройки безопасности при запуске сервиса.
+//
+// В окружении prod найденные проблемы (короткий или предсказуемый секрет,
+// значение-заглушка из примера конфигурации, слабые параметры хеширования паролей)
+// останавливают запуск, в остальных окружениях записываются в лог как
+// предупреждения: сервис не должен незаметно работать с небезопасной
+// конфигурацией. Слабый токен администратора останавливает запуск в любом
+// окружении: с ним маршруты /admin/* фактически не защищены.
+package selfcheck
+
+import (
+	"auth_service/internal/config"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+// Окружения, для которых проверки отличаются.
+const (
+	envLocal = "local"
+	envProd  = "prod"
+)
+
+// Требования к секретам.
+const (
+	// Минимальная длина секрета в байтах (ключ HS256 не короче выхода SHA-256).
+	MinSecretLength = 32
+	// Минимальная оценка энтропии секрета в битах.
+	MinSecretEntropy = 128
+)
+
+// Допустимая стоимость bcrypt: ниже подбор хешей слишком дёшев, выше
+// проверка одного пароля занимает секунды и открывает путь к отказу в обслуживании.
+const (
+	MinBcryptCost = 10
+	MaxBcryptCost = 14
+)
+
+// Минимальные параметры argon2id (рекомендация OWASP: 19 МиБ, 2 прохода).
+const (
+	MinArgon2Memory     = 19 * 1024
+	MinArgon2Iterations = 2
+)
+
+// Значения из примеров конфигурации и документации, которые нельзя
+// использовать как секреты.
+var placeholders = []string{
+	"secret", "password", "postgres", "changeme", "change-me", "change_me",
+	"default", "example", "test", "admin", "jwt_secret", "your-secret", "your_secret",
+	"placeholder", "qwerty", "123456",
+}
+
+// Результат проверки.
+type Finding struct {
+	// Проверяемый параметр конфигурации, например jwt_secret.
+	Setting string
+	Problem string
+	// Проблема останавливает запуск.
+	Fatal bool
+}
+
+// Возвращает описание проблемы.
+func (f Finding) String() string {
+	return f.Setting + ": " + f.Problem
+}
+
+// Проверяет настройки безопасности.
+//
+// Принимает:
+// - cfg: конфигурация приложения.
+//
+// Возвращает:
+// - найденные проблемы; слабый токен администратора фатален всегда, в
+// окружении prod фатальны и все остальные, кроме отсутствия TLS.
+func Check(cfg *config.Config) []Finding {
+	prod := cfg.Env == envProd
+	var findings []Finding
+	add := func(setting, problem string) {
+		findings = append(findings, Finding{Setting: setting, Problem: problem, Fatal: prod})
+	}
+
+	for _, secret := range []struct{ setting, value string }{
+		{"jwt_secret", cfg.JWTSecret},
+		{"refresh_token_secret", cfg.RefreshTokenSecret},
+	} {
+		if secret.value == "" {
+			continue
+		}
+		if problem := checkSecret(secret.value); problem != "" {
+			add(secret.setting, problem)
+		}
+	}
+
+	// Подбираемый токен администратора открывает /admin/* (отключение учётных
+	// записей, массовый отзыв сессий, режим обслуживания) любому клиенту,
+	// поэтому такой токен останавливает запуск в любом окружении.
+	for i, token := range cfg.Admin.Tokens {
+		problem := checkSecret(token)
+		if token == "" {
+			problem = "empty token"
+		}
+		if problem != "" {
+			findings = append(findings, Finding{Setting: fmt.Sprintf("admin.tokens[%d]", i), Problem: problem, Fatal: true})
+		}
+	}
+
+	if cfg.Storage.Driver == "" || cfg.Storage.Driver == "postgres" {
+		if isPlaceholder(cfg.Database.Password) {
+			add("database.password", "default or placeholder password")
+		}
+	}
+	if cfg.IPPrivacy.Mode == "hash" {
+		if problem := checkSecret(cfg.IPPrivacy.Salt); problem != "" {
+			add("ip_privacy.salt", problem)
+		}
+	}
+
+	switch security := cfg.Security; security.PasswordHash {
+	case "", "bcrypt":
+		if security.BcryptCost < MinBcryptCost || security.BcryptCost > MaxBcryptCost {
+			add("security.bcrypt_cost", fmt.Sprintf("cost %d is outside the range %d..%d", security.BcryptCost, MinBcryptCost, MaxBcryptCost))
+		}
+	case "argon2id":
+		if security.Argon2id.Memory < MinArgon2Memory {
+			add("security.argon2id.memory", fmt.Sprintf("must be at least %d KiB, got %d", MinArgon2Memory, security.Argon2id.Memory))
+		}
+		if security.Argon2id.Iterations < MinArgon2Iterations {
+			add("security.argon2id.iterations", fmt.Sprintf("must be at least %d, got %d", MinArgon2Iterations, security.Argon2id.Iterations))
+		}
+	}
+
+	// Без TLS (http_server.tls или mTLS) сервис принимает соединения без
+	// шифрования: его должен обеспечивать прокси или балансировщик перед ним.
+	if cfg.Env != envLocal && !cfg.MTLS.Enabled {
+		switch {
+		case !cfg.HTTPServer.TLS.Enabled:
+			findings = append(findings, Finding{
+				Setting: "tls",
+				Problem: "HTTP and gRPC servers accept plaintext connections; terminate TLS in front of the service",
+			})
+		case cfg.GRPCServer.Enabled:
+			findings = append(findings, Finding{
+				Setting: "tls",
+				Problem: "gRPC server accepts plaintext connections; enable mtls or terminate TLS in front of it",
+			})
+		}
+	}
+	return findings
+}
+
+// Проверяет настройки безопасности и записывает проблемы в лог.
+//
+// Принимает:
+// - cfg: конфигурация приложения.
+// - log: логгер.
+//
+// Возвращает:
+// - ошибку со всеми фатальными проблемами; nil, если запуск можно продолжить.
+func Run(cfg *config.Config, log *slog.Logger) error {
+	var errs []error
+	for _, finding := range Check(cfg) {
+		if finding.Fatal {
+			errs = append(errs, errors.New(finding.String()))
+			continue
+		}
+		log.Warn("Insecure configuration",
+			slog.String("setting", finding.Setting),
+			slog.String("problem", finding.Problem),
+		)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("security self-check failed: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Проверяет длину, энтропию и предсказуемость секрета.
+//
+// Возвращает:
+// - описание проблемы или пустую строку.
+func checkSecret(secret string) string {
+	switch {
+	case isPlaceholder(secret):
+		return "default or placeholder value"
+	case len(secret) < MinSecretLength:
+		return fmt.Sprintf("must be at least %d bytes long, got %d", MinSecretLength, len(secret))
+	case Entropy(secret) < MinSecretEntropy:
+		return fmt.Sprintf("estimated entropy %.0f bits is below %d bits", Entropy(secret), MinSecretEntropy)
+	}
+	return ""
+}
+
+// Проверяет, совпадает ли значение с заглушкой или содержит её (например, changeme123).
+func isPlaceholder(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, placeholder := range placeholders {
+		if value == placeholder || len(placeholder) >= 6 && strings.Contains(value, placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// Оценивает энтропию строки в битах по частоте её символов.
+//
+// Оценка не учитывает способ получения строки и завышает энтропию осмысленных
+// фраз, но надёжно отсеивает повторы и значения из небольшого набора символов
+// (например, "aaaa…" или короткий шестнадцатеричный ключ).
+//
+// Принимает:
+// - s: строка.
+//
+// Возвращает:
+// - длину строки, умноженную на энтропию Шеннона одного символа.
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[byte]int)
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var perSymbol float64
+	n := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / n
+		perSymbol -= p * math.Log2(p)
+	}
+	return perSymbol * n
+}
@@ -0,0 +1,135 @@
+package selfcheck
+
+import (
+	"auth_service/internal/config"
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const strongSecret = "q3Vx8Lr2Zk0pT5nYw9HcJm4bGf7sDa1E"
+
+func newConfig(env string) *config.Config {
+	return &config.Config{
+		Env:       env,
+		JWTSecret: strongSecret,
+		Database:  config.Database{Password: "Pf3kz9QwLr7xNv2M"},
+		Security:  config.Security{PasswordHash: "bcrypt", BcryptCost: 12},
+	}
+}
+
+// Проверка принятия безопасной конфигурации.
+func TestCheck_Secure(t *testing.T) {
+	assert.Empty(t, Check(newConfig(envLocal)))
+}
+
+// Проверка обнаружения слабых секретов и параметров хеширования паролей.
+func TestCheck_Findings(t *testing.T) {
+	for name, tc := range map[string]struct {
+		modify  func(cfg *config.Config)
+		setting string
+		problem string
+	}{
+		"placeholder":     {func(cfg *config.Config) { cfg.JWTSecret = "secret" }, "jwt_secret", "placeholder"},
+		"contains":        {func(cfg *config.Config) { cfg.JWTSecret = "changeme-" + strongSecret }, "jwt_secret", "placeholder"},
+		"short":           {func(cfg *config.Config) { cfg.JWTSecret = "k2Jx9" }, "jwt_secret", "at least 32 bytes"},
+		"low entropy":     {func(cfg *config.Config) { cfg.JWTSecret = strings.Repeat("ab", 20) }, "jwt_secret", "entropy"},
+		"refresh secret":  {func(cfg *config.Config) { cfg.RefreshTokenSecret = "qwerty" }, "refresh_token_secret", "placeholder"},
+		"db password":     {func(cfg *config.Config) { cfg.Database.Password = "password" }, "database.password", "placeholder"},
+		"ip privacy salt": {func(cfg *config.Config) { cfg.IPPrivacy = config.IPPrivacy{Mode: "hash"} }, "ip_privacy.salt", "at least"},
+	} {
+		cfg := newConfig(envLocal)
+		tc.modify(cfg)
+		findings := Check(cfg)
+		require.Len(t, findings, 1, name)
+		assert.Equal(t, tc.setting, findings[0].Setting, name)
+		assert.Contains(t, findings[0].Problem, tc.problem, name)
+		assert.False(t, findings[0].Fatal, name)
+	}
+
+	for _, cost := range []int{4, 9, 15} {
+		cfg := newConfig(envLocal)
+		cfg.Security.BcryptCost = cost
+		findings := Check(cfg)
+		require.Len(t, findings, 1)
+		assert.Equal(t, "security.bcrypt_cost", findings[0].Setting)
+	}
+
+	cfg := newConfig(envLocal)
+	cfg.Security = config.Security{PasswordHash: "argon2id", Argon2id: config.Argon2id{Memory: 64 * 1024, Iterations: 3, Parallelism: 2}}
+	assert.Empty(t, Check(cfg))
+	cfg.Security.Argon2id.Memory = 4096
+	cfg.Security.Argon2id.Iterations = 1
+	findings := Check(cfg)
+	require.Len(t, findings, 2)
+	assert.Equal(t, "security.argon2id.memory", findings[0].Setting)
+	assert.Equal(t, "security.argon2id.iterations", findings[1].Setting)
+}
+
+// Проверка остановки запуска в любом окружении, если токен администратора
+// можно подобрать.
+func TestCheck_AdminTokens(t *testing.T) {
+	cfg := newConfig(envLocal)
+	cfg.Admin.Tokens = []string{strongSecret}
+	assert.Empty(t, Check(cfg))
+
+	cfg.Admin.Tokens = []string{strongSecret, "admin", ""}
+	findings := Check(cfg)
+	require.Len(t, findings, 2)
+	assert.Equal(t, "admin.tokens[1]", findings[0].Setting)
+	assert.Contains(t, findings[0].Problem, "placeholder")
+	assert.True(t, findings[0].Fatal)
+	assert.Equal(t, "admin.tokens[2]", findings[1].Setting)
+	assert.True(t, findings[1].Fatal)
+
+	err := Run(cfg, slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "admin.tokens[1]")
+}
+
+// Проверка остановки запуска в prod и предупреждений в остальных окружениях.
+func TestRun(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+
+	cfg := newConfig("dev")
+	cfg.JWTSecret = "secret"
+	require.NoError(t, Run(cfg, log))
+	assert.Contains(t, buf.String(), "setting=jwt_secret")
+	assert.Contains(t, buf.String(), "setting=tls")
+
+	cfg.Env = envProd
+	buf.Reset()
+	err := Run(cfg, log)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "jwt_secret: default or placeholder value")
+	assert.NotContains(t, err.Error(), "tls")
+	assert.Contains(t, buf.String(), "setting=tls", "missing TLS is only a warning")
+
+	cfg.JWTSecret = strongSecret
+	assert.NoError(t, Run(cfg, log))
+
+	cfg.HTTPServer.TLS.Enabled = true
+	cfg.GRPCServer.Enabled = true
+	findings := Check(cfg)
+	require.Len(t, findings, 1)
+	assert.Contains(t, findings[0].Problem, "gRPC", "gRPC stays plaintext with HTTP TLS only")
+	cfg.GRPCServer.Enabled = false
+	assert.Empty(t, Check(cfg), "TLS is on for the HTTP server")
+
+	cfg.HTTPServer.TLS.Enabled = false
+	cfg.MTLS.Enabled = true
+	assert.Empty(t, Check(cfg), "TLS is on with mTLS enabled")
+}
+
+// Проверка оценки энтропии.
+func TestEntropy(t *testing.T) {
+	assert.Zero(t, Entropy(""))
+	assert.Zero(t, Entropy("aaaaaaaa"))
+	assert.InDelta(t, 24, Entropy("abcdefgh"), 1e-9)
+	assert.GreaterOrEqual(t, Entropy(strongSecret), float64(MinSecretEntropy))
+}
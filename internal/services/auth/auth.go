@@ -0,0 +1,1294 @@
+package auth
+
+import (
+	"auth_service/internal/accounts"
+	"auth_service/internal/clientip"
+	"auth_service/internal/geo"
+	"auth_service/internal/metrics"
+	"auth_service/internal/notify"
+	"auth_service/internal/outbox"
+	"auth_service/internal/passwordexpiry"
+	"auth_service/internal/quota"
+	"auth_service/internal/refreshlimit"
+	"auth_service/internal/security"
+	"auth_service/internal/services/tokens"
+	"auth_service/internal/storage"
+	"auth_service/internal/tracing"
+	"auth_service/lib/clock"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// Идентификатор пользователя не является UUID.
+	ErrInvalidUserID = errors.New("invalid user_id")
+	// Access-токен недействителен.
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	// Refresh-токен не соответствует сохранённому.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// Сессия пользователя не найдена.
+	ErrSessionNotFound = errors.New("session not found")
+	// Срок действия refresh-токена истёк.
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	// Доступ из страны клиента запрещён правилами.
+	ErrGeoBlocked = errors.New("access from client country is not allowed")
+	// Неизвестная политика истечения сессий.
+	ErrInvalidExpiryPolicy = errors.New("invalid session expiry policy")
+)
+
+// Политики истечения сессий.
+const (
+	// Каждое обновление токенов продлевает сессию на TTL.
+	ExpirySliding = "sliding"
+	// Срок сессии отсчитывается от входа и при обновлении не меняется.
+	ExpiryAbsolute = "absolute"
+)
+
+// Правила истечения сессий.
+type SessionPolicy struct {
+	// Срок действия refresh-токена.
+	TTL time.Duration
+	// ExpirySliding или ExpiryAbsolute.
+	Expiry string
+	// Максимальное время от входа, после которого обновление отклоняется
+	// независимо от политики; 0 — без ограничения.
+	MaxLifetime time.Duration
+	// Время неактивности, после которого обновление отклоняется; 0 — без ограничения.
+	IdleTimeout time.Duration
+	// Максимум одновременных сессий пользователя; при входе сверх него
+	// удаляются давно не использовавшиеся сессии. 0 — без ограничения.
+	MaxSessions int
+}
+
+// Причины завершения сессии (значения метки reason метрики endedSessions).
+const (
+	reasonLifetime = "lifetime"
+	reasonIdle     = "idle"
+	reasonEvicted  = "evicted"
+	reasonRevoked  = "revoked"
+)
+
+var endedSessions = metrics.NewCounterVec(
+	"auth_sessions_ended_total",
+	"Number of sessions ended by the service: lifetime or idle limit reached, evicted above the per-user limit, or revoked in bulk.",
+	"reason",
+)
+
+var securityActions = metrics.NewCounterVec(
+	"auth_security_actions_total",
+	"Number of automatic actions taken in response to security events, by action and event type.",
+	"action", "type",
+)
+
+var geoDecisions = metrics.NewCounterVec(
+	"auth_geo_decisions_total",
+	"Number of token issue and refresh requests checked against country restrictions, by decision.",
+	"decision",
+)
+
+var legacyHashLookups = metrics.NewCounterVec(
+	"auth_refresh_legacy_hash_lookups_total",
+	"Number of refresh token lookups that fell back to sessions stored with a pre-HMAC hash, by result. Stays flat once no such sessions are in use.",
+	"result",
+)
+
+var revocationNotices = metrics.NewCounterVec(
+	"auth_revocation_notices_total",
+	"Number of access token revocation notices published to resource servers, by result.",
+	"result",
+)
+
+// Допустимые границы срока действия refresh-токена.
+const (
+	MinRefreshTokenTTL = time.Hour
+	MaxRefreshTokenTTL = 365 * 24 * time.Hour
+)
+
+// Политика по умолчанию: 30 дней, продлеваемые при каждом обновлении.
+var DefaultSessionPolicy = SessionPolicy{TTL: 30 * 24 * time.Hour, Expiry: ExpirySliding}
+
+// Проверяет корректность политики.
+//
+// Возвращает:
+// - ErrInvalidExpiryPolicy, если политика неизвестна, срок не положителен,
+// срок refresh-токена вне допустимых границ или не превышает срок access-токена.
+func (p SessionPolicy) Validate() error {
+	if p.Expiry != ExpirySliding && p.Expiry != ExpiryAbsolute {
+		return fmt.Errorf("%w: %q", ErrInvalidExpiryPolicy, p.Expiry)
+	}
+	if p.TTL <= 0 || p.MaxLifetime < 0 || p.IdleTimeout < 0 {
+		return fmt.Errorf("%w: durations must be positive", ErrInvalidExpiryPolicy)
+	}
+	if p.TTL < MinRefreshTokenTTL || p.TTL > MaxRefreshTokenTTL {
+		return fmt.Errorf("%w: refresh token TTL %s is outside the range %s..%s", ErrInvalidExpiryPolicy, p.TTL, MinRefreshTokenTTL, MaxRefreshTokenTTL)
+	}
+	if p.TTL <= tokens.AccessTokenTTL() {
+		return fmt.Errorf("%w: refresh token TTL %s must exceed access token TTL %s", ErrInvalidExpiryPolicy, p.TTL, tokens.AccessTokenTTL())
+	}
+	if p.MaxSessions < 0 {
+		return fmt.Errorf("%w: max sessions must not be negative", ErrInvalidExpiryPolicy)
+	}
+	return nil
+}
+
+// Вычисляет срок действия сессии, начатой в createdAt, при выдаче токенов в now.
+func (p SessionPolicy) expiresAt(createdAt, now time.Time) time.Time {
+	expiresAt := now.Add(p.TTL)
+	if p.MaxLifetime > 0 {
+		if limit := createdAt.Add(p.MaxLifetime); limit.Before(expiresAt) {
+			return limit
+		}
+	}
+	return expiresAt
+}
+
+// Возвращает причину, по которой сессия больше не может обновляться
+// (reasonLifetime, reasonIdle), или пустую строку.
+//
+// Ограничение не применяется, если хранилище не сообщило соответствующее время.
+func (p SessionPolicy) endReason(session storage.Session, now time.Time) string {
+	switch {
+	case p.MaxLifetime > 0 && !session.CreatedAt.IsZero() && !now.Before(session.CreatedAt.Add(p.MaxLifetime)):
+		return reasonLifetime
+	case p.IdleTimeout > 0 && !session.LastUsedAt.IsZero() && !now.Before(session.LastUsedAt.Add(p.IdleTimeout)):
+		return reasonIdle
+	}
+	return ""
+}
+
+// Пара выданных токенов.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// Пароль пользователя истёк и его нужно сменить (см. пакет passwordexpiry).
+	PasswordExpired bool
+}
+
+// Данные, извлечённые из действительного access-токена.
+type Claims struct {
+	UserID   string
+	ClientIP string
+	// Сессия, в которой выдан токен; пуста у токенов, выданных до появления claim sid.
+	SessionID string
+	// Дополнительные claims: роли, разрешения, арендатор, тариф и прочие.
+	Custom tokens.CustomClaims
+}
+
+// Операции с токенами, общие для HTTP и gRPC API.
+type Service struct {
+	log           *slog.Logger
+	db            storage.Storage
+	jwtSecret     string
+	refreshSecret string
+	policy        SessionPolicy
+	clock         clock.Clock
+	// Проверять список отзыва при проверке access-токенов.
+	strict bool
+	// Точность сравнения IP-адресов при проверке их смены.
+	ipGranularity clientip.Granularity
+	// Ограничения доступа по странам.
+	geoRules geo.Rules
+	// Форма, в которой IP-адреса клиентов сохраняются в сессиях и токенах.
+	ipPrivacy clientip.Privacy
+	// Обработчики событий безопасности.
+	events *security.Pipeline
+	// Автоматические действия в ответ на события безопасности.
+	riskActions security.Actions
+	// Поиск сессий для массового отзыва; nil, если хранилище его не поддерживает.
+	finder storage.SessionFinder
+	// Рассылка уведомлений об отзыве access-токенов; nil — не рассылаются.
+	publisher storage.RevocationPublisher
+	// Источник дополнительных claims access-токенов; nil — без них.
+	claims ClaimsProvider
+	// Outbox событий ротации токенов; nil — события передаются обработчикам сразу.
+	outbox storage.Outbox
+}
+
+// Создаёт новый экземпляр Service.
+//
+// Принимает:
+// - log: указатель на logger для логирования событий.
+// - db: хранилище токенов и IP-адресов.
+// - jwtSecret: секретный ключ для подписи access-токенов (им же по умолчанию вычисляется HMAC refresh-токенов).
+//
+// Возвращает:
+// - указатель на Service.
+func New(log *slog.Logger, db storage.Storage, jwtSecret string) *Service {
+	return &Service{
+		log:           log,
+		db:            db,
+		jwtSecret:     jwtSecret,
+		refreshSecret: jwtSecret,
+		policy:        DefaultSessionPolicy,
+		clock:         clock.Real{},
+		events:        security.NewDefaultPipeline(log),
+		claims:        claimsProvider,
+	}
+}
+
+// Возвращает копию сервиса, записывающую сообщения в log (например, logger
+// запроса с его идентификатором). Остальные настройки, хранилище и
+// обработчики событий у копии общие с исходным сервисом.
+//
+// Принимает:
+// - log: указатель на logger.
+//
+// Возвращает:
+// - указатель на копию Service.
+func (s *Service) WithLogger(log *slog.Logger) *Service {
+	c := *s
+	c.log = log
+	return &c
+}
+
+// Устанавливает отдельный ключ HMAC для хеширования refresh-токенов.
+func (s *Service) WithRefreshSecret(secret string) *Service {
+	if secret != "" {
+		s.refreshSecret = secret
+	}
+	return s
+}
+
+// Устанавливает правила истечения сессий.
+//
+// Незаданные TTL и Expiry берутся из DefaultSessionPolicy.
+func (s *Service) WithSessionPolicy(policy SessionPolicy) *Service {
+	if policy.TTL == 0 {
+		policy.TTL = DefaultSessionPolicy.TTL
+	}
+	if policy.Expiry == "" {
+		policy.Expiry = DefaultSessionPolicy.Expiry
+	}
+	s.policy = policy
+	return s
+}
+
+// Включает строгую проверку access-токенов: ValidateToken отклоняет токены,
+// jti или sid которых занесён в список отзыва.
+//
+// Список заполняется при отзыве токенов и завершении сессий независимо от режима.
+func (s *Service) WithStrictValidation(strict bool) *Service {
+	s.strict = strict
+	return s
+}
+
+// Устанавливает точность сравнения IP-адресов при обновлении токенов: смена
+// адреса в пределах сети заданного размера не считается сменой IP.
+func (s *Service) WithIPGranularity(g clientip.Granularity) *Service {
+	s.ipGranularity = g
+	return s
+}
+
+// Устанавливает форму, в которой IP-адреса клиентов сохраняются в сессиях,
+// access-токенах и логах (см. clientip.Privacy). Смена адреса определяется
+// сравнением сохранённых форм; страна клиента — по исходному адресу.
+func (s *Service) WithIPPrivacy(p clientip.Privacy) *Service {
+	s.ipPrivacy = p
+	return s
+}
+
+// Устанавливает ограничения доступа по странам, проверяемые при выдаче и
+// обновлении токенов. Страна клиента определяется по базе geo.SetDatabase.
+func (s *Service) WithGeoRules(rules geo.Rules) *Service {
+	s.geoRules = rules
+	return s
+}
+
+// Устанавливает обработчики событий безопасности (смена IP-адреса, повторное
+// использование refresh-токена, отказ по стране). По умолчанию события
+// записываются в лог и передаются обработчикам, установленным security.SetSinks.
+func (s *Service) WithSecurityEvents(p *security.Pipeline) *Service {
+	s.events = p
+	return s
+}
+
+// Устанавливает автоматические действия в ответ на события безопасности:
+// отзыв сессии, в которой обнаружено событие, или всех сессий пользователя.
+// По умолчанию о событиях только сообщается.
+func (s *Service) WithRiskActions(actions security.Actions) *Service {
+	s.riskActions = actions
+	return s
+}
+
+// Устанавливает поиск сессий для массового отзыва (RevokeSessions).
+func (s *Service) WithSessionFinder(f storage.SessionFinder) *Service {
+	s.finder = f
+	return s
+}
+
+// Устанавливает рассылку уведомлений об отзыве access-токенов: при отзыве
+// токена или завершении сессии сервисы-потребители узнают об этом сразу, не
+// дожидаясь истечения токенов.
+func (s *Service) WithRevocationPublisher(p storage.RevocationPublisher) *Service {
+	s.publisher = p
+	return s
+}
+
+// Устанавливает outbox: события смены IP-адреса и ротации refresh-токена
+// сохраняются в одной транзакции с ротацией и публикуются outbox.Relay.
+//
+// Принимает:
+// - o: хранилище outbox; nil — события передаются обработчикам сразу.
+func (s *Service) WithOutbox(o storage.Outbox) *Service {
+	s.outbox = o
+	return s
+}
+
+// Устанавливает источник времени, от которого отсчитываются сроки сессий.
+func (s *Service) WithClock(c clock.Clock) *Service {
+	s.clock = c
+	return s
+}
+
+// Начинает спан операции сервиса (см. пакет tracing).
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - name: имя операции.
+//
+// Возвращает:
+// - контекст со спаном.
+// - спан; nil, если операция не записывается в трассировку.
+// - сервис, запросы которого к хранилищу выполняются в контексте спана, или
+// s, если спан не записывается.
+func (s *Service) trace(ctx context.Context, name string) (context.Context, *tracing.Span, *Service) {
+	ctx, span := tracing.Start(ctx, tracing.KindInternal, name)
+	if span == nil {
+		return ctx, nil, s
+	}
+	bound := *s
+	bound.db = storage.WithContext(s.db, ctx)
+	return ctx, span, &bound
+}
+
+// Выдаёт новую пару токенов и сохраняет сессию пользователя.
+//
+// Устройство клиента из контекста (см. WithDevice) сохраняется в сессии.
+// Access-токен получает дополнительные claims от ClaimsProvider и из
+// контекста (см. WithClaims).
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - userID: идентификатор пользователя (UUID).
+// - clientIP: IP-адрес клиента.
+//
+// Возвращает:
+// - пару access и refresh токенов.
+// - ErrInvalidUserID, если userID не является UUID.
+// - ErrGeoBlocked, если доступ из страны клиента запрещён.
+// - accounts.ErrDisabled, если учётная запись пользователя отключена.
+// - ошибку хранилища (в том числе storage.ErrUnavailable), ClaimsProvider или
+// генерации токенов (в том числе tokens.ErrReservedClaim).
+func (s *Service) IssueTokens(ctx context.Context, userID, clientIP string) (pair TokenPair, err error) {
+	ctx, span, s := s.trace(ctx, "auth.IssueTokens")
+	defer func() { span.SetError(err); span.End() }()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return TokenPair{}, ErrInvalidUserID
+	}
+	if err := accounts.Check(userID); err != nil {
+		return TokenPair{}, err
+	}
+	rawIP := clientIP
+	clientIP = s.ipPrivacy.Apply(clientIP)
+	if err := s.checkGeo(ctx, userID, "", rawIP, clientIP, "issue"); err != nil {
+		return TokenPair{}, err
+	}
+	if err := quota.CheckSessions(); err != nil {
+		return TokenPair{}, fmt.Errorf("failed to check session quota: %w", err)
+	}
+	custom, err := s.customClaims(ctx, userID)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to get custom claims: %w", err)
+	}
+
+	refreshToken, hashedToken, err := tokens.GenerateRefreshTokenAndHash(s.refreshSecret)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	now := s.clock.Now()
+	sessionID, err := s.db.SaveRefreshToken(userID, hashedToken, clientIP, s.policy.expiresAt(now, now))
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	s.evictSessions(userID, sessionID)
+	s.saveDevice(ctx, sessionID, storage.Device{})
+
+	version, err := s.db.GetTokenVersion(userID)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to get token version: %w", err)
+	}
+
+	accessToken, err := tokens.GenerateAccessToken(userID, clientIP, s.jwtSecret, hashedToken, sessionID, version, custom)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	s.tokenEvent(ctx, security.EventTokenIssued, userID, sessionID, clientIP, locationDetails(rawIP))
+	return TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// Обменивает действующую пару токенов на новую (ротация refresh-токена).
+//
+// Если IP-адрес клиента изменился с момента последней выдачи (с точностью,
+// заданной WithIPGranularity), пользователю отправляется предупреждение. Новый
+// срок сессии определяется политикой: при ExpirySliding он продлевается, при
+// ExpiryAbsolute сохраняется. Сессия, превысившая MaxLifetime или неактивная
+// дольше IdleTimeout, удаляется, и обновление отклоняется. Обновление из
+// страны, запрещённой WithGeoRules, отклоняется без удаления сессии.
+//
+// Access-токен необязателен: сессия находится по хешу refresh-токена. Если он
+// передан, он должен принадлежать пользователю сессии, а при наличии sid — той
+// же сессии; кроме того, повторное предъявление уже заменённого refresh-токена
+// распознаётся как событие refresh_token_reuse только по sid access-токена,
+// а неудачные попытки учитываются для пользователя (см. пакет refreshlimit).
+// Сообщённые клиентом поля устройства (см. WithDevice) заменяют сохранённые в сессии.
+// Дополнительные claims запрашиваются заново, как при выдаче: claims прежнего
+// access-токена не переносятся.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - accessToken: выданный ранее access-токен (в том числе истёкший) или пустая строка.
+// - refreshToken: refresh-токен сессии.
+// - clientIP: IP-адрес клиента, обновляющего токены; пустая строка — адрес из
+// access-токена или, без него, последний адрес сессии.
+//
+// Возвращает:
+// - новую пару access и refresh токенов.
+// - ErrInvalidAccessToken, ErrSessionNotFound или ErrInvalidRefreshToken, если токены не приняты
+// (ErrSessionNotFound — в том числе для сессии, превысившей MaxLifetime или IdleTimeout).
+// - ErrRefreshTokenExpired, если срок сессии истёк (сессия остаётся в хранилище до очистки).
+// - ErrGeoBlocked, если доступ из страны клиента запрещён.
+// - *refreshlimit.ThrottledError, если после неудачных попыток обновление
+// токенов пользователя (access-токена или, без него, найденной сессии)
+// временно запрещено.
+// - accounts.ErrDisabled, если учётная запись пользователя отключена (сессия
+// не удаляется и снова обновляется после включения).
+// - passwordexpiry.ErrExpired, если пароль пользователя истёк дольше
+// отсрочки назад (сессия не удаляется и снова обновляется после смены пароля).
+// - ошибку хранилища (в том числе storage.ErrUnavailable), ClaimsProvider или
+// генерации токенов.
+func (s *Service) RefreshTokens(ctx context.Context, accessToken, refreshToken, clientIP string) (pair TokenPair, err error) {
+	ctx, span, s := s.trace(ctx, "auth.RefreshTokens")
+	defer func() { span.SetError(err); span.End() }()
+
+	var claims tokens.AccessClaims
+	var session storage.Session
+	// Адрес клиента в сохраняемой форме для события refresh_failed; уточняется
+	// ниже, когда известна сессия.
+	var storedIP string
+	if clientIP != "" {
+		storedIP = s.ipPrivacy.Apply(clientIP)
+	}
+	defer func() {
+		if err != nil {
+			s.tokenEvent(ctx, security.EventRefreshFailed, cmp.Or(session.UserID, claims.UserID),
+				cmp.Or(session.ID, claims.SessionID), storedIP, map[string]string{"reason": refreshFailureReason(err)})
+		}
+	}()
+	if accessToken != "" {
+		// Срок действия не проверяется: к обновлению access-токен, как правило,
+		// уже истёк, а привязка к сессии проверяется ниже.
+		if claims, err = tokens.ParseExpiredAccessToken(accessToken, s.jwtSecret); err != nil {
+			return TokenPair{}, fmt.Errorf("%w: %s", ErrInvalidAccessToken, err)
+		}
+		if err := refreshlimit.Check(claims.UserID); err != nil {
+			return TokenPair{}, err
+		}
+		session, err = s.findSession(claims.UserID, refreshToken)
+	} else {
+		// Без access-токена пользователь известен только после поиска сессии.
+		session, err = s.sessionByRefreshToken(refreshToken)
+		if err == nil {
+			if err := refreshlimit.Check(session.UserID); err != nil {
+				return TokenPair{}, err
+			}
+		}
+	}
+
+	// Страна определяется по исходному адресу, а сохраняется и сравнивается clientIP.
+	rawIP := clientIP
+	if clientIP != "" {
+		clientIP = s.ipPrivacy.Apply(clientIP)
+	} else {
+		clientIP = claims.ClientIP
+		if accessToken == "" {
+			clientIP = session.ClientIP
+		}
+		if s.ipPrivacy.Raw() {
+			rawIP = clientIP
+		}
+	}
+
+	storedIP = clientIP
+
+	if errors.Is(err, ErrInvalidRefreshToken) && accessToken != "" {
+		s.detectReuse(ctx, claims, clientIP)
+	}
+	// Неудача засчитывается пользователю access-токена или найденной сессии;
+	// неизвестный refresh-токен без access-токена ни к кому не относится.
+	if failedUserID := cmp.Or(claims.UserID, session.UserID); failedUserID != "" &&
+		(errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrSessionNotFound)) {
+		s.recordRefreshFailure(failedUserID)
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	// Access-токен другой сессии того же пользователя не подходит к refresh-токену.
+	if claims.SessionID != "" && claims.SessionID != session.ID {
+		s.recordRefreshFailure(claims.UserID)
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	userID := session.UserID
+	lastIP := session.ClientIP
+	if err := accounts.Check(userID); err != nil {
+		return TokenPair{}, err
+	}
+	passwordExpired, err := passwordexpiry.CheckRefresh(userID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := s.clock.Now()
+	if reason := s.policy.endReason(session, now); reason != "" {
+		s.endSession(session, reason)
+		return TokenPair{}, fmt.Errorf("session %s limit exceeded: %w", reason, ErrSessionNotFound)
+	}
+	if err := s.checkGeo(ctx, userID, session.ID, rawIP, clientIP, "refresh"); err != nil {
+		return TokenPair{}, err
+	}
+
+	// События, которые сохраняются в outbox вместе с ротацией токена.
+	var pending []security.Event
+	if !s.ipGranularity.Same(clientIP, lastIP) {
+		event := security.Event{
+			Type:      security.EventIPChange,
+			Severity:  security.SeverityMedium,
+			Time:      now,
+			UserID:    userID,
+			SessionID: session.ID,
+			ClientIP:  clientIP,
+			Details:   map[string]string{"previous_ip": lastIP},
+		}
+		// Если событие отзывает сессию, ротации не будет, и оно передаётся
+		// обработчикам сразу.
+		var revoked bool
+		if s.outbox != nil && s.riskActions.For(event.Type) == security.ActionNone {
+			pending = append(pending, event)
+		} else {
+			revoked = s.report(ctx, event)
+		}
+
+		if err := s.warnIPChange(userID, lastIP, clientIP, now); err != nil {
+			return TokenPair{}, err
+		}
+		if revoked {
+			return TokenPair{}, fmt.Errorf("session revoked after %s event: %w", security.EventIPChange, ErrSessionNotFound)
+		}
+	}
+
+	custom, err := s.customClaims(ctx, userID)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to get custom claims: %w", err)
+	}
+	newRefreshToken, newHashedToken, err := tokens.GenerateRefreshTokenAndHash(s.refreshSecret)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	// Без access-токена claims ver и refresh_hash берутся как при выдаче.
+	version, refreshHash := claims.Version, claims.RefreshHash
+	if accessToken == "" {
+		if version, err = s.db.GetTokenVersion(userID); err != nil {
+			return TokenPair{}, fmt.Errorf("failed to get token version: %w", err)
+		}
+		refreshHash = newHashedToken
+	}
+	newAccessToken, err := tokens.GenerateAccessToken(userID, clientIP, s.jwtSecret, refreshHash, session.ID, version, custom)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	expiresAt := s.sessionExpiry(session, now)
+	if s.outbox != nil {
+		pending = append(pending, security.Event{
+			Type:      security.EventTokenRotated,
+			Severity:  security.SeverityLow,
+			Time:      now,
+			UserID:    userID,
+			SessionID: session.ID,
+			ClientIP:  clientIP,
+			Details:   locationDetails(rawIP),
+		})
+		err = s.rotateWithEvents(session.ID, session.RefreshTokenHash, newHashedToken, clientIP, expiresAt, pending)
+	} else if err = s.db.UpdateRefreshToken(session.ID, session.RefreshTokenHash, newHashedToken, clientIP, expiresAt); err == nil {
+		s.tokenEvent(ctx, security.EventTokenRotated, userID, session.ID, clientIP, locationDetails(rawIP))
+	}
+	if err != nil {
+		return TokenPair{}, sessionError("failed to update refresh token", err)
+	}
+	s.saveDevice(ctx, session.ID, session.Device)
+
+	return TokenPair{AccessToken: newAccessToken, RefreshToken: newRefreshToken, PasswordExpired: passwordExpired}, nil
+}
+
+// Проверяет access-токен и возвращает его данные.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - accessToken: проверяемый токен.
+//
+// В строгом режиме (WithStrictValidation) токен также проверяется по списку
+// отзыва: отклоняются отозванные токены и токены завершённых сессий, а
+// также токены, выданные до выхода пользователя со всех устройств (LogoutAll).
+//
+// Возвращает:
+// - данные токена.
+// - ErrInvalidAccessToken, если токен недействителен или отозван.
+// - ошибку хранилища (в том числе storage.ErrUnavailable) в строгом режиме.
+func (s *Service) ValidateToken(ctx context.Context, accessToken string) (_ Claims, err error) {
+	ctx, span, s := s.trace(ctx, "auth.ValidateToken")
+	defer func() { span.SetError(err); span.End() }()
+
+	claims, err := tokens.ParseAccessToken(accessToken, s.jwtSecret)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %s", ErrInvalidAccessToken, err)
+	}
+
+	if s.strict {
+		var keys []string
+		if claims.ID != "" {
+			keys = append(keys, tokenKey(claims.ID))
+		}
+		if claims.SessionID != "" {
+			keys = append(keys, sessionKey(claims.SessionID))
+		}
+		denied, err := s.db.IsAccessTokenDenied(keys...)
+		if err != nil {
+			return Claims{}, fmt.Errorf("failed to check access token denylist: %w", err)
+		}
+		if denied {
+			return Claims{}, fmt.Errorf("%w: token has been revoked", ErrInvalidAccessToken)
+		}
+
+		version, err := s.db.GetTokenVersion(claims.UserID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return Claims{}, fmt.Errorf("%w: user not found", ErrInvalidAccessToken)
+		}
+		if err != nil {
+			return Claims{}, fmt.Errorf("failed to check token version: %w", err)
+		}
+		if claims.Version < version {
+			return Claims{}, fmt.Errorf("%w: token version has been revoked", ErrInvalidAccessToken)
+		}
+	}
+	return Claims{UserID: claims.UserID, ClientIP: claims.ClientIP, SessionID: claims.SessionID, Custom: claims.Custom}, nil
+}
+
+// Отзывает все сессии пользователя: выданные refresh-токены перестают приниматься,
+// а sid сессий заносятся в список отзыва access-токенов.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - userID: идентификатор пользователя (UUID).
+//
+// Возвращает:
+// - ErrInvalidUserID, если userID не является UUID.
+// - ErrSessionNotFound, если активной сессии нет.
+// - ошибку хранилища (в том числе storage.ErrUnavailable).
+func (s *Service) RevokeSession(ctx context.Context, userID string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidUserID
+	}
+
+	sessions, err := s.db.ListSessions(userID)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if err := s.denySession(session.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.DeleteRefreshToken(userID); err != nil {
+		return sessionError("failed to revoke session", err)
+	}
+
+	s.tokenEvent(ctx, security.EventTokenRevoked, userID, "", "", map[string]string{"scope": "all"})
+	s.log.Info("Sessions revoked", slog.String("user_id", userID))
+	return nil
+}
+
+// Выход со всех устройств: повышает версию токенов пользователя, заносит sid
+// его сессий в список отзыва и удаляет сессии.
+//
+// После повышения версии строгая проверка (WithStrictValidation) отклоняет
+// все выданные ранее access-токены пользователя, в том числе без sid.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - userID: идентификатор пользователя (UUID).
+//
+// Возвращает:
+// - количество отозванных сессий (0, если активных сессий не было).
+// - ErrInvalidUserID, если userID не является UUID.
+// - ошибку хранилища (в том числе storage.ErrNotFound для неизвестного пользователя).
+func (s *Service) LogoutAll(ctx context.Context, userID string) (int, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return 0, ErrInvalidUserID
+	}
+
+	version, err := s.db.BumpTokenVersion(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump token version: %w", err)
+	}
+
+	sessions, err := s.db.ListSessions(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if err := s.denySession(session.ID); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.db.DeleteRefreshToken(userID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	endedSessions.Add(float64(len(sessions)), reasonRevoked)
+	s.tokenEvent(ctx, security.EventTokenRevoked, userID, "", "", map[string]string{"scope": "all"})
+
+	s.log.Info("Logged out from all devices",
+		slog.String("user_id", userID),
+		slog.Int("sessions", len(sessions)),
+		slog.Int64("token_version", version))
+	return len(sessions), nil
+}
+
+// Отзывает сессию, которой принадлежит refresh-токен; другие сессии пользователя сохраняются.
+// Sid сессии заносится в список отзыва access-токенов.
+//
+// Сессия ищется по хешу токена, поэтому идентификатор пользователя не нужен.
+// Сессии с bcrypt-хешем (выданные до перехода на HMAC) так найти нельзя.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - refreshToken: выданный refresh-токен.
+//
+// Возвращает:
+// - ErrSessionNotFound, если сессии с таким токеном нет.
+// - ошибку хранилища (в том числе storage.ErrUnavailable).
+func (s *Service) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	session, err := s.db.GetSessionByRefreshHash(tokens.HashRefreshToken(refreshToken, s.refreshSecret))
+	if err != nil {
+		return sessionError("failed to find session", err)
+	}
+
+	if err := s.denySession(session.ID); err != nil {
+		return err
+	}
+	if err := s.db.DeleteSession(session.ID); err != nil {
+		return sessionError("failed to revoke session", err)
+	}
+
+	s.tokenEvent(ctx, security.EventTokenRevoked, session.UserID, session.ID, session.ClientIP, map[string]string{"scope": "session"})
+	s.log.Info("Session revoked", slog.String("user_id", session.UserID), slog.String("session_id", session.ID))
+	return nil
+}
+
+// Выход из сессии, в которой выдан access-токен: сессия удаляется, а её sid
+// заносится в список отзыва access-токенов. Другие сессии пользователя
+// сохраняются.
+//
+// Токен проверяется так же, как в ValidateToken. Для токенов, выданных до
+// появления sid, сессия неизвестна, поэтому удаляются все refresh-токены
+// пользователя.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - accessToken: access-токен завершаемой сессии.
+//
+// Возвращает:
+// - ErrInvalidAccessToken, если токен недействителен или отозван.
+// - ErrSessionNotFound, если сессия уже завершена.
+// - ошибку хранилища (в том числе storage.ErrUnavailable).
+func (s *Service) Logout(ctx context.Context, accessToken string) error {
+	claims, err := s.ValidateToken(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	if claims.SessionID == "" {
+		if err := s.db.DeleteRefreshToken(claims.UserID); err != nil {
+			return sessionError("failed to log out", err)
+		}
+		s.tokenEvent(ctx, security.EventTokenRevoked, claims.UserID, "", "", map[string]string{"scope": "all"})
+		s.log.Info("Logged out", slog.String("user_id", claims.UserID))
+		return nil
+	}
+
+	if err := s.denySession(claims.SessionID); err != nil {
+		return err
+	}
+	if err := s.db.DeleteSession(claims.SessionID); err != nil {
+		return sessionError("failed to log out", err)
+	}
+	endedSessions.Inc(reasonRevoked)
+
+	s.tokenEvent(ctx, security.EventTokenRevoked, claims.UserID, claims.SessionID, "", map[string]string{"scope": "session"})
+	s.log.Info("Logged out", slog.String("user_id", claims.UserID), slog.String("session_id", claims.SessionID))
+	return nil
+}
+
+// Заносит access-токен в список отзыва до истечения его срока.
+//
+// Отзыв учитывается проверкой в строгом режиме (WithStrictValidation); сессия
+// токена и её refresh-токен не затрагиваются.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - accessToken: отзываемый токен.
+//
+// Возвращает:
+// - ErrInvalidAccessToken, если токен недействителен или в нём нет jti.
+// - ошибку хранилища (в том числе storage.ErrUnavailable).
+func (s *Service) RevokeAccessToken(ctx context.Context, accessToken string) error {
+	claims, err := tokens.ParseAccessToken(accessToken, s.jwtSecret)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAccessToken, err)
+	}
+	if claims.ID == "" {
+		return fmt.Errorf("%w: jti is missing", ErrInvalidAccessToken)
+	}
+
+	if err := s.db.DenyAccessToken(tokenKey(claims.ID), claims.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	s.publishRevocation(storage.RevocationNotice{TokenID: claims.ID, ExpiresAt: claims.ExpiresAt})
+
+	s.log.Info("Access token revoked", slog.String("user_id", claims.UserID), slog.String("session_id", claims.SessionID))
+	return nil
+}
+
+// Проверяет, разрешён ли доступ из страны клиента, и учитывает решение в
+// метрике auth_geo_decisions_total. Разрешение записывается в журнал аудита
+// (лог с audit=true), отказ передаётся обработчикам событий безопасности.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - userID: идентификатор пользователя.
+// - sessionID: идентификатор обновляемой сессии; пустая строка при выдаче токенов.
+// - rawIP: исходный IP-адрес клиента; пустая строка — неизвестен.
+// - clientIP: сохраняемая форма адреса (для журнала).
+// - action: операция (issue, refresh).
+//
+// Возвращает:
+// - ErrGeoBlocked, если доступ запрещён.
+func (s *Service) checkGeo(ctx context.Context, userID, sessionID, rawIP, clientIP, action string) error {
+	if !s.geoRules.Enabled() {
+		return nil
+	}
+
+	country := geo.Country(rawIP)
+	if !s.geoRules.Allowed(country) {
+		geoDecisions.Inc("deny")
+		s.report(ctx, security.Event{
+			Type:      security.EventGeoBlocked,
+			Severity:  security.SeverityMedium,
+			Time:      s.clock.Now(),
+			UserID:    userID,
+			SessionID: sessionID,
+			ClientIP:  clientIP,
+			Details:   map[string]string{"action": action, "country": country},
+		})
+		return ErrGeoBlocked
+	}
+
+	geoDecisions.Inc("allow")
+	s.log.InfoContext(ctx, "Geo access decision",
+		slog.Bool("audit", true),
+		slog.String("decision", "allow"),
+		slog.String("action", action),
+		slog.String("user_id", userID),
+		slog.String("client_ip", clientIP),
+		slog.String("country", country),
+	)
+	return nil
+}
+
+// Учитывает неудачную попытку обновления токенов пользователем (см. пакет
+// refreshlimit). Ошибки хранилища только логируются: обновление и так отклоняется.
+func (s *Service) recordRefreshFailure(userID string) {
+	if err := refreshlimit.RecordFailure(userID); err != nil {
+		s.log.Error("Failed to record refresh failure", slog.String("user_id", userID), slog.String("error", err.Error()))
+	}
+}
+
+// Сообщает о повторном использовании refresh-токена, если access-токен
+// относится к существующей сессии, а refresh-токен ей не соответствует: как
+// правило, это токен, уже ротированный ранее, и одна из копий пары могла
+// попасть к злоумышленнику.
+//
+// Ошибки хранилища только логируются: обновление и так отклоняется.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - claims: данные access-токена.
+// - clientIP: сохраняемая форма адреса клиента.
+func (s *Service) detectReuse(ctx context.Context, claims tokens.AccessClaims, clientIP string) {
+	if claims.SessionID == "" {
+		return
+	}
+	sessions, err := s.db.ListSessions(claims.UserID)
+	if err != nil {
+		s.log.Error("Failed to list sessions", slog.String("user_id", claims.UserID), slog.String("error", err.Error()))
+		return
+	}
+	if !slices.ContainsFunc(sessions, func(session storage.Session) bool { return session.ID == claims.SessionID }) {
+		return
+	}
+	s.report(ctx, security.Event{
+		Type:      security.EventRefreshTokenReuse,
+		Severity:  security.SeverityHigh,
+		Time:      s.clock.Now(),
+		UserID:    claims.UserID,
+		SessionID: claims.SessionID,
+		ClientIP:  clientIP,
+	})
+}
+
+// Передаёт событие безопасности обработчикам и выполняет действие, заданное
+// для его типа WithRiskActions.
+//
+// Ошибки отзыва только логируются: запрос, в котором обнаружено событие,
+// обрабатывается дальше.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - event: событие.
+//
+// Возвращает:
+// - true, если сессия события отозвана.
+func (s *Service) report(ctx context.Context, event security.Event) bool {
+	s.events.Emit(ctx, event)
+
+	action := s.riskActions.For(event.Type)
+	var err error
+	switch {
+	case action == security.ActionRevokeSession && event.SessionID != "":
+		if err = s.denySession(event.SessionID); err == nil {
+			err = s.db.DeleteSession(event.SessionID)
+		}
+	case action == security.ActionRevokeAll && event.UserID != "":
+		err = s.RevokeSession(ctx, event.UserID)
+	default:
+		return false
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, ErrSessionNotFound) {
+		s.log.Error("Failed to revoke sessions after security event",
+			slog.String("type", event.Type),
+			slog.String("action", action),
+			slog.String("user_id", event.UserID),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+
+	securityActions.Inc(action, event.Type)
+	s.log.WarnContext(ctx, "Sessions revoked after security event",
+		slog.Bool("audit", true),
+		slog.String("type", event.Type),
+		slog.String("action", action),
+		slog.String("user_id", event.UserID),
+		slog.String("session_id", event.SessionID),
+	)
+	return true
+}
+
+// Сообщает о событии жизненного цикла токенов обработчикам, подписанным на
+// него (см. security.Lifecycle).
+func (s *Service) tokenEvent(ctx context.Context, eventType, userID, sessionID, clientIP string, details map[string]string) {
+	s.events.Emit(ctx, security.Event{
+		Type:      eventType,
+		Severity:  security.SeverityLow,
+		Time:      s.clock.Now(),
+		UserID:    userID,
+		SessionID: sessionID,
+		ClientIP:  clientIP,
+		Details:   details,
+	})
+}
+
+// Возвращает подробности событий выдачи и обновления токенов о
+// местоположении клиента: страну по исходному адресу (см. geo.Country), если
+// её удалось определить. Страна попадает в историю входов пользователя.
+func locationDetails(rawIP string) map[string]string {
+	if country := geo.Country(rawIP); country != "" {
+		return map[string]string{"country": country}
+	}
+	return nil
+}
+
+// Возвращает причину отказа в обновлении токенов для события refresh_failed.
+func refreshFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidAccessToken):
+		return "invalid_access_token"
+	case errors.Is(err, ErrSessionNotFound):
+		return "session_not_found"
+	case errors.Is(err, ErrInvalidRefreshToken):
+		return "invalid_refresh_token"
+	case errors.Is(err, ErrRefreshTokenExpired):
+		return "refresh_token_expired"
+	case errors.Is(err, ErrGeoBlocked):
+		return "geo_blocked"
+	case errors.Is(err, accounts.ErrDisabled):
+		return "account_disabled"
+	case errors.Is(err, passwordexpiry.ErrExpired):
+		return "password_expired"
+	case errors.Is(err, refreshlimit.ErrThrottled):
+		return "throttled"
+	default:
+		return "error"
+	}
+}
+
+// Ротирует refresh-токен сессии и сохраняет события в outbox в той же транзакции.
+func (s *Service) rotateWithEvents(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time, events []security.Event) error {
+	records := make([]storage.OutboxEvent, 0, len(events))
+	for _, event := range events {
+		record, err := outbox.Encode(event)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	return s.outbox.UpdateRefreshTokenWithEvents(sessionID, oldHash, hashedToken, clientIP, expiresAt, records)
+}
+
+// Отправляет пользователю предупреждение о смене IP-адреса.
+//
+// Письмо формируется по шаблону notify.IPChange на предпочитаемом языке
+// пользователя; если язык получить не удалось, используется язык по умолчанию.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - lastIP: прежний IP-адрес клиента.
+// - clientIP: новый IP-адрес клиента.
+// - now: время обновления токенов.
+//
+// Возвращает:
+// - ошибку, если не удалось получить email пользователя.
+func (s *Service) warnIPChange(userID, lastIP, clientIP string, now time.Time) error {
+	email, err := s.db.GetUserEmail(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user email: %w", err)
+	}
+	locale, err := s.db.GetUserLocale(userID)
+	if err != nil {
+		s.log.Warn("Failed to get user locale, using default", slog.String("user_id", userID), slog.String("error", err.Error()))
+	}
+
+	message, err := notify.Render(locale, notify.IPChange, notify.IPChangeData{PreviousIP: lastIP, CurrentIP: clientIP, Time: now})
+	if err != nil {
+		s.log.Error("Failed to render warning email", slog.String("user_id", userID), slog.String("error", err.Error()))
+		return nil
+	}
+
+	s.log.Warn("Sending warning email",
+		slog.String("email", email),
+		slog.String("user_id", userID),
+		slog.String("locale", message.Locale),
+		slog.String("subject", message.Subject),
+	)
+	// Здесь можно добавить реальную интеграцию с почтовым сервисом.
+	return nil
+}
+
+// Находит сессию пользователя, которой принадлежит refresh-токен.
+//
+// Сессия ищется по HMAC-хешу токена через индекс; если такого хеша нет,
+// проверяются сессии пользователя с хешем bcrypt или argon2id, сохранённые до
+// перехода на HMAC. Найденная так сессия при ротации получает HMAC-хеш;
+// обращения к этому пути считает метрика auth_refresh_legacy_hash_lookups_total.
+//
+// Принимает:
+// - userID: идентификатор пользователя из access-токена.
+// - refreshToken: предъявленный refresh-токен.
+//
+// Возвращает:
+// - сессию.
+// - ErrSessionNotFound или ErrInvalidRefreshToken, если токен не принят.
+// - ErrRefreshTokenExpired, если срок сессии истёк.
+// - ошибку хранилища.
+func (s *Service) findSession(userID, refreshToken string) (storage.Session, error) {
+	session, err := s.db.GetSessionByRefreshHash(tokens.HashRefreshToken(refreshToken, s.refreshSecret))
+	switch {
+	case err == nil:
+		if session.UserID != userID {
+			return storage.Session{}, ErrInvalidRefreshToken
+		}
+		return session, nil
+	case errors.Is(err, storage.ErrExpired):
+		return storage.Session{}, ErrRefreshTokenExpired
+	case !errors.Is(err, storage.ErrNotFound):
+		return storage.Session{}, fmt.Errorf("failed to find session: %w", err)
+	}
+
+	sessions, err := s.db.ListSessions(userID)
+	if err != nil {
+		return storage.Session{}, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	if len(sessions) == 0 {
+		return storage.Session{}, ErrSessionNotFound
+	}
+	legacy := false
+	for _, session := range sessions {
+		if !tokens.IsLegacyHash(session.RefreshTokenHash) {
+			continue
+		}
+		legacy = true
+		if tokens.CompareRefreshToken(session.RefreshTokenHash, refreshToken, s.refreshSecret) == nil {
+			legacyHashLookups.Inc("matched")
+			return session, nil
+		}
+	}
+	if legacy {
+		legacyHashLookups.Inc("mismatched")
+	}
+	return storage.Session{}, ErrInvalidRefreshToken
+}
+
+// Находит сессию по HMAC-хешу refresh-токена без идентификатора пользователя.
+// Сессии с хешем, сохранённым до перехода на HMAC, так найти нельзя.
+//
+// Возвращает:
+// - сессию.
+// - ErrInvalidRefreshToken, если сессии с таким токеном нет.
+// - ErrRefreshTokenExpired, если срок сессии истёк.
+// - ошибку хранилища.
+func (s *Service) sessionByRefreshToken(refreshToken string) (storage.Session, error) {
+	session, err := s.db.GetSessionByRefreshHash(tokens.HashRefreshToken(refreshToken, s.refreshSecret))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return storage.Session{}, ErrInvalidRefreshToken
+	case errors.Is(err, storage.ErrExpired):
+		return storage.Session{}, ErrRefreshTokenExpired
+	case err != nil:
+		return storage.Session{}, fmt.Errorf("failed to find session: %w", err)
+	}
+	return session, nil
+}
+
+// Удаляет сессию, которая больше не может обновляться, и заносит её sid в список отзыва.
+func (s *Service) endSession(session storage.Session, reason string) {
+	if err := s.denySession(session.ID); err != nil {
+		s.log.Error("Failed to deny ended session", slog.String("session_id", session.ID), slog.String("error", err.Error()))
+	}
+	if err := s.db.DeleteSession(session.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		s.log.Error("Failed to delete ended session", slog.String("session_id", session.ID), slog.String("error", err.Error()))
+		return
+	}
+	endedSessions.Inc(reason)
+	s.log.Info("Session ended",
+		slog.String("user_id", session.UserID),
+		slog.String("session_id", session.ID),
+		slog.String("reason", reason),
+		slog.Time("created_at", session.CreatedAt),
+		slog.Time("last_used_at", session.LastUsedAt),
+	)
+}
+
+// Удаляет давно не использовавшиеся сессии пользователя сверх MaxSessions.
+//
+// Ошибки хранилища только логируются: новая сессия уже сохранена, и вход не
+// должен отклоняться из-за того, что не удалось завершить старую.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - currentID: только что начатая сессия, которая не удаляется.
+func (s *Service) evictSessions(userID, currentID string) {
+	if s.policy.MaxSessions <= 0 {
+		return
+	}
+
+	sessions, err := s.db.ListSessions(userID)
+	if err != nil {
+		s.log.Error("Failed to list sessions", slog.String("user_id", userID), slog.String("error", err.Error()))
+		return
+	}
+
+	// Сессии упорядочены от последней использованной, поэтому удаляются с конца.
+	excess := len(sessions) - s.policy.MaxSessions
+	for i := len(sessions) - 1; i >= 0 && excess > 0; i-- {
+		if sessions[i].ID == currentID {
+			continue
+		}
+		s.endSession(sessions[i], reasonEvicted)
+		excess--
+	}
+}
+
+// Заносит sid сессии в список отзыва на срок действия выданных в ней access-токенов.
+func (s *Service) denySession(sessionID string) error {
+	expiresAt := s.clock.Now().Add(tokens.AccessTokenTTL())
+	if err := s.db.DenyAccessToken(sessionKey(sessionID), expiresAt); err != nil {
+		return fmt.Errorf("failed to deny session access tokens: %w", err)
+	}
+	s.publishRevocation(storage.RevocationNotice{SessionID: sessionID, ExpiresAt: expiresAt})
+	return nil
+}
+
+// Рассылает уведомление об отзыве сервисам-потребителям.
+//
+// Отзыв уже записан в список отзыва, поэтому ошибка рассылки только
+// записывается в лог: потребители без уведомления отклонят токены по сроку.
+func (s *Service) publishRevocation(notice storage.RevocationNotice) {
+	if s.publisher == nil {
+		return
+	}
+	if err := s.publisher.PublishRevocation(notice); err != nil {
+		revocationNotices.Inc("error")
+		s.log.Warn("Failed to publish revocation notice",
+			slog.String("session_id", notice.SessionID),
+			slog.String("token_id", notice.TokenID),
+			slog.String("error", err.Error()))
+		return
+	}
+	revocationNotices.Inc("published")
+}
+
+// Ключи списка отзыва access-токенов.
+func tokenKey(id string) string          { return "jti:" + id }
+func sessionKey(sessionID string) string { return "sid:" + sessionID }
+
+// Вычисляет новый срок сессии при обновлении токенов.
+//
+// Если время входа или срок сессии неизвестны, срок отсчитывается от текущего момента.
+func (s *Service) sessionExpiry(session storage.Session, now time.Time) time.Time {
+	if s.policy.Expiry == ExpiryAbsolute && !session.ExpiresAt.IsZero() {
+		return session.ExpiresAt
+	}
+	createdAt := session.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	return s.policy.expiresAt(createdAt, now)
+}
+
+// Приводит storage.ErrNotFound к ErrSessionNotFound, остальные ошибки оборачивает с описанием.
+func sessionError(msg string, err error) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%s: %w", msg, ErrSessionNotFound)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
@@ -0,0 +1,1165 @@
+package auth_test
+
+import (
+	"auth_service/internal/accounts"
+	"auth_service/internal/clientip"
+	"auth_service/internal/geo"
+	"auth_service/internal/lockout"
+	"auth_service/internal/metrics"
+	"auth_service/internal/outbox"
+	"auth_service/internal/passwordexpiry"
+	"auth_service/internal/security"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/services/tokens"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/memory"
+	"auth_service/internal/tracing"
+	"auth_service/lib/clock"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const userID = "123e4567-e89b-12d3-a456-426614174000"
+
+func newService(t *testing.T) *auth.Service {
+	t.Helper()
+
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	return auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+}
+
+// Проверка полного цикла: выдача, проверка, ротация и отзыв сессии.
+func TestService_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t)
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	claims, err := svc.ValidateToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+	assert.Equal(t, "127.0.0.1", claims.ClientIP)
+
+	refreshed, err := svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	assert.NotEqual(t, issued.RefreshToken, refreshed.RefreshToken)
+
+	// Старый refresh-токен после ротации не принимается.
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+
+	require.NoError(t, svc.RevokeSession(ctx, userID))
+	_, err = svc.RefreshTokens(ctx, refreshed.AccessToken, refreshed.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+
+	assert.ErrorIs(t, svc.RevokeSession(ctx, userID), auth.ErrSessionNotFound)
+}
+
+// Проверка ошибок валидации входных данных.
+func TestService_InvalidInput(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t)
+
+	_, err := svc.IssueTokens(ctx, "not-a-uuid", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidUserID)
+
+	_, err = svc.ValidateToken(ctx, "invalid_token")
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+
+	_, err = svc.RefreshTokens(ctx, "invalid_token", "refresh", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+}
+
+// Проверка входа по email и паролю.
+func TestService_Login(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	db.CreateUser("223e4567-e89b-12d3-a456-426614174000", "nopassword@example.com")
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, db.SetPassword(userID, string(hash)))
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+
+	pair, err := svc.Login(ctx, "test@example.com", "correct horse", "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(ctx, pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+
+	_, err = svc.Login(ctx, "test@example.com", "wrong", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = svc.Login(ctx, "unknown@example.com", "correct horse", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	// Пользователь без пароля входить по паролю не может.
+	_, err = svc.Login(ctx, "nopassword@example.com", "", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+// Проверка блокировки входа после неудачных попыток и событий о них.
+func TestService_LoginLockout(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, db.SetPassword(userID, string(hash)))
+	require.NoError(t, lockout.Set(db, lockout.Policy{MaxAccountFailures: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, ResetAfter: time.Hour}))
+	t.Cleanup(func() { lockout.Set(nil, lockout.Policy{}) })
+
+	sink := &recordingSink{}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := auth.New(log, db, "secret").WithSecurityEvents(security.NewPipeline(log, sink))
+
+	// Успешный вход сбрасывает счёт неудачных попыток.
+	_, err = svc.Login(ctx, "test@example.com", "wrong", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	_, err = svc.Login(ctx, "test@example.com", "correct horse", "127.0.0.1")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = svc.Login(ctx, "test@example.com", "wrong", "127.0.0.1")
+		assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	}
+	_, err = svc.Login(ctx, "test@example.com", "correct horse", "127.0.0.1")
+	var lockedErr *lockout.LockedError
+	require.ErrorAs(t, err, &lockedErr)
+	assert.Equal(t, lockout.ScopeAccount, lockedErr.Scope)
+	assert.InDelta(t, time.Minute, lockedErr.RetryAfter, float64(time.Second))
+
+	require.Len(t, sink.events, 4)
+	for _, event := range sink.events[:3] {
+		assert.Equal(t, security.EventLoginFailed, event.Type)
+		assert.Equal(t, userID, event.UserID)
+	}
+	assert.Equal(t, security.EventLoginLockout, sink.events[3].Type)
+	assert.Equal(t, lockout.ScopeAccount, sink.events[3].Details["scope"])
+	assert.Equal(t, "2", sink.events[3].Details["failures"])
+
+	// Неизвестный email блокируется так же, как существующий.
+	for i := 0; i < 2; i++ {
+		_, err = svc.Login(ctx, "unknown@example.com", "wrong", "127.0.0.1")
+		assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	}
+	_, err = svc.Login(ctx, "unknown@example.com", "wrong", "127.0.0.1")
+	assert.ErrorIs(t, err, lockout.ErrLocked)
+}
+
+// Проверка отказа в выдаче и обновлении токенов отключённой учётной записи.
+func TestService_DisabledAccount(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, db.SetPassword(userID, string(hash)))
+	accounts.Set(db, db)
+	t.Cleanup(func() { accounts.Set(nil, nil) })
+
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+	pair, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	require.NoError(t, db.SetUserDisabled(userID, true))
+	_, err = svc.Login(ctx, "test@example.com", "correct horse", "127.0.0.1")
+	assert.ErrorIs(t, err, accounts.ErrDisabled)
+	_, err = svc.IssueTokens(ctx, userID, "127.0.0.1")
+	assert.ErrorIs(t, err, accounts.ErrDisabled)
+	_, err = svc.RefreshTokens(ctx, "", pair.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, accounts.ErrDisabled)
+	// Неверный пароль не раскрывает, что учётная запись отключена.
+	_, err = svc.Login(ctx, "test@example.com", "wrong", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	// После включения сессия снова обновляется.
+	require.NoError(t, db.SetUserDisabled(userID, false))
+	_, err = svc.RefreshTokens(ctx, "", pair.RefreshToken, "127.0.0.1")
+	assert.NoError(t, err)
+}
+
+// Проверка флага истёкшего пароля при входе и ограничения обновления токенов.
+func TestService_PasswordExpiry(t *testing.T) {
+	ctx := context.Background()
+	// Пароль задан 100 дней назад.
+	clk := clock.NewFake(time.Now().Add(-100 * 24 * time.Hour))
+	db := memory.NewMemoryStorage().WithClock(clk)
+	db.CreateUser(userID, "test@example.com")
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, db.SetPassword(userID, string(hash)))
+	clk.Advance(100 * 24 * time.Hour)
+	require.NoError(t, passwordexpiry.Set(db, passwordexpiry.Policy{MaxAge: 90 * 24 * time.Hour, RefreshGrace: 30 * 24 * time.Hour}))
+	t.Cleanup(func() { passwordexpiry.Set(nil, passwordexpiry.Policy{}) })
+
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+	pair, err := svc.Login(ctx, "test@example.com", "correct horse", "127.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, pair.PasswordExpired)
+	pair, err = svc.RefreshTokens(ctx, "", pair.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, pair.PasswordExpired)
+
+	// После отсрочки обновление отклоняется, но сессия сохраняется.
+	require.NoError(t, passwordexpiry.Set(db, passwordexpiry.Policy{MaxAge: 90 * 24 * time.Hour, RefreshGrace: 24 * time.Hour}))
+	_, err = svc.RefreshTokens(ctx, "", pair.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, passwordexpiry.ErrExpired)
+
+	require.NoError(t, db.SetPassword(userID, string(hash)))
+	pair, err = svc.RefreshTokens(ctx, "", pair.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, pair.PasswordExpired)
+}
+
+// Проверка обновления сессии, сохранённой с bcrypt-хешем до перехода на HMAC.
+func TestService_RefreshLegacyBcryptSession(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+
+	refreshToken := "bGVnYWN5LXJlZnJlc2gtdG9rZW4="
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte(refreshToken), bcrypt.MinCost)
+	require.NoError(t, err)
+	_, err = db.SaveRefreshToken(userID, string(legacyHash), "127.0.0.1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	accessToken, err := tokens.GenerateAccessToken(userID, "127.0.0.1", "secret", string(legacyHash), "", 0, nil)
+	require.NoError(t, err)
+
+	refreshed, err := svc.RefreshTokens(ctx, accessToken, refreshToken, "127.0.0.1")
+	require.NoError(t, err)
+
+	// После ротации сессия хранит HMAC-хеш.
+	stored, err := db.GetRefreshToken(userID)
+	require.NoError(t, err)
+	assert.False(t, tokens.IsLegacyHash(stored))
+	assert.Equal(t, tokens.HashRefreshToken(refreshed.RefreshToken, "secret"), stored)
+
+	var out bytes.Buffer
+	metrics.WriteTo(&out)
+	assert.Contains(t, out.String(), `auth_refresh_legacy_hash_lookups_total{result="matched"}`)
+}
+
+// Проверка обновления по одному refresh-токену, без access-токена.
+func TestService_RefreshWithoutAccessToken(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t)
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	issuedClaims, err := svc.ValidateToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+
+	refreshed, err := svc.RefreshTokens(ctx, "", issued.RefreshToken, "")
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(ctx, refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+	assert.Equal(t, issuedClaims.SessionID, claims.SessionID)
+	// Без адреса клиента сохраняется последний адрес сессии.
+	assert.Equal(t, "127.0.0.1", claims.ClientIP)
+
+	// Заменённый refresh-токен больше не принимается.
+	_, err = svc.RefreshTokens(ctx, "", issued.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+	_, err = svc.RefreshTokens(ctx, "", "unknown", "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+
+	// Access-токен, если передан, по-прежнему должен подходить к сессии.
+	other, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.RefreshTokens(ctx, other.AccessToken, refreshed.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+	_, err = svc.RefreshTokens(ctx, "", refreshed.RefreshToken, "127.0.0.1")
+	assert.NoError(t, err)
+}
+
+// Проверка обновления с истёкшим access-токеном: клиент, как правило,
+// обновляет токены, когда access-токен уже истёк.
+func TestService_RefreshWithExpiredAccessToken(t *testing.T) {
+	ctx := context.Background()
+	svc, _, clk := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour})
+	previous := tokens.Clock
+	tokens.Clock = clk
+	t.Cleanup(func() { tokens.Clock = previous })
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	clk.Advance(tokens.AccessTokenTTL() + time.Minute)
+	_, err = svc.ValidateToken(ctx, issued.AccessToken)
+	require.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+
+	refreshed, err := svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(ctx, refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+
+	// Подпись истёкшего токена по-прежнему проверяется.
+	forged, err := tokens.GenerateAccessToken(userID, "127.0.0.1", "other-secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+	clk.Advance(tokens.AccessTokenTTL() + time.Minute)
+	_, err = svc.RefreshTokens(ctx, forged, refreshed.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+}
+
+// Проверка отзыва сессии по refresh-токену без идентификатора пользователя.
+func TestService_RevokeRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t)
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, svc.RevokeRefreshToken(ctx, "unknown"), auth.ErrSessionNotFound)
+	require.NoError(t, svc.RevokeRefreshToken(ctx, issued.RefreshToken))
+
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+}
+
+// Проверка, что отзыв сессии по refresh-токену не затрагивает другие устройства.
+func TestService_RevokeRefreshTokenKeepsOtherSessions(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t)
+
+	phone, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	laptop, err := svc.IssueTokens(ctx, userID, "10.0.0.1")
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RevokeRefreshToken(ctx, phone.RefreshToken))
+	_, err = svc.RefreshTokens(ctx, phone.AccessToken, phone.RefreshToken, "127.0.0.1")
+	assert.Error(t, err)
+	_, err = svc.RefreshTokens(ctx, laptop.AccessToken, laptop.RefreshToken, "127.0.0.1")
+	assert.NoError(t, err)
+
+	// RevokeSession завершает все сессии пользователя.
+	require.NoError(t, svc.RevokeSession(ctx, userID))
+	_, err = svc.RefreshTokens(ctx, laptop.AccessToken, laptop.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+}
+
+// Проверка выхода из сессии по access-токену: другие сессии сохраняются.
+func TestService_Logout(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t).WithStrictValidation(true)
+
+	phone, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	laptop, err := svc.IssueTokens(ctx, userID, "10.0.0.1")
+	require.NoError(t, err)
+
+	require.NoError(t, svc.Logout(ctx, phone.AccessToken))
+	_, err = svc.RefreshTokens(ctx, phone.AccessToken, phone.RefreshToken, "127.0.0.1")
+	assert.Error(t, err)
+	_, err = svc.ValidateToken(ctx, phone.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken, "access tokens of the session are revoked")
+	assert.ErrorIs(t, svc.Logout(ctx, phone.AccessToken), auth.ErrInvalidAccessToken)
+
+	_, err = svc.ValidateToken(ctx, laptop.AccessToken)
+	assert.NoError(t, err)
+	_, err = svc.RefreshTokens(ctx, laptop.AccessToken, laptop.RefreshToken, "127.0.0.1")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, svc.Logout(ctx, "invalid"), auth.ErrInvalidAccessToken)
+}
+
+// Проверка claim sid: access-токен связан со своей сессией.
+func TestService_SessionIDClaim(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t)
+
+	phone, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	laptop, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	phoneClaims, err := svc.ValidateToken(ctx, phone.AccessToken)
+	require.NoError(t, err)
+	laptopClaims, err := svc.ValidateToken(ctx, laptop.AccessToken)
+	require.NoError(t, err)
+	assert.NotEmpty(t, phoneClaims.SessionID)
+	assert.NotEqual(t, phoneClaims.SessionID, laptopClaims.SessionID)
+
+	// Refresh-токен другой сессии не принимается.
+	_, err = svc.RefreshTokens(ctx, phone.AccessToken, laptop.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+
+	// После ротации sid сохраняется.
+	refreshed, err := svc.RefreshTokens(ctx, phone.AccessToken, phone.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	refreshedClaims, err := svc.ValidateToken(ctx, refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, phoneClaims.SessionID, refreshedClaims.SessionID)
+}
+
+// Проверка строгого режима: отозванные токены и токены завершённых сессий отклоняются.
+func TestService_StrictValidation(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t).WithStrictValidation(true)
+
+	phone, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	laptop, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	// Отзыв по jti затрагивает только сам токен.
+	require.NoError(t, svc.RevokeAccessToken(ctx, phone.AccessToken))
+	_, err = svc.ValidateToken(ctx, phone.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+	refreshed, err := svc.RefreshTokens(ctx, phone.AccessToken, phone.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.ValidateToken(ctx, refreshed.AccessToken)
+	assert.NoError(t, err)
+
+	// Отзыв сессии затрагивает все её access-токены.
+	require.NoError(t, svc.RevokeRefreshToken(ctx, refreshed.RefreshToken))
+	_, err = svc.ValidateToken(ctx, refreshed.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+	_, err = svc.ValidateToken(ctx, laptop.AccessToken)
+	assert.NoError(t, err)
+
+	require.NoError(t, svc.RevokeSession(ctx, userID))
+	_, err = svc.ValidateToken(ctx, laptop.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+}
+
+// Проверка выхода со всех устройств: сессии удаляются, а выданные ранее
+// access-токены, в том числе без sid, отклоняются строгой проверкой.
+func TestService_LogoutAll(t *testing.T) {
+	ctx := context.Background()
+	svc := newService(t).WithStrictValidation(true)
+
+	phone, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	legacy, err := tokens.GenerateAccessToken(userID, "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+	_, err = svc.ValidateToken(ctx, legacy)
+	require.NoError(t, err)
+
+	revoked, err := svc.LogoutAll(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, revoked)
+
+	_, err = svc.ValidateToken(ctx, phone.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+	_, err = svc.ValidateToken(ctx, legacy)
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+	_, err = svc.RefreshTokens(ctx, phone.AccessToken, phone.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+
+	// Токены, выданные после выхода, действительны.
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.ValidateToken(ctx, issued.AccessToken)
+	assert.NoError(t, err)
+	refreshed, err := svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.ValidateToken(ctx, refreshed.AccessToken)
+	assert.NoError(t, err)
+
+	// Повторный выход без активных сессий не считается ошибкой.
+	_, err = svc.LogoutAll(ctx, userID)
+	require.NoError(t, err)
+	revoked, err = svc.LogoutAll(ctx, userID)
+	require.NoError(t, err)
+	assert.Zero(t, revoked)
+
+	_, err = svc.LogoutAll(ctx, "not-a-uuid")
+	assert.ErrorIs(t, err, auth.ErrInvalidUserID)
+}
+
+// Проверка сохранения устройства клиента в сессии.
+func TestService_SessionDevice(t *testing.T) {
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+
+	ctx := auth.WithDevice(context.Background(), storage.Device{
+		UserAgent: "  Mozilla/5.0  ",
+		Name:      strings.Repeat("я", 40),
+		Platform:  "iOS",
+	})
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	sessions, err := db.ListSessions(userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "Mozilla/5.0", sessions[0].Device.UserAgent)
+	// Имя обрезается до 64 байт, не разрывая символы.
+	assert.Equal(t, strings.Repeat("я", 32), sessions[0].Device.Name)
+	assert.Equal(t, "ios", sessions[0].Device.Platform)
+
+	// При обновлении несообщённые поля сохраняют прежние значения.
+	ctx = auth.WithDevice(context.Background(), storage.Device{UserAgent: "Mozilla/6.0"})
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	sessions, err = db.ListSessions(userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, storage.Device{UserAgent: "Mozilla/6.0", Name: strings.Repeat("я", 32), Platform: "ios"}, sessions[0].Device)
+}
+
+// Проверка, что список сессий не содержит неактивных дольше IdleTimeout.
+func TestService_ListSessions(t *testing.T) {
+	svc, _, clk := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour, IdleTimeout: time.Hour})
+
+	_, err := svc.IssueTokens(context.Background(), userID, "127.0.0.1")
+	require.NoError(t, err)
+	clk.Advance(2 * time.Hour)
+	issued, err := svc.IssueTokens(context.Background(), userID, "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(context.Background(), issued.AccessToken)
+	require.NoError(t, err)
+
+	sessions, err := svc.ListSessions(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, claims.SessionID, sessions[0].ID)
+}
+
+// Проверка завершения одной сессии пользователя.
+func TestService_RevokeUserSession(t *testing.T) {
+	svc, db, _ := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour})
+	svc.WithStrictValidation(true)
+
+	first, err := svc.IssueTokens(context.Background(), userID, "127.0.0.1")
+	require.NoError(t, err)
+	second, err := svc.IssueTokens(context.Background(), userID, "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(context.Background(), first.AccessToken)
+	require.NoError(t, err)
+
+	err = svc.RevokeUserSession(context.Background(), uuid.NewString(), claims.SessionID)
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound, "another user's session")
+	err = svc.RevokeUserSession(context.Background(), userID, "not-a-uuid")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+
+	require.NoError(t, svc.RevokeUserSession(context.Background(), userID, claims.SessionID))
+	_, err = svc.ValidateToken(context.Background(), first.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken)
+	_, err = svc.ValidateToken(context.Background(), second.AccessToken)
+	assert.NoError(t, err)
+
+	sessions, err := db.ListSessions(userID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+// Проверка, что без строгого режима список отзыва заполняется, но не проверяется.
+func TestService_DenylistWithoutStrictValidation(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RevokeSession(ctx, userID))
+	_, err = svc.ValidateToken(ctx, issued.AccessToken)
+	assert.NoError(t, err)
+
+	denied, err := db.IsAccessTokenDenied("sid:" + claims.SessionID)
+	require.NoError(t, err)
+	assert.True(t, denied)
+}
+
+// Рассылка уведомлений об отзыве, сохраняющая уведомления.
+type recordingPublisher struct {
+	notices []storage.RevocationNotice
+	err     error
+}
+
+func (r *recordingPublisher) PublishRevocation(notice storage.RevocationNotice) error {
+	r.notices = append(r.notices, notice)
+	return r.err
+}
+
+// Проверка рассылки уведомлений при отзыве токенов и сессий.
+func TestService_RevocationNotices(t *testing.T) {
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	svc := newService(t).WithRevocationPublisher(publisher)
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RevokeAccessToken(ctx, issued.AccessToken))
+	require.NoError(t, svc.RevokeRefreshToken(ctx, issued.RefreshToken))
+	require.Len(t, publisher.notices, 2)
+	parsed, err := tokens.ParseAccessToken(issued.AccessToken, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, parsed.ID, publisher.notices[0].TokenID)
+	assert.Empty(t, publisher.notices[0].SessionID)
+	assert.Equal(t, claims.SessionID, publisher.notices[1].SessionID)
+	assert.Empty(t, publisher.notices[1].TokenID)
+	assert.WithinDuration(t, time.Now().Add(tokens.AccessTokenTTL()), publisher.notices[1].ExpiresAt, time.Minute)
+
+	// Ошибка рассылки не мешает выходу: отзыв уже записан в список отзыва.
+	publisher.err = errors.New("redis is down")
+	issued, err = svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, svc.RevokeSession(ctx, userID))
+	assert.Len(t, publisher.notices, 3)
+}
+
+// Проверка вытеснения давно не использовавшихся сессий сверх ограничения.
+func TestService_MaxSessions(t *testing.T) {
+	ctx := context.Background()
+	svc, db, clk := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour, MaxSessions: 2})
+
+	first, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	clk.Advance(time.Minute)
+	second, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	// Первая сессия используется позже второй, поэтому вытесняется вторая.
+	clk.Advance(time.Minute)
+	first, err = svc.RefreshTokens(ctx, first.AccessToken, first.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	clk.Advance(time.Minute)
+	third, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	sessions, err := db.ListSessions(userID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	_, err = svc.RefreshTokens(ctx, second.AccessToken, second.RefreshToken, "127.0.0.1")
+	assert.Error(t, err, "evicted session")
+	_, err = svc.RefreshTokens(ctx, first.AccessToken, first.RefreshToken, "127.0.0.1")
+	assert.NoError(t, err)
+	_, err = svc.RefreshTokens(ctx, third.AccessToken, third.RefreshToken, "127.0.0.1")
+	assert.NoError(t, err)
+}
+
+// Проверка, что refresh-токен другого пользователя не принимается.
+func TestService_RefreshWithForeignToken(t *testing.T) {
+	ctx := context.Background()
+	const otherUserID = "223e4567-e89b-12d3-a456-426614174000"
+
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	db.CreateUser(otherUserID, "other@example.com")
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+
+	mine, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	other, err := svc.IssueTokens(ctx, otherUserID, "127.0.0.1")
+	require.NoError(t, err)
+
+	_, err = svc.RefreshTokens(ctx, mine.AccessToken, other.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+}
+
+// Создаёт сервис с политикой сессий и общими с хранилищем управляемыми часами.
+func newServiceWithPolicy(t *testing.T, policy auth.SessionPolicy) (*auth.Service, *memory.MemoryStorage, *clock.Fake) {
+	t.Helper()
+
+	clk := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	db := memory.NewMemoryStorage().WithClock(clk)
+	db.CreateUser(userID, "test@example.com")
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret").
+		WithSessionPolicy(policy).
+		WithClock(clk)
+	return svc, db, clk
+}
+
+// Возвращает срок действия сессии, которой принадлежит refresh-токен.
+func sessionExpiry(t *testing.T, db *memory.MemoryStorage, refreshToken string) time.Time {
+	t.Helper()
+
+	session, err := db.GetSessionByRefreshHash(tokens.HashRefreshToken(refreshToken, "secret"))
+	require.NoError(t, err)
+	return session.ExpiresAt
+}
+
+// Проверка продления сессии при обновлении токенов (sliding).
+func TestService_SlidingExpiry(t *testing.T) {
+	ctx := context.Background()
+	svc, db, clk := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour, Expiry: auth.ExpirySliding})
+	start := clk.Now()
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(24*time.Hour), sessionExpiry(t, db, issued.RefreshToken))
+
+	clk.Advance(time.Hour)
+	refreshed, err := svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(25*time.Hour), sessionExpiry(t, db, refreshed.RefreshToken))
+}
+
+// Проверка неизменного срока сессии при обновлении токенов (absolute).
+func TestService_AbsoluteExpiry(t *testing.T) {
+	ctx := context.Background()
+	svc, db, clk := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour, Expiry: auth.ExpiryAbsolute})
+	start := clk.Now()
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	clk.Advance(time.Hour)
+	refreshed, err := svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(24*time.Hour), sessionExpiry(t, db, refreshed.RefreshToken))
+}
+
+// Проверка отказа в обновлении после max_session_lifetime.
+func TestService_MaxSessionLifetime(t *testing.T) {
+	ctx := context.Background()
+	svc, db, clk := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour, Expiry: auth.ExpirySliding, MaxLifetime: 36 * time.Hour})
+	start := clk.Now()
+
+	pair, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	// Продление не выходит за пределы максимального времени жизни.
+	clk.Advance(20 * time.Hour)
+	pair, err = svc.RefreshTokens(ctx, pair.AccessToken, pair.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(36*time.Hour), sessionExpiry(t, db, pair.RefreshToken))
+
+	// Сессия, начатая до уменьшения max_session_lifetime, отклоняется и удаляется.
+	strict := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret").
+		WithSessionPolicy(auth.SessionPolicy{TTL: 24 * time.Hour, MaxLifetime: 10 * time.Hour}).
+		WithClock(clk)
+	_, err = strict.RefreshTokens(ctx, pair.AccessToken, pair.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	_, err = db.GetRefreshToken(userID)
+	assert.Error(t, err, "session must be deleted")
+}
+
+// Проверка отказа в обновлении неактивной сессии.
+func TestService_IdleTimeout(t *testing.T) {
+	ctx := context.Background()
+	svc, db, clk := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour, IdleTimeout: 2 * time.Hour})
+
+	pair, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	// Каждое обновление сбрасывает отсчёт неактивности.
+	for i := 0; i < 3; i++ {
+		clk.Advance(90 * time.Minute)
+		pair, err = svc.RefreshTokens(ctx, pair.AccessToken, pair.RefreshToken, "127.0.0.1")
+		require.NoError(t, err)
+	}
+
+	clk.Advance(2 * time.Hour)
+	_, err = svc.RefreshTokens(ctx, pair.AccessToken, pair.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	_, err = db.GetRefreshToken(userID)
+	assert.Error(t, err, "session must be deleted")
+}
+
+// Проверка отказа в обновлении истёкшей сессии, ещё не удалённой очисткой.
+func TestService_ExpiredSession(t *testing.T) {
+	ctx := context.Background()
+	svc, db, clk := newServiceWithPolicy(t, auth.SessionPolicy{TTL: 24 * time.Hour, Expiry: auth.ExpiryAbsolute})
+
+	pair, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	clk.Advance(25 * time.Hour)
+	_, err = svc.RefreshTokens(ctx, pair.AccessToken, pair.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrRefreshTokenExpired)
+
+	// Сессия остаётся в хранилище до очистки.
+	_, err = db.GetSessionByRefreshHash(tokens.HashRefreshToken(pair.RefreshToken, "secret"))
+	assert.ErrorIs(t, err, storage.ErrExpired)
+}
+
+// Проверка разбора политики.
+func TestSessionPolicy_Validate(t *testing.T) {
+	assert.NoError(t, auth.DefaultSessionPolicy.Validate())
+	assert.ErrorIs(t, auth.SessionPolicy{TTL: time.Hour, Expiry: "forever"}.Validate(), auth.ErrInvalidExpiryPolicy)
+	assert.ErrorIs(t, auth.SessionPolicy{Expiry: auth.ExpiryAbsolute}.Validate(), auth.ErrInvalidExpiryPolicy)
+	assert.ErrorIs(t, auth.SessionPolicy{TTL: time.Hour, Expiry: auth.ExpirySliding, MaxSessions: -1}.Validate(), auth.ErrInvalidExpiryPolicy)
+	assert.ErrorIs(t, auth.SessionPolicy{TTL: time.Minute, Expiry: auth.ExpirySliding}.Validate(), auth.ErrInvalidExpiryPolicy)
+	assert.ErrorIs(t, auth.SessionPolicy{TTL: 2 * auth.MaxRefreshTokenTTL, Expiry: auth.ExpirySliding}.Validate(), auth.ErrInvalidExpiryPolicy)
+
+	// Refresh-токен должен жить дольше access-токена.
+	require.NoError(t, tokens.SetAccessTokenTTL(2*time.Hour))
+	t.Cleanup(func() { _ = tokens.SetAccessTokenTTL(tokens.DefaultAccessTokenTTL) })
+	assert.ErrorIs(t, auth.SessionPolicy{TTL: time.Hour, Expiry: auth.ExpirySliding}.Validate(), auth.ErrInvalidExpiryPolicy)
+}
+
+// Проверка сравнения IP-адресов с точностью до сети при обновлении токенов.
+func TestService_IPGranularity(t *testing.T) {
+	ctx := context.Background()
+	var logs bytes.Buffer
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	svc := auth.New(slog.New(slog.NewTextHandler(&logs, nil)), db, "secret").
+		WithIPGranularity(clientip.Granularity{IPv4: 24, IPv6: 64})
+
+	issued, err := svc.IssueTokens(ctx, userID, "203.0.113.7")
+	require.NoError(t, err)
+
+	// Адрес из той же /24 не считается сменой IP.
+	refreshed, err := svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "203.0.113.99")
+	require.NoError(t, err)
+	assert.NotContains(t, logs.String(), "type=ip_change")
+
+	_, err = svc.RefreshTokens(ctx, refreshed.AccessToken, refreshed.RefreshToken, "198.51.100.1")
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "type=ip_change")
+}
+
+// Проверка ограничений доступа по странам при выдаче и обновлении токенов.
+func TestService_GeoRules(t *testing.T) {
+	db, err := geo.Parse(strings.NewReader("203.0.113.0/24,RU\n198.51.100.0/24,KP\n"))
+	require.NoError(t, err)
+	geo.SetDatabase(db)
+	t.Cleanup(func() { geo.SetDatabase(nil) })
+
+	ctx := context.Background()
+	svc := newService(t).WithGeoRules(geo.Rules{Deny: []string{"KP"}})
+
+	_, err = svc.IssueTokens(ctx, userID, "198.51.100.1")
+	assert.ErrorIs(t, err, auth.ErrGeoBlocked)
+
+	issued, err := svc.IssueTokens(ctx, userID, "203.0.113.7")
+	require.NoError(t, err)
+
+	// Обновление из запрещённой страны отклоняется, но сессия сохраняется.
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "198.51.100.1")
+	assert.ErrorIs(t, err, auth.ErrGeoBlocked)
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "203.0.113.7")
+	assert.NoError(t, err)
+}
+
+// Проверка языка предупреждения о смене IP-адреса.
+func TestService_IPChangeWarningLocale(t *testing.T) {
+	ctx := context.Background()
+	var logs bytes.Buffer
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	db.SetUserLocale(userID, "ru-RU")
+	svc := auth.New(slog.New(slog.NewTextHandler(&logs, nil)), db, "secret")
+
+	issued, err := svc.IssueTokens(ctx, userID, "203.0.113.7")
+	require.NoError(t, err)
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "198.51.100.1")
+	require.NoError(t, err)
+
+	assert.Contains(t, logs.String(), "locale=ru")
+	assert.Contains(t, logs.String(), "Вход в аккаунт с нового адреса")
+}
+
+// Проверка хранения хешированных IP-адресов с сохранением обнаружения их смены.
+func TestService_IPPrivacy(t *testing.T) {
+	ctx := context.Background()
+	var logs bytes.Buffer
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	privacy := clientip.Privacy{Mode: clientip.PrivacyHash, Salt: "salt"}
+	svc := auth.New(slog.New(slog.NewTextHandler(&logs, nil)), db, "secret").WithIPPrivacy(privacy)
+
+	issued, err := svc.IssueTokens(ctx, userID, "203.0.113.7")
+	require.NoError(t, err)
+
+	lastIP, err := db.GetLastIP(userID)
+	require.NoError(t, err)
+	assert.Equal(t, privacy.Apply("203.0.113.7"), lastIP)
+	claims, err := svc.ValidateToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, lastIP, claims.ClientIP, "token carries the stored form")
+
+	refreshed, err := svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "203.0.113.7")
+	require.NoError(t, err)
+	assert.NotContains(t, logs.String(), "type=ip_change")
+
+	_, err = svc.RefreshTokens(ctx, refreshed.AccessToken, refreshed.RefreshToken, "198.51.100.1")
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "type=ip_change")
+	assert.NotContains(t, logs.String(), "203.0.113.7")
+	assert.NotContains(t, logs.String(), "198.51.100.1")
+}
+
+// Обработчик событий безопасности, сохраняющий полученные события.
+type recordingSink struct {
+	events []security.Event
+}
+
+func (r *recordingSink) Name() string { return "recording" }
+
+func (r *recordingSink) Handle(ctx context.Context, event security.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+// Обработчик, подписанный на все события, включая жизненный цикл токенов.
+type lifecycleSink struct {
+	recordingSink
+}
+
+func (l *lifecycleSink) Subscribed(eventType string) bool { return true }
+
+// Проверка событий жизненного цикла токенов: выдачи, ротации и отзыва.
+func TestService_TokenEvents(t *testing.T) {
+	ctx := context.Background()
+	sink := &lifecycleSink{}
+	svc := newService(t).WithSecurityEvents(security.NewPipeline(slog.New(slog.NewTextHandler(io.Discard, nil)), sink))
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	refreshed, err := svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, svc.RevokeRefreshToken(ctx, refreshed.RefreshToken))
+	issued, err = svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, svc.Logout(ctx, issued.AccessToken))
+	_, err = svc.LogoutAll(ctx, userID)
+	require.NoError(t, err)
+
+	types := make([]string, 0, len(sink.events))
+	for _, event := range sink.events {
+		types = append(types, event.Type)
+		assert.Equal(t, userID, event.UserID)
+		assert.Equal(t, security.SeverityLow, event.Severity)
+	}
+	assert.Equal(t, []string{
+		security.EventTokenIssued, security.EventTokenRotated, security.EventTokenRevoked,
+		security.EventTokenIssued, security.EventTokenRevoked, security.EventTokenRevoked,
+	}, types)
+	assert.NotEmpty(t, sink.events[0].SessionID)
+	assert.Equal(t, sink.events[0].SessionID, sink.events[1].SessionID)
+	assert.Equal(t, "session", sink.events[2].Details["scope"])
+	assert.Equal(t, sink.events[3].SessionID, sink.events[4].SessionID, "logout revokes the session of the access token")
+	assert.Equal(t, "session", sink.events[4].Details["scope"])
+	assert.Equal(t, "all", sink.events[5].Details["scope"])
+}
+
+// Проверка страны клиента в событиях выдачи и обновления токенов.
+func TestService_TokenEventsCountry(t *testing.T) {
+	db, err := geo.Parse(strings.NewReader("203.0.113.0/24,RU\n"))
+	require.NoError(t, err)
+	geo.SetDatabase(db)
+	t.Cleanup(func() { geo.SetDatabase(nil) })
+
+	ctx := context.Background()
+	sink := &lifecycleSink{}
+	svc := newService(t).
+		WithIPPrivacy(clientip.Privacy{Mode: clientip.PrivacyHash, Salt: "salt"}).
+		WithSecurityEvents(security.NewPipeline(slog.New(slog.NewTextHandler(io.Discard, nil)), sink))
+
+	issued, err := svc.IssueTokens(ctx, userID, "203.0.113.7")
+	require.NoError(t, err)
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "192.0.2.1")
+	require.NoError(t, err)
+
+	require.Len(t, sink.events, 3)
+	assert.Equal(t, map[string]string{"country": "RU"}, sink.events[0].Details, "the country is taken from the original address")
+	assert.Equal(t, security.EventIPChange, sink.events[1].Type)
+	assert.Equal(t, security.EventTokenRotated, sink.events[2].Type)
+	assert.Nil(t, sink.events[2].Details, "unknown country")
+}
+
+// Проверка события отказа в обновлении токенов.
+func TestService_RefreshFailedEvent(t *testing.T) {
+	ctx := context.Background()
+	sink := &lifecycleSink{}
+	svc := newService(t).WithSecurityEvents(security.NewPipeline(slog.New(slog.NewTextHandler(io.Discard, nil)), sink))
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "10.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+
+	require.NotEmpty(t, sink.events)
+	failed := sink.events[len(sink.events)-1]
+	assert.Equal(t, security.EventRefreshFailed, failed.Type)
+	assert.Equal(t, userID, failed.UserID)
+	assert.Equal(t, sink.events[0].SessionID, failed.SessionID)
+	assert.Equal(t, "10.0.0.1", failed.ClientIP)
+	assert.Equal(t, map[string]string{"reason": "invalid_refresh_token"}, failed.Details)
+}
+
+// Проверка события повторного использования ротированного refresh-токена.
+func TestService_RefreshTokenReuseEvent(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sink := &recordingSink{}
+	svc := newService(t).WithSecurityEvents(security.NewPipeline(log, sink))
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Empty(t, sink.events)
+
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "10.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, security.EventRefreshTokenReuse, sink.events[0].Type)
+	assert.Equal(t, security.SeverityHigh, sink.events[0].Severity)
+	assert.Equal(t, userID, sink.events[0].UserID)
+	assert.NotEmpty(t, sink.events[0].SessionID)
+	assert.Equal(t, "10.0.0.1", sink.events[0].ClientIP)
+}
+
+// Проверка outbox: события смены IP-адреса и ротации сохраняются вместе с
+// ротацией и передаются обработчикам только при публикации.
+func TestService_Outbox(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := memory.NewMemoryStorage()
+	db.CreateUser(userID, "test@example.com")
+	sink := &lifecycleSink{}
+	pipeline := security.NewPipeline(log, sink)
+	svc := auth.New(log, db, "secret").WithSecurityEvents(pipeline).WithOutbox(db)
+
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	sink.events = nil
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "198.51.100.1")
+	require.NoError(t, err)
+	assert.Empty(t, sink.events, "events are delivered by the relay")
+
+	due, err := db.DueOutboxEvents(time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.ElementsMatch(t, []string{security.EventIPChange, security.EventTokenRotated}, []string{due[0].Type, due[1].Type})
+
+	sent, err := outbox.NewRelay(log, db, pipeline, outbox.DefaultBackoff).ProcessDue(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	require.Len(t, sink.events, 2)
+	for _, event := range sink.events {
+		assert.NotEmpty(t, event.ID)
+		assert.Equal(t, userID, event.UserID)
+		assert.Equal(t, "198.51.100.1", event.ClientIP)
+	}
+
+	// Если ротация не выполнена, события не сохраняются.
+	_, err = svc.RefreshTokens(ctx, issued.AccessToken, issued.RefreshToken, "203.0.113.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+	due, err = db.DueOutboxEvents(time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+// Проверка автоматического отзыва сессий в ответ на события безопасности.
+func TestService_RiskActions(t *testing.T) {
+	ctx := context.Background()
+
+	// Повторное использование refresh-токена отзывает сессию, другие сессии сохраняются.
+	svc := newService(t).WithRiskActions(security.Actions{security.EventRefreshTokenReuse: security.ActionRevokeSession})
+	phone, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	laptop, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	rotated, err := svc.RefreshTokens(ctx, phone.AccessToken, phone.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+
+	_, err = svc.RefreshTokens(ctx, phone.AccessToken, phone.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken)
+	_, err = svc.RefreshTokens(ctx, rotated.AccessToken, rotated.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrInvalidRefreshToken, "legitimate holder must sign in again")
+	_, err = svc.RefreshTokens(ctx, laptop.AccessToken, laptop.RefreshToken, "127.0.0.1")
+	assert.NoError(t, err)
+
+	// Смена IP-адреса с действием revoke_all отклоняет обновление и завершает все сессии.
+	svc = newService(t).WithRiskActions(security.Actions{security.EventIPChange: security.ActionRevokeAll})
+	phone, err = svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	laptop, err = svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+
+	_, err = svc.RefreshTokens(ctx, phone.AccessToken, phone.RefreshToken, "198.51.100.1")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	_, err = svc.RefreshTokens(ctx, laptop.AccessToken, laptop.RefreshToken, "127.0.0.1")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+}
+
+// Проверка дополнительных claims: от ClaimsProvider и из контекста при выдаче
+// и обновлении токенов.
+func TestService_CustomClaims(t *testing.T) {
+	roles := []string{"user"}
+	svc := newService(t).WithClaimsProvider(auth.ClaimsProviderFunc(func(ctx context.Context, id string) (map[string]any, error) {
+		return map[string]any{"roles": roles, "tenant_id": "acme"}, nil
+	}))
+
+	ctx := auth.WithClaims(context.Background(), map[string]any{"tenant_id": "globex", "plan": "pro"})
+	issued, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	claims, err := svc.ValidateToken(ctx, issued.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, tokens.CustomClaims{Roles: []string{"user"}, TenantID: "globex", Plan: "pro"}, claims.Custom)
+
+	// При обновлении claims запрашиваются заново.
+	roles = []string{"user", "admin"}
+	refreshed, err := svc.RefreshTokens(context.Background(), issued.AccessToken, issued.RefreshToken, "127.0.0.1")
+	require.NoError(t, err)
+	claims, err = svc.ValidateToken(ctx, refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, tokens.CustomClaims{Roles: []string{"user", "admin"}, TenantID: "acme"}, claims.Custom)
+
+	// Зарезервированный claim и ошибка источника прерывают выдачу.
+	_, err = svc.IssueTokens(auth.WithClaims(context.Background(), map[string]any{"sub": "other"}), userID, "127.0.0.1")
+	assert.ErrorIs(t, err, tokens.ErrReservedClaim)
+
+	failure := errors.New("directory unavailable")
+	svc.WithClaimsProvider(auth.ClaimsProviderFunc(func(ctx context.Context, id string) (map[string]any, error) {
+		return nil, failure
+	}))
+	_, err = svc.IssueTokens(context.Background(), userID, "127.0.0.1")
+	assert.ErrorIs(t, err, failure)
+}
+
+type spanRecorder struct {
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(span tracing.SpanData) {
+	r.spans = append(r.spans, span)
+}
+
+// Проверка спанов операций сервиса: вложенность и отметка ошибки.
+func TestService_Tracing(t *testing.T) {
+	recorder := &spanRecorder{}
+	tracing.Set(recorder, 1)
+	t.Cleanup(func() { tracing.Set(nil, 0) })
+	svc := newService(t)
+
+	ctx, root := tracing.Start(context.Background(), tracing.KindServer, "POST /auth/tokens")
+	_, err := svc.IssueTokens(ctx, userID, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = svc.ValidateToken(ctx, "invalid")
+	require.Error(t, err)
+	root.End()
+
+	require.Len(t, recorder.spans, 3)
+	issue, validate := recorder.spans[0], recorder.spans[1]
+	assert.Equal(t, "auth.IssueTokens", issue.Name)
+	assert.Equal(t, root.SpanContext().SpanID, issue.Parent)
+	assert.Empty(t, issue.Error)
+	assert.Equal(t, "auth.ValidateToken", validate.Name)
+	assert.NotEmpty(t, validate.Error)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"auth_service/internal/services/tokens"
+	"context"
+	"maps"
+)
+
+// Источник дополнительных claims access-токена: ролей, разрешений,
+// арендатора и тарифа пользователя (см. tokens.NewCustomClaims).
+type ClaimsProvider interface {
+	// Возвращает дополнительные claims пользователя; nil — без них. Ошибка
+	// прерывает выдачу токенов.
+	Claims(ctx context.Context, userID string) (map[string]any, error)
+}
+
+// Функция, используемая как ClaimsProvider.
+type ClaimsProviderFunc func(ctx context.Context, userID string) (map[string]any, error)
+
+func (f ClaimsProviderFunc) Claims(ctx context.Context, userID string) (map[string]any, error) {
+	return f(ctx, userID)
+}
+
+// Источник дополнительных claims для сервисов, созданных New.
+var claimsProvider ClaimsProvider
+
+// Задаёт источник дополнительных claims для сервисов, создаваемых New.
+// Вызывается при запуске до выдачи первых токенов.
+//
+// Принимает:
+// - p: источник claims; nil — без них.
+func SetClaimsProvider(p ClaimsProvider) {
+	claimsProvider = p
+}
+
+// Устанавливает источник дополнительных claims, запрашиваемых при каждой
+// выдаче и обновлении токенов. По умолчанию — заданный SetClaimsProvider.
+func (s *Service) WithClaimsProvider(p ClaimsProvider) *Service {
+	s.claims = p
+	return s
+}
+
+type claimsKey struct{}
+
+// Добавляет в контекст дополнительные claims access-токена. IssueTokens и
+// RefreshTokens добавляют их к claims из ClaimsProvider, заменяя совпадающие.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - claims: дополнительные claims (см. tokens.NewCustomClaims).
+//
+// Возвращает:
+// - контекст с claims.
+func WithClaims(ctx context.Context, claims map[string]any) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// Собирает дополнительные claims для токена пользователя: от ClaimsProvider
+// и из контекста (см. WithClaims). Claims проверяются сразу, чтобы ошибка в
+// них не оставила сессию без выданных токенов.
+func (s *Service) customClaims(ctx context.Context, userID string) (map[string]any, error) {
+	claims, _ := ctx.Value(claimsKey{}).(map[string]any)
+	if s.claims != nil {
+		provided, err := s.claims.Claims(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(claims) > 0 {
+			provided = maps.Clone(provided)
+			if provided == nil {
+				provided = make(map[string]any, len(claims))
+			}
+			maps.Copy(provided, claims)
+		}
+		claims = provided
+	}
+	if _, err := tokens.NewCustomClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"auth_service/internal/storage"
+	"context"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// Наибольшая длина сохраняемых полей устройства в байтах; более длинные
+// значения обрезаются.
+const (
+	maxUserAgentLength   = 512
+	maxDeviceFieldLength = 64
+)
+
+type deviceKey struct{}
+
+// Добавляет в контекст устройство клиента. IssueTokens и RefreshTokens
+// сохраняют его в сессии, чтобы пользователь и администратор могли понять,
+// какому устройству она принадлежит.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - device: устройство клиента; пустые поля — не сообщены.
+//
+// Возвращает:
+// - контекст с устройством.
+func WithDevice(ctx context.Context, device storage.Device) context.Context {
+	return context.WithValue(ctx, deviceKey{}, device)
+}
+
+// Возвращает устройство клиента из контекста, приведённое к сохраняемому виду.
+func deviceFromContext(ctx context.Context) storage.Device {
+	device, _ := ctx.Value(deviceKey{}).(storage.Device)
+	return storage.Device{
+		UserAgent: clean(device.UserAgent, maxUserAgentLength),
+		Name:      clean(device.Name, maxDeviceFieldLength),
+		Platform:  strings.ToLower(clean(device.Platform, maxDeviceFieldLength)),
+	}
+}
+
+// Удаляет пробелы по краям и некорректные последовательности UTF-8 и
+// обрезает значение до max байт, не разрывая символы.
+func clean(value string, max int) string {
+	value = strings.TrimSpace(strings.ToValidUTF8(value, ""))
+	if len(value) <= max {
+		return value
+	}
+	value = value[:max]
+	for !utf8.ValidString(value) {
+		value = value[:len(value)-1]
+	}
+	return value
+}
+
+// Сохраняет устройство клиента в сессии.
+//
+// Поля, которые клиент не сообщил, сохраняют прежние значения; если
+// устройство не изменилось, хранилище не вызывается. Ошибка хранилища только
+// записывается в лог: токены уже выданы, а устройство — справочные сведения.
+//
+// Принимает:
+// - ctx: контекст запроса с устройством (см. WithDevice).
+// - sessionID: идентификатор сессии.
+// - current: устройство, сохранённое в сессии ранее.
+func (s *Service) saveDevice(ctx context.Context, sessionID string, current storage.Device) {
+	device := deviceFromContext(ctx)
+	if device.UserAgent == "" {
+		device.UserAgent = current.UserAgent
+	}
+	if device.Name == "" {
+		device.Name = current.Name
+	}
+	if device.Platform == "" {
+		device.Platform = current.Platform
+	}
+	if device == current {
+		return
+	}
+	if err := s.db.SetSessionDevice(sessionID, device); err != nil {
+		s.log.Error("Failed to save session device", slog.String("session_id", sessionID), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"auth_service/internal/lockout"
+	"auth_service/internal/passwordexpiry"
+	"auth_service/internal/security"
+	"auth_service/internal/services/tokens"
+	"auth_service/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Email или пароль не подходят.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Хеш, с которым сравнивается пароль, если пользователь не найден: проверка
+// занимает столько же времени, и по задержке ответа нельзя узнать, есть ли
+// пользователь с таким email.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := tokens.HashPassword("dummy password")
+	return hash
+})
+
+// Проверяет email и пароль пользователя и выдаёт новую пару токенов.
+//
+// Неудачные попытки учитываются для email и адреса клиента (см. пакет
+// lockout); о каждой сообщается событием login_failed, о начатой блокировке —
+// событием login_lockout. Пока вход заблокирован, пароль не проверяется.
+// Вход с истёкшим паролем проходит, но отмечается флагом PasswordExpired.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - email: email пользователя.
+// - password: пароль пользователя.
+// - clientIP: IP-адрес клиента.
+//
+// Возвращает:
+// - пару access и refresh токенов и флаг истёкшего пароля.
+// - ErrInvalidCredentials, если пользователя нет, пароль не задан или не совпадает.
+// - *lockout.LockedError, если вход в учётную запись или с адреса клиента заблокирован.
+// - ошибки IssueTokens или хранилища.
+func (s *Service) Login(ctx context.Context, email, password, clientIP string) (pair TokenPair, err error) {
+	ctx, span, s := s.trace(ctx, "auth.Login")
+	defer func() { span.SetError(err); span.End() }()
+
+	storedIP := s.ipPrivacy.Apply(clientIP)
+	if err := lockout.Check(email, storedIP); err != nil {
+		return TokenPair{}, err
+	}
+
+	userID, passwordHash, err := s.db.GetUserCredentials(email)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && passwordHash == "") {
+		_ = tokens.ComparePassword(dummyHash(), password)
+		s.loginFailed(ctx, email, "", storedIP)
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to get user credentials: %w", err)
+	}
+	if err := tokens.ComparePassword(passwordHash, password); err != nil {
+		s.loginFailed(ctx, email, userID, storedIP)
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if err := lockout.RecordSuccess(email); err != nil {
+		s.log.Error("Failed to reset login attempts", slog.String("user_id", userID), slog.String("error", err.Error()))
+	}
+	passwordExpired, err := passwordexpiry.CheckLogin(userID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	pair, err = s.IssueTokens(ctx, userID, clientIP)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	pair.PasswordExpired = passwordExpired
+	return pair, nil
+}
+
+// Учитывает неудачную попытку входа и сообщает о ней и о начатых блокировках.
+// Ошибки хранилища только логируются: вход и так отклоняется.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - email: email из запроса входа.
+// - userID: идентификатор пользователя или пустая строка, если пользователь не найден.
+// - clientIP: сохраняемая форма адреса клиента.
+func (s *Service) loginFailed(ctx context.Context, email, userID, clientIP string) {
+	s.report(ctx, security.Event{
+		Type:     security.EventLoginFailed,
+		Severity: security.SeverityLow,
+		Time:     s.clock.Now(),
+		UserID:   userID,
+		ClientIP: clientIP,
+	})
+
+	locks, err := lockout.RecordFailure(email, clientIP)
+	if err != nil {
+		s.log.Error("Failed to record login failure", slog.String("user_id", userID), slog.String("error", err.Error()))
+	}
+	for _, lock := range locks {
+		s.report(ctx, security.Event{
+			Type:     security.EventLoginLockout,
+			Severity: security.SeverityMedium,
+			Time:     s.clock.Now(),
+			UserID:   userID,
+			ClientIP: clientIP,
+			Details: map[string]string{
+				"scope":        lock.Scope,
+				"failures":     strconv.Itoa(lock.Failures),
+				"locked_until": lock.Until.UTC().Format(time.RFC3339),
+			},
+		})
+	}
+}
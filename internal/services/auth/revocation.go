@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"auth_service/internal/clientip"
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// Хранилище не поддерживает поиск сессий всех пользователей.
+	ErrSessionSearchNotSupported = errors.New("session search is not supported by storage")
+	// Условия массового отзыва некорректны.
+	ErrInvalidRevocationFilter = errors.New("invalid revocation filter")
+)
+
+// Размер порции массового отзыва по умолчанию.
+const DefaultRevocationBatchSize = 500
+
+// Условия массового отзыва сессий. Сессия отзывается, если подходит под все
+// заданные условия; хотя бы одно условие обязательно.
+type RevocationFilter struct {
+	// Владельцы сессий.
+	UserIDs []string
+	// Подсети, в которые входит IP-адрес клиента сессии.
+	Networks []netip.Prefix
+	// Сессии, начатые раньше этого времени.
+	IssuedBefore time.Time
+}
+
+// Проверяет условия отзыва.
+//
+// Возвращает:
+// - ErrInvalidRevocationFilter, если условий нет или идентификатор пользователя не является UUID.
+func (f RevocationFilter) Validate() error {
+	if len(f.UserIDs) == 0 && len(f.Networks) == 0 && f.IssuedBefore.IsZero() {
+		return fmt.Errorf("%w: at least one condition is required", ErrInvalidRevocationFilter)
+	}
+	for _, userID := range f.UserIDs {
+		if _, err := uuid.Parse(userID); err != nil {
+			return fmt.Errorf("%w: invalid user_id %q", ErrInvalidRevocationFilter, userID)
+		}
+	}
+	return nil
+}
+
+// Проверяет, входит ли адрес клиента в одну из подсетей (если они заданы).
+func (f RevocationFilter) matchesIP(clientIP string) bool {
+	if len(f.Networks) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, network := range f.Networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Результат массового отзыва.
+type RevocationResult struct {
+	// Сессии, подошедшие под условия.
+	Matched int64
+	// Отозванные сессии.
+	Revoked int64
+}
+
+// Отзывает все действующие сессии, подходящие под условия, например после
+// утечки секрета или атаки подбором учётных данных.
+//
+// Сессии перебираются порциями по batchSize; каждая сессия удаляется, а её
+// sid заносится в список отзыва access-токенов. При ошибке отзыв
+// прекращается, а уже отозванные сессии остаются отозванными: повторный
+// вызов с теми же условиями отзовёт оставшиеся.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - filter: условия отбора сессий.
+// - batchSize: размер порции; 0 — DefaultRevocationBatchSize.
+//
+// Возвращает:
+// - количество подошедших и отозванных сессий, в том числе при ошибке.
+// - ErrInvalidRevocationFilter, если условия некорректны или подсети нельзя
+// сопоставить с адресами, сохранёнными в виде хеша.
+// - ErrSessionSearchNotSupported, если хранилище не поддерживает поиск сессий.
+// - ошибку хранилища (в том числе storage.ErrUnavailable).
+func (s *Service) RevokeSessions(ctx context.Context, filter RevocationFilter, batchSize int) (RevocationResult, error) {
+	var result RevocationResult
+	if err := filter.Validate(); err != nil {
+		return result, err
+	}
+	if len(filter.Networks) > 0 && s.ipPrivacy.Mode == clientip.PrivacyHash {
+		return result, fmt.Errorf("%w: client IP addresses are stored hashed", ErrInvalidRevocationFilter)
+	}
+	if s.finder == nil {
+		return result, ErrSessionSearchNotSupported
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultRevocationBatchSize
+	}
+
+	query := storage.SessionFilter{UserIDs: filter.UserIDs, CreatedBefore: filter.IssuedBefore}
+	afterID := ""
+	defer func() {
+		s.log.WarnContext(ctx, "Sessions revoked in bulk",
+			slog.Bool("audit", true),
+			slog.Any("user_ids", filter.UserIDs),
+			slog.Any("networks", filter.Networks),
+			slog.Time("issued_before", filter.IssuedBefore),
+			slog.Int64("matched", result.Matched),
+			slog.Int64("revoked", result.Revoked),
+		)
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		sessions, err := s.finder.FindSessions(query, afterID, batchSize)
+		if err != nil {
+			return result, fmt.Errorf("failed to find sessions: %w", err)
+		}
+
+		for _, session := range sessions {
+			if !filter.matchesIP(session.ClientIP) {
+				continue
+			}
+			result.Matched++
+			if err := s.denySession(session.ID); err != nil {
+				return result, err
+			}
+			if err := s.db.DeleteSession(session.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return result, fmt.Errorf("failed to delete session: %w", err)
+			}
+			result.Revoked++
+			endedSessions.Inc(reasonRevoked)
+			s.tokenEvent(ctx, security.EventTokenRevoked, session.UserID, session.ID, session.ClientIP, map[string]string{"scope": "session"})
+		}
+
+		if len(sessions) < batchSize {
+			return result, nil
+		}
+		afterID = sessions[len(sessions)-1].ID
+	}
+}
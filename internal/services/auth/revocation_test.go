@@ -0,0 +1,89 @@
+package auth_test
+
+import (
+	"auth_service/internal/clientip"
+	"auth_service/internal/services/auth"
+	"auth_service/internal/storage/memory"
+	"auth_service/lib/clock"
+	"context"
+	"io"
+	"log/slog"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const otherUserID = "223e4567-e89b-12d3-a456-426614174000"
+
+// Проверка массового отзыва сессий по пользователям, подсетям и времени входа.
+func TestService_RevokeSessions(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))
+	db := memory.NewMemoryStorage().WithClock(clk)
+	db.CreateUser(userID, "test@example.com")
+	db.CreateUser(otherUserID, "other@example.com")
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret").
+		WithClock(clk).
+		WithStrictValidation(true).
+		WithSessionFinder(db)
+
+	attacker, err := svc.IssueTokens(ctx, userID, "203.0.113.7")
+	require.NoError(t, err)
+	_, err = svc.IssueTokens(ctx, otherUserID, "203.0.113.9")
+	require.NoError(t, err)
+	legit, err := svc.IssueTokens(ctx, userID, "198.51.100.1")
+	require.NoError(t, err)
+	clk.Advance(time.Hour)
+	later, err := svc.IssueTokens(ctx, otherUserID, "203.0.113.10")
+	require.NoError(t, err)
+
+	// Сессии из подсети атакующего, начатые до обнаружения атаки.
+	result, err := svc.RevokeSessions(ctx, auth.RevocationFilter{
+		Networks:     []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")},
+		IssuedBefore: clk.Now().Add(-time.Minute),
+	}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RevocationResult{Matched: 2, Revoked: 2}, result)
+
+	_, err = svc.ValidateToken(ctx, attacker.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidAccessToken, "access tokens of revoked sessions must be denied")
+	_, err = svc.RefreshTokens(ctx, attacker.AccessToken, attacker.RefreshToken, "203.0.113.7")
+	assert.Error(t, err)
+
+	_, err = svc.ValidateToken(ctx, legit.AccessToken)
+	assert.NoError(t, err)
+	_, err = svc.ValidateToken(ctx, later.AccessToken)
+	assert.NoError(t, err)
+
+	result, err = svc.RevokeSessions(ctx, auth.RevocationFilter{UserIDs: []string{userID, otherUserID}}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RevocationResult{Matched: 2, Revoked: 2}, result)
+	sessions, err := db.ListSessions(otherUserID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+// Проверка отклонения некорректных условий отзыва.
+func TestService_RevokeSessions_Invalid(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryStorage()
+	svc := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret").WithSessionFinder(db)
+
+	_, err := svc.RevokeSessions(ctx, auth.RevocationFilter{}, 10)
+	assert.ErrorIs(t, err, auth.ErrInvalidRevocationFilter, "an empty filter would revoke every session")
+
+	_, err = svc.RevokeSessions(ctx, auth.RevocationFilter{UserIDs: []string{"not-a-uuid"}}, 10)
+	assert.ErrorIs(t, err, auth.ErrInvalidRevocationFilter)
+
+	networks := auth.RevocationFilter{Networks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	hashed := svc.WithIPPrivacy(clientip.Privacy{Mode: clientip.PrivacyHash, Salt: "salt"})
+	_, err = hashed.RevokeSessions(ctx, networks, 10)
+	assert.ErrorIs(t, err, auth.ErrInvalidRevocationFilter)
+
+	unsupported := auth.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db, "secret")
+	_, err = unsupported.RevokeSessions(ctx, auth.RevocationFilter{UserIDs: []string{userID}}, 10)
+	assert.ErrorIs(t, err, auth.ErrSessionSearchNotSupported)
+}
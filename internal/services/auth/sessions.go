@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// Возвращает действующие сессии пользователя, начиная с последней использованной.
+//
+// Сессии, превысившие MaxLifetime или неактивные дольше IdleTimeout, не
+// возвращаются, хотя ещё могут храниться до очистки или попытки обновления.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - сессии пользователя (пустой список, если их нет).
+// - ошибку хранилища.
+func (s *Service) ListSessions(ctx context.Context, userID string) ([]storage.Session, error) {
+	sessions, err := s.db.ListSessions(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	now := s.clock.Now()
+	active := make([]storage.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if s.policy.endReason(session, now) != "" {
+			continue
+		}
+		active = append(active, session)
+	}
+	return active, nil
+}
+
+// Завершает одну сессию пользователя, например на украденном устройстве;
+// другие сессии сохраняются. Sid сессии заносится в список отзыва
+// access-токенов.
+//
+// Сессия удаляется до занесения в список отзыва, чтобы нельзя было отозвать
+// токены чужой сессии: если запись в список не удалась, refresh-токен сессии
+// уже недействителен, а выданные в ней access-токены действуют до истечения.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - userID: идентификатор пользователя.
+// - sessionID: идентификатор сессии.
+//
+// Возвращает:
+// - ErrSessionNotFound, если у пользователя нет такой сессии.
+// - ошибку хранилища (в том числе storage.ErrUnavailable).
+func (s *Service) RevokeUserSession(ctx context.Context, userID, sessionID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrSessionNotFound
+	}
+	if err := s.db.DeleteUserSession(userID, sessionID); err != nil {
+		return sessionError("failed to revoke session", err)
+	}
+	endedSessions.Inc(reasonRevoked)
+	if err := s.denySession(sessionID); err != nil {
+		return err
+	}
+
+	s.tokenEvent(ctx, security.EventTokenRevoked, userID, sessionID, "", map[string]string{"scope": "session"})
+	s.log.Info("Session revoked", slog.String("user_id", userID), slog.String("session_id", sessionID))
+	return nil
+}
@@ -0,0 +1,103 @@
+package cleanup
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/storage"
+	"context"
+	"log/slog"
+	"time"
+)
+
+var purgedRows = metrics.NewCounterVec(
+	"auth_cleanup_purged_rows_total",
+	"Number of expired or idle rows removed by the cleanup job.",
+	"table",
+)
+
+// Очистка истёкших и неактивных refresh-токенов и истёкших записей списка отзыва access-токенов.
+type Cleanup struct {
+	cleaner     storage.Cleaner
+	log         *slog.Logger
+	batchSize   int
+	idleTimeout time.Duration
+	retention   time.Duration
+}
+
+// Создаёт новый экземпляр Cleanup.
+//
+// Принимает:
+// - cleaner: хранилище, поддерживающее удаление устаревших данных.
+// - log: указатель на logger для логирования событий.
+// - batchSize: количество строк, удаляемых за один запрос.
+//
+// Возвращает:
+// - указатель на Cleanup.
+func New(cleaner storage.Cleaner, log *slog.Logger, batchSize int) *Cleanup {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &Cleanup{cleaner: cleaner, log: log, batchSize: batchSize}
+}
+
+// Включает удаление сессий, не использовавшихся дольше idleTimeout; 0 — отключает.
+func (c *Cleanup) WithIdleTimeout(idleTimeout time.Duration) *Cleanup {
+	c.idleTimeout = idleTimeout
+	return c
+}
+
+// Задаёт время, в течение которого завершённые (истёкшие или неактивные) сессии
+// хранятся перед удалением; 0 — удалять сразу.
+//
+// Такие сессии уже не принимаются при обновлении токенов и остаются в хранилище
+// только для расследования инцидентов.
+func (c *Cleanup) WithRetention(retention time.Duration) *Cleanup {
+	c.retention = retention
+	return c
+}
+
+// Удаляет все истёкшие refresh-токены и записи списка отзыва access-токенов,
+// а при заданном idleTimeout и неактивные refresh-токены пачками по batchSize.
+// Сессии удаляются, когда с момента их завершения прошло время хранения.
+//
+// Принимает:
+// - ctx: контекст, при отмене которого очистка прерывается между пачками.
+//
+// Возвращает:
+// - общее количество удалённых строк.
+// - ошибку, если удаление не удалось.
+func (c *Cleanup) RunOnce(ctx context.Context) (int64, error) {
+	total, err := c.purge(ctx, "tokens", func(limit int) (int64, error) {
+		return c.cleaner.DeleteExpiredRefreshTokens(c.retention, limit)
+	})
+	if err != nil {
+		return total, err
+	}
+
+	denied, err := c.purge(ctx, "access_token_denylist", c.cleaner.DeleteExpiredDeniedAccessTokens)
+	total += denied
+	if err != nil || c.idleTimeout <= 0 {
+		return total, err
+	}
+
+	idle, err := c.purge(ctx, "tokens", func(limit int) (int64, error) {
+		return c.cleaner.DeleteIdleRefreshTokens(c.idleTimeout+c.retention, limit)
+	})
+	return total + idle, err
+}
+
+// Вызывает deleteBatch, пока он удаляет полные пачки, и учитывает удалённые строки таблицы table.
+func (c *Cleanup) purge(ctx context.Context, table string, deleteBatch func(limit int) (int64, error)) (int64, error) {
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := deleteBatch(c.batchSize)
+		total += deleted
+		purgedRows.Add(float64(deleted), table)
+		if err != nil {
+			return total, err
+		}
+		if deleted < int64(c.batchSize) {
+			break
+		}
+	}
+	return total, ctx.Err()
+}
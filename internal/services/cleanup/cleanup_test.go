@@ -0,0 +1,87 @@
+package cleanup_test
+
+import (
+	"auth_service/internal/services/cleanup"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Хранилище-заглушка с заданным количеством истёкших и неактивных токенов.
+type fakeCleaner struct {
+	expired     int64
+	idle        int64
+	denied      int64
+	idleTimeout time.Duration
+	retention   time.Duration
+	calls       int
+}
+
+func (f *fakeCleaner) DeleteExpiredRefreshTokens(retention time.Duration, limit int) (int64, error) {
+	f.calls++
+	f.retention = retention
+	deleted := min(f.expired, int64(limit))
+	f.expired -= deleted
+	return deleted, nil
+}
+
+func (f *fakeCleaner) DeleteIdleRefreshTokens(idleTimeout time.Duration, limit int) (int64, error) {
+	f.calls++
+	f.idleTimeout = idleTimeout
+	deleted := min(f.idle, int64(limit))
+	f.idle -= deleted
+	return deleted, nil
+}
+
+func (f *fakeCleaner) DeleteExpiredDeniedAccessTokens(limit int) (int64, error) {
+	deleted := min(f.denied, int64(limit))
+	f.denied -= deleted
+	return deleted, nil
+}
+
+// Проверка удаления истёкших токенов пачками.
+func TestCleanup_RunOnce(t *testing.T) {
+	cleaner := &fakeCleaner{expired: 25, denied: 3}
+	c := cleanup.New(cleaner, slog.New(slog.NewTextHandler(io.Discard, nil)), 10)
+
+	deleted, err := c.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(28), deleted)
+	assert.Equal(t, 3, cleaner.calls)
+	assert.Zero(t, cleaner.expired)
+	assert.Zero(t, cleaner.denied)
+}
+
+// Проверка удаления неактивных токенов после истёкших.
+func TestCleanup_RunOnceIdle(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cleaner := &fakeCleaner{expired: 5, idle: 12}
+	deleted, err := cleanup.New(cleaner, log, 10).RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), deleted, "idle sessions are kept without idle timeout")
+
+	deleted, err = cleanup.New(cleaner, log, 10).WithIdleTimeout(time.Hour).RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), deleted)
+	assert.Equal(t, time.Hour, cleaner.idleTimeout)
+	assert.Zero(t, cleaner.idle)
+}
+
+// Проверка хранения завершённых сессий перед удалением.
+func TestCleanup_RunOnceRetention(t *testing.T) {
+	cleaner := &fakeCleaner{expired: 2, idle: 3}
+	c := cleanup.New(cleaner, slog.New(slog.NewTextHandler(io.Discard, nil)), 10).
+		WithIdleTimeout(time.Hour).
+		WithRetention(30 * 24 * time.Hour)
+
+	deleted, err := c.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), deleted)
+	assert.Equal(t, 30*24*time.Hour, cleaner.retention)
+	assert.Equal(t, time.Hour+30*24*time.Hour, cleaner.idleTimeout, "idle sessions are kept for the retention period after the timeout")
+}
@@ -0,0 +1,217 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Дополнительный claim совпадает с claim, который задаёт сам сервис.
+var ErrReservedClaim = errors.New("claim is reserved")
+
+// Дополнительный claim имеет неверный тип.
+var ErrInvalidClaim = errors.New("invalid claim value")
+
+// Claims, которые задаёт сам сервис; дополнительные claims их не заменяют.
+var reservedClaims = map[string]bool{
+	"sub": true, "exp": true, "iat": true, "nbf": true, "jti": true, "iss": true, "aud": true,
+	"ip": true, "refresh_hash": true, "sid": true, "ver": true,
+}
+
+// Дополнительные claims access-токена: роли, разрешения, арендатор, тариф и
+// произвольные claims, добавленные вызывающей стороной или ClaimsProvider.
+type CustomClaims struct {
+	// Роли пользователя (roles).
+	Roles []string
+	// Разрешения (scope, через пробел по RFC 8693).
+	Scopes []string
+	// Идентификатор арендатора (tenant_id).
+	TenantID string
+	// Тариф (plan).
+	Plan string
+	// Остальные claims, кроме зарезервированных.
+	Extra map[string]any
+}
+
+// Сообщает, что токен содержит разрешение.
+func (c CustomClaims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Сообщает, что у пользователя есть роль.
+func (c CustomClaims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Разбирает дополнительные claims из map.
+//
+// roles — список строк, scope — строка через пробел или список строк,
+// tenant_id и plan — строки; остальные claims переносятся в Extra как есть и
+// должны сериализоваться в JSON.
+//
+// Принимает:
+// - claims: дополнительные claims; nil — без них.
+//
+// Возвращает:
+// - дополнительные claims.
+// - ErrReservedClaim, если claim зарезервирован сервисом.
+// - ErrInvalidClaim, если у claim неверный тип.
+func NewCustomClaims(claims map[string]any) (CustomClaims, error) {
+	var c CustomClaims
+	for name, value := range claims {
+		if reservedClaims[name] {
+			return CustomClaims{}, fmt.Errorf("%w: %s", ErrReservedClaim, name)
+		}
+		var ok bool
+		switch name {
+		case "roles":
+			c.Roles, ok = stringList(value)
+		case "scope":
+			if scope, isString := value.(string); isString {
+				c.Scopes, ok = strings.Fields(scope), true
+			} else {
+				c.Scopes, ok = stringList(value)
+			}
+		case "tenant_id":
+			c.TenantID, ok = value.(string)
+		case "plan":
+			c.Plan, ok = value.(string)
+		default:
+			if c.Extra == nil {
+				c.Extra = make(map[string]any)
+			}
+			c.Extra[name], ok = value, true
+		}
+		if !ok {
+			return CustomClaims{}, fmt.Errorf("%w: %s has type %T", ErrInvalidClaim, name, value)
+		}
+	}
+	return c, nil
+}
+
+// Разбирает claim scope; nil, если claim пуст.
+func scopes(scope string) []string {
+	if scope == "" {
+		return nil
+	}
+	return strings.Fields(scope)
+}
+
+func stringList(value any) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, s)
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// Сериализует claims токена вместе с дополнительными claims из Extra.
+func (c *accessClaims) MarshalJSON() ([]byte, error) {
+	type plain accessClaims
+	data, err := json.Marshal((*plain)(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+	extra, err := json.Marshal(c.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidClaim, err)
+	}
+	// Ключи Extra не пересекаются с полями структуры (см. NewCustomClaims),
+	// поэтому объекты можно склеить: {…поля…,…extra…}.
+	data = append(data[:len(data)-1], ',')
+	return append(data, extra[1:]...), nil
+}
+
+// Разбирает claims токена; claims, не известные структуре, попадают в Extra.
+func (c *accessClaims) UnmarshalJSON(data []byte) error {
+	type plain accessClaims
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	if !hasExtraClaims(data) {
+		return nil
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for name, raw := range all {
+		if reservedClaims[name] || knownCustomClaims[name] {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if c.Extra == nil {
+			c.Extra = make(map[string]any)
+		}
+		c.Extra[name] = value
+	}
+	return nil
+}
+
+// Дополнительные claims, для которых в accessClaims есть поля.
+var knownCustomClaims = map[string]bool{"roles": true, "scope": true, "tenant_id": true, "plan": true}
+
+// Сообщает, что в объекте JSON есть ключи верхнего уровня, для которых в
+// accessClaims нет полей. Просмотр без выделений памяти избавляет от разбора
+// payload в map для токенов без таких claims, то есть почти для всех.
+// Ключи с escape-последовательностями считаются неизвестными.
+func hasExtraClaims(data []byte) bool {
+	depth := 0
+	expectKey := false
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '{', '[':
+			depth++
+			expectKey = depth == 1
+		case '}', ']':
+			depth--
+		case ',':
+			expectKey = depth == 1
+		case '"':
+			end := i + 1
+			for end < len(data) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end > len(data) {
+				end = len(data)
+			}
+			if expectKey {
+				key := data[i+1 : end]
+				if bytes.IndexByte(key, '\\') >= 0 || !(reservedClaims[string(key)] || knownCustomClaims[string(key)]) {
+					return true
+				}
+				expectKey = false
+			}
+			i = end
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package tokens_test
+
+import (
+	"auth_service/internal/services/tokens"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка, что дополнительные claims сохраняются в токене и возвращаются
+// в типизированном виде.
+func TestCustomClaims(t *testing.T) {
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "session", 0, map[string]any{
+		"roles":     []string{"admin", "billing"},
+		"scope":     "read write",
+		"tenant_id": "acme",
+		"plan":      "pro",
+		"org":       map[string]any{"id": "42"},
+		"features":  []any{"sso"},
+	})
+	require.NoError(t, err)
+
+	claims, err := tokens.ValidateAccessToken(accessToken, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+	assert.Equal(t, "session", claims.SessionID)
+	assert.Equal(t, tokens.CustomClaims{
+		Roles:    []string{"admin", "billing"},
+		Scopes:   []string{"read", "write"},
+		TenantID: "acme",
+		Plan:     "pro",
+		Extra:    map[string]any{"org": map[string]any{"id": "42"}, "features": []any{"sso"}},
+	}, claims.Custom)
+	assert.True(t, claims.Custom.HasRole("admin"))
+	assert.True(t, claims.Custom.HasScope("write"))
+	assert.False(t, claims.Custom.HasScope("delete"))
+
+	// Без дополнительных claims структура пуста.
+	accessToken, err = tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+	claims, err = tokens.ValidateAccessToken(accessToken, "secret")
+	require.NoError(t, err)
+	assert.Zero(t, claims.Custom)
+}
+
+// Проверка отказа для зарезервированных claims и claims неверного типа.
+func TestCustomClaims_Invalid(t *testing.T) {
+	for _, name := range []string{"sub", "exp", "ip", "refresh_hash", "sid", "ver"} {
+		_, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, map[string]any{name: "x"})
+		assert.ErrorIs(t, err, tokens.ErrReservedClaim, name)
+	}
+
+	for name, value := range map[string]any{
+		"roles":     "admin",
+		"scope":     42,
+		"tenant_id": 1,
+		"plan":      []string{"pro"},
+		"org":       func() {},
+	} {
+		_, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, map[string]any{name: value})
+		assert.ErrorIs(t, err, tokens.ErrInvalidClaim, name)
+	}
+}
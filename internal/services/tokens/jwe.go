@@ -0,0 +1,146 @@
+package tokens
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Размер ключа шифрования access-токенов (A256GCM).
+const EncryptionKeySize = 32
+
+// Защищённый заголовок JWE: прямое шифрование общим ключом (dir) алгоритмом
+// A256GCM, полезная нагрузка — подписанный JWT (вложенный токен).
+var jweHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"dir","enc":"A256GCM","cty":"JWT"}`))
+
+// AEAD для шифрования access-токенов; nil — токены выпускаются без шифрования.
+var encryption cipher.AEAD
+
+// Включает шифрование access-токенов (JWE, alg dir, enc A256GCM).
+//
+// Подписанный JWT шифруется целиком, поэтому его claims не может прочитать ни
+// клиент, ни промежуточные узлы. ValidateAccessToken при этом расшифровывает
+// токен прозрачно. Вызывается при запуске до выпуска первых токенов.
+//
+// Принимает:
+// - key: ключ длиной EncryptionKeySize байт; nil отключает шифрование.
+//
+// Возвращает:
+// - ошибку, если ключ имеет неверную длину.
+func SetEncryptionKey(key []byte) error {
+	if key == nil {
+		encryption = nil
+		return nil
+	}
+	if len(key) != EncryptionKeySize {
+		return fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create GCM: %w", err)
+	}
+	encryption = aead
+	return nil
+}
+
+// Декодирует ключ шифрования из base64 (стандартный или URL-алфавит).
+//
+// Принимает:
+// - encoded: ключ в base64.
+//
+// Возвращает:
+// - ключ.
+// - ошибку, если строка не является base64.
+func ParseEncryptionKey(encoded string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := encoding.DecodeString(encoded); err == nil {
+			return key, nil
+		}
+	}
+	return nil, errors.New("encryption key is not valid base64")
+}
+
+// Шифрует подписанный JWT в компактную сериализацию JWE.
+//
+// Принимает:
+// - signed: подписанный JWT.
+//
+// Возвращает:
+// - JWE из пяти частей (ключ пустой для alg dir).
+// - ошибку, если не удалось получить случайный IV.
+func encryptToken(signed string) (string, error) {
+	iv := make([]byte, encryption.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("failed to generate IV: %w", err)
+	}
+
+	sealed := encryption.Seal(nil, iv, []byte(signed), []byte(jweHeader))
+	tagStart := len(sealed) - encryption.Overhead()
+	ciphertext, tag := sealed[:tagStart], sealed[tagStart:]
+
+	encode := base64.RawURLEncoding.EncodeToString
+	return jweHeader + ".." + encode(iv) + "." + encode(ciphertext) + "." + encode(tag), nil
+}
+
+// Сообщает, что токен является JWE (пять частей вместо трёх у JWS).
+func isEncrypted(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// Расшифровывает JWE, выпущенный encryptToken.
+//
+// Принимает:
+// - token: JWE в компактной сериализации.
+//
+// Возвращает:
+// - вложенный подписанный JWT.
+// - ошибку, если шифрование не настроено, заголовок не поддерживается или токен повреждён.
+func decryptToken(token string) (string, error) {
+	if encryption == nil {
+		return "", errors.New("encrypted token received but encryption is not configured")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		return "", errors.New("malformed JWE")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Enc string `json:"enc"`
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(rawHeader, &header) != nil {
+		return "", errors.New("malformed JWE header")
+	}
+	if header.Alg != "dir" || header.Enc != "A256GCM" {
+		return "", fmt.Errorf("unsupported JWE algorithm %s/%s", header.Alg, header.Enc)
+	}
+
+	var decoded [3][]byte
+	for i, part := range parts[2:] {
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return "", errors.New("malformed JWE")
+		}
+	}
+	iv, ciphertext, tag := decoded[0], decoded[1], decoded[2]
+	if len(iv) != encryption.NonceSize() || len(tag) != encryption.Overhead() {
+		return "", errors.New("malformed JWE")
+	}
+
+	plaintext, err := encryption.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return "", errors.New("failed to decrypt token")
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,86 @@
+package tokens_test
+
+import (
+	"auth_service/internal/services/tokens"
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Включает шифрование access-токенов на время теста.
+func useEncryptionKey(t *testing.T, key []byte) {
+	require.NoError(t, tokens.SetEncryptionKey(key))
+	t.Cleanup(func() { _ = tokens.SetEncryptionKey(nil) })
+}
+
+// Проверка выпуска и прозрачной проверки зашифрованного токена.
+func TestEncryptedAccessToken(t *testing.T) {
+	useEncryptionKey(t, bytes.Repeat([]byte{1}, tokens.EncryptionKeySize))
+
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+
+	parts := strings.Split(accessToken, ".")
+	require.Len(t, parts, 5, "JWE compact serialization")
+	assert.Empty(t, parts[1], "dir has no encrypted key")
+
+	claims, err := tokens.ValidateAccessToken(accessToken, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+	assert.Equal(t, "127.0.0.1", claims.ClientIP)
+	assert.Equal(t, "hash", claims.RefreshHash)
+
+	// Подпись вложенного JWT по-прежнему проверяется.
+	_, err = tokens.ValidateAccessToken(accessToken, "other-secret")
+	assert.Error(t, err)
+}
+
+// Проверка отказа для изменённого токена и токена, зашифрованного другим ключом.
+func TestEncryptedAccessToken_Tampered(t *testing.T) {
+	useEncryptionKey(t, bytes.Repeat([]byte{1}, tokens.EncryptionKeySize))
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+
+	parts := strings.Split(accessToken, ".")
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[3])
+	require.NoError(t, err)
+	ciphertext[0] ^= 0xff
+	parts[3] = base64.RawURLEncoding.EncodeToString(ciphertext)
+	_, err = tokens.ValidateAccessToken(strings.Join(parts, "."), "secret")
+	assert.Error(t, err, "modified ciphertext")
+
+	require.NoError(t, tokens.SetEncryptionKey(bytes.Repeat([]byte{2}, tokens.EncryptionKeySize)))
+	_, err = tokens.ValidateAccessToken(accessToken, "secret")
+	assert.Error(t, err, "different key")
+
+	require.NoError(t, tokens.SetEncryptionKey(nil))
+	_, err = tokens.ValidateAccessToken(accessToken, "secret")
+	assert.Error(t, err, "encryption disabled")
+}
+
+// Проверка, что при включённом шифровании принимаются ранее выданные подписанные токены.
+func TestEncryptedAccessToken_AcceptsSigned(t *testing.T) {
+	signed, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+
+	useEncryptionKey(t, bytes.Repeat([]byte{1}, tokens.EncryptionKeySize))
+	claims, err := tokens.ValidateAccessToken(signed, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+}
+
+// Проверка разбора и длины ключа шифрования.
+func TestSetEncryptionKey(t *testing.T) {
+	assert.Error(t, tokens.SetEncryptionKey([]byte("short")))
+
+	key, err := tokens.ParseEncryptionKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xfb}, tokens.EncryptionKeySize)))
+	require.NoError(t, err)
+	assert.Len(t, key, tokens.EncryptionKeySize)
+
+	_, err = tokens.ParseEncryptionKey("not base64!")
+	assert.Error(t, err)
+}
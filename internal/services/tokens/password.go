@@ -0,0 +1,226 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Алгоритмы хеширования паролей и секретов клиентов.
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+// Пароль не соответствует хешу.
+var ErrPasswordMismatch = errors.New("password does not match hash")
+
+// Формат хеша не распознан ни одним алгоритмом.
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Алгоритм хеширования паролей и секретов клиентов.
+//
+// Хеш хранит алгоритм и параметры, с которыми создан, поэтому ComparePassword
+// проверяет хеши любого поддерживаемого алгоритма независимо от того, какой
+// алгоритм выбран для новых хешей.
+type PasswordHasher interface {
+	// Хеширует пароль.
+	Hash(password string) (string, error)
+	// Сообщает, что хеш создан этим алгоритмом.
+	Recognizes(hash string) bool
+	// Сверяет пароль с хешем; ErrPasswordMismatch, если не совпадает.
+	Compare(hash, password string) error
+}
+
+// Алгоритм новых хешей; проверка хешей не зависит от него.
+var passwordHasher PasswordHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+
+// Алгоритмы, хеши которых распознаёт ComparePassword.
+var passwordHashers = []PasswordHasher{BcryptHasher{}, Argon2idHasher{}}
+
+// Задаёт алгоритм и параметры новых хешей паролей и секретов клиентов.
+// Вызывается при запуске до хеширования первых паролей; уже сохранённые хеши
+// проверяются с алгоритмом и параметрами, с которыми были созданы.
+//
+// Принимает:
+// - h: алгоритм хеширования (NewBcryptHasher, NewArgon2idHasher).
+func SetPasswordHasher(h PasswordHasher) {
+	passwordHasher = h
+}
+
+// Хеширует пароль или секрет клиента алгоритмом, заданным SetPasswordHasher,
+// с основным ключом перца, если он задан SetPepper.
+//
+// Принимает:
+// - password: пароль или секрет.
+//
+// Возвращает:
+// - хеш со встроенными алгоритмом и параметрами.
+// - ошибку, если пароль не удалось захешировать.
+func HashPassword(password string) (string, error) {
+	return hashWithPepper(passwordHasher, password)
+}
+
+// Сверяет пароль с хешем bcrypt или argon2id, в том числе созданным с перцем.
+//
+// Принимает:
+// - hash: сохранённый хеш.
+// - password: пароль или секрет.
+//
+// Возвращает:
+// - ErrPasswordMismatch, если пароль не совпадает.
+// - ErrUnknownHashFormat, если алгоритм хеша не распознан.
+// - ErrUnknownPepper, если ключа перца, с которым создан хеш, нет в наборе.
+func ComparePassword(hash, password string) error {
+	hash, password, err := unwrapPepper(hash, password)
+	if err != nil {
+		return err
+	}
+	for _, h := range passwordHashers {
+		if h.Recognizes(hash) {
+			return h.Compare(hash, password)
+		}
+	}
+	return ErrUnknownHashFormat
+}
+
+// Хеширование bcrypt.
+type BcryptHasher struct {
+	// Стоимость: каждая единица вдвое увеличивает время хеширования и проверки.
+	Cost int
+}
+
+// Создаёт алгоритм bcrypt.
+//
+// Принимает:
+// - cost: стоимость от bcrypt.MinCost до bcrypt.MaxCost.
+//
+// Возвращает:
+// - алгоритм.
+// - ошибку, если стоимость вне допустимых границ.
+func NewBcryptHasher(cost int) (BcryptHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return BcryptHasher{}, fmt.Errorf("bcrypt cost %d is outside the range %d..%d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return BcryptHasher{Cost: cost}, nil
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (BcryptHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2")
+}
+
+func (BcryptHasher) Compare(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+// Размеры соли и хеша argon2id в байтах.
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Префикс хеша argon2id в формате PHC.
+const argon2idPrefix = "$argon2id$"
+
+// Верхняя граница памяти argon2id (1 ГиБ): большие значения скорее ошибка
+// конфигурации, чем осознанный выбор, и исчерпают память при нескольких
+// одновременных входах.
+const MaxArgon2Memory = 1 << 20
+
+// Хеширование argon2id (RFC 9106). Хеш хранится в формате PHC:
+// $argon2id$v=19$m=<память>,t=<итерации>,p=<потоки>$<соль>$<хеш>.
+type Argon2idHasher struct {
+	// Память в КиБ.
+	Memory uint32
+	// Число проходов по памяти.
+	Iterations uint32
+	// Число потоков.
+	Parallelism uint8
+}
+
+// Создаёт алгоритм argon2id.
+//
+// Принимает:
+// - memory: память в КиБ, от 8·parallelism до MaxArgon2Memory.
+// - iterations: число проходов, не меньше 1.
+// - parallelism: число потоков, не меньше 1.
+//
+// Возвращает:
+// - алгоритм.
+// - ошибку, если параметры вне допустимых границ.
+func NewArgon2idHasher(memory, iterations uint32, parallelism uint8) (Argon2idHasher, error) {
+	switch {
+	case parallelism < 1:
+		return Argon2idHasher{}, errors.New("argon2id parallelism must be at least 1")
+	case iterations < 1:
+		return Argon2idHasher{}, errors.New("argon2id iterations must be at least 1")
+	case memory < 8*uint32(parallelism) || memory > MaxArgon2Memory:
+		return Argon2idHasher{}, fmt.Errorf("argon2id memory %d KiB is outside the range %d..%d", memory, 8*uint32(parallelism), MaxArgon2Memory)
+	}
+	return Argon2idHasher{Memory: memory, Iterations: iterations, Parallelism: parallelism}, nil
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (Argon2idHasher) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func (Argon2idHasher) Compare(hash, password string) error {
+	// "", "argon2id", "v=19", "m=…,t=…,p=…", соль, хеш.
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return fmt.Errorf("%w: unsupported argon2 version", ErrUnknownHashFormat)
+	}
+	var h Argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.Memory, &h.Iterations, &h.Parallelism); err != nil {
+		return fmt.Errorf("%w: invalid argon2id parameters", ErrUnknownHashFormat)
+	}
+	if _, err := NewArgon2idHasher(h.Memory, h.Iterations, h.Parallelism); err != nil {
+		return fmt.Errorf("%w: %s", ErrUnknownHashFormat, err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return fmt.Errorf("%w: invalid argon2id salt", ErrUnknownHashFormat)
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expected) == 0 {
+		return fmt.Errorf("%w: invalid argon2id hash", ErrUnknownHashFormat)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, uint32(len(expected)))
+	if subtle.ConstantTimeCompare(key, expected) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package tokens_test
+
+import (
+	"auth_service/internal/services/tokens"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Включает алгоритм хеширования паролей на время теста.
+func usePasswordHasher(t *testing.T, h tokens.PasswordHasher) {
+	t.Helper()
+
+	tokens.SetPasswordHasher(h)
+	t.Cleanup(func() { tokens.SetPasswordHasher(tokens.BcryptHasher{Cost: bcrypt.DefaultCost}) })
+}
+
+// Проверка хеширования обоими алгоритмами и проверки хешей независимо от
+// алгоритма, выбранного для новых хешей.
+func TestPasswordHashers(t *testing.T) {
+	bcryptHasher, err := tokens.NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	argon2idHasher, err := tokens.NewArgon2idHasher(1024, 1, 1)
+	require.NoError(t, err)
+
+	usePasswordHasher(t, bcryptHasher)
+	bcryptHash, err := tokens.HashPassword("password")
+	require.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(bcryptHash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost, cost)
+
+	usePasswordHasher(t, argon2idHasher)
+	argon2idHash, err := tokens.HashPassword("password")
+	require.NoError(t, err)
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=1024,t=1,p=1\$[A-Za-z0-9+/]+\$[A-Za-z0-9+/]+$`, argon2idHash)
+
+	other, err := tokens.HashPassword("password")
+	require.NoError(t, err)
+	assert.NotEqual(t, argon2idHash, other, "salt is random")
+
+	for _, hash := range []string{bcryptHash, argon2idHash} {
+		assert.NoError(t, tokens.ComparePassword(hash, "password"), hash)
+		assert.ErrorIs(t, tokens.ComparePassword(hash, "wrong"), tokens.ErrPasswordMismatch, hash)
+		assert.True(t, tokens.IsLegacyHash(hash), hash)
+	}
+
+	assert.ErrorIs(t, tokens.ComparePassword("plain", "plain"), tokens.ErrUnknownHashFormat)
+	assert.ErrorIs(t, tokens.ComparePassword("$argon2id$v=19$m=1024,t=1$salt$hash", "password"), tokens.ErrUnknownHashFormat)
+	assert.ErrorIs(t, tokens.ComparePassword("$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$aGFzaA", "password"), tokens.ErrUnknownHashFormat)
+}
+
+// Проверка отказа от параметров вне допустимых границ.
+func TestPasswordHashers_Invalid(t *testing.T) {
+	_, err := tokens.NewBcryptHasher(bcrypt.MaxCost + 1)
+	assert.Error(t, err)
+
+	for _, params := range []struct {
+		memory, iterations uint32
+		parallelism        uint8
+	}{
+		{memory: 64 * 1024, iterations: 0, parallelism: 1},
+		{memory: 64 * 1024, iterations: 1, parallelism: 0},
+		{memory: 8, iterations: 1, parallelism: 2},
+		{memory: tokens.MaxArgon2Memory + 1, iterations: 1, parallelism: 1},
+	} {
+		_, err := tokens.NewArgon2idHasher(params.memory, params.iterations, params.parallelism)
+		assert.Error(t, err, params)
+	}
+}
+
+// Проверка, что refresh-токены, сохранённые с хешем argon2id, принимаются.
+func TestCompareRefreshToken_Argon2id(t *testing.T) {
+	h, err := tokens.NewArgon2idHasher(1024, 1, 1)
+	require.NoError(t, err)
+	hash, err := h.Hash("refresh")
+	require.NoError(t, err)
+
+	assert.NoError(t, tokens.CompareRefreshToken(hash, "refresh", "secret"))
+	assert.ErrorIs(t, tokens.CompareRefreshToken(hash, "other", "secret"), tokens.ErrRefreshTokenMismatch)
+}
+
+// Показывает, как параметры алгоритма влияют на время хеширования пароля и
+// его проверки при входе: для bcrypt каждая единица стоимости удваивает оба,
+// для argon2id время растёт линейно с памятью и числом проходов.
+func BenchmarkHashPassword(b *testing.B) {
+	var hashers []tokens.PasswordHasher
+	for cost := 10; cost <= 14; cost++ {
+		hashers = append(hashers, tokens.BcryptHasher{Cost: cost})
+	}
+	hashers = append(hashers,
+		tokens.Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 1},
+		tokens.Argon2idHasher{Memory: 64 * 1024, Iterations: 3, Parallelism: 2},
+		tokens.Argon2idHasher{Memory: 256 * 1024, Iterations: 3, Parallelism: 4},
+	)
+
+	for _, h := range hashers {
+		var name string
+		switch h := h.(type) {
+		case tokens.BcryptHasher:
+			name = fmt.Sprintf("bcrypt/cost=%d", h.Cost)
+		case tokens.Argon2idHasher:
+			name = fmt.Sprintf("argon2id/m=%d,t=%d,p=%d", h.Memory, h.Iterations, h.Parallelism)
+		}
+		hash, err := h.Hash("correct horse battery staple")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name+"/hash", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := h.Hash("correct horse battery staple"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(name+"/compare", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := tokens.ComparePassword(hash, "correct horse battery staple"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Хеш создан с перцем, ключа которого нет в наборе.
+var ErrUnknownPepper = errors.New("unknown password pepper")
+
+// Наименьшая длина ключа перца в байтах.
+const MinPepperLength = 32
+
+// Префикс хеша с перцем: $pepper$<идентификатор ключа>$<хеш bcrypt или argon2id>.
+const pepperPrefix = "$pepper$"
+
+// Допустимые идентификаторы ключей перца: идентификатор хранится в хеше до
+// разделителя "$".
+var pepperIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Набор ключей перца — секрета сервера, который подмешивается к паролю перед
+// хешированием. Без перца хеши из утёкшей базы нельзя перебирать офлайн.
+//
+// Новые хеши создаются основным ключом, а его идентификатор сохраняется в
+// хеше, поэтому после ротации хеши прежних ключей проверяются, пока ключи
+// остаются в наборе.
+type Pepper struct {
+	keys    map[string][]byte
+	primary string
+}
+
+// Создаёт набор ключей перца.
+//
+// Принимает:
+// - keys: ключи по идентификаторам, не короче MinPepperLength байт.
+// - primary: идентификатор ключа для новых хешей.
+//
+// Возвращает:
+// - указатель на Pepper.
+// - ошибку, если основной ключ не задан, идентификатор недопустим или ключ короткий.
+func NewPepper(keys map[string][]byte, primary string) (*Pepper, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary pepper key %q is not configured", primary)
+	}
+	p := &Pepper{keys: make(map[string][]byte, len(keys)), primary: primary}
+	for id, key := range keys {
+		if !pepperIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("pepper key id %q must contain only letters, digits, '-' and '_'", id)
+		}
+		if len(key) < MinPepperLength {
+			return nil, fmt.Errorf("pepper key %s must be at least %d bytes, got %d", id, MinPepperLength, len(key))
+		}
+		p.keys[id] = key
+	}
+	return p, nil
+}
+
+// Декодирует ключи из base64 и создаёт набор (см. NewPepper).
+//
+// Принимает:
+// - encoded: ключи в base64 (стандартный или URL-алфавит) по идентификаторам.
+// - primary: идентификатор основного ключа.
+//
+// Возвращает:
+// - указатель на Pepper.
+// - ошибку, если ключ не является base64 или набор некорректен.
+func ParsePepper(encoded map[string]string, primary string) (*Pepper, error) {
+	keys := make(map[string][]byte, len(encoded))
+	for id, value := range encoded {
+		value = strings.TrimSpace(value)
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			if key, err = base64.URLEncoding.DecodeString(value); err != nil {
+				return nil, fmt.Errorf("pepper key %s is not valid base64", id)
+			}
+		}
+		keys[id] = key
+	}
+	return NewPepper(keys, primary)
+}
+
+// Подмешивает ключ к паролю: HMAC-SHA256 в base64 (43 символа) укладывается
+// в ограничение bcrypt на 72 байта при любой длине пароля.
+func (p *Pepper) apply(id, password string) (string, bool) {
+	key, ok := p.keys[id]
+	if !ok {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)), true
+}
+
+var (
+	pepperMu sync.RWMutex
+	pepper   *Pepper
+)
+
+// Задаёт перец для хеширования паролей и секретов клиентов. Вызывается при
+// запуске до хеширования первых паролей; хеши без перца по-прежнему
+// проверяются.
+//
+// Принимает:
+// - p: набор ключей; nil — новые хеши создаются без перца.
+func SetPepper(p *Pepper) {
+	pepperMu.Lock()
+	defer pepperMu.Unlock()
+	pepper = p
+}
+
+func currentPepper() *Pepper {
+	pepperMu.RLock()
+	defer pepperMu.RUnlock()
+	return pepper
+}
+
+// Хеширует пароль с основным ключом перца, если перец задан.
+func hashWithPepper(h PasswordHasher, password string) (string, error) {
+	p := currentPepper()
+	if p == nil {
+		return h.Hash(password)
+	}
+	peppered, _ := p.apply(p.primary, password)
+	hash, err := h.Hash(peppered)
+	if err != nil {
+		return "", err
+	}
+	return pepperPrefix + p.primary + "$" + hash, nil
+}
+
+// Отделяет от хеша с перцем идентификатор ключа и подмешивает ключ к паролю.
+// Хеши без перца возвращаются без изменений.
+func unwrapPepper(hash, password string) (string, string, error) {
+	rest, ok := strings.CutPrefix(hash, pepperPrefix)
+	if !ok {
+		return hash, password, nil
+	}
+	id, inner, ok := strings.Cut(rest, "$")
+	if !ok {
+		return "", "", ErrUnknownHashFormat
+	}
+	p := currentPepper()
+	if p == nil {
+		return "", "", fmt.Errorf("%w: %s", ErrUnknownPepper, id)
+	}
+	peppered, ok := p.apply(id, password)
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrUnknownPepper, id)
+	}
+	return inner, peppered, nil
+}
@@ -0,0 +1,79 @@
+package tokens_test
+
+import (
+	"auth_service/internal/services/tokens"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Включает перец на время теста.
+func usePepper(t *testing.T, keys map[string][]byte, primary string) {
+	t.Helper()
+
+	p, err := tokens.NewPepper(keys, primary)
+	require.NoError(t, err)
+	tokens.SetPepper(p)
+	t.Cleanup(func() { tokens.SetPepper(nil) })
+}
+
+// Проверка хешей с перцем, ротации ключей и хешей, созданных без перца.
+func TestPepper(t *testing.T) {
+	bcryptHasher, err := tokens.NewBcryptHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	usePasswordHasher(t, bcryptHasher)
+	k1, k2 := bytes.Repeat([]byte{1}, tokens.MinPepperLength), bytes.Repeat([]byte{2}, tokens.MinPepperLength)
+
+	plainHash, err := tokens.HashPassword("password")
+	require.NoError(t, err)
+
+	usePepper(t, map[string][]byte{"p1": k1}, "p1")
+	oldHash, err := tokens.HashPassword("password")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(oldHash, "$pepper$p1$$2a$"), oldHash)
+	assert.NoError(t, tokens.ComparePassword(oldHash, "password"))
+	assert.ErrorIs(t, tokens.ComparePassword(oldHash, "wrong"), tokens.ErrPasswordMismatch)
+	assert.NoError(t, tokens.ComparePassword(plainHash, "password"), "hashes without pepper are still verified")
+
+	// После ротации новые хеши создаются новым ключом, прежние проверяются.
+	usePepper(t, map[string][]byte{"p1": k1, "p2": k2}, "p2")
+	newHash, err := tokens.HashPassword("password")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(newHash, "$pepper$p2$"), newHash)
+	assert.NoError(t, tokens.ComparePassword(newHash, "password"))
+	assert.NoError(t, tokens.ComparePassword(oldHash, "password"))
+
+	// Без ключа хеш не проверяется: перец нельзя подменить.
+	usePepper(t, map[string][]byte{"p2": k2}, "p2")
+	assert.ErrorIs(t, tokens.ComparePassword(oldHash, "password"), tokens.ErrUnknownPepper)
+	tokens.SetPepper(nil)
+	assert.ErrorIs(t, tokens.ComparePassword(newHash, "password"), tokens.ErrUnknownPepper)
+
+	// Длинные пароли не обрезаются bcrypt: HMAC укладывается в 72 байта.
+	usePepper(t, map[string][]byte{"p1": k1}, "p1")
+	long := strings.Repeat("a", 80)
+	longHash, err := tokens.HashPassword(long)
+	require.NoError(t, err)
+	assert.ErrorIs(t, tokens.ComparePassword(longHash, long[:72]), tokens.ErrPasswordMismatch)
+}
+
+func TestNewPepper(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, tokens.MinPepperLength)
+
+	_, err := tokens.NewPepper(map[string][]byte{"p1": key}, "p2")
+	assert.Error(t, err, "unknown primary key")
+	_, err = tokens.NewPepper(map[string][]byte{"p$1": key}, "p$1")
+	assert.Error(t, err, "id with separator")
+	_, err = tokens.NewPepper(map[string][]byte{"p1": key[:16]}, "p1")
+	assert.Error(t, err, "short key")
+
+	_, err = tokens.ParsePepper(map[string]string{"p1": "not base64!"}, "p1")
+	assert.Error(t, err)
+	p, err := tokens.ParsePepper(map[string]string{"p1": "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n"}, "p1")
+	require.NoError(t, err)
+	assert.NotNil(t, p)
+}
@@ -0,0 +1,387 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Алгоритмы подписи access-токенов.
+const (
+	// Общий секрет jwt_secret (HMAC-SHA512).
+	AlgorithmHS512 = "HS512"
+	// Закрытый ключ RSA (RSASSA-PKCS1-v1_5 с SHA-256); сервисы-потребители
+	// проверяют подпись открытым ключом.
+	AlgorithmRS256 = "RS256"
+	// Закрытый ключ ECDSA на кривой P-256 с SHA-256.
+	AlgorithmES256 = "ES256"
+	// Закрытый ключ Ed25519.
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Наименьший допустимый размер ключа RSA в битах.
+const minRSAKeyBits = 2048
+
+// Подпись access-токенов.
+type Signer interface {
+	// Алгоритм подписи (заголовок alg).
+	Method() jwt.SigningMethod
+	// Идентификатор ключа (заголовок kid); пустая строка — без kid.
+	KeyID() string
+	// Ключ, которым подписываются токены.
+	SigningKey() any
+	// Ключ, которым проверяется подпись.
+	VerificationKey() any
+}
+
+// Подпись общим секретом.
+type hmacSigner struct {
+	key []byte
+}
+
+func (s hmacSigner) Method() jwt.SigningMethod { return jwt.SigningMethodHS512 }
+func (s hmacSigner) KeyID() string             { return "" }
+func (s hmacSigner) SigningKey() any           { return s.key }
+func (s hmacSigner) VerificationKey() any      { return s.key }
+
+// Подпись закрытым ключом (RS256, ES256 или EdDSA).
+type KeySigner struct {
+	method jwt.SigningMethod
+	key    crypto.Signer
+	keyID  string
+}
+
+// Создаёт подпись закрытым ключом.
+//
+// Принимает:
+// - algorithm: AlgorithmRS256, AlgorithmES256 или AlgorithmEdDSA.
+// - key: закрытый ключ, подходящий алгоритму: RSA не короче 2048 бит, ECDSA
+// на кривой P-256 или Ed25519.
+// - keyID: идентификатор ключа; пустая строка — отпечаток открытого ключа (RFC 7638).
+//
+// Возвращает:
+// - указатель на KeySigner.
+// - ошибку, если алгоритм не поддерживается или ключ ему не подходит.
+func NewKeySigner(algorithm string, key crypto.Signer, keyID string) (*KeySigner, error) {
+	method, err := keyMethod(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if method.Alg() != algorithm {
+		return nil, fmt.Errorf("%s key cannot be used for %s, expected %s", keyType(key.Public()), algorithm, method.Alg())
+	}
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok && rsaKey.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA key must be at least %d bits, got %d", minRSAKeyBits, rsaKey.N.BitLen())
+	}
+	if keyID == "" {
+		if keyID, err = Thumbprint(key.Public()); err != nil {
+			return nil, err
+		}
+	}
+	return &KeySigner{method: method, key: key, keyID: keyID}, nil
+}
+
+// Загружает закрытый ключ из PEM-файла и создаёт подпись.
+//
+// Принимает:
+// - algorithm: AlgorithmRS256, AlgorithmES256 или AlgorithmEdDSA.
+// - path: путь к ключу в PEM (PKCS#8 «PRIVATE KEY», PKCS#1 «RSA PRIVATE KEY»
+// или SEC 1 «EC PRIVATE KEY»).
+// - keyID: идентификатор ключа; пустая строка — отпечаток открытого ключа.
+//
+// Возвращает:
+// - указатель на KeySigner.
+// - ошибку, если файл не прочитан или ключ не подходит алгоритму.
+func LoadSigner(algorithm, path, keyID string) (*KeySigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySigner(algorithm, key, keyID)
+}
+
+// Разбирает закрытый ключ в PEM (PKCS#8, PKCS#1 или SEC 1).
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", parsed)
+	}
+	return key, nil
+}
+
+func (s *KeySigner) Method() jwt.SigningMethod { return s.method }
+func (s *KeySigner) KeyID() string             { return s.keyID }
+func (s *KeySigner) SigningKey() any           { return s.key }
+func (s *KeySigner) VerificationKey() any      { return s.key.Public() }
+
+// Возвращает открытый ключ.
+func (s *KeySigner) PublicKey() crypto.PublicKey {
+	return s.key.Public()
+}
+
+// Открытый ключ проверки подписи.
+type PublicKey struct {
+	// Идентификатор ключа (kid).
+	ID string
+	// *rsa.PublicKey, *ecdsa.PublicKey или ed25519.PublicKey.
+	Key crypto.PublicKey
+}
+
+// Возвращает алгоритм подписи, которым проверяются токены этого ключа.
+func (k PublicKey) Algorithm() string {
+	method, _ := keyMethod(k.Key)
+	if method == nil {
+		return ""
+	}
+	return method.Alg()
+}
+
+// Загружает открытый ключ из PEM-файла («PUBLIC KEY», PKIX).
+//
+// Принимает:
+// - path: путь к ключу.
+// - keyID: идентификатор ключа; пустая строка — отпечаток ключа (RFC 7638).
+//
+// Возвращает:
+// - открытый ключ.
+// - ошибку, если файл не прочитан или ключ не поддерживается.
+func LoadPublicKey(path, keyID string) (PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return PublicKey{}, fmt.Errorf("%s is not a PEM encoded PUBLIC KEY", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	if _, err := keyMethod(key); err != nil {
+		return PublicKey{}, err
+	}
+	if keyID == "" {
+		if keyID, err = Thumbprint(key); err != nil {
+			return PublicKey{}, err
+		}
+	}
+	return PublicKey{ID: keyID, Key: key}, nil
+}
+
+// Возвращает алгоритм подписи, соответствующий типу ключа: каждый ключ
+// проверяет подписи только одного алгоритма.
+func keyMethod(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s, expected P-256", k.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
+
+func keyType(key crypto.PublicKey) string {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return "RSA"
+	case *ecdsa.PublicKey:
+		return "ECDSA"
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return fmt.Sprintf("%T", key)
+}
+
+// Вычисляет отпечаток открытого ключа по RFC 7638 (SHA-256, base64url).
+//
+// Возвращает:
+// - отпечаток.
+// - ошибку, если тип ключа не поддерживается.
+func Thumbprint(key crypto.PublicKey) (string, error) {
+	// Обязательные члены JWK в лексикографическом порядке без пробелов.
+	var canonical string
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		canonical = `{"e":"` + encodeBigInt(big.NewInt(int64(k.E))) + `","kty":"RSA","n":"` + encodeBigInt(k.N) + `"}`
+	case *ecdsa.PublicKey:
+		x, y := ecCoordinates(k)
+		canonical = `{"crv":"` + k.Curve.Params().Name + `","kty":"EC","x":"` + x + `","y":"` + y + `"}`
+	case ed25519.PublicKey:
+		canonical = `{"crv":"Ed25519","kty":"OKP","x":"` + base64.RawURLEncoding.EncodeToString(k) + `"}`
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// Возвращает координаты открытого ключа ECDSA в base64url, дополненные до
+// размера кривой (RFC 7518, раздел 6.2.1).
+func ecCoordinates(key *ecdsa.PublicKey) (string, string) {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+		base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+// Возвращает параметры открытого ключа в формате JWK (RFC 7517, 7518, 8037):
+// kty и члены ключа (n, e для RSA; crv, x, y для EC; crv, x для OKP).
+func JWKParams(key crypto.PublicKey) map[string]string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "n": encodeBigInt(k.N), "e": encodeBigInt(big.NewInt(int64(k.E)))}
+	case *ecdsa.PublicKey:
+		x, y := ecCoordinates(k)
+		return map[string]string{"kty": "EC", "crv": k.Curve.Params().Name, "x": x, "y": y}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(k)}
+	}
+	return nil
+}
+
+var (
+	// Подпись, заданная SetSigner; nil — токены подписываются jwt_secret.
+	signer Signer
+	// Открытые ключи прежних подписей, заданные SetPreviousKeys.
+	previousKeys []PublicKey
+	// Время, до которого при подписи закрытым ключом принимаются токены без
+	// kid, подписанные общим секретом (SetLegacyHS512Until).
+	legacyHS512Until time.Time
+)
+
+// Задаёт подпись access-токенов вместо общего секрета.
+//
+// Токены без kid, подписанные общим секретом до переключения, после него
+// отклоняются, если переходный срок не задан SetLegacyHS512Until.
+// Вызывается при запуске до выпуска первых токенов.
+//
+// Принимает:
+// - s: подпись; nil возвращает подпись общим секретом.
+func SetSigner(s Signer) {
+	signer = s
+}
+
+// Задаёт переходный срок после переключения на подпись закрытым ключом, до
+// которого принимаются токены без kid, подписанные общим секретом. Срок
+// должен покрывать время жизни уже выданных access-токенов; нулевое время
+// отклоняет такие токены сразу. Вызывается при запуске вместе с SetSigner.
+//
+// Принимает:
+// - until: время окончания переходного срока.
+func SetLegacyHS512Until(until time.Time) {
+	legacyHS512Until = until
+}
+
+// Задаёт открытые ключи, которыми подписывались токены до замены ключа.
+//
+// Токены с kid такого ключа принимаются, пока не истекут, а сами ключи
+// публикуются в JWKS, чтобы сервисы-потребители могли их проверить.
+// Вызывается при запуске вместе с SetSigner.
+func SetPreviousKeys(keys []PublicKey) {
+	previousKeys = keys
+}
+
+// Возвращает открытые ключи проверки подписи: ключ текущей подписи (если
+// токены подписываются закрытым ключом) и ключи, заданные SetPreviousKeys.
+func PublicKeys() []PublicKey {
+	keys := make([]PublicKey, 0, len(previousKeys)+1)
+	if s, ok := signer.(*KeySigner); ok {
+		keys = append(keys, PublicKey{ID: s.KeyID(), Key: s.PublicKey()})
+	}
+	return append(keys, previousKeys...)
+}
+
+// Возвращает подпись, которой выпускаются токены.
+func currentSigner(jwtSecret string) Signer {
+	if signer != nil {
+		return signer
+	}
+	return hmacSigner{key: signingKey(jwtSecret)}
+}
+
+// Возвращает ключ проверки подписи токена.
+//
+// Ключ выбирается по kid, и алгоритм токена должен совпадать с алгоритмом
+// этого ключа: токен не может выбрать другой способ проверки, подменив
+// заголовок alg (algorithm confusion). Общий секрет проверяет только HS512
+// и, если токены подписываются закрытым ключом, только до окончания
+// переходного срока (SetLegacyHS512Until).
+func verificationKey(token *jwt.Token, jwtSecret string) (any, error) {
+	alg := token.Method.Alg()
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if alg != AlgorithmHS512 {
+			return nil, fmt.Errorf("unexpected signing method %s for token without kid", alg)
+		}
+		if signer != nil && signer.Method().Alg() != AlgorithmHS512 && !Clock.Now().Before(legacyHS512Until) {
+			return nil, errors.New("token without kid is not accepted after switching to key signing")
+		}
+		return signingKey(jwtSecret), nil
+	}
+
+	var key any
+	var expected string
+	if signer != nil && kid == signer.KeyID() {
+		key, expected = signer.VerificationKey(), signer.Method().Alg()
+	} else {
+		for _, previous := range previousKeys {
+			if previous.ID == kid {
+				key, expected = previous.Key, previous.Algorithm()
+				break
+			}
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if alg != expected {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q, expected %s", alg, kid, expected)
+	}
+	return key, nil
+}
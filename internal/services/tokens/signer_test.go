@@ -0,0 +1,228 @@
+package tokens_test
+
+import (
+	"auth_service/internal/services/tokens"
+	"auth_service/pkg/authtoken"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Создаёт закрытый ключ для алгоритма.
+func generateKey(t *testing.T, algorithm string) crypto.Signer {
+	t.Helper()
+
+	var key crypto.Signer
+	var err error
+	switch algorithm {
+	case tokens.AlgorithmRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case tokens.AlgorithmES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case tokens.AlgorithmEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	require.NoError(t, err)
+	return key
+}
+
+// Сохраняет ключ в PEM-файл во временном каталоге теста.
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+// Возвращает открытый ключ подписи в PEM.
+func publicPEM(t *testing.T, signer *tokens.KeySigner) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(signer.PublicKey())
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// Включает подпись закрытым ключом на время теста.
+func useSigner(t *testing.T, algorithm string) *tokens.KeySigner {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(generateKey(t, algorithm))
+	require.NoError(t, err)
+	signer, err := tokens.LoadSigner(algorithm, writePEM(t, "PRIVATE KEY", der), "")
+	require.NoError(t, err)
+	tokens.SetSigner(signer)
+	t.Cleanup(func() { tokens.SetSigner(nil) })
+	return signer
+}
+
+// Проверка выпуска токенов закрытым ключом и их проверки только по открытому ключу.
+func TestKeySigner(t *testing.T) {
+	legacy, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+
+	for _, algorithm := range []string{tokens.AlgorithmRS256, tokens.AlgorithmES256, tokens.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			signer := useSigner(t, algorithm)
+			accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "session", 0, nil)
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(accessToken, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, algorithm, parsed.Method.Alg())
+			assert.Equal(t, signer.KeyID(), parsed.Header["kid"])
+
+			claims, err := tokens.ParseAccessToken(accessToken, "secret")
+			require.NoError(t, err)
+			assert.Equal(t, "session", claims.SessionID)
+
+			// Токены, подписанные общим секретом до переключения, без
+			// переходного срока отклоняются.
+			_, err = tokens.ParseAccessToken(legacy, "secret")
+			assert.Error(t, err)
+
+			// Сервису-потребителю достаточно открытого ключа.
+			keys, err := authtoken.ParsePublicKeyPEM(publicPEM(t, signer), "")
+			require.NoError(t, err)
+			verifier, err := authtoken.NewVerifier(authtoken.WithKeys(keys))
+			require.NoError(t, err)
+			verified, err := verifier.Verify(context.Background(), accessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "user", verified.Subject)
+		})
+	}
+}
+
+// Проверка переходного срока для токенов без kid, подписанных общим
+// секретом до переключения на закрытый ключ.
+func TestLegacyHS512Until(t *testing.T) {
+	clk := useFakeClock(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	legacy, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+
+	useSigner(t, tokens.AlgorithmEdDSA)
+	tokens.SetLegacyHS512Until(clk.Now().Add(10 * time.Minute))
+	t.Cleanup(func() { tokens.SetLegacyHS512Until(time.Time{}) })
+
+	claims, err := tokens.ParseAccessToken(legacy, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+
+	clk.Advance(10 * time.Minute)
+	_, err = tokens.ParseAccessToken(legacy, "secret")
+	assert.Error(t, err)
+
+	// Без подписи закрытым ключом срок не действует.
+	tokens.SetSigner(nil)
+	_, err = tokens.ParseAccessToken(legacy, "secret")
+	assert.NoError(t, err)
+}
+
+// Проверка, что токен, подписанный другим ключом, отклоняется.
+func TestKeySigner_RejectsOtherKey(t *testing.T) {
+	useSigner(t, tokens.AlgorithmRS256)
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+
+	useSigner(t, tokens.AlgorithmRS256)
+	_, err = tokens.ParseAccessToken(accessToken, "secret")
+	assert.Error(t, err)
+}
+
+// Проверка, что алгоритм токена должен совпадать с алгоритмом ключа.
+func TestKeySigner_AlgorithmConfusion(t *testing.T) {
+	signer := useSigner(t, tokens.AlgorithmRS256)
+	claims := jwt.MapClaims{"sub": "user", "ip": "127.0.0.1", "refresh_hash": "hash", "exp": jwt.NewNumericDate(tokens.Clock.Now().Add(tokens.AccessTokenTTL()))}
+
+	// Токен HMAC с kid открытого ключа.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	token.Header["kid"] = signer.KeyID()
+	signed, err := token.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = tokens.ParseAccessToken(signed, "secret")
+	assert.Error(t, err, "HS512 with RSA kid")
+
+	// Токен HMAC, подписанный открытым ключом как секретом.
+	token = jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	signed, err = token.SignedString(publicPEM(t, signer))
+	require.NoError(t, err)
+	_, err = tokens.ParseAccessToken(signed, "secret")
+	assert.Error(t, err, "HS512 signed with public key")
+
+	// Токен другого асимметричного алгоритма с kid ключа RSA.
+	token = jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = signer.KeyID()
+	signed, err = token.SignedString(generateKey(t, tokens.AlgorithmES256))
+	require.NoError(t, err)
+	_, err = tokens.ParseAccessToken(signed, "secret")
+	assert.Error(t, err, "ES256 with RSA kid")
+
+	// Токен HS256 общим секретом: проверяется только HS512.
+	token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err = token.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = tokens.ParseAccessToken(signed, "secret")
+	assert.Error(t, err, "HS256")
+}
+
+// Проверка, что токены прежнего ключа принимаются после его замены.
+func TestPreviousKeys(t *testing.T) {
+	previous := useSigner(t, tokens.AlgorithmES256)
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(publicPEM(t, previous))
+	key, err := tokens.LoadPublicKey(writePEM(t, block.Type, block.Bytes), "")
+	require.NoError(t, err)
+	assert.Equal(t, previous.KeyID(), key.ID)
+	assert.Equal(t, tokens.AlgorithmES256, key.Algorithm())
+
+	current := useSigner(t, tokens.AlgorithmEdDSA)
+	tokens.SetPreviousKeys([]tokens.PublicKey{key})
+	t.Cleanup(func() { tokens.SetPreviousKeys(nil) })
+
+	_, err = tokens.ParseAccessToken(accessToken, "secret")
+	assert.NoError(t, err)
+
+	keys := tokens.PublicKeys()
+	require.Len(t, keys, 2)
+	assert.Equal(t, current.KeyID(), keys[0].ID)
+	assert.Equal(t, previous.KeyID(), keys[1].ID)
+}
+
+// Проверка отказа от неподходящих ключей.
+func TestLoadSigner_Invalid(t *testing.T) {
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = tokens.NewKeySigner(tokens.AlgorithmRS256, short, "")
+	assert.Error(t, err, "short RSA key")
+
+	_, err = tokens.NewKeySigner(tokens.AlgorithmRS256, generateKey(t, tokens.AlgorithmES256), "")
+	assert.Error(t, err, "ECDSA key for RS256")
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, err = tokens.NewKeySigner(tokens.AlgorithmES256, p384, "")
+	assert.Error(t, err, "P-384 key for ES256")
+
+	_, err = tokens.ParsePrivateKey([]byte("not a key"))
+	assert.Error(t, err)
+
+	_, err = tokens.LoadSigner(tokens.AlgorithmRS256, filepath.Join(t.TempDir(), "missing.pem"), "")
+	assert.Error(t, err)
+}
@@ -1,123 +1,369 @@
 package tokens
 
 import (
+	"auth_service/lib/clock"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	accessTokenExpiry = 15 * time.Minute
+	// Срок действия access-токена по умолчанию.
+	DefaultAccessTokenTTL = 15 * time.Minute
+	// Допустимые границы срока действия access-токена: короче минуты клиенты
+	// не успевают им воспользоваться, дольше суток отзыв по сессии и версии
+	// токенов запаздывает слишком сильно.
+	MinAccessTokenTTL = time.Minute
+	MaxAccessTokenTTL = 24 * time.Hour
+	// Количество случайных байт refresh-токена.
+	refreshTokenBytes = 32
 )
 
+// Срок действия выпускаемых access-токенов.
+var accessTokenTTL = DefaultAccessTokenTTL
+
+// Задаёт срок действия выпускаемых access-токенов. Вызывается при запуске до
+// выпуска первых токенов.
+//
+// Принимает:
+// - ttl: срок действия от MinAccessTokenTTL до MaxAccessTokenTTL.
+//
+// Возвращает:
+// - ошибку, если срок вне допустимых границ.
+func SetAccessTokenTTL(ttl time.Duration) error {
+	if ttl < MinAccessTokenTTL || ttl > MaxAccessTokenTTL {
+		return fmt.Errorf("access token TTL %s is outside the range %s..%s", ttl, MinAccessTokenTTL, MaxAccessTokenTTL)
+	}
+	accessTokenTTL = ttl
+	return nil
+}
+
+// Возвращает срок действия выпускаемых access-токенов.
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
+}
+
+// Издатель (claim iss) и получатели (claim aud) выпускаемых access-токенов;
+// пустые значения — без claims.
+var (
+	issuer   string
+	audience []string
+)
+
+// Задаёт издателя и получателей выпускаемых access-токенов, чтобы
+// сервисы-потребители могли проверять их (authtoken.WithIssuer,
+// authtoken.WithAudience). Вызывается при запуске до выпуска первых токенов.
+//
+// Принимает:
+// - iss: издатель (claim iss); пустая строка — без claim.
+// - aud: получатели (claim aud); пустой список — без claim.
+func SetIssuer(iss string, aud []string) {
+	issuer = iss
+	audience = aud
+}
+
+// Источник времени для выпуска и проверки токенов. Подменяется в тестах.
+var Clock clock.Clock = clock.Real{}
+
+// Claims access-токена. Типизированная структура вместо jwt.MapClaims
+// избавляет от выделения map и приведений interface{} при выпуске и проверке.
+type accessClaims struct {
+	IP          string `json:"ip"`
+	RefreshHash string `json:"refresh_hash"`
+	// Идентификатор сессии (refresh-токена), в которой выдан токен.
+	SessionID string `json:"sid,omitempty"`
+	// Версия токенов пользователя на момент выдачи.
+	Version int64 `json:"ver,omitempty"`
+	// Дополнительные claims (см. CustomClaims).
+	Roles    []string `json:"roles,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	TenantID string   `json:"tenant_id,omitempty"`
+	Plan     string   `json:"plan,omitempty"`
+	// Остальные дополнительные claims; сериализуются на верхнем уровне payload.
+	Extra map[string]any `json:"-"`
+	jwt.RegisteredClaims
+}
+
+// Данные действительного access-токена.
+type AccessClaims struct {
+	UserID      string
+	ClientIP    string
+	RefreshHash string
+	// Идентификатор сессии (claim sid); пуст у токенов, выданных до его появления.
+	SessionID string
+	// Идентификатор токена (claim jti); пуст у токенов, выданных до его появления.
+	ID string
+	// Версия токенов пользователя (claim ver); 0 у токенов, выданных до её повышения.
+	Version   int64
+	ExpiresAt time.Time
+	// Дополнительные claims: роли, разрешения, арендатор, тариф и прочие.
+	Custom CustomClaims
+}
+
+// Парсер access-токенов; создаётся один раз, время берётся из Clock при каждой проверке.
+var parser = jwt.NewParser(
+	jwt.WithValidMethods([]string{AlgorithmHS512, AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}),
+	jwt.WithTimeFunc(func() time.Time { return Clock.Now() }),
+)
+
+// Парсер access-токенов, предъявляемых при обновлении: проверяет подпись, но
+// не срок действия.
+var expiredParser = jwt.NewParser(
+	jwt.WithValidMethods([]string{AlgorithmHS512, AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}),
+	jwt.WithoutClaimsValidation(),
+)
+
+// Ключи подписи, уже преобразованные из строки секрета в []byte.
+// Секретов в процессе единицы (jwt_secret и refresh_token_secret), поэтому кеш не ограничивается.
+var signingKeys sync.Map
+
+// Возвращает ключ подписи для секрета, преобразуя его только при первом обращении.
+func signingKey(secret string) []byte {
+	if key, ok := signingKeys.Load(secret); ok {
+		return key.([]byte)
+	}
+	key, _ := signingKeys.LoadOrStore(secret, []byte(secret))
+	return key.([]byte)
+}
+
 // Генерирует Access Token с указанным userID и clientIP.
 // Принимает:
 // - userID (string): уникальный идентификатор пользователя.
 // - clientIP (string): IP-адрес клиента для дополнительной верификации.
-// - jwtSecret (string): секретный ключ для подписи токена.
+// - jwtSecret (string): секретный ключ для подписи токена, если подпись не задана SetSigner.
+// - refreshHash (string): хеш refresh-токена, выданного вместе с access-токеном.
+// - sessionID (string): идентификатор сессии для claim sid; пустая строка — без claim.
+// - version (int64): версия токенов пользователя для claim ver; 0 — без claim.
+// - custom (map[string]any): дополнительные claims (см. NewCustomClaims); nil — без них.
 // Возвращает:
 // - строку (сгенерированный Access Token).
-// - ошибку, если токен не удалось создать или подписать.
-func GenerateAccessToken(userID, clientIP, jwtSecret, refreshHash string) (string, error) {
-	now := time.Now()
-	expirationTime := now.Add(accessTokenExpiry).Unix()
+// - ошибку, если токен не удалось создать или подписать, либо дополнительный
+// claim зарезервирован (ErrReservedClaim) или имеет неверный тип (ErrInvalidClaim).
+func GenerateAccessToken(userID, clientIP, jwtSecret, refreshHash, sessionID string, version int64, custom map[string]any) (string, error) {
+	now := Clock.Now().Truncate(time.Second)
+
+	extra, err := NewCustomClaims(custom)
+	if err != nil {
+		return "", err
+	}
 
-	claims := jwt.MapClaims{
-		"sub":          userID,
-		"ip":           clientIP,
-		"refresh_hash": refreshHash,
-		"exp":          expirationTime,
-		"iat":          now.Unix(),
+	claims := &accessClaims{
+		IP:          clientIP,
+		RefreshHash: refreshHash,
+		SessionID:   sessionID,
+		Version:     version,
+		Roles:       extra.Roles,
+		Scope:       strings.Join(extra.Scopes, " "),
+		TenantID:    extra.TenantID,
+		Plan:        extra.Plan,
+		Extra:       extra.Extra,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   userID,
+			Audience:  audience,
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.NewString(),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	signedToken, err := token.SignedString([]byte(jwtSecret))
+	s := currentSigner(jwtSecret)
+	token := jwt.NewWithClaims(s.Method(), claims)
+	if kid := s.KeyID(); kid != "" {
+		token.Header["kid"] = kid
+	}
+	signedToken, err := token.SignedString(s.SigningKey())
+	if errors.Is(err, ErrInvalidClaim) {
+		return "", err
+	}
 	if err != nil {
 		return "", errors.New("failed to sign access token")
 	}
+	if encryption != nil {
+		return encryptToken(signedToken)
+	}
 	return signedToken, nil
 }
 
-// Генерирует Refresh токен и его bcrypt-хеш.
+// Refresh-токен не соответствует сохранённому хешу.
+var ErrRefreshTokenMismatch = errors.New("refresh token does not match hash")
+
+// Генерирует Refresh токен и его HMAC-SHA256.
+//
+// Принимает:
+// - secret (string): серверный ключ HMAC.
 //
 // Возвращает:
 // - строку (сгенерированный Refresh Token).
-// - строку (bcrypt-хеш Refresh токена).
+// - строку (HMAC-SHA256 Refresh токена в hex).
 // - ошибку, если токен не удалось создать.
-func GenerateRefreshTokenAndHash() (string, string, error) {
-	rawToken := uuid.New().String()
-	encodedToken := base64.StdEncoding.EncodeToString([]byte(rawToken))
-
-	hashedToken, err := bcrypt.GenerateFromPassword([]byte(encodedToken), bcrypt.DefaultCost)
-	if err != nil {
+func GenerateRefreshTokenAndHash(secret string) (string, string, error) {
+	var raw [refreshTokenBytes]byte
+	if _, err := rand.Read(raw[:]); err != nil {
 		return "", "", err
 	}
+	encodedToken := base64.StdEncoding.EncodeToString(raw[:])
 
-	return encodedToken, string(hashedToken), nil
+	return encodedToken, HashRefreshToken(encodedToken, secret), nil
 }
 
-// Проверяет валидность Access токена и извлекает userID, clientIP и refreshHash.
+// Вычисляет HMAC-SHA256 Refresh токена.
+//
+// В отличие от bcrypt, результат детерминирован, поэтому по нему можно искать
+// сессию в индексе хранилища, а вычисление занимает микросекунды.
+//
+// Принимает:
+// - refreshToken (string): оригинальный Refresh токен.
+// - secret (string): серверный ключ HMAC.
+//
+// Возвращает:
+// - строку (HMAC-SHA256 в hex).
+func HashRefreshToken(refreshToken, secret string) string {
+	mac := hmac.New(sha256.New, signingKey(secret))
+	mac.Write([]byte(refreshToken))
+
+	var sum [sha256.Size]byte
+	var encoded [sha256.Size * 2]byte
+	hex.Encode(encoded[:], mac.Sum(sum[:0]))
+	return string(encoded[:])
+}
+
+// Сообщает, что хеш получен алгоритмом хеширования паролей (bcrypt или
+// argon2id), а не HMAC: так хранились сессии, выданные до перехода на HMAC.
+func IsLegacyHash(hashedToken string) bool {
+	for _, h := range passwordHashers {
+		if h.Recognizes(hashedToken) {
+			return true
+		}
+	}
+	return false
+}
+
+// Проверяет валидность Access токена и возвращает все его данные, включая
+// дополнительные claims. То же, что ParseAccessToken.
 //
 // Принимает:
 // - accessToken (string): токен, который необходимо проверить.
 // - jwtSecret (string): секретный ключ для валидации подписи токена.
 //
 // Возвращает:
-// - строку (userID): идентификатор пользователя, извлеченный из токена.
-// - строку (clientIP): IP-адрес клиента, извлеченный из токена.
-// - строку (refreshHash): хешированный refresh-токен, связанный с Access токеном.
+// - данные токена.
+// - ошибку, если токен недействителен, либо отсутствуют необходимые данные.
+func ValidateAccessToken(accessToken, jwtSecret string) (AccessClaims, error) {
+	return ParseAccessToken(accessToken, jwtSecret)
+}
+
+// Проверяет валидность Access токена и возвращает все его данные, включая sid
+// и дополнительные claims.
+//
+// Принимает:
+// - accessToken (string): токен, который необходимо проверить.
+// - jwtSecret (string): секретный ключ для проверки токенов, подписанных общим секретом.
+//
+// Возвращает:
+// - данные токена.
 // - ошибку, если токен недействителен, либо отсутствуют необходимые данные.
-func ValidateAccessToken(accessToken, jwtSecret string) (string, string, string, error) {
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
+func ParseAccessToken(accessToken, jwtSecret string) (AccessClaims, error) {
+	return parseAccessToken(parser, accessToken, jwtSecret)
+}
+
+// Проверяет подпись access-токена, срок действия которого мог истечь, и
+// возвращает его данные. Используется при обновлении токенов: клиент
+// обновляет их, как правило, когда access-токен уже истёк, а сам токен без
+// refresh-токена сессии ничего не даёт.
+//
+// Принимает:
+// - accessToken (string): выданный сервисом access-токен, в том числе истёкший.
+// - jwtSecret (string): секретный ключ для проверки токенов, подписанных общим секретом.
+//
+// Возвращает:
+// - данные токена.
+// - ошибку, если подпись недействительна, либо отсутствуют необходимые данные.
+func ParseExpiredAccessToken(accessToken, jwtSecret string) (AccessClaims, error) {
+	return parseAccessToken(expiredParser, accessToken, jwtSecret)
+}
+
+// Разбирает access-токен указанным парсером.
+func parseAccessToken(parser *jwt.Parser, accessToken, jwtSecret string) (AccessClaims, error) {
+	if isEncrypted(accessToken) {
+		signed, err := decryptToken(accessToken)
+		if err != nil {
+			return AccessClaims{}, err
 		}
-		return []byte(jwtSecret), nil
-	})
+		accessToken = signed
+	}
 
+	claims := &accessClaims{}
+	_, err := parser.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return verificationKey(token, jwtSecret)
+	})
 	if err != nil {
-		return "", "", "", errors.New("failed to parse token: " + err.Error())
+		return AccessClaims{}, errors.New("failed to parse token: " + err.Error())
 	}
 
-	if !token.Valid {
-		return "", "", "", errors.New("token is not valid")
+	if claims.Subject == "" {
+		return AccessClaims{}, errors.New("userID (sub) is missing or invalid in token claims")
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", "", "", errors.New("invalid token claims format")
+	if claims.IP == "" {
+		return AccessClaims{}, errors.New("clientIP (ip) is missing or invalid in token claims")
 	}
-
-	userID, ok := claims["sub"].(string)
-	if !ok || userID == "" {
-		return "", "", "", errors.New("userID (sub) is missing or invalid in token claims")
+	if claims.RefreshHash == "" {
+		return AccessClaims{}, errors.New("refresh_hash is missing or invalid in token claims")
 	}
 
-	clientIP, ok := claims["ip"].(string)
-	if !ok || clientIP == "" {
-		return "", "", "", errors.New("clientIP (ip) is missing or invalid in token claims")
+	result := AccessClaims{
+		UserID:      claims.Subject,
+		ClientIP:    claims.IP,
+		RefreshHash: claims.RefreshHash,
+		SessionID:   claims.SessionID,
+		ID:          claims.ID,
+		Version:     claims.Version,
+		Custom: CustomClaims{
+			Roles:    claims.Roles,
+			Scopes:   scopes(claims.Scope),
+			TenantID: claims.TenantID,
+			Plan:     claims.Plan,
+			Extra:    claims.Extra,
+		},
 	}
-
-	refreshHash, ok := claims["refresh_hash"].(string)
-	if !ok || refreshHash == "" {
-		return "", "", "", errors.New("refresh_hash is missing or invalid in token claims")
+	if claims.ExpiresAt != nil {
+		result.ExpiresAt = claims.ExpiresAt.Time
 	}
-
-	return userID, clientIP, refreshHash, nil
+	return result, nil
 }
 
-// Проверяет соответствие оригинального Refresh токена и его bcrypt-хеша.
+// Проверяет соответствие оригинального Refresh токена и его хеша.
+//
+// Хеши bcrypt и argon2id, сохранённые до перехода на HMAC, по-прежнему принимаются;
+// при ротации такая сессия получает HMAC-хеш.
 //
 // Принимает:
-// - hashedToken (string): хешированный Refresh токен.
+// - hashedToken (string): хешированный Refresh токен (HMAC-SHA256, bcrypt или argon2id).
 // - refreshToken (string): оригинальный Refresh токен.
+// - secret (string): серверный ключ HMAC.
 //
 // Возвращает:
-// - ошибку, если токен не соответствует хешу.
-func CompareRefreshToken(hashedToken, refreshToken string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedToken), []byte(refreshToken))
+// - ErrRefreshTokenMismatch, если токен не соответствует хешу.
+func CompareRefreshToken(hashedToken, refreshToken, secret string) error {
+	if IsLegacyHash(hashedToken) {
+		if err := ComparePassword(hashedToken, refreshToken); err != nil {
+			return ErrRefreshTokenMismatch
+		}
+		return nil
+	}
+
+	if !hmac.Equal([]byte(hashedToken), []byte(HashRefreshToken(refreshToken, secret))) {
+		return ErrRefreshTokenMismatch
+	}
+	return nil
 }
@@ -0,0 +1,229 @@
+package tokens_test
+
+import (
+	"auth_service/internal/services/tokens"
+	"auth_service/lib/clock"
+	"auth_service/pkg/authtoken"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Подменяет часы пакета tokens на время теста.
+func useFakeClock(t *testing.T, now time.Time) *clock.Fake {
+	fake := clock.NewFake(now)
+	previous := tokens.Clock
+	tokens.Clock = fake
+	t.Cleanup(func() { tokens.Clock = previous })
+	return fake
+}
+
+// Проверка истечения Access токена по управляемым часам.
+func TestValidateAccessToken_Expiry(t *testing.T) {
+	clk := useFakeClock(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	secret := "secret"
+
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", secret, "hash", "", 0, nil)
+	assert.NoError(t, err)
+
+	clk.Advance(14 * time.Minute)
+	claims, err := tokens.ValidateAccessToken(accessToken, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+
+	clk.Advance(2 * time.Minute)
+	_, err = tokens.ValidateAccessToken(accessToken, secret)
+	assert.Error(t, err)
+}
+
+// Проверка разбора истёкшего access-токена при обновлении: срок не
+// проверяется, подпись — проверяется.
+func TestParseExpiredAccessToken(t *testing.T) {
+	clk := useFakeClock(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "session", 0, nil)
+	require.NoError(t, err)
+	clk.Advance(tokens.AccessTokenTTL() + time.Hour)
+
+	_, err = tokens.ParseAccessToken(accessToken, "secret")
+	assert.Error(t, err)
+	claims, err := tokens.ParseExpiredAccessToken(accessToken, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+	assert.Equal(t, "session", claims.SessionID)
+
+	_, err = tokens.ParseExpiredAccessToken(accessToken, "other-secret")
+	assert.Error(t, err)
+}
+
+// Проверка claim sid: сохраняется в токене и не обязателен для старых токенов.
+func TestParseAccessToken_SessionID(t *testing.T) {
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "session", 0, nil)
+	assert.NoError(t, err)
+
+	claims, err := tokens.ParseAccessToken(accessToken, "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+	assert.Equal(t, "127.0.0.1", claims.ClientIP)
+	assert.Equal(t, "hash", claims.RefreshHash)
+	assert.Equal(t, "session", claims.SessionID)
+
+	accessToken, err = tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	assert.NoError(t, err)
+	claims, err = tokens.ParseAccessToken(accessToken, "secret")
+	assert.NoError(t, err)
+	assert.Empty(t, claims.SessionID)
+}
+
+// Проверка claim jti: уникален для каждого токена и возвращается вместе со сроком действия.
+func TestParseAccessToken_ID(t *testing.T) {
+	clk := useFakeClock(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	first, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "session", 0, nil)
+	assert.NoError(t, err)
+	second, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "session", 0, nil)
+	assert.NoError(t, err)
+
+	firstClaims, err := tokens.ParseAccessToken(first, "secret")
+	assert.NoError(t, err)
+	secondClaims, err := tokens.ParseAccessToken(second, "secret")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, firstClaims.ID)
+	assert.NotEqual(t, firstClaims.ID, secondClaims.ID)
+	assert.True(t, firstClaims.ExpiresAt.Equal(clk.Now().Add(tokens.AccessTokenTTL())))
+}
+
+// Проверка настраиваемого срока действия access-токена и его границ.
+func TestSetAccessTokenTTL(t *testing.T) {
+	clk := useFakeClock(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, tokens.SetAccessTokenTTL(5*time.Minute))
+	t.Cleanup(func() { _ = tokens.SetAccessTokenTTL(tokens.DefaultAccessTokenTTL) })
+
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+	claims, err := tokens.ParseAccessToken(accessToken, "secret")
+	require.NoError(t, err)
+	assert.True(t, claims.ExpiresAt.Equal(clk.Now().Add(5*time.Minute)))
+
+	assert.Error(t, tokens.SetAccessTokenTTL(time.Second))
+	assert.Error(t, tokens.SetAccessTokenTTL(48*time.Hour))
+	assert.Equal(t, 5*time.Minute, tokens.AccessTokenTTL())
+}
+
+// Проверка claims iss и aud: токены сервиса принимаются authtoken.Verifier
+// с WithIssuer и WithAudience.
+func TestSetIssuer(t *testing.T) {
+	verifier, err := authtoken.NewVerifier(
+		authtoken.WithSecret("secret"),
+		authtoken.WithIssuer("auth_service"),
+		authtoken.WithAudience("orders"),
+	)
+	require.NoError(t, err)
+
+	accessToken, err := tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), accessToken)
+	assert.ErrorIs(t, err, authtoken.ErrInvalidToken)
+
+	tokens.SetIssuer("auth_service", []string{"orders", "billing"})
+	t.Cleanup(func() { tokens.SetIssuer("", nil) })
+
+	accessToken, err = tokens.GenerateAccessToken("user", "127.0.0.1", "secret", "hash", "", 0, nil)
+	require.NoError(t, err)
+	claims, err := verifier.Verify(context.Background(), accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.Subject)
+	assert.Equal(t, "auth_service", claims.Issuer)
+	assert.Equal(t, []string{"orders", "billing"}, claims.Audience)
+
+	other, err := authtoken.NewVerifier(authtoken.WithSecret("secret"), authtoken.WithAudience("payments"))
+	require.NoError(t, err)
+	_, err = other.Verify(context.Background(), accessToken)
+	assert.ErrorIs(t, err, authtoken.ErrInvalidToken)
+
+	_, err = tokens.ParseAccessToken(accessToken, "secret")
+	assert.NoError(t, err)
+}
+
+// Проверка HMAC-хеша refresh-токена и совместимости с хешами bcrypt.
+func TestCompareRefreshToken(t *testing.T) {
+	refreshToken, hash, err := tokens.GenerateRefreshTokenAndHash("secret")
+	assert.NoError(t, err)
+	assert.Equal(t, tokens.HashRefreshToken(refreshToken, "secret"), hash)
+	assert.False(t, tokens.IsLegacyHash(hash))
+
+	assert.NoError(t, tokens.CompareRefreshToken(hash, refreshToken, "secret"))
+	assert.ErrorIs(t, tokens.CompareRefreshToken(hash, "other", "secret"), tokens.ErrRefreshTokenMismatch)
+	assert.ErrorIs(t, tokens.CompareRefreshToken(hash, refreshToken, "other-secret"), tokens.ErrRefreshTokenMismatch)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte(refreshToken), bcrypt.MinCost)
+	assert.NoError(t, err)
+	assert.True(t, tokens.IsLegacyHash(string(legacy)))
+	assert.NoError(t, tokens.CompareRefreshToken(string(legacy), refreshToken, "secret"))
+	assert.ErrorIs(t, tokens.CompareRefreshToken(string(legacy), "other", "secret"), tokens.ErrRefreshTokenMismatch)
+}
+
+func BenchmarkGenerateAccessToken(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := tokens.GenerateAccessToken("123e4567-e89b-12d3-a456-426614174000", "127.0.0.1", "secret", "hash", "", 0, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkValidateAccessToken(b *testing.B) {
+	accessToken, err := tokens.GenerateAccessToken("123e4567-e89b-12d3-a456-426614174000", "127.0.0.1", "secret", "hash", "", 0, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tokens.ValidateAccessToken(accessToken, "secret"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateRefreshTokenAndHash(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := tokens.GenerateRefreshTokenAndHash("secret"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Фиксирует число выделений памяти на горячем пути, чтобы оптимизации не потерялись.
+func TestAllocations(t *testing.T) {
+	accessToken, err := tokens.GenerateAccessToken("123e4567-e89b-12d3-a456-426614174000", "127.0.0.1", "secret", "hash", "", 0, nil)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		max  float64
+		fn   func()
+	}{
+		{name: "GenerateAccessToken", max: 40, fn: func() {
+			_, _ = tokens.GenerateAccessToken("123e4567-e89b-12d3-a456-426614174000", "127.0.0.1", "secret", "hash", "", 0, nil)
+		}},
+		{name: "ValidateAccessToken", max: 40, fn: func() {
+			_, _ = tokens.ValidateAccessToken(accessToken, "secret")
+		}},
+		{name: "GenerateRefreshTokenAndHash", max: 12, fn: func() {
+			_, _, _ = tokens.GenerateRefreshTokenAndHash("secret")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.LessOrEqual(t, testing.AllocsPerRun(100, tt.fn), tt.max)
+		})
+	}
+}
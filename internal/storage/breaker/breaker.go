@@ -0,0 +1,135 @@
+package breaker
+
+import (
+	"auth_service/internal/storage"
+	"auth_service/lib/clock"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Состояния автомата.
+const (
+	stateClosed = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// Ошибка, возвращаемая без обращения к хранилищу, пока автомат разомкнут.
+type OpenError struct {
+	// Через сколько имеет смысл повторить запрос.
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open, retry after %s", e.RetryAfter)
+}
+
+// Позволяет проверять ошибку через errors.Is(err, storage.ErrUnavailable).
+func (e *OpenError) Unwrap() error {
+	return storage.ErrUnavailable
+}
+
+// Автоматический выключатель (circuit breaker) для обращений к хранилищу.
+//
+// После threshold последовательных ошибок размыкается и в течение openTimeout
+// сразу возвращает OpenError. По истечении таймаута пропускает один пробный
+// запрос: успех замыкает автомат, ошибка снова размыкает его.
+type Breaker struct {
+	mu          sync.Mutex
+	state       int
+	failures    int
+	openedAt    time.Time
+	threshold   int
+	openTimeout time.Duration
+	clock       clock.Clock
+}
+
+// Создаёт новый автоматический выключатель.
+//
+// Принимает:
+// - threshold: количество последовательных ошибок, после которого автомат размыкается.
+// - openTimeout: время, в течение которого автомат остаётся разомкнутым.
+//
+// Возвращает:
+// - указатель на Breaker.
+func New(threshold int, openTimeout time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &Breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		clock:       clock.Real{},
+	}
+}
+
+// Устанавливает источник времени (для тестов).
+func (b *Breaker) WithClock(c clock.Clock) *Breaker {
+	b.clock = c
+	return b
+}
+
+// Выполняет fn, если автомат это разрешает, и учитывает результат.
+//
+// Ошибки storage.ErrNotFound и storage.ErrExpired не считаются сбоем хранилища.
+//
+// Принимает:
+// - fn: операция с хранилищем.
+//
+// Возвращает:
+// - *OpenError, если автомат разомкнут.
+// - ошибку, возвращённую fn.
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := fn()
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrExpired) {
+		b.onFailure()
+	} else {
+		b.onSuccess()
+	}
+	return err
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		elapsed := b.clock.Now().Sub(b.openedAt)
+		if elapsed < b.openTimeout {
+			return &OpenError{RetryAfter: b.openTimeout - elapsed}
+		}
+		b.state = stateHalfOpen
+		return nil
+	case stateHalfOpen:
+		// Пробный запрос уже выполняется, остальные отклоняются.
+		return &OpenError{RetryAfter: b.openTimeout}
+	}
+	return nil
+}
+
+func (b *Breaker) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = stateClosed
+	b.failures = 0
+}
+
+func (b *Breaker) onFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.state = stateOpen
+		b.openedAt = b.clock.Now()
+		b.failures = 0
+	}
+}
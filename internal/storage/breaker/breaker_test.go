@@ -0,0 +1,59 @@
+package breaker
+
+import (
+	"auth_service/internal/storage"
+	"auth_service/lib/clock"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Проверка размыкания после серии ошибок и восстановления после таймаута.
+func TestBreaker_OpensAndRecovers(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	b := New(2, 10*time.Second).WithClock(clk)
+
+	dbErr := errors.New("connection refused")
+	calls := 0
+	failing := func() error { calls++; return dbErr }
+
+	assert.ErrorIs(t, b.Do(failing), dbErr)
+	assert.ErrorIs(t, b.Do(failing), dbErr)
+
+	// Автомат разомкнут: обращения к хранилищу не происходит.
+	err := b.Do(failing)
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+	var openErr *OpenError
+	assert.True(t, errors.As(err, &openErr))
+	assert.Equal(t, 10*time.Second, openErr.RetryAfter)
+	assert.Equal(t, 2, calls)
+
+	// После таймаута пробный запрос успешен и автомат замыкается.
+	clk.Advance(11 * time.Second)
+	assert.NoError(t, b.Do(func() error { return nil }))
+	assert.NoError(t, b.Do(func() error { return nil }))
+}
+
+// Проверка того, что ErrNotFound не считается сбоем хранилища.
+func TestBreaker_IgnoresNotFound(t *testing.T) {
+	b := New(1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, b.Do(func() error { return storage.ErrNotFound }), storage.ErrNotFound)
+	}
+}
+
+// Проверка повторного размыкания при неудачном пробном запросе.
+func TestBreaker_HalfOpenFailure(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	b := New(1, time.Second).WithClock(clk)
+
+	dbErr := errors.New("timeout")
+	assert.ErrorIs(t, b.Do(func() error { return dbErr }), dbErr)
+
+	clk.Advance(2 * time.Second)
+	assert.ErrorIs(t, b.Do(func() error { return dbErr }), dbErr)
+	assert.ErrorIs(t, b.Do(func() error { return nil }), storage.ErrUnavailable)
+}
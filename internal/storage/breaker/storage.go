@@ -0,0 +1,166 @@
+package breaker
+
+import (
+	"auth_service/internal/storage"
+	"context"
+	"time"
+)
+
+// Хранилище, защищённое автоматическим выключателем.
+type Storage struct {
+	next    storage.Storage
+	breaker *Breaker
+}
+
+// Оборачивает хранилище автоматическим выключателем.
+//
+// Принимает:
+// - next: исходное хранилище.
+// - b: автоматический выключатель.
+//
+// Возвращает:
+// - экземпляр Storage, реализующий storage.Storage.
+func Wrap(next storage.Storage, b *Breaker) *Storage {
+	return &Storage{next: next, breaker: b}
+}
+
+// Возвращает хранилище с тем же выключателем, запросы исходного хранилища
+// которого выполняются в контексте ctx (см. storage.ContextBinder).
+func (s *Storage) WithContext(ctx context.Context) storage.Storage {
+	return &Storage{next: storage.WithContext(s.next, ctx), breaker: s.breaker}
+}
+
+func (s *Storage) SaveRefreshToken(userID, hashedToken, clientIP string, expiresAt time.Time) (string, error) {
+	var sessionID string
+	err := s.breaker.Do(func() (err error) {
+		sessionID, err = s.next.SaveRefreshToken(userID, hashedToken, clientIP, expiresAt)
+		return err
+	})
+	return sessionID, err
+}
+
+func (s *Storage) GetRefreshToken(userID string) (string, error) {
+	var hashedToken string
+	err := s.breaker.Do(func() (err error) {
+		hashedToken, err = s.next.GetRefreshToken(userID)
+		return err
+	})
+	return hashedToken, err
+}
+
+func (s *Storage) UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time) error {
+	return s.breaker.Do(func() error {
+		return s.next.UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP, expiresAt)
+	})
+}
+
+func (s *Storage) GetLastIP(userID string) (string, error) {
+	var clientIP string
+	err := s.breaker.Do(func() (err error) {
+		clientIP, err = s.next.GetLastIP(userID)
+		return err
+	})
+	return clientIP, err
+}
+
+func (s *Storage) GetUserEmail(userID string) (string, error) {
+	var email string
+	err := s.breaker.Do(func() (err error) {
+		email, err = s.next.GetUserEmail(userID)
+		return err
+	})
+	return email, err
+}
+
+func (s *Storage) GetUserCredentials(email string) (string, string, error) {
+	var userID, passwordHash string
+	err := s.breaker.Do(func() (err error) {
+		userID, passwordHash, err = s.next.GetUserCredentials(email)
+		return err
+	})
+	return userID, passwordHash, err
+}
+
+func (s *Storage) GetUserLocale(userID string) (string, error) {
+	var locale string
+	err := s.breaker.Do(func() (err error) {
+		locale, err = s.next.GetUserLocale(userID)
+		return err
+	})
+	return locale, err
+}
+
+func (s *Storage) DeleteRefreshToken(userID string) error {
+	return s.breaker.Do(func() error {
+		return s.next.DeleteRefreshToken(userID)
+	})
+}
+
+func (s *Storage) GetTokenVersion(userID string) (int64, error) {
+	var version int64
+	err := s.breaker.Do(func() (err error) {
+		version, err = s.next.GetTokenVersion(userID)
+		return err
+	})
+	return version, err
+}
+
+func (s *Storage) BumpTokenVersion(userID string) (int64, error) {
+	var version int64
+	err := s.breaker.Do(func() (err error) {
+		version, err = s.next.BumpTokenVersion(userID)
+		return err
+	})
+	return version, err
+}
+
+func (s *Storage) GetSessionByRefreshHash(refreshHash string) (storage.Session, error) {
+	var session storage.Session
+	err := s.breaker.Do(func() (err error) {
+		session, err = s.next.GetSessionByRefreshHash(refreshHash)
+		return err
+	})
+	return session, err
+}
+
+func (s *Storage) ListSessions(userID string) ([]storage.Session, error) {
+	var sessions []storage.Session
+	err := s.breaker.Do(func() (err error) {
+		sessions, err = s.next.ListSessions(userID)
+		return err
+	})
+	return sessions, err
+}
+
+func (s *Storage) DeleteSession(sessionID string) error {
+	return s.breaker.Do(func() error {
+		return s.next.DeleteSession(sessionID)
+	})
+}
+
+func (s *Storage) DeleteUserSession(userID, sessionID string) error {
+	return s.breaker.Do(func() error {
+		return s.next.DeleteUserSession(userID, sessionID)
+	})
+}
+
+func (s *Storage) SetSessionDevice(sessionID string, device storage.Device) error {
+	return s.breaker.Do(func() error {
+		return s.next.SetSessionDevice(sessionID, device)
+	})
+}
+
+func (s *Storage) DenyAccessToken(key string, expiresAt time.Time) error {
+	return s.breaker.Do(func() error {
+		return s.next.DenyAccessToken(key, expiresAt)
+	})
+}
+
+func (s *Storage) IsAccessTokenDenied(keys ...string) (bool, error) {
+	var denied bool
+	err := s.breaker.Do(func() (err error) {
+		denied, err = s.next.IsAccessTokenDenied(keys...)
+		return err
+	})
+	return denied, err
+}
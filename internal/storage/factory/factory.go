@@ -0,0 +1,213 @@
+package factory
+
+import (
+	"auth_service/internal/config"
+	"auth_service/internal/database"
+	"auth_service/internal/pwned"
+	"auth_service/internal/services/tokens"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/breaker"
+	"auth_service/internal/storage/fieldcrypt"
+	"auth_service/internal/storage/memory"
+	"auth_service/internal/storage/postgres"
+	redisstorage "auth_service/internal/storage/redis"
+	"auth_service/internal/storage/retry"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Поддерживаемые драйверы хранилища.
+const (
+	DriverPostgres = "postgres"
+	DriverRedis    = "redis"
+	DriverMemory   = "memory"
+	DriverSQLite   = "sqlite"
+	DriverMySQL    = "mysql"
+)
+
+// Драйвер известен, но его реализация в сборке отсутствует.
+var ErrDriverNotImplemented = errors.New("storage driver is not implemented")
+
+// Сконструированное хранилище вместе с ресурсами, которыми оно владеет.
+type Backend struct {
+	Storage storage.Storage
+	// Очистка устаревших данных; обращается к хранилищу в обход автоматического выключателя.
+	Cleaner storage.Cleaner
+	// Подсчёт сессий для квот; nil, если драйвер его не поддерживает.
+	Sessions storage.SessionCounter
+	// Поиск сессий для массового отзыва; nil, если драйвер его не поддерживает.
+	Finder storage.SessionFinder
+	// Рассылка уведомлений об отзыве access-токенов; nil, если драйвер не redis
+	// или рассылка выключена.
+	Revocations storage.RevocationPublisher
+	// Статистика использования; nil, если драйвер её не поддерживает.
+	Usage storage.UsageStats
+	// Суточные сводки; nil, если драйвер их не поддерживает.
+	Analytics storage.Analytics
+	// Очередь доставки webhook; nil, если драйвер её не поддерживает.
+	Webhooks storage.WebhookQueue
+	// Журнал аудита; nil, если драйвер его не поддерживает.
+	Audit storage.AuditLog
+	// Хранилище сертификатов ACME; nil, если драйвер его не поддерживает.
+	ACME storage.ACMECache
+	// Счётчики неудачных обновлений токенов; nil, если драйвер их не поддерживает.
+	RefreshFailures storage.RefreshFailureCounter
+	// Неудачные попытки входа; nil, если драйвер их не поддерживает.
+	LoginAttempts storage.LoginAttempts
+	// Отключение учётных записей; nil, если драйвер его не поддерживает.
+	Accounts storage.AccountStatus
+	// Смена паролей и её время; nil, если драйвер его не поддерживает.
+	Passwords storage.PasswordAge
+	// Outbox событий ротации токенов; nil, если драйвер его не поддерживает.
+	Outbox storage.Outbox
+	// Журнал действий; nil, если драйвер его не поддерживает.
+	AuditTrail storage.AuditTrail
+	// Перешифровка столбцов основным ключом; nil, если шифрование столбцов не включено.
+	Reencryptor Reencryptor
+	// Пул соединений с PostgreSQL; nil, если драйвер не postgres.
+	Pool *pgxpool.Pool
+	// Проверяет доступность базы данных; для memory всегда успешна.
+	Ping func(ctx context.Context) error
+	// Освобождает ресурсы хранилища (соединения с БД и т.п.).
+	Close func()
+}
+
+// Хранилище с перешифровкой столбцов (см. PostgresStorage.ReencryptColumns).
+type Reencryptor interface {
+	ReencryptColumns(limit int) (int64, error)
+}
+
+// Возвращает ключи шифрования столбцов из конфигурации.
+//
+// Принимает:
+// - cfg: указатель на конфигурацию приложения.
+//
+// Возвращает:
+// - набор ключей или nil, если шифрование столбцов не включено.
+// - ошибку, если ключи заданы некорректно.
+func Keyring(cfg *config.Config) (*fieldcrypt.Keyring, error) {
+	encryption := cfg.Storage.Encryption
+	if !encryption.Enabled {
+		return nil, nil
+	}
+	keyring, err := fieldcrypt.ParseKeyring(encryption.Keys, encryption.PrimaryKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage encryption configuration: %w", err)
+	}
+	return keyring, nil
+}
+
+// Создаёт хранилище по значению storage.driver из конфигурации.
+//
+// Если в конфигурации включён автоматический выключатель, хранилище
+// оборачивается им.
+//
+// Принимает:
+// - cfg: указатель на конфигурацию приложения.
+// - log: указатель на logger для логирования событий.
+//
+// Возвращает:
+// - указатель на Backend.
+// - ошибку, если драйвер неизвестен или подключение не удалось.
+func New(cfg *config.Config, log *slog.Logger) (*Backend, error) {
+	backend := &Backend{
+		Ping:  func(context.Context) error { return nil },
+		Close: func() {},
+	}
+
+	switch cfg.Storage.Driver {
+	case "", DriverPostgres:
+		pool, err := database.InitDB(cfg, log)
+		if err != nil {
+			return nil, err
+		}
+		keyring, err := Keyring(cfg)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		ps := postgres.NewPostgresStorage(pool).WithEncryption(keyring)
+		backend.Storage, backend.Cleaner, backend.Usage, backend.Analytics = ps, ps, ps, ps
+		backend.Sessions, backend.Finder, backend.Webhooks, backend.Audit = ps, ps, ps, ps
+		backend.ACME, backend.RefreshFailures, backend.LoginAttempts, backend.Accounts = ps, ps, ps, ps
+		backend.Passwords, backend.Outbox, backend.AuditTrail = ps, ps, ps
+		if keyring != nil {
+			backend.Reencryptor = ps
+		}
+		backend.Pool = pool
+		backend.Ping = pool.Ping
+		backend.Close = pool.Close
+	case DriverRedis:
+		client, err := database.InitRedis(cfg, log)
+		if err != nil {
+			return nil, err
+		}
+		rs := redisstorage.NewRedisStorage(client)
+		backend.Storage, backend.Cleaner = rs, rs
+		if cfg.Storage.Redis.PublishRevocations {
+			backend.Revocations = redisstorage.NewRevocationPublisher(client, cfg.Storage.Redis.RevocationChannel)
+		}
+		backend.Ping = func(ctx context.Context) error { return client.Ping(ctx).Err() }
+		backend.Close = func() { _ = client.Close() }
+	case DriverMemory:
+		log.Warn("Using in-memory storage, data will be lost on restart")
+		ms := memory.NewMemoryStorage()
+		for _, user := range cfg.Storage.Memory.Users {
+			ms.CreateUser(user.ID, user.Email)
+			if user.Password == "" {
+				continue
+			}
+			if err := pwned.Check(context.Background(), user.Password); err != nil {
+				return nil, fmt.Errorf("password of user %s is rejected: %w", user.ID, err)
+			}
+			passwordHash, err := tokens.HashPassword(user.Password)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash password of user %s: %w", user.ID, err)
+			}
+			if err := ms.SetPassword(user.ID, passwordHash); err != nil {
+				return nil, err
+			}
+		}
+		backend.Storage, backend.Cleaner, backend.Usage, backend.Analytics = ms, ms, ms, ms
+		backend.Sessions, backend.Finder, backend.Webhooks, backend.Audit = ms, ms, ms, ms
+		backend.ACME, backend.RefreshFailures, backend.LoginAttempts, backend.Accounts = ms, ms, ms, ms
+		backend.Passwords, backend.Outbox, backend.AuditTrail = ms, ms, ms
+	case DriverSQLite, DriverMySQL:
+		return nil, fmt.Errorf("%s: %w", cfg.Storage.Driver, ErrDriverNotImplemented)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.Storage.Driver)
+	}
+
+	if cfg.Storage.Encryption.Enabled && backend.Reencryptor == nil {
+		log.Warn("Storage encryption is supported by the postgres driver only, values are stored in plaintext")
+	}
+
+	// Повторы выполняются внутри выключателя: он учитывает только ошибки,
+	// оставшиеся после всех попыток.
+	if cfg.Storage.Retry.Enabled && backend.Pool != nil {
+		policy := retry.Policy{
+			MaxAttempts:    cfg.Storage.Retry.MaxAttempts,
+			InitialBackoff: cfg.Storage.Retry.InitialBackoff,
+			MaxBackoff:     cfg.Storage.Retry.MaxBackoff,
+		}
+		if err := policy.Validate(); err != nil {
+			backend.Close()
+			return nil, fmt.Errorf("invalid storage retry configuration: %w", err)
+		}
+		backend.Storage = retry.Wrap(backend.Storage, retry.New(policy, postgres.IsRetryable))
+	}
+
+	if cfg.Storage.CircuitBreaker.Enabled {
+		backend.Storage = breaker.Wrap(backend.Storage, breaker.New(
+			cfg.Storage.CircuitBreaker.FailureThreshold,
+			cfg.Storage.CircuitBreaker.OpenTimeout,
+		))
+	}
+
+	log.Info("Storage initialized", slog.String("driver", cfg.Storage.Driver))
+	return backend, nil
+}
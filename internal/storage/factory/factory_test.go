@@ -0,0 +1,32 @@
+package factory_test
+
+import (
+	"auth_service/internal/config"
+	"auth_service/internal/storage/factory"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Проверка выбора драйвера хранилища по конфигурации.
+func TestNew_DriverSelection(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cfg := &config.Config{}
+	cfg.Storage.Driver = factory.DriverMemory
+	backend, err := factory.New(cfg, logger)
+	assert.NoError(t, err)
+	assert.NotNil(t, backend.Storage)
+	assert.Nil(t, backend.Pool)
+	backend.Close()
+
+	cfg.Storage.Driver = factory.DriverSQLite
+	_, err = factory.New(cfg, logger)
+	assert.ErrorIs(t, err, factory.ErrDriverNotImplemented)
+
+	cfg.Storage.Driver = "cassandra"
+	_, err = factory.New(cfg, logger)
+	assert.Error(t, err)
+}
@@ -0,0 +1,257 @@
+// Пакет fieldcrypt шифрует отдельные значения столбцов базы данных на стороне
+// приложения (AES-256-GCM) с поддержкой ротации ключей.
+//
+// Зашифрованное значение хранится как enc:v1:<id ключа>:<base64url(nonce|шифртекст)>.
+// Имя столбца участвует в шифровании как дополнительные данные, поэтому
+// значение нельзя перенести в другой столбец. Значения без префикса enc:
+// считаются записанными до включения шифрования и возвращаются как есть.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Размер ключа AES-256 в байтах.
+const KeySize = 32
+
+const prefix = "enc:v1:"
+
+// Значение зашифровано ключом, которого нет в наборе.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Ключ набора.
+type key struct {
+	aead cipher.AEAD
+	// Ключ для вычисления nonce детерминированного шифрования.
+	nonceKey []byte
+}
+
+// Набор ключей шифрования.
+//
+// Новые значения шифруются основным ключом; расшифровываются значения,
+// зашифрованные любым ключом набора, поэтому при ротации новый ключ
+// становится основным, а прежний остаётся в наборе, пока все значения не
+// будут перешифрованы. Nil-указатель означает, что шифрование отключено:
+// значения записываются и читаются без изменений.
+type Keyring struct {
+	primary string
+	keys    map[string]key
+}
+
+// Создаёт набор ключей.
+//
+// Принимает:
+// - keys: ключи длиной KeySize байт по идентификаторам (латинские буквы, цифры, - и _).
+// - primary: идентификатор ключа, которым шифруются новые значения.
+//
+// Возвращает:
+// - указатель на Keyring.
+// - ошибку, если ключ имеет неверную длину, идентификатор некорректен или
+// основного ключа нет в наборе.
+func NewKeyring(keys map[string][]byte, primary string) (*Keyring, error) {
+	k := &Keyring{primary: primary, keys: make(map[string]key, len(keys))}
+	for id, secret := range keys {
+		if !validID(id) {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		if len(secret) != KeySize {
+			return nil, fmt.Errorf("encryption key %s must be %d bytes, got %d", id, KeySize, len(secret))
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCM: %w", err)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte("fieldcrypt nonce key"))
+		k.keys[id] = key{aead: aead, nonceKey: mac.Sum(nil)}
+	}
+	if _, ok := k.keys[primary]; !ok {
+		return nil, fmt.Errorf("primary encryption key %q is not configured", primary)
+	}
+	return k, nil
+}
+
+// Декодирует ключи из base64 и создаёт набор (см. NewKeyring).
+//
+// Принимает:
+// - encoded: ключи в base64 (стандартный или URL-алфавит) по идентификаторам.
+// - primary: идентификатор основного ключа.
+//
+// Возвращает:
+// - указатель на Keyring.
+// - ошибку, если ключ не является base64 или набор некорректен.
+func ParseKeyring(encoded map[string]string, primary string) (*Keyring, error) {
+	keys := make(map[string][]byte, len(encoded))
+	for id, value := range encoded {
+		secret, err := decodeKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		keys[id] = secret
+	}
+	return NewKeyring(keys, primary)
+}
+
+// Шифрует значение основным ключом со случайным nonce.
+//
+// Принимает:
+// - column: имя столбца (например, tokens.ip_address).
+// - plaintext: значение.
+//
+// Возвращает:
+// - зашифрованное значение (plaintext, если набор не задан).
+// - ошибку, если не удалось получить случайный nonce.
+func (k *Keyring) Encrypt(column, plaintext string) (string, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+	nonce := make([]byte, k.keys[k.primary].aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return k.seal(k.primary, column, plaintext, nonce), nil
+}
+
+// Шифрует значение основным ключом с nonce, вычисленным из значения.
+//
+// Одинаковые значения дают одинаковый результат, поэтому по столбцу можно
+// искать на равенство и поддерживать ограничение UNIQUE; ценой этого
+// раскрывается, какие значения совпадают. Подходит для идентифицирующих
+// значений вроде email.
+//
+// Принимает:
+// - column: имя столбца.
+// - plaintext: значение.
+//
+// Возвращает:
+// - зашифрованное значение (plaintext, если набор не задан).
+func (k *Keyring) EncryptDeterministic(column, plaintext string) string {
+	if k == nil {
+		return plaintext
+	}
+	return k.deterministic(k.primary, column, plaintext)
+}
+
+// Возвращает все формы, в которых значение могло быть записано
+// EncryptDeterministic: открытую (до включения шифрования) и зашифрованные
+// каждым ключом набора (до перешифровки основным ключом). Используется для
+// поиска по столбцу на равенство во время ротации ключей.
+//
+// Принимает:
+// - column: имя столбца.
+// - plaintext: значение.
+//
+// Возвращает:
+// - формы значения; первая — открытая.
+func (k *Keyring) DeterministicCandidates(column, plaintext string) []string {
+	candidates := []string{plaintext}
+	if k == nil {
+		return candidates
+	}
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		candidates = append(candidates, k.deterministic(id, column, plaintext))
+	}
+	return candidates
+}
+
+// Шифрует значение ключом id с nonce, вычисленным из значения.
+func (k *Keyring) deterministic(id, column, plaintext string) string {
+	key := k.keys[id]
+	mac := hmac.New(sha256.New, key.nonceKey)
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(plaintext))
+	return k.seal(id, column, plaintext, mac.Sum(nil)[:key.aead.NonceSize()])
+}
+
+// Шифрует значение ключом id с заданным nonce.
+func (k *Keyring) seal(id, column, plaintext string, nonce []byte) string {
+	sealed := k.keys[id].aead.Seal(nonce, nonce, []byte(plaintext), []byte(column))
+	return prefix + id + ":" + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+// Расшифровывает значение.
+//
+// Принимает:
+// - column: имя столбца, для которого значение было зашифровано.
+// - value: значение из базы данных.
+//
+// Возвращает:
+// - расшифрованное значение; значение без префикса enc: возвращается как есть.
+// - ErrUnknownKey, если ключа значения нет в наборе (или набор не задан).
+// - ошибку, если значение повреждено или относится к другому столбцу.
+func (k *Keyring) Decrypt(column, value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	if k == nil {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	key, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < key.aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+	plaintext, err := key.aead.Open(nil, nonce, ciphertext, []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Возвращает префикс значений, зашифрованных основным ключом; значения без
+// него нужно перешифровать.
+func (k *Keyring) CurrentPrefix() string {
+	return prefix + k.primary + ":"
+}
+
+// Сообщает, является ли строка допустимым идентификатором ключа.
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Декодирует ключ из base64 (стандартный или URL-алфавит).
+func decodeKey(encoded string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := encoding.DecodeString(encoded); err == nil {
+			return key, nil
+		}
+	}
+	return nil, errors.New("encryption key is not valid base64")
+}
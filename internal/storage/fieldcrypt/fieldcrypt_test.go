@@ -0,0 +1,133 @@
+package fieldcrypt_test
+
+import (
+	"auth_service/internal/storage/fieldcrypt"
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, fieldcrypt.KeySize)
+	newKey = bytes.Repeat([]byte{2}, fieldcrypt.KeySize)
+)
+
+// Проверка шифрования и расшифровки значений.
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	keyring, err := fieldcrypt.NewKeyring(map[string][]byte{"k1": oldKey}, "k1")
+	require.NoError(t, err)
+
+	encrypted, err := keyring.Encrypt("tokens.ip_address", "203.0.113.7")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, keyring.CurrentPrefix()))
+	assert.NotContains(t, encrypted, "203.0.113.7")
+
+	again, err := keyring.Encrypt("tokens.ip_address", "203.0.113.7")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again, "random nonce")
+
+	plaintext, err := keyring.Decrypt("tokens.ip_address", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.7", plaintext)
+
+	// Значение привязано к столбцу.
+	_, err = keyring.Decrypt("users.email", encrypted)
+	assert.Error(t, err)
+
+	// Значения, записанные до включения шифрования, читаются как есть.
+	plaintext, err = keyring.Decrypt("tokens.ip_address", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", plaintext)
+
+	_, err = keyring.Decrypt("tokens.ip_address", encrypted[:len(encrypted)-2])
+	assert.Error(t, err, "truncated value")
+}
+
+// Проверка детерминированного шифрования.
+func TestKeyring_EncryptDeterministic(t *testing.T) {
+	keyring, err := fieldcrypt.NewKeyring(map[string][]byte{"k1": oldKey}, "k1")
+	require.NoError(t, err)
+
+	a := keyring.EncryptDeterministic("users.email", "user@example.com")
+	assert.Equal(t, a, keyring.EncryptDeterministic("users.email", "user@example.com"))
+	assert.NotEqual(t, a, keyring.EncryptDeterministic("users.email", "other@example.com"))
+
+	plaintext, err := keyring.Decrypt("users.email", a)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", plaintext)
+}
+
+// Проверка ротации: значения прежнего ключа читаются после смены основного.
+func TestKeyring_Rotation(t *testing.T) {
+	old, err := fieldcrypt.NewKeyring(map[string][]byte{"k1": oldKey}, "k1")
+	require.NoError(t, err)
+	encrypted, err := old.Encrypt("tokens.ip_address", "203.0.113.7")
+	require.NoError(t, err)
+
+	rotated, err := fieldcrypt.NewKeyring(map[string][]byte{"k1": oldKey, "k2": newKey}, "k2")
+	require.NoError(t, err)
+	plaintext, err := rotated.Decrypt("tokens.ip_address", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.7", plaintext)
+	assert.False(t, strings.HasPrefix(encrypted, rotated.CurrentPrefix()), "needs re-encryption")
+
+	// Без прежнего ключа значение не расшифровать.
+	withoutOld, err := fieldcrypt.NewKeyring(map[string][]byte{"k2": newKey}, "k2")
+	require.NoError(t, err)
+	_, err = withoutOld.Decrypt("tokens.ip_address", encrypted)
+	assert.ErrorIs(t, err, fieldcrypt.ErrUnknownKey)
+}
+
+// Проверка поиска по значениям, зашифрованным прежним ключом и записанным открыто.
+func TestKeyring_DeterministicCandidates(t *testing.T) {
+	old, err := fieldcrypt.NewKeyring(map[string][]byte{"k1": oldKey}, "k1")
+	require.NoError(t, err)
+	rotated, err := fieldcrypt.NewKeyring(map[string][]byte{"k1": oldKey, "k2": newKey}, "k2")
+	require.NoError(t, err)
+
+	candidates := rotated.DeterministicCandidates("users.email", "user@example.com")
+	assert.Equal(t, "user@example.com", candidates[0])
+	assert.Contains(t, candidates, old.EncryptDeterministic("users.email", "user@example.com"))
+	assert.Contains(t, candidates, rotated.EncryptDeterministic("users.email", "user@example.com"))
+	assert.Len(t, candidates, 3)
+
+	var disabled *fieldcrypt.Keyring
+	assert.Equal(t, []string{"user@example.com"}, disabled.DeterministicCandidates("users.email", "user@example.com"))
+}
+
+// Проверка набора без ключей (шифрование отключено).
+func TestKeyring_Nil(t *testing.T) {
+	var keyring *fieldcrypt.Keyring
+
+	value, err := keyring.Encrypt("tokens.ip_address", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", value)
+	assert.Equal(t, "user@example.com", keyring.EncryptDeterministic("users.email", "user@example.com"))
+
+	value, err = keyring.Decrypt("tokens.ip_address", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", value)
+	_, err = keyring.Decrypt("tokens.ip_address", "enc:v1:k1:AAAA")
+	assert.ErrorIs(t, err, fieldcrypt.ErrUnknownKey)
+}
+
+// Проверка разбора ключей из конфигурации.
+func TestParseKeyring(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(oldKey)
+
+	_, err := fieldcrypt.ParseKeyring(map[string]string{"k1": encoded}, "k1")
+	assert.NoError(t, err)
+
+	_, err = fieldcrypt.ParseKeyring(map[string]string{"k1": encoded}, "k2")
+	assert.Error(t, err, "missing primary key")
+	_, err = fieldcrypt.ParseKeyring(map[string]string{"k1": "short"}, "k1")
+	assert.Error(t, err, "short key")
+	_, err = fieldcrypt.ParseKeyring(map[string]string{"k:1": encoded}, "k:1")
+	assert.Error(t, err, "invalid id")
+	_, err = fieldcrypt.ParseKeyring(map[string]string{"k1": "***"}, "k1")
+	assert.Error(t, err, "invalid base64")
+}
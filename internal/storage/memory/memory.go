@@ -0,0 +1,1545 @@
+package memory
+
+import (
+	"auth_service/internal/storage"
+	"auth_service/lib/clock"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type session struct {
+	userID           string
+	refreshTokenHash string
+	ipAddress        string
+	createdAt        time.Time
+	lastUsedAt       time.Time
+	expiresAt        time.Time
+	device           storage.Device
+}
+
+// Неудачные попытки обновления токенов пользователя.
+type refreshFailures struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+func (s session) toStorage(sessionID string) storage.Session {
+	return storage.Session{
+		ID:               sessionID,
+		UserID:           s.userID,
+		RefreshTokenHash: s.refreshTokenHash,
+		ClientIP:         s.ipAddress,
+		CreatedAt:        s.createdAt,
+		LastUsedAt:       s.lastUsedAt,
+		ExpiresAt:        s.expiresAt,
+		Device:           s.device,
+	}
+}
+
+// Хранилище в памяти процесса.
+//
+// Предназначено для локальной разработки и тестов: данные не переживают
+// перезапуск сервиса. Безопасно для конкурентного использования.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	users map[string]string
+	// Время регистрации пользователей.
+	registered map[string]time.Time
+	// Предпочитаемые языки пользователей.
+	locales map[string]string
+	// bcrypt-хеши паролей пользователей.
+	passwords map[string]string
+	// Время последней смены паролей.
+	passwordChangedAt map[string]time.Time
+	// Версии токенов пользователей.
+	tokenVersions map[string]int64
+	// Время отключения учётных записей.
+	disabled map[string]time.Time
+	// Сессии по идентификатору.
+	sessions map[string]session
+	// Индекс хеша refresh-токена на идентификатор сессии.
+	hashes map[string]string
+	// Список отзыва access-токенов: ключ и срок хранения.
+	denied map[string]time.Time
+	// Суточная статистика запросов (Count хранится в значении).
+	usage map[storage.UsageRow]int64
+	// Суточные сводки по началу суток.
+	dailyStats map[time.Time]storage.DailyStats
+	// Доставки webhook по идентификатору, включая недоставленные.
+	webhooks map[string]storage.WebhookDelivery
+	// Журнал аудита в порядке записи и номер последней записи.
+	audit    []storage.AuditEvent
+	auditSeq int64
+	// Позиции выгрузки журнала аудита по именам выгрузок.
+	auditCheckpoints map[string]int64
+	// Неудачные попытки обновления токенов по идентификатору пользователя.
+	refreshFailures map[string]refreshFailures
+	// Неудачные попытки входа по ключу.
+	loginAttempts map[string]storage.LoginAttempt
+	// Данные ACME по ключам.
+	acme map[string][]byte
+	// События outbox по идентификатору.
+	outbox map[string]storage.OutboxEvent
+	// Журнал действий в порядке записи.
+	auditTrail []storage.AuditRecord
+	clock      clock.Clock
+}
+
+// Создаёт новый пустой экземпляр MemoryStorage.
+//
+// Возвращает:
+// - экземпляр MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		users:      make(map[string]string),
+		registered: make(map[string]time.Time),
+		locales:    make(map[string]string),
+		passwords:  make(map[string]string),
+		sessions:   make(map[string]session),
+		hashes:     make(map[string]string),
+		denied:     make(map[string]time.Time),
+		usage:      make(map[storage.UsageRow]int64),
+		dailyStats: make(map[time.Time]storage.DailyStats),
+		webhooks:   make(map[string]storage.WebhookDelivery),
+		clock:      clock.Real{},
+
+		auditCheckpoints: make(map[string]int64),
+		tokenVersions:    make(map[string]int64),
+		acme:             make(map[string][]byte),
+		refreshFailures:  make(map[string]refreshFailures),
+		loginAttempts:    make(map[string]storage.LoginAttempt),
+		disabled:         make(map[string]time.Time),
+
+		passwordChangedAt: make(map[string]time.Time),
+
+		outbox: make(map[string]storage.OutboxEvent),
+	}
+}
+
+// Устанавливает источник времени (для тестов).
+func (ms *MemoryStorage) WithClock(c clock.Clock) *MemoryStorage {
+	ms.clock = c
+	return ms
+}
+
+// Добавляет пользователя в хранилище.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - email: email пользователя.
+func (ms *MemoryStorage) CreateUser(userID, email string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.users[userID] = email
+	ms.registered[userID] = ms.clock.Now()
+}
+
+// Устанавливает хеш пароля пользователя и отмечает время смены пароля.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - passwordHash: bcrypt-хеш пароля.
+//
+// Возвращает:
+// - ошибку, если пользователь не существует.
+func (ms *MemoryStorage) SetPassword(userID, passwordHash string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.users[userID]; !ok {
+		return fmt.Errorf("failed to set password: user %s: %w", userID, storage.ErrNotFound)
+	}
+	ms.passwords[userID] = passwordHash
+	ms.passwordChangedAt[userID] = ms.clock.Now().UTC()
+	return nil
+}
+
+// Возвращает время последней смены пароля пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - время смены; нулевое время, если пароль не задавался.
+// - ошибку, если пользователь не существует.
+func (ms *MemoryStorage) GetPasswordChangedAt(userID string) (time.Time, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if _, ok := ms.users[userID]; !ok {
+		return time.Time{}, fmt.Errorf("failed to get password change time: %w", storage.ErrNotFound)
+	}
+	return ms.passwordChangedAt[userID], nil
+}
+
+// Cохраняет refresh-токен и IP клиента, начиная новую сессию.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - hashedToken: хешированный refresh-токен.
+// - clientIP: IP-адрес клиента.
+// - expiresAt: срок действия сессии.
+//
+// Возвращает:
+// - идентификатор сессии.
+// - ошибку, если пользователь не существует.
+func (ms *MemoryStorage) SaveRefreshToken(userID, hashedToken, clientIP string, expiresAt time.Time) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.users[userID]; !ok {
+		return "", fmt.Errorf("failed to save refresh token: user %s: %w", userID, storage.ErrNotFound)
+	}
+	sessionID := uuid.NewString()
+	now := ms.clock.Now()
+	ms.setSession(sessionID, session{
+		userID:           userID,
+		refreshTokenHash: hashedToken,
+		ipAddress:        clientIP,
+		createdAt:        now,
+		lastUsedAt:       now,
+		expiresAt:        expiresAt,
+	})
+	return sessionID, nil
+}
+
+// Возвращает refresh-токен последней использованной сессии пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - строку (хешированный refresh-токен).
+// - ошибку, если действующих сессий нет.
+func (ms *MemoryStorage) GetRefreshToken(userID string) (string, error) {
+	s, err := ms.lastSession(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return s.RefreshTokenHash, nil
+}
+
+// Обновляет refresh-токен, IP клиента и срок действия существующей сессии.
+//
+// Принимает:
+// - sessionID: идентификатор сессии.
+// - oldHash: хеш ротируемого refresh-токена.
+// - hashedToken: новый хешированный refresh-токен.
+// - clientIP: новый IP-адрес клиента.
+// - expiresAt: новый срок действия сессии.
+//
+// Возвращает:
+// - ошибку, если сессия не найдена, её срок истёк или токен уже ротирован.
+func (ms *MemoryStorage) UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.updateRefreshToken(sessionID, oldHash, hashedToken, clientIP, expiresAt)
+}
+
+// Ротирует refresh-токен сессии; вызывается под ms.mu.
+func (ms *MemoryStorage) updateRefreshToken(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time) error {
+	s, ok := ms.sessions[sessionID]
+	if !ok || s.refreshTokenHash != oldHash || !ms.clock.Now().Before(s.expiresAt) {
+		return fmt.Errorf("failed to update refresh token: %w", storage.ErrNotFound)
+	}
+	s.refreshTokenHash = hashedToken
+	s.ipAddress = clientIP
+	s.lastUsedAt = ms.clock.Now()
+	s.expiresAt = expiresAt
+	ms.setSession(sessionID, s)
+	return nil
+}
+
+// Возвращает IP-адрес клиента последней использованной сессии пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - строку (IP-адрес клиента).
+// - ошибку, если действующих сессий нет.
+func (ms *MemoryStorage) GetLastIP(userID string) (string, error) {
+	s, err := ms.lastSession(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get last IP: %w", err)
+	}
+	return s.ClientIP, nil
+}
+
+// Возвращает email пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - строку (email пользователя).
+// - ошибку, если пользователь не найден.
+func (ms *MemoryStorage) GetUserEmail(userID string) (string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	email, ok := ms.users[userID]
+	if !ok {
+		return "", fmt.Errorf("failed to get user email: %w", storage.ErrNotFound)
+	}
+	return email, nil
+}
+
+// Возвращает идентификатор пользователя и хеш его пароля по email.
+//
+// Принимает:
+// - email: email пользователя.
+//
+// Возвращает:
+// - идентификатор пользователя.
+// - хеш пароля; пустая строка, если пароль не задан.
+// - ошибку, если пользователь не найден.
+func (ms *MemoryStorage) GetUserCredentials(email string) (string, string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	for userID, userEmail := range ms.users {
+		if userEmail == email {
+			return userID, ms.passwords[userID], nil
+		}
+	}
+	return "", "", fmt.Errorf("failed to get user credentials: %w", storage.ErrNotFound)
+}
+
+// Устанавливает предпочитаемый язык пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - locale: язык (например, ru); пустая строка — язык по умолчанию.
+func (ms *MemoryStorage) SetUserLocale(userID, locale string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.locales[userID] = locale
+}
+
+// Возвращает предпочитаемый язык пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - язык пользователя или пустую строку, если он не задан.
+// - ошибку, если пользователь не найден.
+func (ms *MemoryStorage) GetUserLocale(userID string) (string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if _, ok := ms.users[userID]; !ok {
+		return "", fmt.Errorf("failed to get user locale: %w", storage.ErrNotFound)
+	}
+	return ms.locales[userID], nil
+}
+
+// Возвращает версию токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - версию; 0, если она не повышалась.
+// - ошибку, если пользователь не существует.
+func (ms *MemoryStorage) GetTokenVersion(userID string) (int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if _, ok := ms.users[userID]; !ok {
+		return 0, fmt.Errorf("failed to get token version: %w", storage.ErrNotFound)
+	}
+	return ms.tokenVersions[userID], nil
+}
+
+// Повышает версию токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - новую версию.
+// - ошибку, если пользователь не существует.
+func (ms *MemoryStorage) BumpTokenVersion(userID string) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.users[userID]; !ok {
+		return 0, fmt.Errorf("failed to bump token version: %w", storage.ErrNotFound)
+	}
+	ms.tokenVersions[userID]++
+	return ms.tokenVersions[userID], nil
+}
+
+// Отключает или включает учётную запись пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - disabled: true — отключить, false — включить.
+//
+// Возвращает:
+// - ошибку, если пользователь не существует.
+func (ms *MemoryStorage) SetUserDisabled(userID string, disabled bool) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.users[userID]; !ok {
+		return fmt.Errorf("failed to set user disabled: %w", storage.ErrNotFound)
+	}
+	if !disabled {
+		delete(ms.disabled, userID)
+	} else if _, ok := ms.disabled[userID]; !ok {
+		ms.disabled[userID] = ms.clock.Now().UTC()
+	}
+	return nil
+}
+
+// Возвращает время отключения учётной записи пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - время отключения; нулевое время, если учётная запись включена.
+// - ошибку, если пользователь не существует.
+func (ms *MemoryStorage) GetUserDisabledAt(userID string) (time.Time, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if _, ok := ms.users[userID]; !ok {
+		return time.Time{}, fmt.Errorf("failed to get user disabled time: %w", storage.ErrNotFound)
+	}
+	return ms.disabled[userID], nil
+}
+
+// Удаляет все сессии пользователя (отзывает его refresh-токены).
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - ошибку, если сессий нет.
+func (ms *MemoryStorage) DeleteRefreshToken(userID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var deleted bool
+	for sessionID, s := range ms.sessions {
+		if s.userID == userID {
+			ms.deleteSession(sessionID)
+			deleted = true
+		}
+	}
+	if !deleted {
+		return fmt.Errorf("failed to delete refresh token: %w", storage.ErrNotFound)
+	}
+	return nil
+}
+
+// Возвращает сессию по хешу refresh-токена.
+//
+// Принимает:
+// - refreshHash: хеш refresh-токена.
+//
+// Возвращает:
+// - сессию.
+// - storage.ErrExpired, если срок сессии истёк.
+// - ошибку, если сессия не найдена.
+func (ms *MemoryStorage) GetSessionByRefreshHash(refreshHash string) (storage.Session, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	sessionID, ok := ms.hashes[refreshHash]
+	if !ok {
+		return storage.Session{}, fmt.Errorf("failed to get session by refresh hash: %w", storage.ErrNotFound)
+	}
+	s := ms.sessions[sessionID]
+	if !ms.clock.Now().Before(s.expiresAt) {
+		return storage.Session{}, fmt.Errorf("failed to get session by refresh hash: %w", storage.ErrExpired)
+	}
+	return s.toStorage(sessionID), nil
+}
+
+// Возвращает действующие сессии пользователя, начиная с последней использованной.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - сессии (пустой список, если их нет).
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) ListSessions(userID string) ([]storage.Session, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.activeSessions(userID), nil
+}
+
+// Возвращает действующие сессии всех пользователей, подходящие под условия.
+//
+// Принимает:
+// - filter: условия отбора.
+// - afterID: идентификатор последней сессии предыдущей страницы; пустая строка — с начала.
+// - limit: максимальное количество сессий.
+//
+// Возвращает:
+// - сессии, упорядоченные по идентификатору.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) FindSessions(filter storage.SessionFilter, afterID string, limit int) ([]storage.Session, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	now := ms.clock.Now()
+	sessions := []storage.Session{}
+	for sessionID, s := range ms.sessions {
+		switch {
+		case sessionID <= afterID, !now.Before(s.expiresAt):
+			continue
+		case len(filter.UserIDs) > 0 && !slices.Contains(filter.UserIDs, s.userID):
+			continue
+		case !filter.CreatedBefore.IsZero() && !s.createdAt.Before(filter.CreatedBefore):
+			continue
+		}
+		sessions = append(sessions, s.toStorage(sessionID))
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+	}
+	return sessions, nil
+}
+
+// Удаляет сессию.
+//
+// Принимает:
+// - sessionID: идентификатор сессии.
+//
+// Возвращает:
+// - ошибку, если сессия не найдена.
+func (ms *MemoryStorage) DeleteSession(sessionID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.sessions[sessionID]; !ok {
+		return fmt.Errorf("failed to delete session: %w", storage.ErrNotFound)
+	}
+	ms.deleteSession(sessionID)
+	return nil
+}
+
+// Удаляет сессию пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - sessionID: идентификатор сессии.
+//
+// Возвращает:
+// - storage.ErrNotFound, если сессии нет или она принадлежит другому пользователю.
+func (ms *MemoryStorage) DeleteUserSession(userID, sessionID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if s, ok := ms.sessions[sessionID]; !ok || s.userID != userID {
+		return fmt.Errorf("failed to delete session: %w", storage.ErrNotFound)
+	}
+	ms.deleteSession(sessionID)
+	return nil
+}
+
+// Сохраняет устройство сессии.
+//
+// Принимает:
+// - sessionID: идентификатор сессии.
+// - device: устройство клиента.
+//
+// Возвращает:
+// - ошибку, если сессия не найдена.
+func (ms *MemoryStorage) SetSessionDevice(sessionID string, device storage.Device) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	s, ok := ms.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("failed to set session device: %w", storage.ErrNotFound)
+	}
+	s.device = device
+	ms.sessions[sessionID] = s
+	return nil
+}
+
+// Заносит ключ отозванных access-токенов в список отзыва.
+//
+// Принимает:
+// - key: ключ (jti:<id> или sid:<id>).
+// - expiresAt: срок хранения; если ключ уже есть, сохраняется более поздний.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DenyAccessToken(key string, expiresAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if current, ok := ms.denied[key]; !ok || expiresAt.After(current) {
+		ms.denied[key] = expiresAt
+	}
+	return nil
+}
+
+// Сообщает, есть ли в списке отзыва хотя бы один из ключей с неистёкшим сроком.
+//
+// Принимает:
+// - keys: проверяемые ключи.
+//
+// Возвращает:
+// - true, если хотя бы один ключ отозван.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) IsAccessTokenDenied(keys ...string) (bool, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	now := ms.clock.Now()
+	for _, key := range keys {
+		if expiresAt, ok := ms.denied[key]; ok && now.Before(expiresAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Удаляет сессии, истёкшие более retention назад.
+//
+// Принимает:
+// - retention: время хранения истёкших сессий; 0 — удалять сразу после истечения.
+// - limit: максимальное количество удаляемых сессий за один вызов.
+//
+// Возвращает:
+// - количество удалённых сессий.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DeleteExpiredRefreshTokens(retention time.Duration, limit int) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var deleted int64
+	cutoff := ms.clock.Now().Add(-retention)
+	for sessionID, s := range ms.sessions {
+		if deleted >= int64(limit) {
+			break
+		}
+		if !cutoff.Before(s.expiresAt) {
+			ms.deleteSession(sessionID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Удаляет сессии, не использовавшиеся дольше idleTimeout.
+//
+// Принимает:
+// - idleTimeout: допустимое время неактивности.
+// - limit: максимальное количество удаляемых сессий за один вызов.
+//
+// Возвращает:
+// - количество удалённых сессий.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DeleteIdleRefreshTokens(idleTimeout time.Duration, limit int) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var deleted int64
+	idleSince := ms.clock.Now().Add(-idleTimeout)
+	for sessionID, s := range ms.sessions {
+		if deleted >= int64(limit) {
+			break
+		}
+		if s.lastUsedAt.Before(idleSince) {
+			ms.deleteSession(sessionID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Удаляет истёкшие записи списка отзыва access-токенов.
+//
+// Принимает:
+// - limit: максимальное количество удаляемых записей за один вызов.
+//
+// Возвращает:
+// - количество удалённых записей.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DeleteExpiredDeniedAccessTokens(limit int) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var deleted int64
+	now := ms.clock.Now()
+	for key, expiresAt := range ms.denied {
+		if deleted >= int64(limit) {
+			break
+		}
+		if !now.Before(expiresAt) {
+			delete(ms.denied, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Возвращает количество действующих сессий всех пользователей.
+//
+// Возвращает:
+// - количество сессий.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) CountSessions() (int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var count int64
+	now := ms.clock.Now()
+	for _, s := range ms.sessions {
+		if now.Before(s.expiresAt) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Прибавляет количества запросов к суточной статистике.
+//
+// Принимает:
+// - rows: количества по суткам, интерфейсу, операции и результату.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) AddUsage(rows []storage.UsageRow) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, row := range rows {
+		count := row.Count
+		row.Day, row.Count = usageDay(row.Day), 0
+		ms.usage[row] += count
+	}
+	return nil
+}
+
+// Возвращает суточную статистику запросов.
+//
+// Принимает:
+// - from: первые сутки периода.
+// - to: последние сутки периода (включительно).
+//
+// Возвращает:
+// - строки статистики, упорядоченные по дню, интерфейсу, операции и результату.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) ListUsage(from, to time.Time) ([]storage.UsageRow, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	from, to = usageDay(from), usageDay(to)
+	usage := []storage.UsageRow{}
+	for row, count := range ms.usage {
+		if row.Day.Before(from) || row.Day.After(to) {
+			continue
+		}
+		row.Count = count
+		usage = append(usage, row)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if !a.Day.Equal(b.Day) {
+			return a.Day.Before(b.Day)
+		}
+		if a.API != b.API {
+			return a.API < b.API
+		}
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		return a.Result < b.Result
+	})
+	return usage, nil
+}
+
+// Вычисляет и сохраняет сводку за сутки.
+//
+// Принимает:
+// - day: момент времени в пределах суток (UTC).
+//
+// Возвращает:
+// - сохранённую сводку.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) RollupDailyStats(day time.Time) (storage.DailyStats, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stats := storage.DailyStats{Day: usageDay(day)}
+	within := func(t time.Time) bool { return usageDay(t).Equal(stats.Day) }
+
+	active := make(map[string]struct{})
+	for _, s := range ms.sessions {
+		if within(s.lastUsedAt) || within(s.createdAt) {
+			active[s.userID] = struct{}{}
+		}
+	}
+	stats.ActiveUsers = int64(len(active))
+	for _, registeredAt := range ms.registered {
+		if within(registeredAt) {
+			stats.NewUsers++
+		}
+	}
+	for row, count := range ms.usage {
+		if !row.Day.Equal(stats.Day) {
+			continue
+		}
+		stats.Requests += count
+		switch row.Result {
+		case "rejected":
+			stats.RejectedRequests += count
+		case "error":
+			stats.FailedRequests += count
+		}
+	}
+
+	// Сессия, обновлённая позже, в подсчёт уже не попадает, поэтому
+	// сохраняется наибольшее число активных пользователей.
+	if previous, ok := ms.dailyStats[stats.Day]; ok && previous.ActiveUsers > stats.ActiveUsers {
+		stats.ActiveUsers = previous.ActiveUsers
+	}
+	ms.dailyStats[stats.Day] = stats
+	return stats, nil
+}
+
+// Возвращает суточные сводки.
+//
+// Принимает:
+// - from: первые сутки периода.
+// - to: последние сутки периода (включительно).
+//
+// Возвращает:
+// - сводки, упорядоченные по дню.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) ListDailyStats(from, to time.Time) ([]storage.DailyStats, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	from, to = usageDay(from), usageDay(to)
+	list := []storage.DailyStats{}
+	for day, stats := range ms.dailyStats {
+		if !day.Before(from) && !day.After(to) {
+			list = append(list, stats)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Day.Before(list[j].Day) })
+	return list, nil
+}
+
+// Сохраняет новую доставку webhook.
+//
+// Принимает:
+// - delivery: доставка; Status, LastError, CreatedAt и UpdatedAt устанавливаются хранилищем.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) EnqueueWebhook(delivery storage.WebhookDelivery) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.clock.Now()
+	delivery.Payload = append([]byte(nil), delivery.Payload...)
+	delivery.Status, delivery.LastError = storage.WebhookPending, ""
+	delivery.CreatedAt, delivery.UpdatedAt = now, now
+	ms.webhooks[delivery.ID] = delivery
+	return nil
+}
+
+// Возвращает ожидающие доставки webhook, время попытки которых наступило.
+//
+// Принимает:
+// - now: текущее время.
+// - limit: максимальное количество доставок.
+//
+// Возвращает:
+// - доставки, начиная с самых ранних.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DueWebhooks(now time.Time, limit int) ([]storage.WebhookDelivery, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	due := []storage.WebhookDelivery{}
+	for _, d := range ms.webhooks {
+		if d.Status == storage.WebhookPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Отмечает доставку webhook выполненной.
+//
+// Принимает:
+// - id: идентификатор доставки.
+// - attempts: количество выполненных попыток.
+//
+// Возвращает:
+// - ошибку storage.ErrNotFound, если доставка не найдена.
+func (ms *MemoryStorage) MarkWebhookDelivered(id string, attempts int) error {
+	return ms.updateWebhook(id, "failed to mark webhook delivered", func(d *storage.WebhookDelivery) {
+		d.Status, d.Attempts, d.LastError = storage.WebhookDelivered, attempts, ""
+	})
+}
+
+// Назначает повторную попытку доставки webhook.
+//
+// Принимает:
+// - id: идентификатор доставки.
+// - attempts: количество выполненных попыток.
+// - nextAttemptAt: время следующей попытки.
+// - lastError: ошибка последней попытки.
+//
+// Возвращает:
+// - ошибку storage.ErrNotFound, если доставка не найдена.
+func (ms *MemoryStorage) RetryWebhook(id string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return ms.updateWebhook(id, "failed to schedule webhook retry", func(d *storage.WebhookDelivery) {
+		d.Attempts, d.NextAttemptAt, d.LastError = attempts, nextAttemptAt, lastError
+	})
+}
+
+// Переносит доставку webhook в недоставленные.
+//
+// Принимает:
+// - id: идентификатор доставки.
+// - attempts: количество выполненных попыток.
+// - lastError: ошибка последней попытки.
+//
+// Возвращает:
+// - ошибку storage.ErrNotFound, если доставка не найдена.
+func (ms *MemoryStorage) DeadLetterWebhook(id string, attempts int, lastError string) error {
+	return ms.updateWebhook(id, "failed to dead-letter webhook", func(d *storage.WebhookDelivery) {
+		d.Status, d.Attempts, d.LastError = storage.WebhookDead, attempts, lastError
+		d.NextAttemptAt = time.Time{}
+	})
+}
+
+// Возвращает доставку webhook, в том числе недоставленную.
+//
+// Принимает:
+// - id: идентификатор доставки.
+//
+// Возвращает:
+// - доставку.
+// - ошибку storage.ErrNotFound, если доставка не найдена.
+func (ms *MemoryStorage) GetWebhook(id string) (storage.WebhookDelivery, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	d, ok := ms.webhooks[id]
+	if !ok {
+		return storage.WebhookDelivery{}, fmt.Errorf("failed to get webhook: %w", storage.ErrNotFound)
+	}
+	return d, nil
+}
+
+// Возвращает недоставленные доставки webhook.
+//
+// Принимает:
+// - limit: максимальное количество доставок.
+//
+// Возвращает:
+// - доставки, начиная с последних.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) ListDeadWebhooks(limit int) ([]storage.WebhookDelivery, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	dead := []storage.WebhookDelivery{}
+	for _, d := range ms.webhooks {
+		if d.Status == storage.WebhookDead {
+			dead = append(dead, d)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool { return dead[i].UpdatedAt.After(dead[j].UpdatedAt) })
+	if len(dead) > limit {
+		dead = dead[:limit]
+	}
+	return dead, nil
+}
+
+// Возвращает доставку webhook в очередь и сбрасывает счётчик попыток.
+//
+// Принимает:
+// - id: идентификатор доставки.
+// - now: время попытки.
+//
+// Возвращает:
+// - ошибку storage.ErrNotFound, если доставка не найдена.
+func (ms *MemoryStorage) RedeliverWebhook(id string, now time.Time) error {
+	return ms.updateWebhook(id, "failed to redeliver webhook", func(d *storage.WebhookDelivery) {
+		d.Status, d.Attempts, d.NextAttemptAt = storage.WebhookPending, 0, now
+	})
+}
+
+// Удаляет доставки webhook, выполненные раньше before.
+//
+// Принимает:
+// - before: граница времени выполнения.
+// - limit: максимальное количество удаляемых доставок за один вызов.
+//
+// Возвращает:
+// - количество удалённых доставок.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DeleteDeliveredWebhooks(before time.Time, limit int) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var deleted int64
+	for id, d := range ms.webhooks {
+		if deleted >= int64(limit) {
+			break
+		}
+		if d.Status == storage.WebhookDelivered && d.UpdatedAt.Before(before) {
+			delete(ms.webhooks, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Изменяет доставку webhook и время её обновления.
+func (ms *MemoryStorage) updateWebhook(id, message string, update func(d *storage.WebhookDelivery)) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	d, ok := ms.webhooks[id]
+	if !ok {
+		return fmt.Errorf("%s: %w", message, storage.ErrNotFound)
+	}
+	update(&d)
+	d.UpdatedAt = ms.clock.Now()
+	ms.webhooks[id] = d
+	return nil
+}
+
+// Сохраняет запись журнала аудита.
+//
+// Принимает:
+// - event: запись; Seq назначается хранилищем.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) AppendAudit(event storage.AuditEvent) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.auditSeq++
+	event.Seq = ms.auditSeq
+	event.Details = maps.Clone(event.Details)
+	ms.audit = append(ms.audit, event)
+	return nil
+}
+
+// Возвращает записи журнала аудита после afterSeq.
+//
+// Принимает:
+// - afterSeq: номер последней обработанной записи.
+// - before: граница времени записей.
+// - limit: максимальное количество записей.
+//
+// Возвращает:
+// - записи, упорядоченные по номеру.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) ListAuditAfter(afterSeq int64, before time.Time, limit int) ([]storage.AuditEvent, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	events := []storage.AuditEvent{}
+	for _, e := range ms.audit {
+		if len(events) >= limit {
+			break
+		}
+		if e.Seq > afterSeq && e.Time.Before(before) {
+			e.Details = maps.Clone(e.Details)
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// Возвращает номер последней выгруженной записи журнала аудита.
+//
+// Принимает:
+// - name: имя выгрузки.
+//
+// Возвращает:
+// - номер записи; 0, если выгрузок не было.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) GetAuditCheckpoint(name string) (int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.auditCheckpoints[name], nil
+}
+
+// Сохраняет номер последней выгруженной записи журнала аудита.
+//
+// Принимает:
+// - name: имя выгрузки.
+// - seq: номер записи.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) SaveAuditCheckpoint(name string, seq int64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.auditCheckpoints[name] = seq
+	return nil
+}
+
+// Удаляет записи журнала аудита с номером не больше upToSeq и временем раньше before.
+//
+// Принимает:
+// - upToSeq: номер последней удаляемой записи.
+// - before: граница времени записей.
+// - limit: максимальное количество удаляемых записей за один вызов.
+//
+// Возвращает:
+// - количество удалённых записей.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DeleteAuditEvents(upToSeq int64, before time.Time, limit int) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var deleted int64
+	kept := ms.audit[:0]
+	for _, e := range ms.audit {
+		if deleted < int64(limit) && e.Seq <= upToSeq && e.Time.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	clear(ms.audit[len(kept):])
+	ms.audit = kept
+	return deleted, nil
+}
+
+// Начало суток (UTC), к которым относится момент времени.
+func usageDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// Сохраняет сессию и заменяет индекс хеша. Вызывается под ms.mu.
+func (ms *MemoryStorage) setSession(sessionID string, s session) {
+	if old, ok := ms.sessions[sessionID]; ok {
+		delete(ms.hashes, old.refreshTokenHash)
+	}
+	ms.sessions[sessionID] = s
+	ms.hashes[s.refreshTokenHash] = sessionID
+}
+
+// Удаляет сессию и индекс хеша. Вызывается под ms.mu.
+func (ms *MemoryStorage) deleteSession(sessionID string) {
+	if old, ok := ms.sessions[sessionID]; ok {
+		delete(ms.hashes, old.refreshTokenHash)
+	}
+	delete(ms.sessions, sessionID)
+}
+
+// Возвращает действующие сессии пользователя, начиная с последней использованной. Вызывается под ms.mu.
+func (ms *MemoryStorage) activeSessions(userID string) []storage.Session {
+	now := ms.clock.Now()
+	sessions := []storage.Session{}
+	for sessionID, s := range ms.sessions {
+		if s.userID == userID && now.Before(s.expiresAt) {
+			sessions = append(sessions, s.toStorage(sessionID))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions
+}
+
+// Возвращает последнюю использованную действующую сессию пользователя.
+func (ms *MemoryStorage) lastSession(userID string) (storage.Session, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	sessions := ms.activeSessions(userID)
+	if len(sessions) == 0 {
+		return storage.Session{}, storage.ErrNotFound
+	}
+	return sessions[0], nil
+}
+
+// Возвращает данные ACME по ключу.
+//
+// Принимает:
+// - key: ключ данных.
+//
+// Возвращает:
+// - копию данных.
+// - storage.ErrNotFound, если данных нет.
+func (ms *MemoryStorage) GetACMEData(key string) ([]byte, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	data, ok := ms.acme[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return slices.Clone(data), nil
+}
+
+// Сохраняет данные ACME по ключу.
+//
+// Принимает:
+// - key: ключ данных.
+// - data: данные.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) SaveACMEData(key string, data []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.acme[key] = slices.Clone(data)
+	return nil
+}
+
+// Удаляет данные ACME по ключу.
+//
+// Принимает:
+// - key: ключ данных.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DeleteACMEData(key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.acme, key)
+	return nil
+}
+
+// Учитывает неудачную попытку обновления токенов пользователем.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - window: длина окна подсчёта попыток.
+// - maxFailures: число попыток в окне, после которого обновление запрещается.
+// - cooldown: длительность запрета.
+//
+// Возвращает:
+// - момент окончания запрета или нулевое время, если запрета нет.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) AddRefreshFailure(userID string, window time.Duration, maxFailures int, cooldown time.Duration) (time.Time, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.clock.Now()
+	f := ms.refreshFailures[userID]
+	if now.Sub(f.windowStart) >= window {
+		f.failures, f.windowStart = 0, now
+	}
+	f.failures++
+	if f.failures >= maxFailures {
+		f.lockedUntil = now.Add(cooldown)
+	}
+	ms.refreshFailures[userID] = f
+	return f.lockedUntil, nil
+}
+
+// Возвращает момент окончания запрета обновления токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - момент окончания запрета или нулевое время, если запрета не было.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) GetRefreshCooldown(userID string) (time.Time, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.refreshFailures[userID].lockedUntil, nil
+}
+
+// Удаляет неудачные попытки и запрет обновления токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) ResetRefreshFailures(userID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.refreshFailures, userID)
+	return nil
+}
+
+// Возвращает неудачные попытки входа по ключу.
+//
+// Принимает:
+// - key: ключ учётной записи или адреса клиента.
+//
+// Возвращает:
+// - попытки; нулевое значение, если неудачных попыток не было.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) GetLoginAttempt(key string) (storage.LoginAttempt, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.loginAttempts[key], nil
+}
+
+// Учитывает неудачную попытку входа.
+//
+// Принимает:
+// - key: ключ учётной записи или адреса клиента.
+// - resetAfter: время после последней неудачи, по истечении которого счёт начинается заново.
+//
+// Возвращает:
+// - попытки после учёта.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) AddLoginFailure(key string, resetAfter time.Duration) (storage.LoginAttempt, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.clock.Now()
+	attempt := ms.loginAttempts[key]
+	if !attempt.LastFailureAt.After(now.Add(-resetAfter)) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	ms.loginAttempts[key] = attempt
+	return attempt, nil
+}
+
+// Блокирует вход по ключу.
+//
+// Принимает:
+// - key: ключ учётной записи или адреса клиента.
+// - until: момент окончания блокировки.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) LockLogin(key string, until time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if attempt, ok := ms.loginAttempts[key]; ok {
+		attempt.LockedUntil = until
+		ms.loginAttempts[key] = attempt
+	}
+	return nil
+}
+
+// Удаляет неудачные попытки входа и блокировку по ключу.
+//
+// Принимает:
+// - key: ключ учётной записи или адреса клиента.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) ResetLoginAttempts(key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.loginAttempts, key)
+	return nil
+}
+
+// Удаляет устаревшие записи о неудачных попытках входа.
+//
+// Принимает:
+// - before: граница времени последней неудачи.
+// - limit: максимальное количество удаляемых записей за один вызов.
+//
+// Возвращает:
+// - количество удалённых записей.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DeleteLoginAttempts(before time.Time, limit int) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.clock.Now()
+	var deleted int64
+	for key, attempt := range ms.loginAttempts {
+		if deleted >= int64(limit) {
+			break
+		}
+		if attempt.LastFailureAt.Before(before) && !attempt.LockedUntil.After(now) {
+			delete(ms.loginAttempts, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Ротирует refresh-токен сессии и сохраняет события outbox в одной операции.
+//
+// Принимает:
+// - sessionID, oldHash, hashedToken, clientIP, expiresAt: как у UpdateRefreshToken.
+// - events: события; Attempts, NextAttemptAt, LastError и CreatedAt устанавливаются хранилищем.
+//
+// Возвращает:
+// - ошибку storage.ErrNotFound, если сессии нет, её срок истёк или токен уже
+// ротирован; события тогда не сохраняются.
+func (ms *MemoryStorage) UpdateRefreshTokenWithEvents(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time, events []storage.OutboxEvent) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.updateRefreshToken(sessionID, oldHash, hashedToken, clientIP, expiresAt); err != nil {
+		return err
+	}
+	now := ms.clock.Now()
+	for _, event := range events {
+		event.Payload = append([]byte(nil), event.Payload...)
+		event.Attempts, event.LastError = 0, ""
+		event.NextAttemptAt, event.CreatedAt = now, now
+		ms.outbox[event.ID] = event
+	}
+	return nil
+}
+
+// Возвращает события outbox, время попытки которых наступило.
+//
+// Принимает:
+// - now: текущее время.
+// - limit: максимальное количество событий.
+//
+// Возвращает:
+// - события, начиная с самых ранних.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) DueOutboxEvents(now time.Time, limit int) ([]storage.OutboxEvent, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	due := []storage.OutboxEvent{}
+	for _, event := range ms.outbox {
+		if !event.NextAttemptAt.After(now) {
+			due = append(due, event)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Удаляет опубликованное событие outbox.
+//
+// Принимает:
+// - id: идентификатор события.
+//
+// Возвращает:
+// - ошибку storage.ErrNotFound, если событие не найдено.
+func (ms *MemoryStorage) DeleteOutboxEvent(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.outbox[id]; !ok {
+		return fmt.Errorf("failed to delete outbox event: %w", storage.ErrNotFound)
+	}
+	delete(ms.outbox, id)
+	return nil
+}
+
+// Назначает повторную попытку публикации события outbox.
+//
+// Принимает:
+// - id: идентификатор события.
+// - attempts: количество выполненных попыток.
+// - nextAttemptAt: время следующей попытки.
+// - lastError: ошибка последней попытки.
+//
+// Возвращает:
+// - ошибку storage.ErrNotFound, если событие не найдено.
+func (ms *MemoryStorage) RetryOutboxEvent(id string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	event, ok := ms.outbox[id]
+	if !ok {
+		return fmt.Errorf("failed to schedule outbox retry: %w", storage.ErrNotFound)
+	}
+	event.Attempts, event.NextAttemptAt, event.LastError = attempts, nextAttemptAt, lastError
+	ms.outbox[id] = event
+	return nil
+}
+
+// Сохраняет запись журнала действий.
+//
+// Принимает:
+// - record: запись; ID назначается хранилищем.
+//
+// Возвращает:
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) AppendAuditRecord(record storage.AuditRecord) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record.ID = int64(len(ms.auditTrail)) + 1
+	record.Details = maps.Clone(record.Details)
+	ms.auditTrail = append(ms.auditTrail, record)
+	return nil
+}
+
+// Возвращает записи журнала действий, удовлетворяющие условиям.
+//
+// Принимает:
+// - query: условия выборки.
+//
+// Возвращает:
+// - записи, начиная с последних.
+// - ошибку (всегда nil).
+func (ms *MemoryStorage) QueryAuditRecords(query storage.AuditQuery) ([]storage.AuditRecord, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	records := []storage.AuditRecord{}
+	for i := len(ms.auditTrail) - 1; i >= 0 && len(records) < query.Limit; i-- {
+		r := ms.auditTrail[i]
+		switch {
+		case query.BeforeID > 0 && r.ID >= query.BeforeID,
+			query.Action != "" && r.Action != query.Action,
+			len(query.Actions) > 0 && !slices.Contains(query.Actions, r.Action),
+			query.Actor != "" && r.Actor != query.Actor,
+			query.UserID != "" && r.UserID != query.UserID,
+			query.Outcome != "" && r.Outcome != query.Outcome,
+			!query.From.IsZero() && r.Time.Before(query.From),
+			!query.To.IsZero() && !r.Time.Before(query.To):
+			continue
+		}
+		r.Details = maps.Clone(r.Details)
+		records = append(records, r)
+	}
+	return records, nil
+}
@@ -0,0 +1,36 @@
+package memory_test
+
+import (
+	"auth_service/internal/storage/memory"
+	"auth_service/internal/storage/storagetest"
+	"auth_service/lib/clock"
+	"testing"
+)
+
+func TestMemoryStorage_Conformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T, clk clock.Clock) storagetest.Subject {
+		ms := memory.NewMemoryStorage().WithClock(clk)
+		return storagetest.Subject{
+			Storage: ms,
+			CreateUser: func(userID, email string) error {
+				ms.CreateUser(userID, email)
+				return nil
+			},
+			Cleaner:             ms,
+			Sessions:            ms,
+			Finder:              ms,
+			Usage:               ms,
+			Analytics:           ms,
+			Webhooks:            ms,
+			Audit:               ms,
+			ACME:                ms,
+			RefreshFailures:     ms,
+			LoginAttempts:       ms,
+			Accounts:            ms,
+			Passwords:           ms,
+			Outbox:              ms,
+			AuditTrail:          ms,
+			ClockControlsExpiry: true,
+		}
+	})
+}
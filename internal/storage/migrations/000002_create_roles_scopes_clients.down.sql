@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS oauth_clients;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_scopes;
+DROP TABLE IF EXISTS scopes;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,37 @@
+-- Создание таблицы ролей
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Создание таблицы областей доступа (scopes)
+CREATE TABLE IF NOT EXISTS scopes (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Связь ролей и областей доступа
+CREATE TABLE IF NOT EXISTS role_scopes (
+    role_name TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    scope_name TEXT NOT NULL REFERENCES scopes(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_name, scope_name)
+);
+
+-- Связь пользователей и ролей
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_name TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_name)
+);
+
+-- Создание таблицы OAuth-клиентов
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT NOW()
+);
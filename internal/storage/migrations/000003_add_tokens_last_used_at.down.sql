@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_tokens_last_used_at;
+ALTER TABLE tokens DROP COLUMN IF EXISTS last_used_at;
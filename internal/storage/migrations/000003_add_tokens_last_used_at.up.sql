@@ -0,0 +1,8 @@
+-- Время последнего использования сессии (выдачи или обновления токенов)
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- До появления столбца created_at обновлялся при каждой ротации
+UPDATE tokens SET last_used_at = created_at WHERE created_at IS NOT NULL;
+
+-- Индекс для удаления неактивных сессий
+CREATE INDEX IF NOT EXISTS idx_tokens_last_used_at ON tokens (last_used_at);
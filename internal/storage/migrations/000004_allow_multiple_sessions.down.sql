@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_tokens_user_id_last_used_at;
+
+-- Остаётся только последняя использованная сессия пользователя
+DELETE FROM tokens t
+USING tokens newer
+WHERE t.user_id = newer.user_id
+  AND (t.last_used_at, t.id) < (newer.last_used_at, newer.id);
+
+ALTER TABLE tokens ADD CONSTRAINT tokens_user_id_key UNIQUE (user_id);
@@ -0,0 +1,5 @@
+-- Несколько сессий на пользователя (по одной на устройство)
+ALTER TABLE tokens DROP CONSTRAINT IF EXISTS tokens_user_id_key;
+
+-- Индекс для выборки сессий пользователя
+CREATE INDEX IF NOT EXISTS idx_tokens_user_id_last_used_at ON tokens (user_id, last_used_at DESC);
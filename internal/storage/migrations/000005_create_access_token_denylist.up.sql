@@ -0,0 +1,9 @@
+-- Список отозванных access-токенов: ключ jti:<id> или sid:<id> хранится,
+-- пока не истекут все токены, к которым он относится
+CREATE TABLE IF NOT EXISTS access_token_denylist (
+    key TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- Индекс для удаления истёкших записей
+CREATE INDEX IF NOT EXISTS idx_access_token_denylist_expires_at ON access_token_denylist (expires_at);
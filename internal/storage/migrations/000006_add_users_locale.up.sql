@@ -0,0 +1,3 @@
+-- Предпочитаемый язык уведомлений пользователя (BCP 47, например ru или en-GB);
+-- пустая строка — язык по умолчанию
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
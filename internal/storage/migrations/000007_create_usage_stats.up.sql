@@ -0,0 +1,10 @@
+-- Суточная статистика запросов по интерфейсу (http, grpc), операции и результату;
+-- пополняется заданием usage_flush
+CREATE TABLE IF NOT EXISTS usage_stats (
+    day DATE NOT NULL,
+    api TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    result TEXT NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, api, operation, result)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tokens_created_at;
+DROP INDEX IF EXISTS idx_users_created_at;
+DROP TABLE IF EXISTS daily_stats;
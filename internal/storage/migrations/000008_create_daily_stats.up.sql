@@ -0,0 +1,17 @@
+-- Суточные сводки: активные и новые пользователи, запросы и их результаты;
+-- пересчитываются заданием stats_rollup
+CREATE TABLE IF NOT EXISTS daily_stats (
+    day DATE PRIMARY KEY,
+    active_users BIGINT NOT NULL DEFAULT 0,
+    new_users BIGINT NOT NULL DEFAULT 0,
+    requests BIGINT NOT NULL DEFAULT 0,
+    rejected_requests BIGINT NOT NULL DEFAULT 0,
+    failed_requests BIGINT NOT NULL DEFAULT 0,
+    computed_at TIMESTAMP NOT NULL
+);
+
+-- Индекс для подсчёта регистраций за сутки
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at);
+
+-- Индекс для подсчёта сессий, начатых за сутки
+CREATE INDEX IF NOT EXISTS idx_tokens_created_at ON tokens (created_at);
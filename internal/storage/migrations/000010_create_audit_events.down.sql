@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS audit_export_checkpoints;
+DROP TABLE IF EXISTS audit_events;
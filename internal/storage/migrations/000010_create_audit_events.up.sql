@@ -0,0 +1,20 @@
+-- Журнал аудита: события безопасности в порядке записи
+CREATE TABLE IF NOT EXISTS audit_events (
+    seq BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    time TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    session_id TEXT NOT NULL DEFAULT '',
+    client_ip TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_time ON audit_events (time);
+
+-- Номер последней выгруженной записи по выгрузкам
+CREATE TABLE IF NOT EXISTS audit_export_checkpoints (
+    name TEXT PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Версия токенов пользователя; повышается при выходе со всех устройств,
+-- access-токены с меньшей версией отклоняются при строгой проверке
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE tokens DROP COLUMN IF EXISTS platform;
+ALTER TABLE tokens DROP COLUMN IF EXISTS device_name;
+ALTER TABLE tokens DROP COLUMN IF EXISTS user_agent;
@@ -0,0 +1,5 @@
+-- Устройство, на котором начата сессия: User-Agent клиента, имя устройства
+-- и платформа, переданные клиентом; пустая строка — не указано
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS device_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS platform TEXT NOT NULL DEFAULT '';
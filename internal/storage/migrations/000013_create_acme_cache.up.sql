@@ -0,0 +1,6 @@
+-- Сертификаты, ключи и данные проверок ACME (Let's Encrypt)
+CREATE TABLE IF NOT EXISTS acme_cache (
+    key TEXT PRIMARY KEY,
+    data BYTEA NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,7 @@
+-- Неудачные попытки обновления токенов пользователей и запрет обновления после них
+CREATE TABLE IF NOT EXISTS refresh_failures (
+    user_id UUID PRIMARY KEY,
+    failures INT NOT NULL,
+    window_start TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
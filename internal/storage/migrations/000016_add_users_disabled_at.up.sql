@@ -0,0 +1,2 @@
+-- Время отключения учётной записи администратором; NULL — учётная запись включена
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;
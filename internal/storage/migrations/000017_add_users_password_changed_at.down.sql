@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS update_users_password_changed_at ON users;
+DROP FUNCTION IF EXISTS update_users_password_changed_at_column();
+ALTER TABLE users DROP COLUMN IF EXISTS password_changed_at;
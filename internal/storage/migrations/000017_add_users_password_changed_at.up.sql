@@ -0,0 +1,23 @@
+-- Время последней смены пароля (UTC) для политики срока действия пароля.
+-- Для существующих пользователей срок отсчитывается от применения миграции.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP;
+UPDATE users SET password_changed_at = NOW() AT TIME ZONE 'UTC' WHERE password_changed_at IS NULL;
+ALTER TABLE users ALTER COLUMN password_changed_at SET DEFAULT (NOW() AT TIME ZONE 'UTC');
+
+-- Отмечает смену пароля, выполненную в обход сервиса (UPDATE password_hash без
+-- password_changed_at).
+CREATE OR REPLACE FUNCTION update_users_password_changed_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.password_changed_at IS NOT DISTINCT FROM OLD.password_changed_at THEN
+        NEW.password_changed_at = NOW() AT TIME ZONE 'UTC';
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER update_users_password_changed_at
+BEFORE UPDATE OF password_hash ON users
+FOR EACH ROW
+WHEN (NEW.password_hash IS DISTINCT FROM OLD.password_hash)
+EXECUTE FUNCTION update_users_password_changed_at_column();
@@ -0,0 +1,36 @@
+-- Журнал действий: выдача и обновление токенов, неудачные обновления, смена
+-- IP-адреса, действия администраторов. Записи только добавляются.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    time TIMESTAMP NOT NULL,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    user_id TEXT NOT NULL DEFAULT '',
+    session_id TEXT NOT NULL DEFAULT '',
+    client_ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log (action, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_time ON audit_log (time);
+
+-- Запрещает изменение, удаление и очистку (TRUNCATE) журнала.
+CREATE OR REPLACE FUNCTION audit_log_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW
+EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT
+EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,5 @@
+-- Время начала последнего запуска фоновых задач, общее для всех реплик
+CREATE TABLE IF NOT EXISTS job_runs (
+    name TEXT PRIMARY KEY,
+    started_at TIMESTAMPTZ NOT NULL
+);
@@ -1,17 +1,351 @@
 package postgres
 
 import (
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/fieldcrypt"
+	"auth_service/lib/clock"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// Запросы горячего пути. Вынесены в константы, чтобы их можно было
+// заранее подготовить на каждом соединении пула (см. PrepareStatements).
+const (
+	saveRefreshTokenQuery = `
+			INSERT INTO tokens (user_id, refresh_token_hash, ip_address, created_at, last_used_at, expires_at)
+			VALUES ($1, $2, $3, $4, $4, $5)
+			RETURNING id;
+	`
+	// Последняя использованная действующая сессия; использует индекс idx_tokens_user_id_last_used_at.
+	getRefreshTokenQuery = `
+			SELECT refresh_token_hash FROM tokens
+			WHERE user_id = $1 AND expires_at > $2 ORDER BY last_used_at DESC LIMIT 1;
+	`
+	// Истёкшая сессия не ротируется, даже если ещё не удалена.
+	updateRefreshTokenQuery = `
+			UPDATE tokens
+			SET refresh_token_hash = $3, ip_address = $4, last_used_at = $5, expires_at = $6
+			WHERE id = $1 AND refresh_token_hash = $2 AND expires_at > $5;
+	`
+	getLastIPQuery = `
+			SELECT ip_address FROM tokens
+			WHERE user_id = $1 AND expires_at > $2 ORDER BY last_used_at DESC LIMIT 1;
+	`
+	getUserEmailQuery     = `SELECT email FROM users WHERE id = $1`
+	getUserLocaleQuery    = `SELECT locale FROM users WHERE id = $1`
+	getTokenVersionQuery  = `SELECT token_version FROM users WHERE id = $1`
+	bumpTokenVersionQuery = `UPDATE users SET token_version = token_version + 1 WHERE id = $1 RETURNING token_version`
+	// Email сравнивается со всеми формами, в которых он мог быть записан (см. fieldcrypt.DeterministicCandidates).
+	getUserCredentialsQuery = `SELECT id, password_hash FROM users WHERE email = ANY($1) LIMIT 1`
+
+	deleteRefreshTokenQuery = `DELETE FROM tokens WHERE user_id = $1`
+	deleteSessionQuery      = `DELETE FROM tokens WHERE id = $1`
+	deleteUserSessionQuery  = `DELETE FROM tokens WHERE id = $1 AND user_id = $2`
+	setSessionDeviceQuery   = `UPDATE tokens SET user_agent = $2, device_name = $3, platform = $4 WHERE id = $1`
+
+	// Использует индекс idx_tokens_refresh_token_hash.
+	getSessionByRefreshHashQuery = `
+			SELECT id, user_id, refresh_token_hash, ip_address, created_at, last_used_at, expires_at,
+				user_agent, device_name, platform
+			FROM tokens WHERE refresh_token_hash = $1;
+	`
+	listSessionsQuery = `
+			SELECT id, user_id, refresh_token_hash, ip_address, created_at, last_used_at, expires_at,
+				user_agent, device_name, platform
+			FROM tokens WHERE user_id = $1 AND expires_at > $2
+			ORDER BY last_used_at DESC;
+	`
+
+	// Постраничный обход по первичному ключу; пустой массив пользователей и NULL
+	// вместо времени не ограничивают отбор.
+	findSessionsQuery = `
+			SELECT id, user_id, refresh_token_hash, ip_address, created_at, last_used_at, expires_at,
+				user_agent, device_name, platform
+			FROM tokens
+			WHERE expires_at > $1 AND id > $2
+				AND (cardinality($3::uuid[]) = 0 OR user_id = ANY($3::uuid[]))
+				AND ($4::timestamp IS NULL OR created_at < $4)
+			ORDER BY id LIMIT $5;
+	`
+
+	deleteExpiredRefreshTokensQuery = `
+			DELETE FROM tokens
+			WHERE id IN (SELECT id FROM tokens WHERE expires_at < $2 LIMIT $1);
+	`
+
+	// Использует индекс idx_tokens_last_used_at.
+	deleteIdleRefreshTokensQuery = `
+			DELETE FROM tokens
+			WHERE id IN (SELECT id FROM tokens WHERE last_used_at < $2 LIMIT $1);
+	`
+
+	denyAccessTokenQuery = `
+			INSERT INTO access_token_denylist (key, expires_at) VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE SET expires_at = GREATEST(access_token_denylist.expires_at, EXCLUDED.expires_at);
+	`
+	isAccessTokenDeniedQuery = `
+			SELECT EXISTS (SELECT 1 FROM access_token_denylist WHERE key = ANY($1) AND expires_at > $2);
+	`
+	// Значения, зашифрованные не основным ключом ($2 — префикс значений основного ключа).
+	selectStaleTokenIPsQuery = `
+			SELECT id::text, ip_address FROM tokens WHERE left(ip_address, length($2)) <> $2 LIMIT $1;
+	`
+	reencryptTokenIPQuery  = `UPDATE tokens SET ip_address = $3 WHERE id = $1 AND ip_address = $2`
+	selectStaleEmailsQuery = `
+			SELECT id::text, email FROM users WHERE left(email, length($2)) <> $2 LIMIT $1;
+	`
+	reencryptEmailQuery = `UPDATE users SET email = $3 WHERE id = $1 AND email = $2`
+
+	// Использует индекс idx_access_token_denylist_expires_at.
+	deleteExpiredDeniedAccessTokensQuery = `
+			DELETE FROM access_token_denylist
+			WHERE key IN (SELECT key FROM access_token_denylist WHERE expires_at < $2 LIMIT $1);
+	`
+
+	countSessionsQuery = `SELECT count(*) FROM tokens WHERE expires_at > $1`
+
+	addUsageQuery = `
+			INSERT INTO usage_stats (day, api, operation, result, count) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (day, api, operation, result) DO UPDATE SET count = usage_stats.count + EXCLUDED.count;
+	`
+	listUsageQuery = `
+			SELECT day, api, operation, result, count FROM usage_stats
+			WHERE day BETWEEN $1 AND $2
+			ORDER BY day, api, operation, result;
+	`
+
+	// Активные пользователи считаются по сессиям, использованным или начатым
+	// за сутки; сессия, обновлённая позже, в подсчёт уже не попадает, поэтому
+	// при пересчёте сохраняется наибольшее значение.
+	rollupDailyStatsQuery = `
+			INSERT INTO daily_stats (day, active_users, new_users, requests, rejected_requests, failed_requests, computed_at)
+			SELECT $1::date,
+				(SELECT count(DISTINCT user_id) FROM tokens
+				 WHERE (last_used_at >= $1 AND last_used_at < $2) OR (created_at >= $1 AND created_at < $2)),
+				(SELECT count(*) FROM users WHERE created_at >= $1 AND created_at < $2),
+				coalesce(sum(count), 0),
+				coalesce(sum(count) FILTER (WHERE result = 'rejected'), 0),
+				coalesce(sum(count) FILTER (WHERE result = 'error'), 0),
+				$3
+			FROM usage_stats WHERE day = $1::date
+			ON CONFLICT (day) DO UPDATE SET
+				active_users = GREATEST(daily_stats.active_users, EXCLUDED.active_users),
+				new_users = EXCLUDED.new_users,
+				requests = EXCLUDED.requests,
+				rejected_requests = EXCLUDED.rejected_requests,
+				failed_requests = EXCLUDED.failed_requests,
+				computed_at = EXCLUDED.computed_at
+			RETURNING day, active_users, new_users, requests, rejected_requests, failed_requests;
+	`
+	webhookColumns = `id::text, event_id::text, event_type, endpoint, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at`
+
+	enqueueWebhookQuery = `
+			INSERT INTO webhook_deliveries (id, event_id, event_type, endpoint, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7, '', $8, $8);
+	`
+	// Использует индекс idx_webhook_deliveries_pending.
+	dueWebhooksQuery = `
+			SELECT ` + webhookColumns + ` FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1 ORDER BY next_attempt_at LIMIT $2;
+	`
+	markWebhookDeliveredQuery = `
+			UPDATE webhook_deliveries SET status = 'delivered', attempts = $2, last_error = '', updated_at = $3 WHERE id = $1;
+	`
+	retryWebhookQuery = `
+			UPDATE webhook_deliveries SET attempts = $2, next_attempt_at = $3, last_error = $4, updated_at = $5 WHERE id = $1;
+	`
+	deadLetterWebhookQuery = `
+			WITH moved AS (
+				DELETE FROM webhook_deliveries WHERE id = $1
+				RETURNING id, event_id, event_type, endpoint, payload, created_at
+			)
+			INSERT INTO webhook_dead_letters (id, event_id, event_type, endpoint, payload, attempts, last_error, created_at, failed_at)
+			SELECT id, event_id, event_type, endpoint, payload, $2, $3, created_at, $4 FROM moved;
+	`
+	// Для недоставленных в next_attempt_at и updated_at возвращается время переноса.
+	deadWebhookColumns = `id::text, event_id::text, event_type, endpoint, payload, 'dead', attempts, failed_at, last_error, created_at, failed_at`
+	getWebhookQuery    = `
+			SELECT ` + webhookColumns + ` FROM webhook_deliveries WHERE id = $1
+			UNION ALL
+			SELECT ` + deadWebhookColumns + ` FROM webhook_dead_letters WHERE id = $1;
+	`
+	listDeadWebhooksQuery = `
+			SELECT ` + deadWebhookColumns + ` FROM webhook_dead_letters ORDER BY failed_at DESC LIMIT $1;
+	`
+	redeliverWebhookQuery = `
+			UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = $2, updated_at = $2 WHERE id = $1;
+	`
+	restoreDeadWebhookQuery = `
+			WITH moved AS (
+				DELETE FROM webhook_dead_letters WHERE id = $1
+				RETURNING id, event_id, event_type, endpoint, payload, last_error, created_at
+			)
+			INSERT INTO webhook_deliveries (id, event_id, event_type, endpoint, payload, status, attempts, next_attempt_at, last_error, created_at, updated_at)
+			SELECT id, event_id, event_type, endpoint, payload, 'pending', 0, $2, last_error, created_at, $2 FROM moved;
+	`
+	// Использует индекс idx_webhook_deliveries_delivered.
+	deleteDeliveredWebhooksQuery = `
+			DELETE FROM webhook_deliveries
+			WHERE id IN (SELECT id FROM webhook_deliveries WHERE status = 'delivered' AND updated_at < $2 LIMIT $1);
+	`
+
+	appendAuditQuery = `
+			INSERT INTO audit_events (type, severity, time, user_id, session_id, client_ip, details)
+			VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`
+	listAuditAfterQuery = `
+			SELECT seq, type, severity, time, user_id, session_id, client_ip, details FROM audit_events
+			WHERE seq > $1 AND time < $2 ORDER BY seq LIMIT $3;
+	`
+	getAuditCheckpointQuery  = `SELECT seq FROM audit_export_checkpoints WHERE name = $1`
+	saveAuditCheckpointQuery = `
+			INSERT INTO audit_export_checkpoints (name, seq, updated_at) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET seq = EXCLUDED.seq, updated_at = EXCLUDED.updated_at;
+	`
+	getACMEDataQuery  = `SELECT data FROM acme_cache WHERE key = $1`
+	saveACMEDataQuery = `
+			INSERT INTO acme_cache (key, data, updated_at) VALUES ($1, $2, $3)
+			ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at;
+	`
+	deleteACMEDataQuery    = `DELETE FROM acme_cache WHERE key = $1`
+	deleteAuditEventsQuery = `
+			DELETE FROM audit_events
+			WHERE seq IN (SELECT seq FROM audit_events WHERE seq <= $1 AND time < $2 ORDER BY seq LIMIT $3);
+	`
+
+	addRefreshFailureQuery = `
+			INSERT INTO refresh_failures (user_id, failures, window_start, locked_until)
+			VALUES ($1, 1, $2, CASE WHEN $4 <= 1 THEN $5::timestamp END)
+			ON CONFLICT (user_id) DO UPDATE SET
+				failures = CASE WHEN refresh_failures.window_start > $3 THEN refresh_failures.failures + 1 ELSE 1 END,
+				window_start = CASE WHEN refresh_failures.window_start > $3 THEN refresh_failures.window_start ELSE $2 END,
+				locked_until = CASE
+					WHEN (CASE WHEN refresh_failures.window_start > $3 THEN refresh_failures.failures + 1 ELSE 1 END) >= $4 THEN $5
+					ELSE refresh_failures.locked_until
+				END
+			RETURNING locked_until;
+	`
+	getRefreshCooldownQuery = `SELECT locked_until FROM refresh_failures WHERE user_id = $1`
+
+	getLoginAttemptQuery = `SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1`
+	addLoginFailureQuery = `
+			INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, $2)
+			ON CONFLICT (key) DO UPDATE SET
+				failures = CASE WHEN login_attempts.last_failure_at > $3 THEN login_attempts.failures + 1 ELSE 1 END,
+				last_failure_at = EXCLUDED.last_failure_at
+			RETURNING failures, last_failure_at, locked_until;
+	`
+	lockLoginQuery           = `UPDATE login_attempts SET locked_until = $2 WHERE key = $1`
+	resetLoginAttemptsQuery  = `DELETE FROM login_attempts WHERE key = $1`
+	deleteLoginAttemptsQuery = `
+			DELETE FROM login_attempts
+			WHERE key IN (
+				SELECT key FROM login_attempts
+				WHERE last_failure_at < $2 AND (locked_until IS NULL OR locked_until <= $3)
+				LIMIT $1
+			);
+	`
+
+	setUserDisabledQuery   = `UPDATE users SET disabled_at = COALESCE(disabled_at, $2) WHERE id = $1`
+	setUserEnabledQuery    = `UPDATE users SET disabled_at = NULL WHERE id = $1`
+	getUserDisabledAtQuery = `SELECT disabled_at FROM users WHERE id = $1`
+
+	resetRefreshFailuresQuery = `DELETE FROM refresh_failures WHERE user_id = $1`
+
+	setPasswordQuery          = `UPDATE users SET password_hash = $2, password_changed_at = $3 WHERE id = $1`
+	getPasswordChangedAtQuery = `SELECT password_changed_at FROM users WHERE id = $1`
+
+	insertOutboxEventQuery = `
+			INSERT INTO outbox (id, event_type, payload, attempts, next_attempt_at, last_error, created_at)
+			VALUES ($1, $2, $3, 0, $4, '', $4);
+	`
+	// Использует индекс idx_outbox_next_attempt_at.
+	dueOutboxEventsQuery = `
+			SELECT id::text, event_type, payload, attempts, next_attempt_at, last_error, created_at FROM outbox
+			WHERE next_attempt_at <= $1 ORDER BY next_attempt_at, created_at LIMIT $2;
+	`
+	deleteOutboxEventQuery = `DELETE FROM outbox WHERE id = $1`
+	retryOutboxEventQuery  = `UPDATE outbox SET attempts = $2, next_attempt_at = $3, last_error = $4 WHERE id = $1`
+
+	appendAuditRecordQuery = `
+			INSERT INTO audit_log (time, action, actor, user_id, session_id, client_ip, user_agent, outcome, details)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+	`
+	// Пустые условия не ограничивают выборку; $5 и $6 — NULL без границы времени.
+	queryAuditRecordsQuery = `
+			SELECT id, time, action, actor, user_id, session_id, client_ip, user_agent, outcome, details FROM audit_log
+			WHERE ($1 = '' OR action = $1) AND ($2 = '' OR actor = $2) AND ($3 = '' OR user_id = $3)
+				AND ($4 = '' OR outcome = $4) AND ($5::timestamp IS NULL OR time >= $5)
+				AND ($6::timestamp IS NULL OR time < $6) AND ($7 = 0 OR id < $7)
+				AND (coalesce(cardinality($9::text[]), 0) = 0 OR action = ANY($9))
+			ORDER BY id DESC LIMIT $8;
+	`
+
+	listDailyStatsQuery = `
+			SELECT day, active_users, new_users, requests, rejected_requests, failed_requests
+			FROM daily_stats WHERE day BETWEEN $1 AND $2 ORDER BY day;
+	`
+)
+
+// Запросы, которые подготавливаются при установке соединения.
+var hotQueries = []string{
+	saveRefreshTokenQuery,
+	getRefreshTokenQuery,
+	updateRefreshTokenQuery,
+	getLastIPQuery,
+	getUserEmailQuery,
+	getSessionByRefreshHashQuery,
+	listSessionsQuery,
+	isAccessTokenDeniedQuery,
+}
+
+// Подготавливает запросы горячего пути на соединении.
+//
+// Имя подготовленного выражения совпадает с текстом запроса, поэтому pgx
+// использует его напрямую при вызове Exec/QueryRow с тем же SQL, без
+// повторного разбора на стороне сервера.
+// Предназначена для использования в pgxpool.Config.AfterConnect; не должна
+// вызываться в режиме simple protocol (например, за PgBouncer в transaction pooling).
+//
+// Принимает:
+// - ctx: контекст выполнения.
+// - conn: соединение с базой данных.
+//
+// Возвращает:
+// - ошибку, если какой-либо запрос не удалось подготовить.
+func PrepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	for _, query := range hotQueries {
+		if _, err := conn.Prepare(ctx, query, query); err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+	}
+	return nil
+}
+
 // Хранилище для работы с PostgreSQL.
 type PostgresStorage struct {
-	pool *pgxpool.Pool
+	pool  *pgxpool.Pool
+	clock clock.Clock
+	// Ключи шифрования столбцов; nil — значения хранятся открыто.
+	crypt *fieldcrypt.Keyring
+	// Контекст запросов (см. WithContext); nil — ps.queryContext().
+	ctx context.Context
 }
 
+// Столбцы, шифруемые на стороне приложения.
+const (
+	ColumnTokenIP   = "tokens.ip_address"
+	ColumnUserEmail = "users.email"
+	ColumnACMEData  = "acme_cache.data"
+)
+
 // Создаёт новый экземпляр PostgresStorage.
 //
 // Принимает:
@@ -20,33 +354,73 @@ type PostgresStorage struct {
 // Возвращает:
 // - экземпляр PostgresStorage.
 func NewPostgresStorage(pool *pgxpool.Pool) *PostgresStorage {
-	return &PostgresStorage{pool: pool}
+	return &PostgresStorage{pool: pool, clock: clock.Real{}}
+}
+
+// Устанавливает источник времени, от которого отсчитываются сроки жизни токенов.
+func (ps *PostgresStorage) WithClock(c clock.Clock) *PostgresStorage {
+	ps.clock = c
+	return ps
+}
+
+// Включает шифрование IP-адресов сессий и email пользователей.
+//
+// IP-адреса шифруются со случайным nonce, email — детерминированно, чтобы
+// сохранить ограничение UNIQUE и поиск по email. Значения, записанные до
+// включения шифрования, читаются как есть и перешифровываются ReencryptColumns.
+func (ps *PostgresStorage) WithEncryption(keyring *fieldcrypt.Keyring) *PostgresStorage {
+	ps.crypt = keyring
+	return ps
+}
+
+// Возвращает хранилище, выполняющее запросы в контексте ctx, чтобы они
+// попадали в трассировку запроса. Отмена ctx запросы не прерывает.
+func (ps *PostgresStorage) WithContext(ctx context.Context) storage.Storage {
+	bound := *ps
+	bound.ctx = context.WithoutCancel(ctx)
+	return &bound
+}
+
+// Возвращает контекст запросов.
+func (ps *PostgresStorage) queryContext() context.Context {
+	if ps.ctx == nil {
+		return context.Background()
+	}
+	return ps.ctx
+}
+
+// Возвращает текущее время в UTC (столбцы хранятся как TIMESTAMP без часового пояса).
+func (ps *PostgresStorage) now() time.Time {
+	return ps.clock.Now().UTC()
 }
 
-// Cохраняет refresh-токен и IP клиента в базе данных.
+// Cохраняет refresh-токен и IP клиента в базе данных, начиная новую сессию.
 //
 // Принимает:
 // - userID: идентификатор пользователя.
 // - hashedToken: хешированный refresh-токен.
 // - clientIP: IP-адрес клиента.
+// - expiresAt: срок действия сессии.
 //
 // Возвращает:
+// - идентификатор сессии.
 // - ошибку, если не удалось сохранить токен.
-func (ps *PostgresStorage) SaveRefreshToken(userID, hashedToken, clientIP string) error {
-	query := `
-			INSERT INTO tokens (user_id, refresh_token_hash, ip_address, created_at, expires_at)
-			VALUES ($1, $2, $3, NOW(), NOW() + INTERVAL '30 days')
-			ON CONFLICT (user_id) DO UPDATE
-			SET refresh_token_hash = $2, ip_address = $3, created_at = NOW(), expires_at = NOW() + INTERVAL '30 days';
-	`
-	_, err := ps.pool.Exec(context.Background(), query, userID, hashedToken, clientIP)
+func (ps *PostgresStorage) SaveRefreshToken(userID, hashedToken, clientIP string, expiresAt time.Time) (string, error) {
+	storedIP, err := ps.crypt.Encrypt(ColumnTokenIP, clientIP)
 	if err != nil {
-		return fmt.Errorf("failed to save refresh token: %w", err)
+		return "", fmt.Errorf("failed to save refresh token: %w", err)
 	}
-	return nil
+
+	var sessionID string
+	err = ps.pool.QueryRow(ps.queryContext(), saveRefreshTokenQuery, userID, hashedToken, storedIP, ps.now(), expiresAt.UTC()).
+		Scan(&sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return sessionID, nil
 }
 
-// Возвращает refresh-токен пользователя из базы данных.
+// Возвращает refresh-токен последней использованной действующей сессии пользователя из базы данных.
 //
 // Принимает:
 // - userID: идентификатор пользователя.
@@ -56,37 +430,46 @@ func (ps *PostgresStorage) SaveRefreshToken(userID, hashedToken, clientIP string
 // - ошибку, если не удалось получить токен.
 func (ps *PostgresStorage) GetRefreshToken(userID string) (string, error) {
 	var hashedToken string
-	query := `SELECT refresh_token_hash FROM tokens WHERE user_id = $1`
-	err := ps.pool.QueryRow(context.Background(), query, userID).Scan(&hashedToken)
+	err := ps.pool.QueryRow(ps.queryContext(), getRefreshTokenQuery, userID, ps.now()).Scan(&hashedToken)
 	if err != nil {
-		return "", fmt.Errorf("failed to get refresh token: %w", err)
+		return "", fmt.Errorf("failed to get refresh token: %w", notFound(err))
 	}
 	return hashedToken, nil
 }
 
-// Обновляет refresh-токен и IP клиента в базе данных.
+// Обновляет refresh-токен, IP клиента и срок действия сессии в базе данных.
+//
+// created_at (время входа) при ротации не меняется, last_used_at переносится на текущий момент.
+//
+// Токен заменяется, только если в сессии всё ещё хранится oldHash, поэтому
+// из нескольких одновременных ротаций одного токена успешна ровно одна.
 //
 // Принимает:
-// - userID: идентификатор пользователя.
+// - sessionID: идентификатор сессии.
+// - oldHash: хеш ротируемого refresh-токена.
 // - hashedToken: новый хешированный refresh-токен.
 // - clientIP: новый IP-адрес клиента.
+// - expiresAt: новый срок действия сессии.
 //
 // Возвращает:
-// - ошибку, если не удалось обновить токен.
-func (ps *PostgresStorage) UpdateRefreshToken(userID, hashedToken, clientIP string) error {
-	query := `
-			UPDATE tokens
-			SET refresh_token_hash = $2, ip_address = $3, created_at = NOW(), expires_at = NOW() + INTERVAL '30 days'
-			WHERE user_id = $1;
-	`
-	_, err := ps.pool.Exec(context.Background(), query, userID, hashedToken, clientIP)
+// - ошибку, если не удалось обновить токен, сессия не найдена, её срок истёк
+// или токен уже ротирован.
+func (ps *PostgresStorage) UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time) error {
+	storedIP, err := ps.crypt.Encrypt(ColumnTokenIP, clientIP)
+	if err != nil {
+		return fmt.Errorf("failed to update refresh token: %w", err)
+	}
+	tag, err := ps.pool.Exec(ps.queryContext(), updateRefreshTokenQuery, sessionID, oldHash, hashedToken, storedIP, ps.now(), expiresAt.UTC())
 	if err != nil {
 		return fmt.Errorf("failed to update refresh token: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update refresh token: %w", storage.ErrNotFound)
+	}
 	return nil
 }
 
-// Возвращает последний IP-адрес клиента для указанного пользователя.
+// Возвращает IP-адрес клиента последней использованной действующей сессии пользователя.
 //
 // Принимает:
 // - userID: идентификатор пользователя.
@@ -96,9 +479,11 @@ func (ps *PostgresStorage) UpdateRefreshToken(userID, hashedToken, clientIP stri
 // - ошибку, если не удалось получить IP-адрес.
 func (ps *PostgresStorage) GetLastIP(userID string) (string, error) {
 	var clientIP string
-	query := `SELECT ip_address FROM tokens WHERE user_id = $1`
-	err := ps.pool.QueryRow(context.Background(), query, userID).Scan(&clientIP)
+	err := ps.pool.QueryRow(ps.queryContext(), getLastIPQuery, userID, ps.now()).Scan(&clientIP)
 	if err != nil {
+		return "", fmt.Errorf("failed to get last IP: %w", notFound(err))
+	}
+	if clientIP, err = ps.crypt.Decrypt(ColumnTokenIP, clientIP); err != nil {
 		return "", fmt.Errorf("failed to get last IP: %w", err)
 	}
 	return clientIP, nil
@@ -114,10 +499,1324 @@ func (ps *PostgresStorage) GetLastIP(userID string) (string, error) {
 // - ошибку, если email не удалось получить.
 func (ps *PostgresStorage) GetUserEmail(userID string) (string, error) {
 	var email string
-	query := `SELECT email FROM users WHERE id = $1`
-	err := ps.pool.QueryRow(context.Background(), query, userID).Scan(&email)
+	err := ps.pool.QueryRow(ps.queryContext(), getUserEmailQuery, userID).Scan(&email)
 	if err != nil {
+		return "", fmt.Errorf("failed to get user email: %w", notFound(err))
+	}
+	if email, err = ps.crypt.Decrypt(ColumnUserEmail, email); err != nil {
 		return "", fmt.Errorf("failed to get user email: %w", err)
 	}
 	return email, nil
 }
+
+// Возвращает идентификатор пользователя и хеш его пароля по email.
+//
+// Принимает:
+// - email: email пользователя.
+//
+// Возвращает:
+// - идентификатор пользователя.
+// - bcrypt-хеш пароля.
+// - ошибку, если пользователь не найден или запрос не удался.
+func (ps *PostgresStorage) GetUserCredentials(email string) (string, string, error) {
+	var userID, passwordHash string
+	candidates := ps.crypt.DeterministicCandidates(ColumnUserEmail, email)
+	err := ps.pool.QueryRow(ps.queryContext(), getUserCredentialsQuery, candidates).Scan(&userID, &passwordHash)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get user credentials: %w", notFound(err))
+	}
+	return userID, passwordHash, nil
+}
+
+// Возвращает предпочитаемый язык пользователя из базы данных.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - язык пользователя или пустую строку, если он не задан.
+// - ошибку, если пользователь не найден или запрос не удался.
+func (ps *PostgresStorage) GetUserLocale(userID string) (string, error) {
+	var locale string
+	err := ps.pool.QueryRow(ps.queryContext(), getUserLocaleQuery, userID).Scan(&locale)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user locale: %w", notFound(err))
+	}
+	return locale, nil
+}
+
+// Возвращает версию токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - версию; 0, если она не повышалась.
+// - ошибку, если пользователь не найден.
+func (ps *PostgresStorage) GetTokenVersion(userID string) (int64, error) {
+	var version int64
+	err := ps.pool.QueryRow(ps.queryContext(), getTokenVersionQuery, userID).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token version: %w", notFound(err))
+	}
+	return version, nil
+}
+
+// Повышает версию токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - новую версию.
+// - ошибку, если пользователь не найден.
+func (ps *PostgresStorage) BumpTokenVersion(userID string) (int64, error) {
+	var version int64
+	err := ps.pool.QueryRow(ps.queryContext(), bumpTokenVersionQuery, userID).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump token version: %w", notFound(err))
+	}
+	return version, nil
+}
+
+// Удаляет все сессии пользователя (отзывает его refresh-токены).
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - ошибку, если не удалось удалить токен или сессия не найдена.
+func (ps *PostgresStorage) DeleteRefreshToken(userID string) error {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteRefreshTokenQuery, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete refresh token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete refresh token: %w", storage.ErrNotFound)
+	}
+	return nil
+}
+
+// Возвращает сессию по хешу refresh-токена.
+//
+// Принимает:
+// - refreshHash: хеш refresh-токена.
+//
+// Возвращает:
+// - сессию.
+// - storage.ErrExpired, если срок сессии истёк.
+// - ошибку, если сессия не найдена или её не удалось получить.
+func (ps *PostgresStorage) GetSessionByRefreshHash(refreshHash string) (storage.Session, error) {
+	var session storage.Session
+	err := ps.pool.QueryRow(ps.queryContext(), getSessionByRefreshHashQuery, refreshHash).
+		Scan(&session.ID, &session.UserID, &session.RefreshTokenHash, &session.ClientIP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+			&session.Device.UserAgent, &session.Device.Name, &session.Device.Platform)
+	if err != nil {
+		return storage.Session{}, fmt.Errorf("failed to get session by refresh hash: %w", notFound(err))
+	}
+	if !ps.now().Before(session.ExpiresAt) {
+		return storage.Session{}, fmt.Errorf("failed to get session by refresh hash: %w", storage.ErrExpired)
+	}
+	if session.ClientIP, err = ps.crypt.Decrypt(ColumnTokenIP, session.ClientIP); err != nil {
+		return storage.Session{}, fmt.Errorf("failed to get session by refresh hash: %w", err)
+	}
+	return session, nil
+}
+
+// Возвращает действующие сессии пользователя, начиная с последней использованной.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - сессии (пустой список, если их нет).
+// - ошибку, если сессии не удалось получить.
+func (ps *PostgresStorage) ListSessions(userID string) ([]storage.Session, error) {
+	rows, err := ps.pool.Query(ps.queryContext(), listSessionsQuery, userID, ps.now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []storage.Session{}
+	for rows.Next() {
+		var session storage.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.RefreshTokenHash, &session.ClientIP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+			&session.Device.UserAgent, &session.Device.Name, &session.Device.Platform)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		if session.ClientIP, err = ps.crypt.Decrypt(ColumnTokenIP, session.ClientIP); err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Возвращает действующие сессии всех пользователей, подходящие под условия.
+//
+// Принимает:
+// - filter: условия отбора.
+// - afterID: идентификатор последней сессии предыдущей страницы; пустая строка — с начала.
+// - limit: максимальное количество сессий.
+//
+// Возвращает:
+// - сессии, упорядоченные по идентификатору.
+// - ошибку, если запрос не удался.
+func (ps *PostgresStorage) FindSessions(filter storage.SessionFilter, afterID string, limit int) ([]storage.Session, error) {
+	if afterID == "" {
+		afterID = uuid.Nil.String()
+	}
+	userIDs := filter.UserIDs
+	if userIDs == nil {
+		userIDs = []string{}
+	}
+	var createdBefore *time.Time
+	if !filter.CreatedBefore.IsZero() {
+		createdBefore = &filter.CreatedBefore
+	}
+
+	rows, err := ps.pool.Query(ps.queryContext(), findSessionsQuery, ps.now(), afterID, userIDs, createdBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []storage.Session{}
+	for rows.Next() {
+		var session storage.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.RefreshTokenHash, &session.ClientIP, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+			&session.Device.UserAgent, &session.Device.Name, &session.Device.Platform)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		if session.ClientIP, err = ps.crypt.Decrypt(ColumnTokenIP, session.ClientIP); err != nil {
+			return nil, fmt.Errorf("failed to find sessions: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Удаляет сессию.
+//
+// Принимает:
+// - sessionID: идентификатор сессии.
+//
+// Возвращает:
+// - ошибку, если не удалось удалить сессию или она не найдена.
+func (ps *PostgresStorage) DeleteSession(sessionID string) error {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteSessionQuery, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete session: %w", storage.ErrNotFound)
+	}
+	return nil
+}
+
+// Удаляет сессию пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - sessionID: идентификатор сессии.
+//
+// Возвращает:
+// - storage.ErrNotFound, если сессии нет или она принадлежит другому пользователю.
+func (ps *PostgresStorage) DeleteUserSession(userID, sessionID string) error {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteUserSessionQuery, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete session: %w", storage.ErrNotFound)
+	}
+	return nil
+}
+
+// Сохраняет устройство сессии.
+//
+// Принимает:
+// - sessionID: идентификатор сессии.
+// - device: устройство клиента.
+//
+// Возвращает:
+// - ошибку, если не удалось обновить сессию или она не найдена.
+func (ps *PostgresStorage) SetSessionDevice(sessionID string, device storage.Device) error {
+	tag, err := ps.pool.Exec(ps.queryContext(), setSessionDeviceQuery, sessionID, device.UserAgent, device.Name, device.Platform)
+	if err != nil {
+		return fmt.Errorf("failed to set session device: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set session device: %w", storage.ErrNotFound)
+	}
+	return nil
+}
+
+// Заносит ключ отозванных access-токенов в список отзыва.
+//
+// Принимает:
+// - key: ключ (jti:<id> или sid:<id>).
+// - expiresAt: срок хранения; если ключ уже есть, сохраняется более поздний.
+//
+// Возвращает:
+// - ошибку, если запись не удалась.
+func (ps *PostgresStorage) DenyAccessToken(key string, expiresAt time.Time) error {
+	if _, err := ps.pool.Exec(ps.queryContext(), denyAccessTokenQuery, key, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("failed to deny access token: %w", err)
+	}
+	return nil
+}
+
+// Сообщает, есть ли в списке отзыва хотя бы один из ключей с неистёкшим сроком.
+//
+// Принимает:
+// - keys: проверяемые ключи.
+//
+// Возвращает:
+// - true, если хотя бы один ключ отозван.
+// - ошибку, если запрос не удался.
+func (ps *PostgresStorage) IsAccessTokenDenied(keys ...string) (bool, error) {
+	var denied bool
+	err := ps.pool.QueryRow(ps.queryContext(), isAccessTokenDeniedQuery, keys, ps.now()).Scan(&denied)
+	if err != nil {
+		return false, fmt.Errorf("failed to check access token denylist: %w", err)
+	}
+	return denied, nil
+}
+
+// Удаляет refresh-токены, истёкшие более retention назад.
+//
+// Принимает:
+// - retention: время хранения истёкших сессий; 0 — удалять сразу после истечения.
+// - limit: максимальное количество удаляемых строк за один вызов.
+//
+// Возвращает:
+// - количество удалённых строк.
+// - ошибку, если удаление не удалось.
+func (ps *PostgresStorage) DeleteExpiredRefreshTokens(retention time.Duration, limit int) (int64, error) {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteExpiredRefreshTokensQuery, limit, ps.now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Удаляет сессии, не использовавшиеся дольше idleTimeout.
+//
+// Принимает:
+// - idleTimeout: допустимое время неактивности.
+// - limit: максимальное количество удаляемых строк за один вызов.
+//
+// Возвращает:
+// - количество удалённых строк.
+// - ошибку, если удаление не удалось.
+func (ps *PostgresStorage) DeleteIdleRefreshTokens(idleTimeout time.Duration, limit int) (int64, error) {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteIdleRefreshTokensQuery, limit, ps.now().Add(-idleTimeout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idle refresh tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Удаляет истёкшие записи списка отзыва access-токенов.
+//
+// Принимает:
+// - limit: максимальное количество удаляемых строк за один вызов.
+//
+// Возвращает:
+// - количество удалённых строк.
+// - ошибку, если удаление не удалось.
+func (ps *PostgresStorage) DeleteExpiredDeniedAccessTokens(limit int) (int64, error) {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteExpiredDeniedAccessTokensQuery, limit, ps.now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired denylist entries: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Возвращает количество действующих сессий всех пользователей.
+//
+// Возвращает:
+// - количество сессий.
+// - ошибку, если запрос не удался.
+func (ps *PostgresStorage) CountSessions() (int64, error) {
+	var count int64
+	if err := ps.pool.QueryRow(ps.queryContext(), countSessionsQuery, ps.now()).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// Прибавляет количества запросов к суточной статистике в одной транзакции.
+//
+// Принимает:
+// - rows: количества по суткам, интерфейсу, операции и результату.
+//
+// Возвращает:
+// - ошибку, если запись не удалась; в этом случае ни одно количество не сохраняется.
+func (ps *PostgresStorage) AddUsage(rows []storage.UsageRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	ctx := ps.queryContext()
+	tx, err := ps.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to add usage: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	for _, row := range rows {
+		if _, err := tx.Exec(ctx, addUsageQuery, row.Day.UTC(), row.API, row.Operation, row.Result, row.Count); err != nil {
+			return fmt.Errorf("failed to add usage: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to add usage: %w", err)
+	}
+	return nil
+}
+
+// Возвращает суточную статистику запросов.
+//
+// Принимает:
+// - from: первые сутки периода.
+// - to: последние сутки периода (включительно).
+//
+// Возвращает:
+// - строки статистики (пустой список, если их нет).
+// - ошибку, если статистику не удалось получить.
+func (ps *PostgresStorage) ListUsage(from, to time.Time) ([]storage.UsageRow, error) {
+	rows, err := ps.pool.Query(ps.queryContext(), listUsageQuery, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []storage.UsageRow{}
+	for rows.Next() {
+		var row storage.UsageRow
+		if err := rows.Scan(&row.Day, &row.API, &row.Operation, &row.Result, &row.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		usage = append(usage, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+	return usage, nil
+}
+
+// Вычисляет и сохраняет сводку за сутки.
+//
+// Принимает:
+// - day: момент времени в пределах суток (UTC).
+//
+// Возвращает:
+// - сохранённую сводку.
+// - ошибку, если сводку не удалось вычислить или сохранить.
+func (ps *PostgresStorage) RollupDailyStats(day time.Time) (storage.DailyStats, error) {
+	start := day.UTC().Truncate(24 * time.Hour)
+	var stats storage.DailyStats
+	err := ps.pool.QueryRow(ps.queryContext(), rollupDailyStatsQuery, start, start.AddDate(0, 0, 1), ps.now()).
+		Scan(&stats.Day, &stats.ActiveUsers, &stats.NewUsers, &stats.Requests, &stats.RejectedRequests, &stats.FailedRequests)
+	if err != nil {
+		return storage.DailyStats{}, fmt.Errorf("failed to roll up daily stats: %w", err)
+	}
+	return stats, nil
+}
+
+// Возвращает суточные сводки.
+//
+// Принимает:
+// - from: первые сутки периода.
+// - to: последние сутки периода (включительно).
+//
+// Возвращает:
+// - сводки (пустой список, если их нет).
+// - ошибку, если сводки не удалось получить.
+func (ps *PostgresStorage) ListDailyStats(from, to time.Time) ([]storage.DailyStats, error) {
+	rows, err := ps.pool.Query(ps.queryContext(), listDailyStatsQuery, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daily stats: %w", err)
+	}
+	defer rows.Close()
+
+	list := []storage.DailyStats{}
+	for rows.Next() {
+		var stats storage.DailyStats
+		if err := rows.Scan(&stats.Day, &stats.ActiveUsers, &stats.NewUsers, &stats.Requests, &stats.RejectedRequests, &stats.FailedRequests); err != nil {
+			return nil, fmt.Errorf("failed to scan daily stats: %w", err)
+		}
+		list = append(list, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list daily stats: %w", err)
+	}
+	return list, nil
+}
+
+// Сохраняет новую доставку webhook.
+//
+// Принимает:
+// - delivery: доставка; Status, LastError, CreatedAt и UpdatedAt устанавливаются хранилищем.
+//
+// Возвращает:
+// - ошибку, если доставку не удалось сохранить.
+func (ps *PostgresStorage) EnqueueWebhook(delivery storage.WebhookDelivery) error {
+	_, err := ps.pool.Exec(ps.queryContext(), enqueueWebhookQuery,
+		delivery.ID, delivery.EventID, delivery.EventType, delivery.Endpoint, delivery.Payload,
+		delivery.Attempts, delivery.NextAttemptAt.UTC(), ps.now())
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook: %w", err)
+	}
+	return nil
+}
+
+// Возвращает ожидающие доставки webhook, время попытки которых наступило.
+//
+// Принимает:
+// - now: текущее время.
+// - limit: максимальное количество доставок.
+//
+// Возвращает:
+// - доставки, начиная с самых ранних.
+// - ошибку, если доставки не удалось получить.
+func (ps *PostgresStorage) DueWebhooks(now time.Time, limit int) ([]storage.WebhookDelivery, error) {
+	return ps.queryWebhooks("failed to select due webhooks", dueWebhooksQuery, now.UTC(), limit)
+}
+
+// Отмечает доставку webhook выполненной.
+//
+// Принимает:
+// - id: идентификатор доставки.
+// - attempts: количество выполненных попыток.
+//
+// Возвращает:
+// - ошибку, если доставка не найдена или обновление не удалось.
+func (ps *PostgresStorage) MarkWebhookDelivered(id string, attempts int) error {
+	return ps.execByID("failed to mark webhook delivered", markWebhookDeliveredQuery, id, attempts, ps.now())
+}
+
+// Назначает повторную попытку доставки webhook.
+//
+// Принимает:
+// - id: идентификатор доставки.
+// - attempts: количество выполненных попыток.
+// - nextAttemptAt: время следующей попытки.
+// - lastError: ошибка последней попытки.
+//
+// Возвращает:
+// - ошибку, если доставка не найдена или обновление не удалось.
+func (ps *PostgresStorage) RetryWebhook(id string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return ps.execByID("failed to schedule webhook retry", retryWebhookQuery, id, attempts, nextAttemptAt.UTC(), lastError, ps.now())
+}
+
+// Переносит доставку webhook в таблицу недоставленных.
+//
+// Принимает:
+// - id: идентификатор доставки.
+// - attempts: количество выполненных попыток.
+// - lastError: ошибка последней попытки.
+//
+// Возвращает:
+// - ошибку, если доставка не найдена или перенос не удался.
+func (ps *PostgresStorage) DeadLetterWebhook(id string, attempts int, lastError string) error {
+	return ps.execByID("failed to dead-letter webhook", deadLetterWebhookQuery, id, attempts, lastError, ps.now())
+}
+
+// Возвращает доставку webhook, в том числе недоставленную.
+//
+// Принимает:
+// - id: идентификатор доставки.
+//
+// Возвращает:
+// - доставку.
+// - ошибку, если доставка не найдена или запрос не удался.
+func (ps *PostgresStorage) GetWebhook(id string) (storage.WebhookDelivery, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return storage.WebhookDelivery{}, fmt.Errorf("failed to get webhook: %w", storage.ErrNotFound)
+	}
+	deliveries, err := ps.queryWebhooks("failed to get webhook", getWebhookQuery, id)
+	if err != nil {
+		return storage.WebhookDelivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return storage.WebhookDelivery{}, fmt.Errorf("failed to get webhook: %w", storage.ErrNotFound)
+	}
+	return deliveries[0], nil
+}
+
+// Возвращает недоставленные доставки webhook.
+//
+// Принимает:
+// - limit: максимальное количество доставок.
+//
+// Возвращает:
+// - доставки, начиная с последних.
+// - ошибку, если доставки не удалось получить.
+func (ps *PostgresStorage) ListDeadWebhooks(limit int) ([]storage.WebhookDelivery, error) {
+	return ps.queryWebhooks("failed to list dead webhooks", listDeadWebhooksQuery, limit)
+}
+
+// Возвращает доставку webhook в очередь и сбрасывает счётчик попыток.
+//
+// Принимает:
+// - id: идентификатор доставки.
+// - now: время попытки.
+//
+// Возвращает:
+// - ошибку, если доставка не найдена или обновление не удалось.
+func (ps *PostgresStorage) RedeliverWebhook(id string, now time.Time) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("failed to redeliver webhook: %w", storage.ErrNotFound)
+	}
+	ctx := ps.queryContext()
+	tx, err := ps.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to redeliver webhook: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, redeliverWebhookQuery, id, now.UTC())
+	if err == nil && tag.RowsAffected() == 0 {
+		tag, err = tx.Exec(ctx, restoreDeadWebhookQuery, id, now.UTC())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to redeliver webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to redeliver webhook: %w", storage.ErrNotFound)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to redeliver webhook: %w", err)
+	}
+	return nil
+}
+
+// Удаляет доставки webhook, выполненные раньше before.
+//
+// Принимает:
+// - before: граница времени выполнения.
+// - limit: максимальное количество удаляемых строк за один вызов.
+//
+// Возвращает:
+// - количество удалённых строк.
+// - ошибку, если удаление не удалось.
+func (ps *PostgresStorage) DeleteDeliveredWebhooks(before time.Time, limit int) (int64, error) {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteDeliveredWebhooksQuery, limit, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete delivered webhooks: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Выполняет изменение одной строки с идентификатором UUID (доставки webhook,
+// события outbox).
+func (ps *PostgresStorage) execByID(message, query, id string, args ...any) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("%s: %w", message, storage.ErrNotFound)
+	}
+	tag, err := ps.pool.Exec(ps.queryContext(), query, append([]any{id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", message, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", message, storage.ErrNotFound)
+	}
+	return nil
+}
+
+// Выполняет запрос, возвращающий доставки webhook.
+func (ps *PostgresStorage) queryWebhooks(message, query string, args ...any) ([]storage.WebhookDelivery, error) {
+	rows, err := ps.pool.Query(ps.queryContext(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", message, err)
+	}
+	defer rows.Close()
+
+	deliveries := []storage.WebhookDelivery{}
+	for rows.Next() {
+		var d storage.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.EventID, &d.EventType, &d.Endpoint, &d.Payload, &d.Status,
+			&d.Attempts, &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		if d.Status != storage.WebhookPending {
+			d.NextAttemptAt = time.Time{}
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", message, err)
+	}
+	return deliveries, nil
+}
+
+// Сохраняет запись журнала аудита.
+//
+// Принимает:
+// - event: запись; Seq назначается базой данных.
+//
+// Возвращает:
+// - ошибку, если запись не удалось сохранить.
+func (ps *PostgresStorage) AppendAudit(event storage.AuditEvent) error {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event details: %w", err)
+	}
+	if event.Details == nil {
+		details = []byte("{}")
+	}
+	_, err = ps.pool.Exec(ps.queryContext(), appendAuditQuery, event.Type, event.Severity, event.Time.UTC(),
+		event.UserID, event.SessionID, event.ClientIP, string(details))
+	if err != nil {
+		return fmt.Errorf("failed to append audit event: %w", err)
+	}
+	return nil
+}
+
+// Возвращает записи журнала аудита после afterSeq.
+//
+// Номера назначаются последовательностью до фиксации транзакции, поэтому
+// запись с меньшим номером может стать видимой позже записи с большим;
+// граница before должна отставать от текущего времени, чтобы такие записи
+// не были пропущены.
+//
+// Принимает:
+// - afterSeq: номер последней обработанной записи.
+// - before: граница времени записей.
+// - limit: максимальное количество записей.
+//
+// Возвращает:
+// - записи, упорядоченные по номеру.
+// - ошибку, если записи не удалось получить.
+func (ps *PostgresStorage) ListAuditAfter(afterSeq int64, before time.Time, limit int) ([]storage.AuditEvent, error) {
+	rows, err := ps.pool.Query(ps.queryContext(), listAuditAfterQuery, afterSeq, before.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []storage.AuditEvent{}
+	for rows.Next() {
+		var e storage.AuditEvent
+		var details []byte
+		if err := rows.Scan(&e.Seq, &e.Type, &e.Severity, &e.Time, &e.UserID, &e.SessionID, &e.ClientIP, &details); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return nil, fmt.Errorf("failed to decode audit event details: %w", err)
+		}
+		if len(e.Details) == 0 {
+			e.Details = nil
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, nil
+}
+
+// Возвращает номер последней выгруженной записи журнала аудита.
+//
+// Принимает:
+// - name: имя выгрузки.
+//
+// Возвращает:
+// - номер записи; 0, если выгрузок не было.
+// - ошибку, если запрос не удался.
+func (ps *PostgresStorage) GetAuditCheckpoint(name string) (int64, error) {
+	var seq int64
+	err := ps.pool.QueryRow(ps.queryContext(), getAuditCheckpointQuery, name).Scan(&seq)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get audit checkpoint: %w", err)
+	}
+	return seq, nil
+}
+
+// Сохраняет номер последней выгруженной записи журнала аудита.
+//
+// Принимает:
+// - name: имя выгрузки.
+// - seq: номер записи.
+//
+// Возвращает:
+// - ошибку, если номер не удалось сохранить.
+func (ps *PostgresStorage) SaveAuditCheckpoint(name string, seq int64) error {
+	if _, err := ps.pool.Exec(ps.queryContext(), saveAuditCheckpointQuery, name, seq, ps.now()); err != nil {
+		return fmt.Errorf("failed to save audit checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Удаляет записи журнала аудита с номером не больше upToSeq и временем раньше before.
+//
+// Принимает:
+// - upToSeq: номер последней удаляемой записи.
+// - before: граница времени записей.
+// - limit: максимальное количество удаляемых строк за один вызов.
+//
+// Возвращает:
+// - количество удалённых строк.
+// - ошибку, если удаление не удалось.
+func (ps *PostgresStorage) DeleteAuditEvents(upToSeq int64, before time.Time, limit int) (int64, error) {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteAuditEventsQuery, upToSeq, before.UTC(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete audit events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Возвращает данные ACME (сертификат, ключ или данные проверки) по ключу.
+//
+// Принимает:
+// - key: ключ данных.
+//
+// Возвращает:
+// - данные.
+// - storage.ErrNotFound, если данных нет; ошибку, если их не удалось прочитать.
+func (ps *PostgresStorage) GetACMEData(key string) ([]byte, error) {
+	var data []byte
+	if err := ps.pool.QueryRow(ps.queryContext(), getACMEDataQuery, key).Scan(&data); err != nil {
+		return nil, fmt.Errorf("failed to get ACME data: %w", notFound(err))
+	}
+	plaintext, err := ps.crypt.Decrypt(ColumnACMEData, string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt ACME data %s: %w", key, err)
+	}
+	return []byte(plaintext), nil
+}
+
+// Сохраняет данные ACME по ключу. При включённом шифровании столбцов данные
+// (в том числе закрытые ключи) шифруются.
+//
+// Принимает:
+// - key: ключ данных.
+// - data: данные.
+//
+// Возвращает:
+// - ошибку, если данные не удалось сохранить.
+func (ps *PostgresStorage) SaveACMEData(key string, data []byte) error {
+	stored, err := ps.crypt.Encrypt(ColumnACMEData, string(data))
+	if err != nil {
+		return err
+	}
+	if _, err := ps.pool.Exec(ps.queryContext(), saveACMEDataQuery, key, []byte(stored), ps.now()); err != nil {
+		return fmt.Errorf("failed to save ACME data: %w", err)
+	}
+	return nil
+}
+
+// Удаляет данные ACME по ключу.
+//
+// Принимает:
+// - key: ключ данных.
+//
+// Возвращает:
+// - ошибку, если данные не удалось удалить.
+func (ps *PostgresStorage) DeleteACMEData(key string) error {
+	if _, err := ps.pool.Exec(ps.queryContext(), deleteACMEDataQuery, key); err != nil {
+		return fmt.Errorf("failed to delete ACME data: %w", err)
+	}
+	return nil
+}
+
+// Учитывает неудачную попытку обновления токенов пользователем.
+//
+// Попытка, сделанная позже window после начала окна, начинает новое окно.
+// Счётчик и запрет меняются одним запросом, поэтому попытки, одновременно
+// учитываемые несколькими репликами, не теряются.
+//
+// Принимает:
+// - userID: идентификатор пользователя (UUID).
+// - window: длина окна подсчёта попыток.
+// - maxFailures: число попыток в окне, после которого обновление запрещается.
+// - cooldown: длительность запрета.
+//
+// Возвращает:
+// - момент окончания запрета или нулевое время, если запрета нет.
+// - ошибку, если попытку не удалось учесть.
+func (ps *PostgresStorage) AddRefreshFailure(userID string, window time.Duration, maxFailures int, cooldown time.Duration) (time.Time, error) {
+	now := ps.now()
+	var lockedUntil *time.Time
+	err := ps.pool.QueryRow(ps.queryContext(), addRefreshFailureQuery,
+		userID, now, now.Add(-window), maxFailures, now.Add(cooldown)).Scan(&lockedUntil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to add refresh failure: %w", err)
+	}
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *lockedUntil, nil
+}
+
+// Возвращает момент окончания запрета обновления токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя (UUID).
+//
+// Возвращает:
+// - момент окончания запрета или нулевое время, если запрета не было.
+// - ошибку, если запрет не удалось прочитать.
+func (ps *PostgresStorage) GetRefreshCooldown(userID string) (time.Time, error) {
+	var lockedUntil *time.Time
+	err := ps.pool.QueryRow(ps.queryContext(), getRefreshCooldownQuery, userID).Scan(&lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get refresh cooldown: %w", err)
+	}
+	return *lockedUntil, nil
+}
+
+// Удаляет неудачные попытки и запрет обновления токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - ошибку, если удаление не удалось.
+func (ps *PostgresStorage) ResetRefreshFailures(userID string) error {
+	if _, err := ps.pool.Exec(ps.queryContext(), resetRefreshFailuresQuery, userID); err != nil {
+		return fmt.Errorf("failed to reset refresh failures: %w", err)
+	}
+	return nil
+}
+
+// Возвращает неудачные попытки входа по ключу.
+//
+// Принимает:
+// - key: ключ учётной записи или адреса клиента.
+//
+// Возвращает:
+// - попытки; нулевое значение, если неудачных попыток не было.
+// - ошибку, если попытки не удалось прочитать.
+func (ps *PostgresStorage) GetLoginAttempt(key string) (storage.LoginAttempt, error) {
+	attempt, err := scanLoginAttempt(ps.pool.QueryRow(ps.queryContext(), getLoginAttemptQuery, key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.LoginAttempt{}, nil
+	}
+	if err != nil {
+		return storage.LoginAttempt{}, fmt.Errorf("failed to get login attempt: %w", err)
+	}
+	return attempt, nil
+}
+
+// Учитывает неудачную попытку входа одним запросом, поэтому попытки,
+// одновременно учитываемые несколькими репликами, не теряются.
+//
+// Принимает:
+// - key: ключ учётной записи или адреса клиента.
+// - resetAfter: время после последней неудачи, по истечении которого счёт начинается заново.
+//
+// Возвращает:
+// - попытки после учёта.
+// - ошибку, если попытку не удалось учесть.
+func (ps *PostgresStorage) AddLoginFailure(key string, resetAfter time.Duration) (storage.LoginAttempt, error) {
+	now := ps.now()
+	attempt, err := scanLoginAttempt(ps.pool.QueryRow(ps.queryContext(), addLoginFailureQuery, key, now, now.Add(-resetAfter)))
+	if err != nil {
+		return storage.LoginAttempt{}, fmt.Errorf("failed to add login failure: %w", err)
+	}
+	return attempt, nil
+}
+
+// Блокирует вход по ключу.
+//
+// Принимает:
+// - key: ключ учётной записи или адреса клиента.
+// - until: момент окончания блокировки.
+//
+// Возвращает:
+// - ошибку, если блокировку не удалось сохранить.
+func (ps *PostgresStorage) LockLogin(key string, until time.Time) error {
+	if _, err := ps.pool.Exec(ps.queryContext(), lockLoginQuery, key, until.UTC()); err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	return nil
+}
+
+// Удаляет неудачные попытки входа и блокировку по ключу.
+//
+// Принимает:
+// - key: ключ учётной записи или адреса клиента.
+//
+// Возвращает:
+// - ошибку, если попытки не удалось удалить.
+func (ps *PostgresStorage) ResetLoginAttempts(key string) error {
+	if _, err := ps.pool.Exec(ps.queryContext(), resetLoginAttemptsQuery, key); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
+
+// Удаляет устаревшие записи о неудачных попытках входа.
+//
+// Принимает:
+// - before: граница времени последней неудачи.
+// - limit: максимальное количество удаляемых строк за один вызов.
+//
+// Возвращает:
+// - количество удалённых строк.
+// - ошибку, если удаление не удалось.
+func (ps *PostgresStorage) DeleteLoginAttempts(before time.Time, limit int) (int64, error) {
+	tag, err := ps.pool.Exec(ps.queryContext(), deleteLoginAttemptsQuery, limit, before.UTC(), ps.now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete login attempts: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Отключает или включает учётную запись пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - disabled: true — отключить, false — включить.
+//
+// Возвращает:
+// - ошибку, если пользователь не найден или обновление не удалось.
+func (ps *PostgresStorage) SetUserDisabled(userID string, disabled bool) error {
+	query, args := setUserEnabledQuery, []any{userID}
+	if disabled {
+		query, args = setUserDisabledQuery, []any{userID, ps.now()}
+	}
+	tag, err := ps.pool.Exec(ps.queryContext(), query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to set user disabled: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set user disabled: %w", storage.ErrNotFound)
+	}
+	return nil
+}
+
+// Возвращает время отключения учётной записи пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - время отключения; нулевое время, если учётная запись включена.
+// - ошибку, если пользователь не найден или запрос не удался.
+func (ps *PostgresStorage) GetUserDisabledAt(userID string) (time.Time, error) {
+	var disabledAt *time.Time
+	err := ps.pool.QueryRow(ps.queryContext(), getUserDisabledAtQuery, userID).Scan(&disabledAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get user disabled time: %w", notFound(err))
+	}
+	if disabledAt == nil {
+		return time.Time{}, nil
+	}
+	return disabledAt.UTC(), nil
+}
+
+// Устанавливает хеш пароля пользователя и отмечает время смены пароля.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - passwordHash: хеш пароля.
+//
+// Возвращает:
+// - ошибку, если пользователь не найден или обновление не удалось.
+func (ps *PostgresStorage) SetPassword(userID, passwordHash string) error {
+	tag, err := ps.pool.Exec(ps.queryContext(), setPasswordQuery, userID, passwordHash, ps.now())
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set password: %w", storage.ErrNotFound)
+	}
+	return nil
+}
+
+// Возвращает время последней смены пароля пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - время смены; нулевое время, если оно не известно.
+// - ошибку, если пользователь не найден или запрос не удался.
+func (ps *PostgresStorage) GetPasswordChangedAt(userID string) (time.Time, error) {
+	var changedAt *time.Time
+	err := ps.pool.QueryRow(ps.queryContext(), getPasswordChangedAtQuery, userID).Scan(&changedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get password change time: %w", notFound(err))
+	}
+	if changedAt == nil {
+		return time.Time{}, nil
+	}
+	return changedAt.UTC(), nil
+}
+
+// Ротирует refresh-токен сессии и сохраняет события outbox в одной транзакции.
+//
+// Принимает:
+// - sessionID, oldHash, hashedToken, clientIP, expiresAt: как у UpdateRefreshToken.
+// - events: события; Attempts, NextAttemptAt, LastError и CreatedAt устанавливаются хранилищем.
+//
+// Возвращает:
+// - ошибку, если сессия не найдена или токен уже ротирован (события тогда не
+// сохраняются) или запись не удалась.
+func (ps *PostgresStorage) UpdateRefreshTokenWithEvents(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time, events []storage.OutboxEvent) error {
+	storedIP, err := ps.crypt.Encrypt(ColumnTokenIP, clientIP)
+	if err != nil {
+		return fmt.Errorf("failed to update refresh token: %w", err)
+	}
+	ctx := ps.queryContext()
+	tx, err := ps.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update refresh token: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	now := ps.now()
+	tag, err := tx.Exec(ctx, updateRefreshTokenQuery, sessionID, oldHash, hashedToken, storedIP, now, expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to update refresh token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update refresh token: %w", storage.ErrNotFound)
+	}
+	for _, event := range events {
+		if _, err := tx.Exec(ctx, insertOutboxEventQuery, event.ID, event.Type, event.Payload, now); err != nil {
+			return fmt.Errorf("failed to save outbox event: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to update refresh token: %w", err)
+	}
+	return nil
+}
+
+// Возвращает события outbox, время попытки которых наступило.
+//
+// Принимает:
+// - now: текущее время.
+// - limit: максимальное количество событий.
+//
+// Возвращает:
+// - события, начиная с самых ранних.
+// - ошибку, если события не удалось получить.
+func (ps *PostgresStorage) DueOutboxEvents(now time.Time, limit int) ([]storage.OutboxEvent, error) {
+	rows, err := ps.pool.Query(ps.queryContext(), dueOutboxEventsQuery, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select due outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []storage.OutboxEvent{}
+	for rows.Next() {
+		var e storage.OutboxEvent
+		if err := rows.Scan(&e.ID, &e.Type, &e.Payload, &e.Attempts, &e.NextAttemptAt, &e.LastError, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to select due outbox events: %w", err)
+	}
+	return events, nil
+}
+
+// Удаляет опубликованное событие outbox.
+//
+// Принимает:
+// - id: идентификатор события.
+//
+// Возвращает:
+// - ошибку, если событие не найдено или удаление не удалось.
+func (ps *PostgresStorage) DeleteOutboxEvent(id string) error {
+	return ps.execByID("failed to delete outbox event", deleteOutboxEventQuery, id)
+}
+
+// Назначает повторную попытку публикации события outbox.
+//
+// Принимает:
+// - id: идентификатор события.
+// - attempts: количество выполненных попыток.
+// - nextAttemptAt: время следующей попытки.
+// - lastError: ошибка последней попытки.
+//
+// Возвращает:
+// - ошибку, если событие не найдено или обновление не удалось.
+func (ps *PostgresStorage) RetryOutboxEvent(id string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return ps.execByID("failed to schedule outbox retry", retryOutboxEventQuery, id, attempts, nextAttemptAt.UTC(), lastError)
+}
+
+// Сохраняет запись журнала действий.
+//
+// Принимает:
+// - record: запись; ID назначается последовательностью.
+//
+// Возвращает:
+// - ошибку, если запись не удалось сохранить.
+func (ps *PostgresStorage) AppendAuditRecord(record storage.AuditRecord) error {
+	details, err := json.Marshal(record.Details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record details: %w", err)
+	}
+	if record.Details == nil {
+		details = []byte("{}")
+	}
+	_, err = ps.pool.Exec(ps.queryContext(), appendAuditRecordQuery, record.Time.UTC(), record.Action, record.Actor,
+		record.UserID, record.SessionID, record.ClientIP, record.UserAgent, record.Outcome, string(details))
+	if err != nil {
+		return fmt.Errorf("failed to append audit record: %w", err)
+	}
+	return nil
+}
+
+// Возвращает записи журнала действий, удовлетворяющие условиям.
+//
+// Принимает:
+// - query: условия выборки.
+//
+// Возвращает:
+// - записи, начиная с последних.
+// - ошибку, если записи не удалось получить.
+func (ps *PostgresStorage) QueryAuditRecords(query storage.AuditQuery) ([]storage.AuditRecord, error) {
+	var from, to *time.Time
+	if !query.From.IsZero() {
+		t := query.From.UTC()
+		from = &t
+	}
+	if !query.To.IsZero() {
+		t := query.To.UTC()
+		to = &t
+	}
+	rows, err := ps.pool.Query(ps.queryContext(), queryAuditRecordsQuery, query.Action, query.Actor, query.UserID,
+		query.Outcome, from, to, query.BeforeID, query.Limit, query.Actions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []storage.AuditRecord{}
+	for rows.Next() {
+		var r storage.AuditRecord
+		var details []byte
+		if err := rows.Scan(&r.ID, &r.Time, &r.Action, &r.Actor, &r.UserID, &r.SessionID, &r.ClientIP,
+			&r.UserAgent, &r.Outcome, &details); err != nil {
+			return nil, fmt.Errorf("failed to scan audit record: %w", err)
+		}
+		if err := json.Unmarshal(details, &r.Details); err != nil {
+			return nil, fmt.Errorf("failed to decode audit record details: %w", err)
+		}
+		if len(r.Details) == 0 {
+			r.Details = nil
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query audit records: %w", err)
+	}
+	return records, nil
+}
+
+// Читает строку login_attempts.
+func scanLoginAttempt(row pgx.Row) (storage.LoginAttempt, error) {
+	var attempt storage.LoginAttempt
+	var lockedUntil *time.Time
+	if err := row.Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil); err != nil {
+		return storage.LoginAttempt{}, err
+	}
+	if lockedUntil != nil {
+		attempt.LockedUntil = *lockedUntil
+	}
+	return attempt, nil
+}
+
+// Приводит pgx.ErrNoRows к storage.ErrNotFound, остальные ошибки возвращает без изменений.
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.ErrNotFound
+	}
+	return err
+}
+
+// Перешифровывает основным ключом не более limit значений каждого шифруемого
+// столбца, записанных открыто или прежним ключом, и возвращает их количество.
+// Вызывается фоновой задачей после включения шифрования или ротации ключа.
+//
+// Принимает:
+// - limit: максимальное число значений каждого столбца за вызов.
+//
+// Возвращает:
+// - количество перешифрованных значений.
+// - ошибку, если значения не удалось прочитать, расшифровать или записать.
+func (ps *PostgresStorage) ReencryptColumns(limit int) (int64, error) {
+	if ps.crypt == nil {
+		return 0, nil
+	}
+
+	ips, err := ps.reencrypt(selectStaleTokenIPsQuery, reencryptTokenIPQuery, ColumnTokenIP, limit, func(value string) (string, error) {
+		return ps.crypt.Encrypt(ColumnTokenIP, value)
+	})
+	if err != nil {
+		return ips, err
+	}
+	emails, err := ps.reencrypt(selectStaleEmailsQuery, reencryptEmailQuery, ColumnUserEmail, limit, func(value string) (string, error) {
+		return ps.crypt.EncryptDeterministic(ColumnUserEmail, value), nil
+	})
+	return ips + emails, err
+}
+
+// Перешифровывает значения одного столбца.
+//
+// Значение обновляется, только если не изменилось с момента чтения, поэтому
+// задача не затирает данные, записанные параллельно.
+func (ps *PostgresStorage) reencrypt(selectQuery, updateQuery, column string, limit int, encrypt func(string) (string, error)) (int64, error) {
+	ctx := ps.queryContext()
+	rows, err := ps.pool.Query(ctx, selectQuery, limit, ps.crypt.CurrentPrefix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to select %s for re-encryption: %w", column, err)
+	}
+	type row struct{ id, value string }
+	var stale []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan %s: %w", column, err)
+		}
+		stale = append(stale, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to select %s for re-encryption: %w", column, err)
+	}
+
+	var updated int64
+	for _, r := range stale {
+		plaintext, err := ps.crypt.Decrypt(column, r.value)
+		if err != nil {
+			return updated, fmt.Errorf("failed to decrypt %s of %s: %w", column, r.id, err)
+		}
+		encrypted, err := encrypt(plaintext)
+		if err != nil {
+			return updated, err
+		}
+		tag, err := ps.pool.Exec(ctx, updateQuery, r.id, r.value, encrypted)
+		if err != nil {
+			return updated, fmt.Errorf("failed to re-encrypt %s of %s: %w", column, r.id, err)
+		}
+		updated += tag.RowsAffected()
+	}
+	return updated, nil
+}
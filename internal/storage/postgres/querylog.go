@@ -0,0 +1,228 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+
+	"auth_service/internal/metrics"
+	"auth_service/internal/tracing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	queryDuration = metrics.NewHistogramVec(
+		"auth_storage_query_duration_seconds",
+		"Duration of PostgreSQL queries by operation.",
+		metrics.DurationBuckets,
+		"operation",
+	)
+	slowQueries = metrics.NewCounterVec(
+		"auth_storage_slow_queries_total",
+		"PostgreSQL queries slower than the configured threshold by operation.",
+		"operation",
+	)
+)
+
+// Имена операций по тексту запроса; запросы, которых нет в списке, учитываются как "other".
+var queryOperations = map[string]string{
+	saveRefreshTokenQuery:                "save_refresh_token",
+	getRefreshTokenQuery:                 "get_refresh_token",
+	updateRefreshTokenQuery:              "update_refresh_token",
+	getLastIPQuery:                       "get_last_ip",
+	getUserEmailQuery:                    "get_user_email",
+	getUserLocaleQuery:                   "get_user_locale",
+	deleteRefreshTokenQuery:              "delete_refresh_token",
+	deleteSessionQuery:                   "delete_session",
+	getSessionByRefreshHashQuery:         "get_session_by_refresh_hash",
+	listSessionsQuery:                    "list_sessions",
+	findSessionsQuery:                    "find_sessions",
+	deleteExpiredRefreshTokensQuery:      "delete_expired_refresh_tokens",
+	deleteIdleRefreshTokensQuery:         "delete_idle_refresh_tokens",
+	denyAccessTokenQuery:                 "deny_access_token",
+	isAccessTokenDeniedQuery:             "is_access_token_denied",
+	selectStaleTokenIPsQuery:             "select_stale_token_ips",
+	reencryptTokenIPQuery:                "reencrypt_token_ip",
+	selectStaleEmailsQuery:               "select_stale_emails",
+	reencryptEmailQuery:                  "reencrypt_email",
+	deleteExpiredDeniedAccessTokensQuery: "delete_expired_denied_access_tokens",
+	countSessionsQuery:                   "count_sessions",
+	addUsageQuery:                        "add_usage",
+	listUsageQuery:                       "list_usage",
+	rollupDailyStatsQuery:                "rollup_daily_stats",
+	listDailyStatsQuery:                  "list_daily_stats",
+	enqueueWebhookQuery:                  "enqueue_webhook",
+	dueWebhooksQuery:                     "due_webhooks",
+	markWebhookDeliveredQuery:            "mark_webhook_delivered",
+	retryWebhookQuery:                    "retry_webhook",
+	deadLetterWebhookQuery:               "dead_letter_webhook",
+	getWebhookQuery:                      "get_webhook",
+	listDeadWebhooksQuery:                "list_dead_webhooks",
+	redeliverWebhookQuery:                "redeliver_webhook",
+	restoreDeadWebhookQuery:              "restore_dead_webhook",
+	deleteDeliveredWebhooksQuery:         "delete_delivered_webhooks",
+	getACMEDataQuery:                     "get_acme_data",
+	saveACMEDataQuery:                    "save_acme_data",
+	deleteACMEDataQuery:                  "delete_acme_data",
+	bumpTokenVersionQuery:                "bump_token_version",
+	getTokenVersionQuery:                 "get_token_version",
+	getUserCredentialsQuery:              "get_user_credentials",
+	setPasswordQuery:                     "set_password",
+	getPasswordChangedAtQuery:            "get_password_changed_at",
+	getUserDisabledAtQuery:               "get_user_disabled_at",
+	setUserDisabledQuery:                 "set_user_disabled",
+	setUserEnabledQuery:                  "set_user_enabled",
+	deleteUserSessionQuery:               "delete_user_session",
+	setSessionDeviceQuery:                "set_session_device",
+	addRefreshFailureQuery:               "add_refresh_failure",
+	getRefreshCooldownQuery:              "get_refresh_cooldown",
+	resetRefreshFailuresQuery:            "reset_refresh_failures",
+	lockLoginQuery:                       "lock_login",
+	getLoginAttemptQuery:                 "get_login_attempt",
+	addLoginFailureQuery:                 "add_login_failure",
+	resetLoginAttemptsQuery:              "reset_login_attempts",
+	deleteLoginAttemptsQuery:             "delete_login_attempts",
+	appendAuditQuery:                     "append_audit",
+	queryAuditRecordsQuery:               "query_audit_records",
+	deleteAuditEventsQuery:               "delete_audit_events",
+	appendAuditRecordQuery:               "append_audit_record",
+	listAuditAfterQuery:                  "list_audit_after",
+	getAuditCheckpointQuery:              "get_audit_checkpoint",
+	saveAuditCheckpointQuery:             "save_audit_checkpoint",
+	insertOutboxEventQuery:               "insert_outbox_event",
+	dueOutboxEventsQuery:                 "due_outbox_events",
+	retryOutboxEventQuery:                "retry_outbox_event",
+	deleteOutboxEventQuery:               "delete_outbox_event",
+	"begin":                              "begin",
+	"commit":                             "commit",
+	"rollback":                           "rollback",
+}
+
+// Журнал запросов pgx: учитывает длительность каждого запроса в метриках,
+// записывает спан запроса в трассировку из его контекста (см. tracing.Record)
+// и записывает в лог запросы, выполнявшиеся дольше порога.
+//
+// В лог попадают имя операции и типы параметров, но не их значения:
+// параметры содержат хеши токенов, адреса и другие чувствительные данные.
+type QueryLogger struct {
+	log       *slog.Logger
+	threshold time.Duration
+}
+
+// Создаёт журнал запросов для pgx.ConnConfig.Logger.
+//
+// Принимает:
+// - log: логгер для медленных запросов.
+// - threshold: порог длительности медленного запроса; 0 — медленные запросы не записываются.
+//
+// Возвращает:
+// - указатель на QueryLogger.
+func NewQueryLogger(log *slog.Logger, threshold time.Duration) *QueryLogger {
+	return &QueryLogger{log: log, threshold: threshold}
+}
+
+// Обрабатывает сообщение pgx о выполненном запросе.
+//
+// Реализует pgx.Logger; сообщения, не относящиеся к выполнению запросов
+// (подключение, закрытие соединения), игнорируются.
+func (l *QueryLogger) Log(ctx context.Context, _ pgx.LogLevel, msg string, data map[string]interface{}) {
+	elapsed, ok := data["time"].(time.Duration)
+	if !ok {
+		return
+	}
+
+	var operation string
+	switch msg {
+	case "Query", "Exec":
+		sql, _ := data["sql"].(string)
+		operation = OperationName(sql)
+	case "SendBatch":
+		operation = "batch"
+	case "CopyFrom":
+		operation = "copy_from"
+	default:
+		return
+	}
+
+	queryDuration.Observe(elapsed.Seconds(), operation)
+	queryErr, _ := data["err"].(error)
+	if tracing.Recording(ctx) {
+		end := time.Now()
+		tracing.Record(ctx, tracing.KindClient, "db "+operation, end.Add(-elapsed), end, queryErr,
+			tracing.String("db.system", "postgresql"),
+			tracing.String("db.operation.name", operation),
+		)
+	}
+	if l.threshold <= 0 || elapsed < l.threshold {
+		return
+	}
+	slowQueries.Inc(operation)
+
+	attrs := []any{
+		slog.String("operation", operation),
+		slog.Duration("duration", elapsed),
+	}
+	if args, ok := data["args"].([]interface{}); ok {
+		attrs = append(attrs, slog.Any("args", ArgShapes(args)))
+	}
+	if rows, ok := data["rowCount"]; ok {
+		attrs = append(attrs, slog.Any("rows", rows))
+	}
+	if queryErr != nil {
+		attrs = append(attrs, slog.String("error", queryErr.Error()))
+	}
+	if operation == "other" {
+		// Текст запроса без параметров не содержит значений и помогает найти его в коде.
+		sql, _ := data["sql"].(string)
+		attrs = append(attrs, slog.String("sql", strings.Join(strings.Fields(sql), " ")))
+	}
+	l.log.WarnContext(ctx, "Slow query", attrs...)
+}
+
+// Возвращает имя операции хранилища по тексту запроса.
+//
+// Принимает:
+// - sql: текст запроса.
+//
+// Возвращает:
+// - имя операции или "other" для неизвестного запроса.
+func OperationName(sql string) string {
+	if operation, ok := queryOperations[sql]; ok {
+		return operation
+	}
+	if operation, ok := queryOperations[strings.ToLower(strings.TrimSpace(sql))]; ok {
+		return operation
+	}
+	return "other"
+}
+
+// Описывает параметры запроса без их значений.
+//
+// Для каждого параметра возвращается его тип, для срезов — ещё и длина,
+// например "string", "time.Time", "[]string[3]", "nil".
+//
+// Принимает:
+// - args: параметры запроса.
+//
+// Возвращает:
+// - описания параметров в том же порядке.
+func ArgShapes(args []interface{}) []string {
+	shapes := make([]string, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			shapes[i] = "nil"
+			continue
+		}
+		v := reflect.ValueOf(arg)
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			shapes[i] = fmt.Sprintf("%T[%d]", arg, v.Len())
+			continue
+		}
+		shapes[i] = fmt.Sprintf("%T", arg)
+	}
+	return shapes
+}
@@ -0,0 +1,183 @@
+package postgres_test
+
+import (
+	"auth_service/internal/storage/postgres"
+	"auth_service/internal/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка определения имени операции по тексту запроса.
+func TestOperationName(t *testing.T) {
+	assert.Equal(t, "get_user_email", postgres.OperationName(`SELECT email FROM users WHERE id = $1`))
+	assert.Equal(t, "commit", postgres.OperationName("commit"))
+	assert.Equal(t, "other", postgres.OperationName(`SELECT 1`))
+}
+
+// Проверка того, что у каждого запроса пакета (константы *Query) есть имя
+// операции: иначе его длительность и медленные запуски учитываются как "other".
+func TestOperationName_AllQueries(t *testing.T) {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	require.NoError(t, err)
+
+	// Строковые константы пакета; запросы собираются из литералов и других констант.
+	consts := make(map[string]ast.Expr)
+	for _, file := range packages["postgres"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				value := spec.(*ast.ValueSpec)
+				for i, ident := range value.Names {
+					if i < len(value.Values) {
+						consts[ident.Name] = value.Values[i]
+					}
+				}
+			}
+		}
+	}
+	var eval func(expr ast.Expr) string
+	eval = func(expr ast.Expr) string {
+		switch e := expr.(type) {
+		case *ast.BasicLit:
+			s, err := strconv.Unquote(e.Value)
+			require.NoError(t, err)
+			return s
+		case *ast.Ident:
+			value, ok := consts[e.Name]
+			require.True(t, ok, "unknown constant %s", e.Name)
+			return eval(value)
+		case *ast.BinaryExpr:
+			require.Equal(t, token.ADD, e.Op)
+			return eval(e.X) + eval(e.Y)
+		case *ast.ParenExpr:
+			return eval(e.X)
+		}
+		require.Failf(t, "unsupported constant expression", "%T", expr)
+		return ""
+	}
+
+	names := make(map[string]string)
+	for name, expr := range consts {
+		if !strings.HasSuffix(name, "Query") {
+			continue
+		}
+		operation := postgres.OperationName(eval(expr))
+		assert.NotEqual(t, "other", operation, "%s has no operation name", name)
+		if other, ok := names[operation]; ok && operation != "other" {
+			assert.Failf(t, "duplicate operation name", "%s and %s are both named %q", other, name, operation)
+		}
+		names[operation] = name
+	}
+	assert.NotEmpty(t, names)
+}
+
+// Проверка описания параметров запроса без значений.
+func TestArgShapes(t *testing.T) {
+	shapes := postgres.ArgShapes([]interface{}{"secret", int64(42), time.Now(), []string{"a", "b", "c"}, nil})
+	assert.Equal(t, []string{"string", "int64", "time.Time", "[]string[3]", "nil"}, shapes)
+}
+
+// Проверка записи медленных запросов в лог.
+func TestQueryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := postgres.NewQueryLogger(slog.New(slog.NewJSONHandler(&buf, nil)), 100*time.Millisecond)
+	ctx := context.Background()
+
+	logger.Log(ctx, pgx.LogLevelInfo, "Query", map[string]interface{}{
+		"sql":  `SELECT email FROM users WHERE id = $1`,
+		"args": []interface{}{"user@example.com"},
+		"time": 10 * time.Millisecond,
+	})
+	logger.Log(ctx, pgx.LogLevelInfo, "closed connection", nil)
+	assert.Empty(t, buf.String(), "fast queries and other messages are not logged")
+
+	logger.Log(ctx, pgx.LogLevelInfo, "Query", map[string]interface{}{
+		"sql":      "SELECT id\n\t\tFROM users WHERE email = $1",
+		"args":     []interface{}{"user@example.com"},
+		"time":     250 * time.Millisecond,
+		"rowCount": 1,
+	})
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "Slow query", entry["msg"])
+	assert.Equal(t, "other", entry["operation"])
+	assert.Equal(t, []any{"string"}, entry["args"])
+	assert.Equal(t, "SELECT id FROM users WHERE email = $1", entry["sql"])
+	assert.NotContains(t, buf.String(), "user@example.com")
+}
+
+// Проверка отключения записи медленных запросов нулевым порогом.
+func TestQueryLogger_Disabled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := postgres.NewQueryLogger(slog.New(slog.NewJSONHandler(&buf, nil)), 0)
+
+	logger.Log(context.Background(), pgx.LogLevelInfo, "Exec", map[string]interface{}{
+		"sql":  "commit",
+		"time": time.Minute,
+	})
+	assert.Empty(t, buf.String())
+}
+
+// Экспортёр, сохраняющий завершённые спаны.
+type spanRecorder struct {
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(span tracing.SpanData) {
+	r.spans = append(r.spans, span)
+}
+
+// Проверка записи спанов запросов в трассировку из их контекста.
+func TestQueryLogger_Tracing(t *testing.T) {
+	recorder := &spanRecorder{}
+	tracing.Set(recorder, 1)
+	t.Cleanup(func() { tracing.Set(nil, 0) })
+	logger := postgres.NewQueryLogger(slog.New(slog.NewTextHandler(io.Discard, nil)), 0)
+
+	// Запросы вне трассировки не записываются.
+	logger.Log(context.Background(), pgx.LogLevelInfo, "Query", map[string]interface{}{
+		"sql":  `SELECT email FROM users WHERE id = $1`,
+		"time": 10 * time.Millisecond,
+	})
+	assert.Empty(t, recorder.spans)
+
+	ctx, span := tracing.Start(context.Background(), tracing.KindInternal, "auth.RefreshTokens")
+	logger.Log(ctx, pgx.LogLevelError, "Exec", map[string]interface{}{
+		"sql":  `SELECT email FROM users WHERE id = $1`,
+		"time": 10 * time.Millisecond,
+		"err":  errors.New("connection reset"),
+	})
+	span.End()
+
+	require.Len(t, recorder.spans, 2)
+	query := recorder.spans[0]
+	assert.Equal(t, "db get_user_email", query.Name)
+	assert.Equal(t, tracing.KindClient, query.Kind)
+	assert.Equal(t, span.SpanContext().SpanID, query.Parent)
+	assert.Equal(t, 10*time.Millisecond, query.End.Sub(query.Start))
+	assert.Equal(t, "connection reset", query.Error)
+	assert.Contains(t, query.Attributes, tracing.String("db.operation.name", "get_user_email"))
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgconn"
+)
+
+// Определяет, можно ли повторить операцию после ошибки err.
+//
+// Повторяются ошибки, после которых PostgreSQL откатил транзакцию
+// (конфликт сериализации, взаимоблокировка, остановка или перезапуск
+// сервера, ошибка соединения), и ошибки, возникшие до отправки запроса.
+// Обрыв соединения во время запроса повторяется только для идемпотентных
+// операций: запрос мог успеть выполниться.
+//
+// Принимает:
+// - err: ошибка операции.
+// - idempotent: повтор операции не меняет результат, даже если она уже выполнена.
+//
+// Возвращает:
+// - true, если операцию можно повторить.
+func IsRetryable(err error, idempotent bool) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+		// Класс 08 — connection_exception.
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,42 @@
+package postgres_test
+
+import (
+	"auth_service/internal/storage/postgres"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+// Проверка классификации ошибок для повтора операций.
+func TestIsRetryable(t *testing.T) {
+	wrap := func(err error) error { return fmt.Errorf("failed to save refresh token: %w", err) }
+
+	for name, tc := range map[string]struct {
+		err error
+		// Повторяется для идемпотентной и неидемпотентной операции.
+		retried, retriedUnsafe bool
+	}{
+		"serialization failure": {err: &pgconn.PgError{Code: "40001"}, retried: true, retriedUnsafe: true},
+		"deadlock":              {err: &pgconn.PgError{Code: "40P01"}, retried: true, retriedUnsafe: true},
+		"admin shutdown":        {err: &pgconn.PgError{Code: "57P01"}, retried: true, retriedUnsafe: true},
+		"connection failure":    {err: &pgconn.PgError{Code: "08006"}, retried: true, retriedUnsafe: true},
+		"unique violation":      {err: &pgconn.PgError{Code: "23505"}},
+		"connection reset":      {err: syscall.ECONNRESET, retried: true},
+		"unexpected eof":        {err: io.ErrUnexpectedEOF, retried: true},
+		"network error":         {err: &net.OpError{Op: "read", Err: errors.New("broken pipe")}, retried: true},
+		"canceled":              {err: context.Canceled},
+		"deadline":              {err: context.DeadlineExceeded},
+		"other":                 {err: errors.New("invalid input")},
+	} {
+		assert.Equal(t, tc.retried, postgres.IsRetryable(wrap(tc.err), true), name)
+		assert.Equal(t, tc.retriedUnsafe, postgres.IsRetryable(wrap(tc.err), false), name)
+	}
+	assert.False(t, postgres.IsRetryable(nil, true))
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"auth_service/internal/storage"
+	"auth_service/pkg/authtoken"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Рассылка уведомлений об отзыве access-токенов через Pub/Sub Redis.
+//
+// Уведомления публикуются в формате authtoken.RevocationNotice; сервисы-
+// потребители получают их через пакет authtoken/redisrevocation.
+type RevocationPublisher struct {
+	client  *redis.Client
+	channel string
+}
+
+// Создаёт новый экземпляр RevocationPublisher.
+//
+// Принимает:
+// - client: клиент Redis.
+// - channel: канал уведомлений.
+//
+// Возвращает:
+// - экземпляр RevocationPublisher.
+func NewRevocationPublisher(client *redis.Client, channel string) *RevocationPublisher {
+	return &RevocationPublisher{client: client, channel: channel}
+}
+
+// Публикует уведомление об отзыве.
+//
+// Принимает:
+// - notice: отозванная сессия или токен.
+//
+// Возвращает:
+// - ошибку, если публикация не удалась.
+func (p *RevocationPublisher) PublishRevocation(notice storage.RevocationNotice) error {
+	payload, err := json.Marshal(authtoken.RevocationNotice{
+		SessionID: notice.SessionID,
+		TokenID:   notice.TokenID,
+		ExpiresAt: notice.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode revocation notice: %w", err)
+	}
+	if err := p.client.Publish(context.Background(), p.channel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish revocation notice: %w", err)
+	}
+	return nil
+}
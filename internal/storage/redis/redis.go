@@ -0,0 +1,723 @@
+package redis
+
+import (
+	"auth_service/internal/storage"
+	"auth_service/lib/clock"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	fieldUserID      = "user_id"
+	fieldRefreshHash = "refresh_token_hash"
+	fieldIP          = "ip_address"
+	// Время входа и последнего использования в Unix-миллисекундах.
+	fieldCreatedAt  = "created_at"
+	fieldLastUsedAt = "last_used_at"
+	fieldEmail      = "email"
+	fieldLocale     = "locale"
+	// bcrypt-хеш пароля пользователя.
+	fieldPasswordHash = "password_hash"
+	// Версия токенов пользователя.
+	fieldTokenVersion = "token_version"
+	// Устройство клиента сессии.
+	fieldUserAgent  = "user_agent"
+	fieldDeviceName = "device_name"
+	fieldPlatform   = "platform"
+)
+
+// Количество попыток транзакции WATCH/MULTI, прерванной одновременным изменением ключа.
+const maxWatchAttempts = 5
+
+// Хранилище сессий в Redis.
+//
+// Данные сессии хранятся в хеше auth:sessions:<session_id>, который истекает
+// вместе с сессией, поэтому истёкшие сессии удаляются самим Redis. Ключ
+// auth:refresh:<hash> с тем же сроком указывает на сессию по хешу refresh-токена,
+// а отсортированное множество auth:user_sessions:<user_id> — на сессии
+// пользователя (вес — время последнего использования); идентификаторы
+// истёкших сессий удаляются из него при чтении. Профили пользователей хранятся
+// в хешах auth:users:<user_id>, а ключ auth:user_emails:<email> указывает на
+// пользователя по email. Ключи списка отзыва access-токенов хранятся
+// как auth:denylist:<key> и истекают вместе с записью.
+type RedisStorage struct {
+	client *redis.Client
+	clock  clock.Clock
+}
+
+// Создаёт новый экземпляр RedisStorage.
+//
+// Принимает:
+// - client: клиент Redis.
+//
+// Возвращает:
+// - экземпляр RedisStorage.
+func NewRedisStorage(client *redis.Client) *RedisStorage {
+	return &RedisStorage{client: client, clock: clock.Real{}}
+}
+
+// Устанавливает источник времени, от которого отсчитываются время входа,
+// последнего использования и оставшийся срок сессий и записей списка отзыва.
+// Сами ключи истекают по часам Redis.
+func (rs *RedisStorage) WithClock(c clock.Clock) *RedisStorage {
+	rs.clock = c
+	return rs
+}
+
+// Возвращает текущее время.
+func (rs *RedisStorage) now() time.Time {
+	return rs.clock.Now()
+}
+
+func sessionKey(sessionID string) string {
+	return "auth:sessions:" + sessionID
+}
+
+func userSessionsKey(userID string) string {
+	return "auth:user_sessions:" + userID
+}
+
+func userKey(userID string) string {
+	return "auth:users:" + userID
+}
+
+func userEmailKey(email string) string {
+	return "auth:user_emails:" + email
+}
+
+func refreshKey(refreshHash string) string {
+	return "auth:refresh:" + refreshHash
+}
+
+func denylistKey(key string) string {
+	return "auth:denylist:" + key
+}
+
+// Устанавливает ключ со сроком ARGV[1] мс, если текущий срок ключа меньше
+// (PTTL возвращает -2 для отсутствующего ключа).
+var denyScript = redis.NewScript(`
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], '1', 'PX', ARGV[1])
+end
+return 1
+`)
+
+// Cохраняет refresh-токен и IP клиента, начиная новую сессию.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - hashedToken: хешированный refresh-токен.
+// - clientIP: IP-адрес клиента.
+// - expiresAt: срок действия сессии.
+//
+// Возвращает:
+// - идентификатор сессии.
+// - ошибку, если не удалось сохранить токен.
+func (rs *RedisStorage) SaveRefreshToken(userID, hashedToken, clientIP string, expiresAt time.Time) (string, error) {
+	ctx := context.Background()
+	sessionID := uuid.NewString()
+	key := sessionKey(sessionID)
+	now := rs.now()
+
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			fieldUserID, userID,
+			fieldRefreshHash, hashedToken,
+			fieldIP, clientIP,
+			fieldCreatedAt, formatMillis(now),
+			fieldLastUsedAt, formatMillis(now),
+		)
+		pipe.ExpireAt(ctx, key, expiresAt)
+		pipe.Set(ctx, refreshKey(hashedToken), sessionID, 0)
+		pipe.ExpireAt(ctx, refreshKey(hashedToken), expiresAt)
+		pipe.ZAdd(ctx, userSessionsKey(userID), redis.Z{Score: float64(now.UnixMilli()), Member: sessionID})
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return sessionID, nil
+}
+
+// Возвращает refresh-токен последней использованной сессии пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - строку (хешированный refresh-токен).
+// - ошибку, если не удалось получить токен.
+func (rs *RedisStorage) GetRefreshToken(userID string) (string, error) {
+	session, err := rs.lastSession(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return session.RefreshTokenHash, nil
+}
+
+// Обновляет refresh-токен, IP клиента и срок действия существующей сессии.
+//
+// Ротация выполняется в транзакции вместе с заменой ключа поиска по хешу и
+// только если в сессии всё ещё хранится oldHash.
+//
+// Принимает:
+// - sessionID: идентификатор сессии.
+// - oldHash: хеш ротируемого refresh-токена.
+// - hashedToken: новый хешированный refresh-токен.
+// - clientIP: новый IP-адрес клиента.
+// - expiresAt: новый срок действия сессии.
+//
+// Возвращает:
+// - ошибку, если сессия не найдена, токен уже ротирован или сессию не удалось обновить.
+func (rs *RedisStorage) UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time) error {
+	ctx := context.Background()
+	key := sessionKey(sessionID)
+
+	rotate := func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, key, fieldUserID, fieldRefreshHash).Result()
+		if err != nil {
+			return err
+		}
+		userID, _ := values[0].(string)
+		storedHash, _ := values[1].(string)
+		if userID == "" || storedHash != oldHash {
+			return storage.ErrNotFound
+		}
+
+		now := rs.now()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, refreshKey(oldHash))
+			pipe.HSet(ctx, key, fieldRefreshHash, hashedToken, fieldIP, clientIP, fieldLastUsedAt, formatMillis(now))
+			pipe.ExpireAt(ctx, key, expiresAt)
+			pipe.Set(ctx, refreshKey(hashedToken), sessionID, 0)
+			pipe.ExpireAt(ctx, refreshKey(hashedToken), expiresAt)
+			pipe.ZAdd(ctx, userSessionsKey(userID), redis.Z{Score: float64(now.UnixMilli()), Member: sessionID})
+			return nil
+		})
+		return err
+	}
+	// Если сессию изменили между чтением и записью, проверка хеша повторяется:
+	// проигравшая одновременная ротация получит storage.ErrNotFound.
+	var err error
+	for attempt := 0; attempt < maxWatchAttempts; attempt++ {
+		if err = rs.client.Watch(ctx, rotate, key); !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update refresh token: %w", err)
+	}
+	return nil
+}
+
+// Возвращает IP-адрес клиента последней использованной сессии пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - строку (IP-адрес клиента).
+// - ошибку, если не удалось получить IP-адрес.
+func (rs *RedisStorage) GetLastIP(userID string) (string, error) {
+	session, err := rs.lastSession(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get last IP: %w", err)
+	}
+	return session.ClientIP, nil
+}
+
+// Возвращает email пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - строку (email пользователя).
+// - ошибку, если email не удалось получить.
+func (rs *RedisStorage) GetUserEmail(userID string) (string, error) {
+	email, err := rs.client.HGet(context.Background(), userKey(userID), fieldEmail).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user email: %w", notFound(err))
+	}
+	return email, nil
+}
+
+// Возвращает предпочитаемый язык пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - язык пользователя или пустую строку, если он не задан.
+// - ошибку, если пользователь не найден или запрос не удался.
+func (rs *RedisStorage) GetUserLocale(userID string) (string, error) {
+	values, err := rs.client.HMGet(context.Background(), userKey(userID), fieldEmail, fieldLocale).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user locale: %w", err)
+	}
+	// Профиль без email означает, что пользователя нет.
+	if values[0] == nil {
+		return "", fmt.Errorf("failed to get user locale: %w", storage.ErrNotFound)
+	}
+	locale, _ := values[1].(string)
+	return locale, nil
+}
+
+// Устанавливает предпочитаемый язык пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - locale: язык (например, ru); пустая строка — язык по умолчанию.
+//
+// Возвращает:
+// - ошибку, если язык не удалось сохранить.
+func (rs *RedisStorage) SetUserLocale(userID, locale string) error {
+	if err := rs.client.HSet(context.Background(), userKey(userID), fieldLocale, locale).Err(); err != nil {
+		return fmt.Errorf("failed to set user locale: %w", err)
+	}
+	return nil
+}
+
+// Сохраняет профиль пользователя (email) в Redis.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - email: email пользователя.
+//
+// Возвращает:
+// - ошибку, если профиль не удалось сохранить.
+func (rs *RedisStorage) CreateUser(userID, email string) error {
+	ctx := context.Background()
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, userKey(userID), fieldEmail, email)
+		pipe.Set(ctx, userEmailKey(email), userID, 0)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// Устанавливает хеш пароля пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - passwordHash: bcrypt-хеш пароля.
+//
+// Возвращает:
+// - ошибку, если хеш не удалось сохранить.
+func (rs *RedisStorage) SetPassword(userID, passwordHash string) error {
+	if err := rs.client.HSet(context.Background(), userKey(userID), fieldPasswordHash, passwordHash).Err(); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	return nil
+}
+
+// Возвращает идентификатор пользователя и хеш его пароля по email.
+//
+// Принимает:
+// - email: email пользователя.
+//
+// Возвращает:
+// - идентификатор пользователя.
+// - хеш пароля; пустая строка, если пароль не задан.
+// - ошибку, если пользователь не найден или запрос не удался.
+func (rs *RedisStorage) GetUserCredentials(email string) (string, string, error) {
+	ctx := context.Background()
+	userID, err := rs.client.Get(ctx, userEmailKey(email)).Result()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get user credentials: %w", notFound(err))
+	}
+	passwordHash, err := rs.client.HGet(ctx, userKey(userID), fieldPasswordHash).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", "", fmt.Errorf("failed to get user credentials: %w", err)
+	}
+	return userID, passwordHash, nil
+}
+
+// Возвращает версию токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - версию; 0, если она не повышалась.
+// - ошибку, если пользователь не найден или запрос не удался.
+func (rs *RedisStorage) GetTokenVersion(userID string) (int64, error) {
+	values, err := rs.client.HMGet(context.Background(), userKey(userID), fieldEmail, fieldTokenVersion).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token version: %w", err)
+	}
+	if values[0] == nil {
+		return 0, fmt.Errorf("failed to get token version: %w", storage.ErrNotFound)
+	}
+	raw, _ := values[1].(string)
+	if raw == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse token version: %w", err)
+	}
+	return version, nil
+}
+
+// Повышает версию токенов пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - новую версию.
+// - ошибку, если пользователь не найден или запрос не удался.
+func (rs *RedisStorage) BumpTokenVersion(userID string) (int64, error) {
+	ctx := context.Background()
+	exists, err := rs.client.HExists(ctx, userKey(userID), fieldEmail).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump token version: %w", err)
+	}
+	if !exists {
+		return 0, fmt.Errorf("failed to bump token version: %w", storage.ErrNotFound)
+	}
+	version, err := rs.client.HIncrBy(ctx, userKey(userID), fieldTokenVersion, 1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump token version: %w", err)
+	}
+	return version, nil
+}
+
+// Удаляет все сессии пользователя (отзывает его refresh-токены).
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - ошибку, если не удалось удалить токены или сессий нет.
+func (rs *RedisStorage) DeleteRefreshToken(userID string) error {
+	sessions, err := rs.ListSessions(userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete refresh token: %w", err)
+	}
+	if len(sessions) == 0 {
+		return fmt.Errorf("failed to delete refresh token: %w", storage.ErrNotFound)
+	}
+
+	ctx := context.Background()
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, session := range sessions {
+			pipe.Del(ctx, sessionKey(session.ID), refreshKey(session.RefreshTokenHash))
+		}
+		pipe.Del(ctx, userSessionsKey(userID))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete refresh token: %w", err)
+	}
+	return nil
+}
+
+// Возвращает сессию по хешу refresh-токена.
+//
+// Истёкшие сессии удаляются Redis по TTL, поэтому для них возвращается
+// storage.ErrNotFound, а не storage.ErrExpired.
+//
+// Принимает:
+// - refreshHash: хеш refresh-токена.
+//
+// Возвращает:
+// - сессию.
+// - ошибку, если сессия не найдена или её не удалось получить.
+func (rs *RedisStorage) GetSessionByRefreshHash(refreshHash string) (storage.Session, error) {
+	sessionID, err := rs.client.Get(context.Background(), refreshKey(refreshHash)).Result()
+	if err != nil {
+		return storage.Session{}, fmt.Errorf("failed to get session by refresh hash: %w", notFound(err))
+	}
+
+	sessions, err := rs.getSessions(sessionID)
+	if err != nil {
+		return storage.Session{}, fmt.Errorf("failed to get session by refresh hash: %w", err)
+	}
+	// Ключ поиска мог пережить ротацию, если сессия была изменена в обход RedisStorage.
+	if len(sessions) == 0 || sessions[0].RefreshTokenHash != refreshHash {
+		return storage.Session{}, fmt.Errorf("failed to get session by refresh hash: %w", storage.ErrNotFound)
+	}
+	return sessions[0], nil
+}
+
+// Возвращает действующие сессии пользователя, начиная с последней использованной.
+//
+// Идентификаторы истёкших сессий удаляются из индекса пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+//
+// Возвращает:
+// - сессии (пустой список, если их нет).
+// - ошибку, если сессии не удалось получить.
+func (rs *RedisStorage) ListSessions(userID string) ([]storage.Session, error) {
+	ctx := context.Background()
+
+	ids, err := rs.client.ZRevRange(ctx, userSessionsKey(userID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	sessions, err := rs.getSessions(ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	if len(sessions) < len(ids) {
+		found := make(map[string]bool, len(sessions))
+		for _, session := range sessions {
+			found[session.ID] = true
+		}
+		var expired []any
+		for _, id := range ids {
+			if !found[id] {
+				expired = append(expired, id)
+			}
+		}
+		if err := rs.client.ZRem(ctx, userSessionsKey(userID), expired...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to prune sessions: %w", err)
+		}
+	}
+	return sessions, nil
+}
+
+// Удаляет сессию.
+//
+// Принимает:
+// - sessionID: идентификатор сессии.
+//
+// Возвращает:
+// - ошибку, если не удалось удалить сессию или она не найдена.
+func (rs *RedisStorage) DeleteSession(sessionID string) error {
+	return rs.deleteSession("", sessionID)
+}
+
+// Удаляет сессию пользователя.
+//
+// Принимает:
+// - userID: идентификатор пользователя.
+// - sessionID: идентификатор сессии.
+//
+// Возвращает:
+// - storage.ErrNotFound, если сессии нет или она принадлежит другому пользователю.
+func (rs *RedisStorage) DeleteUserSession(userID, sessionID string) error {
+	return rs.deleteSession(userID, sessionID)
+}
+
+// Удаляет сессию; если owner не пуст, только сессию этого пользователя.
+func (rs *RedisStorage) deleteSession(owner, sessionID string) error {
+	ctx := context.Background()
+	key := sessionKey(sessionID)
+
+	err := rs.client.Watch(ctx, func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, key, fieldUserID, fieldRefreshHash).Result()
+		if err != nil {
+			return err
+		}
+		userID, _ := values[0].(string)
+		hashedToken, _ := values[1].(string)
+		if userID == "" || (owner != "" && userID != owner) {
+			return storage.ErrNotFound
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key, refreshKey(hashedToken))
+			pipe.ZRem(ctx, userSessionsKey(userID), sessionID)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// Сохраняет устройство сессии.
+//
+// Принимает:
+// - sessionID: идентификатор сессии.
+// - device: устройство клиента.
+//
+// Возвращает:
+// - ошибку, если сессия не найдена или её не удалось обновить.
+func (rs *RedisStorage) SetSessionDevice(sessionID string, device storage.Device) error {
+	ctx := context.Background()
+	key := sessionKey(sessionID)
+
+	err := rs.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.HExists(ctx, key, fieldUserID).Result()
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return storage.ErrNotFound
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, fieldUserAgent, device.UserAgent, fieldDeviceName, device.Name, fieldPlatform, device.Platform)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return fmt.Errorf("failed to set session device: %w", err)
+	}
+	return nil
+}
+
+// Заносит ключ отозванных access-токенов в список отзыва.
+//
+// Принимает:
+// - key: ключ (jti:<id> или sid:<id>).
+// - expiresAt: срок хранения; если ключ уже есть, сохраняется более поздний.
+//
+// Возвращает:
+// - ошибку, если запись не удалась.
+func (rs *RedisStorage) DenyAccessToken(key string, expiresAt time.Time) error {
+	ttl := expiresAt.Sub(rs.now()).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+	if err := denyScript.Run(context.Background(), rs.client, []string{denylistKey(key)}, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to deny access token: %w", err)
+	}
+	return nil
+}
+
+// Сообщает, есть ли в списке отзыва хотя бы один из ключей с неистёкшим сроком.
+//
+// Принимает:
+// - keys: проверяемые ключи.
+//
+// Возвращает:
+// - true, если хотя бы один ключ отозван.
+// - ошибку, если запрос не удался.
+func (rs *RedisStorage) IsAccessTokenDenied(keys ...string) (bool, error) {
+	if len(keys) == 0 {
+		return false, nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = denylistKey(key)
+	}
+	count, err := rs.client.Exists(context.Background(), redisKeys...).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check access token denylist: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Ничего не удаляет: истёкшие сессии удаляются самим Redis по TTL, поэтому
+// время хранения истёкших сессий не поддерживается.
+//
+// Возвращает:
+// - 0 и nil.
+func (rs *RedisStorage) DeleteExpiredRefreshTokens(retention time.Duration, limit int) (int64, error) {
+	return 0, nil
+}
+
+// Ничего не удаляет: индекса по времени использования нет, поэтому
+// неактивные сессии отклоняются при обновлении токенов и удаляются по TTL.
+//
+// Возвращает:
+// - 0 и nil.
+func (rs *RedisStorage) DeleteIdleRefreshTokens(idleTimeout time.Duration, limit int) (int64, error) {
+	return 0, nil
+}
+
+// Ничего не удаляет: записи списка отзыва удаляются самим Redis по TTL.
+//
+// Возвращает:
+// - 0 и nil.
+func (rs *RedisStorage) DeleteExpiredDeniedAccessTokens(limit int) (int64, error) {
+	return 0, nil
+}
+
+// Возвращает существующие сессии с указанными идентификаторами в том же порядке.
+func (rs *RedisStorage) getSessions(sessionIDs ...string) ([]storage.Session, error) {
+	if len(sessionIDs) == 0 {
+		return []storage.Session{}, nil
+	}
+
+	ctx := context.Background()
+	fields := make([]*redis.MapStringStringCmd, len(sessionIDs))
+	ttls := make([]*redis.DurationCmd, len(sessionIDs))
+	_, err := rs.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range sessionIDs {
+			fields[i] = pipe.HGetAll(ctx, sessionKey(id))
+			ttls[i] = pipe.PTTL(ctx, sessionKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]storage.Session, 0, len(sessionIDs))
+	now := rs.now()
+	for i, id := range sessionIDs {
+		values := fields[i].Val()
+		if values[fieldUserID] == "" {
+			continue
+		}
+		sessions = append(sessions, storage.Session{
+			ID:               id,
+			UserID:           values[fieldUserID],
+			RefreshTokenHash: values[fieldRefreshHash],
+			ClientIP:         values[fieldIP],
+			CreatedAt:        parseMillis(values[fieldCreatedAt]),
+			LastUsedAt:       parseMillis(values[fieldLastUsedAt]),
+			ExpiresAt:        now.Add(ttls[i].Val()),
+			Device: storage.Device{
+				UserAgent: values[fieldUserAgent],
+				Name:      values[fieldDeviceName],
+				Platform:  values[fieldPlatform],
+			},
+		})
+	}
+	return sessions, nil
+}
+
+// Возвращает последнюю использованную действующую сессию пользователя.
+func (rs *RedisStorage) lastSession(userID string) (storage.Session, error) {
+	sessions, err := rs.ListSessions(userID)
+	if err != nil {
+		return storage.Session{}, err
+	}
+	if len(sessions) == 0 {
+		return storage.Session{}, storage.ErrNotFound
+	}
+	return sessions[0], nil
+}
+
+func formatMillis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// Разбирает время в Unix-миллисекундах; для пустого или некорректного значения возвращает нулевое время.
+func parseMillis(value string) time.Time {
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis)
+}
+
+// Приводит redis.Nil к storage.ErrNotFound, остальные ошибки возвращает без изменений.
+func notFound(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return storage.ErrNotFound
+	}
+	return err
+}
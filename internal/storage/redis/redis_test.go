@@ -0,0 +1,36 @@
+package redis_test
+
+import (
+	redisstorage "auth_service/internal/storage/redis"
+	"auth_service/internal/storage/storagetest"
+	"auth_service/lib/clock"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Проверка соответствия RedisStorage общему контракту хранилища.
+// Требует запущенный Redis, адрес которого задан в TEST_REDIS_ADDR.
+func TestRedisStorage_Conformance(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR is not set")
+	}
+
+	storagetest.RunConformance(t, func(t *testing.T, clk clock.Clock) storagetest.Subject {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		t.Cleanup(func() { _ = client.Close() })
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			t.Fatalf("failed to connect to redis: %v", err)
+		}
+
+		rs := redisstorage.NewRedisStorage(client).WithClock(clk)
+		return storagetest.Subject{
+			Storage:    rs,
+			CreateUser: rs.CreateUser,
+			Cleaner:    rs,
+		}
+	})
+}
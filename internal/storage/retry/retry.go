@@ -0,0 +1,103 @@
+// Пакет retry повторяет операции с хранилищем после кратковременных ошибок
+// (конфликт сериализации, обрыв соединения при переключении реплик), чтобы
+// они не доходили до клиентов ошибкой 500.
+package retry
+
+import (
+	"auth_service/internal/metrics"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+var retries = metrics.NewCounterVec(
+	"auth_storage_retries_total",
+	"Number of storage operation retries after transient errors, by operation.",
+	"operation",
+)
+
+// Политика повторов.
+type Policy struct {
+	// Наибольшее число попыток, включая первую.
+	MaxAttempts int
+	// Пауза перед первым повтором; каждая следующая вдвое больше.
+	InitialBackoff time.Duration
+	// Наибольшая пауза между попытками.
+	MaxBackoff time.Duration
+}
+
+// Проверяет политику повторов.
+func (p Policy) Validate() error {
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts must be positive, got %d", p.MaxAttempts)
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < p.InitialBackoff {
+		return fmt.Errorf("invalid backoff %s..%s", p.InitialBackoff, p.MaxBackoff)
+	}
+	return nil
+}
+
+// Определяет, можно ли повторить операцию после ошибки (см. postgres.IsRetryable).
+type Classifier func(err error, idempotent bool) bool
+
+// Выполняет операции с повторами.
+type Retrier struct {
+	policy    Policy
+	retryable Classifier
+	sleep     func(time.Duration)
+}
+
+// Создаёт Retrier.
+//
+// Принимает:
+// - policy: политика повторов.
+// - retryable: классификатор ошибок драйвера хранилища.
+//
+// Возвращает:
+// - указатель на Retrier.
+func New(policy Policy, retryable Classifier) *Retrier {
+	return &Retrier{policy: policy, retryable: retryable, sleep: time.Sleep}
+}
+
+// Устанавливает функцию ожидания между попытками (для тестов).
+func (r *Retrier) WithSleep(sleep func(time.Duration)) *Retrier {
+	r.sleep = sleep
+	return r
+}
+
+// Выполняет fn и повторяет её, пока ошибка кратковременная и попытки не
+// исчерпаны.
+//
+// Принимает:
+// - operation: имя операции для метрики auth_storage_retries_total.
+// - idempotent: повтор операции не меняет результат, даже если она уже выполнена.
+// - fn: операция с хранилищем.
+//
+// Возвращает:
+// - ошибку последней попытки.
+func (r *Retrier) Do(operation string, idempotent bool, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.retryable(err, idempotent) {
+			return err
+		}
+		retries.Inc(operation)
+		r.sleep(r.backoff(attempt))
+	}
+}
+
+// Пауза после attempt неудачных попыток: экспоненциальная, не больше
+// MaxBackoff, со случайным разбросом до половины, чтобы реплики не
+// повторяли запросы одновременно.
+func (r *Retrier) backoff(attempt int) time.Duration {
+	backoff := r.policy.InitialBackoff
+	for i := 1; i < attempt && backoff < r.policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, r.policy.MaxBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
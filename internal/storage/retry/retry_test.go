@@ -0,0 +1,102 @@
+package retry
+
+import (
+	"auth_service/internal/storage/memory"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errTransient = errors.New("connection reset")
+	errPermanent = errors.New("syntax error")
+)
+
+// Повторяет только errTransient, для неидемпотентных операций — ни одной.
+func classify(err error, idempotent bool) bool {
+	return idempotent && errors.Is(err, errTransient)
+}
+
+// Создаёт Retrier, запоминающий паузы вместо ожидания.
+func newRetrier(policy Policy) (*Retrier, *[]time.Duration) {
+	var sleeps []time.Duration
+	r := New(policy, classify).WithSleep(func(d time.Duration) { sleeps = append(sleeps, d) })
+	return r, &sleeps
+}
+
+// Проверка повтора кратковременной ошибки до успеха.
+func TestRetrier_RetriesTransientErrors(t *testing.T) {
+	r, sleeps := newRetrier(Policy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+
+	calls := 0
+	err := r.Do("GetRefreshToken", true, func() error {
+		calls++
+		if calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	require.Len(t, *sleeps, 2)
+	assert.GreaterOrEqual(t, (*sleeps)[0], 50*time.Millisecond)
+	assert.LessOrEqual(t, (*sleeps)[0], 100*time.Millisecond)
+	assert.GreaterOrEqual(t, (*sleeps)[1], 100*time.Millisecond, "backoff doubles")
+	assert.LessOrEqual(t, (*sleeps)[1], 200*time.Millisecond)
+}
+
+// Проверка ограничения числа попыток и отказа от повтора прочих ошибок.
+func TestRetrier_GivesUp(t *testing.T) {
+	r, _ := newRetrier(Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	for name, tc := range map[string]struct {
+		err        error
+		idempotent bool
+		calls      int
+	}{
+		"attempts exhausted": {err: errTransient, idempotent: true, calls: 3},
+		"permanent error":    {err: errPermanent, idempotent: true, calls: 1},
+		"not idempotent":     {err: errTransient, idempotent: false, calls: 1},
+	} {
+		calls := 0
+		err := r.Do("op", tc.idempotent, func() error { calls++; return tc.err })
+		assert.ErrorIs(t, err, tc.err, name)
+		assert.Equal(t, tc.calls, calls, name)
+	}
+}
+
+// Проверка пауз: не больше MaxBackoff.
+func TestRetrier_Backoff(t *testing.T) {
+	r := New(Policy{MaxAttempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}, classify)
+	for attempt := 1; attempt <= 10; attempt++ {
+		assert.LessOrEqual(t, r.backoff(attempt), 300*time.Millisecond)
+	}
+	assert.GreaterOrEqual(t, r.backoff(10), 150*time.Millisecond)
+
+	assert.Zero(t, New(Policy{MaxAttempts: 2}, classify).backoff(1))
+}
+
+// Проверка политики.
+func TestPolicy_Validate(t *testing.T) {
+	require.NoError(t, Policy{MaxAttempts: 1}.Validate())
+	require.NoError(t, Policy{MaxAttempts: 3, InitialBackoff: 50 * time.Millisecond, MaxBackoff: 500 * time.Millisecond}.Validate())
+	assert.Error(t, Policy{MaxAttempts: 0}.Validate())
+	assert.Error(t, Policy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Millisecond}.Validate())
+}
+
+// Проверка обёртки: результат операции возвращается после повтора.
+func TestStorage(t *testing.T) {
+	ms := memory.NewMemoryStorage()
+	ms.CreateUser("user", "user@example.com")
+	s := Wrap(ms, New(Policy{MaxAttempts: 2}, classify))
+
+	sessionID, err := s.SaveRefreshToken("user", "hash", "192.168.1.1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	session, err := s.GetSessionByRefreshHash("hash")
+	require.NoError(t, err)
+	assert.Equal(t, sessionID, session.ID)
+	require.NoError(t, s.DeleteSession(sessionID))
+}
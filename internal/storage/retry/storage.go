@@ -0,0 +1,172 @@
+package retry
+
+import (
+	"auth_service/internal/storage"
+	"context"
+	"time"
+)
+
+// Хранилище, повторяющее операции после кратковременных ошибок.
+type Storage struct {
+	next    storage.Storage
+	retrier *Retrier
+}
+
+// Оборачивает хранилище повторами.
+//
+// Чтение, обновление сессии и отзыв access-токена идемпотентны и
+// повторяются и после обрыва соединения во время запроса. SaveRefreshToken
+// (создаёт новую сессию) и удаление сессий (повтор выполненного удаления
+// вернул бы storage.ErrNotFound) повторяются, только если запрос точно не
+// был выполнен.
+//
+// Принимает:
+// - next: исходное хранилище.
+// - r: Retrier с политикой повторов.
+//
+// Возвращает:
+// - экземпляр Storage, реализующий storage.Storage.
+func Wrap(next storage.Storage, r *Retrier) *Storage {
+	return &Storage{next: next, retrier: r}
+}
+
+// Возвращает хранилище с той же политикой повторов, запросы исходного хранилища
+// которого выполняются в контексте ctx (см. storage.ContextBinder).
+func (s *Storage) WithContext(ctx context.Context) storage.Storage {
+	return &Storage{next: storage.WithContext(s.next, ctx), retrier: s.retrier}
+}
+
+func (s *Storage) SaveRefreshToken(userID, hashedToken, clientIP string, expiresAt time.Time) (string, error) {
+	var sessionID string
+	err := s.retrier.Do("SaveRefreshToken", false, func() (err error) {
+		sessionID, err = s.next.SaveRefreshToken(userID, hashedToken, clientIP, expiresAt)
+		return err
+	})
+	return sessionID, err
+}
+
+func (s *Storage) GetRefreshToken(userID string) (string, error) {
+	var hashedToken string
+	err := s.retrier.Do("GetRefreshToken", true, func() (err error) {
+		hashedToken, err = s.next.GetRefreshToken(userID)
+		return err
+	})
+	return hashedToken, err
+}
+
+func (s *Storage) UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time) error {
+	return s.retrier.Do("UpdateRefreshToken", true, func() error {
+		return s.next.UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP, expiresAt)
+	})
+}
+
+func (s *Storage) GetLastIP(userID string) (string, error) {
+	var clientIP string
+	err := s.retrier.Do("GetLastIP", true, func() (err error) {
+		clientIP, err = s.next.GetLastIP(userID)
+		return err
+	})
+	return clientIP, err
+}
+
+func (s *Storage) GetUserEmail(userID string) (string, error) {
+	var email string
+	err := s.retrier.Do("GetUserEmail", true, func() (err error) {
+		email, err = s.next.GetUserEmail(userID)
+		return err
+	})
+	return email, err
+}
+
+func (s *Storage) GetUserCredentials(email string) (string, string, error) {
+	var userID, passwordHash string
+	err := s.retrier.Do("GetUserCredentials", true, func() (err error) {
+		userID, passwordHash, err = s.next.GetUserCredentials(email)
+		return err
+	})
+	return userID, passwordHash, err
+}
+
+func (s *Storage) GetUserLocale(userID string) (string, error) {
+	var locale string
+	err := s.retrier.Do("GetUserLocale", true, func() (err error) {
+		locale, err = s.next.GetUserLocale(userID)
+		return err
+	})
+	return locale, err
+}
+
+func (s *Storage) DeleteRefreshToken(userID string) error {
+	return s.retrier.Do("DeleteRefreshToken", false, func() error {
+		return s.next.DeleteRefreshToken(userID)
+	})
+}
+
+func (s *Storage) GetTokenVersion(userID string) (int64, error) {
+	var version int64
+	err := s.retrier.Do("GetTokenVersion", true, func() (err error) {
+		version, err = s.next.GetTokenVersion(userID)
+		return err
+	})
+	return version, err
+}
+
+func (s *Storage) BumpTokenVersion(userID string) (int64, error) {
+	var version int64
+	err := s.retrier.Do("BumpTokenVersion", false, func() (err error) {
+		version, err = s.next.BumpTokenVersion(userID)
+		return err
+	})
+	return version, err
+}
+
+func (s *Storage) GetSessionByRefreshHash(refreshHash string) (storage.Session, error) {
+	var session storage.Session
+	err := s.retrier.Do("GetSessionByRefreshHash", true, func() (err error) {
+		session, err = s.next.GetSessionByRefreshHash(refreshHash)
+		return err
+	})
+	return session, err
+}
+
+func (s *Storage) ListSessions(userID string) ([]storage.Session, error) {
+	var sessions []storage.Session
+	err := s.retrier.Do("ListSessions", true, func() (err error) {
+		sessions, err = s.next.ListSessions(userID)
+		return err
+	})
+	return sessions, err
+}
+
+func (s *Storage) DeleteSession(sessionID string) error {
+	return s.retrier.Do("DeleteSession", false, func() error {
+		return s.next.DeleteSession(sessionID)
+	})
+}
+
+func (s *Storage) DeleteUserSession(userID, sessionID string) error {
+	return s.retrier.Do("DeleteUserSession", false, func() error {
+		return s.next.DeleteUserSession(userID, sessionID)
+	})
+}
+
+func (s *Storage) SetSessionDevice(sessionID string, device storage.Device) error {
+	return s.retrier.Do("SetSessionDevice", true, func() error {
+		return s.next.SetSessionDevice(sessionID, device)
+	})
+}
+
+func (s *Storage) DenyAccessToken(key string, expiresAt time.Time) error {
+	return s.retrier.Do("DenyAccessToken", true, func() error {
+		return s.next.DenyAccessToken(key, expiresAt)
+	})
+}
+
+func (s *Storage) IsAccessTokenDenied(keys ...string) (bool, error) {
+	var denied bool
+	err := s.retrier.Do("IsAccessTokenDenied", true, func() (err error) {
+		denied, err = s.next.IsAccessTokenDenied(keys...)
+		return err
+	})
+	return denied, err
+}
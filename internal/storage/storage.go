@@ -0,0 +1,441 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// Запись не найдена в хранилище.
+	ErrNotFound = errors.New("not found")
+	// Хранилище временно недоступно.
+	ErrUnavailable = errors.New("storage is temporarily unavailable")
+	// Срок действия сессии истёк; сессия хранится до удаления заданием очистки.
+	ErrExpired = errors.New("session expired")
+)
+
+// Сессия пользователя: выданный refresh-токен и данные клиента.
+type Session struct {
+	ID               string
+	UserID           string
+	RefreshTokenHash string
+	ClientIP         string
+	// Время входа: не меняется при ротации refresh-токена.
+	CreatedAt time.Time
+	// Время последней выдачи или обновления токенов.
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	// Устройство, на котором начата или последний раз обновлена сессия.
+	Device Device
+}
+
+// Устройство клиента сессии; пустые поля — клиент их не сообщил.
+type Device struct {
+	// Заголовок User-Agent клиента.
+	UserAgent string
+	// Имя устройства, заданное клиентом (например, «iPhone Анны»).
+	Name string
+	// Платформа клиента (например, ios, android, web).
+	Platform string
+}
+
+// Интерфейс для работы с хранилищем токенов и IP-адресов.
+//
+// У пользователя может быть несколько сессий (по одной на устройство).
+// Методы, принимающие userID и возвращающие одно значение, относятся к
+// последней использованной действующей сессии; истёкшие сессии не
+// возвращаются и не обновляются, даже если ещё не удалены.
+type Storage interface {
+	// Начинает новую сессию, действующую до expiresAt, и возвращает её идентификатор.
+	SaveRefreshToken(userID, hashedToken, clientIP string, expiresAt time.Time) (string, error)
+	GetRefreshToken(userID string) (string, error)
+	// Заменяет refresh-токен сессии sessionID с хешем oldHash на hashedToken и
+	// переносит её срок на expiresAt (storage.ErrNotFound, если сессии нет, её
+	// срок истёк или токен уже ротирован другим запросом).
+	UpdateRefreshToken(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time) error
+	GetLastIP(userID string) (string, error)
+	GetUserEmail(userID string) (string, error)
+	// Возвращает идентификатор пользователя и bcrypt-хеш его пароля по email
+	// (storage.ErrNotFound, если пользователя нет; пустой хеш, если пароль не задан).
+	GetUserCredentials(email string) (userID, passwordHash string, err error)
+	// Возвращает предпочитаемый язык пользователя; пустая строка, если он не задан
+	// (storage.ErrNotFound, если пользователя нет).
+	GetUserLocale(userID string) (string, error)
+	// Удаляет все сессии пользователя (storage.ErrNotFound, если их нет).
+	DeleteRefreshToken(userID string) error
+	// Возвращает версию токенов пользователя; 0, если она не повышалась
+	// (storage.ErrNotFound, если пользователя нет).
+	GetTokenVersion(userID string) (int64, error)
+	// Повышает версию токенов пользователя и возвращает новую; access-токены
+	// с меньшей версией отклоняются при строгой проверке
+	// (storage.ErrNotFound, если пользователя нет).
+	BumpTokenVersion(userID string) (int64, error)
+	// Возвращает сессию по хешу refresh-токена (storage.ErrNotFound, если такого хеша нет,
+	// storage.ErrExpired, если срок сессии истёк).
+	GetSessionByRefreshHash(refreshHash string) (Session, error)
+	// Возвращает действующие сессии пользователя, начиная с последней использованной.
+	ListSessions(userID string) ([]Session, error)
+	// Удаляет сессию (storage.ErrNotFound, если её нет).
+	DeleteSession(sessionID string) error
+	// Удаляет сессию пользователя (storage.ErrNotFound, если её нет или она
+	// принадлежит другому пользователю).
+	DeleteUserSession(userID, sessionID string) error
+	// Сохраняет устройство сессии, заменяя прежнее (storage.ErrNotFound, если сессии нет).
+	SetSessionDevice(sessionID string, device Device) error
+	// Заносит ключ отозванных access-токенов (jti:<id> или sid:<id>) в список отзыва до expiresAt;
+	// если ключ уже есть, сохраняется более поздний срок.
+	DenyAccessToken(key string, expiresAt time.Time) error
+	// Сообщает, есть ли в списке отзыва хотя бы один из ключей с неистёкшим сроком.
+	IsAccessTokenDenied(keys ...string) (bool, error)
+}
+
+// Интерфейс для удаления устаревших данных из хранилища.
+type Cleaner interface {
+	// Удаляет не более limit refresh-токенов, истёкших более retention назад, и возвращает количество удалённых.
+	DeleteExpiredRefreshTokens(retention time.Duration, limit int) (int64, error)
+	// Удаляет не более limit сессий, не использовавшихся дольше idleTimeout, и возвращает количество удалённых.
+	DeleteIdleRefreshTokens(idleTimeout time.Duration, limit int) (int64, error)
+	// Удаляет не более limit истёкших записей списка отзыва access-токенов и возвращает количество удалённых.
+	DeleteExpiredDeniedAccessTokens(limit int) (int64, error)
+}
+
+// Интерфейс для подсчёта сессий.
+type SessionCounter interface {
+	// Возвращает количество действующих сессий всех пользователей.
+	CountSessions() (int64, error)
+}
+
+// Условия отбора сессий; пустое условие не ограничивает отбор.
+type SessionFilter struct {
+	// Владельцы сессий.
+	UserIDs []string
+	// Сессии, начатые раньше этого времени.
+	CreatedBefore time.Time
+}
+
+// Интерфейс для поиска сессий всех пользователей.
+type SessionFinder interface {
+	// Возвращает не более limit действующих сессий, подходящих под filter, с
+	// идентификатором больше afterID (пустая строка — с начала), упорядоченных
+	// по идентификатору.
+	FindSessions(filter SessionFilter, afterID string, limit int) ([]Session, error)
+}
+
+// Хранилище, запросы которого можно выполнять в контексте вызывающего: тогда
+// они попадают в его трассировку (см. пакет tracing).
+type ContextBinder interface {
+	// Возвращает хранилище, выполняющее запросы в контексте ctx. Отмена ctx
+	// не прерывает запросы: операция сервиса не должна оборваться между
+	// связанными изменениями.
+	WithContext(ctx context.Context) Storage
+}
+
+// Возвращает хранилище, выполняющее запросы в контексте ctx, или s, если
+// оно этого не поддерживает.
+func WithContext(s Storage, ctx context.Context) Storage {
+	if binder, ok := s.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return s
+}
+
+// Уведомление об отзыве access-токенов для сервисов-потребителей.
+type RevocationNotice struct {
+	// Идентификатор сессии (sid), все токены которой отозваны.
+	SessionID string
+	// Идентификатор отозванного токена (jti).
+	TokenID string
+	// Срок, после которого отозванные токены истекают сами.
+	ExpiresAt time.Time
+}
+
+// Интерфейс для рассылки уведомлений об отзыве access-токенов.
+type RevocationPublisher interface {
+	PublishRevocation(notice RevocationNotice) error
+}
+
+// Количество запросов за сутки по интерфейсу, операции и результату.
+type UsageRow struct {
+	// Начало суток (UTC).
+	Day time.Time
+	// Интерфейс, через который пришли запросы: http или grpc.
+	API       string
+	Operation string
+	Result    string
+	Count     int64
+}
+
+// Интерфейс для хранения статистики использования.
+type UsageStats interface {
+	// Прибавляет количества к сохранённым значениям за те же сутки, интерфейс, операцию и результат.
+	AddUsage(rows []UsageRow) error
+	// Возвращает статистику за сутки с from по to включительно, упорядоченную по дню.
+	ListUsage(from, to time.Time) ([]UsageRow, error)
+}
+
+// Суточная сводка использования сервиса.
+type DailyStats struct {
+	// Начало суток (UTC).
+	Day time.Time
+	// Пользователи, которым в эти сутки выдавались или обновлялись токены.
+	ActiveUsers int64
+	// Пользователи, зарегистрированные в эти сутки.
+	NewUsers int64
+	// Запросы к API по статистике использования (см. UsageStats): всего,
+	// отклонённые из-за клиента и завершившиеся ошибкой сервиса.
+	Requests         int64
+	RejectedRequests int64
+	FailedRequests   int64
+}
+
+// Интерфейс для расчёта и хранения суточных сводок.
+type Analytics interface {
+	// Вычисляет и сохраняет сводку за сутки, которым принадлежит day; повторный
+	// вызов пересчитывает её.
+	RollupDailyStats(day time.Time) (DailyStats, error)
+	// Возвращает сводки за сутки с from по to включительно, упорядоченные по дню.
+	ListDailyStats(from, to time.Time) ([]DailyStats, error)
+}
+
+// Состояния доставки webhook.
+const (
+	// Ожидает отправки или повторной попытки.
+	WebhookPending = "pending"
+	// Доставлен.
+	WebhookDelivered = "delivered"
+	// Все попытки исчерпаны; доставка перенесена в таблицу недоставленных.
+	WebhookDead = "dead"
+)
+
+// Доставка события одному получателю webhook.
+type WebhookDelivery struct {
+	ID string
+	// Идентификатор события; одинаков для всех получателей.
+	EventID   string
+	EventType string
+	// Имя получателя из конфигурации.
+	Endpoint string
+	// Тело запроса.
+	Payload []byte
+	Status  string
+	// Выполненные попытки отправки.
+	Attempts int
+	// Время следующей попытки (для WebhookPending).
+	NextAttemptAt time.Time
+	// Ошибка последней попытки.
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Интерфейс для хранения очереди доставки webhook.
+type WebhookQueue interface {
+	// Сохраняет новую доставку в состоянии WebhookPending.
+	EnqueueWebhook(delivery WebhookDelivery) error
+	// Возвращает не более limit ожидающих доставок со временем попытки не позже now,
+	// начиная с самых ранних.
+	DueWebhooks(now time.Time, limit int) ([]WebhookDelivery, error)
+	// Отмечает доставку выполненной (storage.ErrNotFound, если её нет).
+	MarkWebhookDelivered(id string, attempts int) error
+	// Назначает повторную попытку (storage.ErrNotFound, если доставки нет).
+	RetryWebhook(id string, attempts int, nextAttemptAt time.Time, lastError string) error
+	// Переносит доставку в таблицу недоставленных (storage.ErrNotFound, если её нет).
+	DeadLetterWebhook(id string, attempts int, lastError string) error
+	// Возвращает доставку, в том числе недоставленную (storage.ErrNotFound, если её нет).
+	GetWebhook(id string) (WebhookDelivery, error)
+	// Возвращает не более limit недоставленных доставок, начиная с последних.
+	ListDeadWebhooks(limit int) ([]WebhookDelivery, error)
+	// Возвращает доставку в очередь с попыткой в момент now и сбрасывает счётчик
+	// попыток; недоставленная доставка переносится обратно из таблицы
+	// недоставленных (storage.ErrNotFound, если доставки нет).
+	RedeliverWebhook(id string, now time.Time) error
+	// Удаляет не более limit доставок, выполненных раньше before, и возвращает их количество.
+	DeleteDeliveredWebhooks(before time.Time, limit int) (int64, error)
+}
+
+// Запись журнала аудита.
+type AuditEvent struct {
+	// Порядковый номер, назначаемый хранилищем; возрастает в порядке записи.
+	Seq       int64
+	Type      string
+	Severity  string
+	Time      time.Time
+	UserID    string
+	SessionID string
+	// IP-адрес клиента в сохраняемой форме.
+	ClientIP string
+	Details  map[string]string
+}
+
+// Интерфейс для хранения журнала аудита и позиций его выгрузки.
+type AuditLog interface {
+	// Сохраняет запись; Seq назначается хранилищем.
+	AppendAudit(event AuditEvent) error
+	// Возвращает не более limit записей с номером больше afterSeq и временем
+	// раньше before, упорядоченных по номеру.
+	ListAuditAfter(afterSeq int64, before time.Time, limit int) ([]AuditEvent, error)
+	// Возвращает номер последней выгруженной записи для выгрузки name; 0, если
+	// выгрузок ещё не было.
+	GetAuditCheckpoint(name string) (int64, error)
+	// Сохраняет номер последней выгруженной записи для выгрузки name.
+	SaveAuditCheckpoint(name string, seq int64) error
+	// Удаляет не более limit записей с номером не больше upToSeq и временем
+	// раньше before и возвращает их количество.
+	DeleteAuditEvents(upToSeq int64, before time.Time, limit int) (int64, error)
+}
+
+// Запись журнала действий (таблица audit_log).
+type AuditRecord struct {
+	// Номер, назначаемый хранилищем; возрастает в порядке записи.
+	ID   int64
+	Time time.Time
+	// Действие: тип события безопасности (token_issued, refresh_failed, ...)
+	// или действие администратора (admin_*).
+	Action string
+	// Кто выполнил действие: пользователь или администратор.
+	Actor string
+	// Пользователь, к которому относится действие.
+	UserID    string
+	SessionID string
+	// IP-адрес клиента в сохраняемой форме.
+	ClientIP  string
+	UserAgent string
+	// Результат: success или failure.
+	Outcome string
+	Details map[string]string
+}
+
+// Условия выборки записей журнала действий; пустые поля выборку не ограничивают.
+type AuditQuery struct {
+	Action string
+	// Одно из действий.
+	Actions []string
+	Actor   string
+	UserID  string
+	Outcome string
+	// Время записи в полуинтервале [From, To).
+	From time.Time
+	To   time.Time
+	// Только записи с номером меньше BeforeID (следующая страница); 0 — с последней.
+	BeforeID int64
+	Limit    int
+}
+
+// Интерфейс для журнала действий. Записи только добавляются: изменить или
+// удалить их через хранилище нельзя.
+type AuditTrail interface {
+	// Сохраняет запись; ID назначается хранилищем.
+	AppendAuditRecord(record AuditRecord) error
+	// Возвращает не более query.Limit записей, удовлетворяющих условиям,
+	// начиная с последних (по убыванию ID).
+	QueryAuditRecords(query AuditQuery) ([]AuditRecord, error)
+}
+
+// Интерфейс для хранения сертификатов, ключей и данных проверок ACME (см.
+// internal/acme), чтобы все реплики использовали одни сертификаты.
+type ACMECache interface {
+	// Возвращает данные по ключу или ErrNotFound.
+	GetACMEData(key string) ([]byte, error)
+	// Сохраняет данные по ключу, заменяя прежние.
+	SaveACMEData(key string, data []byte) error
+	// Удаляет данные по ключу; отсутствие ключа не считается ошибкой.
+	DeleteACMEData(key string) error
+}
+
+// Интерфейс для подсчёта неудачных попыток обновления токенов пользователей
+// (см. internal/refreshlimit). Счётчики хранятся вместе с остальными данными,
+// поэтому запрет обновления действует на всех репликах и после перезапуска.
+type RefreshFailureCounter interface {
+	// Учитывает неудачную попытку пользователя. Попытки считаются в окне
+	// длиной window от первой из них; если в окне набралось maxFailures
+	// попыток, обновление запрещается на cooldown. Возвращает момент окончания
+	// запрета или нулевое время, если запрета нет.
+	AddRefreshFailure(userID string, window time.Duration, maxFailures int, cooldown time.Duration) (time.Time, error)
+	// Возвращает момент окончания запрета обновления токенов пользователя или
+	// нулевое время, если запрета не было.
+	GetRefreshCooldown(userID string) (time.Time, error)
+	// Удаляет неудачные попытки и запрет обновления токенов пользователя.
+	ResetRefreshFailures(userID string) error
+}
+
+// Неудачные попытки входа по ключу: учётной записи или адресу клиента.
+type LoginAttempt struct {
+	// Неудачных попыток подряд.
+	Failures int
+	// Время последней неудачной попытки.
+	LastFailureAt time.Time
+	// Момент окончания блокировки входа; нулевое время — блокировки не было.
+	LockedUntil time.Time
+}
+
+// Интерфейс для подсчёта неудачных попыток входа и блокировки входа (см.
+// internal/lockout). Ключи выбирает вызывающий код.
+type LoginAttempts interface {
+	// Возвращает попытки по ключу; нулевое значение, если неудачных попыток не было.
+	GetLoginAttempt(key string) (LoginAttempt, error)
+	// Учитывает неудачную попытку и возвращает попытки после неё. Если
+	// предыдущая неудача была раньше resetAfter назад, счёт начинается заново.
+	AddLoginFailure(key string, resetAfter time.Duration) (LoginAttempt, error)
+	// Блокирует вход по ключу до until.
+	LockLogin(key string, until time.Time) error
+	// Удаляет попытки по ключу (после успешного входа или снятия блокировки).
+	ResetLoginAttempts(key string) error
+	// Удаляет не более limit записей без действующей блокировки, последняя
+	// неудача которых раньше before, и возвращает их количество.
+	DeleteLoginAttempts(before time.Time, limit int) (int64, error)
+}
+
+// Интерфейс для отключения учётных записей администратором.
+type AccountStatus interface {
+	// Отключает (disabled = true) или включает учётную запись пользователя
+	// (storage.ErrNotFound, если пользователя нет). Повторное отключение
+	// сохраняет время первого.
+	SetUserDisabled(userID string, disabled bool) error
+	// Возвращает время отключения учётной записи; нулевое время, если она
+	// включена (storage.ErrNotFound, если пользователя нет).
+	GetUserDisabledAt(userID string) (time.Time, error)
+}
+
+// Интерфейс для учёта смены паролей (политика срока действия пароля).
+type PasswordAge interface {
+	// Задаёт хеш пароля пользователя и отмечает время смены
+	// (storage.ErrNotFound, если пользователя нет).
+	SetPassword(userID, passwordHash string) error
+	// Возвращает время последней смены пароля; нулевое время, если оно не
+	// известно (storage.ErrNotFound, если пользователя нет).
+	GetPasswordChangedAt(userID string) (time.Time, error)
+}
+
+// Событие, ожидающее публикации через outbox (см. internal/outbox).
+type OutboxEvent struct {
+	ID string
+	// Тип события для логов и метрик.
+	Type string
+	// Событие в сериализованном виде.
+	Payload []byte
+	// Выполненные неудачные попытки публикации.
+	Attempts int
+	// Время следующей попытки.
+	NextAttemptAt time.Time
+	// Ошибка последней попытки.
+	LastError string
+	CreatedAt time.Time
+}
+
+// Интерфейс для хранения outbox: события сохраняются в одной транзакции с
+// изменением, о котором сообщают, и публикуются позже, поэтому не теряются
+// при сбое между изменением и публикацией.
+type Outbox interface {
+	// Ротирует refresh-токен как UpdateRefreshToken и в той же транзакции
+	// сохраняет события с попыткой в момент их создания; если сессии нет,
+	// события не сохраняются (storage.ErrNotFound).
+	UpdateRefreshTokenWithEvents(sessionID, oldHash, hashedToken, clientIP string, expiresAt time.Time, events []OutboxEvent) error
+	// Возвращает не более limit событий со временем попытки не позже now,
+	// начиная с самых ранних.
+	DueOutboxEvents(now time.Time, limit int) ([]OutboxEvent, error)
+	// Удаляет опубликованное событие (storage.ErrNotFound, если его нет).
+	DeleteOutboxEvent(id string) error
+	// Назначает повторную попытку (storage.ErrNotFound, если события нет).
+	RetryOutboxEvent(id string, attempts int, nextAttemptAt time.Time, lastError string) error
+}
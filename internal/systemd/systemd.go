@@ -0,0 +1,108 @@
+// Пакет systemd сообщает systemd о состоянии сервиса (sd_notify).
+//
+// Если сервис запущен как юнит с Type=notify, systemd передаёт адрес сокета
+// в переменной NOTIFY_SOCKET, а при заданном WatchdogSec — интервал в
+// WATCHDOG_USEC. Вне systemd переменных нет, и все функции пакета ничего не
+// делают.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Состояния, передаваемые systemd.
+const (
+	// Сервис запущен и принимает запросы.
+	Ready = "READY=1"
+	// Сервис начал остановку.
+	Stopping = "STOPPING=1"
+	// Сервис работоспособен; сбрасывает таймер WatchdogSec.
+	Watchdog = "WATCHDOG=1"
+)
+
+// Отправляет состояние на сокет NOTIFY_SOCKET.
+//
+// Принимает:
+// - state: состояние (Ready, Stopping, Watchdog или другая строка протокола sd_notify).
+//
+// Возвращает:
+// - true, если состояние отправлено; false, если сервис запущен не systemd.
+// - ошибку, если отправить состояние не удалось.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// Имя, начинающееся с @, net интерпретирует как абстрактный сокет Linux.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to send notification: %w", err)
+	}
+	return true, nil
+}
+
+// Возвращает интервал watchdog, заданный systemd (WatchdogSec).
+//
+// Возвращает:
+// - интервал или 0, если watchdog не включён для этого процесса.
+// - ошибку, если значение WATCHDOG_USEC некорректно.
+func WatchdogInterval() (time.Duration, error) {
+	value := os.Getenv("WATCHDOG_USEC")
+	if value == "" {
+		return 0, nil
+	}
+	// WATCHDOG_PID указывает процесс, от которого ожидаются сигналы.
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	usec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", value)
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// Отправляет Watchdog вдвое чаще интервала, пока check успешна.
+//
+// Если check возвращает ошибку (например, база данных недоступна), сигнал
+// пропускается; по истечении WatchdogSec systemd перезапускает сервис
+// согласно Restart=. Блокирует выполнение до отмены контекста.
+//
+// Принимает:
+// - ctx: контекст; при отмене отправка прекращается.
+// - log: указатель на logger для логирования ошибок.
+// - interval: интервал watchdog (см. WatchdogInterval).
+// - check: проверка работоспособности сервиса.
+func RunWatchdog(ctx context.Context, log *slog.Logger, interval time.Duration, check func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, interval/2)
+		err := check(checkCtx)
+		cancel()
+		if err != nil {
+			log.Warn("Health check failed, watchdog notification skipped", slog.String("error", err.Error()))
+			continue
+		}
+		if _, err := Notify(Watchdog); err != nil {
+			log.Error("Failed to notify systemd watchdog", slog.String("error", err.Error()))
+		}
+	}
+}
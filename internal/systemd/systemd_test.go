@@ -0,0 +1,112 @@
+package systemd_test
+
+import (
+	"auth_service/internal/systemd"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Создаёт сокет уведомлений и указывает его в NOTIFY_SOCKET.
+func listen(t *testing.T) *net.UnixConn {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", socket)
+	return conn
+}
+
+// Читает одно уведомление.
+func read(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+// Проверка отправки состояния.
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := systemd.Notify(systemd.Ready)
+	require.NoError(t, err)
+	assert.False(t, sent, "not started by systemd")
+
+	conn := listen(t)
+	sent, err = systemd.Notify(systemd.Ready)
+	require.NoError(t, err)
+	assert.True(t, sent)
+	assert.Equal(t, "READY=1", read(t, conn))
+
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	_, err = systemd.Notify(systemd.Stopping)
+	assert.Error(t, err)
+}
+
+// Проверка чтения интервала watchdog.
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	interval, err := systemd.WatchdogInterval()
+	require.NoError(t, err)
+	assert.Zero(t, interval)
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	interval, err = systemd.WatchdogInterval()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, interval)
+
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	interval, err = systemd.WatchdogInterval()
+	require.NoError(t, err)
+	assert.Zero(t, interval, "watchdog is set for another process")
+
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "soon")
+	_, err = systemd.WatchdogInterval()
+	assert.Error(t, err)
+}
+
+// Проверка пропуска сигнала watchdog при неудачной проверке.
+func TestRunWatchdog(t *testing.T) {
+	conn := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthy := make(chan bool, 1)
+	healthy <- false
+	checks := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		systemd.RunWatchdog(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), 20*time.Millisecond, func(context.Context) error {
+			checks++
+			select {
+			case ok := <-healthy:
+				if !ok {
+					return errors.New("database is unavailable")
+				}
+			default:
+			}
+			return nil
+		})
+	}()
+
+	assert.Equal(t, "WATCHDOG=1", read(t, conn))
+	cancel()
+	<-done
+	assert.GreaterOrEqual(t, checks, 2, "the first failed check is not reported")
+}
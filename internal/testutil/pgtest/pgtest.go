@@ -0,0 +1,193 @@
+// Пакет pgtest поднимает одноразовый PostgreSQL для интеграционных тестов.
+//
+// Использование:
+//
+//	func TestMain(m *testing.M) { os.Exit(pgtest.Run(m)) }
+//
+//	func TestSomething(t *testing.T) {
+//		pool := pgtest.New(t) // отдельная база с применёнными миграциями
+//		...
+//	}
+//
+// Если задана переменная TEST_DATABASE_URL, используется указанный сервер
+// (например, контейнер из docker-compose.test.yaml). Иначе на время прогона
+// тестов пакета запускается контейнер postgres через docker. Если ни то, ни
+// другое недоступно, тесты пропускаются.
+package pgtest
+
+import (
+	"auth_service/internal/migrations"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	image       = "postgres:16-alpine"
+	password    = "password"
+	startupWait = 30 * time.Second
+)
+
+var (
+	once        sync.Once
+	serverURL   string
+	containerID string
+	startErr    error
+)
+
+// Запускает тесты пакета и останавливает контейнер после их завершения.
+//
+// Принимает:
+// - m: *testing.M из TestMain.
+//
+// Возвращает:
+// - код завершения для os.Exit.
+func Run(m *testing.M) int {
+	code := m.Run()
+	if containerID != "" {
+		_ = exec.Command("docker", "rm", "-f", containerID).Run()
+	}
+	return code
+}
+
+// Создаёт отдельную базу данных с применёнными миграциями.
+//
+// База удаляется по завершении теста.
+//
+// Принимает:
+// - t: текущий тест.
+//
+// Возвращает:
+// - пул соединений с созданной базой.
+func New(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	once.Do(func() { serverURL, startErr = startServer() })
+	if startErr != nil {
+		t.Skipf("postgres is not available: %v", startErr)
+	}
+
+	ctx := context.Background()
+	admin, err := pgxpool.Connect(ctx, serverURL)
+	if err != nil {
+		t.Fatalf("failed to connect to postgres: %v", err)
+	}
+	defer admin.Close()
+
+	dbName := "test_" + randomSuffix()
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+dbName); err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+
+	dbURL := withDatabase(serverURL, dbName)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := migrations.ApplyMigrations(dbURL, migrationsPath(), logger); err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+
+	pool, err := pgxpool.Connect(ctx, dbURL)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		pool.Close()
+		admin, err := pgxpool.Connect(context.Background(), serverURL)
+		if err != nil {
+			return
+		}
+		defer admin.Close()
+		_, _ = admin.Exec(context.Background(), "DROP DATABASE IF EXISTS "+dbName+" WITH (FORCE)")
+	})
+
+	return pool
+}
+
+// Возвращает URL сервера: из TEST_DATABASE_URL или запущенного контейнера.
+func startServer() (string, error) {
+	if dbURL := os.Getenv("TEST_DATABASE_URL"); dbURL != "" {
+		return dbURL, waitReady(dbURL)
+	}
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", errors.New("docker is not installed and TEST_DATABASE_URL is not set")
+	}
+
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_PASSWORD="+password,
+		"-p", "127.0.0.1::5432",
+		image,
+	).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to start postgres container: %w", err)
+	}
+	containerID = strings.TrimSpace(string(out))
+
+	out, err = exec.Command("docker", "port", containerID, "5432/tcp").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get container port: %w", err)
+	}
+	hostPort := strings.TrimSpace(strings.Split(string(out), "\n")[0])
+
+	dbURL := fmt.Sprintf("postgres://postgres:%s@%s/postgres?sslmode=disable", password, hostPort)
+	return dbURL, waitReady(dbURL)
+}
+
+// Ожидает, пока сервер начнёт принимать соединения.
+func waitReady(dbURL string) error {
+	deadline := time.Now().Add(startupWait)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		pool, err := pgxpool.Connect(ctx, dbURL)
+		if err == nil {
+			err = pool.Ping(ctx)
+			pool.Close()
+		}
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("postgres did not become ready: %w", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// Заменяет имя базы данных в URL подключения.
+func withDatabase(dbURL, dbName string) string {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return dbURL
+	}
+	u.Path = "/" + dbName
+	return u.String()
+}
+
+// Возвращает file:// путь к каталогу миграций репозитория.
+func migrationsPath() string {
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "..", "storage", "migrations")
+	return "file://" + filepath.ToSlash(dir)
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
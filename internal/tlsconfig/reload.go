@@ -0,0 +1,161 @@
+package tlsconfig
+
+import (
+	"auth_service/internal/metrics"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var certificateReloads = metrics.NewCounterVec(
+	"auth_tls_certificate_reloads_total",
+	"Number of TLS certificate reloads from disk, by result.",
+	"result",
+)
+
+// Сертификат сервера, перечитываемый с диска без перезапуска (например,
+// после продления Let's Encrypt). Используется через tls.Config.GetCertificate:
+// новые соединения получают новый сертификат, установленные не разрываются.
+type Reloader struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+
+	// Отпечаток файлов последней загрузки; защищён mu.
+	mu      sync.Mutex
+	modTime [2]time.Time
+	size    [2]int64
+}
+
+// Загружает сертификат и ключ сервера.
+//
+// Принимает:
+// - certFile, keyFile: сертификат и ключ сервера в PEM.
+//
+// Возвращает:
+// - указатель на Reloader.
+// - ошибку, если файлы не удалось прочитать.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Возвращает текущий сертификат; подходит для tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Перечитывает сертификат и ключ. При ошибке (например, файлы записаны не
+// полностью или ключ не соответствует сертификату) остаётся прежний сертификат.
+//
+// Возвращает:
+// - ошибку, если файлы не удалось прочитать.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reload()
+}
+
+// Перечитывает сертификат и ключ, если файлы изменились (время изменения
+// или размер) с последней загрузки.
+//
+// Возвращает:
+// - true, если сертификат перечитан.
+// - ошибку, если файлы не удалось прочитать.
+func (r *Reloader) ReloadIfChanged() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, size, err := r.stat()
+	if err != nil {
+		certificateReloads.Inc("failure")
+		return false, err
+	}
+	if modTime == r.modTime && size == r.size {
+		return false, nil
+	}
+	return true, r.reload()
+}
+
+func (r *Reloader) reload() error {
+	modTime, size, err := r.stat()
+	if err == nil {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err == nil {
+			r.cert.Store(&cert)
+			r.modTime, r.size = modTime, size
+			certificateReloads.Inc("success")
+			return nil
+		}
+		err = fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	certificateReloads.Inc("failure")
+	return err
+}
+
+// Возвращает время изменения и размер файлов сертификата и ключа. Для
+// символических ссылок (как в /etc/letsencrypt/live) берутся их цели.
+func (r *Reloader) stat() (modTime [2]time.Time, size [2]int64, err error) {
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTime, size, err
+		}
+		modTime[i], size[i] = info.ModTime(), info.Size()
+	}
+	return modTime, size, nil
+}
+
+// Перечитывает сертификат по сигналу и при изменении файлов до отмены контекста.
+//
+// Принимает:
+// - ctx: контекст работы сервиса.
+// - log: логгер.
+// - interval: интервал проверки изменения файлов; 0 — только по сигналу.
+// - signals: сигналы перечитывания (например, SIGHUP).
+func (r *Reloader) Watch(ctx context.Context, log *slog.Logger, interval time.Duration, signals <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if err := r.Reload(); err != nil {
+				log.Error("Failed to reload TLS certificate, keeping the previous one", slog.String("error", err.Error()))
+				continue
+			}
+			log.Info("TLS certificate reloaded", r.expiry())
+		case <-tick:
+			reloaded, err := r.ReloadIfChanged()
+			if err != nil {
+				log.Error("Failed to reload TLS certificate, keeping the previous one", slog.String("error", err.Error()))
+				continue
+			}
+			if reloaded {
+				log.Info("TLS certificate changed on disk, reloaded", r.expiry())
+			}
+		}
+	}
+}
+
+// Атрибут лога со сроком действия текущего сертификата.
+func (r *Reloader) expiry() slog.Attr {
+	if leaf := r.cert.Load().Leaf; leaf != nil {
+		return slog.Time("not_after", leaf.NotAfter)
+	}
+	return slog.Attr{}
+}
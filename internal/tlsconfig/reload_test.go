@@ -0,0 +1,68 @@
+package tlsconfig
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка перечитывания сертификата при изменении файлов.
+func TestReloader_ReloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, first := writeCert(t, dir)
+	r, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	current := func() []byte {
+		cert, err := r.GetCertificate(nil)
+		require.NoError(t, err)
+		return cert.Certificate[0]
+	}
+	assert.Equal(t, first.Raw, current())
+
+	reloaded, err := r.ReloadIfChanged()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "files are unchanged")
+
+	// Продление: новые файлы по тем же путям.
+	_, _, second := writeCert(t, dir)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	reloaded, err = r.ReloadIfChanged()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, second.Raw, current())
+
+	// Повреждённый файл не заменяет действующий сертификат.
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	_, err = r.ReloadIfChanged()
+	assert.Error(t, err)
+	assert.Equal(t, second.Raw, current())
+}
+
+// Проверка перечитывания сертификата по сигналу.
+func TestReloader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeCert(t, dir)
+	r, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal)
+	go r.Watch(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), 0, signals)
+
+	_, _, renewed := writeCert(t, dir)
+	signals <- syscall.SIGHUP
+	assert.Eventually(t, func() bool {
+		cert, _ := r.GetCertificate(nil)
+		return string(cert.Certificate[0]) == string(renewed.Raw)
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,130 @@
+// Пакет tlsconfig создаёт конфигурацию TLS HTTP-сервера из настроек
+// http_server.tls: сертификат и ключ, минимальную версию протокола и
+// допустимые наборы шифров.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Версии TLS, которые можно указать в min_version.
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Создаёт конфигурацию TLS сервера. Сертификат выдаётся через
+// GetCertificate, поэтому его можно заменить без перезапуска (см. Reloader).
+//
+// Принимает:
+// - certFile, keyFile: сертификат (с цепочкой промежуточных УЦ) и ключ сервера в PEM.
+// - minVersion: минимальная версия протокола, "1.2" или "1.3"; пусто — 1.2.
+// - cipherSuites: имена наборов шифров для TLS 1.2 (например,
+// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256); пусто — наборы Go по умолчанию.
+// Наборы шифров TLS 1.3 не настраиваются.
+//
+// Возвращает:
+// - конфигурацию TLS.
+// - загрузчик сертификата для перечитывания с диска.
+// - ошибку, если файлы не удалось прочитать или параметры некорректны.
+func New(certFile, keyFile, minVersion string, cipherSuites []string) (*tls.Config, *Reloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, nil, errors.New("cert_file and key_file are required")
+	}
+	config := &tls.Config{}
+	if err := SetProtocol(config, minVersion, cipherSuites); err != nil {
+		return nil, nil, err
+	}
+	reloader, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.GetCertificate = reloader.GetCertificate
+	return config, reloader, nil
+}
+
+// Устанавливает минимальную версию протокола и наборы шифров в
+// конфигурации TLS (например, созданной менеджером ACME).
+//
+// Принимает:
+// - config: конфигурация TLS.
+// - minVersion, cipherSuites: как в New.
+//
+// Возвращает:
+// - ошибку, если параметры некорректны.
+func SetProtocol(config *tls.Config, minVersion string, cipherSuites []string) error {
+	version, err := ParseVersion(minVersion)
+	if err != nil {
+		return err
+	}
+	suites, err := ParseCipherSuites(cipherSuites)
+	if err != nil {
+		return err
+	}
+	if len(suites) > 0 && version == tls.VersionTLS13 {
+		return errors.New("cipher_suites have no effect with min_version 1.3")
+	}
+	config.MinVersion, config.CipherSuites = version, suites
+	return nil
+}
+
+// Возвращает константу crypto/tls для версии протокола.
+//
+// Принимает:
+// - version: "1.2" или "1.3"; пусто — 1.2.
+//
+// Возвращает:
+// - версию протокола.
+// - ошибку, если версия не поддерживается.
+func ParseVersion(version string) (uint16, error) {
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+	v, ok := versions[strings.TrimPrefix(strings.ToLower(version), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported min_version %q, expected 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// Возвращает идентификаторы наборов шифров по их именам.
+//
+// Принимаются только наборы из tls.CipherSuites(): наборы с известными
+// уязвимостями (tls.InsecureCipherSuites()) отклоняются.
+//
+// Принимает:
+// - names: имена наборов шифров.
+//
+// Возвращает:
+// - идентификаторы в том же порядке; nil для пустого списка.
+// - ошибку, если набор неизвестен или небезопасен.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if insecure[name] {
+			return nil, fmt.Errorf("cipher suite %s is insecure", name)
+		}
+		id, ok := secure[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,106 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Записывает самоподписанный сертификат localhost и его ключ в PEM в dir.
+func writeCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile, cert
+}
+
+func TestNew(t *testing.T) {
+	certFile, keyFile, cert := writeCert(t, t.TempDir())
+	config, _, err := New(certFile, keyFile, "1.3", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	dial := func(max uint16) error {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost", MaxVersion: max}}}
+		resp, err := c.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	assert.NoError(t, dial(tls.VersionTLS13))
+	assert.Error(t, dial(tls.VersionTLS12), "TLS 1.2 is below min_version")
+
+	// Некорректные параметры.
+	_, _, err = New("", keyFile, "", nil)
+	assert.Error(t, err)
+	_, _, err = New(certFile, keyFile, "1.1", nil)
+	assert.Error(t, err)
+	_, _, err = New(certFile, keyFile, "1.3", []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	assert.Error(t, err)
+	_, _, err = New(filepath.Join(t.TempDir(), "missing.pem"), keyFile, "", nil)
+	assert.Error(t, err)
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}, ids)
+
+	ids, err = ParseCipherSuites(nil)
+	require.NoError(t, err)
+	assert.Nil(t, ids)
+
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.ErrorContains(t, err, "insecure")
+	_, err = ParseCipherSuites([]string{"TLS_UNKNOWN"})
+	assert.ErrorContains(t, err, "unknown")
+}
+
+func TestParseVersion(t *testing.T) {
+	for version, want := range map[string]uint16{"": tls.VersionTLS12, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13, "TLS1.3": tls.VersionTLS13} {
+		got, err := ParseVersion(version)
+		require.NoError(t, err, version)
+		assert.Equal(t, want, got, version)
+	}
+	_, err := ParseVersion("1.0")
+	assert.Error(t, err)
+}
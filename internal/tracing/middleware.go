@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Создаёт middleware, записывающее спан каждого HTTP-запроса.
+//
+// Спан продолжает трассировку вызывающего сервиса из заголовка traceparent
+// и называется по методу и шаблону маршрута ("POST /api/v1/auth/refresh").
+// Ответы 5xx отмечаются как ошибки; 4xx — нет, это ошибки клиента.
+//
+// Принимает:
+// - next: обработчик маршрута.
+//
+// Возвращает:
+// - http.Handler.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.Pattern
+		if route == "" {
+			route = r.URL.Path
+		}
+		ctx := Extract(r.Context(), r.Header.Get(TraceparentHeader))
+		ctx, span := Start(ctx, KindServer, r.Method+" "+route,
+			String("http.request.method", r.Method),
+			String("http.route", route),
+			String("url.path", r.URL.Path),
+		)
+		if span == nil {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttributes(Int("http.response.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("HTTP %d %s", sw.status, http.StatusText(sw.status)))
+		}
+	})
+}
+
+// http.ResponseWriter, запоминающий код ответа.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status, sw.wroteHeader = status, true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(p)
+}
+
+// Возвращает исходный ResponseWriter (для http.ResponseController).
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// Коды gRPC, означающие сбой сервера, а не ошибку клиента.
+var serverErrorCodes = map[codes.Code]bool{
+	codes.Unknown:          true,
+	codes.DeadlineExceeded: true,
+	codes.Unimplemented:    true,
+	codes.Internal:         true,
+	codes.Unavailable:      true,
+	codes.DataLoss:         true,
+}
+
+// Создаёт перехватчик, записывающий спан каждого вызова gRPC.
+//
+// Спан продолжает трассировку вызывающего сервиса из метаданных traceparent
+// и называется полным именем метода. Ошибкой отмечаются только сбои сервера
+// (Internal, Unavailable и т. п.).
+//
+// Возвращает:
+// - grpc.UnaryServerInterceptor.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !Enabled() {
+			return handler(ctx, req)
+		}
+
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(TraceparentHeader); len(values) > 0 {
+				ctx = Extract(ctx, values[0])
+			}
+		}
+		ctx, span := Start(ctx, KindServer, info.FullMethod,
+			String("rpc.system", "grpc"),
+			String("rpc.method", info.FullMethod),
+		)
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		span.SetAttributes(Int("rpc.grpc.status_code", int(code)))
+		if serverErrorCodes[code] {
+			span.SetError(err)
+		}
+		span.End()
+		return resp, err
+	}
+}
@@ -0,0 +1,325 @@
+package tracing
+
+import (
+	"auth_service/internal/metrics"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var exportedSpans = metrics.NewCounterVec(
+	"auth_tracing_spans_total",
+	"Number of finished trace spans, by result: exported, failed (the collector rejected the batch or was unreachable) or dropped (the export queue was full).",
+	"result",
+)
+
+// Параметры OTLPExporter.
+type OTLPConfig struct {
+	// Адрес приёмника OTLP/HTTP; спаны отправляются на <Endpoint>/v1/traces.
+	Endpoint string
+	// Дополнительные заголовки запросов (например, авторизация у приёмника).
+	Headers map[string]string
+	// Имя сервиса (атрибут ресурса service.name).
+	ServiceName string
+	// Наибольшее время между завершением спана и его отправкой.
+	BatchTimeout time.Duration
+	// Наибольшее число спанов в одном запросе.
+	BatchSize int
+	// Наибольшее число спанов, ожидающих отправки; спаны сверх него отбрасываются.
+	MaxQueueSize int
+	// Время ожидания ответа приёмника.
+	Timeout time.Duration
+}
+
+// Экспортёр, отправляющий спаны пачками по протоколу OTLP/HTTP в кодировке
+// JSON (коллектор OpenTelemetry, Jaeger, Grafana Tempo и т. п.).
+//
+// Export не блокирует: спаны ставятся в очередь и отправляются фоновой
+// горутиной. Если приёмник недоступен, пачка отбрасывается, чтобы очередь не
+// росла; это учитывается метрикой auth_tracing_spans_total.
+type OTLPExporter struct {
+	log    *slog.Logger
+	cfg    OTLPConfig
+	url    string
+	client *http.Client
+
+	queue chan SpanData
+	flush chan chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Создаёт экспортёр и запускает его фоновую отправку.
+//
+// Принимает:
+// - log: логгер для ошибок отправки.
+// - cfg: параметры экспортёра; незаданные BatchTimeout, BatchSize,
+// MaxQueueSize и Timeout получают значения по умолчанию.
+//
+// Возвращает:
+// - указатель на OTLPExporter.
+// - ошибку, если адрес приёмника не задан.
+func NewOTLPExporter(log *slog.Logger, cfg OTLPConfig) (*OTLPExporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("tracing: OTLP endpoint is required")
+	}
+	if cfg.BatchTimeout <= 0 {
+		cfg.BatchTimeout = 5 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = 2048
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	e := &OTLPExporter{
+		log:    log,
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces",
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan SpanData, cfg.MaxQueueSize),
+		flush:  make(chan chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// Ставит спан в очередь отправки; при переполненной очереди спан отбрасывается.
+func (e *OTLPExporter) Export(span SpanData) {
+	select {
+	case e.queue <- span:
+	default:
+		exportedSpans.Inc("dropped")
+	}
+}
+
+// Отправляет спаны, ожидающие в очереди, и дожидается ответа приёмника.
+//
+// Принимает:
+// - ctx: контекст, ограничивающий ожидание.
+//
+// Возвращает:
+// - ошибку контекста, если отправка не завершилась вовремя.
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case e.flush <- flushed:
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Отправляет оставшиеся спаны и останавливает экспортёр; спаны,
+// завершённые после остановки, отбрасываются.
+//
+// Принимает:
+// - ctx: контекст, ограничивающий ожидание отправки.
+//
+// Возвращает:
+// - ошибку контекста, если отправка не завершилась вовремя.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.cfg.BatchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, e.cfg.BatchSize)
+	send := func() {
+		if len(batch) > 0 {
+			e.send(batch)
+			batch = batch[:0]
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case span := <-e.queue:
+				if batch = append(batch, span); len(batch) == e.cfg.BatchSize {
+					send()
+				}
+			default:
+				send()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			if batch = append(batch, span); len(batch) == e.cfg.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-e.flush:
+			drain()
+			close(flushed)
+		case <-e.stop:
+			drain()
+			return
+		}
+	}
+}
+
+// Отправляет пачку спанов приёмнику.
+func (e *OTLPExporter) send(batch []SpanData) {
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		exportedSpans.Add(float64(len(batch)), "failed")
+		e.log.Error("Failed to encode trace spans", slog.String("error", err.Error()))
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		exportedSpans.Add(float64(len(batch)), "failed")
+		e.log.Error("Failed to export trace spans", slog.String("error", err.Error()))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		exportedSpans.Add(float64(len(batch)), "failed")
+		e.log.Warn("Failed to export trace spans", slog.String("error", err.Error()))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		exportedSpans.Add(float64(len(batch)), "failed")
+		e.log.Warn("Trace collector rejected spans", slog.Int("status", resp.StatusCode))
+		return
+	}
+	exportedSpans.Add(float64(len(batch)), "exported")
+}
+
+// Тело запроса ExportTraceServiceRequest в кодировке OTLP/JSON.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         Kind            `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	// 0 — не задан, 2 — ошибка.
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// Собирает тело запроса для пачки спанов.
+func (e *OTLPExporter) request(batch []SpanData) otlpRequest {
+	spans := make([]otlpSpan, len(batch))
+	for i, span := range batch {
+		s := otlpSpan{
+			TraceID:    span.Context.TraceID.String(),
+			SpanID:     span.Context.SpanID.String(),
+			Name:       span.Name,
+			Kind:       span.Kind,
+			Start:      strconv.FormatInt(span.Start.UnixNano(), 10),
+			End:        strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes: otlpAttributes(span.Attributes),
+		}
+		if span.Parent != (SpanID{}) {
+			s.ParentSpanID = span.Parent.String()
+		}
+		if span.Error != "" {
+			s.Status = otlpStatus{Code: 2, Message: span.Error}
+		}
+		spans[i] = s
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes([]Attribute{String("service.name", e.cfg.ServiceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "auth_service"}, Spans: spans}},
+	}}}
+}
+
+// Преобразует атрибуты в AnyValue OTLP; целые числа передаются строкой.
+func otlpAttributes(attrs []Attribute) []otlpAttribute {
+	result := make([]otlpAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		var value map[string]any
+		switch v := attr.Value.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		result = append(result, otlpAttribute{Key: attr.Key, Value: value})
+	}
+	return result
+}
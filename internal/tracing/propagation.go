@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+)
+
+// Заголовок W3C Trace Context с положением вызывающего спана.
+const TraceparentHeader = "traceparent"
+
+// Флаг sampled в traceparent.
+const flagSampled = 0x01
+
+// Добавляет в контекст входящую трассировку из значения traceparent
+// (W3C Trace Context): спаны, начатые в этом контексте, станут её частью.
+//
+// Принимает:
+// - ctx: контекст входящего запроса.
+// - traceparent: значение заголовка (HTTP) или метаданных (gRPC); пустое или
+// некорректное значение игнорируется, и начинается новая трассировка.
+//
+// Возвращает:
+// - контекст с входящей трассировкой.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	sc, ok := ParseTraceparent(traceparent)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// Возвращает значение traceparent для передачи текущей трассировки в
+// исходящем запросе.
+//
+// Принимает:
+// - ctx: контекст операции.
+//
+// Возвращает:
+// - значение traceparent или пустую строку, если трассировки нет.
+func Inject(ctx context.Context) string {
+	sc := SpanContextFrom(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return FormatTraceparent(sc)
+}
+
+// Форматирует положение спана как traceparent версии 00.
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Разбирает значение traceparent.
+//
+// Принимает:
+// - value: значение вида 00-<trace-id>-<parent-id>-<flags>. Версии новее 00
+// разбираются по тем же первым полям, как требует спецификация.
+//
+// Возвращает:
+// - положение вызывающего спана.
+// - false, если значение некорректно или идентификаторы нулевые.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	// 2 + 1 + 32 + 1 + 16 + 1 + 2
+	const length = 55
+	if len(value) < length || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return SpanContext{}, false
+	}
+	var version [1]byte
+	if _, err := hex.Decode(version[:], []byte(value[:2])); err != nil || version[0] == 0xff {
+		return SpanContext{}, false
+	}
+	if version[0] == 0 && len(value) != length || len(value) > length && value[length] != '-' {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(value[3:35])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(value[36:52])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(value[53:55])); err != nil {
+		return SpanContext{}, false
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&flagSampled != 0
+	return sc, true
+}
@@ -0,0 +1,259 @@
+// Пакет tracing записывает спаны OpenTelemetry и передаёт их экспортёру
+// (см. OTLPExporter), чтобы задержки запросов можно было проследить через
+// несколько сервисов.
+//
+// Контекст трассировки принимается и передаётся в формате W3C Trace Context
+// (заголовок traceparent). Пока экспортёр не установлен (Set), Start
+// возвращает nil-спан, методы которого ничего не делают, и трассировка не
+// создаёт накладных расходов.
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// Идентификатор трассировки.
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// Идентификатор спана.
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// Положение спана в трассировке.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Трассировка записывается; незаписываемые спаны только передают
+	// идентификаторы дальше.
+	Sampled bool
+}
+
+// Сообщает, что идентификаторы заданы.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Вид спана; значения совпадают с SpanKind в OTLP.
+type Kind int
+
+const (
+	// Операция внутри сервиса.
+	KindInternal Kind = 1
+	// Обработка входящего запроса.
+	KindServer Kind = 2
+	// Исходящий запрос (в том числе к базе данных).
+	KindClient Kind = 3
+)
+
+// Атрибут спана. Value — string, int64, float64 или bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attribute        { return Attribute{Key: key, Value: value} }
+func Int(key string, value int) Attribute       { return Attribute{Key: key, Value: int64(value)} }
+func Bool(key string, value bool) Attribute     { return Attribute{Key: key, Value: value} }
+func Float(key string, value float64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Завершённый спан, передаваемый экспортёру.
+type SpanData struct {
+	Name    string
+	Kind    Kind
+	Context SpanContext
+	// Родительский спан; нулевой у корневого спана.
+	Parent     SpanID
+	Start, End time.Time
+	Attributes []Attribute
+	// Текст ошибки; пуст, если операция успешна.
+	Error string
+}
+
+// Получатель завершённых спанов.
+type Exporter interface {
+	// Принимает спан; не должен блокировать вызывающего.
+	Export(span SpanData)
+}
+
+type tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+}
+
+var current atomic.Pointer[tracer]
+
+// Включает трассировку. Вызывается при запуске.
+//
+// Принимает:
+// - exporter: получатель спанов; nil выключает трассировку.
+// - sampleRatio: доля записываемых трассировок от 0 до 1. Решение
+// принимается для корневого спана; продолжение входящей трассировки
+// записывается, если записывается она.
+func Set(exporter Exporter, sampleRatio float64) {
+	if exporter == nil {
+		current.Store(nil)
+		return
+	}
+	current.Store(&tracer{exporter: exporter, sampleRatio: sampleRatio})
+}
+
+// Сообщает, что трассировка включена.
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Записываемый спан. Методы nil-спана ничего не делают, поэтому результат
+// Start можно использовать без проверок.
+type Span struct {
+	tracer *tracer
+	data   SpanData
+}
+
+type spanKey struct{}
+
+// Начинает спан, дочерний по отношению к спану из ctx (или к входящей
+// трассировке, см. Extract).
+//
+// Принимает:
+// - ctx: контекст операции.
+// - kind: вид спана.
+// - name: имя операции.
+// - attrs: атрибуты спана.
+//
+// Возвращает:
+// - контекст с новым спаном для дочерних операций.
+// - спан; nil, если трассировка выключена или трассировка не записывается.
+func Start(ctx context.Context, kind Kind, name string, attrs ...Attribute) (context.Context, *Span) {
+	t := current.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFrom(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: parent.Sampled}
+	if !parent.IsValid() {
+		sc.TraceID = newTraceID()
+		sc.Sampled = rand.Float64() < t.sampleRatio
+	}
+	if !sc.Sampled {
+		// Идентификаторы передаются дальше, чтобы дочерние спаны тоже не записывались.
+		return context.WithValue(ctx, spanKey{}, sc), nil
+	}
+
+	span := &Span{tracer: t, data: SpanData{
+		Name:       name,
+		Kind:       kind,
+		Context:    sc,
+		Parent:     parent.SpanID,
+		Start:      time.Now(),
+		Attributes: attrs,
+	}}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Записывает уже завершённую операцию как дочерний спан спана из ctx. Нужен,
+// когда о длительности операции становится известно после её окончания
+// (например, из журнала запросов драйвера базы данных).
+//
+// Принимает:
+// - ctx: контекст операции.
+// - kind: вид спана.
+// - name: имя операции.
+// - start, end: время начала и окончания.
+// - err: ошибка операции; nil — успех.
+// - attrs: атрибуты спана.
+func Record(ctx context.Context, kind Kind, name string, start, end time.Time, err error, attrs ...Attribute) {
+	if _, ok := ctx.Value(spanKey{}).(*Span); !ok {
+		// Операции вне записываемой трассировки не записываются отдельно.
+		return
+	}
+	_, span := Start(ctx, kind, name, attrs...)
+	if span == nil {
+		return
+	}
+	span.data.Start = start
+	span.SetError(err)
+	span.end(end)
+}
+
+// Добавляет атрибуты спана.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// Отмечает спан как завершившийся ошибкой; nil ничего не меняет.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.data.Error = err.Error()
+}
+
+// Завершает спан и передаёт его экспортёру. Повторный вызов ничего не делает.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end(time.Now())
+}
+
+func (s *Span) end(at time.Time) {
+	if !s.data.End.IsZero() {
+		return
+	}
+	s.data.End = at
+	s.tracer.exporter.Export(s.data)
+}
+
+// Возвращает положение спана в трассировке.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// Возвращает положение текущего спана из ctx: записываемого, незаписываемого
+// или входящей трассировки. Нулевое значение, если трассировки нет.
+func SpanContextFrom(ctx context.Context) SpanContext {
+	switch v := ctx.Value(spanKey{}).(type) {
+	case *Span:
+		return v.data.Context
+	case SpanContext:
+		return v
+	}
+	return SpanContext{}
+}
+
+// Сообщает, что операции в ctx записываются в трассировку.
+func Recording(ctx context.Context) bool {
+	_, ok := ctx.Value(spanKey{}).(*Span)
+	return ok
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		binary.LittleEndian.PutUint64(id[:8], rand.Uint64())
+		binary.LittleEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		binary.LittleEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
@@ -0,0 +1,206 @@
+package tracing_test
+
+import (
+	"auth_service/internal/tracing"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Экспортёр, сохраняющий завершённые спаны.
+type recorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *recorder) Export(span tracing.SpanData) {
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+}
+
+// Включает трассировку на время теста.
+func useRecorder(t *testing.T, sampleRatio float64) *recorder {
+	t.Helper()
+
+	r := &recorder{}
+	tracing.Set(r, sampleRatio)
+	t.Cleanup(func() { tracing.Set(nil, 0) })
+	return r
+}
+
+// Проверка разбора и форматирования заголовка traceparent.
+func TestTraceparent(t *testing.T) {
+	const value = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := tracing.ParseTraceparent(value)
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, value, tracing.FormatTraceparent(sc))
+
+	// Поля будущих версий после известных игнорируются.
+	_, ok = tracing.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.True(t, ok)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, ok := tracing.ParseTraceparent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+// Проверка связи дочерних спанов с родительским и входящей трассировкой.
+func TestStart(t *testing.T) {
+	ctx, span := tracing.Start(context.Background(), tracing.KindInternal, "disabled")
+	assert.Nil(t, span, "tracing is disabled")
+	assert.False(t, tracing.Recording(ctx))
+	span.End()
+
+	r := useRecorder(t, 1)
+	ctx = tracing.Extract(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := tracing.Start(ctx, tracing.KindServer, "parent")
+	_, child := tracing.Start(ctx, tracing.KindInternal, "child", tracing.String("key", "value"))
+	child.SetError(errors.New("failed"))
+	child.End()
+	child.End()
+	start := time.Now().Add(-time.Second)
+	tracing.Record(ctx, tracing.KindClient, "query", start, start.Add(time.Millisecond), nil)
+	parent.End()
+
+	require.Len(t, r.spans, 3)
+	childData, query, parentData := r.spans[0], r.spans[1], r.spans[2]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", parentData.Context.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", parentData.Parent.String())
+	assert.Equal(t, parentData.Context.TraceID, childData.Context.TraceID)
+	assert.Equal(t, parentData.Context.SpanID, childData.Parent)
+	assert.Equal(t, []tracing.Attribute{tracing.String("key", "value")}, childData.Attributes)
+	assert.Equal(t, "failed", childData.Error)
+	assert.Equal(t, parentData.Context.SpanID, query.Parent)
+	assert.Equal(t, time.Millisecond, query.End.Sub(query.Start))
+	assert.Equal(t, tracing.Inject(ctx), tracing.FormatTraceparent(parentData.Context))
+}
+
+// Проверка, что незаписываемые трассировки не записываются и в дочерних спанах.
+func TestStart_NotSampled(t *testing.T) {
+	r := useRecorder(t, 0)
+
+	ctx, span := tracing.Start(context.Background(), tracing.KindServer, "root")
+	assert.Nil(t, span)
+	assert.NotEmpty(t, tracing.Inject(ctx), "identifiers are still propagated")
+	tracing.Record(ctx, tracing.KindClient, "query", time.Now(), time.Now(), nil)
+
+	ctx = tracing.Extract(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span = tracing.Start(ctx, tracing.KindServer, "remote")
+	assert.Nil(t, span, "caller did not sample the trace")
+
+	ctx = tracing.Extract(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span = tracing.Start(ctx, tracing.KindServer, "remote")
+	assert.NotNil(t, span, "caller sampled the trace")
+	assert.Empty(t, r.spans, "unsampled spans are not exported")
+}
+
+// Проверка спана HTTP-запроса: имя по шаблону маршрута, продолжение
+// трассировки вызывающего и ошибка для ответов 5xx.
+func TestMiddleware(t *testing.T) {
+	r := useRecorder(t, 1)
+
+	mux := http.NewServeMux()
+	mux.Handle("/items/{id}", tracing.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.True(t, tracing.Recording(req.Context()))
+		if req.PathValue("id") == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/broken", nil))
+
+	require.Len(t, r.spans, 2)
+	ok, broken := r.spans[0], r.spans[1]
+	assert.Equal(t, "GET /items/{id}", ok.Name)
+	assert.Equal(t, tracing.KindServer, ok.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", ok.Context.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", ok.Parent.String())
+	assert.Contains(t, ok.Attributes, tracing.Int("http.response.status_code", http.StatusOK))
+	assert.Empty(t, ok.Error)
+	assert.Contains(t, broken.Attributes, tracing.Int("http.response.status_code", http.StatusInternalServerError))
+	assert.NotEmpty(t, broken.Error)
+	assert.NotEqual(t, ok.Context.TraceID, broken.Context.TraceID, "request without traceparent starts a new trace")
+}
+
+// Проверка отправки спанов приёмнику в кодировке OTLP/JSON.
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var body map[string]any
+	var headers http.Header
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		headers = r.Header.Clone()
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer collector.Close()
+
+	exporter, err := tracing.NewOTLPExporter(slog.New(slog.NewTextHandler(io.Discard, nil)), tracing.OTLPConfig{
+		Endpoint:     collector.URL + "/",
+		Headers:      map[string]string{"Authorization": "Bearer token"},
+		ServiceName:  "auth_service",
+		BatchTimeout: time.Hour,
+	})
+	require.NoError(t, err)
+
+	sc, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	start := time.Unix(1700000000, 0)
+	exporter.Export(tracing.SpanData{
+		Name:       "auth.RefreshTokens",
+		Kind:       tracing.KindInternal,
+		Context:    sc,
+		Start:      start,
+		End:        start.Add(time.Millisecond),
+		Attributes: []tracing.Attribute{tracing.String("db.system", "postgresql"), tracing.Int("rows", 1)},
+		Error:      "failed",
+	})
+	require.NoError(t, exporter.Flush(context.Background()))
+	require.NoError(t, exporter.Shutdown(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", headers.Get("Authorization"))
+
+	resourceSpans := body["resourceSpans"].([]any)[0].(map[string]any)
+	assert.Equal(t, map[string]any{"attributes": []any{
+		map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "auth_service"}},
+	}}, resourceSpans["resource"])
+	span := resourceSpans["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", span["spanId"])
+	assert.NotContains(t, span, "parentSpanId")
+	assert.Equal(t, "auth.RefreshTokens", span["name"])
+	assert.Equal(t, float64(tracing.KindInternal), span["kind"])
+	assert.Equal(t, "1700000000000000000", span["startTimeUnixNano"])
+	assert.Equal(t, "1700000000001000000", span["endTimeUnixNano"])
+	assert.Equal(t, map[string]any{"code": float64(2), "message": "failed"}, span["status"])
+	assert.Contains(t, span["attributes"], map[string]any{"key": "rows", "value": map[string]any{"intValue": "1"}})
+}
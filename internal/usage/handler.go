@@ -0,0 +1,95 @@
+package usage
+
+import (
+	"auth_service/internal/i18n"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Формат дат в параметрах from и to.
+const dateLayout = "2006-01-02"
+
+// Период по умолчанию, если from не задан.
+const defaultPeriod = 30 * 24 * time.Hour
+
+// Строка статистики в ответе GET /admin/usage.
+type Row struct {
+	Day       string `json:"day"`
+	API       string `json:"api"`
+	Operation string `json:"operation"`
+	Result    string `json:"result"`
+	Count     int64  `json:"count"`
+}
+
+// Создаёт обработчик GET /admin/usage?from=YYYY-MM-DD&to=YYYY-MM-DD.
+//
+// Возвращает записанную в хранилище суточную статистику за период с from по
+// to включительно; по умолчанию — за последние 30 суток. Счётчики, ещё не
+// записанные задачей usage_flush, в ответ не входят.
+//
+// Возвращает:
+// - http.Handler.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		mu.Lock()
+		s := store
+		mu.Unlock()
+		if s == nil {
+			i18n.Error(w, r, "usage_stats_not_supported", http.StatusNotImplemented)
+			return
+		}
+
+		from, to, ok := period(r)
+		if !ok {
+			i18n.Error(w, r, "invalid_period", http.StatusBadRequest)
+			return
+		}
+
+		stored, err := s.ListUsage(from, to)
+		if err != nil {
+			i18n.Error(w, r, "service_unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		rows := make([]Row, 0, len(stored))
+		for _, row := range stored {
+			rows = append(rows, Row{
+				Day:       row.Day.UTC().Format(dateLayout),
+				API:       row.API,
+				Operation: row.Operation,
+				Result:    row.Result,
+				Count:     row.Count,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rows)
+	})
+}
+
+// Возвращает период запроса статистики из параметров from и to.
+func period(r *http.Request) (time.Time, time.Time, bool) {
+	to := day(time.Now())
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultPeriod)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+	return from, to, !from.After(to)
+}
@@ -0,0 +1,109 @@
+package usage
+
+import (
+	"auth_service/pkg/authpb"
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Создаёт middleware, учитывающее запросы HTTP API.
+//
+// Результат определяется по коду ответа: 2xx и 3xx — ResultSuccess,
+// 4xx — ResultRejected, 5xx — ResultError.
+//
+// Принимает:
+// - operation: операция маршрута.
+// - next: обработчик маршрута.
+//
+// Возвращает:
+// - http.Handler.
+func Middleware(operation string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		Record(APIHTTP, operation, httpResult(sw.status))
+	})
+}
+
+// Результат запроса по коду ответа HTTP.
+func httpResult(code int) string {
+	switch {
+	case code >= http.StatusInternalServerError:
+		return ResultError
+	case code >= http.StatusBadRequest:
+		return ResultRejected
+	default:
+		return ResultSuccess
+	}
+}
+
+// http.ResponseWriter, запоминающий код ответа.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.status, sw.wroteHeader = status, true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(p)
+}
+
+// Возвращает исходный ResponseWriter (для http.ResponseController).
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// Операции методов gRPC API.
+var grpcOperations = map[string]string{
+	"IssueTokens":   OperationIssue,
+	"RefreshTokens": OperationRefresh,
+	"ValidateToken": OperationValidate,
+	"RevokeSession": OperationRevoke,
+}
+
+// Создаёт перехватчик, учитывающий вызовы методов AuthService.
+//
+// Вызовы других сервисов (проверка состояния, reflection) не учитываются.
+// Результат определяется по коду статуса: ошибки клиента (InvalidArgument,
+// Unauthenticated, PermissionDenied, NotFound и т. п.) — ResultRejected,
+// остальные ошибки — ResultError.
+//
+// Возвращает:
+// - grpc.UnaryServerInterceptor.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+
+		method, ok := strings.CutPrefix(info.FullMethod, "/"+authpb.AuthService_ServiceDesc.ServiceName+"/")
+		if operation, known := grpcOperations[method]; ok && known {
+			Record(APIGRPC, operation, grpcResult(err))
+		}
+		return resp, err
+	}
+}
+
+// Результат вызова по ошибке gRPC.
+func grpcResult(err error) string {
+	switch status.Code(err) {
+	case codes.OK:
+		return ResultSuccess
+	case codes.InvalidArgument, codes.Unauthenticated, codes.PermissionDenied,
+		codes.NotFound, codes.FailedPrecondition, codes.ResourceExhausted, codes.Canceled:
+		return ResultRejected
+	default:
+		return ResultError
+	}
+}
@@ -0,0 +1,136 @@
+// Пакет usage учитывает запросы к API по интерфейсу (http, grpc), операции и
+// результату для планирования мощностей и биллинга.
+//
+// Каждый запрос учитывается сразу в метрике Prometheus
+// auth_usage_requests_total и в счётчиках процесса, которые периодически
+// записываются в хранилище (см. Flush) и доступны через GET /admin/usage.
+// Счётчики ведутся по суткам (UTC), в которые пришёл запрос.
+package usage
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/storage"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Интерфейсы API.
+const (
+	APIHTTP = "http"
+	APIGRPC = "grpc"
+)
+
+// Операции.
+const (
+	OperationIssue    = "issue"
+	OperationLogin    = "login"
+	OperationRefresh  = "refresh"
+	OperationValidate = "validate"
+	OperationRevoke   = "revoke"
+	OperationSessions = "sessions"
+)
+
+// Результаты запросов.
+const (
+	// Запрос выполнен.
+	ResultSuccess = "success"
+	// Запрос отклонён из-за клиента: некорректные данные, недействительный токен и т. п.
+	ResultRejected = "rejected"
+	// Запрос не выполнен из-за ошибки сервиса или хранилища.
+	ResultError = "error"
+)
+
+var requests = metrics.NewCounterVec(
+	"auth_usage_requests_total",
+	"Number of API requests, by API surface, operation and result.",
+	"api", "operation", "result",
+)
+
+var (
+	mu sync.Mutex
+	// Накопленные с последней записи количества; Count в ключе всегда 0.
+	pending = make(map[storage.UsageRow]int64)
+	store   storage.UsageStats
+)
+
+// Устанавливает хранилище статистики.
+//
+// Принимает:
+// - s: хранилище; nil — счётчики учитываются только в метрике Prometheus.
+func SetStore(s storage.UsageStats) {
+	mu.Lock()
+	defer mu.Unlock()
+	store = s
+}
+
+// Учитывает запрос.
+//
+// Принимает:
+// - api: интерфейс (APIHTTP, APIGRPC).
+// - operation: операция.
+// - result: результат (ResultSuccess, ResultRejected, ResultError).
+func Record(api, operation, result string) {
+	requests.Inc(api, operation, result)
+
+	key := storage.UsageRow{Day: day(time.Now()), API: api, Operation: operation, Result: result}
+	mu.Lock()
+	defer mu.Unlock()
+	if store != nil {
+		pending[key]++
+	}
+}
+
+// Записывает накопленные счётчики в хранилище.
+//
+// Вызывается периодической задачей на каждой реплике: каждая реплика
+// записывает только свои счётчики, и хранилище суммирует их. Если запись не
+// удалась, счётчики возвращаются в накопленные и будут записаны при
+// следующем вызове.
+//
+// Принимает:
+// - ctx: контекст выполнения.
+//
+// Возвращает:
+// - количество записанных строк.
+// - ошибку, если запись не удалась.
+func Flush(ctx context.Context) (int, error) {
+	mu.Lock()
+	s, counts := store, pending
+	pending = make(map[storage.UsageRow]int64)
+	mu.Unlock()
+
+	if s == nil || len(counts) == 0 {
+		return 0, nil
+	}
+
+	rows := make([]storage.UsageRow, 0, len(counts))
+	for key, count := range counts {
+		key.Count = count
+		rows = append(rows, key)
+	}
+	if err := ctx.Err(); err != nil {
+		restore(counts)
+		return 0, err
+	}
+	if err := s.AddUsage(rows); err != nil {
+		restore(counts)
+		return 0, fmt.Errorf("failed to flush usage: %w", err)
+	}
+	return len(rows), nil
+}
+
+// Возвращает незаписанные счётчики в накопленные.
+func restore(counts map[storage.UsageRow]int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	for key, count := range counts {
+		pending[key] += count
+	}
+}
+
+// Начало суток (UTC), к которым относится момент времени.
+func day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
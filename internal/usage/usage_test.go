@@ -0,0 +1,181 @@
+package usage_test
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/memory"
+	"auth_service/internal/usage"
+	"auth_service/pkg/authpb"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Хранилище статистики, запись в которое не удаётся.
+type failingStore struct {
+	storage.UsageStats
+}
+
+func (failingStore) AddUsage(rows []storage.UsageRow) error {
+	return storage.ErrUnavailable
+}
+
+// Устанавливает хранилище на время теста.
+func setStore(t *testing.T, s storage.UsageStats) {
+	t.Helper()
+	usage.SetStore(s)
+	t.Cleanup(func() {
+		_, _ = usage.Flush(context.Background())
+		usage.SetStore(nil)
+	})
+}
+
+// Возвращает записанные за сегодня количества по ключу api/operation/result.
+func counts(t *testing.T, s storage.UsageStats) map[string]int64 {
+	t.Helper()
+	today := time.Now().UTC()
+	rows, err := s.ListUsage(today, today)
+	require.NoError(t, err)
+	result := make(map[string]int64)
+	for _, row := range rows {
+		result[row.API+"/"+row.Operation+"/"+row.Result] += row.Count
+	}
+	return result
+}
+
+// Проверка записи накопленных счётчиков и их сохранения при ошибке хранилища.
+func TestFlush(t *testing.T) {
+	ms := memory.NewMemoryStorage()
+	setStore(t, failingStore{})
+
+	usage.Record(usage.APIHTTP, usage.OperationIssue, usage.ResultSuccess)
+	usage.Record(usage.APIHTTP, usage.OperationIssue, usage.ResultSuccess)
+	usage.Record(usage.APIGRPC, usage.OperationRefresh, usage.ResultRejected)
+
+	_, err := usage.Flush(context.Background())
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+
+	// Счётчики, которые не удалось записать, записываются при следующем вызове.
+	usage.SetStore(ms)
+	written, err := usage.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, written)
+	assert.Equal(t, map[string]int64{
+		"http/issue/success":    2,
+		"grpc/refresh/rejected": 1,
+	}, counts(t, ms))
+
+	written, err = usage.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, written)
+
+	var out bytes.Buffer
+	metrics.WriteTo(&out)
+	assert.Contains(t, out.String(), `auth_usage_requests_total{api="http",operation="issue",result="success"}`)
+}
+
+// Проверка учёта запросов HTTP API по коду ответа.
+func TestMiddleware(t *testing.T) {
+	ms := memory.NewMemoryStorage()
+	setStore(t, ms)
+
+	for _, code := range []int{http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable} {
+		handler := usage.Middleware(usage.OperationRefresh, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/auth/refresh", nil))
+	}
+	// Ответ без явного WriteHeader — 200.
+	usage.Middleware(usage.OperationIssue, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/auth/tokens", nil))
+
+	_, err := usage.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"http/refresh/success":  1,
+		"http/refresh/rejected": 2,
+		"http/refresh/error":    1,
+		"http/issue/success":    1,
+	}, counts(t, ms))
+}
+
+// Проверка учёта вызовов gRPC API по коду статуса.
+func TestUnaryServerInterceptor(t *testing.T) {
+	ms := memory.NewMemoryStorage()
+	setStore(t, ms)
+
+	interceptor := usage.UnaryServerInterceptor()
+	call := func(fullMethod string, err error) {
+		info := &grpc.UnaryServerInfo{FullMethod: fullMethod}
+		_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+			return nil, err
+		})
+	}
+	service := "/" + authpb.AuthService_ServiceDesc.ServiceName + "/"
+	call(service+"IssueTokens", nil)
+	call(service+"ValidateToken", status.Error(codes.Unauthenticated, "invalid access token"))
+	call(service+"RevokeSession", status.Error(codes.Unavailable, "storage unavailable"))
+	call(service+"RefreshTokens", errors.New("unexpected"))
+	// Проверки состояния не учитываются.
+	call("/grpc.health.v1.Health/Check", nil)
+
+	_, err := usage.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"grpc/issue/success":     1,
+		"grpc/validate/rejected": 1,
+		"grpc/revoke/error":      1,
+		"grpc/refresh/error":     1,
+	}, counts(t, ms))
+}
+
+// Проверка выдачи статистики через GET /admin/usage.
+func TestHandler(t *testing.T) {
+	serve := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		usage.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	rr := serve("/admin/usage")
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Equal(t, "usage_stats_not_supported", rr.Header().Get("X-Error-Code"))
+
+	ms := memory.NewMemoryStorage()
+	setStore(t, ms)
+	require.NoError(t, ms.AddUsage([]storage.UsageRow{
+		{Day: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), API: usage.APIHTTP, Operation: usage.OperationIssue, Result: usage.ResultSuccess, Count: 7},
+		{Day: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), API: usage.APIGRPC, Operation: usage.OperationValidate, Result: usage.ResultSuccess, Count: 3},
+	}))
+
+	rr = serve("/admin/usage?from=2024-03-01&to=2024-03-02")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var rows []usage.Row
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rows))
+	assert.Equal(t, []usage.Row{
+		{Day: "2024-03-01", API: "http", Operation: "issue", Result: "success", Count: 7},
+	}, rows)
+
+	for _, target := range []string{"/admin/usage?from=yesterday", "/admin/usage?from=2024-03-05&to=2024-03-01"} {
+		rr = serve(target)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+		assert.Equal(t, "invalid_period", rr.Header().Get("X-Error-Code"))
+	}
+
+	rr = httptest.NewRecorder()
+	usage.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/usage", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
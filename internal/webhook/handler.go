@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"auth_service/internal/i18n"
+	"auth_service/internal/storage"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Количество недоставленных в ответе по умолчанию и наибольшее.
+const (
+	defaultDeadLetterLimit = 100
+	maxDeadLetterLimit     = 1000
+)
+
+// Доставка в ответах служебных маршрутов /admin/webhooks.
+type Delivery struct {
+	ID        string `json:"id"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	Endpoint  string `json:"endpoint"`
+	// pending, delivered или dead.
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// Время следующей попытки; null, если доставка не ожидает отправки.
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Время последнего изменения; для недоставленных — время переноса.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Создаёт обработчик GET /admin/webhooks/deliveries/{id}.
+//
+// Возвращает состояние доставки, в том числе недоставленной.
+//
+// Возвращает:
+// - http.Handler.
+func DeliveryHandler() http.Handler {
+	return queueHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request, q storage.WebhookQueue) {
+		writeDelivery(w, r, q, http.StatusOK)
+	})
+}
+
+// Создаёт обработчик POST /admin/webhooks/deliveries/{id}/redeliver.
+//
+// Возвращает доставку (выполненную или недоставленную) в очередь со
+// сброшенным счётчиком попыток; отправку выполняет ближайший запуск
+// задачи webhook_delivery.
+//
+// Возвращает:
+// - http.Handler.
+func RedeliverHandler() http.Handler {
+	return queueHandler(http.MethodPost, func(w http.ResponseWriter, r *http.Request, q storage.WebhookQueue) {
+		if err := q.RedeliverWebhook(r.PathValue("id"), time.Now()); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeDelivery(w, r, q, http.StatusAccepted)
+	})
+}
+
+// Создаёт обработчик GET /admin/webhooks/dead-letters?limit=N.
+//
+// Возвращает недоставленные после всех попыток доставки, начиная с
+// последних (по умолчанию 100, не больше 1000).
+//
+// Возвращает:
+// - http.Handler.
+func DeadLettersHandler() http.Handler {
+	return queueHandler(http.MethodGet, func(w http.ResponseWriter, r *http.Request, q storage.WebhookQueue) {
+		limit := defaultDeadLetterLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > maxDeadLetterLimit {
+				i18n.Error(w, r, "invalid_limit", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		dead, err := q.ListDeadWebhooks(limit)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		list := make([]Delivery, 0, len(dead))
+		for _, d := range dead {
+			list = append(list, toDelivery(d))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	})
+}
+
+// Проверяет метод запроса и наличие очереди перед вызовом handle.
+func queueHandler(method string, handle func(w http.ResponseWriter, r *http.Request, q storage.WebhookQueue)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		q := currentQueue()
+		if q == nil {
+			i18n.Error(w, r, "webhook_queue_not_supported", http.StatusNotImplemented)
+			return
+		}
+		handle(w, r, q)
+	})
+}
+
+// Отправляет состояние доставки из пути запроса.
+func writeDelivery(w http.ResponseWriter, r *http.Request, q storage.WebhookQueue, status int) {
+	d, err := q.GetWebhook(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(toDelivery(d))
+}
+
+// Отправляет ответ с ошибкой очереди.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		i18n.Error(w, r, "webhook_delivery_not_found", http.StatusNotFound)
+		return
+	}
+	i18n.Error(w, r, "service_unavailable", http.StatusServiceUnavailable)
+}
+
+// Преобразует доставку из хранилища в ответ.
+func toDelivery(d storage.WebhookDelivery) Delivery {
+	delivery := Delivery{
+		ID:        d.ID,
+		EventID:   d.EventID,
+		EventType: d.EventType,
+		Endpoint:  d.Endpoint,
+		Status:    d.Status,
+		Attempts:  d.Attempts,
+		LastError: d.LastError,
+		CreatedAt: d.CreatedAt.UTC(),
+		UpdatedAt: d.UpdatedAt.UTC(),
+	}
+	if d.Status == storage.WebhookPending {
+		next := d.NextAttemptAt.UTC()
+		delivery.NextAttemptAt = &next
+	}
+	return delivery
+}
@@ -0,0 +1,181 @@
+package webhook
+
+import (
+	"auth_service/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Политика повторных попыток по умолчанию: восемь попыток в течение
+// примерно часа.
+var DefaultRetry = Retry{MaxAttempts: 8, InitialBackoff: 30 * time.Second, MaxBackoff: time.Hour}
+
+// Политика повторных попыток доставки.
+type Retry struct {
+	// Наибольшее число попыток; после последней неудачной доставка
+	// переносится в недоставленные.
+	MaxAttempts int
+	// Пауза после первой неудачной попытки; каждая следующая вдвое больше.
+	InitialBackoff time.Duration
+	// Наибольшая пауза между попытками.
+	MaxBackoff time.Duration
+}
+
+// Проверяет политику повторных попыток.
+//
+// Принимает:
+// - timeout: время ожидания ответа получателя.
+//
+// Возвращает:
+// - ошибку, если значения некорректны.
+func (r Retry) Validate(timeout time.Duration) error {
+	if r.MaxAttempts < 1 {
+		return errors.New("webhook max_attempts must be positive")
+	}
+	// Иначе задача повторных попыток может начать доставку, первая попытка
+	// которой ещё не завершилась.
+	if r.InitialBackoff < timeout {
+		return fmt.Errorf("webhook initial_backoff must not be less than timeout %s", timeout)
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		return errors.New("webhook max_backoff must not be less than initial_backoff")
+	}
+	return nil
+}
+
+// Возвращает паузу перед следующей попыткой.
+//
+// Принимает:
+// - attempts: количество выполненных неудачных попыток (не меньше 1).
+//
+// Возвращает:
+// - InitialBackoff·2^(attempts-1), но не больше MaxBackoff.
+func (r Retry) Backoff(attempts int) time.Duration {
+	backoff := r.InitialBackoff
+	for i := 1; i < attempts && backoff < r.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, r.MaxBackoff)
+}
+
+// Выполняет повторные попытки доставок, время которых наступило.
+//
+// Доставки получателей, удалённых из конфигурации, сразу переносятся в
+// недоставленные. Вызывается периодически на одной реплике.
+//
+// Принимает:
+// - ctx: контекст; при отмене обработка прерывается.
+// - limit: наибольшее количество доставок за один вызов.
+//
+// Возвращает:
+// - количество обработанных доставок.
+// - ошибку, если очередь не задана или недоступна.
+func (s *Sink) ProcessDue(ctx context.Context, limit int) (int, error) {
+	q := currentQueue()
+	if q == nil {
+		return 0, errors.New("webhook queue is not configured")
+	}
+	due, err := q.DueWebhooks(s.clock.Now(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select due webhooks: %w", err)
+	}
+
+	processed := 0
+	for _, delivery := range due {
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+		endpoint, ok := s.endpoint(delivery.Endpoint)
+		if !ok {
+			s.fail(q, delivery, delivery.Attempts, "endpoint is not configured", true)
+		} else {
+			s.attempt(q, endpoint, delivery)
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// Удаляет выполненные доставки, обновлённые раньше before.
+//
+// Принимает:
+// - before: граница времени выполнения.
+// - limit: наибольшее количество удаляемых доставок за один вызов.
+//
+// Возвращает:
+// - количество удалённых доставок.
+// - ошибку, если удаление не удалось.
+func PurgeDelivered(before time.Time, limit int) (int64, error) {
+	q := currentQueue()
+	if q == nil {
+		return 0, nil
+	}
+	return q.DeleteDeliveredWebhooks(before, limit)
+}
+
+// Выполняет одну попытку доставки и сохраняет её результат в очереди q
+// (nil — без очереди).
+func (s *Sink) attempt(q storage.WebhookQueue, endpoint Endpoint, delivery storage.WebhookDelivery) {
+	attempts := delivery.Attempts + 1
+	if err := s.deliver(endpoint, delivery); err != nil {
+		deliveries.Inc(endpoint.Name, "failure")
+		s.fail(q, delivery, attempts, err.Error(), q == nil || attempts >= s.retry.MaxAttempts)
+		return
+	}
+
+	deliveries.Inc(endpoint.Name, "success")
+	if q != nil {
+		if err := q.MarkWebhookDelivered(delivery.ID, attempts); err != nil {
+			s.log.Error("Failed to mark webhook delivered",
+				slog.String("id", delivery.ID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// Логирует неудачную попытку и назначает повторную либо переносит доставку
+// в недоставленные (final).
+func (s *Sink) fail(q storage.WebhookQueue, delivery storage.WebhookDelivery, attempts int, reason string, final bool) {
+	attrs := []any{
+		slog.String("endpoint", delivery.Endpoint),
+		slog.String("delivery_id", delivery.EventID),
+		slog.String("type", delivery.EventType),
+		slog.Int("attempts", attempts),
+		slog.String("error", reason),
+	}
+	if q == nil {
+		s.log.Error("Failed to deliver webhook", attrs...)
+		return
+	}
+
+	var err error
+	if final {
+		s.log.Error("Failed to deliver webhook, moved to dead letters", attrs...)
+		deadLetters.Inc(delivery.Endpoint)
+		err = q.DeadLetterWebhook(delivery.ID, attempts, reason)
+	} else {
+		next := s.clock.Now().Add(s.retry.Backoff(attempts))
+		s.log.Warn("Failed to deliver webhook, retry scheduled", append(attrs, slog.Time("next_attempt_at", next))...)
+		err = q.RetryWebhook(delivery.ID, attempts, next, reason)
+	}
+	if err != nil {
+		s.log.Error("Failed to update webhook delivery",
+			slog.String("id", delivery.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// Возвращает получателя по имени.
+func (s *Sink) endpoint(name string) (Endpoint, bool) {
+	for _, endpoint := range s.endpoints {
+		if endpoint.Name == name {
+			return endpoint, true
+		}
+	}
+	return Endpoint{}, false
+}
@@ -0,0 +1,280 @@
+// Пакет webhook доставляет события безопасности во внешние системы HTTP-запросами.
+//
+// Каждый запрос подписывается секретом получателя (заголовок
+// X-Auth-Signature, см. authtoken.SignWebhook), чтобы получатель мог
+// убедиться, что событие отправлено сервисом и не воспроизведено повторно.
+//
+// Если задана очередь (SetQueue), доставки сохраняются в хранилище:
+// неудачные повторяются с экспоненциальной паузой (ProcessDue), а после
+// последней попытки переносятся в недоставленные, откуда их можно вернуть
+// в очередь через служебные маршруты /admin/webhooks.
+package webhook
+
+import (
+	"auth_service/internal/metrics"
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"auth_service/lib/clock"
+	"auth_service/pkg/authtoken"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Заголовки запроса, кроме подписи.
+const (
+	// Тип события.
+	EventHeader = "X-Auth-Event"
+	// Идентификатор доставки; одинаков для всех получателей события и
+	// повторных попыток, поэтому получатель может по нему отбрасывать дубли.
+	DeliveryHeader = "X-Auth-Delivery"
+)
+
+var deliveries = metrics.NewCounterVec(
+	"auth_webhook_deliveries_total",
+	"Number of webhook delivery attempts, by endpoint and result.",
+	"endpoint", "result",
+)
+
+var deadLetters = metrics.NewCounterVec(
+	"auth_webhook_dead_letters_total",
+	"Number of webhook deliveries moved to dead letters after the last attempt, by endpoint.",
+	"endpoint",
+)
+
+var (
+	mu    sync.Mutex
+	queue storage.WebhookQueue
+)
+
+// Устанавливает хранилище очереди доставки.
+//
+// Без очереди каждое событие отправляется один раз, а ошибки доставки
+// только логируются.
+//
+// Принимает:
+// - q: очередь доставки (nil — без очереди).
+func SetQueue(q storage.WebhookQueue) {
+	mu.Lock()
+	defer mu.Unlock()
+	queue = q
+}
+
+// Возвращает установленную очередь доставки.
+func currentQueue() storage.WebhookQueue {
+	mu.Lock()
+	defer mu.Unlock()
+	return queue
+}
+
+// Получатель событий.
+type Endpoint struct {
+	// Имя получателя для логов и метрик.
+	Name string
+	URL  string
+	// Секреты подписи. Во время ротации указываются новый и прежний секреты:
+	// запрос подписывается каждым, и получатель может перейти на новый
+	// секрет в любой момент, после чего прежний удаляется.
+	Secrets []string
+	// Типы событий, которые доставляются получателю; пусто — все.
+	Events []string
+}
+
+// Проверяет настройки получателя.
+func (e Endpoint) Validate() error {
+	if e.Name == "" {
+		return errors.New("webhook name is required")
+	}
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook %s: invalid url %q", e.Name, e.URL)
+	}
+	if len(e.Secrets) == 0 {
+		return fmt.Errorf("webhook %s: at least one secret is required", e.Name)
+	}
+	for _, secret := range e.Secrets {
+		if secret == "" {
+			return fmt.Errorf("webhook %s: empty secret", e.Name)
+		}
+	}
+	for _, eventType := range e.Events {
+		if !security.IsKnownEvent(eventType) {
+			return fmt.Errorf("webhook %s: unknown security event type %q", e.Name, eventType)
+		}
+	}
+	return nil
+}
+
+// Доставляется ли получателю событие этого типа.
+func (e Endpoint) subscribed(eventType string) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, eventType)
+}
+
+// Тело запроса.
+type Payload struct {
+	// Идентификатор события; совпадает с заголовком X-Auth-Delivery.
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Severity  string            `json:"severity"`
+	Time      time.Time         `json:"time"`
+	UserID    string            `json:"user_id"`
+	SessionID string            `json:"session_id,omitempty"`
+	ClientIP  string            `json:"client_ip,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Обработчик событий безопасности, отправляющий их получателям.
+type Sink struct {
+	log       *slog.Logger
+	endpoints []Endpoint
+	client    *http.Client
+	retry     Retry
+	clock     clock.Clock
+	wg        sync.WaitGroup
+}
+
+// Создаёт обработчик.
+//
+// Принимает:
+// - log: указатель на logger для ошибок доставки.
+// - endpoints: получатели.
+// - timeout: время ожидания ответа получателя.
+//
+// Возвращает:
+// - указатель на Sink.
+// - ошибку, если настройки получателя некорректны.
+func New(log *slog.Logger, endpoints []Endpoint, timeout time.Duration) (*Sink, error) {
+	for _, endpoint := range endpoints {
+		if err := endpoint.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Sink{
+		log:       log,
+		endpoints: endpoints,
+		client:    &http.Client{Timeout: timeout},
+		retry:     DefaultRetry,
+		clock:     clock.Real{},
+	}, nil
+}
+
+// Устанавливает политику повторных попыток (по умолчанию DefaultRetry).
+func (s *Sink) WithRetry(r Retry) *Sink {
+	s.retry = r
+	return s
+}
+
+// Устанавливает источник времени (для тестов).
+func (s *Sink) WithClock(c clock.Clock) *Sink {
+	s.clock = c
+	return s
+}
+
+// Возвращает имя обработчика.
+func (s *Sink) Name() string {
+	return "webhook"
+}
+
+// Отправляет событие подписанным на него получателям.
+//
+// Запросы выполняются в фоне, чтобы медленный получатель не задерживал
+// запрос, в котором обнаружено событие; ошибки доставки логируются и
+// учитываются метрикой auth_webhook_deliveries_total. Если задана очередь,
+// доставка сначала сохраняется в ней, а после неудачной попытки назначается
+// повторная.
+//
+// Принимает:
+// - ctx: контекст запроса (не используется доставкой, которая его переживает).
+// - event: событие.
+//
+// Возвращает:
+// - ошибку, если событие не удалось закодировать.
+func (s *Sink) Handle(ctx context.Context, event security.Event) error {
+	payload := Payload{
+		ID:        cmp.Or(event.ID, uuid.NewString()),
+		Type:      event.Type,
+		Severity:  string(event.Severity),
+		Time:      event.Time.UTC(),
+		UserID:    event.UserID,
+		SessionID: event.SessionID,
+		ClientIP:  event.ClientIP,
+		Details:   event.Details,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	q := currentQueue()
+	for _, endpoint := range s.endpoints {
+		if !endpoint.subscribed(event.Type) {
+			continue
+		}
+		delivery := storage.WebhookDelivery{
+			ID:        uuid.NewString(),
+			EventID:   payload.ID,
+			EventType: payload.Type,
+			Endpoint:  endpoint.Name,
+			Payload:   body,
+			// Повторная попытка не начнётся раньше, чем завершится первая:
+			// InitialBackoff не меньше времени ожидания ответа.
+			NextAttemptAt: s.clock.Now().Add(s.retry.InitialBackoff),
+		}
+		tracked := q
+		if tracked != nil {
+			if err := tracked.EnqueueWebhook(delivery); err != nil {
+				s.log.Error("Failed to enqueue webhook, delivering without retries",
+					slog.String("endpoint", endpoint.Name),
+					slog.String("delivery_id", payload.ID),
+					slog.String("error", err.Error()),
+				)
+				tracked = nil
+			}
+		}
+
+		s.wg.Add(1)
+		go func(endpoint Endpoint) {
+			defer s.wg.Done()
+			s.attempt(tracked, endpoint, delivery)
+		}(endpoint)
+	}
+	return nil
+}
+
+// Ожидает завершения начатых доставок.
+func (s *Sink) Wait() {
+	s.wg.Wait()
+}
+
+// Отправляет подписанный запрос получателю.
+func (s *Sink) deliver(endpoint Endpoint, delivery storage.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.EventID)
+	req.Header.Set(authtoken.WebhookSignatureHeader, authtoken.SignWebhook(delivery.Payload, time.Now(), endpoint.Secrets...))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package webhook_test
+
+import (
+	"auth_service/internal/security"
+	"auth_service/internal/storage"
+	"auth_service/internal/storage/memory"
+	"auth_service/internal/webhook"
+	"auth_service/lib/clock"
+	"auth_service/pkg/authtoken"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Полученный получателем запрос.
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// Запускает получателя, сохраняющего запросы и отвечающего status.
+func newReceiver(t *testing.T, status int) (*httptest.Server, func() []received) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, received{header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+// Проверка доставки подписанного события подписанным получателям.
+func TestSink_Handle(t *testing.T) {
+	all, allRequests := newReceiver(t, http.StatusNoContent)
+	reuse, reuseRequests := newReceiver(t, http.StatusOK)
+
+	sink, err := webhook.New(slog.New(slog.NewTextHandler(io.Discard, nil)), []webhook.Endpoint{
+		{Name: "all", URL: all.URL, Secrets: []string{"new", "old"}},
+		{Name: "reuse", URL: reuse.URL, Secrets: []string{"reuse-secret"}, Events: []string{security.EventRefreshTokenReuse}},
+	}, time.Second)
+	require.NoError(t, err)
+
+	p := security.NewPipeline(slog.New(slog.NewTextHandler(io.Discard, nil)), sink)
+	p.Emit(context.Background(), security.Event{
+		Type:     security.EventIPChange,
+		UserID:   "user",
+		ClientIP: "203.0.113.7",
+		Details:  map[string]string{"previous_ip": "192.168.1.1"},
+	})
+	sink.Wait()
+
+	require.Len(t, allRequests(), 1)
+	assert.Empty(t, reuseRequests(), "endpoint is not subscribed to ip_change")
+
+	req := allRequests()[0]
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, security.EventIPChange, req.header.Get(webhook.EventHeader))
+	// Получатель, ещё не перешедший на новый секрет, принимает запрос.
+	signature := req.header.Get(authtoken.WebhookSignatureHeader)
+	assert.NoError(t, authtoken.VerifyWebhook(req.body, signature, time.Minute, "old"))
+	assert.NoError(t, authtoken.VerifyWebhook(req.body, signature, time.Minute, "new"))
+
+	var payload webhook.Payload
+	require.NoError(t, json.Unmarshal(req.body, &payload))
+	assert.Equal(t, req.header.Get(webhook.DeliveryHeader), payload.ID)
+	assert.Equal(t, security.EventIPChange, payload.Type)
+	assert.Equal(t, "low", payload.Severity)
+	assert.Equal(t, "user", payload.UserID)
+	assert.Equal(t, "192.168.1.1", payload.Details["previous_ip"])
+
+	p.Emit(context.Background(), security.Event{Type: security.EventRefreshTokenReuse, UserID: "user"})
+	sink.Wait()
+	assert.Len(t, allRequests(), 2)
+	require.Len(t, reuseRequests(), 1)
+	assert.NoError(t, authtoken.VerifyWebhook(reuseRequests()[0].body,
+		reuseRequests()[0].header.Get(authtoken.WebhookSignatureHeader), time.Minute, "reuse-secret"))
+}
+
+// Проверка логирования ошибки доставки.
+func TestSink_DeliveryFailure(t *testing.T) {
+	receiver, _ := newReceiver(t, http.StatusInternalServerError)
+	var logs syncBuffer
+	sink, err := webhook.New(slog.New(slog.NewTextHandler(&logs, nil)), []webhook.Endpoint{
+		{Name: "failing", URL: receiver.URL, Secrets: []string{"secret"}},
+	}, time.Second)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Handle(context.Background(), security.Event{Type: security.EventGeoBlocked}))
+	sink.Wait()
+	assert.Contains(t, logs.String(), `msg="Failed to deliver webhook" endpoint=failing`)
+	assert.Contains(t, logs.String(), "unexpected status 500")
+}
+
+// Очередь в памяти, запоминающая идентификаторы новых доставок.
+type recordingQueue struct {
+	*memory.MemoryStorage
+	mu  sync.Mutex
+	ids []string
+}
+
+func (q *recordingQueue) EnqueueWebhook(delivery storage.WebhookDelivery) error {
+	q.mu.Lock()
+	q.ids = append(q.ids, delivery.ID)
+	q.mu.Unlock()
+	return q.MemoryStorage.EnqueueWebhook(delivery)
+}
+
+func (q *recordingQueue) last(t *testing.T) storage.WebhookDelivery {
+	t.Helper()
+	q.mu.Lock()
+	require.NotEmpty(t, q.ids)
+	id := q.ids[len(q.ids)-1]
+	q.mu.Unlock()
+	d, err := q.GetWebhook(id)
+	require.NoError(t, err)
+	return d
+}
+
+// Устанавливает очередь на время теста.
+func newQueue(t *testing.T, clk clock.Clock) *recordingQueue {
+	t.Helper()
+	q := &recordingQueue{MemoryStorage: memory.NewMemoryStorage().WithClock(clk)}
+	webhook.SetQueue(q)
+	t.Cleanup(func() { webhook.SetQueue(nil) })
+	return q
+}
+
+// Проверка сохранения успешной доставки в очереди.
+func TestSink_QueuedDelivery(t *testing.T) {
+	receiver, requests := newReceiver(t, http.StatusOK)
+	clk := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	q := newQueue(t, clk)
+
+	sink, err := webhook.New(slog.New(slog.NewTextHandler(io.Discard, nil)), []webhook.Endpoint{
+		{Name: "siem", URL: receiver.URL, Secrets: []string{"secret"}},
+	}, time.Second)
+	require.NoError(t, err)
+	sink.WithClock(clk)
+
+	require.NoError(t, sink.Handle(context.Background(), security.Event{Type: security.EventGeoBlocked, UserID: "user"}))
+	sink.Wait()
+
+	require.Len(t, requests(), 1)
+	d := q.last(t)
+	assert.Equal(t, storage.WebhookDelivered, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, "siem", d.Endpoint)
+	assert.Equal(t, requests()[0].header.Get(webhook.DeliveryHeader), d.EventID)
+	assert.Equal(t, string(requests()[0].body), string(d.Payload))
+}
+
+// Проверка повторных попыток, переноса в недоставленные и ручной повторной доставки.
+func TestSink_RetryAndDeadLetter(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	var delivered []string
+	var mu sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		delivered = append(delivered, r.Header.Get(webhook.DeliveryHeader))
+		mu.Unlock()
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(receiver.Close)
+
+	clk := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	q := newQueue(t, clk)
+	sink, err := webhook.New(slog.New(slog.NewTextHandler(io.Discard, nil)), []webhook.Endpoint{
+		{Name: "siem", URL: receiver.URL, Secrets: []string{"secret"}},
+	}, time.Second)
+	require.NoError(t, err)
+	sink.WithClock(clk).WithRetry(webhook.Retry{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour})
+
+	require.NoError(t, sink.Handle(context.Background(), security.Event{Type: security.EventGeoBlocked, UserID: "user"}))
+	sink.Wait()
+
+	d := q.last(t)
+	assert.Equal(t, storage.WebhookPending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, "unexpected status 503", d.LastError)
+	assert.Equal(t, clk.Now().Add(time.Minute), d.NextAttemptAt)
+
+	// Время повторной попытки ещё не наступило.
+	processed, err := sink.ProcessDue(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Zero(t, processed)
+
+	clk.Advance(time.Minute)
+	processed, err = sink.ProcessDue(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, processed)
+	d = q.last(t)
+	assert.Equal(t, 2, d.Attempts)
+	assert.Equal(t, clk.Now().Add(2*time.Minute), d.NextAttemptAt, "backoff doubles")
+
+	clk.Advance(2 * time.Minute)
+	_, err = sink.ProcessDue(context.Background(), 10)
+	require.NoError(t, err)
+	d = q.last(t)
+	assert.Equal(t, storage.WebhookDead, d.Status)
+	assert.Equal(t, 3, d.Attempts)
+
+	dead, err := q.ListDeadWebhooks(10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+
+	// Получатель восстановлен: доставка возвращается в очередь вручную.
+	status.Store(http.StatusOK)
+	rr := httptest.NewRecorder()
+	webhook.RedeliverHandler().ServeHTTP(rr, redeliverRequest(d.ID))
+	require.Equal(t, http.StatusAccepted, rr.Code)
+
+	clk.Set(time.Now())
+	processed, err = sink.ProcessDue(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, processed)
+	d = q.last(t)
+	assert.Equal(t, storage.WebhookDelivered, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, delivered, 4)
+	for _, id := range delivered {
+		assert.Equal(t, d.EventID, id, "retries keep the delivery header")
+	}
+}
+
+// Проверка переноса в недоставленные доставки получателя, удалённого из конфигурации.
+func TestSink_ProcessDueUnknownEndpoint(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	q := newQueue(t, clk)
+	require.NoError(t, q.EnqueueWebhook(storage.WebhookDelivery{
+		ID: "d1", EventID: "e1", EventType: security.EventGeoBlocked, Endpoint: "removed", NextAttemptAt: clk.Now(),
+	}))
+
+	sink, err := webhook.New(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, time.Second)
+	require.NoError(t, err)
+	sink.WithClock(clk)
+	processed, err := sink.ProcessDue(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, processed)
+
+	d, err := q.GetWebhook("d1")
+	require.NoError(t, err)
+	assert.Equal(t, storage.WebhookDead, d.Status)
+	assert.Equal(t, "endpoint is not configured", d.LastError)
+}
+
+// Проверка политики повторных попыток.
+func TestRetry(t *testing.T) {
+	r := webhook.Retry{MaxAttempts: 5, InitialBackoff: 30 * time.Second, MaxBackoff: 3 * time.Minute}
+	require.NoError(t, r.Validate(5*time.Second))
+	assert.Equal(t, 30*time.Second, r.Backoff(1))
+	assert.Equal(t, time.Minute, r.Backoff(2))
+	assert.Equal(t, 2*time.Minute, r.Backoff(3))
+	assert.Equal(t, 3*time.Minute, r.Backoff(4))
+	assert.Equal(t, 3*time.Minute, r.Backoff(100))
+
+	assert.Error(t, webhook.Retry{MaxAttempts: 0, InitialBackoff: time.Minute, MaxBackoff: time.Hour}.Validate(time.Second))
+	assert.Error(t, r.Validate(time.Minute), "initial backoff shorter than timeout")
+	assert.Error(t, webhook.Retry{MaxAttempts: 1, InitialBackoff: time.Hour, MaxBackoff: time.Minute}.Validate(time.Second))
+	require.NoError(t, webhook.DefaultRetry.Validate(5*time.Second))
+}
+
+// Проверка служебных маршрутов /admin/webhooks.
+func TestHandlers(t *testing.T) {
+	rr := httptest.NewRecorder()
+	webhook.DeadLettersHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/webhooks/dead-letters", nil))
+	assert.Equal(t, http.StatusNotImplemented, rr.Code, "queue is not set")
+	assert.Equal(t, "webhook_queue_not_supported", rr.Header().Get("X-Error-Code"))
+
+	clk := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	q := newQueue(t, clk)
+	require.NoError(t, q.EnqueueWebhook(storage.WebhookDelivery{
+		ID: "d1", EventID: "e1", EventType: security.EventGeoBlocked, Endpoint: "siem", NextAttemptAt: clk.Now(),
+	}))
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/webhooks/deliveries/{id}", webhook.DeliveryHandler())
+	mux.Handle("/admin/webhooks/deliveries/{id}/redeliver", webhook.RedeliverHandler())
+	mux.Handle("/admin/webhooks/dead-letters", webhook.DeadLettersHandler())
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	rr = serve(http.MethodGet, "/admin/webhooks/deliveries/d1")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var d webhook.Delivery
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &d))
+	assert.Equal(t, "e1", d.EventID)
+	assert.Equal(t, storage.WebhookPending, d.Status)
+	require.NotNil(t, d.NextAttemptAt)
+	assert.True(t, clk.Now().Equal(*d.NextAttemptAt))
+
+	require.NoError(t, q.DeadLetterWebhook("d1", 8, "unexpected status 500"))
+	rr = serve(http.MethodGet, "/admin/webhooks/dead-letters?limit=5")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var dead []webhook.Delivery
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &dead))
+	require.Len(t, dead, 1)
+	assert.Equal(t, storage.WebhookDead, dead[0].Status)
+	assert.Nil(t, dead[0].NextAttemptAt)
+	assert.Equal(t, "unexpected status 500", dead[0].LastError)
+
+	rr = serve(http.MethodPost, "/admin/webhooks/deliveries/d1/redeliver")
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &d))
+	assert.Equal(t, storage.WebhookPending, d.Status)
+	assert.Zero(t, d.Attempts)
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/admin/webhooks/deliveries/missing").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/admin/webhooks/deliveries/missing/redeliver").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodGet, "/admin/webhooks/deliveries/d1/redeliver").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, "/admin/webhooks/deliveries/d1").Code)
+	for _, limit := range []string{"0", "1001", "x"} {
+		rr = serve(http.MethodGet, "/admin/webhooks/dead-letters?limit="+limit)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, limit)
+		assert.Equal(t, "invalid_limit", rr.Header().Get("X-Error-Code"))
+	}
+}
+
+// Запрос повторной доставки с идентификатором в пути.
+func redeliverRequest(id string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/admin/webhooks/deliveries/"+id+"/redeliver", nil)
+	req.SetPathValue("id", id)
+	return req
+}
+
+// Проверка настроек получателей.
+func TestEndpoint_Validate(t *testing.T) {
+	valid := webhook.Endpoint{Name: "siem", URL: "https://siem.example.com/hooks", Secrets: []string{"secret"}}
+	require.NoError(t, valid.Validate())
+
+	for name, mutate := range map[string]func(e *webhook.Endpoint){
+		"no name":       func(e *webhook.Endpoint) { e.Name = "" },
+		"relative url":  func(e *webhook.Endpoint) { e.URL = "/hooks" },
+		"ftp url":       func(e *webhook.Endpoint) { e.URL = "ftp://example.com" },
+		"no secrets":    func(e *webhook.Endpoint) { e.Secrets = nil },
+		"empty secret":  func(e *webhook.Endpoint) { e.Secrets = []string{"new", ""} },
+		"unknown event": func(e *webhook.Endpoint) { e.Events = []string{"login"} },
+	} {
+		e := valid
+		mutate(&e)
+		assert.Error(t, e.Validate(), name)
+		_, err := webhook.New(slog.New(slog.NewTextHandler(io.Discard, nil)), []webhook.Endpoint{e}, time.Second)
+		assert.Error(t, err, name)
+	}
+}
+
+// Буфер, безопасный для записи из нескольких горутин.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -0,0 +1,54 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Источник текущего времени.
+//
+// Позволяет подменять время в тестах и моделировать расхождение часов.
+type Clock interface {
+	Now() time.Time
+}
+
+// Системные часы.
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Управляемые часы для тестов.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Создаёт управляемые часы, показывающие время t.
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Сдвигает время на d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
+
+// Устанавливает время t.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = t
+}
@@ -0,0 +1,15 @@
+// Пакет authpb содержит контракт gRPC API сервиса авторизации: определения
+// .proto (каталог proto) и сгенерированный по ним Go-код.
+//
+// Пакет оформлен отдельным Go-модулем auth_service/pkg/authpb и зависит только
+// от grpc и protobuf, поэтому сервисы-потребители могут подключать его, не
+// получая зависимостей самого сервиса авторизации:
+//
+//	conn, err := grpc.NewClient("auth_service:9090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	client := authpb.NewAuthServiceClient(conn)
+//	pair, err := client.IssueTokens(ctx, &authpb.IssueTokensRequest{UserId: userID})
+//
+// Контракт версионируется пакетом protobuf (auth.v1): в пределах версии
+// допускаются только обратно совместимые изменения — новые поля и методы.
+// Номера и типы существующих полей не меняются, удалённые поля резервируются.
+package authpb
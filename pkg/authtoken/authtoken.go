@@ -0,0 +1,268 @@
+// Пакет authtoken проверяет access-токены сервиса авторизации на стороне
+// сервисов-потребителей (resource servers).
+//
+// Пакет оформлен отдельным Go-модулем auth_service/pkg/authtoken и не зависит
+// от хранилища сервиса авторизации: проверка выполняется только по подписи
+// и claims токена. Claims iss и aud сервис добавляет, только если заданы
+// access_token_signing.issuer и access_token_signing.audience.
+//
+//	verifier, err := authtoken.NewVerifier(
+//		authtoken.WithSecret(jwtSecret),            // или authtoken.WithKeys(keySet)
+//		authtoken.WithIssuer("auth_service"),
+//		authtoken.WithAudience("orders"),
+//		authtoken.WithRequiredScopes("orders:read"),
+//	)
+//	claims, err := verifier.Verify(ctx, token)
+package authtoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// Токен недействителен: неверная подпись, истёк срок, не совпал iss или aud.
+	ErrInvalidToken = errors.New("invalid token")
+	// В токене нет требуемого scope.
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// Данные проверенного access-токена.
+type Claims struct {
+	// Идентификатор пользователя (sub).
+	Subject string
+	// Издатель токена (iss).
+	Issuer string
+	// Получатели токена (aud).
+	Audience []string
+	// Разрешения токена (scope или scp).
+	Scopes []string
+	// IP-адрес клиента, для которого был выдан токен (ip).
+	ClientIP string
+	// Идентификатор токена (jti).
+	ID string
+	// Идентификатор сессии, в которой выдан токен (sid).
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// Все claims токена, включая нестандартные.
+	Raw map[string]any
+}
+
+// Проверяет, содержит ли токен указанный scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Источник открытых ключей для проверки подписи (например, JWKS).
+type KeyProvider interface {
+	// Возвращает ключ по идентификатору kid из заголовка токена.
+	Key(ctx context.Context, kid string) (any, error)
+}
+
+// Проверка access-токенов.
+type Verifier struct {
+	secret         []byte
+	keys           KeyProvider
+	issuer         string
+	audience       string
+	requiredScopes []string
+	leeway         time.Duration
+	revocations    *RevocationList
+	now            func() time.Time
+}
+
+// Параметр Verifier.
+type Option func(*Verifier)
+
+// Проверять подпись общим секретом (HS256/HS384/HS512).
+func WithSecret(secret string) Option {
+	return func(v *Verifier) { v.secret = []byte(secret) }
+}
+
+// Проверять подпись открытыми ключами (RS*, PS*, ES*, EdDSA).
+func WithKeys(keys KeyProvider) Option {
+	return func(v *Verifier) { v.keys = keys }
+}
+
+// Требовать указанный издатель (iss).
+func WithIssuer(issuer string) Option {
+	return func(v *Verifier) { v.issuer = issuer }
+}
+
+// Требовать, чтобы токен был выдан для указанного получателя (aud).
+func WithAudience(audience string) Option {
+	return func(v *Verifier) { v.audience = audience }
+}
+
+// Требовать наличие всех указанных scope.
+func WithRequiredScopes(scopes ...string) Option {
+	return func(v *Verifier) { v.requiredScopes = append(v.requiredScopes, scopes...) }
+}
+
+// Допустимое расхождение часов при проверке exp, nbf и iat.
+func WithLeeway(leeway time.Duration) Option {
+	return func(v *Verifier) { v.leeway = leeway }
+}
+
+// Отклонять токены, отозванные по уведомлениям сервиса авторизации, с ошибкой
+// ErrTokenRevoked (см. RevocationList).
+func WithRevocationList(list *RevocationList) Option {
+	return func(v *Verifier) { v.revocations = list }
+}
+
+// Источник текущего времени (для тестов).
+func WithTimeFunc(now func() time.Time) Option {
+	return func(v *Verifier) { v.now = now }
+}
+
+// Создаёт Verifier.
+//
+// Принимает:
+// - opts: параметры проверки; должен быть задан WithSecret или WithKeys.
+//
+// Возвращает:
+// - указатель на Verifier.
+// - ошибку, если не задан способ проверки подписи.
+func NewVerifier(opts ...Option) (*Verifier, error) {
+	v := &Verifier{now: time.Now}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	if len(v.secret) == 0 && v.keys == nil {
+		return nil, errors.New("either WithSecret or WithKeys must be set")
+	}
+	if len(v.secret) > 0 && v.keys != nil {
+		return nil, errors.New("WithSecret and WithKeys are mutually exclusive")
+	}
+	return v, nil
+}
+
+// Проверяет токен и возвращает его данные.
+//
+// Принимает:
+// - ctx: контекст (используется при получении ключей).
+// - token: access-токен.
+//
+// Возвращает:
+// - данные токена.
+// - ошибку, обёртывающую ErrInvalidToken (вместе с ErrTokenRevoked для
+// отозванных токенов) или ErrInsufficientScope.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.validMethods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.leeway),
+		jwt.WithTimeFunc(v.now),
+	}
+	if v.issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(v.audience))
+	}
+
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		return v.key(ctx, t)
+	}, parserOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	mapClaims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid claims format", ErrInvalidToken)
+	}
+
+	claims, err := newClaims(mapClaims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	if v.revocations != nil && v.revocations.Revoked(claims) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, ErrTokenRevoked)
+	}
+
+	for _, scope := range v.requiredScopes {
+		if !claims.HasScope(scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInsufficientScope, scope)
+		}
+	}
+	return claims, nil
+}
+
+func (v *Verifier) validMethods() []string {
+	if v.keys != nil {
+		return []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+	}
+	return []string{"HS256", "HS384", "HS512"}
+}
+
+func (v *Verifier) key(ctx context.Context, t *jwt.Token) (any, error) {
+	if v.keys == nil {
+		return v.secret, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	return v.keys.Key(ctx, kid)
+}
+
+func newClaims(m jwt.MapClaims) (*Claims, error) {
+	subject, err := m.GetSubject()
+	if err != nil || subject == "" {
+		return nil, errors.New("sub is missing or invalid")
+	}
+	issuer, _ := m.GetIssuer()
+	audience, _ := m.GetAudience()
+	clientIP, _ := m["ip"].(string)
+	id, _ := m["jti"].(string)
+	sessionID, _ := m["sid"].(string)
+
+	claims := &Claims{
+		Subject:   subject,
+		Issuer:    issuer,
+		Audience:  audience,
+		Scopes:    scopes(m),
+		ClientIP:  clientIP,
+		ID:        id,
+		SessionID: sessionID,
+		Raw:       m,
+	}
+	if exp, _ := m.GetExpirationTime(); exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	if iat, _ := m.GetIssuedAt(); iat != nil {
+		claims.IssuedAt = iat.Time
+	}
+	return claims, nil
+}
+
+// Извлекает scope из claim scope (строка через пробел) или scp (массив строк).
+func scopes(m jwt.MapClaims) []string {
+	if scope, ok := m["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+
+	raw, ok := m["scp"].([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(raw))
+	for _, s := range raw {
+		if str, ok := s.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package authtoken_test
+
+import (
+	"auth_service/pkg/authtoken"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "secret"
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub":   "user-1",
+		"iss":   "auth_service",
+		"aud":   "orders",
+		"ip":    "127.0.0.1",
+		"sid":   "session-1",
+		"scope": "orders:read orders:write",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+	}
+}
+
+func signHS(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return token
+}
+
+// Проверка токена, подписанного общим секретом.
+func TestVerifier_Secret(t *testing.T) {
+	verifier, err := authtoken.NewVerifier(
+		authtoken.WithSecret(secret),
+		authtoken.WithIssuer("auth_service"),
+		authtoken.WithAudience("orders"),
+		authtoken.WithRequiredScopes("orders:read"),
+	)
+	require.NoError(t, err)
+
+	claims, err := verifier.Verify(context.Background(), signHS(t, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "127.0.0.1", claims.ClientIP)
+	assert.Equal(t, "session-1", claims.SessionID)
+	assert.Equal(t, []string{"orders"}, claims.Audience)
+	assert.True(t, claims.HasScope("orders:write"))
+}
+
+// Проверка отклонения токенов с неверными claims.
+func TestVerifier_Rejects(t *testing.T) {
+	verifier, err := authtoken.NewVerifier(
+		authtoken.WithSecret(secret),
+		authtoken.WithIssuer("auth_service"),
+		authtoken.WithAudience("orders"),
+		authtoken.WithRequiredScopes("orders:read"),
+	)
+	require.NoError(t, err)
+
+	tests := map[string]func(jwt.MapClaims){
+		"expired":      func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no exp":       func(c jwt.MapClaims) { delete(c, "exp") },
+		"wrong issuer": func(c jwt.MapClaims) { c["iss"] = "someone-else" },
+		"wrong aud":    func(c jwt.MapClaims) { c["aud"] = "billing" },
+		"no sub":       func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := validClaims()
+			mutate(claims)
+			_, err := verifier.Verify(context.Background(), signHS(t, claims))
+			assert.ErrorIs(t, err, authtoken.ErrInvalidToken)
+		})
+	}
+
+	claims := validClaims()
+	claims["scope"] = "orders:write"
+	_, err = verifier.Verify(context.Background(), signHS(t, claims))
+	assert.ErrorIs(t, err, authtoken.ErrInsufficientScope)
+}
+
+// Проверка токена, подписанного RSA-ключом из JWKS.
+func TestVerifier_JWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	doc, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "key-1",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	require.NoError(t, err)
+
+	keys, err := authtoken.ParseJWKS(doc)
+	require.NoError(t, err)
+	verifier, err := authtoken.NewVerifier(authtoken.WithKeys(keys))
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	claims, err := verifier.Verify(context.Background(), signed)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+
+	// HMAC-токен не принимается верификатором с открытыми ключами.
+	_, err = verifier.Verify(context.Background(), signHS(t, validClaims()))
+	assert.ErrorIs(t, err, authtoken.ErrInvalidToken)
+
+	token.Header["kid"] = "unknown"
+	signed, err = token.SignedString(key)
+	require.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), signed)
+	assert.ErrorIs(t, err, authtoken.ErrInvalidToken)
+}
+
+// Проверка токена открытым ключом в PEM.
+func TestVerifier_PublicKeyPEM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	keys, err := authtoken.ParsePublicKeyPEM(data, "key-1")
+	require.NoError(t, err)
+	verifier, err := authtoken.NewVerifier(authtoken.WithKeys(keys))
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	claims, err := verifier.Verify(context.Background(), signed)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+
+	_, err = authtoken.ParsePublicKeyPEM([]byte("not a key"), "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,204 @@
+package authtoken
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Ключ не найден в наборе.
+var ErrKeyNotFound = errors.New("key not found")
+
+// Неизменяемый набор открытых ключей, полученный из JWKS (RFC 7517).
+type KeySet struct {
+	keys map[string]any
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Разбирает документ JWKS.
+//
+// Ключи с use, отличным от sig, и ключи неподдерживаемых типов пропускаются.
+//
+// Принимает:
+// - data: JSON вида {"keys": [...]}.
+//
+// Возвращает:
+// - набор ключей.
+// - ошибку, если документ или один из ключей некорректен.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	set := &KeySet{keys: make(map[string]any, len(doc.Keys))}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			set.keys[k.Kid] = key
+		}
+	}
+	return set, nil
+}
+
+// Создаёт набор из одного открытого ключа в PEM («PUBLIC KEY», PKIX).
+//
+// Подходит, если сервис авторизации подписывает токены закрытым ключом
+// (RS256, ES256, EdDSA), а открытый ключ передаётся потребителям вместе с
+// конфигурацией.
+//
+// Принимает:
+// - data: открытый ключ в PEM.
+// - kid: идентификатор ключа; пустая строка означает отпечаток ключа по
+// RFC 7638, который сервис авторизации использует как kid по умолчанию.
+//
+// Возвращает:
+// - набор ключей.
+// - ошибку, если ключ некорректен.
+func ParsePublicKeyPEM(data []byte, kid string) (*KeySet, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("public key is not a PEM encoded PUBLIC KEY block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	if kid == "" {
+		if kid, err = thumbprint(key); err != nil {
+			return nil, err
+		}
+	}
+	return &KeySet{keys: map[string]any{kid: key}}, nil
+}
+
+// Отпечаток открытого ключа по RFC 7638 (SHA-256, base64url).
+func thumbprint(key any) (string, error) {
+	encode := base64.RawURLEncoding.EncodeToString
+	var canonical string
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		canonical = `{"e":"` + encode(big.NewInt(int64(k.E)).Bytes()) + `","kty":"RSA","n":"` + encode(k.N.Bytes()) + `"}`
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		canonical = `{"crv":"` + k.Curve.Params().Name + `","kty":"EC","x":"` + encode(k.X.FillBytes(make([]byte, size))) +
+			`","y":"` + encode(k.Y.FillBytes(make([]byte, size))) + `"}`
+	case ed25519.PublicKey:
+		canonical = `{"crv":"Ed25519","kty":"OKP","x":"` + encode(k) + `"}`
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", key)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return encode(sum[:]), nil
+}
+
+// Возвращает ключ по kid. Если kid пуст и в наборе один ключ, возвращает его.
+//
+// Принимает:
+// - ctx: контекст (не используется).
+// - kid: идентификатор ключа.
+//
+// Возвращает:
+// - открытый ключ.
+// - ErrKeyNotFound, если ключа нет в наборе.
+func (s *KeySet) Key(ctx context.Context, kid string) (any, error) {
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+}
+
+// Возвращает количество ключей в наборе.
+func (s *KeySet) Len() int {
+	return len(s.keys)
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,192 @@
+package authtoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheTTL           = time.Hour
+	defaultMinRefetchInterval = 10 * time.Second
+	maxJWKSSize               = 1 << 20
+)
+
+// Источник ключей, загружающий JWKS по HTTP.
+//
+// Ключи кешируются на CacheTTL. Если в кеше нет ключа с нужным kid (например,
+// после ротации ключей сервисом авторизации), JWKS загружается повторно —
+// не чаще одного раза в MinRefetchInterval, чтобы токены со случайными kid
+// не приводили к лавине запросов. При ошибке загрузки продолжают
+// использоваться ранее полученные ключи.
+type JWKSClient struct {
+	url                string
+	httpClient         *http.Client
+	cacheTTL           time.Duration
+	minRefetchInterval time.Duration
+	now                func() time.Time
+
+	fetchMu   sync.Mutex
+	mu        sync.RWMutex
+	keys      *KeySet
+	fetchedAt time.Time
+}
+
+// Параметр JWKSClient.
+type JWKSOption func(*JWKSClient)
+
+// HTTP-клиент для загрузки JWKS (по умолчанию с таймаутом 10 секунд).
+func WithHTTPClient(client *http.Client) JWKSOption {
+	return func(c *JWKSClient) { c.httpClient = client }
+}
+
+// Время жизни кеша ключей (по умолчанию 1 час).
+func WithCacheTTL(ttl time.Duration) JWKSOption {
+	return func(c *JWKSClient) { c.cacheTTL = ttl }
+}
+
+// Минимальный интервал между загрузками из-за неизвестного kid (по умолчанию 10 секунд).
+func WithMinRefetchInterval(interval time.Duration) JWKSOption {
+	return func(c *JWKSClient) { c.minRefetchInterval = interval }
+}
+
+// Создаёт JWKSClient.
+//
+// Ключи загружаются при первом обращении; для загрузки заранее и фонового
+// обновления используйте Start.
+//
+// Принимает:
+// - url: адрес JWKS (например, https://auth.example.com/.well-known/jwks.json).
+// - opts: параметры клиента.
+//
+// Возвращает:
+// - указатель на JWKSClient.
+func NewJWKSClient(url string, opts ...JWKSOption) *JWKSClient {
+	c := &JWKSClient{
+		url:                url,
+		httpClient:         &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:           defaultCacheTTL,
+		minRefetchInterval: defaultMinRefetchInterval,
+		now:                time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Загружает ключи и запускает их фоновое обновление раз в CacheTTL.
+//
+// Обновление останавливается при отмене ctx.
+//
+// Принимает:
+// - ctx: контекст жизни фонового обновления.
+//
+// Возвращает:
+// - ошибку первой загрузки (фоновое обновление запускается в любом случае).
+func (c *JWKSClient) Start(ctx context.Context) error {
+	err := c.Refresh(ctx)
+
+	go func() {
+		ticker := time.NewTicker(c.cacheTTL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = c.Refresh(ctx)
+			}
+		}
+	}()
+	return err
+}
+
+// Возвращает ключ по kid, при необходимости загружая JWKS.
+//
+// Принимает:
+// - ctx: контекст загрузки.
+// - kid: идентификатор ключа.
+//
+// Возвращает:
+// - открытый ключ.
+// - ErrKeyNotFound, если ключа нет и после повторной загрузки.
+// - ошибку загрузки, если ключей в кеше нет вовсе.
+func (c *JWKSClient) Key(ctx context.Context, kid string) (any, error) {
+	keys, fetchedAt := c.cached()
+
+	if keys == nil || c.now().Sub(fetchedAt) >= c.cacheTTL {
+		if err := c.Refresh(ctx); err != nil && keys == nil {
+			return nil, err
+		}
+		keys, fetchedAt = c.cached()
+	}
+
+	key, err := keys.Key(ctx, kid)
+	if !errors.Is(err, ErrKeyNotFound) || c.now().Sub(fetchedAt) < c.minRefetchInterval {
+		return key, err
+	}
+
+	// Неизвестный kid: возможно, ключи были ротированы. Загружаем JWKS один раз.
+	if err := c.Refresh(ctx); err != nil {
+		return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+	}
+	keys, _ = c.cached()
+	return keys.Key(ctx, kid)
+}
+
+// Загружает JWKS и заменяет кеш ключей.
+//
+// Принимает:
+// - ctx: контекст загрузки.
+//
+// Возвращает:
+// - ошибку, если JWKS не удалось загрузить или разобрать (кеш при этом не меняется).
+func (c *JWKSClient) Refresh(ctx context.Context) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	keys, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = c.now()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *JWKSClient) cached() (*KeySet, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.keys, c.fetchedAt
+}
+
+func (c *JWKSClient) fetch(ctx context.Context) (*KeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	return ParseJWKS(data)
+}
@@ -0,0 +1,142 @@
+package authtoken_test
+
+import (
+	"auth_service/pkg/authtoken"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Сервер JWKS с подменяемым набором ключей.
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     map[string]ed25519.PublicKey
+	requests atomic.Int32
+	fail     atomic.Bool
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	if s.fail.Load() {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]map[string]string, 0, len(s.keys))
+	for kid, key := range s.keys {
+		keys = append(keys, map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": kid,
+			"x":   base64.RawURLEncoding.EncodeToString(key),
+		})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+}
+
+func (s *jwksServer) setKey(kid string, key ed25519.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = map[string]ed25519.PublicKey{kid: key}
+}
+
+func signEdDSA(t *testing.T, key ed25519.PrivateKey, kid string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, validClaims())
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+// Проверка кеширования и повторной загрузки при ротации ключей.
+func TestJWKSClient_KeyRollover(t *testing.T) {
+	oldPub, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	newPub, newKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwks := &jwksServer{}
+	jwks.setKey("old", oldPub)
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	client := authtoken.NewJWKSClient(server.URL, authtoken.WithMinRefetchInterval(0))
+	verifier, err := authtoken.NewVerifier(authtoken.WithKeys(client))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = verifier.Verify(ctx, signEdDSA(t, oldKey, "old"))
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, signEdDSA(t, oldKey, "old"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), jwks.requests.Load(), "keys must be cached")
+
+	// Ротация: неизвестный kid приводит к одной повторной загрузке.
+	jwks.setKey("new", newPub)
+	_, err = verifier.Verify(ctx, signEdDSA(t, newKey, "new"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), jwks.requests.Load())
+
+	// Если ключа нет и после загрузки, токен отклоняется.
+	_, err = verifier.Verify(ctx, signEdDSA(t, oldKey, "old"))
+	assert.ErrorIs(t, err, authtoken.ErrInvalidToken)
+}
+
+// Проверка работы на кешированных ключах при недоступности JWKS.
+func TestJWKSClient_ServesStaleKeysOnError(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwks := &jwksServer{}
+	jwks.setKey("k1", pub)
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	client := authtoken.NewJWKSClient(server.URL, authtoken.WithCacheTTL(time.Millisecond))
+	require.NoError(t, client.Refresh(context.Background()))
+	verifier, err := authtoken.NewVerifier(authtoken.WithKeys(client))
+	require.NoError(t, err)
+
+	jwks.fail.Store(true)
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = verifier.Verify(context.Background(), signEdDSA(t, key, "k1"))
+	assert.NoError(t, err)
+}
+
+// Проверка ограничения частоты повторных загрузок для неизвестных kid.
+func TestJWKSClient_RefetchRateLimit(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwks := &jwksServer{}
+	jwks.setKey("k1", pub)
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	client := authtoken.NewJWKSClient(server.URL, authtoken.WithMinRefetchInterval(time.Minute))
+	verifier, err := authtoken.NewVerifier(authtoken.WithKeys(client))
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = verifier.Verify(context.Background(), signEdDSA(t, key, "unknown"))
+		assert.ErrorIs(t, err, authtoken.ErrInvalidToken)
+	}
+	assert.Equal(t, int32(1), jwks.requests.Load())
+}
@@ -0,0 +1,65 @@
+// Пакет redisrevocation доставляет в authtoken.RevocationList уведомления об
+// отзыве access-токенов, которые сервис авторизации публикует в канал Redis
+// (storage.redis.revocation_channel).
+//
+//	list := authtoken.NewRevocationList()
+//	verifier, err := authtoken.NewVerifier(authtoken.WithSecret(jwtSecret), authtoken.WithRevocationList(list))
+//	go redisrevocation.Subscribe(ctx, redisClient, "auth:revocations", list, nil)
+//
+// Pub/Sub в Redis не хранит сообщения: уведомления, отправленные, пока
+// подписка была разорвана, теряются, и такие токены действуют до истечения.
+package redisrevocation
+
+import (
+	"auth_service/pkg/authtoken"
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Канал уведомлений по умолчанию.
+const DefaultChannel = "auth:revocations"
+
+// Подписывается на канал уведомлений об отзыве и добавляет их в list до
+// отмены ctx. Разорванное соединение восстанавливается клиентом Redis.
+//
+// Принимает:
+// - ctx: контекст подписки.
+// - client: клиент Redis (*redis.Client, *redis.ClusterClient и т.п.).
+// - channel: канал уведомлений; пустая строка — DefaultChannel.
+// - list: список отозванных токенов.
+// - onError: вызывается для некорректных сообщений; может быть nil.
+//
+// Возвращает:
+// - ошибку, если подписаться не удалось; nil после отмены ctx.
+func Subscribe(ctx context.Context, client redis.UniversalClient, channel string, list *authtoken.RevocationList, onError func(error)) error {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+
+	sub := client.Subscribe(ctx, channel)
+	defer sub.Close()
+	// Дожидается подтверждения подписки, чтобы сообщить об ошибке соединения.
+	if _, err := sub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to subscribe to %s: %w", channel, err)
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			if err := list.Apply([]byte(msg.Payload)); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
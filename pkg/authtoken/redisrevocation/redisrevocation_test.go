@@ -0,0 +1,54 @@
+package redisrevocation_test
+
+import (
+	"auth_service/pkg/authtoken"
+	"auth_service/pkg/authtoken/redisrevocation"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка доставки уведомлений в список отзыва.
+// Требует запущенный Redis, адрес которого задан в TEST_REDIS_ADDR.
+func TestSubscribe(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR is not set")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { _ = client.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	list := authtoken.NewRevocationList()
+	invalid := make(chan error, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- redisrevocation.Subscribe(ctx, client, "test:revocations", list, func(err error) { invalid <- err })
+	}()
+
+	claims := &authtoken.Claims{SessionID: "session-1"}
+	require.Eventually(t, func() bool {
+		// Публикация повторяется, пока подписка не установлена.
+		payload := `{"sid":"session-1","expires_at":"` + time.Now().Add(time.Minute).Format(time.RFC3339) + `"}`
+		require.NoError(t, client.Publish(ctx, "test:revocations", payload).Err())
+		return list.Revoked(claims)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, client.Publish(ctx, "test:revocations", "garbage").Err())
+	select {
+	case err := <-invalid:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalid notice was not reported")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
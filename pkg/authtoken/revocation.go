@@ -0,0 +1,157 @@
+package authtoken
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Токен отозван: пользователь вышел из сессии или токен отозван явно.
+// Ошибка Verify при этом обёртывает и ErrInvalidToken.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// Уведомление об отзыве access-токенов, которое сервис авторизации публикует
+// при выходе пользователя и отзыве токенов.
+//
+// Задан ровно один из идентификаторов: SessionID отзывает все токены сессии,
+// TokenID — один токен. После ExpiresAt все отозванные токены истекают сами.
+type RevocationNotice struct {
+	// Идентификатор сессии (claim sid).
+	SessionID string `json:"sid,omitempty"`
+	// Идентификатор токена (claim jti).
+	TokenID   string    `json:"jti,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Разбирает уведомление об отзыве из JSON.
+//
+// Принимает:
+// - payload: тело сообщения.
+//
+// Возвращает:
+// - уведомление.
+// - ошибку, если сообщение некорректно.
+func ParseRevocationNotice(payload []byte) (RevocationNotice, error) {
+	var n RevocationNotice
+	if err := json.Unmarshal(payload, &n); err != nil {
+		return RevocationNotice{}, fmt.Errorf("failed to decode revocation notice: %w", err)
+	}
+	if (n.SessionID == "") == (n.TokenID == "") {
+		return RevocationNotice{}, errors.New("revocation notice must contain exactly one of sid and jti")
+	}
+	if n.ExpiresAt.IsZero() {
+		return RevocationNotice{}, errors.New("revocation notice has no expires_at")
+	}
+	return n, nil
+}
+
+// Интервал между удалениями истёкших записей RevocationList.
+const revocationSweepInterval = time.Minute
+
+// Список отозванных сессий и токенов в памяти сервиса-потребителя.
+//
+// Заполняется уведомлениями об отзыве (см. пакет authtoken/redisrevocation)
+// и подключается к Verifier через WithRevocationList. Записи хранятся до
+// истечения отозванных токенов. Безопасен для одновременного использования.
+type RevocationList struct {
+	mu        sync.Mutex
+	sessions  map[string]time.Time
+	tokens    map[string]time.Time
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+// Создаёт пустой RevocationList.
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		sessions: make(map[string]time.Time),
+		tokens:   make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Добавляет отзыв в список; уже истёкшие уведомления пропускаются.
+//
+// Принимает:
+// - n: уведомление об отзыве.
+func (l *RevocationList) Add(n RevocationNotice) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !n.ExpiresAt.After(now) {
+		return
+	}
+	if now.After(l.nextSweep) {
+		sweep(l.sessions, now)
+		sweep(l.tokens, now)
+		l.nextSweep = now.Add(revocationSweepInterval)
+	}
+	if n.SessionID != "" {
+		extend(l.sessions, n.SessionID, n.ExpiresAt)
+	}
+	if n.TokenID != "" {
+		extend(l.tokens, n.TokenID, n.ExpiresAt)
+	}
+}
+
+// Разбирает сообщение с уведомлением об отзыве и добавляет его в список.
+//
+// Принимает:
+// - payload: тело сообщения в формате RevocationNotice.
+//
+// Возвращает:
+// - ошибку, если сообщение некорректно.
+func (l *RevocationList) Apply(payload []byte) error {
+	n, err := ParseRevocationNotice(payload)
+	if err != nil {
+		return err
+	}
+	l.Add(n)
+	return nil
+}
+
+// Сообщает, отозваны ли токен или его сессия.
+//
+// Принимает:
+// - c: данные проверенного токена.
+//
+// Возвращает:
+// - true, если sid или jti токена есть в списке и срок записи не истёк.
+func (l *RevocationList) Revoked(c *Claims) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if exp, ok := l.sessions[c.SessionID]; ok && c.SessionID != "" && exp.After(now) {
+		return true
+	}
+	if exp, ok := l.tokens[c.ID]; ok && c.ID != "" && exp.After(now) {
+		return true
+	}
+	return false
+}
+
+// Возвращает количество записей в списке, включая ещё не удалённые истёкшие.
+func (l *RevocationList) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.sessions) + len(l.tokens)
+}
+
+// Сохраняет более поздний срок записи.
+func extend(m map[string]time.Time, id string, expiresAt time.Time) {
+	if expiresAt.After(m[id]) {
+		m[id] = expiresAt
+	}
+}
+
+func sweep(m map[string]time.Time, now time.Time) {
+	for id, exp := range m {
+		if !exp.After(now) {
+			delete(m, id)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package authtoken_test
+
+import (
+	"auth_service/pkg/authtoken"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Проверка разбора уведомлений об отзыве.
+func TestParseRevocationNotice(t *testing.T) {
+	n, err := authtoken.ParseRevocationNotice([]byte(`{"sid":"session-1","expires_at":"2030-01-01T00:00:00Z"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", n.SessionID)
+	assert.Equal(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), n.ExpiresAt)
+
+	for _, payload := range []string{
+		`not json`,
+		`{"expires_at":"2030-01-01T00:00:00Z"}`,
+		`{"sid":"s","jti":"t","expires_at":"2030-01-01T00:00:00Z"}`,
+		`{"jti":"t"}`,
+	} {
+		_, err := authtoken.ParseRevocationNotice([]byte(payload))
+		assert.Error(t, err, payload)
+	}
+}
+
+// Проверка отклонения токенов отозванной сессии и отозванных jti.
+func TestVerifier_RevocationList(t *testing.T) {
+	list := authtoken.NewRevocationList()
+	verifier, err := authtoken.NewVerifier(authtoken.WithSecret(secret), authtoken.WithRevocationList(list))
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["jti"] = "token-1"
+	token := signHS(t, claims)
+
+	_, err = verifier.Verify(context.Background(), token)
+	require.NoError(t, err)
+
+	list.Add(authtoken.RevocationNotice{SessionID: "session-1", ExpiresAt: time.Now().Add(-time.Second)})
+	assert.Zero(t, list.Len(), "expired notices are ignored")
+
+	require.NoError(t, list.Apply([]byte(`{"sid":"session-1","expires_at":"`+time.Now().Add(time.Minute).Format(time.RFC3339)+`"}`)))
+	_, err = verifier.Verify(context.Background(), token)
+	assert.ErrorIs(t, err, authtoken.ErrTokenRevoked)
+	assert.ErrorIs(t, err, authtoken.ErrInvalidToken)
+
+	other := validClaims()
+	other["sid"] = "session-2"
+	other["jti"] = "token-2"
+	_, err = verifier.Verify(context.Background(), signHS(t, other))
+	require.NoError(t, err)
+
+	list.Add(authtoken.RevocationNotice{TokenID: "token-2", ExpiresAt: time.Now().Add(time.Minute)})
+	_, err = verifier.Verify(context.Background(), signHS(t, other))
+	assert.ErrorIs(t, err, authtoken.ErrTokenRevoked)
+	assert.Equal(t, 2, list.Len())
+}
@@ -0,0 +1,109 @@
+package authtoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовок с подписью webhook: t=<unix-время>,v1=<HMAC-SHA256 в hex>[,v1=...].
+//
+// Подпись вычисляется от строки "<t>.<тело запроса>" с секретом получателя.
+// Во время ротации секрета сервис подписывает запрос каждым действующим
+// секретом, и заголовок содержит несколько значений v1.
+const WebhookSignatureHeader = "X-Auth-Signature"
+
+// Допустимое по умолчанию расхождение времени подписи и времени проверки.
+const DefaultWebhookTolerance = 5 * time.Minute
+
+var (
+	// Подпись webhook отсутствует, некорректна или не совпадает ни с одним секретом.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// Подпись webhook создана слишком давно (или в будущем): возможно повторное воспроизведение.
+	ErrSignatureExpired = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+// Вычисляет значение заголовка X-Auth-Signature.
+//
+// Принимает:
+// - payload: тело запроса.
+// - timestamp: время подписи.
+// - secrets: секреты, каждым из которых подписывается запрос.
+//
+// Возвращает:
+// - значение заголовка.
+func SignWebhook(payload []byte, timestamp time.Time, secrets ...string) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	var b strings.Builder
+	b.WriteString("t=" + t)
+	for _, secret := range secrets {
+		b.WriteString(",v1=" + webhookMAC(t, payload, secret))
+	}
+	return b.String()
+}
+
+// Проверяет подпись webhook.
+//
+// Подпись принимается, если время подписи отличается от текущего не больше
+// чем на tolerance и хотя бы одно значение v1 совпадает с подписью одним из
+// секретов. Во время ротации получатель передаёт новый и прежний секреты.
+//
+//	body, _ := io.ReadAll(r.Body)
+//	err := authtoken.VerifyWebhook(body, r.Header.Get(authtoken.WebhookSignatureHeader),
+//		authtoken.DefaultWebhookTolerance, newSecret, oldSecret)
+//
+// Принимает:
+// - payload: тело запроса в том виде, в каком оно получено.
+// - header: значение заголовка X-Auth-Signature.
+// - tolerance: допустимое расхождение времени.
+// - secrets: секреты получателя.
+//
+// Возвращает:
+// - ErrInvalidSignature или ErrSignatureExpired, если подпись не принята.
+func VerifyWebhook(payload []byte, header string, tolerance time.Duration, secrets ...string) error {
+	var t string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	for _, secret := range secrets {
+		expected := webhookMAC(t, payload, secret)
+		for _, signature := range signatures {
+			if hmac.Equal([]byte(signature), []byte(expected)) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// HMAC-SHA256 строки "<t>.<payload>" в hex.
+func webhookMAC(t string, payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,35 @@
+package authtoken_test
+
+import (
+	"auth_service/pkg/authtoken"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Проверка подписи webhook, в том числе во время ротации секрета.
+func TestVerifyWebhook(t *testing.T) {
+	payload := []byte(`{"type":"refresh_token_reuse"}`)
+	now := time.Now()
+	tolerance := authtoken.DefaultWebhookTolerance
+
+	header := authtoken.SignWebhook(payload, now, "new", "old")
+	assert.True(t, strings.HasPrefix(header, "t="))
+	assert.Equal(t, 2, strings.Count(header, "v1="))
+
+	// Получатель ещё не перешёл на новый секрет, уже перешёл или принимает оба.
+	assert.NoError(t, authtoken.VerifyWebhook(payload, header, tolerance, "old"))
+	assert.NoError(t, authtoken.VerifyWebhook(payload, header, tolerance, "new"))
+	assert.NoError(t, authtoken.VerifyWebhook(payload, authtoken.SignWebhook(payload, now, "new"), tolerance, "new", "old"))
+
+	assert.ErrorIs(t, authtoken.VerifyWebhook(payload, header, tolerance, "other"), authtoken.ErrInvalidSignature)
+	assert.ErrorIs(t, authtoken.VerifyWebhook([]byte(`{}`), header, tolerance, "new"), authtoken.ErrInvalidSignature)
+	assert.ErrorIs(t, authtoken.VerifyWebhook(payload, "v1=abc", tolerance, "new"), authtoken.ErrInvalidSignature)
+	assert.ErrorIs(t, authtoken.VerifyWebhook(payload, "", tolerance, "new"), authtoken.ErrInvalidSignature)
+
+	// Подпись, созданная раньше допустимого, не принимается, даже если верна.
+	stale := authtoken.SignWebhook(payload, now.Add(-10*time.Minute), "new")
+	assert.ErrorIs(t, authtoken.VerifyWebhook(payload, stale, tolerance, "new"), authtoken.ErrSignatureExpired)
+}
@@ -0,0 +1,195 @@
+// Пакет grpcauth содержит gRPC-перехватчики для сервисов, принимающих
+// access-токены сервиса авторизации.
+//
+// Перехватчик извлекает токен из метаданных (authorization: Bearer <token>),
+// проверяет его, помещает данные токена в контекст и проверяет наличие
+// scope, требуемых для вызываемого метода:
+//
+//	verifier := grpcauth.NewHMACVerifier(secret)
+//	server := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(grpcauth.UnaryServerInterceptor(verifier,
+//			grpcauth.WithMethodScopes(map[string][]string{
+//				"/orders.v1.Orders/Cancel": {"orders:write"},
+//			}),
+//			grpcauth.WithPublicMethods("/grpc.health.v1.Health/Check"),
+//		)),
+//		grpc.ChainStreamInterceptor(grpcauth.StreamServerInterceptor(verifier)),
+//	)
+//
+//	func (s *orders) Cancel(ctx context.Context, req *pb.CancelRequest) (*pb.CancelResponse, error) {
+//		claims, _ := grpcauth.ClaimsFromContext(ctx)
+//		...
+//	}
+package grpcauth
+
+import (
+	"auth_service/pkg/authtoken"
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Данные проверенного access-токена.
+type Claims = authtoken.Claims
+
+// Проверяет access-токен и возвращает его данные.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Claims, error)
+}
+
+// Функция, реализующая Verifier.
+type VerifierFunc func(ctx context.Context, token string) (*Claims, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, token string) (*Claims, error) {
+	return f(ctx, token)
+}
+
+type options struct {
+	methodScopes  map[string][]string
+	publicMethods map[string]bool
+}
+
+// Параметр перехватчика.
+type Option func(*options)
+
+// Задаёт scope, обязательные для методов (полное имя: /package.Service/Method).
+// Для вызова метода токен должен содержать все перечисленные scope.
+func WithMethodScopes(scopes map[string][]string) Option {
+	return func(o *options) {
+		for method, s := range scopes {
+			o.methodScopes[method] = append(o.methodScopes[method], s...)
+		}
+	}
+}
+
+// Задаёт методы, доступные без токена (например, проверки состояния).
+func WithPublicMethods(methods ...string) Option {
+	return func(o *options) {
+		for _, method := range methods {
+			o.publicMethods[method] = true
+		}
+	}
+}
+
+type claimsKey struct{}
+
+// Возвращает данные токена, помещённые в контекст перехватчиком.
+//
+// Принимает:
+// - ctx: контекст вызова.
+//
+// Возвращает:
+// - данные токена.
+// - false, если вызов не прошёл через перехватчик или метод публичный.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Помещает данные токена в контекст (например, для тестов обработчиков).
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// Создаёт unary-перехватчик, проверяющий access-токен.
+//
+// Принимает:
+// - verifier: способ проверки токена.
+// - opts: параметры перехватчика.
+//
+// Возвращает:
+// - grpc.UnaryServerInterceptor.
+func UnaryServerInterceptor(verifier Verifier, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := o.authorize(ctx, verifier, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Создаёт stream-перехватчик, проверяющий access-токен.
+//
+// Принимает:
+// - verifier: способ проверки токена.
+// - opts: параметры перехватчика.
+//
+// Возвращает:
+// - grpc.StreamServerInterceptor.
+func StreamServerInterceptor(verifier Verifier, opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := o.authorize(ss.Context(), verifier, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		methodScopes:  make(map[string][]string),
+		publicMethods: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Проверяет токен вызова и требуемые scope, возвращает контекст с данными токена.
+func (o *options) authorize(ctx context.Context, verifier Verifier, method string) (context.Context, error) {
+	if o.publicMethods[method] {
+		return ctx, nil
+	}
+
+	token, err := tokenFromMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+
+	for _, scope := range o.methodScopes[method] {
+		if !claims.HasScope(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "missing scope %q", scope)
+		}
+	}
+
+	return ContextWithClaims(ctx, claims), nil
+}
+
+// Извлекает токен из метаданных authorization: Bearer <token>.
+func tokenFromMetadata(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "authorization metadata is required")
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", status.Error(codes.Unauthenticated, "authorization must use the Bearer scheme")
+	}
+	return token, nil
+}
+
+// ServerStream с подменённым контекстом.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,90 @@
+package grpcauth_test
+
+import (
+	"auth_service/pkg/grpcauth"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const secret = "secret"
+
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return token
+}
+
+func callUnary(t *testing.T, interceptor grpc.UnaryServerInterceptor, method, authorization string) (*grpcauth.Claims, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	if authorization != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", authorization))
+	}
+
+	var claims *grpcauth.Claims
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+		claims, _ = grpcauth.ClaimsFromContext(ctx)
+		return nil, nil
+	})
+	return claims, err
+}
+
+// Проверка извлечения токена, scope и публичных методов.
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := grpcauth.UnaryServerInterceptor(grpcauth.NewHMACVerifier(secret),
+		grpcauth.WithMethodScopes(map[string][]string{"/test.Svc/Write": {"orders:write"}}),
+		grpcauth.WithPublicMethods("/grpc.health.v1.Health/Check"),
+	)
+	token := signToken(t, jwt.MapClaims{
+		"sub":   "user-1",
+		"ip":    "127.0.0.1",
+		"scope": "orders:read",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	})
+
+	claims, err := callUnary(t, interceptor, "/test.Svc/Read", "Bearer "+token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, []string{"orders:read"}, claims.Scopes)
+
+	_, err = callUnary(t, interceptor, "/test.Svc/Write", "Bearer "+token)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = callUnary(t, interceptor, "/test.Svc/Read", "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = callUnary(t, interceptor, "/test.Svc/Read", "Basic "+token)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = callUnary(t, interceptor, "/grpc.health.v1.Health/Check", "")
+	assert.NoError(t, err)
+}
+
+// Проверка отклонения недействительных токенов.
+func TestHMACVerifier_Invalid(t *testing.T) {
+	verifier := grpcauth.NewHMACVerifier(secret)
+
+	expired := signToken(t, jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(-time.Minute).Unix()})
+	_, err := verifier.Verify(context.Background(), expired)
+	assert.Error(t, err)
+
+	otherSecret, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("other"))
+	require.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), otherSecret)
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package grpcauth
+
+import "auth_service/pkg/authtoken"
+
+// Создаёт Verifier на основе authtoken.Verifier (секрет или JWKS, iss, aud, scope).
+//
+// Принимает:
+// - v: настроенный authtoken.Verifier.
+//
+// Возвращает:
+// - Verifier для перехватчиков.
+func NewVerifier(v *authtoken.Verifier) Verifier {
+	return VerifierFunc(v.Verify)
+}
+
+// Создаёт Verifier для токенов, подписанных секретом jwt_secret сервиса авторизации.
+//
+// Принимает:
+// - secret: секретный ключ подписи.
+//
+// Возвращает:
+// - Verifier для перехватчиков.
+func NewHMACVerifier(secret string) Verifier {
+	v, _ := authtoken.NewVerifier(authtoken.WithSecret(secret))
+	return NewVerifier(v)
+}
@@ -0,0 +1,58 @@
+// Пакет echoauth содержит адаптер middleware для echo:
+//
+//	e.Use(echoauth.Authenticate(verifier, "orders:read"))
+//
+//	func handler(c echo.Context) error {
+//		userID := middleware.UserID(c.Request().Context())
+//	}
+package echoauth
+
+import (
+	"auth_service/pkg/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Ключ данных токена в echo.Context.
+const ClaimsKey = "auth.claims"
+
+// Создаёт middleware для echo.
+//
+// Данные токена помещаются и в контекст запроса (middleware.ClaimsFromContext),
+// и в echo.Context под ключом ClaimsKey.
+//
+// Принимает:
+// - verifier: способ проверки токена.
+// - scopes: scope, обязательные для всех запросов через middleware.
+//
+// Возвращает:
+// - echo.MiddlewareFunc.
+func Authenticate(verifier middleware.Verifier, scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			claims, authErr := middleware.Check(req.Context(), verifier, req.Header.Get("Authorization"), scopes)
+			if authErr != nil {
+				c.Response().Header().Set("WWW-Authenticate", authErr.WWWAuthenticate())
+				return c.JSON(authErr.Status, authErr.Response())
+			}
+
+			c.SetRequest(req.WithContext(middleware.ContextWithClaims(req.Context(), claims)))
+			c.Set(ClaimsKey, claims)
+			return next(c)
+		}
+	}
+}
+
+// Возвращает данные токена из echo.Context.
+//
+// Принимает:
+// - c: контекст запроса echo.
+//
+// Возвращает:
+// - данные токена.
+// - false, если запрос не прошёл через middleware.
+func ClaimsFromContext(c echo.Context) (*middleware.Claims, bool) {
+	claims, ok := c.Get(ClaimsKey).(*middleware.Claims)
+	return claims, ok
+}
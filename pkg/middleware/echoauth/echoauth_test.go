@@ -0,0 +1,63 @@
+package echoauth_test
+
+import (
+	"auth_service/pkg/authtoken"
+	"auth_service/pkg/middleware"
+	"auth_service/pkg/middleware/echoauth"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var verifier = middleware.VerifierFunc(func(_ context.Context, token string) (*middleware.Claims, error) {
+	if token != "valid" {
+		return nil, authtoken.ErrInvalidToken
+	}
+	return &middleware.Claims{Subject: "user-1", Scopes: []string{"orders:read"}}, nil
+})
+
+// Проверка адаптера для echo.
+func TestAuthenticate(t *testing.T) {
+	e := echo.New()
+	e.GET("/orders", func(c echo.Context) error {
+		claims, ok := echoauth.ClaimsFromContext(c)
+		assert.True(t, ok)
+		assert.Equal(t, claims.Subject, middleware.UserID(c.Request().Context()))
+		return c.String(http.StatusOK, claims.Subject)
+	}, echoauth.Authenticate(verifier, "orders:read"))
+	e.GET("/admin", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, echoauth.Authenticate(verifier, "admin"))
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		status        int
+	}{
+		{name: "Valid token", path: "/orders", authorization: "Bearer valid", status: http.StatusOK},
+		{name: "Missing header", path: "/orders", status: http.StatusUnauthorized},
+		{name: "Invalid token", path: "/orders", authorization: "Bearer forged", status: http.StatusUnauthorized},
+		{name: "Missing scope", path: "/admin", authorization: "Bearer valid", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			e.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			if tt.status != http.StatusOK {
+				assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Пакет ginauth содержит адаптер middleware для gin:
+//
+//	router.Use(ginauth.Authenticate(verifier, "orders:read"))
+//
+//	func handler(c *gin.Context) {
+//		userID := middleware.UserID(c.Request.Context())
+//	}
+package ginauth
+
+import (
+	"auth_service/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ключ данных токена в gin.Context.
+const ClaimsKey = "auth.claims"
+
+// Создаёт middleware для gin.
+//
+// Данные токена помещаются и в контекст запроса (middleware.ClaimsFromContext),
+// и в gin.Context под ключом ClaimsKey.
+//
+// Принимает:
+// - verifier: способ проверки токена.
+// - scopes: scope, обязательные для всех запросов через middleware.
+//
+// Возвращает:
+// - gin.HandlerFunc.
+func Authenticate(verifier middleware.Verifier, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, authErr := middleware.Check(c.Request.Context(), verifier, c.GetHeader("Authorization"), scopes)
+		if authErr != nil {
+			c.Header("WWW-Authenticate", authErr.WWWAuthenticate())
+			c.AbortWithStatusJSON(authErr.Status, authErr.Response())
+			return
+		}
+
+		c.Request = c.Request.WithContext(middleware.ContextWithClaims(c.Request.Context(), claims))
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// Возвращает данные токена из gin.Context.
+//
+// Принимает:
+// - c: контекст запроса gin.
+//
+// Возвращает:
+// - данные токена.
+// - false, если запрос не прошёл через middleware.
+func ClaimsFromContext(c *gin.Context) (*middleware.Claims, bool) {
+	claims, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	typed, ok := claims.(*middleware.Claims)
+	return typed, ok
+}
@@ -0,0 +1,64 @@
+package ginauth_test
+
+import (
+	"auth_service/pkg/authtoken"
+	"auth_service/pkg/middleware"
+	"auth_service/pkg/middleware/ginauth"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var verifier = middleware.VerifierFunc(func(_ context.Context, token string) (*middleware.Claims, error) {
+	if token != "valid" {
+		return nil, authtoken.ErrInvalidToken
+	}
+	return &middleware.Claims{Subject: "user-1", Scopes: []string{"orders:read"}}, nil
+})
+
+// Проверка адаптера для gin.
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/orders", ginauth.Authenticate(verifier, "orders:read"), func(c *gin.Context) {
+		claims, ok := ginauth.ClaimsFromContext(c)
+		assert.True(t, ok)
+		assert.Equal(t, claims.Subject, middleware.UserID(c.Request.Context()))
+		c.String(http.StatusOK, claims.Subject)
+	})
+	router.GET("/admin", ginauth.Authenticate(verifier, "admin"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		status        int
+	}{
+		{name: "Valid token", path: "/orders", authorization: "Bearer valid", status: http.StatusOK},
+		{name: "Missing header", path: "/orders", status: http.StatusUnauthorized},
+		{name: "Invalid token", path: "/orders", authorization: "Bearer forged", status: http.StatusUnauthorized},
+		{name: "Missing scope", path: "/admin", authorization: "Bearer valid", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			if tt.status != http.StatusOK {
+				assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Пакет middleware содержит HTTP middleware для сервисов, принимающих
+// access-токены сервиса авторизации.
+//
+// Middleware проверяет токен из заголовка Authorization: Bearer <token>,
+// помещает данные токена в контекст запроса и единообразно отвечает
+// 401 Unauthorized (нет токена или он недействителен) и 403 Forbidden
+// (нет требуемого scope) с заголовком WWW-Authenticate по RFC 6750.
+//
+// net/http и chi:
+//
+//	verifier, _ := authtoken.NewVerifier(authtoken.WithSecret(secret))
+//	r.Use(middleware.Authenticate(verifier, "orders:read"))
+//
+//	func handler(w http.ResponseWriter, r *http.Request) {
+//		userID := middleware.UserID(r.Context())
+//	}
+//
+// Адаптеры для gin и echo находятся в пакетах ginauth и echoauth.
+package middleware
+
+import (
+	"auth_service/pkg/authtoken"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Данные проверенного access-токена.
+type Claims = authtoken.Claims
+
+// Проверяет access-токен; реализуется *authtoken.Verifier.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Claims, error)
+}
+
+// Функция, реализующая Verifier.
+type VerifierFunc func(ctx context.Context, token string) (*Claims, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, token string) (*Claims, error) {
+	return f(ctx, token)
+}
+
+// Ошибка аутентификации или авторизации с готовым HTTP-ответом.
+type Error struct {
+	// HTTP-статус: 401 или 403.
+	Status int
+	// Код ошибки по RFC 6750: invalid_request, invalid_token или insufficient_scope.
+	Code string
+	// Описание ошибки для клиента.
+	Description string
+	// Недостающий scope (для insufficient_scope).
+	Scope string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// Возвращает значение заголовка WWW-Authenticate.
+func (e *Error) WWWAuthenticate() string {
+	if e.Code == "invalid_request" {
+		return "Bearer"
+	}
+	value := fmt.Sprintf("Bearer error=%q, error_description=%q", e.Code, e.Description)
+	if e.Scope != "" {
+		value += fmt.Sprintf(", scope=%q", e.Scope)
+	}
+	return value
+}
+
+// Тело ответа с ошибкой.
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Возвращает тело ответа с ошибкой.
+func (e *Error) Response() ErrorResponse {
+	return ErrorResponse{Error: e.Code, ErrorDescription: e.Description}
+}
+
+type claimsKey struct{}
+
+// Возвращает данные токена, помещённые в контекст middleware.
+//
+// Принимает:
+// - ctx: контекст запроса.
+//
+// Возвращает:
+// - данные токена.
+// - false, если запрос не прошёл через middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Помещает данные токена в контекст.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// Возвращает идентификатор пользователя из контекста или пустую строку.
+func UserID(ctx context.Context) string {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.Subject
+	}
+	return ""
+}
+
+// Возвращает scope токена из контекста.
+func Scopes(ctx context.Context) []string {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.Scopes
+	}
+	return nil
+}
+
+// Создаёт middleware для net/http и chi.
+//
+// Принимает:
+// - verifier: способ проверки токена.
+// - scopes: scope, обязательные для всех запросов через middleware.
+//
+// Возвращает:
+// - middleware вида func(http.Handler) http.Handler.
+func Authenticate(verifier Verifier, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, authErr := Check(r.Context(), verifier, r.Header.Get("Authorization"), scopes)
+			if authErr != nil {
+				WriteError(w, authErr)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// Проверяет заголовок Authorization и наличие scope.
+//
+// Используется адаптерами для других роутеров.
+//
+// Принимает:
+// - ctx: контекст запроса.
+// - verifier: способ проверки токена.
+// - authorization: значение заголовка Authorization.
+// - scopes: обязательные scope.
+//
+// Возвращает:
+// - данные токена.
+// - *Error, если запрос нужно отклонить.
+func Check(ctx context.Context, verifier Verifier, authorization string, scopes []string) (*Claims, *Error) {
+	if authorization == "" {
+		return nil, &Error{Status: http.StatusUnauthorized, Code: "invalid_request", Description: "authorization header is required"}
+	}
+
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return nil, &Error{Status: http.StatusUnauthorized, Code: "invalid_request", Description: "authorization header must use the Bearer scheme"}
+	}
+
+	claims, err := verifier.Verify(ctx, token)
+	if err != nil {
+		if errors.Is(err, authtoken.ErrInsufficientScope) {
+			return nil, &Error{Status: http.StatusForbidden, Code: "insufficient_scope", Description: "token does not have the required scope"}
+		}
+		return nil, &Error{Status: http.StatusUnauthorized, Code: "invalid_token", Description: "access token is invalid or expired"}
+	}
+
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return nil, &Error{Status: http.StatusForbidden, Code: "insufficient_scope", Description: "token does not have the required scope", Scope: scope}
+		}
+	}
+	return claims, nil
+}
+
+// Отправляет ответ с ошибкой аутентификации в формате JSON.
+//
+// Принимает:
+// - w: http.ResponseWriter для отправки ответа клиенту.
+// - authErr: ошибка аутентификации.
+func WriteError(w http.ResponseWriter, authErr *Error) {
+	w.Header().Set("WWW-Authenticate", authErr.WWWAuthenticate())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(authErr.Status)
+	_ = json.NewEncoder(w).Encode(authErr.Response())
+}
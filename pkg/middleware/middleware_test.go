@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"auth_service/pkg/authtoken"
+	"auth_service/pkg/middleware"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Принимает токен "valid" со scope orders:read.
+var verifier = middleware.VerifierFunc(func(_ context.Context, token string) (*middleware.Claims, error) {
+	if token != "valid" {
+		return nil, authtoken.ErrInvalidToken
+	}
+	return &middleware.Claims{Subject: "user-1", Scopes: []string{"orders:read"}}, nil
+})
+
+func serve(t *testing.T, handler http.Handler, authorization string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// Проверка middleware для net/http.
+func TestAuthenticate(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, []string{"orders:read"}, middleware.Scopes(r.Context()))
+		_, _ = w.Write([]byte(middleware.UserID(r.Context())))
+	})
+
+	tests := []struct {
+		name          string
+		scopes        []string
+		authorization string
+		status        int
+		code          string
+	}{
+		{name: "Valid token", authorization: "Bearer valid", status: http.StatusOK},
+		{name: "Scheme is case-insensitive", authorization: "bearer valid", status: http.StatusOK},
+		{name: "Required scope present", scopes: []string{"orders:read"}, authorization: "Bearer valid", status: http.StatusOK},
+		{name: "Missing header", status: http.StatusUnauthorized, code: "invalid_request"},
+		{name: "Wrong scheme", authorization: "Basic dXNlcjpwYXNz", status: http.StatusUnauthorized, code: "invalid_request"},
+		{name: "Invalid token", authorization: "Bearer forged", status: http.StatusUnauthorized, code: "invalid_token"},
+		{name: "Missing scope", scopes: []string{"orders:write"}, authorization: "Bearer valid", status: http.StatusForbidden, code: "insufficient_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(t, middleware.Authenticate(verifier, tt.scopes...)(next), tt.authorization)
+			require.Equal(t, tt.status, rr.Code)
+
+			if tt.code == "" {
+				assert.Equal(t, "user-1", rr.Body.String())
+				return
+			}
+
+			var resp middleware.ErrorResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			assert.Equal(t, tt.code, resp.Error)
+			assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "Bearer")
+		})
+	}
+}
+
+// Проверка заголовка WWW-Authenticate при нехватке scope.
+func TestAuthenticate_InsufficientScopeHeader(t *testing.T) {
+	handler := middleware.Authenticate(verifier, "orders:write")(http.NotFoundHandler())
+
+	rr := serve(t, handler, "Bearer valid")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+	assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `scope="orders:write"`)
+}